@@ -8,8 +8,26 @@ import (
 type AppendOptions struct {
 	Flags []Flag
 	Time  time.Time
+
+	// How clients handle flags which can't be stored permanently in the
+	// destination mailbox. Only applies when the destination mailbox is the
+	// selected mailbox, since PERMANENTFLAGS is unknown for other mailboxes.
+	UnsupportedFlags UnsupportedFlagsMode
 }
 
+// UnsupportedFlagsMode indicates how a client handles APPEND flags which are
+// missing from the PERMANENTFLAGS of the destination mailbox.
+type UnsupportedFlagsMode int
+
+const (
+	// Send the flags anyway, the server may reject the command
+	UnsupportedFlagsSend UnsupportedFlagsMode = iota
+	// Remove the flags from the command
+	UnsupportedFlagsStrip
+	// Fail without sending the command
+	UnsupportedFlagsReject
+)
+
 // AppendData is the data returned by an APPEND command.
 type AppendData struct {
 	UID, UIDValidity uint32 // requires UIDPLUS or IMAP4rev2
@@ -41,10 +41,13 @@ const (
 	CapCatenate         Cap = "CATENATE"           // RFC 4469
 	CapChildren         Cap = "CHILDREN"           // RFC 3348
 	CapCondStore        Cap = "CONDSTORE"          // RFC 7162
+	CapContextSearch    Cap = "CONTEXT=SEARCH"     // RFC 5267
 	CapConvert          Cap = "CONVERT"            // RFC 5259
 	CapCreateSpecialUse Cap = "CREATE-SPECIAL-USE" // RFC 6154
 	CapESort            Cap = "ESORT"              // RFC 5267
 	CapFilters          Cap = "FILTERS"            // RFC 5466
+	CapI18NLevel1       Cap = "I18NLEVEL=1"        // RFC 5255
+	CapI18NLevel2       Cap = "I18NLEVEL=2"        // RFC 5255
 	CapID               Cap = "ID"                 // RFC 2971
 	CapLanguage         Cap = "LANGUAGE"           // RFC 5255
 	CapListMyRights     Cap = "LIST-MYRIGHTS"      // RFC 8440
@@ -65,11 +65,12 @@ func main() {
 
 	server := imapserver.New(&imapserver.Options{
 		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
-			return memServer.NewSession(), nil
+			return memServer.NewConnSession(conn), nil
 		},
 		Caps: imap.CapSet{
-			imap.CapIMAP4rev1: {},
-			imap.CapIMAP4rev2: {},
+			imap.CapIMAP4rev1:  {},
+			imap.CapIMAP4rev2:  {},
+			imap.CapI18NLevel1: {},
 		},
 		TLSConfig:    tlsConfig,
 		InsecureAuth: insecureAuth,
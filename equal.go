@@ -0,0 +1,507 @@
+package imap
+
+import (
+	"encoding/binary"
+	"hash"
+	"hash/fnv"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The Equal methods and functions below compare values semantically, as
+// they would be interpreted by a server, unlike reflect.DeepEqual:
+//
+//   - nil and empty slices and maps are equal
+//   - case-insensitive values are compared case-insensitively: MIME types,
+//     parameter names, content transfer encodings, address hosts and flags
+//   - envelope dates are compared as points in time, regardless of their
+//     time zone and formatting
+//   - search criteria dates are compared by day only
+//
+// The Hash methods and functions return a hash consistent with Equal: equal
+// values have the same hash. Hashes don't depend on the process, so they can
+// be used as keys of persistent caches.
+
+// Equal checks whether two envelopes are equal.
+func (env *Envelope) Equal(other *Envelope) bool {
+	if env == nil || other == nil {
+		return env == other
+	}
+	return envelopeDateEqual(env.Date, other.Date) &&
+		env.Subject == other.Subject &&
+		addressesEqual(env.From, other.From) &&
+		addressesEqual(env.Sender, other.Sender) &&
+		addressesEqual(env.ReplyTo, other.ReplyTo) &&
+		addressesEqual(env.To, other.To) &&
+		addressesEqual(env.Cc, other.Cc) &&
+		addressesEqual(env.Bcc, other.Bcc) &&
+		env.InReplyTo == other.InReplyTo &&
+		env.MessageID == other.MessageID
+}
+
+// Hash returns a hash of the envelope.
+func (env *Envelope) Hash() uint64 {
+	h := newHasher()
+	h.envelope(env)
+	return h.Sum64()
+}
+
+func envelopeDateEqual(a, b string) bool {
+	ta, errA := mail.ParseDate(a)
+	tb, errB := mail.ParseDate(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return ta.Equal(tb)
+}
+
+func addressesEqual(a, b []Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Name != b[i].Name || a[i].Mailbox != b[i].Mailbox || !strings.EqualFold(a[i].Host, b[i].Host) {
+			return false
+		}
+	}
+	return true
+}
+
+// BodyStructureEqual checks whether two body structures are equal.
+func BodyStructureEqual(a, b BodyStructure) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case *BodyStructureSinglePart:
+		b, ok := b.(*BodyStructureSinglePart)
+		return ok && singlePartEqual(a, b)
+	case *BodyStructureMultiPart:
+		b, ok := b.(*BodyStructureMultiPart)
+		return ok && multiPartEqual(a, b)
+	default:
+		panic("unreachable")
+	}
+}
+
+// HashBodyStructure returns a hash of the body structure.
+func HashBodyStructure(bs BodyStructure) uint64 {
+	h := newHasher()
+	h.bodyStructure(bs)
+	return h.Sum64()
+}
+
+func singlePartEqual(a, b *BodyStructureSinglePart) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if !strings.EqualFold(a.Type, b.Type) || !strings.EqualFold(a.Subtype, b.Subtype) ||
+		!paramsEqual(a.Params, b.Params) || a.ID != b.ID || a.Description != b.Description ||
+		!strings.EqualFold(a.Encoding, b.Encoding) || a.Size != b.Size {
+		return false
+	}
+
+	if (a.MessageRFC822 == nil) != (b.MessageRFC822 == nil) {
+		return false
+	} else if a.MessageRFC822 != nil {
+		am, bm := a.MessageRFC822, b.MessageRFC822
+		if !am.Envelope.Equal(bm.Envelope) || !BodyStructureEqual(am.BodyStructure, bm.BodyStructure) || am.NumLines != bm.NumLines {
+			return false
+		}
+	}
+
+	if (a.Text == nil) != (b.Text == nil) {
+		return false
+	} else if a.Text != nil && a.Text.NumLines != b.Text.NumLines {
+		return false
+	}
+
+	if (a.Extended == nil) != (b.Extended == nil) {
+		return false
+	} else if a.Extended != nil {
+		ae, be := a.Extended, b.Extended
+		if !dispositionEqual(ae.Disposition, be.Disposition) || !stringsEqual(ae.Language, be.Language) || ae.Location != be.Location {
+			return false
+		}
+	}
+	return true
+}
+
+func multiPartEqual(a, b *BodyStructureMultiPart) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if len(a.Children) != len(b.Children) || !strings.EqualFold(a.Subtype, b.Subtype) {
+		return false
+	}
+	for i := range a.Children {
+		if !BodyStructureEqual(a.Children[i], b.Children[i]) {
+			return false
+		}
+	}
+
+	if (a.Extended == nil) != (b.Extended == nil) {
+		return false
+	} else if a.Extended != nil {
+		ae, be := a.Extended, b.Extended
+		if !paramsEqual(ae.Params, be.Params) || !dispositionEqual(ae.Disposition, be.Disposition) || !stringsEqual(ae.Language, be.Language) || ae.Location != be.Location {
+			return false
+		}
+	}
+	return true
+}
+
+func dispositionEqual(a, b *BodyStructureDisposition) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return strings.EqualFold(a.Value, b.Value) && paramsEqual(a.Params, b.Params)
+}
+
+// paramsEqual compares MIME parameters. Parameter names are
+// case-insensitive.
+func paramsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	bl := make(map[string]string, len(b))
+	for k, v := range b {
+		bl[strings.ToLower(k)] = v
+	}
+	for k, v := range a {
+		if bv, ok := bl[strings.ToLower(k)]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
+
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// FlagsEqual checks whether two lists contain the same flags. The order and
+// duplicates are ignored, and flags are compared case-insensitively.
+func FlagsEqual(a, b []Flag) bool {
+	ca, cb := canonicalFlags(a), canonicalFlags(b)
+	if len(ca) != len(cb) {
+		return false
+	}
+	for i := range ca {
+		if ca[i] != cb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// HashFlags returns a hash of a list of flags.
+func HashFlags(flags []Flag) uint64 {
+	h := newHasher()
+	h.flags(flags)
+	return h.Sum64()
+}
+
+// canonicalFlags returns the sorted, lower-case and de-duplicated flags.
+func canonicalFlags(flags []Flag) []string {
+	l := make([]string, 0, len(flags))
+	seen := make(map[string]struct{}, len(flags))
+	for _, flag := range flags {
+		s := strings.ToLower(string(flag))
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		l = append(l, s)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Equal checks whether two search criteria are equal.
+//
+// Flags are compared as sets, other keys are compared in order. Use
+// SearchCriteria.Optimize first to compare criteria matching the same
+// messages but written differently.
+func (criteria *SearchCriteria) Equal(other *SearchCriteria) bool {
+	if criteria == nil || other == nil {
+		return criteria == other
+	}
+	if criteria.SeqNum.Canonical().String() != other.SeqNum.Canonical().String() ||
+		criteria.UID.Canonical().String() != other.UID.Canonical().String() ||
+		!searchDateEqual(criteria.Since, other.Since) ||
+		!searchDateEqual(criteria.Before, other.Before) ||
+		!searchDateEqual(criteria.SentSince, other.SentSince) ||
+		!searchDateEqual(criteria.SentBefore, other.SentBefore) ||
+		!stringsEqual(criteria.Body, other.Body) ||
+		!stringsEqual(criteria.Text, other.Text) ||
+		!FlagsEqual(criteria.Flag, other.Flag) ||
+		!FlagsEqual(criteria.NotFlag, other.NotFlag) ||
+		criteria.Larger != other.Larger ||
+		criteria.Smaller != other.Smaller ||
+		criteria.Older/time.Second != other.Older/time.Second ||
+		criteria.Younger/time.Second != other.Younger/time.Second {
+		return false
+	}
+
+	if len(criteria.Header) != len(other.Header) {
+		return false
+	}
+	for i := range criteria.Header {
+		a, b := criteria.Header[i], other.Header[i]
+		if !strings.EqualFold(a.Key, b.Key) || a.Value != b.Value {
+			return false
+		}
+	}
+
+	if (criteria.ModSeq == nil) != (other.ModSeq == nil) {
+		return false
+	} else if criteria.ModSeq != nil && *criteria.ModSeq != *other.ModSeq {
+		return false
+	}
+
+	if len(criteria.Not) != len(other.Not) || len(criteria.Or) != len(other.Or) {
+		return false
+	}
+	for i := range criteria.Not {
+		if !criteria.Not[i].Equal(&other.Not[i]) {
+			return false
+		}
+	}
+	for i := range criteria.Or {
+		if !criteria.Or[i][0].Equal(&other.Or[i][0]) || !criteria.Or[i][1].Equal(&other.Or[i][1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Hash returns a hash of the search criteria.
+func (criteria *SearchCriteria) Hash() uint64 {
+	h := newHasher()
+	h.searchCriteria(criteria)
+	return h.Sum64()
+}
+
+func searchDateEqual(a, b time.Time) bool {
+	if a.IsZero() || b.IsZero() {
+		return a.IsZero() == b.IsZero()
+	}
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// hasher writes the canonical form of values to a hash. Strings are
+// length-prefixed and optional values are preceded by a presence marker, so
+// that different values can't produce the same byte sequence.
+type hasher struct {
+	hash.Hash64
+}
+
+func newHasher() *hasher {
+	return &hasher{fnv.New64a()}
+}
+
+func (h *hasher) uint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	h.Write(b[:])
+}
+
+func (h *hasher) bool(v bool) {
+	if v {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+}
+
+func (h *hasher) string(s string) {
+	h.uint64(uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+func (h *hasher) strings(l []string) {
+	h.uint64(uint64(len(l)))
+	for _, s := range l {
+		h.string(s)
+	}
+}
+
+func (h *hasher) envelope(env *Envelope) {
+	h.bool(env != nil)
+	if env == nil {
+		return
+	}
+	if t, err := mail.ParseDate(env.Date); err == nil {
+		h.bool(true)
+		h.uint64(uint64(t.Unix()))
+		h.uint64(uint64(t.Nanosecond()))
+	} else {
+		h.bool(false)
+		h.string(env.Date)
+	}
+	h.string(env.Subject)
+	for _, l := range [][]Address{env.From, env.Sender, env.ReplyTo, env.To, env.Cc, env.Bcc} {
+		h.uint64(uint64(len(l)))
+		for _, addr := range l {
+			h.string(addr.Name)
+			h.string(addr.Mailbox)
+			h.string(strings.ToLower(addr.Host))
+		}
+	}
+	h.string(env.InReplyTo)
+	h.string(env.MessageID)
+}
+
+func (h *hasher) bodyStructure(bs BodyStructure) {
+	switch bs := bs.(type) {
+	case nil:
+		h.Write([]byte{0})
+	case *BodyStructureSinglePart:
+		h.Write([]byte{1})
+		h.singlePart(bs)
+	case *BodyStructureMultiPart:
+		h.Write([]byte{2})
+		h.multiPart(bs)
+	}
+}
+
+func (h *hasher) singlePart(bs *BodyStructureSinglePart) {
+	h.bool(bs != nil)
+	if bs == nil {
+		return
+	}
+	h.string(strings.ToLower(bs.Type))
+	h.string(strings.ToLower(bs.Subtype))
+	h.params(bs.Params)
+	h.string(bs.ID)
+	h.string(bs.Description)
+	h.string(strings.ToLower(bs.Encoding))
+	h.uint64(uint64(bs.Size))
+
+	h.bool(bs.MessageRFC822 != nil)
+	if msg := bs.MessageRFC822; msg != nil {
+		h.envelope(msg.Envelope)
+		h.bodyStructure(msg.BodyStructure)
+		h.uint64(uint64(msg.NumLines))
+	}
+	h.bool(bs.Text != nil)
+	if bs.Text != nil {
+		h.uint64(uint64(bs.Text.NumLines))
+	}
+	h.bool(bs.Extended != nil)
+	if ext := bs.Extended; ext != nil {
+		h.disposition(ext.Disposition)
+		h.strings(ext.Language)
+		h.string(ext.Location)
+	}
+}
+
+func (h *hasher) multiPart(bs *BodyStructureMultiPart) {
+	h.bool(bs != nil)
+	if bs == nil {
+		return
+	}
+	h.uint64(uint64(len(bs.Children)))
+	for _, child := range bs.Children {
+		h.bodyStructure(child)
+	}
+	h.string(strings.ToLower(bs.Subtype))
+	h.bool(bs.Extended != nil)
+	if ext := bs.Extended; ext != nil {
+		h.params(ext.Params)
+		h.disposition(ext.Disposition)
+		h.strings(ext.Language)
+		h.string(ext.Location)
+	}
+}
+
+func (h *hasher) disposition(disp *BodyStructureDisposition) {
+	h.bool(disp != nil)
+	if disp != nil {
+		h.string(strings.ToLower(disp.Value))
+		h.params(disp.Params)
+	}
+}
+
+func (h *hasher) params(params map[string]string) {
+	keys := make([]string, 0, len(params))
+	values := make(map[string]string, len(params))
+	for k, v := range params {
+		k = strings.ToLower(k)
+		keys = append(keys, k)
+		values[k] = v
+	}
+	sort.Strings(keys)
+	h.uint64(uint64(len(keys)))
+	for _, k := range keys {
+		h.string(k)
+		h.string(values[k])
+	}
+}
+
+func (h *hasher) flags(flags []Flag) {
+	h.strings(canonicalFlags(flags))
+}
+
+func (h *hasher) searchDate(t time.Time) {
+	h.bool(!t.IsZero())
+	if !t.IsZero() {
+		y, m, d := t.Date()
+		h.uint64(uint64(y))
+		h.uint64(uint64(m))
+		h.uint64(uint64(d))
+	}
+}
+
+func (h *hasher) searchCriteria(criteria *SearchCriteria) {
+	h.bool(criteria != nil)
+	if criteria == nil {
+		return
+	}
+	h.string(criteria.SeqNum.Canonical().String())
+	h.string(criteria.UID.Canonical().String())
+	h.searchDate(criteria.Since)
+	h.searchDate(criteria.Before)
+	h.searchDate(criteria.SentSince)
+	h.searchDate(criteria.SentBefore)
+	h.uint64(uint64(len(criteria.Header)))
+	for _, field := range criteria.Header {
+		h.string(strings.ToLower(field.Key))
+		h.string(field.Value)
+	}
+	h.strings(criteria.Body)
+	h.strings(criteria.Text)
+	h.flags(criteria.Flag)
+	h.flags(criteria.NotFlag)
+	h.uint64(uint64(criteria.Larger))
+	h.uint64(uint64(criteria.Smaller))
+	h.uint64(uint64(criteria.Older / time.Second))
+	h.uint64(uint64(criteria.Younger / time.Second))
+	h.bool(criteria.ModSeq != nil)
+	if modSeq := criteria.ModSeq; modSeq != nil {
+		h.uint64(modSeq.ModSeq)
+		h.string(modSeq.MetadataName)
+		h.string(string(modSeq.MetadataType))
+	}
+	h.uint64(uint64(len(criteria.Not)))
+	for i := range criteria.Not {
+		h.searchCriteria(&criteria.Not[i])
+	}
+	h.uint64(uint64(len(criteria.Or)))
+	for i := range criteria.Or {
+		h.searchCriteria(&criteria.Or[i][0])
+		h.searchCriteria(&criteria.Or[i][1])
+	}
+}
@@ -0,0 +1,122 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnvelope_Equal(t *testing.T) {
+	a := &Envelope{
+		Date:    "Mon, 02 Jan 2006 15:04:05 -0700",
+		Subject: "Hello",
+		From:    []Address{{Name: "Alice", Mailbox: "alice", Host: "example.org"}},
+		To:      []Address{},
+	}
+	b := &Envelope{
+		Date:    "Mon, 2 Jan 2006 22:04:05 +0000",
+		Subject: "Hello",
+		From:    []Address{{Name: "Alice", Mailbox: "alice", Host: "EXAMPLE.ORG"}},
+	}
+	if !a.Equal(b) {
+		t.Errorf("Equal() = false, want true")
+	}
+	if a.Hash() != b.Hash() {
+		t.Errorf("Hash() differ for equal envelopes")
+	}
+
+	b.Subject = "Re: Hello"
+	if a.Equal(b) {
+		t.Errorf("Equal() = true for different subjects")
+	}
+	if a.Equal(nil) || !(*Envelope)(nil).Equal(nil) {
+		t.Errorf("Equal() mishandles nil")
+	}
+}
+
+func TestBodyStructureEqual(t *testing.T) {
+	newBS := func(typ, charset string, params map[string]string) BodyStructure {
+		return &BodyStructureMultiPart{
+			Subtype: "mixed",
+			Children: []BodyStructure{
+				&BodyStructureSinglePart{
+					Type:     typ,
+					Subtype:  "plain",
+					Params:   map[string]string{charset: "utf-8"},
+					Encoding: "7bit",
+					Text:     &BodyStructureText{NumLines: 1},
+				},
+			},
+			Extended: &BodyStructureMultiPartExt{Params: params},
+		}
+	}
+
+	a := newBS("text", "charset", nil)
+	b := newBS("TEXT", "CHARSET", map[string]string{})
+	if !BodyStructureEqual(a, b) {
+		t.Errorf("BodyStructureEqual() = false, want true")
+	}
+	if HashBodyStructure(a) != HashBodyStructure(b) {
+		t.Errorf("HashBodyStructure() differ for equal body structures")
+	}
+
+	c := newBS("application", "charset", nil)
+	if BodyStructureEqual(a, c) {
+		t.Errorf("BodyStructureEqual() = true for different types")
+	}
+	if BodyStructureEqual(a, nil) || !BodyStructureEqual(nil, nil) {
+		t.Errorf("BodyStructureEqual() mishandles nil")
+	}
+}
+
+func TestFlagsEqual(t *testing.T) {
+	a := []Flag{FlagSeen, "$Label1", FlagSeen}
+	b := []Flag{"$label1", "\\SEEN"}
+	if !FlagsEqual(a, b) {
+		t.Errorf("FlagsEqual() = false, want true")
+	}
+	if HashFlags(a) != HashFlags(b) {
+		t.Errorf("HashFlags() differ for equal flags")
+	}
+	if FlagsEqual(a, []Flag{FlagSeen}) {
+		t.Errorf("FlagsEqual() = true for different flags")
+	}
+	if !FlagsEqual(nil, []Flag{}) || HashFlags(nil) != HashFlags([]Flag{}) {
+		t.Errorf("nil and empty flags differ")
+	}
+}
+
+func TestSearchCriteria_Equal(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skipf("time.LoadLocation() = %v", err)
+	}
+
+	a := &SearchCriteria{
+		UID:    SeqSet{Seq{Start: 3, Stop: 4}, Seq{Start: 1, Stop: 2}},
+		Since:  time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC),
+		Header: []SearchCriteriaHeaderField{{Key: "Subject", Value: "hello"}},
+		Flag:   []Flag{FlagSeen, FlagFlagged},
+		Not:    []SearchCriteria{{Body: []string{"spam"}}},
+	}
+	b := &SearchCriteria{
+		UID:    SeqSetRange(1, 4),
+		Since:  time.Date(2024, time.March, 1, 23, 0, 0, 0, paris),
+		Header: []SearchCriteriaHeaderField{{Key: "SUBJECT", Value: "hello"}},
+		Flag:   []Flag{FlagFlagged, FlagSeen},
+		Not:    []SearchCriteria{{Body: []string{"spam"}, Text: []string{}}},
+	}
+	if !a.Equal(b) {
+		t.Errorf("Equal() = false, want true")
+	}
+	if a.Hash() != b.Hash() {
+		t.Errorf("Hash() differ for equal criteria")
+	}
+
+	b.Not[0].Body = []string{"ham"}
+	if a.Equal(b) {
+		t.Errorf("Equal() = true for different NOT keys")
+	}
+	if a.Hash() == b.Hash() {
+		t.Errorf("Hash() equal for different criteria")
+	}
+}
@@ -0,0 +1,109 @@
+// Command idlenotify prints a line for each new message delivered to a
+// mailbox, using IDLE to get notified by the server.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// Servers may drop idle connections after 30 minutes, see RFC 9051 section
+// 5.4
+const idleTimeout = 25 * time.Minute
+
+var (
+	addr     string
+	username string
+	password string
+	mailbox  string
+)
+
+func main() {
+	flag.StringVar(&addr, "addr", "localhost:993", "IMAP server address")
+	flag.StringVar(&username, "username", "", "Username")
+	flag.StringVar(&password, "password", "", "Password")
+	flag.StringVar(&mailbox, "mailbox", "INBOX", "Mailbox to watch")
+	flag.Parse()
+
+	// The handler is called by the goroutine reading responses: it must not
+	// send commands, so it only signals the main loop
+	newMessages := make(chan uint32, 1)
+	c, err := imapclient.DialTLS(addr, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+				if data.NumMessages == nil {
+					return
+				}
+				select {
+				case <-newMessages:
+				default:
+				}
+				newMessages <- *data.NumMessages
+			},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to dial IMAP server: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Login(username, password).Wait(); err != nil {
+		log.Fatalf("Failed to login: %v", err)
+	}
+	selectData, err := c.Select(mailbox).Wait()
+	if err != nil {
+		log.Fatalf("Failed to select %v: %v", mailbox, err)
+	}
+	log.Printf("Watching %v, %v messages", mailbox, selectData.NumMessages)
+
+	prevNum := selectData.NumMessages
+	for {
+		idleCmd, err := c.Idle()
+		if err != nil {
+			log.Fatalf("Failed to start IDLE: %v", err)
+		}
+
+		var num uint32
+		select {
+		case num = <-newMessages:
+		case <-time.After(idleTimeout):
+			num = prevNum
+		case <-c.Done():
+			log.Fatalf("Connection closed: %v", c.Err())
+		}
+
+		if err := idleCmd.Close(); err != nil {
+			log.Fatalf("Failed to stop IDLE: %v", err)
+		}
+		if err := idleCmd.Wait(); err != nil {
+			log.Fatalf("IDLE command failed: %v", err)
+		}
+
+		if num > prevNum {
+			if err := printMessages(c, prevNum+1, num); err != nil {
+				log.Fatalf("Failed to fetch new messages: %v", err)
+			}
+		}
+		prevNum = num
+	}
+}
+
+func printMessages(c *imapclient.Client, start, stop uint32) error {
+	seqSet := imap.SeqSetRange(start, stop)
+	msgs, err := c.Fetch(seqSet, []imap.FetchItem{imap.FetchItemEnvelope}).Collect()
+	if err != nil {
+		return err
+	}
+	for _, msg := range msgs {
+		var from string
+		if len(msg.Envelope.From) > 0 {
+			from = msg.Envelope.From[0].Addr()
+		}
+		log.Printf("New message from %v: %v", from, msg.Envelope.Subject)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Command maildir archives an IMAP mailbox to a local Maildir.
+//
+// The client runs in low-memory mode: messages are written to disk as they
+// are received.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+var (
+	addr     string
+	username string
+	password string
+	mailbox  string
+	dir      string
+)
+
+// maildirFlags maps lower-case IMAP flags to Maildir info flags.
+var maildirFlags = map[string]byte{
+	`\draft`:    'D',
+	`\flagged`:  'F',
+	`\answered`: 'R',
+	`\seen`:     'S',
+	`\deleted`:  'T',
+}
+
+func main() {
+	flag.StringVar(&addr, "addr", "localhost:993", "IMAP server address")
+	flag.StringVar(&username, "username", "", "Username")
+	flag.StringVar(&password, "password", "", "Password")
+	flag.StringVar(&mailbox, "mailbox", "INBOX", "Mailbox to archive")
+	flag.StringVar(&dir, "dir", "Maildir", "Maildir path")
+	flag.Parse()
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0700); err != nil {
+			log.Fatalf("Failed to create Maildir: %v", err)
+		}
+	}
+
+	c, err := imapclient.DialTLS(addr, &imapclient.Options{LowMemory: true})
+	if err != nil {
+		log.Fatalf("Failed to dial IMAP server: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Login(username, password).Wait(); err != nil {
+		log.Fatalf("Failed to login: %v", err)
+	}
+	selectData, err := c.Examine(mailbox).Wait()
+	if err != nil {
+		log.Fatalf("Failed to examine %v: %v", mailbox, err)
+	}
+	if selectData.NumMessages == 0 {
+		log.Printf("Mailbox %v is empty", mailbox)
+		return
+	}
+
+	fetchCmd := c.UIDFetch(imap.UIDSetRange(1, 0), []imap.FetchItem{
+		imap.FetchItemFlags,
+		&imap.FetchItemBodySection{Peek: true},
+	})
+	defer fetchCmd.Close()
+
+	n := 0
+	for {
+		msg := fetchCmd.Next()
+		if msg == nil {
+			break
+		}
+		if err := archiveMessage(msg, selectData.UIDValidity); err != nil {
+			log.Fatalf("Failed to archive message: %v", err)
+		}
+		n++
+	}
+	if err := fetchCmd.Close(); err != nil {
+		log.Fatalf("FETCH command failed: %v", err)
+	}
+	log.Printf("Archived %v messages from %v", n, mailbox)
+
+	if err := c.Logout().Wait(); err != nil {
+		log.Printf("Failed to logout: %v", err)
+	}
+}
+
+// archiveMessage writes a message to tmp/, then moves it to cur/ once the
+// flags are known: servers may send them after the body.
+func archiveMessage(msg *imapclient.FetchMessageData, uidValidity uint32) error {
+	var (
+		uid     uint32
+		flags   []imap.Flag
+		tmpPath string
+	)
+	for {
+		item := msg.Next()
+		if item == nil {
+			break
+		}
+		switch item := item.(type) {
+		case imapclient.FetchItemDataUID:
+			uid = item.UID
+		case imapclient.FetchItemDataFlags:
+			flags = item.Flags
+		case imapclient.FetchItemDataBodySection:
+			f, err := os.CreateTemp(filepath.Join(dir, "tmp"), "imap")
+			if err != nil {
+				return err
+			}
+			tmpPath = f.Name()
+			_, err = io.Copy(f, item.Literal)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(tmpPath)
+				return err
+			}
+		}
+	}
+	if tmpPath == "" {
+		return fmt.Errorf("missing body for message %v", uid)
+	}
+
+	name := fmt.Sprintf("%v_%v.imap:2,%v", uidValidity, uid, infoFlags(flags))
+	return os.Rename(tmpPath, filepath.Join(dir, "cur", name))
+}
+
+func infoFlags(flags []imap.Flag) string {
+	var l []byte
+	for _, flag := range flags {
+		// System flags are case-insensitive
+		if ch, ok := maildirFlags[strings.ToLower(string(flag))]; ok {
+			l = append(l, ch)
+		}
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i] < l[j]
+	})
+	return string(l)
+}
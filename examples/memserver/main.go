@@ -0,0 +1,100 @@
+// Command memserver runs a minimal IMAP server backed by memory, with a
+// single user and a welcome message. It's useful to try out IMAP clients.
+//
+// With -lmtp, messages can be delivered by an MTA over LMTP, and show up
+// live in IMAP sessions.
+//
+// Authentication is allowed without TLS: don't expose it to untrusted
+// networks.
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imaplmtp"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+const welcomeMessage = "From: postmaster@example.org\r\n" +
+	"To: user@example.org\r\n" +
+	"Subject: Welcome\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"This message is stored in memory.\r\n"
+
+var (
+	listen   string
+	lmtp     string
+	username string
+	password string
+	trace    bool
+)
+
+func main() {
+	flag.StringVar(&listen, "listen", "localhost:1143", "listening address")
+	flag.StringVar(&lmtp, "lmtp", "", "LMTP listening address")
+	flag.StringVar(&username, "username", "user", "Username")
+	flag.StringVar(&password, "password", "user", "Password")
+	flag.BoolVar(&trace, "trace", false, "Print a JSON trace of commands and responses")
+	flag.Parse()
+
+	memServer := imapmemserver.New()
+	user := imapmemserver.NewUser(username, password)
+	for _, name := range []string{"INBOX", "Archive", "Archive/2024"} {
+		if err := user.Create(name); err != nil {
+			log.Fatalf("Failed to create mailbox %v: %v", name, err)
+		}
+	}
+	memServer.AddUser(user)
+
+	_, err := memServer.DeliverMessage(username, strings.NewReader(welcomeMessage), &imapserver.DeliverOptions{
+		Flags: []imap.Flag{imap.FlagFlagged},
+	})
+	if err != nil {
+		log.Fatalf("Failed to deliver welcome message: %v", err)
+	}
+
+	options := &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			return memServer.NewConnSession(conn), nil
+		},
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapIMAP4rev2: {},
+		},
+		InsecureAuth: true,
+	}
+	if trace {
+		options.ConformanceTrace = os.Stderr
+	}
+	server := imapserver.New(options)
+
+	if lmtp != "" {
+		lmtpServer := imaplmtp.New(&imaplmtp.Options{Deliverer: memServer})
+		lmtpLn, err := net.Listen("tcp", lmtp)
+		if err != nil {
+			log.Fatalf("Failed to listen: %v", err)
+		}
+		log.Printf("LMTP server listening on %v", lmtpLn.Addr())
+		go func() {
+			if err := lmtpServer.Serve(lmtpLn); err != nil {
+				log.Fatalf("Serve() = %v", err)
+			}
+		}()
+	}
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	log.Printf("IMAP server listening on %v", ln.Addr())
+	if err := server.Serve(ln); err != nil {
+		log.Fatalf("Serve() = %v", err)
+	}
+}
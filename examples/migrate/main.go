@@ -0,0 +1,188 @@
+// Command migrate copies all mailboxes and messages from one IMAP account to
+// another, preserving flags and internal dates.
+//
+// Messages are streamed from the source server to the destination server
+// without being held in memory.
+package main
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+var (
+	srcAddr, srcUsername, srcPassword string
+	dstAddr, dstUsername, dstPassword string
+)
+
+func main() {
+	flag.StringVar(&srcAddr, "src-addr", "", "Source IMAP server address")
+	flag.StringVar(&srcUsername, "src-username", "", "Source username")
+	flag.StringVar(&srcPassword, "src-password", "", "Source password")
+	flag.StringVar(&dstAddr, "dst-addr", "", "Destination IMAP server address")
+	flag.StringVar(&dstUsername, "dst-username", "", "Destination username")
+	flag.StringVar(&dstPassword, "dst-password", "", "Destination password")
+	flag.Parse()
+
+	src := login(srcAddr, srcUsername, srcPassword)
+	defer src.Close()
+	dst := login(dstAddr, dstUsername, dstPassword)
+	defer dst.Close()
+
+	mailboxes, err := src.List("", "*", nil).Collect()
+	if err != nil {
+		log.Fatalf("Failed to list source mailboxes: %v", err)
+	}
+	dstDelim := delimiter(dst)
+
+	for _, data := range mailboxes {
+		if hasAttr(data.Attrs, imap.MailboxAttrNoSelect) || hasAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+			continue
+		}
+		name := data.Mailbox
+		if data.Delim != 0 && dstDelim != 0 {
+			name = strings.ReplaceAll(name, string(data.Delim), string(dstDelim))
+		}
+
+		n, err := migrateMailbox(src, dst, data.Mailbox, name)
+		if err != nil {
+			log.Fatalf("Failed to migrate %v: %v", data.Mailbox, err)
+		}
+		log.Printf("Migrated %v messages from %v to %v", n, data.Mailbox, name)
+	}
+
+	if err := src.Logout().Wait(); err != nil {
+		log.Printf("Failed to logout from source server: %v", err)
+	}
+	if err := dst.Logout().Wait(); err != nil {
+		log.Printf("Failed to logout from destination server: %v", err)
+	}
+}
+
+func login(addr, username, password string) *imapclient.Client {
+	c, err := imapclient.DialTLS(addr, nil)
+	if err != nil {
+		log.Fatalf("Failed to dial %v: %v", addr, err)
+	}
+	if err := c.Login(username, password).Wait(); err != nil {
+		log.Fatalf("Failed to login to %v: %v", addr, err)
+	}
+	return c
+}
+
+func delimiter(c *imapclient.Client) rune {
+	l, err := c.List("", "", nil).Collect()
+	if err != nil || len(l) == 0 {
+		return 0
+	}
+	return l[0].Delim
+}
+
+func migrateMailbox(src, dst *imapclient.Client, srcName, dstName string) (int, error) {
+	// EXAMINE doesn't reset \Recent nor allow flag changes on the source
+	selectData, err := src.Examine(srcName).Wait()
+	if err != nil {
+		return 0, err
+	}
+	// Options.AutoCreateMailbox isn't used, since it keeps a copy of
+	// appended messages in memory
+	if err := createMailbox(dst, dstName); err != nil {
+		return 0, err
+	}
+	if selectData.NumMessages == 0 {
+		return 0, nil
+	}
+
+	// Fetch metadata first: servers may send it after the message body
+	all := imap.UIDSetRange(1, 0)
+	bufs, err := src.UIDFetch(all, []imap.FetchItem{
+		imap.FetchItemFlags,
+		imap.FetchItemInternalDate,
+	}).Collect()
+	if err != nil {
+		return 0, err
+	}
+	infos := make(map[uint32]*imapclient.FetchMessageBuffer, len(bufs))
+	for _, buf := range bufs {
+		infos[buf.UID] = buf
+	}
+
+	// UID is always returned before the body for UID FETCH
+	n := 0
+	fetchCmd := src.UIDFetch(all, []imap.FetchItem{&imap.FetchItemBodySection{Peek: true}})
+	defer fetchCmd.Close()
+	for {
+		msg := fetchCmd.Next()
+		if msg == nil {
+			break
+		}
+
+		var uid uint32
+		for {
+			item := msg.Next()
+			if item == nil {
+				break
+			}
+			switch item := item.(type) {
+			case imapclient.FetchItemDataUID:
+				uid = item.UID
+			case imapclient.FetchItemDataBodySection:
+				if err := appendMessage(dst, dstName, infos[uid], item.Literal); err != nil {
+					return n, err
+				}
+				n++
+			}
+		}
+	}
+	return n, fetchCmd.Close()
+}
+
+func appendMessage(dst *imapclient.Client, mailbox string, info *imapclient.FetchMessageBuffer, body imap.LiteralReader) error {
+	options := &imap.AppendOptions{}
+	if info != nil {
+		options.Time = info.InternalDate
+		for _, flag := range info.Flags {
+			if flag != imap.FlagRecent {
+				options.Flags = append(options.Flags, flag)
+			}
+		}
+	}
+
+	appendCmd := dst.Append(mailbox, body.Size(), options)
+	if _, err := io.Copy(appendCmd, body); err != nil {
+		appendCmd.Close()
+		return err
+	}
+	if err := appendCmd.Close(); err != nil {
+		return err
+	}
+	_, err := appendCmd.Wait()
+	return err
+}
+
+func createMailbox(c *imapclient.Client, name string) error {
+	if strings.EqualFold(name, "INBOX") {
+		return nil // always exists
+	}
+	err := c.Create(name).Wait()
+	var imapErr *imap.Error
+	if errors.As(err, &imapErr) && imapErr.Code == imap.ResponseCodeAlreadyExists {
+		return nil
+	}
+	return err
+}
+
+func hasAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,827 @@
+// Command restgateway runs a read-only IMAP server exposing messages stored
+// behind an HTTP API, e.g. an object store or a web mail service.
+//
+// The API is expected to provide:
+//
+//	GET /mailboxes                  JSON list of mailbox names
+//	GET /mailboxes/{name}/messages  JSON apiMessageList
+//	GET /messages/{id}              raw RFC 5322 message, with Range support
+//
+// The API identifies messages with opaque IDs: UIDs are assigned and
+// persisted by an imapserver.UIDMap. Message metadata is fetched when a
+// mailbox is selected, message contents are only downloaded when a FETCH
+// command requests them. The API doesn't describe the MIME structure of
+// messages, so they are reported as a single part.
+//
+// Changes made behind the API are polled while a mailbox is selected, and
+// reported with EXPUNGE, EXISTS and FETCH responses. If the API reassigns
+// message IDs, the mailbox is renumbered and clients are disconnected.
+//
+// Authentication is allowed without TLS: don't expose it to untrusted
+// networks.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-message/textproto"
+)
+
+const mailboxDelim = '/'
+
+// pollInterval is the minimum delay between two requests checking the
+// selected mailbox for changes.
+const pollInterval = 10 * time.Second
+
+var (
+	listen   string
+	apiURL   string
+	stateDir string
+	username string
+	password string
+)
+
+// apiMessageList is the list of messages of a mailbox returned by the API.
+type apiMessageList struct {
+	// Changes if the message IDs are reassigned, e.g. when the mailbox is
+	// restored from a backup
+	Generation string       `json:"generation"`
+	Messages   []apiMessage `json:"messages"`
+}
+
+type apiMessage struct {
+	ID          string       `json:"id"`
+	Size        int64        `json:"size"`
+	Date        time.Time    `json:"date"`
+	Flags       []string     `json:"flags"`
+	ContentType string       `json:"contentType"`
+	Subject     string       `json:"subject"`
+	MessageID   string       `json:"messageId"`
+	From        []apiAddress `json:"from"`
+	To          []apiAddress `json:"to"`
+}
+
+type apiAddress struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+func main() {
+	flag.StringVar(&listen, "listen", "localhost:1143", "listening address")
+	flag.StringVar(&apiURL, "api", "http://localhost:8080", "HTTP API base URL")
+	flag.StringVar(&stateDir, "state", "uidmap", "Directory storing the UID map")
+	flag.StringVar(&username, "username", "user", "Username")
+	flag.StringVar(&password, "password", "user", "Password")
+	flag.Parse()
+
+	if err := os.MkdirAll(stateDir, 0700); err != nil {
+		log.Fatalf("Failed to create state directory: %v", err)
+	}
+
+	api := &apiClient{base: strings.TrimSuffix(apiURL, "/"), http: http.DefaultClient}
+	uidMap := imapserver.NewUIDMap(&imapserver.UIDMapFileStore{Dir: stateDir})
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			return &session{api: api, uidMap: uidMap}, nil
+		},
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapIMAP4rev2: {},
+		},
+		InsecureAuth: true,
+	})
+
+	ln, err := net.Listen("tcp", listen)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	log.Printf("IMAP server listening on %v", ln.Addr())
+	if err := server.Serve(ln); err != nil {
+		log.Fatalf("Serve() = %v", err)
+	}
+}
+
+type apiClient struct {
+	base string
+	http *http.Client
+}
+
+func (api *apiClient) get(path string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, api.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := api.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusPartialContent:
+		return resp, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, imapserver.NewNonExistentError("No such mailbox or message")
+	default:
+		resp.Body.Close()
+		return nil, imapserver.NewUnavailableError(fmt.Sprintf("HTTP API returned %v", resp.Status))
+	}
+}
+
+func (api *apiClient) getJSON(path string, v interface{}) error {
+	resp, err := api.get(path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (api *apiClient) mailboxes() ([]string, error) {
+	var l []string
+	err := api.getJSON("/mailboxes", &l)
+	return l, err
+}
+
+func (api *apiClient) messages(mailbox string) (*apiMessageList, error) {
+	var l apiMessageList
+	err := api.getJSON("/mailboxes/"+url.PathEscape(mailbox)+"/messages", &l)
+	return &l, err
+}
+
+// openMessage downloads a message. If partial is non-nil, only the requested
+// range is downloaded.
+func (api *apiClient) openMessage(msg *apiMessage, partial *imap.SectionPartial) (io.ReadCloser, int64, error) {
+	offset, size := int64(0), msg.Size
+	if partial != nil {
+		offset, size = clampPartial(partial, msg.Size)
+		if size == 0 {
+			return io.NopCloser(strings.NewReader("")), 0, nil
+		}
+	}
+
+	var header http.Header
+	if offset > 0 || size < msg.Size {
+		header = http.Header{"Range": {fmt.Sprintf("bytes=%v-%v", offset, offset+size-1)}}
+	}
+	resp, err := api.get("/messages/"+url.PathEscape(msg.ID), header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := resp.Body
+	if header != nil && resp.StatusCode != http.StatusPartialContent {
+		// The Range header has been ignored
+		if _, err := io.CopyN(io.Discard, r, offset); err != nil {
+			r.Close()
+			return nil, 0, err
+		}
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, size), r}, size, nil
+}
+
+func clampPartial(partial *imap.SectionPartial, size int64) (offset, n int64) {
+	if partial.Offset >= size {
+		return size, 0
+	}
+	n = size - partial.Offset
+	if partial.Size < n {
+		n = partial.Size
+	}
+	return partial.Offset, n
+}
+
+type session struct {
+	api    *apiClient
+	uidMap *imapserver.UIDMap
+
+	mailbox     string
+	uidValidity uint32
+	uidNext     uint32
+	messages    []*apiMessage // indexed by sequence number - 1
+	uids        []uint32
+	syncedAt    time.Time
+}
+
+var (
+	_ imapserver.SessionIMAP4rev2     = (*session)(nil)
+	_ imapserver.SessionFetchIterator = (*session)(nil)
+)
+
+var errReadOnly = imapserver.NewNoPermError("The HTTP API is read-only")
+
+var errRenumbered = &imap.Error{
+	Type: imap.StatusResponseTypeBye,
+	Text: "Mailbox has been renumbered, please reconnect",
+}
+
+func (sess *session) Close() error {
+	return nil
+}
+
+func (sess *session) Login(user, pass string) error {
+	if user != username || pass != password {
+		return imapserver.ErrAuthFailed
+	}
+	return nil
+}
+
+// sync fetches the messages of a mailbox, and assigns their UIDs.
+//
+// The changes since the last synchronization are consumed: sync must only be
+// called when the session can report them, i.e. for the selected mailbox.
+func (sess *session) sync(mailbox string) (*imapserver.UIDMapSnapshot, map[string]*apiMessage, error) {
+	return sess.fetchSnapshot(mailbox, sess.uidMap.Sync)
+}
+
+// peek is like sync, but doesn't modify the UID map.
+func (sess *session) peek(mailbox string) (*imapserver.UIDMapSnapshot, map[string]*apiMessage, error) {
+	return sess.fetchSnapshot(mailbox, sess.uidMap.Peek)
+}
+
+type uidMapFunc func(mailbox, generation string, ids []string) (*imapserver.UIDMapSnapshot, error)
+
+func (sess *session) fetchSnapshot(mailbox string, f uidMapFunc) (*imapserver.UIDMapSnapshot, map[string]*apiMessage, error) {
+	list, err := sess.api.messages(mailbox)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]string, len(list.Messages))
+	byID := make(map[string]*apiMessage, len(list.Messages))
+	for i := range list.Messages {
+		msg := &list.Messages[i]
+		ids[i] = msg.ID
+		byID[msg.ID] = msg
+	}
+	snapshot, err := f(mailbox, list.Generation, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, byID, nil
+}
+
+func (sess *session) Select(mailbox string, options *imapserver.SelectOptions) (*imap.SelectData, error) {
+	snapshot, byID, err := sess.sync(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	sess.mailbox = mailbox
+	sess.uidValidity = snapshot.UIDValidity
+	sess.uidNext = snapshot.UIDNext
+	sess.syncedAt = time.Now()
+	sess.messages = make([]*apiMessage, len(snapshot.Entries))
+	sess.uids = make([]uint32, len(snapshot.Entries))
+	for i, entry := range snapshot.Entries {
+		sess.messages[i] = byID[entry.ID]
+		sess.uids[i] = entry.UID
+	}
+
+	return &imap.SelectData{
+		Flags:       []imap.Flag{imap.FlagSeen, imap.FlagAnswered, imap.FlagFlagged, imap.FlagDeleted, imap.FlagDraft},
+		NumMessages: uint32(len(sess.messages)),
+		UIDNext:     snapshot.UIDNext,
+		UIDValidity: snapshot.UIDValidity,
+	}, nil
+}
+
+func (sess *session) Unselect() error {
+	sess.mailbox = ""
+	sess.uidValidity, sess.uidNext = 0, 0
+	sess.messages, sess.uids = nil, nil
+	return nil
+}
+
+func (sess *session) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+	if len(patterns) == 0 {
+		return w.WriteList(&imap.ListData{
+			Attrs: []imap.MailboxAttr{imap.MailboxAttrNoSelect},
+			Delim: mailboxDelim,
+		})
+	}
+
+	names, err := sess.api.mailboxes()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		match := false
+		for _, pattern := range patterns {
+			if imapserver.MatchList(name, mailboxDelim, ref, pattern) {
+				match = true
+				break
+			}
+		}
+		if !match {
+			continue
+		}
+		if err := w.WriteList(&imap.ListData{Delim: mailboxDelim, Mailbox: name}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sess *session) Status(mailbox string, items []imap.StatusItem) (*imap.StatusData, error) {
+	snapshot, byID, err := sess.peek(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &imap.StatusData{Mailbox: mailbox}
+	for _, item := range items {
+		switch item {
+		case imap.StatusItemNumMessages:
+			n := uint32(len(snapshot.Entries))
+			data.NumMessages = &n
+		case imap.StatusItemUIDNext:
+			data.UIDNext = snapshot.UIDNext
+		case imap.StatusItemUIDValidity:
+			data.UIDValidity = snapshot.UIDValidity
+		case imap.StatusItemNumUnseen:
+			var n uint32
+			for _, entry := range snapshot.Entries {
+				if !hasFlag(byID[entry.ID].Flags, imap.FlagSeen) {
+					n++
+				}
+			}
+			data.NumUnseen = &n
+		}
+	}
+	return data, nil
+}
+
+func (sess *session) Poll(w *imapserver.UpdateWriter, allowExpunge bool) error {
+	if sess.mailbox == "" || time.Since(sess.syncedAt) < pollInterval {
+		return nil
+	}
+	return sess.poll(w, allowExpunge)
+}
+
+func (sess *session) Idle(w *imapserver.UpdateWriter, stop <-chan struct{}) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+			if sess.mailbox == "" {
+				continue
+			}
+			if err := sess.poll(w, true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// poll synchronizes the selected mailbox, and reports the changes.
+//
+// If expunges aren't allowed, removed messages are kept: they are reported
+// by a later poll.
+func (sess *session) poll(w *imapserver.UpdateWriter, allowExpunge bool) error {
+	snapshot, byID, err := sess.sync(sess.mailbox)
+	if err != nil {
+		return err
+	}
+	sess.syncedAt = time.Now()
+	if snapshot.UIDValidity != sess.uidValidity {
+		return errRenumbered
+	}
+
+	if allowExpunge {
+		for i := len(sess.uids) - 1; i >= 0; i-- {
+			if _, ok := snapshot.ID(sess.uids[i]); ok {
+				continue
+			}
+			if err := w.WriteExpunge(uint32(i) + 1); err != nil {
+				return err
+			}
+			sess.uids = append(sess.uids[:i], sess.uids[i+1:]...)
+			sess.messages = append(sess.messages[:i], sess.messages[i+1:]...)
+		}
+	}
+
+	for i, uid := range sess.uids {
+		id, ok := snapshot.ID(uid)
+		if !ok {
+			continue
+		}
+		msg := byID[id]
+		if !sameFlags(sess.messages[i].Flags, msg.Flags) {
+			if err := w.WriteMessageFlags(uint32(i)+1, uid, convertFlags(msg.Flags)); err != nil {
+				return err
+			}
+		}
+		sess.messages[i] = msg
+	}
+
+	n := len(sess.uids)
+	for _, entry := range snapshot.Entries {
+		if entry.UID >= sess.uidNext {
+			sess.uids = append(sess.uids, entry.UID)
+			sess.messages = append(sess.messages, byID[entry.ID])
+		}
+	}
+	sess.uidNext = snapshot.UIDNext
+	if len(sess.uids) != n {
+		return w.WriteNumMessages(uint32(len(sess.uids)))
+	}
+	return nil
+}
+
+func sameFlags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, flag := range a {
+		if !hasFlag(b, imap.Flag(flag)) {
+			return false
+		}
+	}
+	return true
+}
+
+func convertFlags(l []string) []imap.Flag {
+	flags := make([]imap.Flag, len(l))
+	for i, flag := range l {
+		flags[i] = imap.Flag(flag)
+	}
+	return flags
+}
+
+func (sess *session) Namespace() (*imap.NamespaceData, error) {
+	return &imap.NamespaceData{
+		Personal: []imap.NamespaceDescriptor{{Delim: mailboxDelim}},
+	}, nil
+}
+
+func (sess *session) Create(mailbox string) error {
+	return errReadOnly
+}
+
+func (sess *session) Delete(mailbox string) error {
+	return errReadOnly
+}
+
+func (sess *session) Rename(mailbox, newName string) error {
+	return errReadOnly
+}
+
+func (sess *session) Subscribe(mailbox string) error {
+	return errReadOnly
+}
+
+func (sess *session) Unsubscribe(mailbox string) error {
+	return errReadOnly
+}
+
+func (sess *session) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
+	return nil, errReadOnly
+}
+
+func (sess *session) Expunge(w *imapserver.ExpungeWriter, uids *imap.SeqSet) error {
+	return errReadOnly
+}
+
+func (sess *session) Store(w *imapserver.FetchWriter, kind imapserver.NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags) error {
+	return errReadOnly
+}
+
+func (sess *session) Copy(kind imapserver.NumKind, seqSet imap.SeqSet, dest string) (*imap.CopyData, error) {
+	return nil, errReadOnly
+}
+
+func (sess *session) Move(w *imapserver.MoveWriter, kind imapserver.NumKind, seqSet imap.SeqSet, dest string) error {
+	return errReadOnly
+}
+
+// staticSeqSet replaces "*" with the largest sequence number or UID.
+func (sess *session) staticSeqSet(seqSet imap.SeqSet, kind imapserver.NumKind) imap.SeqSet {
+	var max uint32
+	if n := len(sess.uids); n > 0 {
+		if kind == imapserver.NumKindUID {
+			max = sess.uids[n-1]
+		} else {
+			max = uint32(n)
+		}
+	}
+
+	out := make(imap.SeqSet, len(seqSet))
+	for i, seq := range seqSet {
+		if seq.Start == 0 {
+			seq.Start = max
+		}
+		if seq.Stop == 0 {
+			seq.Stop = max
+		}
+		if seq.Start > seq.Stop {
+			seq.Start, seq.Stop = seq.Stop, seq.Start
+		}
+		out[i] = seq
+	}
+	return out
+}
+
+func (sess *session) Search(kind imapserver.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	if err := checkSearchCriteria(criteria); err != nil {
+		return nil, err
+	}
+
+	data := &imap.SearchData{UID: kind == imapserver.NumKindUID}
+	for i, msg := range sess.messages {
+		seqNum, uid := uint32(i)+1, sess.uids[i]
+		if !sess.match(seqNum, uid, msg, criteria) {
+			continue
+		}
+
+		num := seqNum
+		if kind == imapserver.NumKindUID {
+			num = uid
+		}
+		data.All.AddNum(num)
+		if data.Min == 0 {
+			data.Min = num
+		}
+		data.Max = num
+		data.Count++
+	}
+	return data, nil
+}
+
+// checkSearchCriteria returns an error if the criteria need data the API
+// doesn't provide.
+func checkSearchCriteria(criteria *imap.SearchCriteria) error {
+	if len(criteria.Header) > 0 || len(criteria.Body) > 0 || len(criteria.Text) > 0 || !criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() || criteria.ModSeq != nil {
+		return imapserver.NewCannotError("Unsupported search key")
+	}
+	for i := range criteria.Not {
+		if err := checkSearchCriteria(&criteria.Not[i]); err != nil {
+			return err
+		}
+	}
+	for i := range criteria.Or {
+		for j := range criteria.Or[i] {
+			if err := checkSearchCriteria(&criteria.Or[i][j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (sess *session) match(seqNum, uid uint32, msg *apiMessage, criteria *imap.SearchCriteria) bool {
+	if len(criteria.SeqNum) > 0 && !sess.staticSeqSet(criteria.SeqNum, imapserver.NumKindSeq).Contains(seqNum) {
+		return false
+	}
+	if len(criteria.UID) > 0 && !sess.staticSeqSet(criteria.UID, imapserver.NumKindUID).Contains(uid) {
+		return false
+	}
+	if !criteria.Since.IsZero() && truncateDate(msg.Date).Before(truncateDate(criteria.Since)) {
+		return false
+	}
+	if !criteria.Before.IsZero() && !truncateDate(msg.Date).Before(truncateDate(criteria.Before)) {
+		return false
+	}
+	for _, flag := range criteria.Flag {
+		if !hasFlag(msg.Flags, flag) {
+			return false
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if hasFlag(msg.Flags, flag) {
+			return false
+		}
+	}
+	if criteria.Larger > 0 && msg.Size <= criteria.Larger {
+		return false
+	}
+	if criteria.Smaller > 0 && msg.Size >= criteria.Smaller {
+		return false
+	}
+	for i := range criteria.Not {
+		if sess.match(seqNum, uid, msg, &criteria.Not[i]) {
+			return false
+		}
+	}
+	for _, or := range criteria.Or {
+		if !sess.match(seqNum, uid, msg, &or[0]) && !sess.match(seqNum, uid, msg, &or[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func truncateDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func hasFlag(flags []string, flag imap.Flag) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, string(flag)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (sess *session) Fetch(w *imapserver.FetchWriter, kind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem) error {
+	it, err := sess.FetchIterator(kind, seqSet, items)
+	if err != nil {
+		return err
+	}
+	return w.WriteIterator(it, items)
+}
+
+func (sess *session) FetchIterator(kind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem) (imapserver.FetchIterator, error) {
+	return &fetchIterator{
+		sess:   sess,
+		kind:   kind,
+		seqSet: sess.staticSeqSet(seqSet, kind),
+	}, nil
+}
+
+// fetchIterator returns the messages of the selected mailbox matching a
+// FETCH command. Contents are downloaded when the FETCH response is written.
+type fetchIterator struct {
+	sess   *session
+	kind   imapserver.NumKind
+	seqSet imap.SeqSet
+	i      int
+}
+
+func (it *fetchIterator) Next() (*imapserver.FetchMessage, error) {
+	for it.i < len(it.sess.messages) {
+		i := it.i
+		it.i++
+
+		seqNum, uid := uint32(i)+1, it.sess.uids[i]
+		num := seqNum
+		if it.kind == imapserver.NumKindUID {
+			num = uid
+		}
+		if !it.seqSet.Contains(num) {
+			continue
+		}
+
+		msg := it.sess.messages[i]
+		return &imapserver.FetchMessage{
+			SeqNum:       seqNum,
+			UID:          uid,
+			Flags:        convertFlags(msg.Flags),
+			InternalDate: msg.Date,
+			RFC822Size:   msg.Size,
+			Envelope: func() (*imap.Envelope, error) {
+				return msg.envelope(), nil
+			},
+			BodyStructure: func(extended bool) (imap.BodyStructure, error) {
+				return msg.bodyStructure(), nil
+			},
+			OpenBodySection: func(section *imap.FetchItemBodySection) (io.ReadCloser, int64, error) {
+				return it.sess.api.openBodySection(msg, section)
+			},
+		}, nil
+	}
+	return nil, nil
+}
+
+func (it *fetchIterator) Close() error {
+	return nil
+}
+
+func (msg *apiMessage) envelope() *imap.Envelope {
+	return &imap.Envelope{
+		Date:      msg.Date.Format(time.RFC1123Z),
+		Subject:   msg.Subject,
+		From:      convertAddressList(msg.From),
+		To:        convertAddressList(msg.To),
+		MessageID: msg.MessageID,
+	}
+}
+
+func convertAddressList(l []apiAddress) []imap.Address {
+	out := make([]imap.Address, len(l))
+	for i, addr := range l {
+		mailbox, host, _ := strings.Cut(addr.Email, "@")
+		out[i] = imap.Address{Name: addr.Name, Mailbox: mailbox, Host: host}
+	}
+	return out
+}
+
+// bodyStructure describes the message as a single part. The size of the body
+// isn't known without downloading the message: the message size is used.
+func (msg *apiMessage) bodyStructure() imap.BodyStructure {
+	typ, subtype := "text", "plain"
+	params := map[string]string{"charset": "us-ascii"}
+	if mediaType, p, err := mime.ParseMediaType(msg.ContentType); err == nil {
+		typ, subtype, _ = strings.Cut(mediaType, "/")
+		params = p
+	}
+
+	bs := &imap.BodyStructureSinglePart{
+		Type:     typ,
+		Subtype:  subtype,
+		Params:   params,
+		Encoding: "8bit",
+		Size:     uint32(msg.Size),
+	}
+	if strings.EqualFold(typ, "text") {
+		bs.Text = &imap.BodyStructureText{}
+	}
+	return bs
+}
+
+// openBodySection returns a body section of a message. The whole message is
+// streamed from the API, with Range requests for partial fetches. Other
+// sections are extracted from the downloaded message.
+func (api *apiClient) openBodySection(msg *apiMessage, section *imap.FetchItemBodySection) (io.ReadCloser, int64, error) {
+	var specifier imap.PartSpecifier
+	switch {
+	case len(section.Part) == 0:
+		specifier = section.Specifier
+	case len(section.Part) == 1 && section.Part[0] == 1 && section.Specifier == imap.PartSpecifierNone:
+		// Messages are single-part: part 1 is the body
+		specifier = imap.PartSpecifierText
+	default:
+		return nil, 0, imapserver.NewCannotError("Unsupported body section")
+	}
+	if specifier == imap.PartSpecifierNone {
+		return api.openMessage(msg, section.Partial)
+	}
+
+	r, _, err := api.openMessage(msg, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Close()
+
+	br := bufio.NewReader(r)
+	header, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var buf bytes.Buffer
+	switch specifier {
+	case imap.PartSpecifierHeader:
+		filterHeader(&header, section.HeaderFields, section.HeaderFieldsNot)
+		if err := textproto.WriteHeader(&buf, header); err != nil {
+			return nil, 0, err
+		}
+	case imap.PartSpecifierText:
+		if _, err := buf.ReadFrom(br); err != nil {
+			return nil, 0, err
+		}
+	default:
+		return nil, 0, imapserver.NewCannotError("Unsupported body section")
+	}
+
+	b := buf.Bytes()
+	if section.Partial != nil {
+		offset, n := clampPartial(section.Partial, int64(len(b)))
+		b = b[offset : offset+n]
+	}
+	return io.NopCloser(bytes.NewReader(b)), int64(len(b)), nil
+}
+
+func filterHeader(header *textproto.Header, fields, fieldsNot []string) {
+	if len(fields) > 0 {
+		keep := make(map[string]bool, len(fields))
+		for _, k := range fields {
+			keep[strings.ToLower(k)] = true
+		}
+		fields := header.Fields()
+		for fields.Next() {
+			if !keep[strings.ToLower(fields.Key())] {
+				fields.Del()
+			}
+		}
+	}
+	for _, k := range fieldsNot {
+		header.Del(k)
+	}
+}
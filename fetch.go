@@ -35,8 +35,20 @@ var (
 	FetchItemInternalDate  FetchItem = FetchItemKeyword("INTERNALDATE")
 	FetchItemRFC822Size    FetchItem = FetchItemKeyword("RFC822.SIZE")
 	FetchItemUID           FetchItem = FetchItemKeyword("UID")
+	FetchItemModSeq        FetchItem = FetchItemKeyword("MODSEQ") // requires CONDSTORE
 )
 
+// FetchOptions contains options for the FETCH command.
+type FetchOptions struct {
+	// Only return messages whose mod-sequence is greater than this value.
+	// Requires CONDSTORE.
+	ChangedSince uint64 `json:"changedSince,omitempty"`
+	// Report messages expunged since ChangedSince via a VANISHED (EARLIER)
+	// response. Requires QRESYNC and ChangedSince, and is only valid for UID
+	// FETCH.
+	Vanished bool `json:"vanished,omitempty"`
+}
+
 type PartSpecifier string
 
 const (
@@ -192,6 +204,71 @@ type BodyStructureMessageRFC822 struct {
 	NumLines      int64
 }
 
+// EmbeddedMessage describes a message/rfc822 or message/global part, e.g. a
+// forwarded message.
+type EmbeddedMessage struct {
+	// IMAP part path of the embedded message
+	Part          []int
+	Envelope      *Envelope
+	BodyStructure BodyStructure
+}
+
+// HeaderSection returns a body section for the header of the embedded
+// message.
+func (msg *EmbeddedMessage) HeaderSection() *FetchItemBodySection {
+	return &FetchItemBodySection{Part: msg.Part, Specifier: PartSpecifierHeader, Peek: true}
+}
+
+// TextSection returns a body section for the text of the embedded message,
+// without its header.
+func (msg *EmbeddedMessage) TextSection() *FetchItemBodySection {
+	return &FetchItemBodySection{Part: msg.Part, Specifier: PartSpecifierText, Peek: true}
+}
+
+// EmbeddedMessages returns the messages embedded in a body structure,
+// including messages embedded in other embedded messages. The messages are
+// returned in DFS pre-order.
+func EmbeddedMessages(bs BodyStructure) []EmbeddedMessage {
+	if _, ok := bs.(*BodyStructureMultiPart); ok {
+		return appendEmbeddedMessages(nil, bs, nil)
+	}
+	return appendEmbeddedMessages(nil, bs, []int{1})
+}
+
+func appendEmbeddedMessages(l []EmbeddedMessage, bs BodyStructure, path []int) []EmbeddedMessage {
+	switch bs := bs.(type) {
+	case *BodyStructureMultiPart:
+		for i, child := range bs.Children {
+			l = appendEmbeddedMessages(l, child, appendPartNum(path, i+1))
+		}
+	case *BodyStructureSinglePart:
+		msg := bs.MessageRFC822
+		if msg == nil {
+			break
+		}
+		l = append(l, EmbeddedMessage{
+			Part:          path,
+			Envelope:      msg.Envelope,
+			BodyStructure: msg.BodyStructure,
+		})
+		// The parts of a multipart embedded message are numbered like its
+		// children, a single-part body is numbered 1
+		if _, ok := msg.BodyStructure.(*BodyStructureMultiPart); ok {
+			l = appendEmbeddedMessages(l, msg.BodyStructure, path)
+		} else if msg.BodyStructure != nil {
+			l = appendEmbeddedMessages(l, msg.BodyStructure, appendPartNum(path, 1))
+		}
+	}
+	return l
+}
+
+func appendPartNum(path []int, num int) []int {
+	l := make([]int, len(path)+1)
+	copy(l, path)
+	l[len(path)] = num
+	return l
+}
+
 type BodyStructureText struct {
 	NumLines int64
 }
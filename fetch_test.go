@@ -0,0 +1,55 @@
+package imap_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestEmbeddedMessages(t *testing.T) {
+	text := &imap.BodyStructureSinglePart{Type: "text", Subtype: "plain", Text: &imap.BodyStructureText{}}
+	nested := &imap.BodyStructureSinglePart{
+		Type:    "message",
+		Subtype: "rfc822",
+		MessageRFC822: &imap.BodyStructureMessageRFC822{
+			Envelope:      &imap.Envelope{Subject: "nested"},
+			BodyStructure: text,
+		},
+	}
+	forwarded := &imap.BodyStructureSinglePart{
+		Type:    "message",
+		Subtype: "rfc822",
+		MessageRFC822: &imap.BodyStructureMessageRFC822{
+			Envelope: &imap.Envelope{Subject: "forwarded"},
+			BodyStructure: &imap.BodyStructureMultiPart{
+				Subtype:  "mixed",
+				Children: []imap.BodyStructure{text, nested},
+			},
+		},
+	}
+	bs := &imap.BodyStructureMultiPart{
+		Subtype:  "mixed",
+		Children: []imap.BodyStructure{text, forwarded},
+	}
+
+	l := imap.EmbeddedMessages(bs)
+	if len(l) != 2 {
+		t.Fatalf("EmbeddedMessages() returned %v messages, want 2", len(l))
+	}
+	if l[0].Envelope.Subject != "forwarded" || !reflect.DeepEqual(l[0].Part, []int{2}) {
+		t.Errorf("EmbeddedMessages()[0] = %v %v", l[0].Part, l[0].Envelope.Subject)
+	}
+	if l[1].Envelope.Subject != "nested" || !reflect.DeepEqual(l[1].Part, []int{2, 2}) {
+		t.Errorf("EmbeddedMessages()[1] = %v %v", l[1].Part, l[1].Envelope.Subject)
+	}
+
+	section := l[1].HeaderSection()
+	if !reflect.DeepEqual(section.Part, []int{2, 2}) || section.Specifier != imap.PartSpecifierHeader {
+		t.Errorf("HeaderSection() = %+v", section)
+	}
+
+	if l := imap.EmbeddedMessages(nested); len(l) != 1 || !reflect.DeepEqual(l[0].Part, []int{1}) {
+		t.Errorf("EmbeddedMessages(single part) = %+v", l)
+	}
+}
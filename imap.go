@@ -92,6 +92,10 @@ const (
 
 	// Permanent flags
 	FlagWildcard Flag = "\\*"
+
+	// Deprecated: \Recent has been removed in IMAP4rev2. It's only returned
+	// by IMAP4rev1 servers.
+	FlagRecent Flag = "\\Recent"
 )
 
 // LiteralReader is a reader for IMAP literals.
@@ -0,0 +1,95 @@
+package imapclient
+
+import (
+	"fmt"
+	"time"
+)
+
+// Servers may drop idle connections after 30 minutes, see RFC 9051 section
+// 5.4
+const accountIdleRestart = 25 * time.Minute
+
+// Minimum duration of an IDLE command, to avoid reconnecting in a loop when
+// the credentials keep expiring within the re-authentication margin
+const accountIdleMin = time.Minute
+
+// Idle selects a mailbox of an account and runs IDLE until stop is closed.
+// Unilateral data is delivered to AccountManagerOptions.Event.
+//
+// IDLE is restarted periodically so that the server doesn't drop the
+// connection. If AccountConfig.Expiry is set, IDLE is stopped shortly before
+// the credentials expire and the connection is re-established, so that
+// long-lived IDLE connections aren't closed by the server with an
+// AUTHENTICATIONFAILED response. The mailbox is selected again after each
+// new connection: Event receives the new mailbox status.
+//
+// The client returned by Client must not be used while Idle is running.
+func (m *AccountManager) Idle(id, mailbox string, stop <-chan struct{}) error {
+	m.mutex.Lock()
+	acc := m.accounts[id]
+	m.mutex.Unlock()
+
+	if acc == nil {
+		return fmt.Errorf("imapclient: unknown account %q", id)
+	}
+
+	var selected *Client
+	for {
+		c, err := m.connect(acc)
+		if err != nil {
+			return err
+		}
+		if c != selected {
+			if _, err := c.Select(mailbox).Wait(); err != nil {
+				return fmt.Errorf("imapclient: failed to select mailbox %q for account %q: %w", mailbox, id, err)
+			}
+			selected = c
+		}
+
+		idleCmd, err := c.Idle()
+		if err != nil {
+			return err
+		}
+
+		timer := time.NewTimer(m.idleDuration(acc, time.Now()))
+		var stopped, closed bool
+		select {
+		case <-stop:
+			stopped = true
+		case <-timer.C:
+		case <-c.Done():
+			closed = true
+		}
+		timer.Stop()
+
+		if closed {
+			// The next iteration reconnects
+			continue
+		}
+		if err := idleCmd.Close(); err != nil {
+			return err
+		}
+		if err := idleCmd.Wait(); err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+}
+
+// idleDuration returns how long the next IDLE command should run for.
+func (m *AccountManager) idleDuration(acc *managedAccount, now time.Time) time.Duration {
+	acc.mutex.Lock()
+	reauthAt := m.reauthAt(acc)
+	acc.mutex.Unlock()
+
+	d := accountIdleRestart
+	if !reauthAt.IsZero() && reauthAt.Sub(now) < d {
+		d = reauthAt.Sub(now)
+	}
+	if d < accountIdleMin {
+		d = accountIdleMin
+	}
+	return d
+}
@@ -0,0 +1,534 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// AccountConfig describes an account managed by an AccountManager.
+type AccountConfig struct {
+	// Unique identifier for the account
+	ID string
+	// Connect dials the server and authenticates. It's called when the
+	// account is added and each time the connection needs to be
+	// re-established, so it's a good place to refresh credentials (e.g. to
+	// fetch a new OAuth token).
+	//
+	// The options must be passed to New, DialTLS or DialStartTLS: they
+	// contain the unilateral data handler used by the manager.
+	Connect func(options *Options) (*Client, error)
+	// Expiry returns the time at which the credentials used by the last
+	// successful Connect call expire, e.g. the expiry of an OAuth token. It's
+	// optional, a zero time means the credentials don't expire.
+	//
+	// When set, the connection is re-established shortly before the
+	// credentials expire, whenever it has no command in progress and isn't
+	// held by AccountManager.Acquire. Servers may close connections with an
+	// AUTHENTICATIONFAILED response once the credentials have expired.
+	//
+	// A running IDLE command doesn't prevent the connection from being
+	// re-established: at that time, IDLE is stopped, the connection is
+	// replaced and AccountManagerOptions.Reauth is called so that the caller
+	// can restart IDLE with a new client.
+	Expiry func() time.Time
+}
+
+// AccountEvent contains unilateral data received for an account.
+//
+// Exactly one of Expunge, Mailbox, Fetch, List or Vanished is set.
+type AccountEvent struct {
+	Account string
+
+	Expunge uint32 // message sequence number
+	Mailbox *UnilateralDataMailbox
+	// The message data must be consumed before the callback returns
+	Fetch    *FetchMessageData
+	List     *imap.ListData
+	Vanished imap.UIDSet
+}
+
+// AccountListData is a mailbox returned by AccountManager.List.
+type AccountListData struct {
+	Account string
+	imap.ListData
+}
+
+// AccountManagerOptions contains options for an AccountManager.
+type AccountManagerOptions struct {
+	// Options used to connect to accounts. The unilateral data handler is
+	// replaced by one invoking Event.
+	ClientOptions *Options
+	// Event is called when unilateral data is received for an account. It
+	// will be invoked in an arbitrary goroutine.
+	Event func(ev *AccountEvent)
+	// Options for the delay applied before reconnecting after a connection
+	// attempt failed, e.g. because of a network error, an authentication
+	// failure or an UNAVAILABLE or LIMIT response code
+	BackoffOptions *BackoffOptions
+	// Backoff is called when a connection attempt fails, with the time of
+	// the next attempt. It's called without holding any lock of the
+	// manager, so it may call AccountManager methods.
+	Backoff func(ev *BackoffEvent)
+	// How long before the credentials expire the connection is
+	// re-established, see AccountConfig.Expiry. Defaults to 5 minutes.
+	ReauthMargin time.Duration
+	// Reauth is called when IDLE has been stopped to re-establish the
+	// connection of an account, see AccountConfig.Expiry. The IDLE command
+	// must be closed and restarted with a client returned by
+	// AccountManager.Client. It will be invoked in an arbitrary goroutine.
+	Reauth func(id string)
+}
+
+const defaultReauthMargin = 5 * time.Minute
+
+// AccountManager manages connections to multiple accounts.
+//
+// Connections are re-established on demand when they are closed.
+type AccountManager struct {
+	options AccountManagerOptions
+
+	mutex    sync.Mutex
+	accounts map[string]*managedAccount
+	closed   bool
+
+	now func() time.Time // for tests
+}
+
+type managedAccount struct {
+	config AccountConfig
+
+	mutex    sync.Mutex // protects fields below
+	client   *Client
+	leases   int // number of Acquire calls not released yet
+	failures int
+	retryAt  time.Time
+	lastErr  error
+	expiry   time.Time
+	// Expiry of the credentials which didn't change after re-establishing
+	// the connection
+	staleExpiry time.Time
+	// Fires when the connection needs to be re-established, to stop IDLE
+	reauthTimer *time.Timer
+}
+
+// NewAccountManager creates a new account manager.
+func NewAccountManager(options *AccountManagerOptions) *AccountManager {
+	m := &AccountManager{accounts: make(map[string]*managedAccount), now: time.Now}
+	if options != nil {
+		m.options = *options
+	}
+	return m
+}
+
+// Add adds an account and connects to it.
+func (m *AccountManager) Add(config AccountConfig) error {
+	if config.Connect == nil {
+		return fmt.Errorf("imapclient: missing Connect function for account %q", config.ID)
+	}
+
+	acc := &managedAccount{config: config}
+
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return fmt.Errorf("imapclient: account manager is closed")
+	} else if _, ok := m.accounts[config.ID]; ok {
+		m.mutex.Unlock()
+		return fmt.Errorf("imapclient: account %q already exists", config.ID)
+	}
+	m.accounts[config.ID] = acc
+	m.mutex.Unlock()
+
+	if _, err := m.connect(acc); err != nil {
+		m.mutex.Lock()
+		delete(m.accounts, config.ID)
+		m.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Remove logs out of an account and removes it.
+func (m *AccountManager) Remove(id string) error {
+	m.mutex.Lock()
+	acc := m.accounts[id]
+	delete(m.accounts, id)
+	m.mutex.Unlock()
+
+	if acc == nil {
+		return fmt.Errorf("imapclient: unknown account %q", id)
+	}
+	return acc.logout()
+}
+
+// Accounts returns the identifiers of all accounts, sorted.
+func (m *AccountManager) Accounts() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	l := make([]string, 0, len(m.accounts))
+	for id := range m.accounts {
+		l = append(l, id)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Client returns a client for an account.
+//
+// If the previous connection has been closed, a new one is established. If
+// the last connection attempt has failed and the backoff delay hasn't elapsed
+// yet, a *BackoffError is returned.
+//
+// If the credentials are about to expire, see AccountConfig.Expiry, the
+// connection is re-established as well and the previous client is logged
+// out. This only happens between commands: the returned client must only be
+// used to send a single command, e.g. a LIST or an IDLE command. Use Acquire
+// to send several commands, e.g. SELECT followed by FETCH.
+func (m *AccountManager) Client(id string) (*Client, error) {
+	m.mutex.Lock()
+	acc := m.accounts[id]
+	m.mutex.Unlock()
+
+	if acc == nil {
+		return nil, fmt.Errorf("imapclient: unknown account %q", id)
+	}
+	return m.connect(acc)
+}
+
+// Acquire returns a client for an account, like Client, and prevents the
+// connection from being re-established before expiry until release is
+// called.
+//
+// The connection may still be closed, e.g. by the server.
+func (m *AccountManager) Acquire(id string) (c *Client, release func(), err error) {
+	m.mutex.Lock()
+	acc := m.accounts[id]
+	m.mutex.Unlock()
+
+	if acc == nil {
+		return nil, nil, fmt.Errorf("imapclient: unknown account %q", id)
+	}
+
+	c, ev, err := m.tryConnect(acc, true)
+	if ev != nil && m.options.Backoff != nil {
+		m.options.Backoff(ev)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			acc.mutex.Lock()
+			acc.leases--
+			acc.mutex.Unlock()
+		})
+	}
+	return c, release, nil
+}
+
+// List lists the mailboxes matching a pattern in all accounts.
+//
+// Accounts are queried in the order returned by Accounts. If an error occurs,
+// the mailboxes listed so far are returned along with the error.
+func (m *AccountManager) List(pattern string, options *imap.ListOptions) ([]AccountListData, error) {
+	var l []AccountListData
+	for _, id := range m.Accounts() {
+		c, err := m.Client(id)
+		if err != nil {
+			return l, err
+		}
+		mailboxes, err := c.List("", pattern, options).Collect()
+		if err != nil {
+			return l, fmt.Errorf("imapclient: failed to list mailboxes for account %q: %w", id, err)
+		}
+		for _, data := range mailboxes {
+			l = append(l, AccountListData{Account: id, ListData: *data})
+		}
+	}
+	return l, nil
+}
+
+// Close logs out of all accounts.
+//
+// The first error encountered is returned.
+func (m *AccountManager) Close() error {
+	m.mutex.Lock()
+	m.closed = true
+	accounts := m.accounts
+	m.accounts = make(map[string]*managedAccount)
+	m.mutex.Unlock()
+
+	var (
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+		firstErr error
+	)
+	for _, acc := range accounts {
+		wg.Add(1)
+		go func(acc *managedAccount) {
+			defer wg.Done()
+			if err := acc.logout(); err != nil {
+				errMutex.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				errMutex.Unlock()
+			}
+		}(acc)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+func (m *AccountManager) connect(acc *managedAccount) (*Client, error) {
+	c, ev, err := m.tryConnect(acc, false)
+	if ev != nil && m.options.Backoff != nil {
+		m.options.Backoff(ev)
+	}
+	return c, err
+}
+
+// tryConnect returns the account's client, re-establishing the connection if
+// necessary. If the connection attempt fails, a backoff event is returned.
+// If lease is set and a client is returned, the client is leased, see
+// Acquire.
+func (m *AccountManager) tryConnect(acc *managedAccount, lease bool) (*Client, *BackoffEvent, error) {
+	acc.mutex.Lock()
+	defer acc.mutex.Unlock()
+
+	c, ev, err := m.tryConnectLocked(acc, false)
+	if lease && c != nil {
+		acc.leases++
+	}
+	return c, ev, err
+}
+
+// tryConnectLocked is tryConnect without locking. If force is set, the
+// connection is replaced even if commands are in progress, e.g. a stopped
+// IDLE command.
+func (m *AccountManager) tryConnectLocked(acc *managedAccount, force bool) (*Client, *BackoffEvent, error) {
+	now := m.now()
+
+	// The connection is only replaced between commands, when no caller
+	// holds it
+	prev := acc.client
+	if prev != nil && prev.State() != imap.ConnStateLogout {
+		if !m.needsReauth(acc, now) || (prev.hasPendingCommands() && !force) || acc.leases > 0 {
+			return prev, nil, nil
+		}
+	} else {
+		prev = nil
+	}
+
+	if acc.failures > 0 && now.Before(acc.retryAt) {
+		return nil, nil, &BackoffError{Account: acc.config.ID, RetryAt: acc.retryAt, Err: acc.lastErr}
+	}
+
+	c, err := acc.config.Connect(m.clientOptions(acc.config.ID))
+	if err != nil {
+		err = fmt.Errorf("imapclient: failed to connect to account %q: %w", acc.config.ID, err)
+		var ev *BackoffEvent
+		if isThrottleError(err) {
+			ev = m.backoff(acc, err)
+		}
+		if prev != nil {
+			// The credentials haven't expired yet, keep using the previous
+			// connection
+			return prev, ev, nil
+		}
+		return nil, ev, err
+	}
+
+	prevExpiry := acc.expiry
+	acc.client = c
+	acc.failures = 0
+	acc.lastErr = nil
+	acc.expiry = time.Time{}
+	if acc.config.Expiry != nil {
+		acc.expiry = acc.config.Expiry()
+	}
+
+	if prev != nil {
+		if !acc.expiry.After(prevExpiry) {
+			// Don't reconnect again until the credentials are refreshed
+			acc.staleExpiry = acc.expiry
+		}
+		go logoutClient(prev)
+	}
+	m.scheduleReauth(acc, now)
+	return c, nil, nil
+}
+
+// scheduleReauth arms the timer stopping IDLE before the credentials expire.
+// The caller must hold acc.mutex.
+func (m *AccountManager) scheduleReauth(acc *managedAccount, now time.Time) {
+	if acc.reauthTimer != nil {
+		acc.reauthTimer.Stop()
+		acc.reauthTimer = nil
+	}
+	t := m.reauthAt(acc)
+	if t.IsZero() {
+		return
+	}
+	acc.reauthTimer = time.AfterFunc(t.Sub(now), func() {
+		m.reauthIdle(acc)
+	})
+}
+
+// reauthIdle re-establishes the connection of an account if IDLE is running
+// and the credentials are about to expire. Connections without IDLE are
+// re-established on the next call to Client.
+func (m *AccountManager) reauthIdle(acc *managedAccount) {
+	acc.mutex.Lock()
+	c := acc.client
+	if c == nil || acc.leases > 0 || !m.needsReauth(acc, m.now()) {
+		acc.mutex.Unlock()
+		return
+	}
+	stopped, err := c.stopIdle()
+	if !stopped {
+		acc.mutex.Unlock()
+		return
+	}
+	var ev *BackoffEvent
+	if err == nil {
+		_, ev, _ = m.tryConnectLocked(acc, true)
+	}
+	acc.mutex.Unlock()
+
+	if ev != nil && m.options.Backoff != nil {
+		m.options.Backoff(ev)
+	}
+	if m.options.Reauth != nil {
+		m.options.Reauth(acc.config.ID)
+	}
+}
+
+// dial opens a new connection to an account, separate from the one returned
+// by Client. Unilateral data is delivered to handler instead of Event. The
+// caller is responsible for logging out.
+func (m *AccountManager) dial(id string, handler *UnilateralDataHandler) (*Client, error) {
+	m.mutex.Lock()
+	acc := m.accounts[id]
+	m.mutex.Unlock()
+
+	if acc == nil {
+		return nil, fmt.Errorf("imapclient: unknown account %q", id)
+	}
+
+	options := m.clientOptions(id)
+	options.UnilateralDataHandler = handler
+	c, err := acc.config.Connect(options)
+	if err != nil {
+		return nil, fmt.Errorf("imapclient: failed to connect to account %q: %w", id, err)
+	}
+	return c, nil
+}
+
+func (m *AccountManager) reauthMargin() time.Duration {
+	if m.options.ReauthMargin > 0 {
+		return m.options.ReauthMargin
+	}
+	return defaultReauthMargin
+}
+
+// reauthAt returns the time at which an account's connection needs to be
+// re-established, or a zero time if there is none. The caller must hold
+// acc.mutex.
+func (m *AccountManager) reauthAt(acc *managedAccount) time.Time {
+	if acc.expiry.IsZero() || acc.expiry.Equal(acc.staleExpiry) {
+		return time.Time{}
+	}
+	return acc.expiry.Add(-m.reauthMargin())
+}
+
+// needsReauth checks whether an account's connection needs to be
+// re-established because the credentials are about to expire. The caller must
+// hold acc.mutex.
+func (m *AccountManager) needsReauth(acc *managedAccount, now time.Time) bool {
+	t := m.reauthAt(acc)
+	return !t.IsZero() && !now.Before(t)
+}
+
+// backoff schedules the next connection attempt. The caller must hold
+// acc.mutex, and deliver the returned event once it's released.
+func (m *AccountManager) backoff(acc *managedAccount, err error) *BackoffEvent {
+	acc.failures++
+	acc.lastErr = err
+	acc.retryAt = m.now().Add(m.options.BackoffOptions.delay(acc.failures))
+
+	return &BackoffEvent{
+		Account: acc.config.ID,
+		Attempt: acc.failures,
+		Err:     err,
+		RetryAt: acc.retryAt,
+	}
+}
+
+func (m *AccountManager) clientOptions(id string) *Options {
+	var options Options
+	if m.options.ClientOptions != nil {
+		options = *m.options.ClientOptions
+	}
+
+	event := m.options.Event
+	if event == nil {
+		options.UnilateralDataHandler = nil
+		return &options
+	}
+	options.UnilateralDataHandler = &UnilateralDataHandler{
+		Expunge: func(seqNum uint32) {
+			event(&AccountEvent{Account: id, Expunge: seqNum})
+		},
+		Mailbox: func(data *UnilateralDataMailbox) {
+			event(&AccountEvent{Account: id, Mailbox: data})
+		},
+		Fetch: func(msg *FetchMessageData) {
+			event(&AccountEvent{Account: id, Fetch: msg})
+		},
+		List: func(data *imap.ListData) {
+			event(&AccountEvent{Account: id, List: data})
+		},
+		Vanished: func(uids imap.UIDSet) {
+			event(&AccountEvent{Account: id, Vanished: uids})
+		},
+	}
+	return &options
+}
+
+func (acc *managedAccount) logout() error {
+	acc.mutex.Lock()
+	c := acc.client
+	acc.client = nil
+	if acc.reauthTimer != nil {
+		acc.reauthTimer.Stop()
+		acc.reauthTimer = nil
+	}
+	acc.mutex.Unlock()
+
+	return logoutClient(c)
+}
+
+func logoutClient(c *Client) error {
+	if c == nil || c.State() == imap.ConnStateLogout {
+		return nil
+	}
+	if err := c.Logout().Wait(); err != nil {
+		c.Close()
+		return err
+	}
+	// The server closes the connection after LOGOUT
+	if err := c.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
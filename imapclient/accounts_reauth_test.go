@@ -0,0 +1,253 @@
+package imapclient
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// newReauthTestServer starts an in-memory server with a user "alice" whose
+// password is "secret", and returns its address.
+func newReauthTestServer(t *testing.T) string {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewConnSession(conn), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+	t.Cleanup(func() { server.Close() })
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	return ln.Addr().String()
+}
+
+func dialReauthTestServer(addr string, options *Options) (*Client, error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := New(conn, options)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func TestAccountManagerReauth(t *testing.T) {
+	addr := newReauthTestServer(t)
+
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var (
+		mutex    sync.Mutex
+		now      = t0
+		expiry   = t0.Add(time.Hour)
+		connects int
+	)
+	setNow := func(t time.Time) {
+		mutex.Lock()
+		now = t
+		mutex.Unlock()
+	}
+
+	m := NewAccountManager(nil)
+	m.now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return now
+	}
+	defer m.Close()
+
+	err := m.Add(AccountConfig{
+		ID: "alice",
+		Connect: func(options *Options) (*Client, error) {
+			c, err := dialReauthTestServer(addr, options)
+			if err != nil {
+				return nil, err
+			}
+			mutex.Lock()
+			connects++
+			mutex.Unlock()
+			return c, nil
+		},
+		Expiry: func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return expiry
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	client := func() *Client {
+		c, err := m.Client("alice")
+		if err != nil {
+			t.Fatalf("Client() = %v", err)
+		}
+		return c
+	}
+	waitLogout := func(c *Client) {
+		select {
+		case <-c.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("previous client not logged out")
+		}
+	}
+
+	c1 := client()
+
+	// The connection isn't replaced while IDLE is running
+	idleCmd, err := c1.Idle()
+	if err != nil {
+		t.Fatalf("Idle() = %v", err)
+	}
+	setNow(t0.Add(56 * time.Minute))
+	if c := client(); c != c1 {
+		t.Errorf("connection replaced during IDLE")
+	}
+	if err := idleCmd.Close(); err != nil {
+		t.Fatalf("IdleCommand.Close() = %v", err)
+	} else if err := idleCmd.Wait(); err != nil {
+		t.Fatalf("IdleCommand.Wait() = %v", err)
+	}
+
+	mutex.Lock()
+	expiry = t0.Add(2 * time.Hour)
+	mutex.Unlock()
+	c2 := client()
+	if c2 == c1 {
+		t.Fatalf("connection not replaced before expiry")
+	}
+	waitLogout(c1)
+
+	// The connection isn't replaced while it's held
+	c, release, err := m.Acquire("alice")
+	if err != nil {
+		t.Fatalf("Acquire() = %v", err)
+	} else if c != c2 {
+		t.Fatalf("Acquire() returned a new connection")
+	}
+	setNow(t0.Add(2*time.Hour - 4*time.Minute))
+	if c := client(); c != c2 {
+		t.Errorf("held connection replaced")
+	}
+	if _, err := c2.Select("INBOX").Wait(); err != nil {
+		t.Errorf("Select() on held connection = %v", err)
+	}
+	release()
+	release() // no-op
+
+	// The credentials haven't been refreshed: the connection is replaced
+	// once, then kept until expiry
+	c3 := client()
+	if c3 == c2 {
+		t.Fatalf("connection not replaced after release")
+	}
+	waitLogout(c2)
+	if c := client(); c != c3 {
+		t.Errorf("connection replaced again with stale credentials")
+	}
+
+	mutex.Lock()
+	n := connects
+	mutex.Unlock()
+	if n != 3 {
+		t.Errorf("Connect called %v times, want 3", n)
+	}
+}
+
+func TestAccountManagerReauthIdle(t *testing.T) {
+	addr := newReauthTestServer(t)
+
+	const margin = time.Hour
+	var (
+		mutex  sync.Mutex
+		expiry = time.Now().Add(margin + 100*time.Millisecond)
+	)
+	reauth := make(chan string, 1)
+	m := NewAccountManager(&AccountManagerOptions{
+		ReauthMargin: margin,
+		Reauth: func(id string) {
+			reauth <- id
+		},
+	})
+	defer m.Close()
+
+	err := m.Add(AccountConfig{
+		ID: "alice",
+		Connect: func(options *Options) (*Client, error) {
+			return dialReauthTestServer(addr, options)
+		},
+		Expiry: func() time.Time {
+			mutex.Lock()
+			defer mutex.Unlock()
+			e := expiry
+			expiry = expiry.Add(2 * margin)
+			return e
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	c1, err := m.Client("alice")
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	}
+	idleCmd, err := c1.Idle()
+	if err != nil {
+		t.Fatalf("Idle() = %v", err)
+	}
+
+	// IDLE spans the expiry: it's stopped and the connection is replaced
+	select {
+	case id := <-reauth:
+		if id != "alice" {
+			t.Errorf("Reauth(%q), want %q", id, "alice")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("IDLE not stopped before expiry")
+	}
+	if err := idleCmd.Close(); err != nil {
+		t.Errorf("IdleCommand.Close() after Reauth = %v", err)
+	}
+	if err := idleCmd.Wait(); err != nil {
+		t.Errorf("IdleCommand.Wait() = %v", err)
+	}
+	select {
+	case <-c1.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("previous client not logged out")
+	}
+
+	c2, err := m.Client("alice")
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	} else if c2 == c1 {
+		t.Fatalf("connection not replaced")
+	}
+	idleCmd, err = c2.Idle()
+	if err != nil {
+		t.Fatalf("Idle() on the new connection = %v", err)
+	}
+	if err := idleCmd.Close(); err != nil {
+		t.Fatalf("IdleCommand.Close() = %v", err)
+	} else if err := idleCmd.Wait(); err != nil {
+		t.Fatalf("IdleCommand.Wait() = %v", err)
+	}
+}
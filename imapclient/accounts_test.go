@@ -0,0 +1,77 @@
+package imapclient_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestAccountManagerBackoff(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+
+	var (
+		m        *imapclient.AccountManager
+		events   []*imapclient.BackoffEvent
+		retryErr error
+	)
+	m = imapclient.NewAccountManager(&imapclient.AccountManagerOptions{
+		BackoffOptions: &imapclient.BackoffOptions{Initial: time.Hour, Jitter: -1},
+		Backoff: func(ev *imapclient.BackoffEvent) {
+			events = append(events, ev)
+			// Calling the manager from the callback must not deadlock
+			_, retryErr = m.Client(ev.Account)
+		},
+	})
+
+	// Add removes the account when the first attempt fails, use Client on
+	// an account whose connection got closed instead
+	connected := false
+	err := m.Add(imapclient.AccountConfig{
+		ID: "alice",
+		Connect: func(options *imapclient.Options) (*imapclient.Client, error) {
+			if connected {
+				return nil, dialErr
+			}
+			connected = true
+			c1, c2 := net.Pipe()
+			c2.Close()
+			return imapclient.New(c1, options), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		// Wait for the client to notice the closed connection
+		for {
+			c, err := m.Client("alice")
+			if err != nil || c == nil {
+				done <- err
+				return
+			}
+			<-c.Done()
+		}
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Client() deadlocked")
+	}
+
+	if !errors.Is(err, dialErr) {
+		t.Errorf("Client() = %v, want dial error", err)
+	}
+	if len(events) != 1 || events[0].Attempt != 1 || !errors.Is(events[0].Err, dialErr) {
+		t.Errorf("Backoff events = %v, want one event for the dial error", events)
+	}
+	var backoffErr *imapclient.BackoffError
+	if !errors.As(retryErr, &backoffErr) {
+		t.Errorf("Client() from Backoff = %v, want *BackoffError", retryErr)
+	}
+}
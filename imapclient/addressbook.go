@@ -0,0 +1,123 @@
+package imapclient
+
+import (
+	"fmt"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const defaultAddressBookChunkSize = 500
+
+// AddressBookOptions contains options for Client.ExtractAddressBook.
+type AddressBookOptions struct {
+	// Number of messages fetched per FETCH command, defaults to 500
+	ChunkSize int
+}
+
+// Correspondent is an e-mail address found in message headers.
+type Correspondent struct {
+	// Most recently seen display name, if any
+	Name string
+	Addr string
+	// Number of messages the address appears in
+	Count int
+	// Date of the most recent message the address appears in
+	LastSeen time.Time
+}
+
+// ExtractAddressBook scans the envelopes of all messages in the currently
+// selected mailbox, and returns the unique addresses found in the From, To, Cc
+// and Bcc fields.
+//
+// Addresses are compared case-insensitively. The result is sorted by
+// decreasing count, then by decreasing last-seen date.
+func (c *Client) ExtractAddressBook(options *AddressBookOptions) ([]Correspondent, error) {
+	chunkSize := defaultAddressBookChunkSize
+	if options != nil && options.ChunkSize > 0 {
+		chunkSize = options.ChunkSize
+	}
+
+	mailbox := c.Mailbox()
+	if mailbox == nil {
+		return nil, fmt.Errorf("imapclient: address book extraction requires a selected mailbox")
+	}
+
+	m := make(map[string]*Correspondent)
+	for start := uint32(1); start <= mailbox.NumMessages; start += uint32(chunkSize) {
+		stop := start + uint32(chunkSize) - 1
+		if stop > mailbox.NumMessages {
+			stop = mailbox.NumMessages
+		}
+
+		msgs, err := c.Fetch(imap.SeqSetRange(start, stop), []imap.FetchItem{
+			imap.FetchItemEnvelope,
+			imap.FetchItemInternalDate,
+		}).Collect()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgs {
+			if msg.Envelope == nil {
+				continue
+			}
+			date := msg.InternalDate
+			if t, err := mail.ParseDate(msg.Envelope.Date); err == nil {
+				date = t
+			}
+			addCorrespondents(m, msg.Envelope, date)
+		}
+	}
+
+	l := make([]Correspondent, 0, len(m))
+	for _, corr := range m {
+		l = append(l, *corr)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Count != l[j].Count {
+			return l[i].Count > l[j].Count
+		}
+		if !l[i].LastSeen.Equal(l[j].LastSeen) {
+			return l[i].LastSeen.After(l[j].LastSeen)
+		}
+		return l[i].Addr < l[j].Addr
+	})
+	return l, nil
+}
+
+func addCorrespondents(m map[string]*Correspondent, envelope *imap.Envelope, date time.Time) {
+	// Count each address at most once per message
+	seen := make(map[string]struct{})
+	for _, addrs := range [][]imap.Address{envelope.From, envelope.To, envelope.Cc, envelope.Bcc} {
+		for _, addr := range addrs {
+			s := addr.Addr()
+			if s == "" {
+				continue // group marker
+			}
+			k := strings.ToLower(s)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			corr, ok := m[k]
+			if !ok {
+				corr = &Correspondent{Addr: s}
+				m[k] = corr
+			}
+			corr.Count++
+			if !date.Before(corr.LastSeen) {
+				corr.LastSeen = date
+				if addr.Name != "" {
+					corr.Name = addr.Name
+				}
+			} else if corr.Name == "" {
+				corr.Name = addr.Name
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestExtractAddressBook(t *testing.T) {
+	tests := []struct {
+		name string
+		msgs []string
+		want []imapclient.Correspondent
+	}{
+		{
+			name: "empty",
+			want: []imapclient.Correspondent{},
+		},
+		{
+			name: "count and order",
+			msgs: []string{
+				"From: Alice <alice@example.org>\r\n" +
+					"To: bob@example.org, Carol <carol@example.org>\r\n" +
+					"Date: Wed, 1 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+				"From: Bob <bob@example.org>\r\n" +
+					"To: Alice <alice@example.org>\r\n" +
+					"Date: Thu, 2 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+			},
+			want: []imapclient.Correspondent{
+				{Name: "Alice", Addr: "alice@example.org", Count: 2, LastSeen: time.Date(2023, 3, 2, 10, 0, 0, 0, time.UTC)},
+				{Name: "Bob", Addr: "bob@example.org", Count: 2, LastSeen: time.Date(2023, 3, 2, 10, 0, 0, 0, time.UTC)},
+				{Name: "Carol", Addr: "carol@example.org", Count: 1, LastSeen: time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name: "case-insensitive and once per message",
+			msgs: []string{
+				"From: Alice <Alice@Example.org>\r\n" +
+					"To: alice@example.org\r\n" +
+					"Cc: ALICE@EXAMPLE.ORG\r\n" +
+					"Date: Wed, 1 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+			},
+			want: []imapclient.Correspondent{
+				{Name: "Alice", Addr: "Alice@Example.org", Count: 1, LastSeen: time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name: "most recent name",
+			msgs: []string{
+				"From: Alice Smith <alice@example.org>\r\n" +
+					"Date: Thu, 2 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+				"From: Alice <alice@example.org>\r\n" +
+					"Date: Wed, 1 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+				"From: alice@example.org\r\n" +
+					"Date: Fri, 3 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+			},
+			want: []imapclient.Correspondent{
+				{Name: "Alice Smith", Addr: "alice@example.org", Count: 3, LastSeen: time.Date(2023, 3, 3, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name: "group",
+			msgs: []string{
+				"From: Alice <alice@example.org>\r\n" +
+					"To: undisclosed-recipients:;\r\n" +
+					"Date: Wed, 1 Mar 2023 10:00:00 +0000\r\n" +
+					"\r\n",
+			},
+			want: []imapclient.Correspondent{
+				{Name: "Alice", Addr: "alice@example.org", Count: 1, LastSeen: time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, nil)
+			if err := c.Login("alice", "secret").Wait(); err != nil {
+				t.Fatalf("Login() = %v", err)
+			}
+			for _, msg := range tc.msgs {
+				appendCmd := c.Append("INBOX", int64(len(msg)), nil)
+				appendCmd.Write([]byte(msg))
+				appendCmd.Close()
+				if _, err := appendCmd.Wait(); err != nil {
+					t.Fatalf("Append() = %v", err)
+				}
+			}
+			if _, err := c.Select("INBOX").Wait(); err != nil {
+				t.Fatalf("Select() = %v", err)
+			}
+
+			for _, chunkSize := range []int{0, 1} {
+				l, err := c.ExtractAddressBook(&imapclient.AddressBookOptions{ChunkSize: chunkSize})
+				if err != nil {
+					t.Fatalf("ExtractAddressBook() with chunk size %v = %v", chunkSize, err)
+				}
+				for i := range l {
+					l[i].LastSeen = l[i].LastSeen.UTC()
+				}
+				if !reflect.DeepEqual(l, tc.want) {
+					t.Errorf("ExtractAddressBook() with chunk size %v = %+v, want %+v", chunkSize, l, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractAddressBookNoMailbox(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if _, err := c.ExtractAddressBook(nil); err == nil {
+		t.Errorf("ExtractAddressBook() without a selected mailbox = nil, want error")
+	}
+}
@@ -1,24 +1,44 @@
 package imapclient
 
 import (
+	"bytes"
+	"fmt"
 	"io"
+	"strings"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
 // Append sends an APPEND command.
 //
 // The caller must call AppendCommand.Close.
 //
-// The options are optional.
+// The options are optional. AppendOptions.Flags may contain system flags and
+// arbitrary keywords: invalid flags are rejected before the command is sent.
+// If the destination mailbox is the selected mailbox, flags missing from its
+// PERMANENTFLAGS are handled according to AppendOptions.UnsupportedFlags.
 func (c *Client) Append(mailbox string, size int64, options *imap.AppendOptions) *AppendCommand {
-	cmd := &AppendCommand{}
-	cmd.enc = c.beginCommand("APPEND", cmd)
+	cmd := &AppendCommand{
+		size:    size,
+		options: options,
+	}
+	if !c.options.LowMemory {
+		cmd.retry = c.newTryCreateRetry(mailbox)
+	}
+
+	flags, err := c.appendFlags(mailbox, options)
+	if err != nil {
+		cmd.retry = nil
+	} else {
+		c.statusCache.invalidate(mailbox)
+	}
+	cmd.enc = c.beginFailedCommand("APPEND", cmd, err)
 	cmd.enc.SP().Mailbox(mailbox).SP()
-	if options != nil && len(options.Flags) > 0 {
-		cmd.enc.List(len(options.Flags), func(i int) {
-			cmd.enc.Flag(options.Flags[i])
+	if len(flags) > 0 {
+		cmd.enc.List(len(flags), func(i int) {
+			cmd.enc.Flag(flags[i])
 		}).SP()
 	}
 	if options != nil && !options.Time.IsZero() {
@@ -36,10 +56,27 @@ type AppendCommand struct {
 	enc  *commandEncoder
 	wc   io.WriteCloser
 	data imap.AppendData
+
+	size    int64
+	options *imap.AppendOptions
+	retry   *tryCreateRetry
+	buf     bytes.Buffer
+	// Error returned by wc, if the command can be retried
+	writeErr error
 }
 
 func (cmd *AppendCommand) Write(b []byte) (int, error) {
-	return cmd.wc.Write(b)
+	if cmd.retry == nil {
+		return cmd.wc.Write(b)
+	}
+
+	// The server may reject the command before accepting the literal: keep
+	// going, the error will be returned by Wait
+	cmd.buf.Write(b)
+	if cmd.writeErr == nil {
+		_, cmd.writeErr = cmd.wc.Write(b)
+	}
+	return len(b), nil
 }
 
 func (cmd *AppendCommand) Close() error {
@@ -48,9 +85,139 @@ func (cmd *AppendCommand) Close() error {
 		cmd.enc.end()
 		cmd.enc = nil
 	}
+	if cmd.writeErr != nil {
+		return nil
+	}
 	return err
 }
 
 func (cmd *AppendCommand) Wait() (*imap.AppendData, error) {
-	return &cmd.data, cmd.cmd.Wait()
+	err := cmd.cmd.Wait()
+	if ok, createErr := cmd.retry.create(err); createErr != nil {
+		return nil, createErr
+	} else if ok {
+		return cmd.retryAppend()
+	}
+	if err == nil && cmd.writeErr != nil {
+		err = cmd.writeErr
+	}
+	return &cmd.data, err
+}
+
+func (cmd *AppendCommand) retryAppend() (*imap.AppendData, error) {
+	retryCmd := cmd.retry.client.Append(cmd.retry.mailbox, cmd.size, cmd.options)
+	retryCmd.retry = nil
+	if _, err := retryCmd.Write(cmd.buf.Bytes()); err != nil {
+		retryCmd.Close()
+		return nil, err
+	}
+	if err := retryCmd.Close(); err != nil {
+		return nil, err
+	}
+	return retryCmd.Wait()
+}
+
+// UnsupportedFlagsError is returned by AppendCommand.Wait when the command
+// hasn't been sent because the destination mailbox can't store some of the
+// flags permanently.
+type UnsupportedFlagsError struct {
+	Mailbox string
+	Flags   []imap.Flag
+}
+
+// Error implements the error interface.
+func (err *UnsupportedFlagsError) Error() string {
+	l := make([]string, len(err.Flags))
+	for i, flag := range err.Flags {
+		l[i] = string(flag)
+	}
+	return fmt.Sprintf("imapclient: mailbox %q doesn't support flags %v", err.Mailbox, strings.Join(l, " "))
+}
+
+// appendFlags returns the flags to send in an APPEND command.
+func (c *Client) appendFlags(mailbox string, options *imap.AppendOptions) ([]imap.Flag, error) {
+	if options == nil {
+		return nil, nil
+	}
+	for _, flag := range options.Flags {
+		if err := checkAppendFlag(flag); err != nil {
+			return nil, err
+		}
+	}
+	if options.UnsupportedFlags == imap.UnsupportedFlagsSend || len(options.Flags) == 0 {
+		return options.Flags, nil
+	}
+
+	selected := c.Mailbox()
+	if selected == nil || selected.PermanentFlags == nil || !sameMailbox(selected.Name, mailbox) {
+		return options.Flags, nil
+	}
+
+	var supported, unsupported []imap.Flag
+	for _, flag := range options.Flags {
+		if isPermanentFlag(selected.PermanentFlags, flag) {
+			supported = append(supported, flag)
+		} else {
+			unsupported = append(unsupported, flag)
+		}
+	}
+	if len(unsupported) == 0 {
+		return options.Flags, nil
+	}
+
+	switch options.UnsupportedFlags {
+	case imap.UnsupportedFlagsStrip:
+		if f := c.options.StrippedFlags; f != nil {
+			f(mailbox, unsupported)
+		}
+		return supported, nil
+	case imap.UnsupportedFlagsReject:
+		return nil, &UnsupportedFlagsError{Mailbox: mailbox, Flags: unsupported}
+	default:
+		panic(fmt.Errorf("imapclient: unknown unsupported flags mode %v", options.UnsupportedFlags))
+	}
+}
+
+var appendSystemFlags = []imap.Flag{
+	imap.FlagSeen,
+	imap.FlagAnswered,
+	imap.FlagFlagged,
+	imap.FlagDeleted,
+	imap.FlagDraft,
+}
+
+// checkAppendFlag checks that a flag can be set by an APPEND command: it must
+// be a system flag other than \Recent, or a keyword made of atom characters.
+func checkAppendFlag(flag imap.Flag) error {
+	if strings.HasPrefix(string(flag), "\\") {
+		for _, f := range appendSystemFlags {
+			if strings.EqualFold(string(f), string(flag)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("imapclient: flag %v cannot be set by APPEND", flag)
+	}
+	if flag == "" {
+		return fmt.Errorf("imapclient: empty keyword")
+	}
+	for i := 0; i < len(flag); i++ {
+		if !imapwire.IsAtomChar(flag[i]) {
+			return fmt.Errorf("imapclient: invalid keyword %q", flag)
+		}
+	}
+	return nil
+}
+
+func isPermanentFlag(permanentFlags []imap.Flag, flag imap.Flag) bool {
+	isKeyword := !strings.HasPrefix(string(flag), "\\")
+	for _, f := range permanentFlags {
+		if strings.EqualFold(string(f), string(flag)) || (isKeyword && f == imap.FlagWildcard) {
+			return true
+		}
+	}
+	return false
+}
+
+func sameMailbox(a, b string) bool {
+	return imap.MailboxName{Name: a}.Equal(imap.MailboxName{Name: b})
 }
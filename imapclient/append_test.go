@@ -0,0 +1,88 @@
+package imapclient_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestAppendInvalidFlag(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	msg := "Subject: Hi\r\n\r\nHi!\r\n"
+	appendCmd := c.Append("INBOX", int64(len(msg)), &imap.AppendOptions{
+		Flags: []imap.Flag{imap.FlagRecent},
+	})
+	if _, err := appendCmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("AppendCommand.Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("AppendCommand.Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err == nil {
+		t.Errorf("Append() with \\Recent succeeded")
+	}
+
+	// The command hasn't been sent
+	data, err := c.Status("INBOX", []imap.StatusItem{imap.StatusItemNumMessages}).Wait()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	} else if *data.NumMessages != 0 {
+		t.Errorf("NumMessages = %v, want 0", *data.NumMessages)
+	}
+}
+
+func TestAppendKeywords(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: `T1 APPEND INBOX (\Seen $MDNSent $Forwarded Junk) {2}`, responses: []string{"+ send literal"}},
+			{command: "Hi", responses: []string{"T1 OK APPEND completed"}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	appendCmd := c.Append("INBOX", 2, &imap.AppendOptions{
+		Flags: []imap.Flag{imap.FlagSeen, imap.FlagMDNSent, "$Forwarded", "Junk"},
+	})
+	appendCmd.Write([]byte("Hi"))
+	appendCmd.Close()
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Errorf("Append() = %v", err)
+	}
+}
+
+func TestAppendInvalidKeyword(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	for _, flag := range []imap.Flag{"", "foo bar", "(foo", "foo*", `\Unknown`} {
+		appendCmd := c.Append("INBOX", 2, &imap.AppendOptions{
+			Flags: []imap.Flag{flag},
+		})
+		appendCmd.Write([]byte("Hi"))
+		appendCmd.Close()
+		if _, err := appendCmd.Wait(); err == nil {
+			t.Errorf("Append() with %q succeeded", flag)
+		}
+	}
+}
@@ -25,6 +25,7 @@ func (c *Client) Authenticate(saslClient sasl.Client) error {
 	}
 
 	cmd := &authenticateCommand{}
+	c.beginAuth(&cmd.authCaps)
 	contReq := c.registerContReq(cmd)
 	enc := c.beginCommand("AUTHENTICATE", cmd)
 	enc.SP().Atom(mech)
@@ -73,6 +74,7 @@ func (c *Client) Authenticate(saslClient sasl.Client) error {
 
 type authenticateCommand struct {
 	cmd
+	authCaps
 }
 
 func (c *Client) writeSASLResp(resp []byte) error {
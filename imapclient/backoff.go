@@ -0,0 +1,119 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultBackoffInitial    = time.Second
+	defaultBackoffMax        = 30 * time.Minute
+	defaultBackoffMultiplier = 2
+	defaultBackoffJitter     = 0.2
+)
+
+// BackoffOptions contains options for the exponential backoff applied by an
+// AccountManager when a connection attempt fails.
+type BackoffOptions struct {
+	// Delay after the first failure, defaults to 1s
+	Initial time.Duration
+	// Maximum delay, defaults to 30min
+	Max time.Duration
+	// Factor applied to the delay after each consecutive failure, defaults
+	// to 2
+	Multiplier float64
+	// Fraction of the delay randomly added or subtracted, defaults to 0.2.
+	// Set to a negative value to disable jitter.
+	Jitter float64
+}
+
+func (options *BackoffOptions) delay(attempt int) time.Duration {
+	initial := defaultBackoffInitial
+	max := defaultBackoffMax
+	multiplier := float64(defaultBackoffMultiplier)
+	jitter := defaultBackoffJitter
+	if options != nil {
+		if options.Initial > 0 {
+			initial = options.Initial
+		}
+		if options.Max > 0 {
+			max = options.Max
+		}
+		if options.Multiplier >= 1 {
+			multiplier = options.Multiplier
+		}
+		if options.Jitter != 0 {
+			jitter = options.Jitter
+		}
+	}
+
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= multiplier
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	if jitter > 0 {
+		d += d * jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// BackoffEvent describes a failed connection attempt.
+type BackoffEvent struct {
+	Account string
+	// Number of consecutive failures
+	Attempt int
+	// Error returned by the connection attempt
+	Err error
+	// No new attempt is made before this time
+	RetryAt time.Time
+}
+
+// BackoffError is returned by AccountManager when a connection isn't
+// attempted because of a previous failure.
+type BackoffError struct {
+	Account string
+	RetryAt time.Time
+	// Error returned by the last connection attempt
+	Err error
+}
+
+// Error implements the error interface.
+func (err *BackoffError) Error() string {
+	return fmt.Sprintf("imapclient: not reconnecting to account %q before %v: %v", err.Account, err.RetryAt.Format(time.RFC3339), err.Err)
+}
+
+// Unwrap returns the error returned by the last connection attempt.
+func (err *BackoffError) Unwrap() error {
+	return err.Err
+}
+
+// isThrottleError checks whether an error returned by a connection attempt
+// should delay the next attempt.
+//
+// This includes network errors, since the server may be unreachable for a
+// while, and authentication failures, since retrying with the same
+// credentials in a tight loop may lock the account.
+func isThrottleError(err error) bool {
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) {
+		// Dial and I/O errors
+		return true
+	}
+	switch imapErr.Code {
+	case imap.ResponseCodeAuthenticationFailed, imap.ResponseCodeUnavailable, imap.ResponseCodeLimit:
+		return true
+	case "":
+		// Servers aren't required to send AUTHENTICATIONFAILED on LOGIN
+		// failure
+		return imapErr.Type == imap.StatusResponseTypeNo
+	default:
+		return false
+	}
+}
@@ -19,10 +19,22 @@ func (c *Client) handleCapability() error {
 	if err != nil {
 		return err
 	}
-	c.setCaps(caps)
+	// A pending CAPABILITY command takes precedence. Otherwise,
+	// capabilities sent during authentication are only valid once it
+	// succeeds.
 	if cmd := findPendingCmdByType[*CapabilityCommand](c); cmd != nil {
+		c.setCaps(caps)
 		cmd.caps = caps
+		return nil
+	} else if cmd := findOldestPendingCmdByType[*loginCommand](c); cmd != nil {
+		cmd.after = caps
+		return nil
+	} else if cmd := findOldestPendingCmdByType[*authenticateCommand](c); cmd != nil {
+		cmd.after = caps
+		return nil
 	}
+
+	c.setCaps(caps)
 	return nil
 }
 
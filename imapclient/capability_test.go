@@ -0,0 +1,59 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestCapabilityDuringLogin(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	defer serverConn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		br := bufio.NewReader(serverConn)
+		if _, err := io.WriteString(serverConn, "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN] ready\r\n"); err != nil {
+			done <- err
+			return
+		}
+		// Wait for both commands before replying
+		for i := 0; i < 2; i++ {
+			if _, err := br.ReadString('\n'); err != nil {
+				done <- err
+				return
+			}
+		}
+		_, err := io.WriteString(serverConn, "* CAPABILITY IMAP4rev1 AUTH=PLAIN\r\n"+
+			"T2 OK CAPABILITY completed\r\n"+
+			"T1 OK [CAPABILITY IMAP4rev1 IDLE] Logged in\r\n")
+		done <- err
+	}()
+
+	c := imapclient.New(clientConn, nil)
+	defer c.Close()
+
+	loginCmd := c.Login("alice", "secret")
+	caps, err := c.Capability().Wait()
+	if err != nil {
+		t.Fatalf("Capability() = %v", err)
+	}
+	if !caps.Has(imap.Cap("AUTH=PLAIN")) {
+		t.Errorf("Capability() = %v, want the CAPABILITY response", caps)
+	}
+	if err := loginCmd.Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("server: %v", err)
+	}
+
+	// The capabilities sent with the LOGIN response are used afterwards
+	if caps := c.Caps(); !caps.Has(imap.CapIdle) || caps.Has(imap.Cap("AUTH=PLAIN")) {
+		t.Errorf("Caps() after LOGIN = %v", caps)
+	}
+}
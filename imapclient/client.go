@@ -4,6 +4,8 @@ package imapclient
 import (
 	"bufio"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
@@ -14,7 +16,6 @@ import (
 	"time"
 
 	"github.com/emersion/go-imap/v2"
-	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
@@ -31,8 +32,15 @@ const (
 type SelectedMailbox struct {
 	Name           string
 	NumMessages    uint32
+	UIDValidity    uint32
 	Flags          []imap.Flag
 	PermanentFlags []imap.Flag
+	// Whether the mailbox has been opened with EXAMINE
+	ReadOnly bool
+
+	// Deprecated: RECENT has been removed in IMAP4rev2. It's only returned
+	// by IMAP4rev1 servers.
+	NumRecent uint32
 }
 
 func (mbox *SelectedMailbox) copy() *SelectedMailbox {
@@ -44,24 +52,155 @@ func (mbox *SelectedMailbox) copy() *SelectedMailbox {
 type Options struct {
 	// Raw ingress and egress data will be written to this writer, if any.
 	// Note, this may include sensitive information such as credentials used
-	// during authentication.
+	// during authentication. It can be changed later with
+	// Client.SetDebugWriter.
 	DebugWriter io.Writer
 	// Unilateral data handler.
 	UnilateralDataHandler *UnilateralDataHandler
 	// Decoder for RFC 2047 words.
 	WordDecoder *mime.WordDecoder
+	// Parsers for response codes unknown to this package, indexed by
+	// response code.
+	ResponseCodeParsers map[imap.ResponseCode]ResponseCodeParser
+	// If set, the destination mailbox of a COPY, MOVE or APPEND command
+	// failing with the TRYCREATE response code is created, and the command is
+	// retried once.
+	//
+	// APPEND commands keep a copy of the message in memory to be able to
+	// retry.
+	AutoCreateMailbox bool
+	// Callbacks invoked for each command, if any. They can be changed later
+	// with Client.SetCommandHooks.
+	CommandHooks *CommandHooks
+	// StrippedFlags is called when flags are removed from an APPEND command
+	// because the destination mailbox can't store them permanently. See
+	// imap.UnsupportedFlagsStrip.
+	StrippedFlags func(mailbox string, flags []imap.Flag)
+	// AuthCapsChanged is called when the capabilities advertised after
+	// authentication differ from the ones advertised before. Extensions
+	// available before authentication may be withdrawn, and new ones may be
+	// advertised.
+	//
+	// The callback is invoked while reading responses, so it must not wait
+	// for commands to complete.
+	AuthCapsChanged func(before, after imap.CapSet)
+	// How mailbox names are encoded on the wire. Defaults to
+	// MailboxNameEncodingAuto. LIST patterns are sent verbatim, unless
+	// MailboxNameEncodingUTF7 is used.
+	MailboxNameEncoding MailboxNameEncoding
+	// Tag generator, called with a counter starting at 1 for each command. It
+	// must return a unique tag made of atom characters other than "+". If
+	// nil, tags are "T" followed by the counter.
+	//
+	// If the returned tag is already used by a pending command, the new
+	// command fails without being sent.
+	//
+	// For instance, proxies can namespace their tags:
+	//
+	//	func(n uint64) string { return fmt.Sprintf("proxy-%04d", n) }
+	TagGenerator func(n uint64) string
+	// If non-zero, STATUS results are cached for this duration, and Status
+	// doesn't send a command if all of the requested items are cached.
+	//
+	// Cached entries are invalidated when the client learns that a mailbox
+	// has changed: EXISTS, EXPUNGE, VANISHED and FETCH responses for the
+	// selected mailbox, unsolicited STATUS responses, and APPEND, COPY, MOVE,
+	// STORE, CLOSE, UNSELECT, DELETE and RENAME commands sent by the client.
+	// Changes made by other clients aren't noticed before the entry expires,
+	// unless Client.InvalidateStatus is called.
+	StatusCacheTTL time.Duration
+	// LowMemory reduces the memory used by the client, for constrained
+	// environments such as embedded mail checkers:
+	//
+	//   - FETCH and EXPUNGE responses aren't queued: the client stops reading
+	//     responses until the previous message has been consumed with
+	//     FetchCommand.Next or ExpungeCommand.Next.
+	//   - Read and write buffers are smaller, which results in more system
+	//     calls.
+	//   - APPEND commands don't keep a copy of the message, so
+	//     AutoCreateMailbox doesn't retry them.
+	//
+	// Message bodies are always streamed with FetchItemDataBodySection.Literal
+	// and FetchItemDataBinarySection.Literal. Helpers which collect messages
+	// in memory, such as FetchCommand.Collect, FetchMessageData.Collect and
+	// Client.GetMessage, should be avoided in this mode. Leaving a FETCH or
+	// EXPUNGE command unconsumed blocks all other commands.
+	LowMemory bool
+	// If non-nil, an ID command with these fields is sent once the greeting
+	// has been received, if the server supports the ID extension. The
+	// response is used to fill in Client.ServerInfo.
+	ID map[string]string
+	// If set, the optional ID and ENABLE commands failing with a BAD
+	// response are treated as soft failures: the command completes without
+	// error, as if the server didn't return any data. The failure is recorded
+	// in Client.Quirks, and subsequent commands with the same name complete
+	// immediately without being sent.
+	//
+	// This works around servers which advertise these extensions but don't
+	// implement them correctly. NO responses are still reported as errors.
+	ProbeExtensions bool
+	// When commands are written to the connection. Defaults to
+	// FlushModeAuto.
+	//
+	// With other modes, commands are written in batches, which reduces the
+	// number of system calls and TCP segments when sending many small
+	// commands. Methods sending commands may return before the command has
+	// been written.
+	FlushMode FlushMode
+	// Maximum delay before commands are written with FlushModeCoalesce.
+	// Defaults to 1ms.
+	FlushDelay time.Duration
+	// Maximum length of a command line accepted by the server, in bytes,
+	// literals excluded. If zero, the limit is guessed, see
+	// Client.MaxCommandLength.
+	MaxCommandLength int
+	// If set, FetchCommand.Collect and Client.BatchFetch return messages in
+	// the order sent by the server, instead of sorting them.
+	PreserveFetchOrder bool
+
+	// The following fields configure the TLS connection established by
+	// DialTLS and DialStartTLS.
+
+	// Root certificate authorities used to verify the server certificate. If
+	// nil, the host's root CA set is used.
+	RootCAs *x509.CertPool
+	// VerifyConnection is called after the TLS handshake, once the server
+	// certificate has been verified. If it returns an error, the connection
+	// is aborted.
+	VerifyConnection func(state tls.ConnectionState) error
+	// InsecureSkipVerify disables server certificate verification. The
+	// connection is vulnerable to man-in-the-middle attacks unless
+	// VerifyConnection performs its own checks.
+	InsecureSkipVerify bool
+	// InsecureSkipVerifyFunc, if set, is called with the server hostname
+	// each time a TLS connection is established with InsecureSkipVerify, for
+	// instance to log a warning.
+	InsecureSkipVerifyFunc func(host string)
 }
 
-func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
-	if options.DebugWriter == nil {
-		return rw
+// MailboxNameEncoding describes how mailbox names are encoded on the wire.
+type MailboxNameEncoding int
+
+const (
+	// Use modified UTF-7, unless IMAP4rev2 or UTF8=ACCEPT has been enabled
+	MailboxNameEncodingAuto MailboxNameEncoding = iota
+	// Always use modified UTF-7
+	MailboxNameEncodingUTF7
+	// Send and receive mailbox names as-is, without any conversion. This can
+	// be used with servers which don't implement modified UTF-7 correctly.
+	MailboxNameEncodingRaw
+)
+
+func (options *Options) tlsConfig(host string) *tls.Config {
+	if options.InsecureSkipVerify && options.InsecureSkipVerifyFunc != nil {
+		options.InsecureSkipVerifyFunc(host)
 	}
-	return struct {
-		io.Reader
-		io.Writer
-	}{
-		Reader: io.TeeReader(rw, options.DebugWriter),
-		Writer: io.MultiWriter(rw, options.DebugWriter),
+	return &tls.Config{
+		ServerName:         host,
+		NextProtos:         []string{"imap"},
+		RootCAs:            options.RootCAs,
+		VerifyConnection:   options.VerifyConnection,
+		InsecureSkipVerify: options.InsecureSkipVerify,
 	}
 }
 
@@ -77,6 +216,13 @@ func (options *Options) decodeText(s string) (string, error) {
 	return out, nil
 }
 
+func (options *Options) tag(n uint64) string {
+	if options.TagGenerator != nil {
+		return options.TagGenerator(n)
+	}
+	return fmt.Sprintf("T%v", n)
+}
+
 func (options *Options) unilateralDataHandler() *UnilateralDataHandler {
 	if options.UnilateralDataHandler == nil {
 		return &UnilateralDataHandler{}
@@ -108,17 +254,35 @@ type Client struct {
 	greetingRecv bool
 	greetingErr  error
 
+	serverInfoCh   chan struct{} // closed once ServerInfo is populated
+	serverInfoOnce sync.Once
+
+	counters    *byteCounters
+	tracer      *tracer
+	statusCache *statusCache // nil if disabled
+
 	decCh  chan struct{}
 	decErr error
+	bye    *imap.Error // BYE response sent by the server, if any
 
 	mutex       sync.Mutex
 	state       imap.ConnState
 	caps        imap.CapSet
+	preAuthCaps imap.CapSet // set until the post-authentication caps are known
+	enabled     imap.CapSet
+	serverInfo  ServerInfo
+	badCommands map[string]*imap.Error // see Options.ProbeExtensions
 	mailbox     *SelectedMailbox
 	cmdTag      uint64
 	pendingCmds []command
+	idle        *IdleCommand // running IDLE command, if any
 	contReqs    []continuationRequest
+	flusher     *flushWriter // nil with FlushModeAuto
 	closed      bool
+	loggedOut   bool
+
+	// Handlers for CONTEXT=SEARCH updates, keyed by SEARCH command tag
+	searchUpdates map[string]func(*searchContextUpdate)
 }
 
 // New creates a new IMAP client.
@@ -131,29 +295,43 @@ func New(conn net.Conn, options *Options) *Client {
 		options = &Options{}
 	}
 
-	rw := options.wrapReadWriter(conn)
-	br := bufio.NewReader(rw)
-	bw := bufio.NewWriter(rw)
+	counters := new(byteCounters)
+	tracer := &tracer{
+		debugWriter: options.DebugWriter,
+		hooks:       options.CommandHooks,
+	}
+	rw := tracingReadWriter{countingReadWriter{conn, counters}, tracer}
+	br := options.newBufioReader(rw)
 
 	client := &Client{
-		conn:       conn,
-		options:    *options,
-		br:         br,
-		bw:         bw,
-		dec:        imapwire.NewDecoder(br, imapwire.ConnSideClient),
-		greetingCh: make(chan struct{}),
-		decCh:      make(chan struct{}),
-		state:      imap.ConnStateNone,
+		conn:         conn,
+		options:      *options,
+		br:           br,
+		dec:          imapwire.NewDecoder(br, imapwire.ConnSideClient),
+		greetingCh:   make(chan struct{}),
+		serverInfoCh: make(chan struct{}),
+		counters:     counters,
+		tracer:       tracer,
+		statusCache:  newStatusCache(options.StatusCacheTTL),
+		decCh:        make(chan struct{}),
+		state:        imap.ConnStateNone,
 	}
+	client.setWriter(rw)
 	go client.read()
 	return client
 }
 
 // DialTLS connects to an IMAP server with implicit TLS.
 func DialTLS(address string, options *Options) (*Client, error) {
-	conn, err := tls.Dial("tcp", address, &tls.Config{
-		NextProtos: []string{"imap"},
-	})
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if options == nil {
+		options = &Options{}
+	}
+
+	conn, err := tls.Dial("tcp", address, options.tlsConfig(host))
 	if err != nil {
 		return nil, err
 	}
@@ -167,13 +345,19 @@ func DialStartTLS(address string, options *Options) (*Client, error) {
 		return nil, err
 	}
 
+	if options == nil {
+		options = &Options{}
+	}
+
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
 		return nil, err
 	}
 
+	tlsConfig := options.tlsConfig(host)
+	tlsConfig.NextProtos = nil
 	client := New(conn, options)
-	if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+	if err := client.StartTLS(tlsConfig); err != nil {
 		conn.Close()
 		return nil, err
 	}
@@ -189,7 +373,19 @@ func (c *Client) setReadTimeout(dur time.Duration) {
 	}
 }
 
+// setWriteTimeout sets the write deadline while encoding a command.
+//
+// With FlushModeManual and FlushModeCoalesce, encoded commands are buffered
+// and may be written by another goroutine: the deadline is set by the
+// flushWriter instead.
 func (c *Client) setWriteTimeout(dur time.Duration) {
+	if c.options.FlushMode != FlushModeAuto {
+		return
+	}
+	c.setConnWriteTimeout(dur)
+}
+
+func (c *Client) setConnWriteTimeout(dur time.Duration) {
 	if dur > 0 {
 		c.conn.SetWriteDeadline(time.Now().Add(dur))
 	} else {
@@ -204,6 +400,13 @@ func (c *Client) State() imap.ConnState {
 	return c.state
 }
 
+// hasPendingCommands checks whether commands are in progress.
+func (c *Client) hasPendingCommands() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.pendingCmds) > 0
+}
+
 func (c *Client) setState(state imap.ConnState) {
 	c.mutex.Lock()
 	c.state = state
@@ -235,12 +438,76 @@ func (c *Client) Caps() imap.CapSet {
 	return caps
 }
 
+// MailboxNameEncoding returns the encoding currently used for mailbox names:
+// either MailboxNameEncodingUTF7 or MailboxNameEncodingRaw.
+func (c *Client) MailboxNameEncoding() MailboxNameEncoding {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.mailboxNameEncodingLocked()
+}
+
+func (c *Client) mailboxNameEncodingLocked() MailboxNameEncoding {
+	switch c.options.MailboxNameEncoding {
+	case MailboxNameEncodingAuto:
+		if c.enabled.Has(imap.CapIMAP4rev2) || c.enabled.Has(imap.CapUTF8Accept) {
+			return MailboxNameEncodingRaw
+		}
+		return MailboxNameEncodingUTF7
+	default:
+		return c.options.MailboxNameEncoding
+	}
+}
+
 func (c *Client) setCaps(caps imap.CapSet) {
 	c.mutex.Lock()
 	c.caps = caps
+	c.updateServerInfoLocked()
+	before := c.preAuthCaps
+	if caps != nil {
+		c.preAuthCaps = nil
+	}
+	c.mutex.Unlock()
+
+	if before != nil && caps != nil && !capSetEqual(before, caps) && c.options.AuthCapsChanged != nil {
+		c.options.AuthCapsChanged(before, caps)
+	}
+}
+
+// setAuthCaps updates the capabilities once the client has authenticated.
+// The server may have included them in the tagged OK response, or sent them
+// in an untagged CAPABILITY response. Otherwise, they'll be requested on the
+// next call to Caps.
+func (c *Client) setAuthCaps(auth *authCaps) {
+	c.mutex.Lock()
+	c.preAuthCaps = auth.before
+	c.mutex.Unlock()
+
+	c.setCaps(auth.after)
+}
+
+// authCaps tracks the capabilities advertised during authentication.
+type authCaps struct {
+	before, after imap.CapSet
+}
+
+func (c *Client) beginAuth(auth *authCaps) {
+	c.mutex.Lock()
+	auth.before = c.caps
 	c.mutex.Unlock()
 }
 
+func capSetEqual(a, b imap.CapSet) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for c := range a {
+		if !b.Has(c) {
+			return false
+		}
+	}
+	return true
+}
+
 // Mailbox returns the state of the currently selected mailbox.
 //
 // If there is no currently selected mailbox, nil is returned.
@@ -275,42 +542,142 @@ func (c *Client) Close() error {
 	return nil
 }
 
+// ErrLoggedOut is returned by Client.Err when the connection ended after a
+// LOGOUT command.
+var ErrLoggedOut = errors.New("imapclient: logged out")
+
+// Done returns a channel which is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.decCh
+}
+
+// Err returns the reason why the connection ended, or nil if the connection
+// is still alive. See Done.
+//
+// The error is:
+//
+//   - ErrLoggedOut if a LOGOUT command has been sent,
+//   - net.ErrClosed if Close has been called,
+//   - an *imap.Error of type BYE if the server closed the connection with a
+//     BYE response (e.g. because of an authentication problem or because the
+//     server is shutting down),
+//   - otherwise, the network or protocol error which interrupted the
+//     connection. io.ErrUnexpectedEOF is returned if the server closed the
+//     connection without notice.
+func (c *Client) Err() error {
+	select {
+	case <-c.decCh:
+		// Connection ended
+	default:
+		return nil
+	}
+
+	c.mutex.Lock()
+	loggedOut, closed := c.loggedOut, c.closed
+	c.mutex.Unlock()
+
+	switch {
+	case loggedOut:
+		return ErrLoggedOut
+	case closed:
+		return net.ErrClosed
+	case c.bye != nil:
+		return c.bye
+	case c.decErr != nil:
+		return c.decErr
+	default:
+		return io.ErrUnexpectedEOF
+	}
+}
+
 // beginCommand starts sending a command to the server.
 //
 // The command name and a space are written.
 //
 // The caller must call commandEncoder.end.
 func (c *Client) beginCommand(name string, cmd command) *commandEncoder {
+	return c.beginFailedCommand(name, cmd, nil)
+}
+
+// beginFailedCommand is like beginCommand, but fails the command with err
+// without sending it if err is not nil, for instance if the command arguments
+// are invalid. The command is handled like a command vetoed by
+// CommandHooks.Send.
+func (c *Client) beginFailedCommand(name string, cmd command, err error) *commandEncoder {
 	c.encMutex.Lock() // unlocked by commandEncoder.end
 
+	hooks := c.tracer.commandHooks()
+
 	c.mutex.Lock()
 	c.cmdTag++
-	tag := fmt.Sprintf("T%v", c.cmdTag)
-	c.pendingCmds = append(c.pendingCmds, cmd)
+	tag := c.options.tag(c.cmdTag)
+	vetoErr := err
+	if vetoErr == nil {
+		for _, pending := range c.pendingCmds {
+			if pending.base().tag == tag {
+				vetoErr = fmt.Errorf("imapclient: duplicate command tag %q", tag)
+				break
+			}
+		}
+	}
+	if vetoErr == nil && hooks != nil && hooks.Send != nil {
+		vetoErr = hooks.Send(tag, name)
+	}
+	if vetoErr == nil {
+		c.pendingCmds = append(c.pendingCmds, cmd)
+	}
 	quotedUTF8 := c.caps.Has(imap.CapIMAP4rev2) || c.caps.Has(imap.CapUTF8Accept)
 	literalMinus := c.caps.Has(imap.CapLiteralMinus)
+	rawMailbox := c.mailboxNameEncodingLocked() == MailboxNameEncodingRaw
 	c.mutex.Unlock()
 
 	c.setWriteTimeout(cmdWriteTimeout)
 
-	wireEnc := imapwire.NewEncoder(c.bw, imapwire.ConnSideClient)
+	var rec *recordingWriter
+	bw := c.bw
+	if vetoErr != nil {
+		// The command is encoded, but nothing is sent
+		bw = bufio.NewWriter(io.Discard)
+	} else if hooks != nil && hooks.Sent != nil {
+		rec = &recordingWriter{
+			bw:           c.bw,
+			literalLimit: hooks.sentLiteralLimit(),
+			sent: func(raw []byte) {
+				hooks.Sent(tag, name, raw)
+			},
+		}
+		bw = c.options.newBufioWriter(rec)
+		rec.enc = bw
+	}
+
+	wireEnc := imapwire.NewEncoder(bw, imapwire.ConnSideClient)
 	wireEnc.QuotedUTF8 = quotedUTF8
-	wireEnc.LiteralMinus = literalMinus
-	wireEnc.NewContinuationRequest = func() *imapwire.ContinuationRequest {
-		return c.registerContReq(cmd)
+	wireEnc.LiteralMinus = literalMinus || vetoErr != nil
+	wireEnc.RawMailbox = rawMailbox
+	if vetoErr == nil {
+		wireEnc.NewContinuationRequest = func() *imapwire.ContinuationRequest {
+			return c.registerContReq(cmd)
+		}
 	}
 
 	baseCmd := cmd.base()
 	*baseCmd = Command{
-		tag:  tag,
-		done: make(chan error, 1),
+		tag:     tag,
+		name:    name,
+		done:    make(chan error, 1),
+		rec:     rec,
+		flusher: c.flusher,
 	}
 	enc := &commandEncoder{
 		Encoder: wireEnc,
 		client:  c,
 		cmd:     baseCmd,
+		vetoed:  vetoErr != nil,
 	}
 	enc.Atom(tag).SP().Atom(name)
+	if vetoErr != nil {
+		c.completeCommand(cmd, vetoErr)
+	}
 	return enc
 }
 
@@ -353,7 +720,35 @@ func findPendingCmdByType[T command](c *Client) T {
 	return cmd
 }
 
+// findOldestPendingCmdByType returns the oldest pending command if it has the
+// type T.
+//
+// This is useful for responses which can't be sent while another command is
+// running: the server executes pipelined commands in order, so such responses
+// received while an earlier command is pending aren't related to later
+// commands.
+func findOldestPendingCmdByType[T command](c *Client) T {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(c.pendingCmds) > 0 {
+		if cmd, ok := c.pendingCmds[0].(T); ok {
+			return cmd
+		}
+	}
+
+	var cmd T
+	return cmd
+}
+
 func (c *Client) completeCommand(cmd command, err error) {
+	err = c.commandDone(cmd, err)
+
+	// Populate the cache before Wait returns
+	if cmd, ok := cmd.(*StatusCommand); ok && err == nil && c.statusCache != nil {
+		c.statusCache.store(cmd.mailbox, &cmd.data, cmd.gen)
+	}
+
 	done := cmd.base().done
 	done <- err
 	close(done)
@@ -369,6 +764,9 @@ func (c *Client) completeCommand(cmd command, err error) {
 		}
 	}
 	c.contReqs = filtered
+	if c.idle != nil && cmd.base() == &c.idle.cmd {
+		c.idle = nil
+	}
 	c.mutex.Unlock()
 
 	switch cmd := cmd.(type) {
@@ -383,8 +781,11 @@ func (c *Client) completeCommand(cmd command, err error) {
 			c.mailbox = &SelectedMailbox{
 				Name:           cmd.mailbox,
 				NumMessages:    cmd.data.NumMessages,
+				UIDValidity:    cmd.data.UIDValidity,
 				Flags:          cmd.data.Flags,
 				PermanentFlags: cmd.data.PermanentFlags,
+				ReadOnly:       cmd.readOnly,
+				NumRecent:      cmd.data.NumRecent,
 			}
 			c.mutex.Unlock()
 		}
@@ -452,12 +853,21 @@ func (c *Client) read() {
 		c.mutex.Unlock()
 
 		cmdErr := c.decErr
-		if cmdErr == nil {
+		if cmdErr == nil && c.bye != nil {
+			cmdErr = c.bye
+		} else if cmdErr == nil {
 			cmdErr = io.ErrUnexpectedEOF
 		}
 		for _, cmd := range pendingCmds {
 			c.completeCommand(cmd, cmdErr)
 		}
+
+		if !c.greetingRecv {
+			c.greetingErr = cmdErr
+			c.greetingRecv = true
+			close(c.greetingCh)
+			c.serverInfoDone()
+		}
 	}()
 
 	c.setReadTimeout(idleReadTimeout)
@@ -479,6 +889,10 @@ func (c *Client) readResponse() error {
 	c.setReadTimeout(respReadTimeout)
 	defer c.setReadTimeout(idleReadTimeout)
 
+	c.mutex.Lock()
+	c.dec.RawMailbox = c.mailboxNameEncodingLocked() == MailboxNameEncodingRaw
+	c.mutex.Unlock()
+
 	if c.dec.Special('+') {
 		if err := c.readContinueReq(); err != nil {
 			return fmt.Errorf("in continue-req: %v", err)
@@ -507,10 +921,7 @@ func (c *Client) readResponse() error {
 		startTLS, err = c.readResponseTagged(tag, typ)
 	} else if typ == "BYE" {
 		token = "resp-cond-bye"
-		var text string
-		if !c.dec.ExpectText(&text) {
-			return fmt.Errorf("in resp-text: %v", c.dec.Err())
-		}
+		err = c.readBye()
 	} else {
 		token = "response-data"
 		err = c.readResponseData(typ)
@@ -531,6 +942,37 @@ func (c *Client) readResponse() error {
 	return nil
 }
 
+func (c *Client) readBye() error {
+	bye := &imap.Error{Type: imap.StatusResponseTypeBye}
+	if !c.dec.ExpectSP() {
+		return c.dec.Err()
+	}
+	if c.dec.Special('[') { // resp-text-code
+		code, codeData, err := c.readResponseCode()
+		if err != nil {
+			return err
+		}
+		bye.Code = imap.ResponseCode(code)
+		bye.CodeData = codeData
+		if !c.dec.ExpectSpecial(']') {
+			return fmt.Errorf("in resp-text: %v", c.dec.Err())
+		}
+		// Some servers omit the text after the response code
+		c.dec.SP()
+	}
+	c.dec.Text(&bye.Text)
+	c.bye = bye
+
+	if !c.greetingRecv {
+		c.setState(imap.ConnStateLogout)
+		c.greetingErr = bye
+		c.greetingRecv = true
+		close(c.greetingCh)
+		c.serverInfoDone()
+	}
+	return nil
+}
+
 func (c *Client) readContinueReq() error {
 	var text string
 	if c.dec.SP() {
@@ -556,53 +998,57 @@ func (c *Client) readContinueReq() error {
 	return nil
 }
 
-func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
+func (c *Client) readResponseTagged(tag, typ string) (startTLS *startTLSCommand, err error) {
 	cmd := c.deletePendingCmdByTag(tag)
 	if cmd == nil {
 		return nil, fmt.Errorf("received tagged response with unknown tag %q", tag)
 	}
+	// The command isn't pending anymore: complete it if the response can't
+	// be decoded, e.g. because a ResponseCodeParser failed
+	defer func() {
+		if err != nil {
+			c.completeCommand(cmd, err)
+		}
+	}()
 
 	if !c.dec.ExpectSP() {
 		return nil, c.dec.Err()
 	}
-	var code string
+	var (
+		code     string
+		codeData interface{}
+	)
 	if c.dec.Special('[') { // resp-text-code
-		if !c.dec.ExpectAtom(&code) {
-			return nil, fmt.Errorf("in resp-text-code: %v", c.dec.Err())
+		var err error
+		code, codeData, err = c.readResponseCode()
+		if err != nil {
+			return nil, err
 		}
 		// TODO: LONGENTRIES and MAXSIZE from METADATA
-		switch code {
-		case "CAPABILITY": // capability-data
-			caps, err := readCapabilities(c.dec)
-			if err != nil {
-				return nil, fmt.Errorf("in capability-data: %v", err)
-			}
-			c.setCaps(caps)
-		case "APPENDUID":
-			var uidValidity, uid uint32
-			if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) || !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uid) {
-				return nil, fmt.Errorf("in resp-code-apnd: %v", c.dec.Err())
+		switch data := codeData.(type) {
+		case *imap.ResponseCodeCapabilityData:
+			switch cmd := cmd.(type) {
+			case *loginCommand:
+				cmd.after = data.Caps
+			case *authenticateCommand:
+				cmd.after = data.Caps
+			default:
+				c.setCaps(data.Caps)
 			}
+		case *imap.ResponseCodeAppendUIDData:
 			if cmd, ok := cmd.(*AppendCommand); ok {
-				cmd.data.UID = uid
-				cmd.data.UIDValidity = uidValidity
-			}
-		case "COPYUID":
-			if !c.dec.ExpectSP() {
-				return nil, c.dec.Err()
-			}
-			uidValidity, srcUIDs, dstUIDs, err := readRespCodeCopy(c.dec)
-			if err != nil {
-				return nil, fmt.Errorf("in resp-code-copy: %v", err)
+				cmd.data.UID = data.UID
+				cmd.data.UIDValidity = data.UIDValidity
 			}
+		case *imap.ResponseCodeCopyUIDData:
 			if cmd, ok := cmd.(*CopyCommand); ok {
-				cmd.data.UIDValidity = uidValidity
-				cmd.data.SourceUIDs = srcUIDs
-				cmd.data.DestUIDs = dstUIDs
+				cmd.data.UIDValidity = data.UIDValidity
+				cmd.data.SourceUIDs = data.SourceUIDs
+				cmd.data.DestUIDs = data.DestUIDs
 			}
-		default: // [SP 1*<any TEXT-CHAR except "]">]
-			if c.dec.SP() {
-				c.dec.DiscardUntilByte(']')
+		case *imap.ResponseCodeModifiedData:
+			if cmd, ok := cmd.(*FetchCommand); ok {
+				cmd.modified = data.Set
 			}
 		}
 		if !c.dec.ExpectSpecial(']') || !c.dec.ExpectSP() {
@@ -620,123 +1066,124 @@ func (c *Client) readResponseTagged(tag, typ string) (*startTLSCommand, error) {
 		// nothing to do
 	case "NO", "BAD":
 		cmdErr = &imap.Error{
-			Type: imap.StatusResponseType(typ),
-			Code: imap.ResponseCode(code),
-			Text: text,
+			Type:     imap.StatusResponseType(typ),
+			Code:     imap.ResponseCode(code),
+			CodeData: codeData,
+			Text:     text,
 		}
 	default:
 		return nil, fmt.Errorf("in resp-cond-state: expected OK, NO or BAD status condition, but got %v", typ)
 	}
 
+	// Update the capabilities before completing the command, so that they're
+	// up-to-date when Wait returns
+	if cmdErr == nil {
+		switch cmd := cmd.(type) {
+		case *startTLSCommand:
+			if code != "CAPABILITY" {
+				c.setCaps(nil)
+			}
+		case *loginCommand:
+			c.setAuthCaps(&cmd.authCaps)
+		case *authenticateCommand:
+			c.setAuthCaps(&cmd.authCaps)
+		}
+	}
+
+	if cmd, ok := cmd.(*RawCommand); ok {
+		cmd.status = &imap.StatusResponse{
+			Type:     imap.StatusResponseType(typ),
+			Code:     imap.ResponseCode(code),
+			CodeData: codeData,
+			Text:     text,
+		}
+	}
+
+	if cmdErr != nil {
+		cmdErr = c.softenCommandError(cmd, cmdErr)
+	}
+
 	c.completeCommand(cmd, cmdErr)
 
-	var startTLS *startTLSCommand
 	if cmd, ok := cmd.(*startTLSCommand); ok && cmdErr == nil {
 		startTLS = cmd
 	}
 
-	if cmdErr == nil && code != "CAPABILITY" {
-		switch cmd.(type) {
-		case *startTLSCommand, *loginCommand, *authenticateCommand:
-			c.setCaps(nil)
-		}
-	}
-
 	return startTLS, nil
 }
 
 func (c *Client) readResponseData(typ string) error {
 	// number SP ("EXISTS" / "RECENT" / "FETCH" / "EXPUNGE")
-	var num uint32
+	var (
+		num    uint32
+		hasNum bool
+	)
 	if typ[0] >= '0' && typ[0] <= '9' {
 		v, err := strconv.ParseUint(typ, 10, 32)
 		if err != nil {
 			return err
 		}
 
-		num = uint32(v)
+		num, hasNum = uint32(v), true
 		if !c.dec.ExpectSP() || !c.dec.ExpectAtom(&typ) {
 			return c.dec.Err()
 		}
 	}
 
+	switch typ {
+	case "EXISTS", "EXPUNGE", "VANISHED", "FETCH":
+		c.invalidateSelectedStatus()
+	}
+
 	switch typ {
 	case "OK", "PREAUTH", "NO", "BAD", "BYE": // resp-cond-state / resp-cond-bye / resp-cond-auth
 		if !c.dec.ExpectSP() {
 			return c.dec.Err()
 		}
 
-		var code string
+		var (
+			code     string
+			codeData interface{}
+		)
 		if c.dec.Special('[') { // resp-text-code
-			if !c.dec.ExpectAtom(&code) {
-				return fmt.Errorf("in resp-text-code: %v", c.dec.Err())
+			var err error
+			code, codeData, err = c.readResponseCode()
+			if err != nil {
+				return err
 			}
-			switch code {
-			case "CAPABILITY": // capability-data
-				caps, err := readCapabilities(c.dec)
-				if err != nil {
-					return fmt.Errorf("in capability-data: %v", err)
-				}
-				c.setCaps(caps)
-			case "PERMANENTFLAGS":
-				if !c.dec.ExpectSP() {
-					return c.dec.Err()
-				}
-				flags, err := internal.ReadFlagList(c.dec)
-				if err != nil {
-					return err
-				}
-
+			switch data := codeData.(type) {
+			case *imap.ResponseCodeCapabilityData:
+				c.setCaps(data.Caps)
+			case *imap.ResponseCodePermanentFlagsData:
 				c.mutex.Lock()
 				if c.state == imap.ConnStateSelected {
 					c.mailbox = c.mailbox.copy()
-					c.mailbox.PermanentFlags = flags
+					c.mailbox.PermanentFlags = data.Flags
 				}
 				c.mutex.Unlock()
 
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
-					cmd.data.PermanentFlags = flags
+					cmd.data.PermanentFlags = data.Flags
 				} else if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
-					handler(&UnilateralDataMailbox{PermanentFlags: flags})
-				}
-			case "UIDNEXT":
-				if !c.dec.ExpectSP() {
-					return c.dec.Err()
-				}
-				var uidNext uint32
-				if !c.dec.ExpectNumber(&uidNext) {
-					return c.dec.Err()
+					handler(&UnilateralDataMailbox{PermanentFlags: data.Flags})
 				}
+			case *imap.ResponseCodeUIDNextData:
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
-					cmd.data.UIDNext = uidNext
-				}
-			case "UIDVALIDITY":
-				if !c.dec.ExpectSP() {
-					return c.dec.Err()
-				}
-				var uidValidity uint32
-				if !c.dec.ExpectNumber(&uidValidity) {
-					return c.dec.Err()
+					cmd.data.UIDNext = data.UIDNext
 				}
+			case *imap.ResponseCodeUIDValidityData:
 				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
-					cmd.data.UIDValidity = uidValidity
-				}
-			case "COPYUID":
-				if !c.dec.ExpectSP() {
-					return c.dec.Err()
+					cmd.data.UIDValidity = data.UIDValidity
 				}
-				uidValidity, srcUIDs, dstUIDs, err := readRespCodeCopy(c.dec)
-				if err != nil {
-					return fmt.Errorf("in resp-code-copy: %v", err)
+			case *imap.ResponseCodeHighestModSeqData:
+				if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
+					cmd.data.HighestModSeq = data.ModSeq
 				}
+			case *imap.ResponseCodeCopyUIDData:
 				if cmd := findPendingCmdByType[*MoveCommand](c); cmd != nil {
-					cmd.data.UIDValidity = uidValidity
-					cmd.data.SourceUIDs = srcUIDs
-					cmd.data.DestUIDs = dstUIDs
-				}
-			default: // [SP 1*<any TEXT-CHAR except "]">]
-				if c.dec.SP() {
-					c.dec.DiscardUntilByte(']')
+					cmd.data.UIDValidity = data.UIDValidity
+					cmd.data.SourceUIDs = data.SourceUIDs
+					cmd.data.DestUIDs = data.DestUIDs
 				}
 			}
 			if !c.dec.ExpectSpecial(']') || !c.dec.ExpectSP() {
@@ -749,8 +1196,13 @@ func (c *Client) readResponseData(typ string) error {
 			return fmt.Errorf("in resp-text: %v", c.dec.Err())
 		}
 
-		if code == "CLOSED" {
+		switch imap.ResponseCode(code) {
+		case imap.ResponseCodeClosed:
 			c.setState(imap.ConnStateAuthenticated)
+		case imap.ResponseCodeUIDNotSticky:
+			if cmd := findPendingCmdByType[*SelectCommand](c); cmd != nil {
+				cmd.data.UIDNotSticky = true
+			}
 		}
 
 		if !c.greetingRecv {
@@ -762,13 +1214,24 @@ func (c *Client) readResponseData(typ string) error {
 			default:
 				c.setState(imap.ConnStateLogout)
 				c.greetingErr = &imap.Error{
-					Type: imap.StatusResponseType(typ),
-					Code: imap.ResponseCode(code),
-					Text: text,
+					Type:     imap.StatusResponseType(typ),
+					Code:     imap.ResponseCode(code),
+					CodeData: codeData,
+					Text:     text,
 				}
 			}
+			c.mutex.Lock()
+			c.serverInfo.Greeting = text
+			c.updateServerInfoLocked()
+			c.mutex.Unlock()
+
 			c.greetingRecv = true
 			close(c.greetingCh)
+			if c.greetingErr == nil && c.options.ID != nil {
+				go c.identify()
+			} else {
+				c.serverInfoDone()
+			}
 		}
 	case "CAPABILITY":
 		return c.handleCapability()
@@ -779,6 +1242,11 @@ func (c *Client) readResponseData(typ string) error {
 			return c.dec.Err()
 		}
 		return c.handleNamespace()
+	case "ID":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleID()
 	case "FLAGS":
 		if !c.dec.ExpectSP() {
 			return c.dec.Err()
@@ -787,7 +1255,7 @@ func (c *Client) readResponseData(typ string) error {
 	case "EXISTS":
 		return c.handleExists(num)
 	case "RECENT":
-		// ignore
+		return c.handleRecent(num)
 	case "LIST":
 		if !c.dec.ExpectSP() {
 			return c.dec.Err()
@@ -805,6 +1273,11 @@ func (c *Client) readResponseData(typ string) error {
 		return c.handleFetch(num)
 	case "EXPUNGE":
 		return c.handleExpunge(num)
+	case "VANISHED":
+		if !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		return c.handleVanished()
 	case "SEARCH":
 		return c.handleSearch()
 	case "ESEARCH":
@@ -828,7 +1301,12 @@ func (c *Client) readResponseData(typ string) error {
 			return c.dec.Err()
 		}
 		return c.handleQuotaRoot()
+	case "GENURLAUTH":
+		return c.handleGenURLAuth()
 	default:
+		if err := c.handleRaw(typ, num, hasNum); err != errUnhandledRaw {
+			return err
+		}
 		return fmt.Errorf("unsupported response type %q", typ)
 	}
 
@@ -852,6 +1330,10 @@ func (c *Client) Noop() *Command {
 //
 // This command informs the server that the client is done with the connection.
 func (c *Client) Logout() *Command {
+	c.mutex.Lock()
+	c.loggedOut = true
+	c.mutex.Unlock()
+
 	cmd := &logoutCommand{}
 	c.beginCommand("LOGOUT", cmd).end()
 	return &cmd.cmd
@@ -860,6 +1342,7 @@ func (c *Client) Logout() *Command {
 // Login sends a LOGIN command.
 func (c *Client) Login(username, password string) *Command {
 	cmd := &loginCommand{}
+	c.beginAuth(&cmd.authCaps)
 	enc := c.beginCommand("LOGIN", cmd)
 	enc.SP().String(username).SP().String(password)
 	enc.end()
@@ -877,6 +1360,7 @@ func (c *Client) Create(mailbox string) *Command {
 
 // Delete sends a DELETE command.
 func (c *Client) Delete(mailbox string) *Command {
+	c.statusCache.invalidateAll()
 	cmd := &Command{}
 	enc := c.beginCommand("DELETE", cmd)
 	enc.SP().Mailbox(mailbox)
@@ -886,6 +1370,7 @@ func (c *Client) Delete(mailbox string) *Command {
 
 // Rename sends a RENAME command.
 func (c *Client) Rename(mailbox, newName string) *Command {
+	c.statusCache.invalidateAll()
 	cmd := &Command{}
 	enc := c.beginCommand("RENAME", cmd)
 	enc.SP().Mailbox(mailbox).SP().Mailbox(newName)
@@ -919,10 +1404,45 @@ func uidCmdName(name string, uid bool) string {
 	}
 }
 
+// isUIDSet checks whether a command operating on numSet needs to be sent with
+// the UID prefix.
+func isUIDSet(numSet imap.NumSet) bool {
+	_, ok := numSet.(imap.UIDSet)
+	return ok
+}
+
+// errNilNumSet is returned by commands passed a nil imap.NumSet.
+var errNilNumSet = errors.New("imapclient: nil NumSet")
+
+// numSetArg returns the IMAP representation of a command's NumSet argument.
+func numSetArg(numSet imap.NumSet) (string, error) {
+	if numSet == nil {
+		return "", errNilNumSet
+	}
+	return numSet.String(), nil
+}
+
+// numSetContains checks whether num is part of numSet. The SEARCHRES marker
+// is assumed to contain all numbers, a nil set contains none.
+func numSetContains(numSet imap.NumSet, num uint32) bool {
+	switch numSet := numSet.(type) {
+	case imap.SeqSet:
+		return numSet.Contains(num)
+	case imap.UIDSet:
+		return numSet.Contains(num)
+	case nil:
+		return false
+	default:
+		return true
+	}
+}
+
 type commandEncoder struct {
 	*imapwire.Encoder
 	client *Client
 	cmd    *Command
+	// Whether CommandHooks.Send rejected the command
+	vetoed bool
 }
 
 // end ends an outgoing command.
@@ -941,8 +1461,21 @@ func (ce *commandEncoder) end() {
 // A CRLF is written and the encoder is flushed. Callers must call
 // commandEncoder.end to release the lock.
 func (ce *commandEncoder) flush() {
-	if err := ce.Encoder.CRLF(); err != nil {
+	rec := ce.cmd.rec
+	if rec != nil {
+		rec.final = true
+	}
+	err := ce.Encoder.CRLF()
+	if rec != nil && err == nil {
+		err = rec.finish()
+	}
+	if err != nil {
 		ce.cmd.err = err
+		if !ce.vetoed {
+			// Part of the command may have been written: the connection
+			// can't be used anymore
+			ce.client.conn.Close()
+		}
 	}
 	ce.Encoder = nil
 }
@@ -950,16 +1483,34 @@ func (ce *commandEncoder) flush() {
 // Literal encodes a literal.
 func (ce *commandEncoder) Literal(size int64) io.WriteCloser {
 	var contReq *imapwire.ContinuationRequest
-	if size > 4096 || !ce.client.Caps().Has(imap.CapLiteralMinus) {
+	if !ce.vetoed && (size > 4096 || !ce.client.Caps().Has(imap.CapLiteralMinus)) {
 		contReq = ce.client.registerContReq(ce.cmd)
 	}
 	ce.client.setWriteTimeout(literalWriteTimeout)
+	w := ce.Encoder.Literal(size, contReq)
+	if rec := ce.cmd.rec; rec != nil {
+		if err := rec.beginLiteral(size); err != nil {
+			w = errorWriteCloser{err}
+		}
+	}
 	return literalWriter{
-		WriteCloser: ce.Encoder.Literal(size, contReq),
+		WriteCloser: w,
 		client:      ce.client,
 	}
 }
 
+type errorWriteCloser struct {
+	err error
+}
+
+func (w errorWriteCloser) Write(b []byte) (int, error) {
+	return 0, w.err
+}
+
+func (w errorWriteCloser) Close() error {
+	return w.err
+}
+
 type literalWriter struct {
 	io.WriteCloser
 	client *Client
@@ -983,6 +1534,10 @@ type UnilateralDataMailbox struct {
 	NumMessages    *uint32
 	Flags          []imap.Flag
 	PermanentFlags []imap.Flag
+
+	// Deprecated: RECENT has been removed in IMAP4rev2. It's only returned
+	// by IMAP4rev1 servers.
+	NumRecent *uint32
 }
 
 // UnilateralDataHandler handles unilateral data.
@@ -998,6 +1553,13 @@ type UnilateralDataHandler struct {
 	Expunge func(seqNum uint32)
 	Mailbox func(data *UnilateralDataMailbox)
 	Fetch   func(msg *FetchMessageData)
+	// List is called for LIST responses which aren't part of a LIST command,
+	// e.g. when a mailbox is renamed. Responses with the OLDNAME extended
+	// data item are always delivered here.
+	List func(data *imap.ListData)
+
+	// requires ENABLE QRESYNC
+	Vanished func(uids imap.UIDSet)
 }
 
 // command is an interface for IMAP commands.
@@ -1011,17 +1573,29 @@ type command interface {
 // Command is a basic IMAP command.
 type Command struct {
 	tag  string
+	name string
 	done chan error
 	err  error
+
+	rec     *recordingWriter // for CommandHooks.Sent
+	flusher *flushWriter     // see Options.FlushMode
 }
 
 func (cmd *Command) base() *Command {
 	return cmd
 }
 
+// Tag returns the tag of the command, e.g. to correlate it with logs.
+func (cmd *Command) Tag() string {
+	return cmd.tag
+}
+
 // Wait blocks until the command has completed.
+//
+// Commands buffered because of Options.FlushMode are written first.
 func (cmd *Command) Wait() error {
 	if cmd.err == nil {
+		cmd.flusher.Flush()
 		cmd.err = <-cmd.done
 	}
 	return cmd.err
@@ -1031,6 +1605,7 @@ type cmd = Command // type alias to avoid exporting anonymous struct fields
 
 type loginCommand struct {
 	cmd
+	authCaps
 }
 
 // logoutCommand is a LOGOUT command.
@@ -0,0 +1,94 @@
+package imapclient
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// defaultMaxCommandLength is the command line length recommended by RFC 7162
+// section 4: servers should accept lines of at least 8192 bytes.
+const defaultMaxCommandLength = 8192
+
+// vendorMaxCommandLengths contains the command line length limits of known
+// server implementations, in their default configuration.
+var vendorMaxCommandLengths = map[ServerVendor]int{
+	ServerVendorDovecot: 64 * 1024, // imap_max_line_length
+}
+
+// MaxCommandLength returns the maximum length of a command line accepted by
+// the server, in bytes, literals excluded.
+//
+// Options.MaxCommandLength is returned if set. Otherwise, the limit is
+// guessed from ServerInfo, and defaults to 8192 bytes for unknown servers.
+//
+// Helpers sending commands with potentially large sets of messages, such as
+// BatchFetch, BatchStore and BatchUIDSearch, split them to stay below this
+// limit: some servers silently truncate longer lines.
+func (c *Client) MaxCommandLength() int {
+	if c.options.MaxCommandLength > 0 {
+		return c.options.MaxCommandLength
+	}
+	if n, ok := vendorMaxCommandLengths[c.ServerInfo().Vendor]; ok {
+		return n
+	}
+	return defaultMaxCommandLength
+}
+
+// numSetLengthBudget returns the number of bytes left for a set of messages
+// in a command line, once the tag, the command name and the other arguments
+// encoded by f have been written.
+func (c *Client) numSetLengthBudget(name string, f func(enc *imapwire.Encoder)) (int, error) {
+	c.mutex.Lock()
+	tag := c.options.tag(c.cmdTag + 1)
+	c.mutex.Unlock()
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	enc := imapwire.NewEncoder(bw, imapwire.ConnSideClient)
+	// Make sure strings are written inline, to overestimate their length
+	// rather than omit literals
+	enc.QuotedUTF8 = true
+	enc.LiteralMinus = true
+	f(enc)
+	bw.Flush()
+
+	// Spaces around the set, number growth of the tag and CRLF
+	const slack = 16
+	budget := c.MaxCommandLength() - len(tag) - len(name) - buf.Len() - slack
+	if budget <= 0 {
+		return 0, fmt.Errorf("imapclient: %v command exceeds the maximum command length", name)
+	}
+	return budget, nil
+}
+
+// splitNumSet splits a set of messages into sets whose representation is at
+// most n bytes long. Saved search results are returned as is.
+func splitNumSet(numSet imap.NumSet, n int) []imap.NumSet {
+	var (
+		sets []imap.SeqSet
+		uid  bool
+	)
+	switch numSet := numSet.(type) {
+	case imap.SeqSet:
+		sets = numSet.SplitLength(n)
+	case imap.UIDSet:
+		sets = imap.SeqSet(numSet).SplitLength(n)
+		uid = true
+	default:
+		return []imap.NumSet{numSet}
+	}
+
+	l := make([]imap.NumSet, len(sets))
+	for i, set := range sets {
+		if uid {
+			l[i] = imap.UIDSet(set)
+		} else {
+			l[i] = set
+		}
+	}
+	return l
+}
@@ -5,34 +5,54 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Client) copy(uid bool, seqSet imap.SeqSet, mailbox string) *CopyCommand {
-	cmd := &CopyCommand{}
-	enc := c.beginCommand(uidCmdName("COPY", uid), cmd)
-	enc.SP().Atom(seqSet.String()).SP().Mailbox(mailbox)
+func (c *Client) copy(uid bool, numSet imap.NumSet, mailbox string) *CopyCommand {
+	cmd := &CopyCommand{
+		uid:    uid,
+		numSet: numSet,
+		retry:  c.newTryCreateRetry(mailbox),
+	}
+	c.statusCache.invalidate(mailbox)
+	arg, err := numSetArg(numSet)
+	enc := c.beginFailedCommand(uidCmdName("COPY", uid), cmd, err)
+	enc.SP().Atom(arg).SP().Mailbox(mailbox)
 	enc.end()
 	return cmd
 }
 
 // Copy sends a COPY command.
-func (c *Client) Copy(seqSet imap.SeqSet, mailbox string) *CopyCommand {
-	return c.copy(false, seqSet, mailbox)
+//
+// If numSet is an imap.UIDSet, a UID COPY command is sent.
+func (c *Client) Copy(numSet imap.NumSet, mailbox string) *CopyCommand {
+	return c.copy(isUIDSet(numSet), numSet, mailbox)
 }
 
-// UIDCopy sends a UID COPY command.
+// UIDCopy sends a UID COPY command. A SeqSet is interpreted as a set of UIDs.
 //
 // See Copy.
-func (c *Client) UIDCopy(seqSet imap.SeqSet, mailbox string) *CopyCommand {
-	return c.copy(true, seqSet, mailbox)
+func (c *Client) UIDCopy(numSet imap.NumSet, mailbox string) *CopyCommand {
+	return c.copy(true, numSet, mailbox)
 }
 
 // CopyCommand is a COPY command.
 type CopyCommand struct {
 	cmd
 	data imap.CopyData
+
+	uid    bool
+	numSet imap.NumSet
+	retry  *tryCreateRetry
 }
 
 func (cmd *CopyCommand) Wait() (*imap.CopyData, error) {
-	return &cmd.data, cmd.cmd.Wait()
+	err := cmd.cmd.Wait()
+	if ok, createErr := cmd.retry.create(err); createErr != nil {
+		return nil, createErr
+	} else if ok {
+		retryCmd := cmd.retry.client.copy(cmd.uid, cmd.numSet, cmd.retry.mailbox)
+		retryCmd.retry = nil
+		return retryCmd.Wait()
+	}
+	return &cmd.data, err
 }
 
 func readRespCodeCopy(dec *imapwire.Decoder) (uidValidity uint32, srcUIDs, dstUIDs imap.SeqSet, err error) {
@@ -0,0 +1,281 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// corpusExchange is a command sent by the client, followed by the
+// responses sent by the server.
+type corpusExchange struct {
+	command   string
+	responses []string
+}
+
+// corpusFixture is a transcript loaded from testdata/corpus.
+//
+// The transcripts are written by hand, see testdata/corpus/README.
+//
+// Lines starting with "C: " are sent by the client, lines starting with
+// "S: " are sent by the server. Lines starting with "#" are comments. Server
+// lines sent before the first client line form the greeting. Literals are
+// written as-is, each line adds its CRLF to the literal size.
+type corpusFixture struct {
+	greeting  []string
+	exchanges []corpusExchange
+}
+
+func loadCorpusFixture(path string) (*corpusFixture, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture corpusFixture
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for i := 1; sc.Scan(); i++ {
+		line := sc.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			// ignore
+		case strings.HasPrefix(line, "C: "):
+			fixture.exchanges = append(fixture.exchanges, corpusExchange{command: line[3:]})
+		case strings.HasPrefix(line, "S: ") || line == "S:":
+			resp := strings.TrimPrefix(line[2:], " ")
+			if n := len(fixture.exchanges); n > 0 {
+				fixture.exchanges[n-1].responses = append(fixture.exchanges[n-1].responses, resp)
+			} else {
+				fixture.greeting = append(fixture.greeting, resp)
+			}
+		default:
+			return nil, fmt.Errorf("%v:%v: invalid line %q", path, i, line)
+		}
+	}
+	return &fixture, sc.Err()
+}
+
+// serve plays the server side of the transcript. Commands sent by the
+// client are checked against the transcript.
+func (fixture *corpusFixture) serve(conn net.Conn) error {
+	defer conn.Close()
+
+	bw := bufio.NewWriter(conn)
+	writeLines := func(lines []string) error {
+		for _, l := range lines {
+			bw.WriteString(l + "\r\n")
+		}
+		return bw.Flush()
+	}
+	if err := writeLines(fixture.greeting); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+	for _, ex := range fixture.exchanges {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("waiting for command %q: %v", ex.command, err)
+		}
+		if l = strings.TrimSuffix(l, "\r\n"); l != ex.command {
+			return fmt.Errorf("got command %q, want %q", l, ex.command)
+		}
+		if err := writeLines(ex.responses); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// corpusTests contains the client calls issued for each transcript, in the
+// same order as the commands in the transcript.
+var corpusTests = map[string]func(t *testing.T, c *imapclient.Client){
+	"gmail-list": func(t *testing.T, c *imapclient.Client) {
+		if err := c.Login("user@gmail.com", "secret").Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		if vendor := c.ServerInfo().Vendor; vendor != imapclient.ServerVendorGmail {
+			t.Errorf("ServerInfo().Vendor = %q, want %q", vendor, imapclient.ServerVendorGmail)
+		}
+		mailboxes, err := c.List("", "*", nil).Collect()
+		if err != nil {
+			t.Fatalf("List() = %v", err)
+		}
+		if len(mailboxes) != 4 {
+			t.Fatalf("List() returned %v mailboxes, want 4", len(mailboxes))
+		}
+		if mbox := mailboxes[1]; mbox.Mailbox != "[Gmail]" || !hasAttr(mbox.Attrs, imap.MailboxAttrNoSelect) {
+			t.Errorf("List()[1] = %+v, want \\Noselect [Gmail]", mbox)
+		}
+		if mbox := mailboxes[2]; mbox.Mailbox != "[Gmail]/All Mail" || !hasAttr(mbox.Attrs, imap.MailboxAttrAll) {
+			t.Errorf("List()[2] = %+v, want \\All [Gmail]/All Mail", mbox)
+		}
+		if mbox := mailboxes[3]; mbox.Mailbox != "[Gmail]/Entwürfe" {
+			t.Errorf("List()[3].Mailbox = %q, want modified UTF-7 to be decoded", mbox.Mailbox)
+		}
+	},
+	"dovecot-select-fetch": func(t *testing.T, c *imapclient.Client) {
+		if err := c.Login("user", "secret").Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		data, err := c.Select("INBOX").Wait()
+		if err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+		if data.NumMessages != 2 || data.UIDValidity != 1700000000 || data.UIDNext != 3 || data.HighestModSeq != 7 {
+			t.Errorf("Select() = %+v", data)
+		}
+		msgs, err := c.Fetch(imap.SeqSetNum(1), []imap.FetchItem{
+			imap.FetchItemUID,
+			imap.FetchItemFlags,
+			imap.FetchItemEnvelope,
+			imap.FetchItemBodyStructure,
+		}).Collect()
+		if err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+		if len(msgs) != 1 {
+			t.Fatalf("Fetch() returned %v messages, want 1", len(msgs))
+		}
+		msg := msgs[0]
+		if msg.UID != 1 || msg.Envelope == nil || msg.Envelope.Subject != "Café menu" {
+			t.Errorf("Fetch() = UID %v, envelope %+v", msg.UID, msg.Envelope)
+		}
+		mp, ok := msg.BodyStructure.(*imap.BodyStructureMultiPart)
+		if !ok || len(mp.Children) != 2 || mp.Subtype != "alternative" {
+			t.Errorf("Fetch() body structure = %#v", msg.BodyStructure)
+		}
+	},
+	"outlook-fetch-body": func(t *testing.T, c *imapclient.Client) {
+		if err := c.Login("user@outlook.com", "secret").Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		if _, err := c.Select("INBOX").Wait(); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+		section := &imap.FetchItemBodySection{Peek: true}
+		msgs, err := c.UIDFetch(imap.UIDSetNum(17), []imap.FetchItem{
+			imap.FetchItemFlags,
+			imap.FetchItemInternalDate,
+			imap.FetchItemRFC822Size,
+			section,
+		}).Collect()
+		if err != nil {
+			t.Fatalf("UIDFetch() = %v", err)
+		}
+		if len(msgs) != 1 {
+			t.Fatalf("UIDFetch() returned %v messages, want 1", len(msgs))
+		}
+		msg := msgs[0]
+		if msg.UID != 17 || msg.RFC822Size != 52 || msg.InternalDate.IsZero() {
+			t.Errorf("UIDFetch() = UID %v, size %v, date %v", msg.UID, msg.RFC822Size, msg.InternalDate)
+		}
+		if body := msg.FindBodySection(section); len(body) != 52 {
+			t.Errorf("UIDFetch() body = %q", body)
+		}
+	},
+	"courier-list-status": func(t *testing.T, c *imapclient.Client) {
+		if err := c.Login("user", "secret").Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		if vendor := c.ServerInfo().Vendor; vendor != imapclient.ServerVendorCourier {
+			t.Errorf("ServerInfo().Vendor = %q, want %q", vendor, imapclient.ServerVendorCourier)
+		}
+		mailboxes, err := c.List("", "*", nil).Collect()
+		if err != nil {
+			t.Fatalf("List() = %v", err)
+		}
+		if len(mailboxes) != 2 || mailboxes[1].Mailbox != "INBOX.Sent" || mailboxes[1].Delim != '.' {
+			t.Errorf("List() = %+v", mailboxes)
+		}
+		data, err := c.Status("INBOX.Sent", []imap.StatusItem{imap.StatusItemNumMessages, imap.StatusItemNumUnseen}).Wait()
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		}
+		if data.NumMessages == nil || *data.NumMessages != 12 || data.NumUnseen == nil || *data.NumUnseen != 0 {
+			t.Errorf("Status() = %+v", data)
+		}
+	},
+	"zimbra-id-search": func(t *testing.T, c *imapclient.Client) {
+		if err := c.Login("user", "secret").Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		fields, err := c.ID(map[string]string{"name": "go-imap"}).Wait()
+		if err != nil {
+			t.Fatalf("ID() = %v", err)
+		}
+		if fields["name"] != "Zimbra" {
+			t.Errorf("ID() = %v", fields)
+		}
+		if vendor := c.ServerInfo().Vendor; vendor != imapclient.ServerVendorZimbra {
+			t.Errorf("ServerInfo().Vendor = %q, want %q", vendor, imapclient.ServerVendorZimbra)
+		}
+		if _, err := c.Select("INBOX").Wait(); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+		data, err := c.UIDSearch(&imap.SearchCriteria{NotFlag: []imap.Flag{imap.FlagSeen}}, nil).Wait()
+		if err != nil {
+			t.Fatalf("UIDSearch() = %v", err)
+		}
+		if uids := data.AllNums(); len(uids) != 3 || uids[2] != 260 {
+			t.Errorf("UIDSearch() = %v", uids)
+		}
+	},
+}
+
+func TestCorpus(t *testing.T) {
+	paths, err := filepath.Glob("testdata/corpus/*.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(corpusTests) {
+		t.Errorf("found %v transcripts, want %v", len(paths), len(corpusTests))
+	}
+
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".txt")
+		t.Run(name, func(t *testing.T) {
+			f, ok := corpusTests[name]
+			if !ok {
+				t.Fatalf("no test for transcript %v", path)
+			}
+			fixture, err := loadCorpusFixture(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			clientConn, serverConn := net.Pipe()
+			done := make(chan error, 1)
+			go func() {
+				done <- fixture.serve(serverConn)
+			}()
+
+			c := imapclient.New(clientConn, nil)
+			defer func() {
+				c.Close()
+				if err := <-done; err != nil {
+					t.Errorf("transcript: %v", err)
+				}
+			}()
+
+			f(t, c)
+		})
+	}
+}
+
+func hasAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
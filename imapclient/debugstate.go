@@ -0,0 +1,110 @@
+package imapclient
+
+import (
+	"io"
+	"sort"
+	"sync/atomic"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// DebugState is a snapshot of the client state, suitable for bug reports. It
+// can be serialized to JSON.
+//
+// It doesn't contain any credentials nor message data.
+type DebugState struct {
+	State   string        `json:"state"`
+	Caps    []imap.Cap    `json:"caps,omitempty"`
+	Enabled []imap.Cap    `json:"enabled,omitempty"`
+	Mailbox *DebugMailbox `json:"mailbox,omitempty"`
+	// Commands waiting for a server reply, oldest first
+	PendingCommands []DebugCommand `json:"pendingCommands,omitempty"`
+
+	// Bytes read and written since the client was created. When TLS is in
+	// use, this excludes the TLS overhead.
+	BytesRead    int64 `json:"bytesRead"`
+	BytesWritten int64 `json:"bytesWritten"`
+}
+
+// DebugMailbox describes the currently selected mailbox in a DebugState.
+type DebugMailbox struct {
+	Name           string      `json:"name"`
+	NumMessages    uint32      `json:"numMessages"`
+	Flags          []imap.Flag `json:"flags,omitempty"`
+	PermanentFlags []imap.Flag `json:"permanentFlags,omitempty"`
+}
+
+// DebugCommand describes a pending command in a DebugState.
+type DebugCommand struct {
+	Tag  string `json:"tag"`
+	Name string `json:"name"`
+}
+
+// DebugState returns a snapshot of the client state.
+//
+// Unlike Caps, this function doesn't send any command.
+func (c *Client) DebugState() *DebugState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	state := &DebugState{
+		State:        c.state.String(),
+		Caps:         sortedCaps(c.caps),
+		Enabled:      sortedCaps(c.enabled),
+		BytesRead:    atomic.LoadInt64(&c.counters.read),
+		BytesWritten: atomic.LoadInt64(&c.counters.written),
+	}
+	if c.mailbox != nil {
+		state.Mailbox = &DebugMailbox{
+			Name:           c.mailbox.Name,
+			NumMessages:    c.mailbox.NumMessages,
+			Flags:          append([]imap.Flag(nil), c.mailbox.Flags...),
+			PermanentFlags: append([]imap.Flag(nil), c.mailbox.PermanentFlags...),
+		}
+	}
+	for _, cmd := range c.pendingCmds {
+		base := cmd.base()
+		state.PendingCommands = append(state.PendingCommands, DebugCommand{
+			Tag:  base.tag,
+			Name: base.name,
+		})
+	}
+	return state
+}
+
+func sortedCaps(caps imap.CapSet) []imap.Cap {
+	if len(caps) == 0 {
+		return nil
+	}
+	l := make([]imap.Cap, 0, len(caps))
+	for c := range caps {
+		l = append(l, c)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i] < l[j]
+	})
+	return l
+}
+
+// byteCounters counts the bytes read and written on a connection. It's
+// updated atomically.
+type byteCounters struct {
+	read, written int64
+}
+
+type countingReadWriter struct {
+	rw       io.ReadWriter
+	counters *byteCounters
+}
+
+func (crw countingReadWriter) Read(b []byte) (int, error) {
+	n, err := crw.rw.Read(b)
+	atomic.AddInt64(&crw.counters.read, int64(n))
+	return n, err
+}
+
+func (crw countingReadWriter) Write(b []byte) (int, error) {
+	n, err := crw.rw.Write(b)
+	atomic.AddInt64(&crw.counters.written, int64(n))
+	return n, err
+}
@@ -0,0 +1,122 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestDebugState(t *testing.T) {
+	exchanges := []struct {
+		command   string
+		responses []string
+	}{
+		{command: "T1 SELECT INBOX", responses: []string{
+			"* 2 EXISTS",
+			`* FLAGS (\Seen \Deleted)`,
+			`* OK [PERMANENTFLAGS (\Seen)] Limited`,
+			"* OK [UIDVALIDITY 1] UIDs valid",
+			"T1 OK [READ-WRITE] SELECT completed",
+		}},
+		{command: "T2 NOOP", responses: []string{"T2 OK NOOP completed"}},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		if _, err := io.WriteString(serverConn, "* OK [CAPABILITY IMAP4rev1 IDLE] ready\r\n"); err != nil {
+			done <- err
+			return
+		}
+		br := bufio.NewReader(serverConn)
+		for i, ex := range exchanges {
+			l, err := br.ReadString('\n')
+			if err != nil {
+				done <- err
+				return
+			} else if l != ex.command+"\r\n" {
+				done <- fmt.Errorf("got command %q, want %q", l, ex.command)
+				return
+			}
+			if i == len(exchanges)-1 {
+				<-release
+			}
+			for _, resp := range ex.responses {
+				if _, err := io.WriteString(serverConn, resp+"\r\n"); err != nil {
+					done <- err
+					return
+				}
+			}
+		}
+		done <- nil
+	}()
+
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("server: %v", err)
+		}
+	}()
+
+	if err := c.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+	state := c.DebugState()
+	if state.State != imap.ConnStateNotAuthenticated.String() {
+		t.Errorf("State = %q, want %q", state.State, imap.ConnStateNotAuthenticated.String())
+	}
+	wantCaps := []imap.Cap{imap.CapIdle, imap.CapIMAP4rev1}
+	if !reflect.DeepEqual(state.Caps, wantCaps) {
+		t.Errorf("Caps = %v, want %v", state.Caps, wantCaps)
+	}
+	if state.Mailbox != nil || len(state.PendingCommands) != 0 {
+		t.Errorf("DebugState() = %+v, want no mailbox and no pending command", state)
+	}
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	state = c.DebugState()
+	if state.State != imap.ConnStateSelected.String() {
+		t.Errorf("State = %q, want %q", state.State, imap.ConnStateSelected.String())
+	}
+	wantMailbox := &imapclient.DebugMailbox{
+		Name:           "INBOX",
+		NumMessages:    2,
+		Flags:          []imap.Flag{imap.FlagSeen, imap.FlagDeleted},
+		PermanentFlags: []imap.Flag{imap.FlagSeen},
+	}
+	if !reflect.DeepEqual(state.Mailbox, wantMailbox) {
+		t.Errorf("Mailbox = %+v, want %+v", state.Mailbox, wantMailbox)
+	}
+	if len(state.PendingCommands) != 0 {
+		t.Errorf("PendingCommands = %v, want none", state.PendingCommands)
+	}
+
+	noopCmd := c.Noop()
+	state = c.DebugState()
+	wantPending := []imapclient.DebugCommand{{Tag: "T2", Name: "NOOP"}}
+	if !reflect.DeepEqual(state.PendingCommands, wantPending) {
+		t.Errorf("PendingCommands = %v, want %v", state.PendingCommands, wantPending)
+	}
+	if state.BytesRead == 0 || state.BytesWritten == 0 {
+		t.Errorf("BytesRead = %v, BytesWritten = %v, want non-zero", state.BytesRead, state.BytesWritten)
+	}
+
+	close(release)
+	if err := noopCmd.Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+	if state := c.DebugState(); len(state.PendingCommands) != 0 {
+		t.Errorf("PendingCommands after completion = %v, want none", state.PendingCommands)
+	}
+}
@@ -0,0 +1,51 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestDialInsecureSkipVerifyFunc(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	for _, insecure := range []bool{false, true} {
+		var hosts []string
+		options := &imapclient.Options{
+			InsecureSkipVerify: insecure,
+			InsecureSkipVerifyFunc: func(host string) {
+				hosts = append(hosts, host)
+			},
+		}
+		// The handshake fails, but the hook is called beforehand
+		if c, err := imapclient.DialTLS(ln.Addr().String(), options); err == nil {
+			c.Close()
+		}
+		if c, err := imapclient.DialStartTLS(ln.Addr().String(), options); err == nil {
+			c.Close()
+		}
+
+		var want []string
+		if insecure {
+			want = []string{"127.0.0.1", "127.0.0.1"}
+		}
+		if !reflect.DeepEqual(hosts, want) {
+			t.Errorf("InsecureSkipVerifyFunc called with %v, want %v (InsecureSkipVerify = %v)", hosts, want, insecure)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package imapclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxDiscoveryResponseSize is the maximum size of an autoconfig or
+// autodiscover response.
+const maxDiscoveryResponseSize = 1024 * 1024
+
+// DiscoveredServer is an IMAP server found by DiscoverServers.
+type DiscoveredServer struct {
+	Host string
+	Port uint16
+	// If true, the connection uses STARTTLS, otherwise it uses implicit TLS.
+	StartTLS bool
+}
+
+// Address returns the host and port of the server, suitable for DialTLS and
+// DialStartTLS.
+func (srv *DiscoveredServer) Address() string {
+	return net.JoinHostPort(srv.Host, strconv.Itoa(int(srv.Port)))
+}
+
+// Dial connects to the server with the appropriate security mode.
+func (srv *DiscoveredServer) Dial(options *Options) (*Client, error) {
+	if srv.StartTLS {
+		return DialStartTLS(srv.Address(), options)
+	}
+	return DialTLS(srv.Address(), options)
+}
+
+// DiscoverOptions contains options for DiscoverServers.
+type DiscoverOptions struct {
+	// Resolver used for DNS lookups. If nil, net.DefaultResolver is used.
+	Resolver *net.Resolver
+	// HTTP client used for autoconfig and autodiscover requests. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Query Thunderbird autoconfig endpoints if no SRV record is found
+	Autoconfig bool
+	// Query Microsoft autodiscover endpoints if no server has been found
+	// with the other methods
+	Autodiscover bool
+}
+
+// DiscoverServers finds the IMAP servers for an e-mail address.
+//
+// DNS SRV records defined in RFC 6186 are looked up first. Servers using
+// implicit TLS are returned before servers using STARTTLS, as recommended by
+// RFC 8314. Servers without TLS are never returned.
+func DiscoverServers(ctx context.Context, emailAddress string, options *DiscoverOptions) ([]DiscoveredServer, error) {
+	if options == nil {
+		options = new(DiscoverOptions)
+	}
+
+	at := strings.LastIndexByte(emailAddress, '@')
+	if at < 0 {
+		return nil, fmt.Errorf("imapclient: invalid e-mail address %q", emailAddress)
+	}
+	domain := emailAddress[at+1:]
+
+	servers, err := discoverSRV(ctx, domain, options.Resolver)
+	if len(servers) > 0 {
+		return servers, nil
+	}
+	errs := []error{err}
+
+	if options.Autoconfig {
+		servers, err := discoverAutoconfig(ctx, emailAddress, domain, options.HTTPClient)
+		if len(servers) > 0 {
+			return servers, nil
+		}
+		errs = append(errs, err)
+	}
+	if options.Autodiscover {
+		servers, err := discoverAutodiscover(ctx, emailAddress, domain, options.HTTPClient)
+		if len(servers) > 0 {
+			return servers, nil
+		}
+		errs = append(errs, err)
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("imapclient: failed to discover IMAP server for %q: %w", domain, err)
+		}
+	}
+	return nil, fmt.Errorf("imapclient: no IMAP server found for %q", domain)
+}
+
+func discoverSRV(ctx context.Context, domain string, resolver *net.Resolver) ([]DiscoveredServer, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	var (
+		servers  []DiscoveredServer
+		firstErr error
+	)
+	for _, service := range []string{"imaps", "imap"} {
+		_, addrs, err := resolver.LookupSRV(ctx, service, "tcp", domain)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			continue
+		} else if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		for _, addr := range addrs {
+			// A target of "." means that the service is not available
+			if addr.Target == "." {
+				continue
+			}
+			servers = append(servers, DiscoveredServer{
+				Host:     strings.TrimSuffix(addr.Target, "."),
+				Port:     addr.Port,
+				StartTLS: service == "imap",
+			})
+		}
+	}
+	return servers, firstErr
+}
+
+type autoconfigXML struct {
+	XMLName        xml.Name `xml:"clientConfig"`
+	IncomingServer []struct {
+		Type       string `xml:"type,attr"`
+		Hostname   string `xml:"hostname"`
+		Port       uint16 `xml:"port"`
+		SocketType string `xml:"socketType"`
+	} `xml:"emailProvider>incomingServer"`
+}
+
+func discoverAutoconfig(ctx context.Context, emailAddress, domain string, client *http.Client) ([]DiscoveredServer, error) {
+	urls := []string{
+		"https://autoconfig." + domain + "/mail/config-v1.1.xml?emailaddress=" + url.QueryEscape(emailAddress),
+		"https://" + domain + "/.well-known/autoconfig/mail/config-v1.1.xml",
+	}
+
+	var firstErr error
+	for _, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		b, err := doDiscoveryRequest(client, req)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		var config autoconfigXML
+		if err := xml.Unmarshal(b, &config); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid autoconfig response: %v", err)
+			}
+			continue
+		}
+
+		var servers []DiscoveredServer
+		for _, in := range config.IncomingServer {
+			if in.Type != "imap" || in.Hostname == "" || in.Port == 0 {
+				continue
+			}
+			srv := DiscoveredServer{
+				Host: strings.ReplaceAll(in.Hostname, "%EMAILDOMAIN%", domain),
+				Port: in.Port,
+			}
+			switch strings.ToUpper(in.SocketType) {
+			case "SSL":
+				// implicit TLS
+			case "STARTTLS":
+				srv.StartTLS = true
+			default:
+				continue // plaintext
+			}
+			servers = append(servers, srv)
+		}
+		if len(servers) > 0 {
+			return sortDiscoveredServers(servers), nil
+		}
+	}
+	return nil, firstErr
+}
+
+type autodiscoverXML struct {
+	XMLName  xml.Name `xml:"Autodiscover"`
+	Protocol []struct {
+		Type       string `xml:"Type"`
+		Server     string `xml:"Server"`
+		Port       uint16 `xml:"Port"`
+		SSL        string `xml:"SSL"`
+		Encryption string `xml:"Encryption"`
+	} `xml:"Response>Account>Protocol"`
+}
+
+const autodiscoverRequest = `<?xml version="1.0" encoding="utf-8"?>
+<Autodiscover xmlns="http://schemas.microsoft.com/exchange/autodiscover/outlook/requestschema/2006">
+<Request>
+<EMailAddress>%s</EMailAddress>
+<AcceptableResponseSchema>http://schemas.microsoft.com/exchange/autodiscover/outlook/responseschema/2006a</AcceptableResponseSchema>
+</Request>
+</Autodiscover>`
+
+func discoverAutodiscover(ctx context.Context, emailAddress, domain string, client *http.Client) ([]DiscoveredServer, error) {
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(emailAddress)); err != nil {
+		return nil, err
+	}
+	body := fmt.Sprintf(autodiscoverRequest, escaped.String())
+
+	urls := []string{
+		"https://autodiscover." + domain + "/autodiscover/autodiscover.xml",
+		"https://" + domain + "/autodiscover/autodiscover.xml",
+	}
+
+	var firstErr error
+	for _, u := range urls {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/xml")
+		b, err := doDiscoveryRequest(client, req)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		var resp autodiscoverXML
+		if err := xml.Unmarshal(b, &resp); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("invalid autodiscover response: %v", err)
+			}
+			continue
+		}
+
+		var servers []DiscoveredServer
+		for _, proto := range resp.Protocol {
+			if !strings.EqualFold(proto.Type, "IMAP") || proto.Server == "" {
+				continue
+			}
+			srv := DiscoveredServer{Host: proto.Server, Port: proto.Port}
+			switch {
+			case strings.EqualFold(proto.Encryption, "TLS"):
+				srv.StartTLS = true
+			case strings.EqualFold(proto.Encryption, "SSL"), proto.Encryption == "" && !strings.EqualFold(proto.SSL, "off"):
+				// implicit TLS
+			default:
+				continue // plaintext
+			}
+			if srv.Port == 0 {
+				if srv.StartTLS {
+					srv.Port = 143
+				} else {
+					srv.Port = 993
+				}
+			}
+			servers = append(servers, srv)
+		}
+		if len(servers) > 0 {
+			return sortDiscoveredServers(servers), nil
+		}
+	}
+	return nil, firstErr
+}
+
+func doDiscoveryRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP request to %v failed: %v", req.URL, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDiscoveryResponseSize))
+}
+
+// sortDiscoveredServers moves servers using implicit TLS first, keeping the
+// original order otherwise.
+func sortDiscoveredServers(servers []DiscoveredServer) []DiscoveredServer {
+	var implicitTLS, startTLS []DiscoveredServer
+	for _, srv := range servers {
+		if srv.StartTLS {
+			startTLS = append(startTLS, srv)
+		} else {
+			implicitTLS = append(implicitTLS, srv)
+		}
+	}
+	return append(implicitTLS, startTLS...)
+}
@@ -0,0 +1,261 @@
+package imapclient_test
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// newTestResolver returns a resolver answering SRV queries from records,
+// keyed by name. Other names don't exist.
+func newTestResolver(records map[string][]net.SRV) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			clientConn, serverConn := net.Pipe()
+			go serveTestDNS(serverConn, records)
+			return clientConn, nil
+		},
+	}
+}
+
+// serveTestDNS answers DNS queries sent over a stream connection.
+func serveTestDNS(conn net.Conn, records map[string][]net.SRV) {
+	defer conn.Close()
+
+	for {
+		var n uint16
+		if err := binary.Read(conn, binary.BigEndian, &n); err != nil {
+			return
+		}
+		query := make([]byte, n)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		// Parse the question name
+		var labels []string
+		i := 12
+		for i < len(query) && query[i] != 0 {
+			l := int(query[i])
+			labels = append(labels, string(query[i+1:i+1+l]))
+			i += 1 + l
+		}
+		question := query[12 : i+5]
+		srvs, ok := records[strings.ToLower(strings.Join(labels, "."))]
+
+		resp := make([]byte, 12, 512)
+		copy(resp, query[:2])
+		binary.BigEndian.PutUint16(resp[2:], 0x8180)
+		if !ok {
+			resp[3] |= 3 // NXDOMAIN
+		}
+		binary.BigEndian.PutUint16(resp[4:], 1)
+		binary.BigEndian.PutUint16(resp[6:], uint16(len(srvs)))
+		resp = append(resp, question...)
+		for _, srv := range srvs {
+			var target []byte
+			for _, label := range strings.Split(strings.TrimSuffix(srv.Target, "."), ".") {
+				if label != "" {
+					target = append(target, byte(len(label)))
+					target = append(target, label...)
+				}
+			}
+			target = append(target, 0)
+
+			resp = append(resp, 0xC0, 12)         // pointer to the question name
+			resp = appendUint16(resp, 33)         // SRV
+			resp = appendUint16(resp, 1)          // IN
+			resp = append(resp, 0, 0, 0x0E, 0x10) // TTL
+			resp = appendUint16(resp, uint16(6+len(target)))
+			resp = appendUint16(resp, srv.Priority)
+			resp = appendUint16(resp, srv.Weight)
+			resp = appendUint16(resp, srv.Port)
+			resp = append(resp, target...)
+		}
+
+		if err := binary.Write(conn, binary.BigEndian, uint16(len(resp))); err != nil {
+			return
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// newTestHTTPClient returns an HTTP client serving bodies, keyed by URL
+// without the query string. Other URLs return 404.
+func newTestHTTPClient(bodies map[string]string) *http.Client {
+	return &http.Client{
+		Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			u := *req.URL
+			u.RawQuery = ""
+			body, ok := bodies[u.String()]
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     "200 OK",
+				Body:       io.NopCloser(strings.NewReader(body)),
+				Request:    req,
+			}
+			if !ok {
+				resp.StatusCode = http.StatusNotFound
+				resp.Status = "404 Not Found"
+			}
+			return resp, nil
+		}),
+	}
+}
+
+func TestDiscoverServers(t *testing.T) {
+	tests := []struct {
+		name       string
+		srv        map[string][]net.SRV
+		autoconfig map[string]string
+		want       []imapclient.DiscoveredServer
+	}{
+		{
+			name: "srv",
+			srv: map[string][]net.SRV{
+				"_imap._tcp.example.org": {
+					{Target: "mail.example.org.", Port: 143},
+				},
+				"_imaps._tcp.example.org": {
+					{Target: "mail.example.org.", Port: 993},
+				},
+			},
+			want: []imapclient.DiscoveredServer{
+				{Host: "mail.example.org", Port: 993},
+				{Host: "mail.example.org", Port: 143, StartTLS: true},
+			},
+		},
+		{
+			name: "srv not available",
+			srv: map[string][]net.SRV{
+				"_imaps._tcp.example.org": {
+					{Target: ".", Port: 0},
+				},
+				"_imap._tcp.example.org": {
+					{Target: "mail.example.org.", Port: 143},
+				},
+			},
+			want: []imapclient.DiscoveredServer{
+				{Host: "mail.example.org", Port: 143, StartTLS: true},
+			},
+		},
+		{
+			name: "srv preferred over autoconfig",
+			srv: map[string][]net.SRV{
+				"_imaps._tcp.example.org": {
+					{Target: "srv.example.org.", Port: 993},
+				},
+			},
+			autoconfig: map[string]string{
+				"https://autoconfig.example.org/mail/config-v1.1.xml": autoconfigResponse("autoconfig.example.org", 993, "SSL"),
+			},
+			want: []imapclient.DiscoveredServer{
+				{Host: "srv.example.org", Port: 993},
+			},
+		},
+		{
+			name: "autoconfig",
+			autoconfig: map[string]string{
+				"https://autoconfig.example.org/mail/config-v1.1.xml": `<clientConfig version="1.1">
+  <emailProvider id="example.org">
+    <incomingServer type="pop3">
+      <hostname>pop.example.org</hostname>
+      <port>995</port>
+      <socketType>SSL</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>imap.example.org</hostname>
+      <port>143</port>
+      <socketType>STARTTLS</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>plain.example.org</hostname>
+      <port>143</port>
+      <socketType>plain</socketType>
+    </incomingServer>
+    <incomingServer type="imap">
+      <hostname>imap.%EMAILDOMAIN%</hostname>
+      <port>993</port>
+      <socketType>SSL</socketType>
+    </incomingServer>
+  </emailProvider>
+</clientConfig>`,
+			},
+			want: []imapclient.DiscoveredServer{
+				{Host: "imap.example.org", Port: 993},
+				{Host: "imap.example.org", Port: 143, StartTLS: true},
+			},
+		},
+		{
+			name: "autoconfig well-known",
+			autoconfig: map[string]string{
+				"https://autoconfig.example.org/mail/config-v1.1.xml":             "<invalid",
+				"https://example.org/.well-known/autoconfig/mail/config-v1.1.xml": autoconfigResponse("imap.example.org", 993, "SSL"),
+			},
+			want: []imapclient.DiscoveredServer{
+				{Host: "imap.example.org", Port: 993},
+			},
+		},
+		{
+			name: "not found",
+			autoconfig: map[string]string{
+				"https://autoconfig.example.org/mail/config-v1.1.xml": autoconfigResponse("imap.example.org", 143, "plain"),
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			servers, err := imapclient.DiscoverServers(context.Background(), "alice@example.org", &imapclient.DiscoverOptions{
+				Resolver:   newTestResolver(tc.srv),
+				HTTPClient: newTestHTTPClient(tc.autoconfig),
+				Autoconfig: true,
+			})
+			if tc.want == nil {
+				if err == nil {
+					t.Errorf("DiscoverServers() = %+v, want error", servers)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DiscoverServers() = %v", err)
+			}
+			if !reflect.DeepEqual(servers, tc.want) {
+				t.Errorf("DiscoverServers() = %+v, want %+v", servers, tc.want)
+			}
+		})
+	}
+}
+
+func autoconfigResponse(hostname string, port int, socketType string) string {
+	return `<clientConfig version="1.1">
+  <emailProvider id="example.org">
+    <incomingServer type="imap">
+      <hostname>` + hostname + `</hostname>
+      <port>` + strconv.Itoa(port) + `</port>
+      <socketType>` + socketType + `</socketType>
+    </incomingServer>
+  </emailProvider>
+</clientConfig>`
+}
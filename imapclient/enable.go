@@ -9,6 +9,10 @@ import (
 // This command requires support for IMAP4rev2 or the ENABLE extension.
 func (c *Client) Enable(caps ...imap.Cap) *EnableCommand {
 	cmd := &EnableCommand{}
+	if c.isBadCommand("ENABLE") {
+		cmd.skipped = true
+		return cmd
+	}
 	enc := c.beginCommand("ENABLE", cmd)
 	for _, c := range caps {
 		enc.SP().Atom(string(c))
@@ -22,6 +26,16 @@ func (c *Client) handleEnabled() error {
 	if err != nil {
 		return err
 	}
+
+	c.mutex.Lock()
+	if c.enabled == nil {
+		c.enabled = make(imap.CapSet)
+	}
+	for name := range caps {
+		c.enabled[name] = struct{}{}
+	}
+	c.mutex.Unlock()
+
 	if cmd := findPendingCmdByType[*EnableCommand](c); cmd != nil {
 		cmd.data.Caps = caps
 	}
@@ -31,10 +45,14 @@ func (c *Client) handleEnabled() error {
 // EnableCommand is an ENABLE command.
 type EnableCommand struct {
 	cmd
-	data EnableData
+	data    EnableData
+	skipped bool // see Options.ProbeExtensions
 }
 
 func (cmd *EnableCommand) Wait() (*EnableData, error) {
+	if cmd.skipped {
+		return &cmd.data, nil
+	}
 	return &cmd.data, cmd.cmd.Wait()
 }
 
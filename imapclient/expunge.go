@@ -1,12 +1,15 @@
 package imapclient
 
 import (
+	"math"
+	"strings"
+
 	"github.com/emersion/go-imap/v2"
 )
 
 // Expunge sends an EXPUNGE command.
 func (c *Client) Expunge() *ExpungeCommand {
-	cmd := &ExpungeCommand{seqNums: make(chan uint32, 128)}
+	cmd := &ExpungeCommand{seqNums: make(chan uint32, c.options.queueSize())}
 	c.beginCommand("EXPUNGE", cmd).end()
 	return cmd
 }
@@ -14,10 +17,11 @@ func (c *Client) Expunge() *ExpungeCommand {
 // UIDExpunge sends a UID EXPUNGE command.
 //
 // This command requires support for IMAP4rev2 or the UIDPLUS extension.
-func (c *Client) UIDExpunge(uids imap.SeqSet) *ExpungeCommand {
-	cmd := &ExpungeCommand{seqNums: make(chan uint32, 128)}
-	enc := c.beginCommand("UID EXPUNGE", cmd)
-	enc.SP().Atom(uids.String())
+func (c *Client) UIDExpunge(uids imap.NumSet) *ExpungeCommand {
+	cmd := &ExpungeCommand{seqNums: make(chan uint32, c.options.queueSize())}
+	arg, err := numSetArg(uids)
+	enc := c.beginFailedCommand("UID EXPUNGE", cmd, err)
+	enc.SP().Atom(arg)
 	enc.end()
 	return cmd
 }
@@ -30,7 +34,10 @@ func (c *Client) handleExpunge(seqNum uint32) error {
 	}
 	c.mutex.Unlock()
 
-	cmd := findPendingCmdByType[*ExpungeCommand](c)
+	// Servers may send EXPUNGE responses while a UID command is running, e.g.
+	// UID FETCH or UID STORE. These must not be attributed to an EXPUNGE
+	// command pipelined after it.
+	cmd := findOldestPendingCmdByType[*ExpungeCommand](c)
 	if cmd != nil {
 		cmd.seqNums <- seqNum
 	} else if handler := c.options.unilateralDataHandler().Expunge; handler != nil {
@@ -54,6 +61,7 @@ type ExpungeCommand struct {
 // On success, the message sequence number is returned. On error or if there
 // are no more messages, 0 is returned. To check the error value, use Close.
 func (cmd *ExpungeCommand) Next() uint32 {
+	cmd.flusher.Flush()
 	return <-cmd.seqNums
 }
 
@@ -82,3 +90,58 @@ func (cmd *ExpungeCommand) Collect() ([]uint32, error) {
 	}
 	return l, cmd.Close()
 }
+
+func (c *Client) handleVanished() error {
+	var earlier bool
+	if c.dec.Special('(') {
+		var tag string
+		if !c.dec.ExpectAtom(&tag) || !c.dec.ExpectSpecial(')') || !c.dec.ExpectSP() {
+			return c.dec.Err()
+		}
+		earlier = strings.EqualFold(tag, "EARLIER")
+	}
+
+	var seqSet imap.SeqSet
+	if !c.dec.ExpectSeqSet(&seqSet) {
+		return c.dec.Err()
+	}
+	uids := imap.UIDSet(seqSet)
+
+	if earlier {
+		if cmd := findPendingCmdByType[*FetchCommand](c); cmd != nil {
+			cmd.vanished.AddSet(uids)
+		}
+		return nil
+	}
+
+	// VANISHED without EARLIER replaces EXPUNGE when QRESYNC is enabled. The
+	// set isn't expanded, since it may contain large ranges.
+	c.mutex.Lock()
+	if c.state == imap.ConnStateSelected {
+		c.mailbox = c.mailbox.copy()
+		if n := uidSetLen(uids); n < uint64(c.mailbox.NumMessages) {
+			c.mailbox.NumMessages -= uint32(n)
+		} else {
+			c.mailbox.NumMessages = 0
+		}
+	}
+	c.mutex.Unlock()
+
+	if handler := c.options.unilateralDataHandler().Vanished; handler != nil {
+		handler(uids)
+	}
+	return nil
+}
+
+// uidSetLen returns the number of UIDs in a set. Dynamic ranges are counted
+// as containing all UIDs.
+func uidSetLen(uids imap.UIDSet) uint64 {
+	var n uint64
+	for _, r := range imap.SeqSet(uids).Canonical() {
+		if r.Start == 0 || r.Stop == 0 {
+			return math.MaxUint32
+		}
+		n += uint64(r.Stop) - uint64(r.Start) + 1
+	}
+	return n
+}
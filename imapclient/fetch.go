@@ -3,6 +3,8 @@ package imapclient
 import (
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -11,7 +13,7 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Client) fetch(uid bool, seqSet imap.SeqSet, items []imap.FetchItem) *FetchCommand {
+func (c *Client) fetch(uid bool, numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) *FetchCommand {
 	// Ensure we request UID as the first data item for UID FETCH, to be safer.
 	// We want to get it before any literal.
 	if uid {
@@ -25,31 +27,99 @@ func (c *Client) fetch(uid bool, seqSet imap.SeqSet, items []imap.FetchItem) *Fe
 	}
 
 	cmd := &FetchCommand{
-		uid:    uid,
-		seqSet: seqSet,
-		msgs:   make(chan *FetchMessageData, 128),
-	}
-	enc := c.beginCommand(uidCmdName("FETCH", uid), cmd)
-	enc.SP().Atom(seqSet.String()).SP().List(len(items), func(i int) {
-		writeFetchItem(enc.Encoder, items[i])
-	})
+		uid:           uid,
+		numSet:        numSet,
+		preserveOrder: c.options.PreserveFetchOrder,
+		msgs:          make(chan *FetchMessageData, c.options.queueSize()),
+	}
+	arg, err := numSetArg(numSet)
+	if err == nil {
+		err = checkFetchOptions(uid, options)
+	}
+	enc := c.beginFailedCommand(uidCmdName("FETCH", uid), cmd, err)
+	enc.SP().Atom(arg).SP()
+	writeFetchArgs(enc.Encoder, items, options)
 	enc.end()
 	return cmd
 }
 
+func writeFetchArgs(enc *imapwire.Encoder, items []imap.FetchItem, options *imap.FetchOptions) {
+	enc.List(len(items), func(i int) {
+		writeFetchItem(enc, items[i])
+	})
+	if modifiers := fetchModifiers(options); len(modifiers) > 0 {
+		enc.SP().List(len(modifiers), func(i int) {
+			switch modifier := modifiers[i]; modifier {
+			case "CHANGEDSINCE":
+				enc.Atom(modifier).SP().Atom(strconv.FormatUint(options.ChangedSince, 10))
+			default:
+				enc.Atom(modifier)
+			}
+		})
+	}
+}
+
+// checkFetchOptions returns an error if FETCH modifiers are inconsistent.
+func checkFetchOptions(uid bool, options *imap.FetchOptions) error {
+	if options == nil || !options.Vanished {
+		return nil
+	}
+	if !uid {
+		return fmt.Errorf("imapclient: FETCH VANISHED requires UID FETCH")
+	}
+	if options.ChangedSince == 0 {
+		return fmt.Errorf("imapclient: FETCH VANISHED requires CHANGEDSINCE")
+	}
+	return nil
+}
+
+func fetchModifiers(options *imap.FetchOptions) []string {
+	if options == nil {
+		return nil
+	}
+	var l []string
+	if options.ChangedSince != 0 {
+		l = append(l, "CHANGEDSINCE")
+	}
+	if options.Vanished {
+		l = append(l, "VANISHED")
+	}
+	return l
+}
+
 // Fetch sends a FETCH command.
 //
 // The caller must fully consume the FetchCommand. A simple way to do so is to
 // defer a call to FetchCommand.Close.
-func (c *Client) Fetch(seqSet imap.SeqSet, items []imap.FetchItem) *FetchCommand {
-	return c.fetch(false, seqSet, items)
+//
+// If numSet is an imap.UIDSet, a UID FETCH command is sent.
+func (c *Client) Fetch(numSet imap.NumSet, items []imap.FetchItem) *FetchCommand {
+	return c.fetch(isUIDSet(numSet), numSet, items, nil)
+}
+
+// UIDFetch sends a UID FETCH command. A SeqSet is interpreted as a set of
+// UIDs.
+//
+// See Fetch.
+func (c *Client) UIDFetch(numSet imap.NumSet, items []imap.FetchItem) *FetchCommand {
+	return c.fetch(true, numSet, items, nil)
 }
 
-// UIDFetch sends a UID FETCH command.
+// FetchWithOptions sends a FETCH command with modifiers.
 //
 // See Fetch.
-func (c *Client) UIDFetch(seqSet imap.SeqSet, items []imap.FetchItem) *FetchCommand {
-	return c.fetch(true, seqSet, items)
+func (c *Client) FetchWithOptions(numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) *FetchCommand {
+	return c.fetch(isUIDSet(numSet), numSet, items, options)
+}
+
+// UIDFetchWithOptions sends a UID FETCH command with modifiers.
+//
+// If FetchOptions.Vanished is set, the UIDs reported by the server as
+// expunged are available via FetchCommand.Vanished.
+//
+// See Fetch.
+func (c *Client) UIDFetchWithOptions(numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) *FetchCommand {
+	return c.fetch(true, numSet, items, options)
 }
 
 func writeFetchItem(enc *imapwire.Encoder, item imap.FetchItem) {
@@ -63,11 +133,12 @@ func writeFetchItem(enc *imapwire.Encoder, item imap.FetchItem) {
 		}
 		enc.Special('[')
 		writeSectionPart(enc, item.Part)
-		if len(item.Part) > 0 && item.Specifier != imap.PartSpecifierNone {
+		specifier := bodySectionSpecifier(item)
+		if len(item.Part) > 0 && specifier != imap.PartSpecifierNone {
 			enc.Special('.')
 		}
-		if item.Specifier != imap.PartSpecifierNone {
-			enc.Atom(string(item.Specifier))
+		if specifier != imap.PartSpecifierNone {
+			enc.Atom(string(specifier))
 
 			var headerList []string
 			if len(item.HeaderFields) > 0 {
@@ -128,12 +199,16 @@ func writeSectionPartial(enc *imapwire.Encoder, partial *imap.SectionPartial) {
 type FetchCommand struct {
 	cmd
 
-	uid        bool
-	seqSet     imap.SeqSet
-	recvSeqSet imap.SeqSet
+	uid           bool
+	numSet        imap.NumSet
+	recvSeqSet    imap.SeqSet
+	preserveOrder bool
 
 	msgs chan *FetchMessageData
 	prev *FetchMessageData
+
+	vanished imap.UIDSet
+	modified imap.SeqSet
 }
 
 // Next advances to the next message.
@@ -144,6 +219,7 @@ func (cmd *FetchCommand) Next() *FetchMessageData {
 	if cmd.prev != nil {
 		cmd.prev.discard()
 	}
+	cmd.flusher.Flush()
 	return <-cmd.msgs
 }
 
@@ -158,12 +234,37 @@ func (cmd *FetchCommand) Close() error {
 	return cmd.cmd.Wait()
 }
 
+// Vanished returns the UIDs of messages reported as expunged by a VANISHED
+// (EARLIER) response.
+//
+// This requires FetchOptions.Vanished. Vanished must only be called after
+// Close or Collect has returned.
+func (cmd *FetchCommand) Vanished() imap.UIDSet {
+	return cmd.vanished
+}
+
+// Modified returns the messages which haven't been altered by a STORE
+// command because they failed the UNCHANGEDSINCE test, as reported by the
+// MODIFIED response code. The set contains UIDs for UID STORE commands, and
+// sequence numbers otherwise.
+//
+// This requires StoreOptions.UnchangedSince. Modified must only be called
+// after Close or Collect has returned.
+func (cmd *FetchCommand) Modified() imap.SeqSet {
+	return cmd.modified
+}
+
 // Collect accumulates message data into a list.
 //
 // This method will read and store message contents in memory. This is
 // acceptable when the message contents have a reasonable size, but may not be
 // suitable when fetching e.g. attachments.
 //
+// Servers may send messages in any order. The messages are sorted by UID for
+// UID FETCH commands, and by sequence number otherwise, unless
+// Options.PreserveFetchOrder is set. The messages collected before an error
+// are returned along with it, in the same order.
+//
 // This is equivalent to calling Next repeatedly and then Close.
 func (cmd *FetchCommand) Collect() ([]*FetchMessageBuffer, error) {
 	defer cmd.Close()
@@ -177,16 +278,38 @@ func (cmd *FetchCommand) Collect() ([]*FetchMessageBuffer, error) {
 
 		buf, err := msg.Collect()
 		if err != nil {
+			cmd.sort(l)
 			return l, err
 		}
 
 		l = append(l, buf)
 	}
+	cmd.sort(l)
 	return l, cmd.Close()
 }
 
+func (cmd *FetchCommand) sort(l []*FetchMessageBuffer) {
+	if !cmd.preserveOrder {
+		sortFetchMessageBuffers(l, cmd.uid)
+	}
+}
+
+// sortFetchMessageBuffers sorts messages by UID or by sequence number.
+// Messages with the same number keep their relative order.
+func sortFetchMessageBuffers(l []*FetchMessageBuffer, uid bool) {
+	sort.SliceStable(l, func(i, j int) bool {
+		if uid {
+			return l[i].UID < l[j].UID
+		}
+		return l[i].SeqNum < l[j].SeqNum
+	})
+}
+
 // FetchMessageData contains a message's FETCH data.
 type FetchMessageData struct {
+	// Message sequence number. Servers may send EXPUNGE responses while a
+	// UID command is running, in which case the sequence numbers of the
+	// messages received before the expunge are no longer valid.
 	SeqNum uint32
 
 	items chan FetchItemData
@@ -250,6 +373,7 @@ var (
 	_ FetchItemData = FetchItemDataRFC822Size{}
 	_ FetchItemData = FetchItemDataUID{}
 	_ FetchItemData = FetchItemDataBodyStructure{}
+	_ FetchItemData = FetchItemDataModSeq{}
 )
 
 type discarder interface {
@@ -273,6 +397,15 @@ func (item FetchItemDataBodySection) discard() {
 	io.Copy(io.Discard, item.Literal)
 }
 
+// MatchCommand checks whether the response item corresponds to a body section
+// requested in a FETCH command.
+//
+// Servers may normalize the section in their response: for instance, header
+// field names may be returned in a different case or a different order.
+func (item FetchItemDataBodySection) MatchCommand(section *imap.FetchItemBodySection) bool {
+	return matchFetchItemBodySection(section, item.Section)
+}
+
 // FetchItemDataBinarySection holds data returned by FETCH BINARY[].
 type FetchItemDataBinarySection struct {
 	Section *imap.FetchItemBinarySection
@@ -329,6 +462,15 @@ type FetchItemDataBodyStructure struct {
 
 func (FetchItemDataBodyStructure) fetchItemData() {}
 
+// FetchItemDataModSeq holds data returned by FETCH MODSEQ.
+//
+// This requires the CONDSTORE extension.
+type FetchItemDataModSeq struct {
+	ModSeq uint64
+}
+
+func (FetchItemDataModSeq) fetchItemData() {}
+
 // FetchItemDataBinarySectionSize holds data returned by FETCH BINARY.SIZE[].
 type FetchItemDataBinarySectionSize struct {
 	Part []int
@@ -351,6 +493,83 @@ type FetchMessageBuffer struct {
 	BodySection       map[*imap.FetchItemBodySection][]byte
 	BinarySection     map[*imap.FetchItemBinarySection][]byte
 	BinarySectionSize []FetchItemDataBinarySectionSize
+	ModSeq            uint64 // requires CONDSTORE
+}
+
+// FindBodySection returns the contents of a requested body section.
+//
+// If the body section is not found, nil is returned.
+func (buf *FetchMessageBuffer) FindBodySection(section *imap.FetchItemBodySection) []byte {
+	for s, b := range buf.BodySection {
+		if matchFetchItemBodySection(section, s) {
+			return b
+		}
+	}
+	return nil
+}
+
+// bodySectionSpecifier returns the part specifier of a body section. Header
+// field lists imply the HEADER specifier.
+func bodySectionSpecifier(section *imap.FetchItemBodySection) imap.PartSpecifier {
+	if section.Specifier == imap.PartSpecifierNone && (len(section.HeaderFields) > 0 || len(section.HeaderFieldsNot) > 0) {
+		return imap.PartSpecifierHeader
+	}
+	return imap.PartSpecifier(strings.ToUpper(string(section.Specifier)))
+}
+
+func matchFetchItemBodySection(cmd, resp *imap.FetchItemBodySection) bool {
+	if bodySectionSpecifier(cmd) != bodySectionSpecifier(resp) {
+		return false
+	}
+	if !intSliceEqual(cmd.Part, resp.Part) {
+		return false
+	}
+	if !headerListEqual(cmd.HeaderFields, resp.HeaderFields) || !headerListEqual(cmd.HeaderFieldsNot, resp.HeaderFieldsNot) {
+		return false
+	}
+	if (cmd.Partial == nil) != (resp.Partial == nil) {
+		return false
+	}
+	if cmd.Partial != nil && cmd.Partial.Offset != resp.Partial.Offset {
+		return false
+	}
+	return true
+}
+
+func intSliceEqual(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// headerListEqual checks whether two lists contain the same header field
+// names, ignoring case, order and duplicates.
+func headerListEqual(a, b []string) bool {
+	contains := func(l []string, name string) bool {
+		for _, s := range l {
+			if strings.EqualFold(s, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range a {
+		if !contains(b, name) {
+			return false
+		}
+	}
+	for _, name := range b {
+		if !contains(a, name) {
+			return false
+		}
+	}
+	return true
 }
 
 func (buf *FetchMessageBuffer) populateItemData(item FetchItemData) error {
@@ -387,6 +606,8 @@ func (buf *FetchMessageBuffer) populateItemData(item FetchItemData) error {
 		buf.BodyStructure = item.BodyStructure
 	case FetchItemDataBinarySectionSize:
 		buf.BinarySectionSize = append(buf.BinarySectionSize, item)
+	case FetchItemDataModSeq:
+		buf.ModSeq = item.ModSeq
 	default:
 		panic(fmt.Errorf("unsupported fetch item data %T", item))
 	}
@@ -426,7 +647,7 @@ func (c *Client) handleFetch(seqNum uint32) error {
 			} else {
 				num = seqNum
 			}
-			if num == 0 || !cmd.seqSet.Contains(num) || cmd.recvSeqSet.Contains(num) {
+			if num == 0 || !numSetContains(cmd.numSet, num) || cmd.recvSeqSet.Contains(num) {
 				return false
 			}
 			cmd.recvSeqSet.AddNum(num)
@@ -505,6 +726,38 @@ func (c *Client) handleFetch(seqNum uint32) error {
 			}
 
 			item = FetchItemDataUID{UID: uid}
+		case imap.FetchItemModSeq:
+			var modSeq int64
+			if !dec.ExpectSP() || !dec.ExpectSpecial('(') || !dec.ExpectNumber64(&modSeq) || !dec.ExpectSpecial(')') {
+				return dec.Err()
+			}
+
+			item = FetchItemDataModSeq{ModSeq: uint64(modSeq)}
+		case "RFC822", "RFC822.HEADER", "RFC822.TEXT":
+			// Legacy forms, still sent by some servers even when a body
+			// section has been requested
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+
+			lit, _, ok := dec.ExpectNStringReader()
+			if !ok {
+				return dec.Err()
+			}
+
+			var fetchLit imap.LiteralReader
+			if lit != nil {
+				done = make(chan struct{})
+				fetchLit = &fetchLiteralReader{
+					LiteralReader: lit,
+					ch:            done,
+				}
+			}
+
+			item = FetchItemDataBodySection{
+				Section: legacyBodySection(string(attName)),
+				Literal: fetchLit,
+			}
 		case "BODY", "BINARY":
 			if dec.Special('[') {
 				var section imap.FetchItem
@@ -530,7 +783,15 @@ func (c *Client) handleFetch(seqNum uint32) error {
 					return dec.Err()
 				}
 
-				lit, _, ok := dec.ExpectNStringReader()
+				var (
+					lit *imapwire.LiteralReader
+					ok  bool
+				)
+				if attName == "BINARY" {
+					lit, _, ok = dec.ExpectNString8Reader()
+				} else {
+					lit, _, ok = dec.ExpectNStringReader()
+				}
 				if !ok {
 					return dec.Err()
 				}
@@ -614,6 +875,19 @@ func (c *Client) handleFetch(seqNum uint32) error {
 	})
 }
 
+// legacyBodySection returns the body section equivalent to a legacy RFC822
+// message data item, as defined in RFC 3501 section 6.4.5.
+func legacyBodySection(name string) *imap.FetchItemBodySection {
+	switch name {
+	case "RFC822.HEADER":
+		return &imap.FetchItemBodySection{Specifier: imap.PartSpecifierHeader, Peek: true}
+	case "RFC822.TEXT":
+		return &imap.FetchItemBodySection{Specifier: imap.PartSpecifierText}
+	default: // RFC822
+		return &imap.FetchItemBodySection{}
+	}
+}
+
 func isMsgAttNameChar(ch byte) bool {
 	return ch != '[' && imapwire.IsAtomChar(ch)
 }
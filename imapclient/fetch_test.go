@@ -0,0 +1,74 @@
+package imapclient_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestFetchHeaderFieldsNormalized(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 1 EXISTS",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: `T2 FETCH 1 (BODY.PEEK[HEADER.FIELDS ("Subject" "From")] BODY.PEEK[1.HEADER.FIELDS.NOT ("x-spam")] BODY[TEXT])`, responses: []string{
+				// Header field names are returned in a different case and
+				// order, with a duplicate
+				"* 1 FETCH (BODY[HEADER.FIELDS (FROM SUBJECT FROM)] {15}",
+				"Subject: Hi",
+				"",
+				" BODY[1.HEADER.FIELDS.NOT (X-SPAM)] {2}",
+				"",
+				" BODY[TEXT] {5}",
+				"Hi!",
+				")",
+				"T2 OK FETCH completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	fields := &imap.FetchItemBodySection{HeaderFields: []string{"Subject", "From"}, Peek: true}
+	fieldsNot := &imap.FetchItemBodySection{Part: []int{1}, HeaderFieldsNot: []string{"x-spam"}, Peek: true}
+	text := &imap.FetchItemBodySection{Specifier: "text"}
+	msgs, err := c.Fetch(imap.SeqSetNum(1), []imap.FetchItem{fields, fieldsNot, text}).Collect()
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch() returned %v messages, want 1", len(msgs))
+	}
+
+	for _, tc := range []struct {
+		section *imap.FetchItemBodySection
+		want    string
+	}{
+		{fields, "Subject: Hi\r\n\r\n"},
+		{fieldsNot, "\r\n"},
+		{text, "Hi!\r\n"},
+	} {
+		if b := msgs[0].FindBodySection(tc.section); string(b) != tc.want {
+			t.Errorf("FindBodySection(%v) = %q, want %q", tc.section, b, tc.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package imapclient
+
+import (
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// BatchFetch fetches a potentially large set of messages and collects the
+// results. The set is split into as many FETCH commands as necessary to stay
+// below Client.MaxCommandLength.
+//
+// If numSet is an imap.UIDSet, UID FETCH commands are sent. Like
+// FetchCommand.Collect, all of the data is stored in memory, and the messages
+// are sorted unless Options.PreserveFetchOrder is set.
+func (c *Client) BatchFetch(numSet imap.NumSet, items []imap.FetchItem, options *imap.FetchOptions) ([]*FetchMessageBuffer, error) {
+	name := uidCmdName("FETCH", isUIDSet(numSet))
+	budget, err := c.numSetLengthBudget(name, func(enc *imapwire.Encoder) {
+		writeFetchArgs(enc, items, options)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sets := splitNumSet(numSet, budget)
+	cmds := make([]*FetchCommand, len(sets))
+	for i, set := range sets {
+		cmds[i] = c.FetchWithOptions(set, items, options)
+	}
+
+	var l []*FetchMessageBuffer
+	for i, cmd := range cmds {
+		var bufs []*FetchMessageBuffer
+		bufs, err = cmd.Collect()
+		l = append(l, bufs...)
+		if err != nil {
+			for _, rest := range cmds[i+1:] {
+				rest.Close()
+			}
+			break
+		}
+	}
+	if !c.options.PreserveFetchOrder {
+		sortFetchMessageBuffers(l, isUIDSet(numSet))
+	}
+	return l, err
+}
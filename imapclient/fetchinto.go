@@ -0,0 +1,256 @@
+package imapclient
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"time"
+
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	msgtextproto "github.com/emersion/go-message/textproto"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+var (
+	uint32Type        = reflect.TypeOf(uint32(0))
+	uint64Type        = reflect.TypeOf(uint64(0))
+	int64Type         = reflect.TypeOf(int64(0))
+	stringType        = reflect.TypeOf("")
+	stringSliceType   = reflect.TypeOf([]string(nil))
+	byteSliceType     = reflect.TypeOf([]byte(nil))
+	timeType          = reflect.TypeOf(time.Time{})
+	flagSliceType     = reflect.TypeOf([]imap.Flag(nil))
+	envelopeType      = reflect.TypeOf((*imap.Envelope)(nil))
+	bodyStructureType = reflect.TypeOf((*imap.BodyStructure)(nil)).Elem()
+)
+
+// FetchDecoder decodes FETCH data into structs of type T.
+//
+// The fetched data is described by struct field tags with the "imap" key:
+//
+//	seqnum          uint32
+//	uid             uint32
+//	flags           []imap.Flag
+//	envelope        *imap.Envelope
+//	internaldate    time.Time
+//	rfc822.size     int64
+//	bodystructure   imap.BodyStructure
+//	modseq          uint64 (requires CONDSTORE)
+//	body            []byte, the whole message
+//	header:<name>   string or []string, the header field <name>
+//
+// Header fields decoded into a string are the first value of the field, with
+// RFC 2047 encoded words decoded. Header fields decoded into a []string are
+// all of the raw values of the field.
+//
+// Sections are fetched with the peek variants, so the \Seen flag isn't set.
+//
+// For example:
+//
+//	type message struct {
+//		UID      uint32         `imap:"uid"`
+//		Envelope *imap.Envelope `imap:"envelope"`
+//		ListID   string         `imap:"header:List-Id"`
+//		Received []string       `imap:"header:Received"`
+//	}
+type FetchDecoder[T any] struct {
+	fields        []fetchField
+	items         []imap.FetchItem
+	headerSection *imap.FetchItemBodySection
+	bodySection   *imap.FetchItemBodySection
+}
+
+type fetchField struct {
+	index  int
+	name   string // tag name, without the "header:" prefix for header fields
+	header bool
+}
+
+// NewFetchDecoder creates a new FetchDecoder for T. An error is returned if T
+// is not a struct or if its tags are invalid.
+func NewFetchDecoder[T any]() (*FetchDecoder[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("imapclient: cannot decode FETCH data into %v: not a struct", t)
+	}
+
+	d := &FetchDecoder[T]{}
+	var headerFields []string
+	seen := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("imap")
+		if !ok || tag == "-" {
+			continue
+		}
+		if !sf.IsExported() {
+			return nil, fmt.Errorf("imapclient: field %v with imap tag is unexported", sf.Name)
+		}
+
+		f := fetchField{index: i}
+		if name := strings.TrimPrefix(tag, "header:"); name != tag {
+			if name == "" {
+				return nil, fmt.Errorf("imapclient: field %v: empty header field name", sf.Name)
+			}
+			if sf.Type != stringType && sf.Type != stringSliceType {
+				return nil, fmt.Errorf("imapclient: field %v: header fields must be decoded into string or []string, not %v", sf.Name, sf.Type)
+			}
+			f.name = textproto.CanonicalMIMEHeaderKey(name)
+			f.header = true
+			if !seen["header:"+f.name] {
+				headerFields = append(headerFields, f.name)
+				seen["header:"+f.name] = true
+			}
+			d.fields = append(d.fields, f)
+			continue
+		}
+
+		f.name = strings.ToLower(tag)
+		var (
+			want reflect.Type
+			item imap.FetchItem
+		)
+		switch f.name {
+		case "seqnum":
+			want = uint32Type
+		case "uid":
+			want, item = uint32Type, imap.FetchItemUID
+		case "flags":
+			want, item = flagSliceType, imap.FetchItemFlags
+		case "envelope":
+			want, item = envelopeType, imap.FetchItemEnvelope
+		case "internaldate":
+			want, item = timeType, imap.FetchItemInternalDate
+		case "rfc822.size":
+			want, item = int64Type, imap.FetchItemRFC822Size
+		case "bodystructure":
+			want, item = bodyStructureType, imap.FetchItemBodyStructure
+		case "modseq":
+			want, item = uint64Type, imap.FetchItemModSeq
+		case "body":
+			want = byteSliceType
+			if d.bodySection == nil {
+				d.bodySection = &imap.FetchItemBodySection{Peek: true}
+				item = d.bodySection
+			}
+		default:
+			return nil, fmt.Errorf("imapclient: field %v: unknown FETCH item %q", sf.Name, tag)
+		}
+		if sf.Type != want {
+			return nil, fmt.Errorf("imapclient: field %v: FETCH item %q must be decoded into %v, not %v", sf.Name, tag, want, sf.Type)
+		}
+		if item != nil && !seen[f.name] {
+			d.items = append(d.items, item)
+			seen[f.name] = true
+		}
+		d.fields = append(d.fields, f)
+	}
+
+	if len(headerFields) > 0 {
+		d.headerSection = &imap.FetchItemBodySection{
+			Specifier:    imap.PartSpecifierHeader,
+			HeaderFields: headerFields,
+			Peek:         true,
+		}
+		d.items = append(d.items, d.headerSection)
+	}
+	if len(d.items) == 0 {
+		// FETCH requires at least one item
+		d.items = append(d.items, imap.FetchItemUID)
+	}
+
+	return d, nil
+}
+
+// Items returns the FETCH items to request for T.
+func (d *FetchDecoder[T]) Items() []imap.FetchItem {
+	return d.items
+}
+
+// Decode decodes the data of a message fetched with Items.
+func (d *FetchDecoder[T]) Decode(buf *FetchMessageBuffer) (*T, error) {
+	var header mail.Header
+	if d.headerSection != nil {
+		h, err := msgtextproto.ReadHeader(bufio.NewReader(bytes.NewReader(buf.FindBodySection(d.headerSection))))
+		if err != nil {
+			return nil, fmt.Errorf("imapclient: failed to parse message header: %v", err)
+		}
+		header = mail.Header{Header: gomessage.Header{Header: h}}
+	}
+
+	var v T
+	rv := reflect.ValueOf(&v).Elem()
+	for _, f := range d.fields {
+		fv := rv.Field(f.index)
+		if f.header {
+			if fv.Type() == stringSliceType {
+				fv.Set(reflect.ValueOf(header.Values(f.name)))
+			} else {
+				s, err := header.Text(f.name)
+				if err != nil {
+					s = header.Get(f.name)
+				}
+				fv.SetString(s)
+			}
+			continue
+		}
+
+		switch f.name {
+		case "seqnum":
+			fv.SetUint(uint64(buf.SeqNum))
+		case "uid":
+			fv.SetUint(uint64(buf.UID))
+		case "flags":
+			fv.Set(reflect.ValueOf(buf.Flags))
+		case "envelope":
+			fv.Set(reflect.ValueOf(buf.Envelope))
+		case "internaldate":
+			fv.Set(reflect.ValueOf(buf.InternalDate))
+		case "rfc822.size":
+			fv.SetInt(buf.RFC822Size)
+		case "bodystructure":
+			if buf.BodyStructure != nil {
+				fv.Set(reflect.ValueOf(buf.BodyStructure))
+			}
+		case "modseq":
+			fv.SetUint(buf.ModSeq)
+		case "body":
+			fv.SetBytes(buf.FindBodySection(d.bodySection))
+		}
+	}
+	return &v, nil
+}
+
+// FetchInto fetches messages and decodes them into structs of type T.
+//
+// See FetchDecoder for the supported struct tags. If numSet is an
+// imap.UIDSet, UID FETCH commands are sent. Large sets are split, see
+// Client.BatchFetch.
+//
+// Like FetchCommand.Collect, all of the data is stored in memory.
+func FetchInto[T any](c *Client, numSet imap.NumSet) ([]*T, error) {
+	d, err := NewFetchDecoder[T]()
+	if err != nil {
+		return nil, err
+	}
+
+	bufs, err := c.BatchFetch(numSet, d.Items(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l := make([]*T, 0, len(bufs))
+	for _, buf := range bufs {
+		v, err := d.Decode(buf)
+		if err != nil {
+			return l, err
+		}
+		l = append(l, v)
+	}
+	return l, nil
+}
@@ -0,0 +1,191 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+type fetchIntoMessage struct {
+	SeqNum        uint32             `imap:"seqnum"`
+	UID           uint32             `imap:"uid"`
+	Flags         []imap.Flag        `imap:"flags"`
+	Envelope      *imap.Envelope     `imap:"envelope"`
+	InternalDate  time.Time          `imap:"internaldate"`
+	RFC822Size    int64              `imap:"rfc822.size"`
+	BodyStructure imap.BodyStructure `imap:"bodystructure"`
+	ModSeq        uint64             `imap:"modseq"`
+	Body          []byte             `imap:"body"`
+	Subject       string             `imap:"header:subject"`
+	RawSubject    []string           `imap:"header:Subject"`
+	Received      []string           `imap:"header:Received"`
+	Missing       string             `imap:"header:X-Missing"`
+	Ignored       string             `imap:"-"`
+	Untagged      string
+}
+
+func TestFetchDecoder(t *testing.T) {
+	d, err := imapclient.NewFetchDecoder[fetchIntoMessage]()
+	if err != nil {
+		t.Fatalf("NewFetchDecoder() = %v", err)
+	}
+
+	bodySection := &imap.FetchItemBodySection{Peek: true}
+	headerSection := &imap.FetchItemBodySection{
+		Specifier:    imap.PartSpecifierHeader,
+		HeaderFields: []string{"Subject", "Received", "X-Missing"},
+		Peek:         true,
+	}
+	wantItems := []imap.FetchItem{
+		imap.FetchItemUID,
+		imap.FetchItemFlags,
+		imap.FetchItemEnvelope,
+		imap.FetchItemInternalDate,
+		imap.FetchItemRFC822Size,
+		imap.FetchItemBodyStructure,
+		imap.FetchItemModSeq,
+		bodySection,
+		headerSection,
+	}
+	if items := d.Items(); !reflect.DeepEqual(items, wantItems) {
+		t.Errorf("Items() = %v, want %v", items, wantItems)
+	}
+
+	body := "Subject: =?utf-8?q?Caf=C3=A9?=\r\n\r\nHi\r\n"
+	header := "Subject: =?utf-8?q?Caf=C3=A9?=\r\n" +
+		"Received: from a\r\n" +
+		"Received: from b\r\n" +
+		"\r\n"
+	date := time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC)
+	bs := &imap.BodyStructureSinglePart{Type: "text", Subtype: "plain"}
+	buf := &imapclient.FetchMessageBuffer{
+		SeqNum:        3,
+		UID:           42,
+		Flags:         []imap.Flag{imap.FlagSeen},
+		Envelope:      &imap.Envelope{Subject: "Café"},
+		InternalDate:  date,
+		RFC822Size:    int64(len(body)),
+		BodyStructure: bs,
+		ModSeq:        7,
+		BodySection: map[*imap.FetchItemBodySection][]byte{
+			bodySection:   []byte(body),
+			headerSection: []byte(header),
+		},
+	}
+	msg, err := d.Decode(buf)
+	if err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+
+	want := &fetchIntoMessage{
+		SeqNum:        3,
+		UID:           42,
+		Flags:         []imap.Flag{imap.FlagSeen},
+		Envelope:      &imap.Envelope{Subject: "Café"},
+		InternalDate:  date,
+		RFC822Size:    int64(len(body)),
+		BodyStructure: bs,
+		ModSeq:        7,
+		Body:          []byte(body),
+		// Encoded words are only decoded into strings
+		Subject:    "Café",
+		RawSubject: []string{"=?utf-8?q?Caf=C3=A9?="},
+		Received:   []string{"from a", "from b"},
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("Decode() = %+v, want %+v", msg, want)
+	}
+}
+
+func TestFetchDecoderNoItems(t *testing.T) {
+	// FETCH requires at least one item
+	d, err := imapclient.NewFetchDecoder[struct {
+		SeqNum uint32 `imap:"seqnum"`
+	}]()
+	if err != nil {
+		t.Fatalf("NewFetchDecoder() = %v", err)
+	}
+	if items, want := d.Items(), []imap.FetchItem{imap.FetchItemUID}; !reflect.DeepEqual(items, want) {
+		t.Errorf("Items() = %v, want %v", items, want)
+	}
+}
+
+func TestNewFetchDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		newDecoder func() error
+		want       string
+	}{
+		{
+			name: "not a struct",
+			newDecoder: func() error {
+				_, err := imapclient.NewFetchDecoder[string]()
+				return err
+			},
+			want: "not a struct",
+		},
+		{
+			name: "type mismatch",
+			newDecoder: func() error {
+				_, err := imapclient.NewFetchDecoder[struct {
+					UID int `imap:"uid"`
+				}]()
+				return err
+			},
+			want: "must be decoded into uint32, not int",
+		},
+		{
+			name: "unexported field",
+			newDecoder: func() error {
+				_, err := imapclient.NewFetchDecoder[struct {
+					uid uint32 `imap:"uid"`
+				}]()
+				return err
+			},
+			want: "unexported",
+		},
+		{
+			name: "empty header field name",
+			newDecoder: func() error {
+				_, err := imapclient.NewFetchDecoder[struct {
+					Header string `imap:"header:"`
+				}]()
+				return err
+			},
+			want: "empty header field name",
+		},
+		{
+			name: "header type mismatch",
+			newDecoder: func() error {
+				_, err := imapclient.NewFetchDecoder[struct {
+					Header []byte `imap:"header:Subject"`
+				}]()
+				return err
+			},
+			want: "must be decoded into string or []string",
+		},
+		{
+			name: "unknown item",
+			newDecoder: func() error {
+				_, err := imapclient.NewFetchDecoder[struct {
+					Foo string `imap:"foo"`
+				}]()
+				return err
+			},
+			want: "unknown FETCH item",
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.newDecoder()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("NewFetchDecoder() = %v, want error containing %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package imapclient
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// FlushMode specifies when commands are written to the connection.
+type FlushMode int
+
+const (
+	// Write each command as soon as it has been encoded
+	FlushModeAuto FlushMode = iota
+	// Buffer commands until Client.Flush is called, or until the client
+	// waits for a reply, e.g. in Command.Wait
+	FlushModeManual
+	// Buffer commands for at most Options.FlushDelay, so that bursts of
+	// commands are written together. This is similar to Nagle's algorithm.
+	FlushModeCoalesce
+)
+
+const (
+	defaultFlushDelay = time.Millisecond
+	// Buffered commands are written when the buffer grows larger than this
+	maxPendingWriteSize = 32 * 1024
+)
+
+func (options *Options) flushDelay() time.Duration {
+	if options.FlushDelay > 0 {
+		return options.FlushDelay
+	}
+	return defaultFlushDelay
+}
+
+// flushWriter buffers the commands written by the client, as configured by
+// Options.FlushMode.
+//
+// Writes go through while a continuation request is pending, since the
+// client is blocked until the server replies. The write deadline is only set
+// while the buffered data is written to the connection.
+type flushWriter struct {
+	w      io.Writer
+	client *Client
+
+	mutex sync.Mutex
+	buf   bytes.Buffer
+	timer *time.Timer
+}
+
+// newFlushWriter returns a writer buffering commands, or nil if commands
+// are written as soon as they have been encoded.
+func (c *Client) newFlushWriter(w io.Writer) *flushWriter {
+	if c.options.FlushMode == FlushModeAuto {
+		return nil
+	}
+	return &flushWriter{w: w, client: c}
+}
+
+// setWriter sets the writer commands are encoded to.
+func (c *Client) setWriter(w io.Writer) {
+	flusher := c.newFlushWriter(w)
+	if flusher != nil {
+		w = flusher
+	}
+	c.bw = c.options.newBufioWriter(w)
+
+	c.mutex.Lock()
+	c.flusher = flusher
+	c.mutex.Unlock()
+}
+
+func (fw *flushWriter) Write(b []byte) (int, error) {
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+
+	fw.buf.Write(b)
+	if fw.buf.Len() >= maxPendingWriteSize || fw.client.hasContReqs() {
+		if err := fw.flushLocked(); err != nil {
+			return 0, err
+		}
+	} else if fw.client.options.FlushMode == FlushModeCoalesce && fw.timer == nil {
+		fw.timer = time.AfterFunc(fw.client.options.flushDelay(), func() {
+			fw.Flush()
+		})
+	}
+	return len(b), nil
+}
+
+// Flush writes the buffered commands. On error, the connection is closed:
+// the server may have received a partial command.
+func (fw *flushWriter) Flush() error {
+	if fw == nil {
+		return nil
+	}
+	fw.mutex.Lock()
+	defer fw.mutex.Unlock()
+	return fw.flushLocked()
+}
+
+func (fw *flushWriter) flushLocked() error {
+	if fw.timer != nil {
+		fw.timer.Stop()
+		fw.timer = nil
+	}
+	if fw.buf.Len() == 0 {
+		return nil
+	}
+
+	fw.client.setConnWriteTimeout(cmdWriteTimeout)
+	_, err := fw.buf.WriteTo(fw.w)
+	fw.client.setConnWriteTimeout(0)
+	if err != nil {
+		fw.buf.Reset()
+		fw.client.conn.Close()
+	}
+	return err
+}
+
+func (c *Client) hasContReqs() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return len(c.contReqs) > 0
+}
+
+// Flush writes the commands buffered because of Options.FlushMode to the
+// connection. It's a no-op with FlushModeAuto.
+func (c *Client) Flush() error {
+	c.mutex.Lock()
+	fw := c.flusher
+	c.mutex.Unlock()
+	return fw.Flush()
+}
@@ -0,0 +1,141 @@
+package imapclient_test
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// writeCountingConn counts the writes made to a connection, and records the
+// write deadline.
+type writeCountingConn struct {
+	net.Conn
+
+	mutex    sync.Mutex
+	writes   int
+	deadline time.Time
+}
+
+func (conn *writeCountingConn) Write(b []byte) (int, error) {
+	conn.mutex.Lock()
+	conn.writes++
+	conn.mutex.Unlock()
+	return conn.Conn.Write(b)
+}
+
+func (conn *writeCountingConn) SetWriteDeadline(t time.Time) error {
+	conn.mutex.Lock()
+	conn.deadline = t
+	conn.mutex.Unlock()
+	return conn.Conn.SetWriteDeadline(t)
+}
+
+func (conn *writeCountingConn) state() (writes int, deadline time.Time) {
+	conn.mutex.Lock()
+	defer conn.mutex.Unlock()
+	return conn.writes, conn.deadline
+}
+
+func newFlushTestClient(t *testing.T, options *imapclient.Options) (*imapclient.Client, *writeCountingConn) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 NOOP", responses: []string{"T1 OK NOOP completed"}},
+			{command: "T2 NOOP", responses: []string{"T2 OK NOOP completed"}},
+			{command: "T3 NOOP", responses: []string{"T3 OK NOOP completed"}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+
+	conn := &writeCountingConn{Conn: clientConn}
+	c := imapclient.New(conn, options)
+	t.Cleanup(func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	})
+	return c, conn
+}
+
+func sendNoops(c *imapclient.Client) []*imapclient.Command {
+	cmds := make([]*imapclient.Command, 3)
+	for i := range cmds {
+		cmds[i] = c.Noop()
+	}
+	return cmds
+}
+
+func TestFlushModeManual(t *testing.T) {
+	c, conn := newFlushTestClient(t, &imapclient.Options{FlushMode: imapclient.FlushModeManual})
+
+	cmds := sendNoops(c)
+	if writes, _ := conn.state(); writes != 0 {
+		t.Errorf("%v writes before Flush, want 0", writes)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	writes, deadline := conn.state()
+	if writes != 1 {
+		t.Errorf("%v writes after Flush, want 1", writes)
+	}
+	if !deadline.IsZero() {
+		t.Errorf("write deadline not cleared after Flush")
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("Noop().Wait() = %v", err)
+		}
+	}
+	if writes, _ := conn.state(); writes != 1 {
+		t.Errorf("%v writes after Wait, want 1", writes)
+	}
+}
+
+func TestFlushModeCoalesce(t *testing.T) {
+	c, conn := newFlushTestClient(t, &imapclient.Options{
+		FlushMode:  imapclient.FlushModeCoalesce,
+		FlushDelay: 20 * time.Millisecond,
+	})
+
+	cmds := sendNoops(c)
+	if writes, _ := conn.state(); writes != 0 {
+		t.Errorf("%v writes before FlushDelay, want 0", writes)
+	}
+
+	// The commands are written by the timer, without calling Flush or Wait
+	timeout := time.After(5 * time.Second)
+	for {
+		if writes, _ := conn.state(); writes > 0 {
+			break
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("commands not written after FlushDelay")
+		}
+	}
+
+	for _, cmd := range cmds {
+		if err := cmd.Wait(); err != nil {
+			t.Errorf("Noop().Wait() = %v", err)
+		}
+	}
+	writes, deadline := conn.state()
+	if writes != 1 {
+		t.Errorf("%v writes after FlushDelay, want 1", writes)
+	}
+	if !deadline.IsZero() {
+		t.Errorf("write deadline not cleared after flushing")
+	}
+}
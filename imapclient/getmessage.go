@@ -0,0 +1,205 @@
+package imapclient
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// GetMessageOptions contains options for Client.GetMessage.
+type GetMessageOptions struct {
+	// Set the \Seen flag on the message. By default, the message is left
+	// untouched.
+	MarkSeen bool
+}
+
+// Message is a decoded message returned by Client.GetMessage.
+type Message struct {
+	UID      uint32
+	Flags    []imap.Flag
+	Envelope *imap.Envelope
+	Header   mail.Header
+
+	// Decoded text/plain and text/html bodies, if any
+	TextBody string
+	HTMLBody string
+
+	Attachments []MessageAttachment
+	// Messages embedded in this message, e.g. forwarded messages. Their
+	// header and text can be fetched with EmbeddedMessage.HeaderSection and
+	// EmbeddedMessage.TextSection, without downloading the whole message.
+	EmbeddedMessages []imap.EmbeddedMessage
+}
+
+// MessageAttachment describes an attachment of a message.
+//
+// The contents can be fetched with a BODY[] or BINARY[] item for Part.
+type MessageAttachment struct {
+	Part        []int
+	MediaType   string
+	Filename    string
+	Disposition string
+	Size        uint32
+}
+
+// GetMessage fetches and decodes the message with the specified UID.
+//
+// At most two FETCH commands are sent: one for the metadata and header, and
+// one for the text bodies.
+//
+// If the text bodies use a charset unknown to go-message, they are returned
+// without charset conversion.
+func (c *Client) GetMessage(uid uint32, options *GetMessageOptions) (*Message, error) {
+	if options == nil {
+		options = new(GetMessageOptions)
+	}
+
+	uidSet := imap.UIDSetNum(uid)
+	headerSection := &imap.FetchItemBodySection{
+		Specifier: imap.PartSpecifierHeader,
+		Peek:      true,
+	}
+	msgs, err := c.Fetch(uidSet, []imap.FetchItem{
+		imap.FetchItemFlags,
+		imap.FetchItemEnvelope,
+		imap.FetchItemBodyStructure,
+		headerSection,
+	}).Collect()
+	if err != nil {
+		return nil, err
+	} else if len(msgs) == 0 {
+		return nil, fmt.Errorf("imapclient: message with UID %v not found", uid)
+	}
+	buf := msgs[0]
+
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(buf.FindBodySection(headerSection))))
+	if err != nil {
+		return nil, fmt.Errorf("imapclient: failed to parse message header: %v", err)
+	}
+
+	msg := &Message{
+		UID:      uid,
+		Flags:    buf.Flags,
+		Envelope: buf.Envelope,
+		Header:   mail.Header{Header: gomessage.Header{Header: header}},
+	}
+
+	var textPart, htmlPart *imap.BodyStructureSinglePart
+	var textPath, htmlPath []int
+	if buf.BodyStructure != nil {
+		buf.BodyStructure.Walk(func(path []int, part imap.BodyStructure) bool {
+			singlePart, ok := part.(*imap.BodyStructureSinglePart)
+			if !ok {
+				return true
+			}
+
+			var disp string
+			if d := singlePart.Disposition(); d != nil {
+				disp = strings.ToLower(d.Value)
+			}
+			filename := singlePart.Filename()
+			if disp == "attachment" || (disp != "inline" && filename != "") || singlePart.Text == nil {
+				msg.Attachments = append(msg.Attachments, MessageAttachment{
+					Part:        path,
+					MediaType:   singlePart.MediaType(),
+					Filename:    filename,
+					Disposition: disp,
+					Size:        singlePart.Size,
+				})
+				return true
+			}
+
+			switch singlePart.MediaType() {
+			case "text/plain":
+				if textPart == nil {
+					textPart, textPath = singlePart, path
+				}
+			case "text/html":
+				if htmlPart == nil {
+					htmlPart, htmlPath = singlePart, path
+				}
+			}
+			return true
+		})
+		msg.EmbeddedMessages = imap.EmbeddedMessages(buf.BodyStructure)
+	}
+
+	var items []imap.FetchItem
+	var textSection, htmlSection *imap.FetchItemBodySection
+	if textPart != nil {
+		textSection = &imap.FetchItemBodySection{Part: textPath, Peek: !options.MarkSeen}
+		items = append(items, textSection)
+	}
+	if htmlPart != nil {
+		htmlSection = &imap.FetchItemBodySection{Part: htmlPath, Peek: !options.MarkSeen}
+		items = append(items, htmlSection)
+	}
+	if len(items) == 0 {
+		if options.MarkSeen {
+			err := c.Store(uidSet, &imap.StoreFlags{
+				Op:     imap.StoreFlagsAdd,
+				Silent: true,
+				Flags:  []imap.Flag{imap.FlagSeen},
+			}).Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return msg, nil
+	}
+
+	msgs, err = c.Fetch(uidSet, items).Collect()
+	if err != nil {
+		return nil, err
+	} else if len(msgs) == 0 {
+		return nil, fmt.Errorf("imapclient: message with UID %v not found", uid)
+	}
+	buf = msgs[0]
+	if len(buf.Flags) > 0 {
+		msg.Flags = buf.Flags
+	}
+
+	if textSection != nil {
+		msg.TextBody, err = decodeTextPart(textPart, buf.FindBodySection(textSection))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if htmlSection != nil {
+		msg.HTMLBody, err = decodeTextPart(htmlPart, buf.FindBodySection(htmlSection))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return msg, nil
+}
+
+func decodeTextPart(part *imap.BodyStructureSinglePart, b []byte) (string, error) {
+	var h gomessage.Header
+	h.SetContentType(part.MediaType(), part.Params)
+	if part.Encoding != "" {
+		h.Set("Content-Transfer-Encoding", part.Encoding)
+	}
+
+	entity, err := gomessage.New(h, bytes.NewReader(b))
+	if gomessage.IsUnknownEncoding(err) {
+		return string(b), nil
+	} else if err != nil && !gomessage.IsUnknownCharset(err) {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if _, err := io.Copy(&sb, entity.Body); err != nil {
+		return "", fmt.Errorf("imapclient: failed to decode message body: %v", err)
+	}
+	return sb.String(), nil
+}
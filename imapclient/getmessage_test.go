@@ -0,0 +1,168 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestGetMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		msg         string
+		text, html  string
+		attachments []imapclient.MessageAttachment
+	}{
+		{
+			name: "text",
+			msg: "Subject: Hello\r\n" +
+				"Content-Type: text/plain; charset=utf-8\r\n" +
+				"\r\n" +
+				"Hi there\r\n",
+			text: "Hi there",
+		},
+		{
+			name: "alternative",
+			msg: "Subject: Hello\r\n" +
+				"Content-Type: multipart/alternative; boundary=b\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"Content-Transfer-Encoding: quoted-printable\r\n" +
+				"\r\n" +
+				"Caf=C3=A9\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/html\r\n" +
+				"\r\n" +
+				"<p>Caf&eacute;</p>\r\n" +
+				"--b--\r\n",
+			text: "Café",
+			html: "<p>Caf&eacute;</p>",
+		},
+		{
+			name: "first text part wins",
+			msg: "Subject: Hello\r\n" +
+				"Content-Type: multipart/mixed; boundary=b\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"first\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"second\r\n" +
+				"--b--\r\n",
+			text: "first",
+		},
+		{
+			name: "attachments",
+			msg: "Subject: Hello\r\n" +
+				"Content-Type: multipart/mixed; boundary=b\r\n" +
+				"\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"\r\n" +
+				"See attached\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/plain\r\n" +
+				"Content-Disposition: attachment\r\n" +
+				"\r\n" +
+				"notes\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/csv; name=\"report.csv\"\r\n" +
+				"\r\n" +
+				"a,b\r\n" +
+				"--b\r\n" +
+				"Content-Type: text/html\r\n" +
+				"Content-Disposition: inline; filename=\"signature.html\"\r\n" +
+				"\r\n" +
+				"<p>Bye</p>\r\n" +
+				"--b\r\n" +
+				"Content-Type: application/octet-stream\r\n" +
+				"\r\n" +
+				"data\r\n" +
+				"--b--\r\n",
+			text: "See attached",
+			html: "<p>Bye</p>",
+			attachments: []imapclient.MessageAttachment{
+				{Part: []int{2}, MediaType: "text/plain", Disposition: "attachment", Size: 5},
+				{Part: []int{3}, MediaType: "text/csv", Filename: "report.csv", Size: 3},
+				{Part: []int{5}, MediaType: "application/octet-stream", Size: 4},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := newTestClient(t, nil)
+			if err := c.Login("alice", "secret").Wait(); err != nil {
+				t.Fatalf("Login() = %v", err)
+			}
+			appendCmd := c.Append("INBOX", int64(len(tc.msg)), nil)
+			appendCmd.Write([]byte(tc.msg))
+			appendCmd.Close()
+			if _, err := appendCmd.Wait(); err != nil {
+				t.Fatalf("Append() = %v", err)
+			}
+			if _, err := c.Select("INBOX").Wait(); err != nil {
+				t.Fatalf("Select() = %v", err)
+			}
+
+			msg, err := c.GetMessage(1, nil)
+			if err != nil {
+				t.Fatalf("GetMessage() = %v", err)
+			}
+			if subject, _ := msg.Header.Subject(); subject != "Hello" {
+				t.Errorf("Header.Subject() = %q, want %q", subject, "Hello")
+			}
+			if got := strings.TrimSuffix(msg.TextBody, "\r\n"); got != tc.text {
+				t.Errorf("TextBody = %q, want %q", msg.TextBody, tc.text)
+			}
+			if got := strings.TrimSuffix(msg.HTMLBody, "\r\n"); got != tc.html {
+				t.Errorf("HTMLBody = %q, want %q", msg.HTMLBody, tc.html)
+			}
+			if !reflect.DeepEqual(msg.Attachments, tc.attachments) {
+				t.Errorf("Attachments = %+v, want %+v", msg.Attachments, tc.attachments)
+			}
+			if len(msg.Flags) != 0 {
+				t.Errorf("Flags = %v, want the message to stay unseen", msg.Flags)
+			}
+		})
+	}
+}
+
+func TestGetMessageMarkSeen(t *testing.T) {
+	for _, msg := range []string{
+		"Subject: Hello\r\n\r\nHi there\r\n",
+		"Subject: Hello\r\nContent-Type: application/pdf\r\n\r\ndata\r\n",
+	} {
+		c := newTestClient(t, nil)
+		if err := c.Login("alice", "secret").Wait(); err != nil {
+			t.Fatalf("Login() = %v", err)
+		}
+		appendCmd := c.Append("INBOX", int64(len(msg)), nil)
+		appendCmd.Write([]byte(msg))
+		appendCmd.Close()
+		if _, err := appendCmd.Wait(); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+		if _, err := c.Select("INBOX").Wait(); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+
+		if _, err := c.GetMessage(1, &imapclient.GetMessageOptions{MarkSeen: true}); err != nil {
+			t.Fatalf("GetMessage() = %v", err)
+		}
+		msgs, err := c.Fetch(imap.UIDSetNum(1), []imap.FetchItem{imap.FetchItemFlags}).Collect()
+		if err != nil {
+			t.Fatalf("Fetch() = %v", err)
+		}
+		if len(msgs) != 1 || len(msgs[0].Flags) != 1 || !strings.EqualFold(string(msgs[0].Flags[0]), string(imap.FlagSeen)) {
+			t.Errorf("Fetch() = %+v, want \\Seen", msgs)
+		}
+	}
+}
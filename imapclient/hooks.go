@@ -0,0 +1,152 @@
+package imapclient
+
+import (
+	"bufio"
+	"bytes"
+)
+
+// CommandHooks contains callbacks invoked for each command sent by the
+// client.
+//
+// The callbacks can be used to record traffic, collect metrics or build test
+// doubles. They will be invoked in an arbitrary goroutine and must not block.
+//
+// See Options.CommandHooks.
+type CommandHooks struct {
+	// Send is called before a command is written to the connection. If it
+	// returns an error, the command isn't sent and fails with this error.
+	Send func(tag, name string) error
+	// Sent is called when a command has been written to the connection,
+	// before the server can reply. raw contains the encoded command,
+	// including literals and the final CRLF. Note, this may include
+	// sensitive information such as credentials.
+	Sent func(tag, name string, raw []byte)
+	// Maximum number of bytes of each literal included in the raw data
+	// passed to Sent, the rest of the literal data is omitted. If zero, 4096
+	// bytes are kept. If negative, literals are never truncated.
+	SentLiteralLimit int
+	// Done is called when a command has completed, before the command's
+	// Wait method returns. err is nil if the command succeeded. The returned
+	// error replaces err.
+	//
+	// data contains the decoded result for commands returning a single
+	// value: *imap.AppendData, *imap.CopyData, *MoveData, *imap.SearchData,
+	// *imap.SelectData, *imap.StatusData, *EnableData and
+	// *imap.NamespaceData. Done may modify it in place. For other commands,
+	// data is nil.
+	Done func(tag, name string, data interface{}, err error) error
+}
+
+const defaultSentLiteralLimit = 4096
+
+func (hooks *CommandHooks) sentLiteralLimit() int64 {
+	switch {
+	case hooks.SentLiteralLimit > 0:
+		return int64(hooks.SentLiteralLimit)
+	case hooks.SentLiteralLimit < 0:
+		return -1
+	default:
+		return defaultSentLiteralLimit
+	}
+}
+
+// commandResult is implemented by commands returning a single value.
+type commandResult interface {
+	result() interface{}
+}
+
+func (cmd *AppendCommand) result() interface{}    { return &cmd.data }
+func (cmd *CopyCommand) result() interface{}      { return &cmd.data }
+func (cmd *MoveCommand) result() interface{}      { return &cmd.data }
+func (cmd *SearchCommand) result() interface{}    { return &cmd.data }
+func (cmd *SelectCommand) result() interface{}    { return &cmd.data }
+func (cmd *StatusCommand) result() interface{}    { return &cmd.data }
+func (cmd *EnableCommand) result() interface{}    { return &cmd.data }
+func (cmd *NamespaceCommand) result() interface{} { return &cmd.data }
+
+// recordingWriter writes to a bufio.Writer and keeps a copy of the data, for
+// CommandHooks.Sent.
+type recordingWriter struct {
+	bw  *bufio.Writer
+	enc *bufio.Writer // buffered writer of the encoder, writing to this one
+	buf bytes.Buffer
+
+	// Literal data still to be written, and how many bytes of it can still
+	// be recorded
+	literal, literalKeep int64
+	literalLimit         int64
+
+	// If set, the rest of the command is held back until it has been passed
+	// to the callback
+	final   bool
+	pending bytes.Buffer
+	sent    func(raw []byte)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.record(b)
+
+	if w.final {
+		w.pending.Write(b)
+		return len(b), nil
+	}
+	n, err := w.bw.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, w.bw.Flush()
+}
+
+func (w *recordingWriter) record(b []byte) {
+	for len(b) > 0 && w.literal > 0 {
+		n := int64(len(b))
+		if n > w.literal {
+			n = w.literal
+		}
+		keep := n
+		if w.literalKeep >= 0 && keep > w.literalKeep {
+			keep = w.literalKeep
+		}
+		w.buf.Write(b[:keep])
+		if w.literalKeep >= 0 {
+			w.literalKeep -= keep
+		}
+		w.literal -= n
+		b = b[n:]
+	}
+	w.buf.Write(b)
+}
+
+// beginLiteral indicates that the next size bytes written by the encoder are
+// literal data.
+func (w *recordingWriter) beginLiteral(size int64) error {
+	if err := w.enc.Flush(); err != nil {
+		return err
+	}
+	w.literal = size
+	w.literalKeep = w.literalLimit
+	return nil
+}
+
+// finish invokes the callback with the whole command, then writes the rest of
+// the command. The encoder must have been flushed.
+func (w *recordingWriter) finish() error {
+	w.sent(w.buf.Bytes())
+	w.final = false
+	if _, err := w.bw.Write(w.pending.Bytes()); err != nil {
+		return err
+	}
+	return w.bw.Flush()
+}
+
+func (c *Client) commandDone(cmd command, err error) error {
+	hooks := c.tracer.commandHooks()
+	if hooks == nil || hooks.Done == nil {
+		return err
+	}
+	var data interface{}
+	if res, ok := cmd.(commandResult); ok && err == nil {
+		data = res.result()
+	}
+	return hooks.Done(cmd.base().tag, cmd.base().name, data, err)
+}
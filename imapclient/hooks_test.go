@@ -0,0 +1,161 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// newTestClient connects to an in-memory server with a user "alice" whose
+// password is "secret", and an INBOX.
+func newTestClient(t *testing.T, options *imapclient.Options) *imapclient.Client {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewConnSession(conn), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+	t.Cleanup(func() { server.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	c := imapclient.New(conn, options)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+type sentCommand struct {
+	tag, name string
+	raw       string
+}
+
+func TestCommandHooksSent(t *testing.T) {
+	var (
+		mutex sync.Mutex
+		sent  []sentCommand
+	)
+	c := newTestClient(t, &imapclient.Options{
+		CommandHooks: &imapclient.CommandHooks{
+			Sent: func(tag, name string, raw []byte) {
+				mutex.Lock()
+				sent = append(sent, sentCommand{tag, name, string(raw)})
+				mutex.Unlock()
+			},
+			SentLiteralLimit: 8,
+		},
+	})
+
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	msg := "Subject: hooks\r\n\r\n" + strings.Repeat("a", 10000) + "\r\n"
+	appendCmd := c.Append("INBOX", int64(len(msg)), nil)
+	if _, err := appendCmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	var appendRaw string
+	for _, cmd := range sent {
+		if !strings.HasSuffix(cmd.raw, "\r\n") {
+			t.Errorf("%v command without trailing CRLF: %q", cmd.name, cmd.raw)
+		}
+		if !strings.HasPrefix(cmd.raw, cmd.tag+" "+cmd.name) {
+			t.Errorf("%v command doesn't start with its tag and name: %q", cmd.name, cmd.raw)
+		}
+		if cmd.name == "APPEND" {
+			appendRaw = cmd.raw
+		}
+	}
+	if want := "}\r\nSubject:\r\n"; !strings.HasSuffix(appendRaw, want) {
+		t.Errorf("APPEND recorded as %q, want literal truncated to %q", appendRaw, want)
+	}
+}
+
+func TestCommandHooksSendVeto(t *testing.T) {
+	errVeto := errors.New("vetoed")
+	var sent bytes.Buffer
+	c := newTestClient(t, &imapclient.Options{
+		CommandHooks: &imapclient.CommandHooks{
+			Send: func(tag, name string) error {
+				if name == "DELETE" {
+					return errVeto
+				}
+				return nil
+			},
+			Sent: func(tag, name string, raw []byte) {
+				sent.Write(raw)
+			},
+		},
+	})
+
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if err := c.Delete("INBOX").Wait(); err != errVeto {
+		t.Errorf("Delete() = %v, want veto error", err)
+	}
+	// The connection is still usable, and INBOX hasn't been deleted
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Errorf("Select() = %v", err)
+	}
+	if strings.Contains(sent.String(), "DELETE") {
+		t.Errorf("vetoed command sent: %q", sent.String())
+	}
+}
+
+func TestCommandHooksDone(t *testing.T) {
+	c := newTestClient(t, &imapclient.Options{
+		CommandHooks: &imapclient.CommandHooks{
+			Done: func(tag, name string, data interface{}, err error) error {
+				if selectData, ok := data.(*imap.SelectData); ok {
+					selectData.NumMessages = 42
+				}
+				return err
+			},
+		},
+	})
+
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	data, err := c.Select("INBOX").Wait()
+	if err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	if data.NumMessages != 42 {
+		t.Errorf("NumMessages = %v, want the value set by Done", data.NumMessages)
+	}
+}
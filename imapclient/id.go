@@ -0,0 +1,96 @@
+package imapclient
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// ID sends an ID command.
+//
+// The fields identify the client, e.g. "name" and "version". A nil map sends
+// no information.
+//
+// This command requires support for the ID extension.
+func (c *Client) ID(fields map[string]string) *IDCommand {
+	cmd := &IDCommand{}
+	if c.isBadCommand("ID") {
+		cmd.skipped = true
+		return cmd
+	}
+	enc := c.beginCommand("ID", cmd)
+	enc.SP()
+	if fields == nil {
+		enc.NIL()
+	} else {
+		keys := make([]string, 0, len(fields))
+		for k := range fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		enc.List(len(keys), func(i int) {
+			enc.String(keys[i]).SP().String(fields[keys[i]])
+		})
+	}
+	enc.end()
+	return cmd
+}
+
+func (c *Client) handleID() error {
+	fields, err := readID(c.dec)
+	if err != nil {
+		return fmt.Errorf("in id-response: %v", err)
+	}
+	c.mutex.Lock()
+	c.serverInfo.ID = fields
+	c.updateServerInfoLocked()
+	c.mutex.Unlock()
+	if cmd := findPendingCmdByType[*IDCommand](c); cmd != nil {
+		cmd.fields = fields
+	}
+	return nil
+}
+
+// IDCommand is an ID command.
+type IDCommand struct {
+	cmd
+	fields  map[string]string
+	skipped bool // see Options.ProbeExtensions
+}
+
+// Wait waits for the command to complete and returns the fields sent by the
+// server. Field names are converted to lower-case. The map is nil if the
+// server didn't send any information.
+func (cmd *IDCommand) Wait() (map[string]string, error) {
+	if cmd.skipped {
+		return cmd.fields, nil
+	}
+	return cmd.fields, cmd.cmd.Wait()
+}
+
+func readID(dec *imapwire.Decoder) (map[string]string, error) {
+	var l []string
+	err := dec.ExpectNList(func() error {
+		var s string
+		if !dec.ExpectNString(&s) {
+			return dec.Err()
+		}
+		l = append(l, s)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if len(l)%2 != 0 {
+		return nil, fmt.Errorf("odd number of items in ID list")
+	} else if l == nil {
+		return nil, nil
+	}
+
+	fields := make(map[string]string, len(l)/2)
+	for i := 0; i < len(l); i += 2 {
+		fields[strings.ToLower(l[i])] = l[i+1]
+	}
+	return fields, nil
+}
@@ -2,6 +2,7 @@ package imapclient
 
 import (
 	"fmt"
+	"sync"
 )
 
 // Idle sends an IDLE command.
@@ -24,9 +25,34 @@ func (c *Client) Idle() (*IdleCommand, error) {
 		return nil, err
 	}
 
+	c.mutex.Lock()
+	c.idle = cmd
+	c.mutex.Unlock()
 	return cmd, nil
 }
 
+// stopIdle stops the running IDLE command, if any. It returns false if IDLE
+// wasn't running.
+//
+// The IDLE command is stopped on behalf of its owner: IdleCommand.Close
+// returns nil afterwards.
+func (c *Client) stopIdle() (bool, error) {
+	c.mutex.Lock()
+	cmd := c.idle
+	c.mutex.Unlock()
+	if cmd == nil {
+		return false, nil
+	}
+
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+	if cmd.enc == nil {
+		return false, nil // closed concurrently by its owner
+	}
+	cmd.stopped = true
+	return true, cmd.closeLocked()
+}
+
 // IdleCommand is an IDLE command.
 //
 // Initially, the IDLE command is running. The server may send unilateral
@@ -35,25 +61,51 @@ func (c *Client) Idle() (*IdleCommand, error) {
 // Close must be called to stop the IDLE command.
 type IdleCommand struct {
 	cmd
-	enc *commandEncoder
+
+	mutex   sync.Mutex // protects fields below
+	enc     *commandEncoder
+	stopped bool // by the client, see Client.stopIdle
 }
 
 // Close stops the IDLE command.
 //
 // This method blocks until the command to stop IDLE is written, but doesn't
 // wait for the server to respond. Callers can use Wait for this purpose.
+//
+// If IDLE has already been stopped by an AccountManager, nil is returned.
 func (cmd *IdleCommand) Close() error {
+	cmd.mutex.Lock()
+	defer cmd.mutex.Unlock()
+
 	if cmd.err != nil {
 		return cmd.err
 	}
 	if cmd.enc == nil {
+		if cmd.stopped {
+			cmd.stopped = false
+			return nil
+		}
 		return fmt.Errorf("imapclient: IDLE command closed twice")
 	}
+	return cmd.closeLocked()
+}
+
+func (cmd *IdleCommand) closeLocked() error {
+	c := cmd.enc.client
+	c.mutex.Lock()
+	if c.idle == cmd {
+		c.idle = nil
+	}
+	c.mutex.Unlock()
+
 	cmd.enc.client.setWriteTimeout(cmdWriteTimeout)
 	_, err := cmd.enc.client.bw.WriteString("DONE\r\n")
 	if err == nil {
 		err = cmd.enc.client.bw.Flush()
 	}
+	if err == nil {
+		err = cmd.flusher.Flush()
+	}
 	cmd.enc.end()
 	cmd.enc = nil
 	return err
@@ -63,7 +115,10 @@ func (cmd *IdleCommand) Close() error {
 //
 // Wait can only be called after Close.
 func (cmd *IdleCommand) Wait() error {
-	if cmd.enc != nil {
+	cmd.mutex.Lock()
+	running := cmd.enc != nil
+	cmd.mutex.Unlock()
+	if running {
 		return fmt.Errorf("imapclient: IdleCommand.Close must be called before Wait")
 	}
 	return cmd.cmd.Wait()
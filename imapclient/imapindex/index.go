@@ -0,0 +1,345 @@
+// Package imapindex maintains a local full-text index of messages, and
+// answers SEARCH criteria offline.
+//
+// Messages fetched by imapclient are added to the index, typically while
+// synchronizing a mailbox. The index doesn't send any command: searches are
+// answered from the indexed messages only, with the same criteria model as
+// imapclient.Client.UIDSearch.
+//
+// TEXT and BODY keys are matched against the decoded text parts of the
+// messages, using a trigram index to skip messages which can't match.
+//
+// # Limitations
+//
+// The index is kept in memory only: nothing is persisted, and the index must
+// be rebuilt by fetching the messages again after a restart.
+//
+// An Index holds the messages of a single mailbox and is keyed by UID only.
+// It doesn't know which mailbox it belongs to, nor its UIDVALIDITY. Callers
+// indexing several mailboxes must keep one Index per mailbox, and must
+// discard an Index when the UIDVALIDITY of its mailbox changes, since UIDs
+// may then refer to different messages.
+package imapindex
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/mail"
+	"github.com/emersion/go-message/textproto"
+)
+
+// ErrUnsupportedCriteria is returned by Index.Search when the criteria
+// contain keys which can't be answered offline.
+var ErrUnsupportedCriteria = errors.New("imapindex: unsupported search criteria")
+
+// Message is a message to add to the index.
+type Message struct {
+	UID          uint32
+	Flags        []imap.Flag
+	InternalDate time.Time
+	// RFC822.SIZE of the message. If zero, the length of Literal is used.
+	Size int64
+	// Full message, as returned by BODY[]
+	Literal []byte
+}
+
+// Index is a full-text index of the messages of a mailbox, by UID.
+//
+// It's safe to use an Index from multiple goroutines.
+type Index struct {
+	mutex  sync.RWMutex
+	docs   map[uint32]*document
+	header postings
+	body   postings
+}
+
+// New creates a new empty index.
+func New() *Index {
+	return &Index{
+		docs:   make(map[uint32]*document),
+		header: make(postings),
+		body:   make(postings),
+	}
+}
+
+// Add adds a message to the index. If a message with the same UID has
+// already been added, it's replaced.
+func (idx *Index) Add(msg *Message) error {
+	if msg.UID == 0 {
+		return fmt.Errorf("imapindex: missing UID")
+	}
+	doc := newDocument(msg)
+
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.removeLocked(msg.UID)
+	idx.docs[msg.UID] = doc
+	idx.header.add(msg.UID, doc.headerText)
+	idx.body.add(msg.UID, doc.bodyText)
+	return nil
+}
+
+// AddFetchMessage adds a message fetched with imapclient.Client.Fetch.
+//
+// The UID, FLAGS, INTERNALDATE and BODY[] items must have been fetched.
+// RFC822.SIZE is optional.
+func (idx *Index) AddFetchMessage(buf *imapclient.FetchMessageBuffer) error {
+	literal := buf.FindBodySection(&imap.FetchItemBodySection{})
+	if literal == nil {
+		return fmt.Errorf("imapindex: missing BODY[] for message UID %v", buf.UID)
+	}
+	return idx.Add(&Message{
+		UID:          buf.UID,
+		Flags:        buf.Flags,
+		InternalDate: buf.InternalDate,
+		Size:         buf.RFC822Size,
+		Literal:      literal,
+	})
+}
+
+// SetFlags replaces the flags of an indexed message. It returns false if the
+// message isn't in the index.
+func (idx *Index) SetFlags(uid uint32, flags []imap.Flag) bool {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	doc, ok := idx.docs[uid]
+	if ok {
+		doc.flags = flagSet(flags)
+	}
+	return ok
+}
+
+// Remove removes a message from the index, e.g. after it's been expunged.
+func (idx *Index) Remove(uid uint32) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+	idx.removeLocked(uid)
+}
+
+func (idx *Index) removeLocked(uid uint32) {
+	doc, ok := idx.docs[uid]
+	if !ok {
+		return
+	}
+	delete(idx.docs, uid)
+	idx.header.remove(uid, doc.headerText)
+	idx.body.remove(uid, doc.bodyText)
+}
+
+// Len returns the number of indexed messages.
+func (idx *Index) Len() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+	return len(idx.docs)
+}
+
+// Search returns the UIDs of the indexed messages matching the criteria, in
+// ascending order.
+//
+// Strings are matched case-insensitively. Relative keys (OLDER and YOUNGER)
+// are evaluated against the current time. Sequence numbers and MODSEQ keys
+// aren't supported, because the index doesn't track them: ErrUnsupportedCriteria
+// is returned.
+func (idx *Index) Search(criteria *imap.SearchCriteria) ([]uint32, error) {
+	if err := checkCriteria(criteria); err != nil {
+		return nil, err
+	}
+
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	// "*" is the largest UID in the index
+	m := &matcher{now: time.Now()}
+	for uid := range idx.docs {
+		if uid > m.lastUID {
+			m.lastUID = uid
+		}
+	}
+
+	candidates, ok := idx.candidates(criteria)
+	if !ok {
+		candidates = make(map[uint32]struct{}, len(idx.docs))
+		for uid := range idx.docs {
+			candidates[uid] = struct{}{}
+		}
+	}
+
+	var uids []uint32
+	for uid := range candidates {
+		if m.match(idx.docs[uid], uid, criteria) {
+			uids = append(uids, uid)
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool {
+		return uids[i] < uids[j]
+	})
+	return uids, nil
+}
+
+// candidates returns the messages which may match the top-level full-text
+// keys of the criteria. It returns false if the keys don't restrict the
+// candidates.
+func (idx *Index) candidates(criteria *imap.SearchCriteria) (map[uint32]struct{}, bool) {
+	var (
+		out        map[uint32]struct{}
+		restricted bool
+	)
+	and := func(set map[uint32]struct{}) {
+		if !restricted {
+			out, restricted = set, true
+			return
+		}
+		for uid := range out {
+			if _, ok := set[uid]; !ok {
+				delete(out, uid)
+			}
+		}
+	}
+
+	for _, pattern := range criteria.Body {
+		if set, ok := idx.body.lookup(pattern); ok {
+			and(set)
+		}
+	}
+	for _, pattern := range criteria.Text {
+		headerSet, headerOK := idx.header.lookup(pattern)
+		bodySet, bodyOK := idx.body.lookup(pattern)
+		if !headerOK || !bodyOK {
+			continue
+		}
+		for uid := range bodySet {
+			headerSet[uid] = struct{}{}
+		}
+		and(headerSet)
+	}
+	return out, restricted
+}
+
+func checkCriteria(criteria *imap.SearchCriteria) error {
+	if criteria.SeqNum != nil {
+		return fmt.Errorf("%w: sequence numbers", ErrUnsupportedCriteria)
+	}
+	if criteria.ModSeq != nil {
+		return fmt.Errorf("%w: MODSEQ", ErrUnsupportedCriteria)
+	}
+	for i := range criteria.Not {
+		if err := checkCriteria(&criteria.Not[i]); err != nil {
+			return err
+		}
+	}
+	for i := range criteria.Or {
+		for j := range criteria.Or[i] {
+			if err := checkCriteria(&criteria.Or[i][j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// document is an indexed message.
+type document struct {
+	flags        map[imap.Flag]struct{}
+	internalDate time.Time
+	size         int64
+	header       mail.Header
+
+	// Case-folded text matched by TEXT and BODY keys
+	headerText, bodyText string
+}
+
+func newDocument(msg *Message) *document {
+	doc := &document{
+		flags:        flagSet(msg.Flags),
+		internalDate: msg.InternalDate,
+		size:         msg.Size,
+	}
+	if doc.size == 0 {
+		doc.size = int64(len(msg.Literal))
+	}
+
+	br := bufio.NewReader(bytes.NewReader(msg.Literal))
+	rawHeader, _ := textproto.ReadHeader(br)
+	doc.header = mail.Header{Header: gomessage.Header{Header: rawHeader}}
+
+	var sb strings.Builder
+	fields := doc.header.Fields()
+	for fields.Next() {
+		v, err := fields.Text()
+		if err != nil {
+			v = fields.Value()
+		}
+		sb.WriteString(fields.Key() + ": " + v + "\n")
+	}
+	doc.headerText = foldText(sb.String())
+	doc.bodyText = foldText(bodyText(msg.Literal))
+	return doc
+}
+
+// bodyText returns the decoded text parts of a message. If the message can't
+// be parsed, the raw body is returned.
+func bodyText(literal []byte) string {
+	entity, err := gomessage.Read(bytes.NewReader(literal))
+	if err != nil && !gomessage.IsUnknownCharset(err) && !gomessage.IsUnknownEncoding(err) {
+		return rawBody(literal)
+	}
+
+	var sb strings.Builder
+	err = entity.Walk(func(path []int, part *gomessage.Entity, err error) error {
+		if err != nil {
+			return err
+		}
+		if part.MultipartReader() != nil {
+			return nil
+		}
+		mediaType, _, _ := part.Header.ContentType()
+		if mediaType != "" && !strings.HasPrefix(mediaType, "text/") {
+			return nil
+		}
+		if _, err := io.Copy(&sb, part.Body); err != nil {
+			return err
+		}
+		sb.WriteString("\n")
+		return nil
+	})
+	if err != nil {
+		return rawBody(literal)
+	}
+	return sb.String()
+}
+
+func rawBody(literal []byte) string {
+	if i := bytes.Index(literal, []byte("\r\n\r\n")); i >= 0 {
+		return string(literal[i+4:])
+	}
+	return ""
+}
+
+func flagSet(flags []imap.Flag) map[imap.Flag]struct{} {
+	set := make(map[imap.Flag]struct{}, len(flags))
+	for _, flag := range flags {
+		set[canonicalFlag(flag)] = struct{}{}
+	}
+	return set
+}
+
+func canonicalFlag(flag imap.Flag) imap.Flag {
+	return imap.Flag(strings.ToLower(string(flag)))
+}
+
+func foldText(s string) string {
+	return strings.ToLower(s)
+}
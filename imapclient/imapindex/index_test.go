@@ -0,0 +1,131 @@
+package imapindex_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient/imapindex"
+)
+
+var testMessages = []imapindex.Message{
+	{
+		UID:          1,
+		Flags:        []imap.Flag{imap.FlagSeen},
+		InternalDate: time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC),
+		Literal: []byte("From: Alice <alice@example.org>\r\n" +
+			"Subject: Quarterly report\r\n" +
+			"Date: Wed, 1 Mar 2023 10:00:00 +0000\r\n" +
+			"\r\n" +
+			"The numbers are in.\r\n"),
+	},
+	{
+		UID:          2,
+		InternalDate: time.Date(2023, 3, 2, 10, 0, 0, 0, time.UTC),
+		Literal: []byte("From: Bob <bob@example.org>\r\n" +
+			"Subject: =?utf-8?q?Caf=C3=A9?=\r\n" +
+			"Date: Thu, 2 Mar 2023 10:00:00 +0000\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n" +
+			"\r\n" +
+			"--b\r\n" +
+			"Content-Type: text/plain\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			"TWVldCBtZSBhdCBub29u\r\n" +
+			"--b\r\n" +
+			"Content-Type: application/octet-stream\r\n" +
+			"\r\n" +
+			"numbers\r\n" +
+			"--b--\r\n"),
+	},
+}
+
+func newTestIndex(t *testing.T) *imapindex.Index {
+	idx := imapindex.New()
+	for i := range testMessages {
+		if err := idx.Add(&testMessages[i]); err != nil {
+			t.Fatalf("Add() = %v", err)
+		}
+	}
+	return idx
+}
+
+func TestIndexSearch(t *testing.T) {
+	idx := newTestIndex(t)
+
+	tests := []struct {
+		name     string
+		criteria imap.SearchCriteria
+		want     []uint32
+	}{
+		{"all", imap.SearchCriteria{}, []uint32{1, 2}},
+		{"body", imap.SearchCriteria{Body: []string{"NUMBERS"}}, []uint32{1}},
+		{"body decoded", imap.SearchCriteria{Body: []string{"meet me"}}, []uint32{2}},
+		{"text header", imap.SearchCriteria{Text: []string{"quarterly"}}, []uint32{1}},
+		{"text short", imap.SearchCriteria{Text: []string{"in"}}, []uint32{1}},
+		{"header encoded word", imap.SearchCriteria{
+			Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "café"}},
+		}, []uint32{2}},
+		{"flag", imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}, []uint32{1}},
+		{"not flag", imap.SearchCriteria{NotFlag: []imap.Flag{imap.FlagSeen}}, []uint32{2}},
+		{"since", imap.SearchCriteria{Since: time.Date(2023, 3, 2, 0, 0, 0, 0, time.UTC)}, []uint32{2}},
+		{"sent before", imap.SearchCriteria{SentBefore: time.Date(2023, 3, 2, 0, 0, 0, 0, time.UTC)}, []uint32{1}},
+		{"uid star", imap.SearchCriteria{UID: imap.SeqSet{{Start: 0, Stop: 0}}}, []uint32{2}},
+		{"not", imap.SearchCriteria{Not: []imap.SearchCriteria{{Body: []string{"numbers"}}}}, []uint32{2}},
+		{"or", imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{
+			{Body: []string{"numbers"}},
+			{Text: []string{"bob@"}},
+		}}}, []uint32{1, 2}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			uids, err := idx.Search(&tc.criteria)
+			if err != nil {
+				t.Fatalf("Search() = %v", err)
+			}
+			if !reflect.DeepEqual(uids, tc.want) {
+				t.Errorf("Search() = %v, want %v", uids, tc.want)
+			}
+		})
+	}
+}
+
+func TestIndexUpdate(t *testing.T) {
+	idx := newTestIndex(t)
+
+	if !idx.SetFlags(2, []imap.Flag{imap.FlagSeen}) {
+		t.Fatalf("SetFlags() = false, want true")
+	}
+	idx.Remove(1)
+	if n := idx.Len(); n != 1 {
+		t.Errorf("Len() = %v, want 1", n)
+	}
+
+	criteria := imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}}
+	if uids, err := idx.Search(&criteria); err != nil {
+		t.Fatalf("Search() = %v", err)
+	} else if !reflect.DeepEqual(uids, []uint32{2}) {
+		t.Errorf("Search() = %v, want [2]", uids)
+	}
+
+	criteria = imap.SearchCriteria{Body: []string{"numbers"}}
+	if uids, err := idx.Search(&criteria); err != nil {
+		t.Fatalf("Search() = %v", err)
+	} else if len(uids) != 0 {
+		t.Errorf("Search() = %v, want none", uids)
+	}
+}
+
+func TestIndexSearchUnsupported(t *testing.T) {
+	idx := newTestIndex(t)
+
+	criteria := imap.SearchCriteria{
+		Not: []imap.SearchCriteria{{SeqNum: imap.SeqSet{{Start: 1, Stop: 1}}}},
+	}
+	if _, err := idx.Search(&criteria); !errors.Is(err, imapindex.ErrUnsupportedCriteria) {
+		t.Errorf("Search() = %v, want ErrUnsupportedCriteria", err)
+	}
+}
@@ -0,0 +1,129 @@
+package imapindex
+
+import (
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	gomessage "github.com/emersion/go-message"
+)
+
+var wordDecoder = mime.WordDecoder{CharsetReader: gomessage.CharsetReader}
+
+type matcher struct {
+	now     time.Time
+	lastUID uint32
+}
+
+func (m *matcher) match(doc *document, uid uint32, criteria *imap.SearchCriteria) bool {
+	if criteria.UID != nil && !m.containsUID(criteria.UID, uid) {
+		return false
+	}
+	if !matchDate(doc.internalDate, criteria.Since, criteria.Before) {
+		return false
+	}
+	if criteria.Older != 0 && doc.internalDate.After(m.now.Add(-criteria.Older)) {
+		return false
+	}
+	if criteria.Younger != 0 && !doc.internalDate.After(m.now.Add(-criteria.Younger)) {
+		return false
+	}
+
+	for _, flag := range criteria.Flag {
+		if _, ok := doc.flags[canonicalFlag(flag)]; !ok {
+			return false
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if _, ok := doc.flags[canonicalFlag(flag)]; ok {
+			return false
+		}
+	}
+
+	if criteria.Larger != 0 && doc.size <= criteria.Larger {
+		return false
+	}
+	if criteria.Smaller != 0 && doc.size >= criteria.Smaller {
+		return false
+	}
+
+	for _, fieldCriteria := range criteria.Header {
+		if !doc.header.Has(fieldCriteria.Key) {
+			return false
+		}
+		if fieldCriteria.Value == "" {
+			continue
+		}
+		found := false
+		for _, v := range doc.header.Values(fieldCriteria.Key) {
+			if text, err := wordDecoder.DecodeHeader(v); err == nil {
+				v = text
+			}
+			found = containsFold(v, fieldCriteria.Value)
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !criteria.SentSince.IsZero() || !criteria.SentBefore.IsZero() {
+		t, err := doc.header.Date()
+		if err != nil {
+			return false
+		} else if !matchDate(t, criteria.SentSince, criteria.SentBefore) {
+			return false
+		}
+	}
+
+	for _, pattern := range criteria.Body {
+		if !strings.Contains(doc.bodyText, foldText(pattern)) {
+			return false
+		}
+	}
+	for _, pattern := range criteria.Text {
+		pattern = foldText(pattern)
+		if !strings.Contains(doc.headerText, pattern) && !strings.Contains(doc.bodyText, pattern) {
+			return false
+		}
+	}
+
+	for i := range criteria.Not {
+		if m.match(doc, uid, &criteria.Not[i]) {
+			return false
+		}
+	}
+	for i := range criteria.Or {
+		if !m.match(doc, uid, &criteria.Or[i][0]) && !m.match(doc, uid, &criteria.Or[i][1]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// containsUID checks whether a UID set contains a UID, with "*" standing for
+// the largest UID in the index.
+func (m *matcher) containsUID(set imap.SeqSet, uid uint32) bool {
+	return set.Contains(uid) || (uid == m.lastUID && set.Dynamic())
+}
+
+func matchDate(t, since, before time.Time) bool {
+	// Only the date is compared, the time zone is ignored
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	if !since.IsZero() && t.Before(since) {
+		return false
+	}
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(foldText(s), foldText(substr))
+}
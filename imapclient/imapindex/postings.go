@@ -0,0 +1,71 @@
+package imapindex
+
+// postings maps trigrams to the UIDs of the messages containing them.
+type postings map[string]map[uint32]struct{}
+
+func (p postings) add(uid uint32, text string) {
+	for tri := range trigrams(text) {
+		set := p[tri]
+		if set == nil {
+			set = make(map[uint32]struct{})
+			p[tri] = set
+		}
+		set[uid] = struct{}{}
+	}
+}
+
+func (p postings) remove(uid uint32, text string) {
+	for tri := range trigrams(text) {
+		set := p[tri]
+		delete(set, uid)
+		if len(set) == 0 {
+			delete(p, tri)
+		}
+	}
+}
+
+// lookup returns the messages which may contain the pattern. It returns
+// false if the pattern is too short to be looked up.
+//
+// The returned set belongs to the caller.
+func (p postings) lookup(pattern string) (map[uint32]struct{}, bool) {
+	tris := trigrams(foldText(pattern))
+	if len(tris) == 0 {
+		return nil, false
+	}
+
+	// Start from the rarest trigram
+	var smallest map[uint32]struct{}
+	for tri := range tris {
+		set := p[tri]
+		if smallest == nil || len(set) < len(smallest) {
+			smallest = set
+		}
+		if len(set) == 0 {
+			return make(map[uint32]struct{}), true
+		}
+	}
+
+	out := make(map[uint32]struct{}, len(smallest))
+	for uid := range smallest {
+		out[uid] = struct{}{}
+	}
+	for tri := range tris {
+		for uid := range out {
+			if _, ok := p[tri][uid]; !ok {
+				delete(out, uid)
+			}
+		}
+	}
+	return out, true
+}
+
+// trigrams returns the set of sequences of three runes in s.
+func trigrams(s string) map[string]struct{} {
+	runes := []rune(s)
+	set := make(map[string]struct{})
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = struct{}{}
+	}
+	return set
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
+	"github.com/emersion/go-imap/v2/internal/utf7"
 )
 
 func getSelectOpts(options *imap.ListOptions) []string {
@@ -58,6 +59,9 @@ func getReturnOpts(options *imap.ListOptions) []string {
 func (c *Client) List(ref, pattern string, options *imap.ListOptions) *ListCommand {
 	cmd := &ListCommand{
 		mailboxes:    make(chan *imap.ListData, 64),
+		ref:          ref,
+		pattern:      pattern,
+		handled:      make(map[string]struct{}),
 		returnStatus: options != nil && len(options.ReturnStatus) > 0,
 	}
 	enc := c.beginCommand("LIST", cmd)
@@ -66,7 +70,13 @@ func (c *Client) List(ref, pattern string, options *imap.ListOptions) *ListComma
 			enc.Atom(selectOpts[i])
 		})
 	}
-	enc.SP().Mailbox(ref).SP().String(pattern)
+	enc.SP().Mailbox(ref).SP()
+	// Patterns are sent verbatim, unless modified UTF-7 has been forced
+	if c.options.MailboxNameEncoding == MailboxNameEncodingUTF7 {
+		enc.Mailbox(pattern)
+	} else {
+		enc.String(pattern)
+	}
 	if returnOpts := getReturnOpts(options); len(returnOpts) > 0 {
 		enc.SP().Atom("RETURN").SP().List(len(returnOpts), func(i int) {
 			opt := returnOpts[i]
@@ -91,15 +101,19 @@ func (c *Client) handleList() error {
 	cmd := c.findPendingCmdFunc(func(cmd command) bool {
 		switch cmd := cmd.(type) {
 		case *ListCommand:
-			return true // TODO: match pattern, check if already handled
+			// OLDNAME is only sent for renamed mailboxes
+			return data.OldName == "" && cmd.matches(data)
 		case *SelectCommand:
 			return cmd.mailbox == data.Mailbox && cmd.data.List == nil
+		case *renameCommand:
+			return data.OldName != ""
 		default:
 			return false
 		}
 	})
 	switch cmd := cmd.(type) {
 	case *ListCommand:
+		cmd.handled[data.Mailbox] = struct{}{}
 		if cmd.returnStatus {
 			if cmd.pendingData != nil {
 				cmd.mailboxes <- cmd.pendingData
@@ -110,6 +124,15 @@ func (c *Client) handleList() error {
 		}
 	case *SelectCommand:
 		cmd.data.List = data
+	case *renameCommand:
+		cmd.renamed = append(cmd.renamed, data)
+		if handler := c.options.unilateralDataHandler().List; handler != nil {
+			handler(data)
+		}
+	default:
+		if handler := c.options.unilateralDataHandler().List; handler != nil {
+			handler(data)
+		}
 	}
 
 	return nil
@@ -120,15 +143,50 @@ type ListCommand struct {
 	cmd
 	mailboxes chan *imap.ListData
 
+	ref, pattern string
+	handled      map[string]struct{}
+
 	returnStatus bool
 	pendingData  *imap.ListData
 }
 
+// matches checks whether LIST data belongs to the results of the command:
+// the mailbox must match the pattern and must not have been returned yet.
+func (cmd *ListCommand) matches(data *imap.ListData) bool {
+	if _, ok := cmd.handled[data.Mailbox]; ok {
+		return false
+	}
+	if cmd.pattern == "" {
+		// The server returns the hierarchy delimiter and root name
+		return true
+	}
+
+	// INBOX is case-insensitive
+	ref, pattern := cmd.ref, cmd.pattern
+	if ref == "" && len(pattern) >= 5 && strings.EqualFold(pattern[:5], "INBOX") {
+		pattern = "INBOX" + pattern[5:]
+	}
+
+	// The pattern may be sent verbatim, so match both the decoded and the
+	// modified UTF-7 mailbox names
+	names := []string{data.Mailbox}
+	if encoded, err := utf7.Encoding.NewEncoder().String(data.Mailbox); err == nil && encoded != data.Mailbox {
+		names = append(names, encoded)
+	}
+	for _, name := range names {
+		if internal.MatchList(name, data.Delim, ref, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
 // Next advances to the next mailbox.
 //
 // On success, the mailbox LIST data is returned. On error or if there are no
 // more mailboxes, nil is returned.
 func (cmd *ListCommand) Next() *imap.ListData {
+	cmd.flusher.Flush()
 	return <-cmd.mailboxes
 }
 
@@ -206,7 +264,7 @@ func readList(dec *imapwire.Decoder) (*imap.ListData, error) {
 				}
 			default:
 				if !dec.DiscardValue() {
-					return fmt.Errorf("in tagged-ext-val: %v", err)
+					return fmt.Errorf("in tagged-ext-val: %v", dec.Err())
 				}
 			}
 			return nil
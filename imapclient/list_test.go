@@ -0,0 +1,136 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestListPatternEncoding(t *testing.T) {
+	tests := []struct {
+		encoding imapclient.MailboxNameEncoding
+		command  string
+	}{
+		{imapclient.MailboxNameEncodingAuto, `T1 LIST "" "A&B/*"`},
+		{imapclient.MailboxNameEncodingRaw, `T1 LIST "" "A&B/*"`},
+		{imapclient.MailboxNameEncodingUTF7, `T1 LIST "" "A&-B/*"`},
+	}
+	for _, tc := range tests {
+		fixture := &corpusFixture{
+			greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+			exchanges: []corpusExchange{
+				{command: tc.command, responses: []string{"T1 OK LIST completed"}},
+			},
+		}
+
+		clientConn, serverConn := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- fixture.serve(serverConn)
+		}()
+		c := imapclient.New(clientConn, &imapclient.Options{MailboxNameEncoding: tc.encoding})
+		if _, err := c.List("", "A&B/*", nil).Collect(); err != nil {
+			t.Errorf("List() with encoding %v = %v", tc.encoding, err)
+		}
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript with encoding %v: %v", tc.encoding, err)
+		}
+	}
+}
+
+func TestListUnsolicited(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		responses  []string
+		want       []string
+		unilateral []string
+	}{
+		{
+			pattern:   "*",
+			responses: []string{`* LIST () "/" INBOX`, `* LIST () "/" Archive/2023`},
+			want:      []string{"INBOX", "Archive/2023"},
+		},
+		{
+			pattern:    "%",
+			responses:  []string{`* LIST () "/" INBOX`, `* LIST () "/" Archive/2023`},
+			want:       []string{"INBOX"},
+			unilateral: []string{"Archive/2023"},
+		},
+		{
+			pattern:    "Archive/*",
+			responses:  []string{`* LIST () "/" Archive/2023`, `* LIST () "/" Archive/2023`, `* LIST () "/" Sent`},
+			want:       []string{"Archive/2023"},
+			unilateral: []string{"Archive/2023", "Sent"},
+		},
+		{
+			pattern:   "inbox",
+			responses: []string{`* LIST () "/" INBOX`},
+			want:      []string{"INBOX"},
+		},
+		{
+			pattern:   "Entw&APw-rfe",
+			responses: []string{`* LIST () "/" "Entw&APw-rfe"`},
+			want:      []string{"Entwürfe"},
+		},
+		{
+			pattern:   "",
+			responses: []string{`* LIST (\Noselect) "/" ""`},
+			want:      []string{""},
+		},
+	}
+	for _, tc := range tests {
+		fixture := &corpusFixture{
+			greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+			exchanges: []corpusExchange{
+				{
+					command:   `T1 LIST "" "` + tc.pattern + `"`,
+					responses: append(tc.responses, "T1 OK LIST completed"),
+				},
+			},
+		}
+
+		var (
+			mutex      sync.Mutex
+			unilateral []string
+		)
+		clientConn, serverConn := net.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			done <- fixture.serve(serverConn)
+		}()
+		c := imapclient.New(clientConn, &imapclient.Options{
+			UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+				List: func(data *imap.ListData) {
+					mutex.Lock()
+					unilateral = append(unilateral, data.Mailbox)
+					mutex.Unlock()
+				},
+			},
+		})
+		mailboxes, err := c.List("", tc.pattern, nil).Collect()
+		if err != nil {
+			t.Errorf("List(%q) = %v", tc.pattern, err)
+		}
+		var got []string
+		for _, data := range mailboxes {
+			got = append(got, data.Mailbox)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("List(%q) = %q, want %q", tc.pattern, got, tc.want)
+		}
+		mutex.Lock()
+		if !reflect.DeepEqual(unilateral, tc.unilateral) {
+			t.Errorf("List(%q): unilateral data = %q, want %q", tc.pattern, unilateral, tc.unilateral)
+		}
+		mutex.Unlock()
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript for pattern %q: %v", tc.pattern, err)
+		}
+	}
+}
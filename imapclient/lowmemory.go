@@ -0,0 +1,39 @@
+package imapclient
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	// Size of the bufio.Reader and bufio.Writer in low-memory mode
+	lowMemoryBufferSize = 512
+
+	// Number of messages or expunged sequence numbers queued for a command
+	// before the decoder blocks
+	defaultQueueSize   = 128
+	lowMemoryQueueSize = 0
+)
+
+func (options *Options) newBufioReader(r io.Reader) *bufio.Reader {
+	if options.LowMemory {
+		return bufio.NewReaderSize(r, lowMemoryBufferSize)
+	}
+	return bufio.NewReader(r)
+}
+
+func (options *Options) newBufioWriter(w io.Writer) *bufio.Writer {
+	if options.LowMemory {
+		return bufio.NewWriterSize(w, lowMemoryBufferSize)
+	}
+	return bufio.NewWriter(w)
+}
+
+// queueSize returns the capacity of the channels used to stream FETCH and
+// EXPUNGE responses to commands.
+func (options *Options) queueSize() int {
+	if options.LowMemory {
+		return lowMemoryQueueSize
+	}
+	return defaultQueueSize
+}
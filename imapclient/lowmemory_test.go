@@ -0,0 +1,134 @@
+package imapclient
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestLowMemoryQueueSizes(t *testing.T) {
+	tests := []struct {
+		lowMemory  bool
+		bufferSize int
+		queueSize  int
+	}{
+		{lowMemory: false, bufferSize: 4096, queueSize: defaultQueueSize},
+		{lowMemory: true, bufferSize: lowMemoryBufferSize, queueSize: lowMemoryQueueSize},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(fmt.Sprintf("%v", tc.lowMemory), func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			go func() {
+				io.WriteString(serverConn, "* OK [CAPABILITY IMAP4rev1] ready\r\n")
+				io.Copy(io.Discard, serverConn)
+			}()
+			defer serverConn.Close()
+
+			c := New(clientConn, &Options{LowMemory: tc.lowMemory})
+			defer c.Close()
+
+			if size := c.br.Size(); size != tc.bufferSize {
+				t.Errorf("read buffer size = %v, want %v", size, tc.bufferSize)
+			}
+			if size := c.bw.Size(); size != tc.bufferSize {
+				t.Errorf("write buffer size = %v, want %v", size, tc.bufferSize)
+			}
+
+			fetchCmd := c.Fetch(imap.SeqSetNum(1), []imap.FetchItem{imap.FetchItemFlags})
+			if n := cap(fetchCmd.msgs); n != tc.queueSize {
+				t.Errorf("FETCH queue size = %v, want %v", n, tc.queueSize)
+			}
+			storeCmd := c.Store(imap.SeqSetNum(1), &imap.StoreFlags{
+				Op:    imap.StoreFlagsAdd,
+				Flags: []imap.Flag{imap.FlagSeen},
+			})
+			if n := cap(storeCmd.msgs); n != tc.queueSize {
+				t.Errorf("STORE queue size = %v, want %v", n, tc.queueSize)
+			}
+			expungeCmd := c.Expunge()
+			if n := cap(expungeCmd.seqNums); n != tc.queueSize {
+				t.Errorf("EXPUNGE queue size = %v, want %v", n, tc.queueSize)
+			}
+		})
+	}
+}
+
+func TestLowMemoryStreaming(t *testing.T) {
+	const numMessages = 3
+
+	clientConn, serverConn := net.Pipe()
+	var sent [numMessages]chan struct{}
+	for i := range sent {
+		sent[i] = make(chan struct{})
+	}
+	done := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		if _, err := io.WriteString(serverConn, "* OK [CAPABILITY IMAP4rev1] ready\r\n"); err != nil {
+			done <- err
+			return
+		}
+		buf := make([]byte, 4096)
+		if _, err := serverConn.Read(buf); err != nil {
+			done <- err
+			return
+		}
+		// Each response is sent with a separate write, which only returns
+		// once the client has read it
+		for i := range sent {
+			resp := fmt.Sprintf("* %v FETCH (UID %v FLAGS (\\Seen))\r\n", i+1, i+1)
+			if _, err := io.WriteString(serverConn, resp); err != nil {
+				done <- err
+				return
+			}
+			close(sent[i])
+		}
+		_, err := io.WriteString(serverConn, "T1 OK FETCH completed\r\n")
+		done <- err
+	}()
+
+	c := New(clientConn, &Options{LowMemory: true})
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("server: %v", err)
+		}
+	}()
+
+	fetchCmd := c.Fetch(imap.SeqSetNum(1, 2, 3), []imap.FetchItem{imap.FetchItemUID, imap.FetchItemFlags})
+	defer fetchCmd.Close()
+
+	for i := 0; i < numMessages; i++ {
+		msg := fetchCmd.Next()
+		if msg == nil {
+			t.Fatalf("FetchCommand.Next() = nil, want message %v", i+1)
+		}
+		buf, err := msg.Collect()
+		if err != nil {
+			t.Fatalf("FetchMessageData.Collect() = %v", err)
+		} else if buf.UID != uint32(i+1) {
+			t.Errorf("UID = %v, want %v", buf.UID, i+1)
+		}
+
+		// The decoder holds at most one message which hasn't been
+		// consumed, so it doesn't read the response after it
+		if i+2 < numMessages {
+			select {
+			case <-sent[i+2]:
+				t.Errorf("response %v read before message %v was consumed", i+3, i+2)
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+	if msg := fetchCmd.Next(); msg != nil {
+		t.Errorf("FetchCommand.Next() = %v, want nil", msg)
+	}
+	if err := fetchCmd.Close(); err != nil {
+		t.Errorf("FetchCommand.Close() = %v", err)
+	}
+}
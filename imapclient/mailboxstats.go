@@ -0,0 +1,156 @@
+package imapclient
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const (
+	defaultMailboxStatsMaxFetch   = 10000
+	defaultMailboxStatsSampleSize = 1000
+	defaultMailboxStatsNumLargest = 10
+)
+
+// MailboxStatsOptions contains options for Client.MailboxStats.
+type MailboxStatsOptions struct {
+	// Flags to count messages for, defaults to the system flags
+	Flags []imap.Flag
+	// Maximum number of messages for which sizes are fetched exhaustively,
+	// defaults to 10000. Larger mailboxes are sampled.
+	MaxFetch uint32
+	// Number of messages sampled in large mailboxes, defaults to 1000
+	SampleSize uint32
+	// Number of largest messages to return, defaults to 10
+	NumLargest int
+}
+
+// MailboxStats contains statistics about a mailbox.
+type MailboxStats struct {
+	NumMessages uint32
+	// Number of messages with each flag set
+	NumFlag map[imap.Flag]uint32
+	// Total size of all messages, in bytes
+	TotalSize int64
+	// Largest messages, sorted by decreasing size
+	Largest []MailboxStatsMessage
+	// Earliest and latest internal dates. When Estimated is set, these are
+	// computed from the sample, which always includes the first and last
+	// messages.
+	Oldest, Newest time.Time
+	// Indicates that TotalSize and Largest have been computed from a sample
+	// of the messages
+	Estimated bool
+}
+
+// MailboxStatsMessage describes a message returned in MailboxStats.
+type MailboxStatsMessage struct {
+	UID  uint32
+	Size int64
+}
+
+// MailboxStats computes statistics about the currently selected mailbox.
+//
+// Flag counts use SEARCH RETURN (COUNT) if the server supports ESEARCH.
+// Sizes are fetched with RFC822.SIZE. STATUS SIZE isn't used because STATUS
+// should not be sent for the selected mailbox.
+func (c *Client) MailboxStats(options *MailboxStatsOptions) (*MailboxStats, error) {
+	if options == nil {
+		options = new(MailboxStatsOptions)
+	}
+	flags := options.Flags
+	if flags == nil {
+		flags = []imap.Flag{imap.FlagSeen, imap.FlagAnswered, imap.FlagFlagged, imap.FlagDeleted, imap.FlagDraft}
+	}
+	maxFetch := options.MaxFetch
+	if maxFetch == 0 {
+		maxFetch = defaultMailboxStatsMaxFetch
+	}
+	sampleSize := options.SampleSize
+	if sampleSize == 0 {
+		sampleSize = defaultMailboxStatsSampleSize
+	}
+	numLargest := options.NumLargest
+	if numLargest == 0 {
+		numLargest = defaultMailboxStatsNumLargest
+	}
+
+	mailbox := c.Mailbox()
+	if mailbox == nil {
+		return nil, fmt.Errorf("imapclient: mailbox statistics require a selected mailbox")
+	}
+	stats := &MailboxStats{
+		NumMessages: mailbox.NumMessages,
+		NumFlag:     make(map[imap.Flag]uint32),
+	}
+	if stats.NumMessages == 0 {
+		return stats, nil
+	}
+
+	var searchOptions *imap.SearchOptions
+	if c.Caps().Has(imap.CapESearch) {
+		searchOptions = &imap.SearchOptions{Return: []imap.SearchReturnOption{imap.SearchReturnCount}}
+	}
+	for _, flag := range flags {
+		data, err := c.Search(&imap.SearchCriteria{Flag: []imap.Flag{flag}}, searchOptions).Wait()
+		if err != nil {
+			return nil, err
+		}
+		if searchOptions != nil {
+			stats.NumFlag[flag] = data.Count
+		} else {
+			stats.NumFlag[flag] = uint32(len(data.AllNums()))
+		}
+	}
+
+	var seqSet imap.SeqSet
+	if stats.NumMessages <= maxFetch {
+		seqSet = imap.SeqSetRange(1, stats.NumMessages)
+	} else {
+		stats.Estimated = true
+		step := stats.NumMessages / sampleSize
+		for i := uint32(0); i < sampleSize; i++ {
+			seqSet.AddNum(1 + i*step)
+		}
+	}
+	// Always include the first and last messages for the dates
+	seqSet.AddNum(1, stats.NumMessages)
+
+	msgs, err := c.Fetch(seqSet, []imap.FetchItem{
+		imap.FetchItemUID,
+		imap.FetchItemRFC822Size,
+		imap.FetchItemInternalDate,
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	var sampled []MailboxStatsMessage
+	for _, msg := range msgs {
+		if !msg.InternalDate.IsZero() {
+			if stats.Oldest.IsZero() || msg.InternalDate.Before(stats.Oldest) {
+				stats.Oldest = msg.InternalDate
+			}
+			if msg.InternalDate.After(stats.Newest) {
+				stats.Newest = msg.InternalDate
+			}
+		}
+		stats.TotalSize += msg.RFC822Size
+		sampled = append(sampled, MailboxStatsMessage{UID: msg.UID, Size: msg.RFC822Size})
+	}
+	if stats.Estimated && len(sampled) > 0 {
+		stats.TotalSize = stats.TotalSize * int64(stats.NumMessages) / int64(len(sampled))
+	}
+
+	sort.Slice(sampled, func(i, j int) bool {
+		return sampled[i].Size > sampled[j].Size
+	})
+	if len(sampled) > numLargest {
+		sampled = sampled[:numLargest]
+	}
+	stats.Largest = sampled
+
+	return stats, nil
+}
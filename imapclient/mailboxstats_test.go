@@ -0,0 +1,50 @@
+package imapclient_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestMailboxStatsDates(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	// Messages aren't necessarily appended in chronological order, e.g.
+	// when importing
+	dates := []time.Time{
+		time.Date(2023, 3, 2, 10, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 1, 10, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 4, 10, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 3, 10, 0, 0, 0, time.UTC),
+	}
+	msg := "Subject: Hello\r\n\r\nHi\r\n"
+	for _, date := range dates {
+		appendCmd := c.Append("INBOX", int64(len(msg)), &imap.AppendOptions{Time: date})
+		appendCmd.Write([]byte(msg))
+		appendCmd.Close()
+		if _, err := appendCmd.Wait(); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	stats, err := c.MailboxStats(nil)
+	if err != nil {
+		t.Fatalf("MailboxStats() = %v", err)
+	}
+	if stats.NumMessages != 4 || stats.TotalSize != 4*int64(len(msg)) || stats.Estimated {
+		t.Errorf("MailboxStats() = %+v", stats)
+	}
+	if want := dates[1]; !stats.Oldest.Equal(want) {
+		t.Errorf("Oldest = %v, want %v", stats.Oldest, want)
+	}
+	if want := dates[2]; !stats.Newest.Equal(want) {
+		t.Errorf("Newest = %v, want %v", stats.Newest, want)
+	}
+}
@@ -0,0 +1,70 @@
+package imapclient
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// ErrMDNSentUnsupported is returned by Client.ClaimMDN when the selected
+// mailbox can't store the $MDNSent keyword permanently.
+//
+// As per RFC 3503 section 3.1, clients should then not send message
+// disposition notifications automatically, because other clients wouldn't
+// know they have been sent.
+var ErrMDNSentUnsupported = errors.New("imapclient: mailbox doesn't support the $MDNSent keyword")
+
+// HasMDNSent returns true if the flags contain the $MDNSent keyword, in which
+// case a message disposition notification must not be sent for the message.
+func HasMDNSent(flags []imap.Flag) bool {
+	for _, flag := range flags {
+		if strings.EqualFold(string(flag), string(imap.FlagMDNSent)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimMDN sets the $MDNSent keyword on messages of the selected mailbox, and
+// returns the UIDs of the messages for which the caller is responsible for
+// sending a message disposition notification: the ones which didn't have the
+// keyword yet.
+//
+// This ensures a notification is sent at most once per message, as long as
+// the caller only sends notifications for the returned UIDs. The keyword is
+// set before the notification is sent, so a notification may be lost if the
+// caller fails to send it.
+func (c *Client) ClaimMDN(uids imap.UIDSet) (imap.UIDSet, error) {
+	mbox := c.Mailbox()
+	if mbox == nil {
+		return nil, errors.New("imapclient: no mailbox selected")
+	} else if mbox.PermanentFlags != nil && !isPermanentFlag(mbox.PermanentFlags, imap.FlagMDNSent) {
+		return nil, ErrMDNSentUnsupported
+	}
+
+	msgs, err := c.UIDFetch(uids, []imap.FetchItem{imap.FetchItemUID, imap.FetchItemFlags}).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending imap.UIDSet
+	for _, msg := range msgs {
+		if msg.UID != 0 && !HasMDNSent(msg.Flags) {
+			pending.AddNum(msg.UID)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	err = c.UIDStore(pending, &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagMDNSent},
+	}).Close()
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
@@ -0,0 +1,107 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestHasMDNSent(t *testing.T) {
+	tests := []struct {
+		flags []imap.Flag
+		want  bool
+	}{
+		{flags: nil, want: false},
+		{flags: []imap.Flag{imap.FlagSeen, "$Forwarded"}, want: false},
+		{flags: []imap.Flag{imap.FlagSeen, imap.FlagMDNSent}, want: true},
+		{flags: []imap.Flag{"$mdnsent"}, want: true},
+	}
+	for _, tc := range tests {
+		if got := imapclient.HasMDNSent(tc.flags); got != tc.want {
+			t.Errorf("HasMDNSent(%v) = %v, want %v", tc.flags, got, tc.want)
+		}
+	}
+}
+
+func TestClaimMDN(t *testing.T) {
+	tests := []struct {
+		name           string
+		permanentFlags string
+		exchanges      []corpusExchange
+		want           imap.UIDSet
+		wantErr        error
+	}{
+		{
+			name:           "wildcard",
+			permanentFlags: `(\Seen \*)`,
+			exchanges: []corpusExchange{
+				{command: "T2 UID FETCH 1:3 (UID FLAGS)", responses: []string{
+					"* 1 FETCH (UID 1 FLAGS (\\Seen))",
+					"* 2 FETCH (UID 2 FLAGS ($MDNSent))",
+					"* 3 FETCH (UID 3 FLAGS ())",
+					"T2 OK FETCH completed",
+				}},
+				{command: "T3 UID STORE 1,3 +FLAGS.SILENT ($MDNSent)", responses: []string{"T3 OK STORE completed"}},
+			},
+			want: imap.UIDSetNum(1, 3),
+		},
+		{
+			name:           "explicit keyword",
+			permanentFlags: `(\Seen $MDNSent)`,
+			exchanges: []corpusExchange{
+				{command: "T2 UID FETCH 1:3 (UID FLAGS)", responses: []string{
+					"* 1 FETCH (UID 1 FLAGS ($MDNSent))",
+					"T2 OK FETCH completed",
+				}},
+			},
+		},
+		{
+			name:           "unsupported",
+			permanentFlags: `(\Seen \Deleted)`,
+			wantErr:        imapclient.ErrMDNSentUnsupported,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := &corpusFixture{
+				greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+				exchanges: append([]corpusExchange{
+					{command: "T1 SELECT INBOX", responses: []string{
+						"* 3 EXISTS",
+						"* OK [UIDVALIDITY 1] UIDs valid",
+						"* OK [PERMANENTFLAGS " + tc.permanentFlags + "] Limited",
+						"T1 OK [READ-WRITE] SELECT completed",
+					}},
+				}, tc.exchanges...),
+			}
+
+			clientConn, serverConn := net.Pipe()
+			done := make(chan error, 1)
+			go func() {
+				done <- fixture.serve(serverConn)
+			}()
+			c := imapclient.New(clientConn, nil)
+			defer func() {
+				c.Close()
+				if err := <-done; err != nil {
+					t.Errorf("transcript: %v", err)
+				}
+			}()
+
+			if _, err := c.Select("INBOX").Wait(); err != nil {
+				t.Fatalf("Select() = %v", err)
+			}
+			uids, err := c.ClaimMDN(imap.UIDSetNum(1, 2, 3))
+			if err != tc.wantErr {
+				t.Fatalf("ClaimMDN() = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(uids, tc.want) {
+				t.Errorf("ClaimMDN() = %v, want %v", uids, tc.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/emersion/go-imap/v2"
 )
 
-func (c *Client) move(uid bool, seqSet imap.SeqSet, mailbox string) *MoveCommand {
+func (c *Client) move(uid bool, numSet imap.NumSet, mailbox string) *MoveCommand {
 	// If the server doesn't support MOVE, fallback to [UID] COPY,
 	// [UID] STORE +FLAGS.SILENT \Deleted and [UID] EXPUNGE
 	cmdName := "MOVE"
@@ -12,19 +12,27 @@ func (c *Client) move(uid bool, seqSet imap.SeqSet, mailbox string) *MoveCommand
 		cmdName = "COPY"
 	}
 
-	cmd := &MoveCommand{}
-	enc := c.beginCommand(uidCmdName(cmdName, uid), cmd)
-	enc.SP().Atom(seqSet.String()).SP().Mailbox(mailbox)
+	cmd := &MoveCommand{uid: uid, numSet: numSet}
+	if cmdName == "MOVE" {
+		// The fallback can't be retried: messages are flagged as deleted and
+		// expunged even if COPY fails
+		cmd.retry = c.newTryCreateRetry(mailbox)
+	}
+	c.statusCache.invalidate(mailbox)
+	arg, err := numSetArg(numSet)
+	enc := c.beginFailedCommand(uidCmdName(cmdName, uid), cmd, err)
+	enc.SP().Atom(arg).SP().Mailbox(mailbox)
 	enc.end()
 
-	if cmdName == "COPY" {
-		cmd.store = c.store(uid, seqSet, &imap.StoreFlags{
+	// The fallback must not expunge messages if COPY has failed early
+	if cmdName == "COPY" && err == nil {
+		cmd.store = c.store(uid, numSet, &imap.StoreFlags{
 			Op:     imap.StoreFlagsAdd,
 			Silent: true,
 			Flags:  []imap.Flag{imap.FlagDeleted},
-		})
+		}, nil)
 		if uid && c.Caps().Has(imap.CapUIDPlus) {
-			cmd.expunge = c.UIDExpunge(seqSet)
+			cmd.expunge = c.UIDExpunge(numSet)
 		} else {
 			cmd.expunge = c.Expunge()
 		}
@@ -37,15 +45,17 @@ func (c *Client) move(uid bool, seqSet imap.SeqSet, mailbox string) *MoveCommand
 //
 // If the server doesn't support IMAP4rev2 nor the MOVE extension, a fallback
 // with COPY + STORE + EXPUNGE commands is used.
-func (c *Client) Move(seqSet imap.SeqSet, mailbox string) *MoveCommand {
-	return c.move(false, seqSet, mailbox)
+//
+// If numSet is an imap.UIDSet, a UID MOVE command is sent.
+func (c *Client) Move(numSet imap.NumSet, mailbox string) *MoveCommand {
+	return c.move(isUIDSet(numSet), numSet, mailbox)
 }
 
-// UIDMove sends a UID MOVE command.
+// UIDMove sends a UID MOVE command. A SeqSet is interpreted as a set of UIDs.
 //
 // See Move.
-func (c *Client) UIDMove(seqSet imap.SeqSet, mailbox string) *MoveCommand {
-	return c.move(true, seqSet, mailbox)
+func (c *Client) UIDMove(numSet imap.NumSet, mailbox string) *MoveCommand {
+	return c.move(true, numSet, mailbox)
 }
 
 // MoveCommand is a MOVE command.
@@ -53,6 +63,10 @@ type MoveCommand struct {
 	cmd
 	data MoveData
 
+	uid    bool
+	numSet imap.NumSet
+	retry  *tryCreateRetry
+
 	// Fallback
 	store   *FetchCommand
 	expunge *ExpungeCommand
@@ -60,6 +74,13 @@ type MoveCommand struct {
 
 func (cmd *MoveCommand) Wait() (*MoveData, error) {
 	if err := cmd.cmd.Wait(); err != nil {
+		if ok, createErr := cmd.retry.create(err); createErr != nil {
+			return nil, createErr
+		} else if ok {
+			retryCmd := cmd.retry.client.move(cmd.uid, cmd.numSet, cmd.retry.mailbox)
+			retryCmd.retry = nil
+			return retryCmd.Wait()
+		}
 		return nil, err
 	}
 	if cmd.store != nil {
@@ -0,0 +1,38 @@
+package imapclient_test
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestNilNumSet(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	if _, err := c.Fetch(nil, []imap.FetchItem{imap.FetchItemFlags}).Collect(); err == nil {
+		t.Errorf("Fetch(nil) succeeded")
+	}
+	if err := c.Store(nil, &imap.StoreFlags{Op: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagSeen}}).Close(); err == nil {
+		t.Errorf("Store(nil) succeeded")
+	}
+	if _, err := c.Copy(nil, "INBOX").Wait(); err == nil {
+		t.Errorf("Copy(nil) succeeded")
+	}
+	if _, err := c.Move(nil, "INBOX").Wait(); err == nil {
+		t.Errorf("Move(nil) succeeded")
+	}
+	if err := c.UIDExpunge(nil).Close(); err == nil {
+		t.Errorf("UIDExpunge(nil) succeeded")
+	}
+
+	// Nothing has been sent to the server
+	if err := c.Noop().Wait(); err != nil {
+		t.Errorf("Noop() = %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package imapclient
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// probedCommands lists the optional commands affected by
+// Options.ProbeExtensions. Some servers advertise these extensions but reply
+// BAD because they don't implement them, or because of parser bugs.
+var probedCommands = map[string]struct{}{
+	"ID":     {},
+	"ENABLE": {},
+}
+
+// Quirks describes the server bugs detected by the client.
+type Quirks struct {
+	// Optional commands which failed with a BAD response while
+	// Options.ProbeExtensions was set, indexed by command name
+	BadCommands map[string]*imap.Error
+}
+
+// Quirks returns the server bugs detected so far.
+func (c *Client) Quirks() *Quirks {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	quirks := &Quirks{BadCommands: make(map[string]*imap.Error, len(c.badCommands))}
+	for name, err := range c.badCommands {
+		quirks.BadCommands[name] = err
+	}
+	return quirks
+}
+
+// softenCommandError turns a BAD response to a probed command into a soft
+// failure, and remembers it.
+func (c *Client) softenCommandError(cmd command, err error) error {
+	name := cmd.base().name
+	if _, ok := probedCommands[name]; !ok || !c.options.ProbeExtensions {
+		return err
+	}
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBad {
+		return err
+	}
+
+	c.mutex.Lock()
+	if c.badCommands == nil {
+		c.badCommands = make(map[string]*imap.Error)
+	}
+	c.badCommands[name] = imapErr
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// isBadCommand returns true if the command has previously been rejected by
+// the server with a BAD response. Such commands aren't sent again.
+func (c *Client) isBadCommand(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	_, bad := c.badCommands[name]
+	return bad
+}
@@ -0,0 +1,54 @@
+package imapclient_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestProbeExtensions(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 ID ENABLE CONDSTORE] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 ID NIL", responses: []string{"T1 BAD Unknown command"}},
+			{command: "T2 ENABLE CONDSTORE", responses: []string{"T2 NO Not now"}},
+			// The second ID command isn't sent
+			{command: "T3 NOOP", responses: []string{"T3 OK NOOP completed"}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+
+	c := imapclient.New(clientConn, &imapclient.Options{ProbeExtensions: true})
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		if fields, err := c.ID(nil).Wait(); err != nil {
+			t.Fatalf("ID() #%v = %v, want a soft failure", i, err)
+		} else if fields != nil {
+			t.Errorf("ID() #%v = %v, want nil", i, fields)
+		}
+	}
+	if _, err := c.Enable(imap.CapCondStore).Wait(); err == nil {
+		t.Errorf("Enable() = nil, want NO error")
+	}
+	if err := c.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+
+	quirks := c.Quirks()
+	if _, ok := quirks.BadCommands["ID"]; !ok || len(quirks.BadCommands) != 1 {
+		t.Errorf("Quirks().BadCommands = %v, want ID", quirks.BadCommands)
+	}
+}
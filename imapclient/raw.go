@@ -0,0 +1,340 @@
+package imapclient
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// Raw sends a command which isn't supported by this package.
+//
+// The command name is written, followed by the arguments written by build, if
+// non-nil. build is responsible for writing the separating spaces, e.g.:
+//
+//	c.Raw("XLIST", func(enc *imapclient.RawEncoder) {
+//		enc.SP().String("").SP().String("*")
+//	}, handle)
+//
+// While the command is pending, untagged responses unknown to this package
+// are passed to handle, if non-nil, along with their name as sent by the
+// server. For responses prefixed with a number, e.g. "* 3 XFOO", the name is
+// the atom following the number, and the number is returned by
+// RawDecoder.Num. The decoder is positioned right after the name: handle must
+// decode the rest of the response, except the final CRLF. If handle returns an
+// error, the connection is closed. Responses known to this package are
+// handled as usual, e.g. by UnilateralDataHandler.
+//
+// Raw commands are tagged and pipelined like any other command.
+func (c *Client) Raw(name string, build func(enc *RawEncoder), handle func(name string, dec *RawDecoder) error) *RawCommand {
+	cmd := &RawCommand{handle: handle}
+	enc := c.beginCommand(strings.ToUpper(name), cmd)
+	if build != nil {
+		build(&RawEncoder{enc: enc})
+	}
+	enc.end()
+	return cmd
+}
+
+var errUnhandledRaw = errors.New("imapclient: no raw command to handle response")
+
+// handleRaw passes an unknown untagged response to the oldest pending raw
+// command with a handler. It returns errUnhandledRaw if there is none.
+func (c *Client) handleRaw(name string, num uint32, hasNum bool) error {
+	cmd := c.findPendingCmdFunc(func(cmd command) bool {
+		rawCmd, ok := cmd.(*RawCommand)
+		return ok && rawCmd.handle != nil
+	})
+	if cmd == nil {
+		return errUnhandledRaw
+	}
+	return cmd.(*RawCommand).handle(name, &RawDecoder{dec: c.dec, num: num, hasNum: hasNum})
+}
+
+// RawCommand is a raw command sent with Client.Raw.
+type RawCommand struct {
+	cmd
+	handle func(name string, dec *RawDecoder) error
+	status *imap.StatusResponse
+}
+
+// Wait waits for the command to complete and returns the tagged status
+// response sent by the server. If the status response is NO or BAD, an
+// *imap.Error is returned as well.
+func (cmd *RawCommand) Wait() (*imap.StatusResponse, error) {
+	err := cmd.cmd.Wait()
+	return cmd.status, err
+}
+
+// RawEncoder writes the arguments of a raw command.
+type RawEncoder struct {
+	enc *commandEncoder
+}
+
+// SP writes a space.
+func (enc *RawEncoder) SP() *RawEncoder {
+	enc.enc.SP()
+	return enc
+}
+
+// Special writes a special character, e.g. '(' or ')'.
+func (enc *RawEncoder) Special(ch byte) *RawEncoder {
+	enc.enc.Special(ch)
+	return enc
+}
+
+// Atom writes an atom. s must only contain atom characters.
+func (enc *RawEncoder) Atom(s string) *RawEncoder {
+	enc.enc.Atom(s)
+	return enc
+}
+
+// String writes a string, using the quoted or literal form as necessary.
+func (enc *RawEncoder) String(s string) *RawEncoder {
+	enc.enc.String(s)
+	return enc
+}
+
+// AString writes an astring: an atom if possible, a string otherwise.
+func (enc *RawEncoder) AString(s string) *RawEncoder {
+	enc.enc.AString(s)
+	return enc
+}
+
+// Quoted writes a quoted string.
+//
+// If s can't be represented as a quoted string (see StringForm), the
+// command fails and the connection is closed.
+func (enc *RawEncoder) Quoted(s string) *RawEncoder {
+	enc.enc.Quoted(s)
+	return enc
+}
+
+// StringLiteral writes a string as a literal.
+func (enc *RawEncoder) StringLiteral(s string) *RawEncoder {
+	enc.enc.StringLiteral(s)
+	return enc
+}
+
+// StringForm returns the syntax used by String to encode s: either
+// StringFormQuoted or StringFormLiteral.
+func (enc *RawEncoder) StringForm(s string) StringForm {
+	return stringForm(enc.enc.StringForm(s))
+}
+
+// AStringForm returns the syntax used by AString to encode s.
+func (enc *RawEncoder) AStringForm(s string) StringForm {
+	return stringForm(enc.enc.AStringForm(s))
+}
+
+// StringForm is the syntax used to encode a string.
+type StringForm int
+
+const (
+	StringFormAtom StringForm = 1 + iota
+	StringFormQuoted
+	StringFormLiteral
+)
+
+func stringForm(form imapwire.StringForm) StringForm {
+	switch form {
+	case imapwire.StringFormAtom:
+		return StringFormAtom
+	case imapwire.StringFormQuoted:
+		return StringFormQuoted
+	default:
+		return StringFormLiteral
+	}
+}
+
+// Mailbox writes a mailbox name, encoded as configured in Options.
+func (enc *RawEncoder) Mailbox(name string) *RawEncoder {
+	enc.enc.Mailbox(name)
+	return enc
+}
+
+// Flag writes a flag.
+func (enc *RawEncoder) Flag(flag imap.Flag) *RawEncoder {
+	enc.enc.Flag(flag)
+	return enc
+}
+
+// NumSet writes a sequence set.
+func (enc *RawEncoder) NumSet(numSet imap.NumSet) *RawEncoder {
+	enc.enc.Atom(numSet.String())
+	return enc
+}
+
+// Number writes a number.
+func (enc *RawEncoder) Number(v uint32) *RawEncoder {
+	enc.enc.Number(v)
+	return enc
+}
+
+// Number64 writes a 64-bit number.
+func (enc *RawEncoder) Number64(v int64) *RawEncoder {
+	enc.enc.Number64(v)
+	return enc
+}
+
+// NIL writes NIL.
+func (enc *RawEncoder) NIL() *RawEncoder {
+	enc.enc.NIL()
+	return enc
+}
+
+// List writes a parenthesized list of n items. f is called for each item,
+// the separating spaces are written automatically.
+func (enc *RawEncoder) List(n int, f func(i int)) *RawEncoder {
+	enc.enc.List(n, f)
+	return enc
+}
+
+// Literal writes a literal of the specified size. The returned writer must
+// be closed before build returns.
+func (enc *RawEncoder) Literal(size int64) io.WriteCloser {
+	return enc.enc.Literal(size)
+}
+
+// RawDecoder reads an untagged response for a raw command.
+//
+// Methods prefixed with Expect return false and record an error if the value
+// is missing. Other methods return false if the value is missing, without
+// consuming any data.
+type RawDecoder struct {
+	dec    *imapwire.Decoder
+	err    error
+	num    uint32
+	hasNum bool
+}
+
+// Err returns the decoding error, if any.
+func (dec *RawDecoder) Err() error {
+	if dec.err != nil {
+		return dec.err
+	}
+	return dec.dec.Err()
+}
+
+// Num returns the number preceding the response name, e.g. 3 for
+// "* 3 XFOO". ok is false if the response doesn't start with a number.
+func (dec *RawDecoder) Num() (num uint32, ok bool) {
+	return dec.num, dec.hasNum
+}
+
+// SP reads a space.
+func (dec *RawDecoder) SP() bool {
+	return dec.dec.SP()
+}
+
+// ExpectSP reads a space.
+func (dec *RawDecoder) ExpectSP() bool {
+	return dec.dec.ExpectSP()
+}
+
+// Special reads a special character, e.g. '(' or ')'.
+func (dec *RawDecoder) Special(ch byte) bool {
+	return dec.dec.Special(ch)
+}
+
+// ExpectSpecial reads a special character.
+func (dec *RawDecoder) ExpectSpecial(ch byte) bool {
+	return dec.dec.ExpectSpecial(ch)
+}
+
+// Atom reads an atom.
+func (dec *RawDecoder) Atom(ptr *string) bool {
+	return dec.dec.Atom(ptr)
+}
+
+// ExpectAtom reads an atom.
+func (dec *RawDecoder) ExpectAtom(ptr *string) bool {
+	return dec.dec.ExpectAtom(ptr)
+}
+
+// Number reads a number.
+func (dec *RawDecoder) Number(ptr *uint32) bool {
+	return dec.dec.Number(ptr)
+}
+
+// ExpectNumber reads a number.
+func (dec *RawDecoder) ExpectNumber(ptr *uint32) bool {
+	return dec.dec.ExpectNumber(ptr)
+}
+
+// ExpectNumber64 reads a 64-bit number.
+func (dec *RawDecoder) ExpectNumber64(ptr *int64) bool {
+	return dec.dec.ExpectNumber64(ptr)
+}
+
+// String reads a quoted string or a literal.
+func (dec *RawDecoder) String(ptr *string) bool {
+	return dec.dec.String(ptr)
+}
+
+// ExpectString reads a quoted string or a literal.
+func (dec *RawDecoder) ExpectString(ptr *string) bool {
+	return dec.dec.ExpectString(ptr)
+}
+
+// ExpectNString reads a string or NIL. NIL is decoded as an empty string.
+func (dec *RawDecoder) ExpectNString(ptr *string) bool {
+	return dec.dec.ExpectNString(ptr)
+}
+
+// ExpectAString reads an atom or a string.
+func (dec *RawDecoder) ExpectAString(ptr *string) bool {
+	return dec.dec.ExpectAString(ptr)
+}
+
+// ExpectMailbox reads a mailbox name, decoded as configured in Options.
+func (dec *RawDecoder) ExpectMailbox(ptr *string) bool {
+	return dec.dec.ExpectMailbox(ptr)
+}
+
+// ExpectFlag reads a flag or a mailbox attribute.
+func (dec *RawDecoder) ExpectFlag(ptr *string) bool {
+	flag, err := internal.ReadFlag(dec.dec)
+	if err != nil {
+		if dec.err == nil {
+			dec.err = err
+		}
+		return false
+	}
+	*ptr = flag
+	return true
+}
+
+// ExpectFlagList reads a parenthesized list of flags.
+func (dec *RawDecoder) ExpectFlagList() ([]imap.Flag, error) {
+	return internal.ReadFlagList(dec.dec)
+}
+
+// ExpectNIL reads NIL.
+func (dec *RawDecoder) ExpectNIL() bool {
+	return dec.dec.ExpectNIL()
+}
+
+// List reads a parenthesized list, calling f for each item. It returns false
+// if the next value isn't a list.
+func (dec *RawDecoder) List(f func() error) (isList bool, err error) {
+	return dec.dec.List(f)
+}
+
+// ExpectList reads a parenthesized list, calling f for each item.
+func (dec *RawDecoder) ExpectList(f func() error) error {
+	return dec.dec.ExpectList(f)
+}
+
+// Text reads human-readable text until the end of the line.
+func (dec *RawDecoder) Text(ptr *string) bool {
+	return dec.dec.Text(ptr)
+}
+
+// DiscardValue skips a value: an atom, a number, a string, NIL or a list.
+func (dec *RawDecoder) DiscardValue() bool {
+	return dec.dec.DiscardValue()
+}
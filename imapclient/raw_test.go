@@ -0,0 +1,187 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestRaw(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: `T1 XLIST "" "*"`, responses: []string{
+				`* XLIST (\HasNoChildren \Archive) "/" "Old"`,
+				"* 3 XFOO bar",
+				"* 1 EXISTS",
+				"T1 OK [XDONE] XLIST completed",
+			}},
+			{command: "T2 XFLAG", responses: []string{
+				"* XFLAG (",
+				"T2 OK XFLAG completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+
+	var numMessages uint32
+	c := imapclient.New(clientConn, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Mailbox: func(data *imapclient.UnilateralDataMailbox) {
+				if data.NumMessages != nil {
+					numMessages = *data.NumMessages
+				}
+			},
+		},
+	})
+	defer func() {
+		c.Close()
+		<-done
+	}()
+
+	type xfoo struct {
+		num uint32
+		arg string
+	}
+	var (
+		attrs  []string
+		name   string
+		xfoos  []xfoo
+		others []string
+	)
+	cmd := c.Raw("xlist", func(enc *imapclient.RawEncoder) {
+		enc.SP().String("").SP().String("*")
+	}, func(respName string, dec *imapclient.RawDecoder) error {
+		switch respName {
+		case "XLIST":
+			if !dec.ExpectSP() {
+				return dec.Err()
+			}
+			err := dec.ExpectList(func() error {
+				var attr string
+				if !dec.ExpectFlag(&attr) {
+					return dec.Err()
+				}
+				attrs = append(attrs, attr)
+				return nil
+			})
+			var delim string
+			if err != nil {
+				return err
+			} else if !dec.ExpectSP() || !dec.ExpectString(&delim) || !dec.ExpectSP() || !dec.ExpectMailbox(&name) {
+				return dec.Err()
+			}
+		case "XFOO":
+			num, ok := dec.Num()
+			if !ok {
+				t.Errorf("Num() returned false for numeric response")
+			}
+			var arg string
+			if !dec.ExpectSP() || !dec.ExpectAtom(&arg) {
+				return dec.Err()
+			}
+			xfoos = append(xfoos, xfoo{num, arg})
+		default:
+			others = append(others, respName)
+		}
+		return nil
+	})
+	status, err := cmd.Wait()
+	if err != nil {
+		t.Fatalf("Raw().Wait() = %v", err)
+	}
+	if status.Code != "XDONE" {
+		t.Errorf("status code = %q, want XDONE", status.Code)
+	}
+	if want := []string{`\HasNoChildren`, `\Archive`}; !reflect.DeepEqual(attrs, want) || name != "Old" {
+		t.Errorf("XLIST = %v %q, want %v %q", attrs, name, want, "Old")
+	}
+	if want := []xfoo{{3, "bar"}}; !reflect.DeepEqual(xfoos, want) {
+		t.Errorf("XFOO = %v, want %v", xfoos, want)
+	}
+	if len(others) > 0 {
+		t.Errorf("known responses passed to the handler: %v", others)
+	}
+	if numMessages != 1 {
+		t.Errorf("EXISTS not handled by the unilateral data handler")
+	}
+
+	// Decoding errors are reported and close the connection
+	var flagErr error
+	_, err = c.Raw("XFLAG", nil, func(respName string, dec *imapclient.RawDecoder) error {
+		if !dec.ExpectSP() || !dec.ExpectSpecial('(') {
+			return dec.Err()
+		}
+		var flag string
+		if !dec.ExpectFlag(&flag) {
+			flagErr = dec.Err()
+			return flagErr
+		}
+		return nil
+	}).Wait()
+	if flagErr == nil {
+		t.Errorf("ExpectFlag() didn't record an error")
+	}
+	if err == nil {
+		t.Errorf("Raw().Wait() succeeded after a decoding error")
+	}
+	if _, ok := err.(*imap.Error); ok {
+		t.Errorf("Raw().Wait() = %v, want a connection error", err)
+	}
+}
+
+func TestRawStringForms(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 LITERAL-] ready"},
+		exchanges: []corpusExchange{
+			{command: `T1 XSET key "hello world" {3+}`, responses: nil},
+			{command: "foo", responses: []string{"T1 OK XSET completed"}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		<-done
+	}()
+	if err := c.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+
+	var forms []imapclient.StringForm
+	_, err := c.Raw("XSET", func(enc *imapclient.RawEncoder) {
+		for _, s := range []string{"key", "hello world", "a\r\nb"} {
+			forms = append(forms, enc.AStringForm(s))
+		}
+		enc.SP().AString("key").SP().Quoted("hello world").SP().StringLiteral("foo")
+	}, nil).Wait()
+	if err != nil {
+		t.Fatalf("Raw().Wait() = %v", err)
+	}
+	want := []imapclient.StringForm{imapclient.StringFormAtom, imapclient.StringFormQuoted, imapclient.StringFormLiteral}
+	if !reflect.DeepEqual(forms, want) {
+		t.Errorf("AStringForm() = %v, want %v", forms, want)
+	}
+
+	// Strings which can't be quoted fail the command instead of producing
+	// invalid syntax
+	_, err = c.Raw("XSET", func(enc *imapclient.RawEncoder) {
+		enc.SP().Quoted("a\r\nb")
+	}, nil).Wait()
+	if err == nil {
+		t.Errorf("Raw().Wait() with an invalid quoted string succeeded")
+	}
+}
@@ -0,0 +1,164 @@
+package imapclient
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// MailboxRename describes a mailbox renamed by Client.RenameMailbox.
+type MailboxRename struct {
+	OldName string
+	NewName string
+}
+
+// RenameMailboxData is the data returned by Client.RenameMailbox.
+type RenameMailboxData struct {
+	// Renamed mailboxes, including the children of the renamed mailbox,
+	// sorted by old name
+	Renamed []MailboxRename
+	// New names subscribed to because the server didn't move the
+	// subscriptions of the renamed mailboxes
+	Resubscribed []string
+}
+
+// RenameMailbox renames a mailbox along with its children, and keeps
+// subscriptions consistent.
+//
+// RENAME also renames the children of the mailbox, but servers aren't
+// required to move subscriptions. If the server supports IMAP4rev2 or
+// LIST-EXTENDED, RenameMailbox subscribes to the new names of the mailboxes
+// which were subscribed to, and unsubscribes from the old names. Otherwise,
+// subscriptions are left untouched.
+//
+// The renamed mailboxes are discovered by listing the hierarchy before and
+// after renaming, and by the LIST responses with the OLDNAME extended data
+// item sent by the server. Children which don't exist under their new name
+// afterwards aren't reported.
+func (c *Client) RenameMailbox(mailbox, newName string) (*RenameMailboxData, error) {
+	caps := c.Caps()
+	listExtended := caps.Has(imap.CapIMAP4rev2) || caps.Has(imap.CapListExtended)
+
+	var listOptions *imap.ListOptions
+	if listExtended {
+		listOptions = &imap.ListOptions{ReturnSubscribed: true}
+	}
+	before, err := c.listHierarchy(mailbox, listOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	c.statusCache.invalidateAll()
+	cmd := &renameCommand{}
+	enc := c.beginCommand("RENAME", cmd)
+	enc.SP().Mailbox(mailbox).SP().Mailbox(newName)
+	enc.end()
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+
+	newNames := map[string]string{mailbox: newName}
+	subscribed := make(map[string]bool)
+	for _, data := range before {
+		if data.Mailbox != mailbox {
+			newNames[data.Mailbox] = newName + data.Mailbox[len(mailbox):]
+		}
+		if hasMailboxAttr(data.Attrs, imap.MailboxAttrSubscribed) {
+			subscribed[data.Mailbox] = true
+		}
+	}
+	for _, data := range cmd.renamed {
+		newNames[data.OldName] = data.Mailbox
+	}
+
+	// Only report the mailboxes which exist under their new name: some
+	// servers don't rename children
+	after, err := c.listHierarchy(newName, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]*imap.ListData, len(after))
+	for _, data := range after {
+		exists[data.Mailbox] = data
+	}
+
+	result := &RenameMailboxData{}
+	for oldName, name := range newNames {
+		if exists[name] != nil || oldName == mailbox {
+			result.Renamed = append(result.Renamed, MailboxRename{OldName: oldName, NewName: name})
+		}
+	}
+	sort.Slice(result.Renamed, func(i, j int) bool {
+		return result.Renamed[i].OldName < result.Renamed[j].OldName
+	})
+
+	if !listExtended || len(subscribed) == 0 {
+		return result, nil
+	}
+
+	renamed := make(map[string]bool)
+	for _, r := range result.Renamed {
+		renamed[r.OldName] = true
+		data := exists[r.NewName]
+		if !subscribed[r.OldName] || data == nil || hasMailboxAttr(data.Attrs, imap.MailboxAttrSubscribed) {
+			continue
+		}
+		if err := c.Subscribe(r.NewName).Wait(); err != nil {
+			return result, err
+		}
+		result.Resubscribed = append(result.Resubscribed, r.NewName)
+	}
+
+	stale, err := c.listHierarchy(mailbox, &imap.ListOptions{SelectSubscribed: true})
+	if err != nil {
+		return result, err
+	}
+	for _, data := range stale {
+		if !renamed[data.Mailbox] {
+			continue
+		}
+		if err := c.Unsubscribe(data.Mailbox).Wait(); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// listHierarchy lists a mailbox and its children.
+//
+// LIST patterns can't escape wildcards: if the mailbox name contains one, the
+// pattern stops before it, and the results are filtered by name.
+func (c *Client) listHierarchy(mailbox string, options *imap.ListOptions) ([]*imap.ListData, error) {
+	pattern := mailbox
+	if i := strings.IndexAny(pattern, "*%"); i >= 0 {
+		pattern = pattern[:i]
+	}
+	l, err := c.List("", pattern+"*", options).Collect()
+	if err != nil {
+		return nil, err
+	}
+	var out []*imap.ListData
+	for _, data := range l {
+		isChild := data.Delim != 0 && strings.HasPrefix(data.Mailbox, mailbox+string(data.Delim))
+		if data.Mailbox == mailbox || isChild {
+			out = append(out, data)
+		}
+	}
+	return out, nil
+}
+
+func hasMailboxAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if strings.EqualFold(string(a), string(attr)) {
+			return true
+		}
+	}
+	return false
+}
+
+type renameCommand struct {
+	cmd
+	renamed []*imap.ListData // LIST responses with OLDNAME
+}
@@ -0,0 +1,49 @@
+package imapclient_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestRenameMailboxWildcards(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	for _, name := range []string{"a%b", "a%b/c", "axb", "axb/d", "a*b2"} {
+		if err := c.Create(name).Wait(); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+
+	data, err := c.RenameMailbox("a%b", "new")
+	if err != nil {
+		t.Fatalf("RenameMailbox() = %v", err)
+	}
+	// The memory server doesn't rename children: "a%b/c" doesn't exist under
+	// its new name, and mailboxes matching "a%b" as a pattern are left alone
+	want := []imapclient.MailboxRename{{OldName: "a%b", NewName: "new"}}
+	if !reflect.DeepEqual(data.Renamed, want) {
+		t.Errorf("Renamed = %v, want %v", data.Renamed, want)
+	}
+
+	l, err := c.List("", "*", nil).Collect()
+	if err != nil {
+		t.Fatalf("List() = %v", err)
+	}
+	var names []string
+	for _, data := range l {
+		names = append(names, data.Mailbox)
+	}
+	for _, name := range []string{"a%b/c", "axb", "axb/d", "a*b2"} {
+		found := false
+		for _, n := range names {
+			found = found || n == name
+		}
+		if !found {
+			t.Errorf("mailbox %q missing after rename: %v", name, names)
+		}
+	}
+}
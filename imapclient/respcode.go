@@ -0,0 +1,117 @@
+package imapclient
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
+)
+
+// ResponseCodeParser parses the arguments of a response code.
+//
+// arg contains the raw text following the response code name, and is empty if
+// the response code has no arguments. The returned value is stored in
+// imap.StatusResponse.CodeData.
+type ResponseCodeParser func(code imap.ResponseCode, arg string) (interface{}, error)
+
+// readResponseCode reads a resp-text-code, after the opening bracket.
+func (c *Client) readResponseCode() (code string, data interface{}, err error) {
+	if !c.dec.ExpectAtom(&code) {
+		return "", nil, fmt.Errorf("in resp-text-code: %v", c.dec.Err())
+	}
+
+	switch code {
+	case "CAPABILITY": // capability-data
+		caps, err := readCapabilities(c.dec)
+		if err != nil {
+			return "", nil, fmt.Errorf("in capability-data: %v", err)
+		}
+		data = &imap.ResponseCodeCapabilityData{Caps: caps}
+	case "BADCHARSET":
+		var charsets []string
+		if c.dec.SP() {
+			err := c.dec.ExpectList(func() error {
+				var charset string
+				if !c.dec.ExpectAString(&charset) {
+					return c.dec.Err()
+				}
+				charsets = append(charsets, charset)
+				return nil
+			})
+			if err != nil {
+				return "", nil, fmt.Errorf("in resp-text-code: %v", err)
+			}
+		}
+		data = &imap.ResponseCodeBadCharsetData{Charsets: charsets}
+	case "PERMANENTFLAGS":
+		if !c.dec.ExpectSP() {
+			return "", nil, c.dec.Err()
+		}
+		flags, err := internal.ReadFlagList(c.dec)
+		if err != nil {
+			return "", nil, err
+		}
+		data = &imap.ResponseCodePermanentFlagsData{Flags: flags}
+	case "UIDNEXT":
+		var uidNext uint32
+		if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidNext) {
+			return "", nil, c.dec.Err()
+		}
+		data = &imap.ResponseCodeUIDNextData{UIDNext: uidNext}
+	case "UIDVALIDITY":
+		var uidValidity uint32
+		if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) {
+			return "", nil, c.dec.Err()
+		}
+		data = &imap.ResponseCodeUIDValidityData{UIDValidity: uidValidity}
+	case "APPENDUID":
+		var uidValidity, uid uint32
+		if !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uidValidity) || !c.dec.ExpectSP() || !c.dec.ExpectNumber(&uid) {
+			return "", nil, fmt.Errorf("in resp-code-apnd: %v", c.dec.Err())
+		}
+		data = &imap.ResponseCodeAppendUIDData{UIDValidity: uidValidity, UID: uid}
+	case "COPYUID":
+		if !c.dec.ExpectSP() {
+			return "", nil, c.dec.Err()
+		}
+		uidValidity, srcUIDs, dstUIDs, err := readRespCodeCopy(c.dec)
+		if err != nil {
+			return "", nil, fmt.Errorf("in resp-code-copy: %v", err)
+		}
+		data = &imap.ResponseCodeCopyUIDData{
+			UIDValidity: uidValidity,
+			SourceUIDs:  srcUIDs,
+			DestUIDs:    dstUIDs,
+		}
+	case "MODIFIED":
+		var set imap.SeqSet
+		if !c.dec.ExpectSP() || !c.dec.ExpectSeqSet(&set) {
+			return "", nil, c.dec.Err()
+		}
+		data = &imap.ResponseCodeModifiedData{Set: set}
+	case "HIGHESTMODSEQ":
+		var modSeq int64
+		if !c.dec.ExpectSP() || !c.dec.ExpectNumber64(&modSeq) {
+			return "", nil, c.dec.Err()
+		}
+		data = &imap.ResponseCodeHighestModSeqData{ModSeq: uint64(modSeq)}
+	default: // [SP 1*<any TEXT-CHAR except "]">]
+		var arg string
+		if c.dec.SP() {
+			c.dec.Func(&arg, func(ch byte) bool {
+				return ch != ']' && ch != '\r' && ch != '\n'
+			})
+		}
+		if c.dec.Err() != nil {
+			return "", nil, c.dec.Err()
+		}
+		if parser := c.options.ResponseCodeParsers[imap.ResponseCode(code)]; parser != nil {
+			data, err = parser(imap.ResponseCode(code), arg)
+			if err != nil {
+				return "", nil, fmt.Errorf("in resp-text-code %v: %v", code, err)
+			}
+		}
+	}
+
+	return code, data, nil
+}
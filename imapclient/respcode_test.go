@@ -0,0 +1,119 @@
+package imapclient_test
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+type quotaWarningData struct {
+	Percent int
+}
+
+func parseQuotaWarning(code imap.ResponseCode, arg string) (interface{}, error) {
+	percent, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid percentage: %v", err)
+	}
+	return &quotaWarningData{Percent: percent}, nil
+}
+
+func TestResponseCode(t *testing.T) {
+	tests := []struct {
+		resp string
+		code imap.ResponseCode
+		data interface{}
+	}{
+		{
+			resp: "NO [BADCHARSET (US-ASCII \"ISO-8859-1\")] Unsupported charset",
+			code: imap.ResponseCodeBadCharset,
+			data: &imap.ResponseCodeBadCharsetData{Charsets: []string{"US-ASCII", "ISO-8859-1"}},
+		},
+		{
+			resp: "NO [BADCHARSET] Unsupported charset",
+			code: imap.ResponseCodeBadCharset,
+			data: &imap.ResponseCodeBadCharsetData{},
+		},
+		{
+			resp: "NO [MODIFIED 7,9] Conditional STORE failed",
+			code: imap.ResponseCodeModified,
+			data: &imap.ResponseCodeModifiedData{Set: imap.SeqSetNum(7, 9)},
+		},
+		{
+			resp: "NO [HIGHESTMODSEQ 715194045007] Highest",
+			code: imap.ResponseCode("HIGHESTMODSEQ"),
+			data: &imap.ResponseCodeHighestModSeqData{ModSeq: 715194045007},
+		},
+		{
+			resp: "NO [X-QUOTA-WARNING 95] Almost full",
+			code: imap.ResponseCode("X-QUOTA-WARNING"),
+			data: &quotaWarningData{Percent: 95},
+		},
+		{
+			// No parser registered: the arguments are discarded
+			resp: "NO [X-UNKNOWN some args] Unknown",
+			code: imap.ResponseCode("X-UNKNOWN"),
+			data: nil,
+		},
+		{
+			resp: "NO [ALERT] Hello",
+			code: imap.ResponseCodeAlert,
+			data: nil,
+		},
+	}
+	for _, tc := range tests {
+		err := noopWithResponse(t, tc.resp)
+		var imapErr *imap.Error
+		if !errors.As(err, &imapErr) {
+			t.Errorf("%q: Noop() = %v, want an IMAP error", tc.resp, err)
+			continue
+		}
+		if imapErr.Code != tc.code {
+			t.Errorf("%q: Code = %v, want %v", tc.resp, imapErr.Code, tc.code)
+		}
+		if !reflect.DeepEqual(imapErr.CodeData, tc.data) {
+			t.Errorf("%q: CodeData = %#v, want %#v", tc.resp, imapErr.CodeData, tc.data)
+		}
+	}
+
+	// The parser fails: the response can't be decoded
+	err := noopWithResponse(t, "NO [X-QUOTA-WARNING high] Almost full")
+	var imapErr *imap.Error
+	if err == nil || errors.As(err, &imapErr) {
+		t.Errorf("Noop() with invalid response code arguments = %v, want a decoding error", err)
+	}
+}
+
+// noopWithResponse sends a NOOP command, which the server completes with
+// resp.
+func noopWithResponse(t *testing.T, resp string) error {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 NOOP", responses: []string{"T1 " + resp}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, &imapclient.Options{
+		ResponseCodeParsers: map[imap.ResponseCode]imapclient.ResponseCodeParser{
+			"X-QUOTA-WARNING": parseQuotaWarning,
+		},
+	})
+	err := c.Noop().Wait()
+	c.Close()
+	if serveErr := <-done; serveErr != nil {
+		t.Errorf("transcript: %v", serveErr)
+	}
+	return err
+}
@@ -0,0 +1,317 @@
+package imapclient
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// Interval between two searches when watching a saved search on a server
+// which doesn't support CONTEXT=SEARCH, or between two NOOP commands on a
+// server which doesn't support IDLE
+const savedSearchPollInterval = time.Minute
+
+// SavedSearch is a saved search in the currently selected mailbox, behaving
+// like a virtual mailbox containing the matching messages.
+//
+// The result set is updated by calling Refresh, which re-runs the search, or
+// kept current by Watch.
+type SavedSearch struct {
+	client       *Client
+	criteria     *imap.SearchCriteria
+	pollInterval time.Duration
+
+	mutex       sync.Mutex // protects the fields below
+	mailbox     string
+	uidValidity uint32
+	uids        map[uint32]struct{}
+}
+
+// SavedSearchUpdate describes the changes in the result set of a saved search.
+type SavedSearchUpdate struct {
+	// UIDs of messages which started matching the criteria
+	Added imap.UIDSet
+	// UIDs of messages which no longer match the criteria or were expunged
+	Removed imap.UIDSet
+}
+
+func (update *SavedSearchUpdate) empty() bool {
+	return len(update.Added) == 0 && len(update.Removed) == 0
+}
+
+// NewSavedSearch creates a new saved search for the currently selected
+// mailbox.
+//
+// The result set is initially empty, Refresh or Watch must be called to
+// populate it.
+func NewSavedSearch(c *Client, criteria *imap.SearchCriteria) *SavedSearch {
+	return &SavedSearch{
+		client:       c,
+		criteria:     criteria,
+		pollInterval: savedSearchPollInterval,
+	}
+}
+
+// UIDs returns the UIDs of the messages matching the criteria, as of the last
+// update.
+//
+// UIDs is safe to call while Watch is running.
+func (s *SavedSearch) UIDs() imap.UIDSet {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var uids imap.UIDSet
+	for uid := range s.uids {
+		uids.AddNum(uid)
+	}
+	return uids
+}
+
+// Refresh re-runs the search and returns the changes since the last call.
+//
+// If a different mailbox has been selected since the last call, or if the
+// UIDVALIDITY of the mailbox has changed, all previous results are reported
+// as removed. In that case, the same UIDs may be reported as removed and
+// added: removals must be processed first.
+//
+// Refresh must not be called while Watch is running.
+func (s *SavedSearch) Refresh() (*SavedSearchUpdate, error) {
+	mailbox := s.client.Mailbox()
+	if mailbox == nil {
+		return nil, fmt.Errorf("imapclient: saved search requires a selected mailbox")
+	}
+
+	data, err := s.client.UIDSearch(s.criteria, nil).Wait()
+	if err != nil {
+		return nil, err
+	}
+	return s.replace(mailbox, data.AllNums()), nil
+}
+
+// replace replaces the result set and returns the changes.
+func (s *SavedSearch) replace(mailbox *SelectedMailbox, nums []uint32) *SavedSearchUpdate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	uids := make(map[uint32]struct{})
+	for _, uid := range nums {
+		uids[uid] = struct{}{}
+	}
+
+	prev := s.uids
+	if s.mailbox != mailbox.Name || s.uidValidity != mailbox.UIDValidity {
+		prev = nil
+	}
+
+	var update SavedSearchUpdate
+	for uid := range uids {
+		if _, ok := prev[uid]; !ok {
+			update.Added.AddNum(uid)
+		}
+	}
+	for uid := range s.uids {
+		if _, ok := prev[uid]; !ok {
+			// Mailbox or UIDVALIDITY changed
+			update.Removed.AddNum(uid)
+		} else if _, ok := uids[uid]; !ok {
+			update.Removed.AddNum(uid)
+		}
+	}
+
+	s.mailbox = mailbox.Name
+	s.uidValidity = mailbox.UIDValidity
+	s.uids = uids
+	return &update
+}
+
+// apply applies updates sent by the server to the result set and returns the
+// changes.
+func (s *SavedSearch) apply(updates []*searchContextUpdate) *SavedSearchUpdate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	uids := make(map[uint32]struct{}, len(s.uids))
+	for uid := range s.uids {
+		uids[uid] = struct{}{}
+	}
+	for _, u := range updates {
+		// Note: a dynamic set would be a server bug
+		removed, _ := u.removed.Nums()
+		for _, uid := range removed {
+			delete(uids, uid)
+		}
+		added, _ := u.added.Nums()
+		for _, uid := range added {
+			uids[uid] = struct{}{}
+		}
+	}
+
+	var update SavedSearchUpdate
+	for uid := range uids {
+		if _, ok := s.uids[uid]; !ok {
+			update.Added.AddNum(uid)
+		}
+	}
+	for uid := range s.uids {
+		if _, ok := uids[uid]; !ok {
+			update.Removed.AddNum(uid)
+		}
+	}
+
+	s.uids = uids
+	return &update
+}
+
+// Watch keeps the result set current until stop is closed.
+//
+// If the server supports CONTEXT=SEARCH, the search is run once and the
+// server sends the changes to the result set. Otherwise, the search is re-run
+// periodically. In the meantime, the client runs IDLE (or polls with NOOP if
+// the server doesn't support IDLE). The changed callback, if non-nil, is
+// called from Watch with the initial result and after each change.
+//
+// The client must not be used to send other commands while Watch is running.
+// If an error occurs, Watch stops and returns it.
+func (s *SavedSearch) Watch(changed func(*SavedSearchUpdate), stop <-chan struct{}) error {
+	if changed == nil {
+		changed = func(*SavedSearchUpdate) {}
+	}
+
+	mailbox := s.client.Mailbox()
+	if mailbox == nil {
+		return fmt.Errorf("imapclient: saved search requires a selected mailbox")
+	}
+
+	if s.client.Caps().Has(imap.CapContextSearch) {
+		return s.watchContext(mailbox, changed, stop)
+	}
+	return s.watchPoll(changed, stop)
+}
+
+// watchPoll re-runs the search periodically until stop is closed.
+func (s *SavedSearch) watchPoll(changed func(*SavedSearchUpdate), stop <-chan struct{}) error {
+	for {
+		update, err := s.Refresh()
+		if err != nil {
+			return err
+		}
+		if !update.empty() {
+			changed(update)
+		}
+
+		if stopped, err := waitSavedSearch(s.client, nil, stop, s.pollInterval); err != nil {
+			return err
+		} else if stopped {
+			return nil
+		}
+	}
+}
+
+// watchContext runs the search with CONTEXT=SEARCH updates and applies them
+// until stop is closed.
+func (s *SavedSearch) watchContext(mailbox *SelectedMailbox, changed func(*SavedSearchUpdate), stop <-chan struct{}) error {
+	c := s.client
+
+	var (
+		updatesMutex sync.Mutex
+		updates      []*searchContextUpdate
+		updated      = make(chan struct{}, 1)
+	)
+	searchCmd := c.uidSearchContext(s.criteria, func(update *searchContextUpdate) {
+		updatesMutex.Lock()
+		updates = append(updates, update)
+		updatesMutex.Unlock()
+
+		select {
+		case updated <- struct{}{}:
+		default:
+		}
+	})
+	data, err := searchCmd.Wait()
+	if err != nil {
+		return err
+	}
+	if update := s.replace(mailbox, data.AllNums()); !update.empty() {
+		changed(update)
+	}
+
+	idle := c.Caps().Has(imap.CapIdle)
+	interval := s.pollInterval
+	if idle {
+		interval = accountIdleRestart
+	}
+	for err == nil {
+		var stopped bool
+		stopped, err = waitSavedSearch(c, updated, stop, interval)
+		if err != nil || stopped {
+			break
+		}
+		if !idle {
+			// Updates are only sent while a command is in progress
+			if err = c.Noop().Wait(); err != nil {
+				break
+			}
+		}
+
+		updatesMutex.Lock()
+		pending := updates
+		updates = nil
+		updatesMutex.Unlock()
+		if len(pending) == 0 {
+			continue
+		}
+		if update := s.apply(pending); !update.empty() {
+			changed(update)
+		}
+	}
+
+	cancelErr := c.cancelSearchContext(searchCmd).Wait()
+	if err == nil {
+		err = cancelErr
+	}
+	return err
+}
+
+// waitSavedSearch waits until updated is signalled, stop is closed or d
+// elapses, running IDLE in the meantime if the server supports it. It returns
+// true if stop has been closed.
+func waitSavedSearch(c *Client, updated <-chan struct{}, stop <-chan struct{}, d time.Duration) (bool, error) {
+	select {
+	case <-stop:
+		return true, nil
+	default:
+	}
+
+	var idleCmd *IdleCommand
+	if c.Caps().Has(imap.CapIdle) {
+		var err error
+		if idleCmd, err = c.Idle(); err != nil {
+			return false, err
+		}
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	var stopped bool
+	select {
+	case <-updated:
+	case <-timer.C:
+	case <-stop:
+		stopped = true
+	case <-c.Done():
+		return false, c.Err()
+	}
+
+	if idleCmd != nil {
+		if err := idleCmd.Close(); err != nil {
+			return false, err
+		}
+		if err := idleCmd.Wait(); err != nil {
+			return false, err
+		}
+	}
+	return stopped, nil
+}
@@ -0,0 +1,200 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestSavedSearchUIDValidity(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 2 EXISTS",
+				"* OK [UIDVALIDITY 1] UIDs valid",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: "T2 UID SEARCH (ALL)", responses: []string{
+				"* SEARCH 1 2",
+				"T2 OK SEARCH completed",
+			}},
+			{command: "T3 SELECT INBOX", responses: []string{
+				"* 2 EXISTS",
+				"* OK [UIDVALIDITY 2] UIDs valid",
+				"T3 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: "T4 UID SEARCH (ALL)", responses: []string{
+				"* SEARCH 1 3",
+				"T4 OK SEARCH completed",
+			}},
+			{command: "T5 UID SEARCH (ALL)", responses: []string{
+				"* SEARCH 3",
+				"T5 OK SEARCH completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	s := imapclient.NewSavedSearch(c, &imap.SearchCriteria{})
+	refresh := func(wantAdded, wantRemoved string) {
+		t.Helper()
+		update, err := s.Refresh()
+		if err != nil {
+			t.Fatalf("Refresh() = %v", err)
+		}
+		if added := update.Added.String(); added != wantAdded {
+			t.Errorf("Added = %q, want %q", added, wantAdded)
+		}
+		if removed := update.Removed.String(); removed != wantRemoved {
+			t.Errorf("Removed = %q, want %q", removed, wantRemoved)
+		}
+	}
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	refresh("1:2", "")
+
+	// UIDs aren't comparable across UIDVALIDITY changes
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	refresh("1,3", "1:2")
+
+	refresh("", "1")
+	if uids := s.UIDs().String(); uids != "3" {
+		t.Errorf("UIDs() = %q, want %q", uids, "3")
+	}
+}
+
+func TestSavedSearchWatchContext(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 ESEARCH CONTEXT=SEARCH IDLE] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 3 EXISTS",
+				"* OK [UIDVALIDITY 1] UIDs valid",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: "T2 UID SEARCH RETURN (ALL UPDATE) (ALL)", responses: []string{
+				`* ESEARCH (TAG "T2") UID ALL 1:3`,
+				"T2 OK SEARCH completed",
+			}},
+			{command: "T3 IDLE", responses: []string{
+				"+ idling",
+				"* 4 EXISTS",
+				`* ESEARCH (TAG "T2") UID ADDTO (0 5)`,
+				"* 1 EXPUNGE",
+				`* ESEARCH (TAG "T2") UID REMOVEFROM (0 1)`,
+			}},
+			{command: "DONE", responses: []string{
+				"T3 OK IDLE terminated",
+			}},
+			{command: `T4 CANCELUPDATE "T2"`, responses: []string{
+				"T4 OK CANCELUPDATE completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	s := imapclient.NewSavedSearch(c, &imap.SearchCriteria{})
+	var updates []string
+	stop := make(chan struct{})
+	err := s.Watch(func(update *imapclient.SavedSearchUpdate) {
+		updates = append(updates, "+"+update.Added.String()+" -"+update.Removed.String())
+		if len(updates) == 2 {
+			close(stop)
+		}
+	}, stop)
+	if err != nil {
+		t.Fatalf("Watch() = %v", err)
+	}
+
+	want := []string{"+1:3 -", "+5 -1"}
+	if !reflect.DeepEqual(updates, want) {
+		t.Errorf("updates = %v, want %v", updates, want)
+	}
+	if uids := s.UIDs().String(); uids != "2:3,5" {
+		t.Errorf("UIDs() = %q, want %q", uids, "2:3,5")
+	}
+}
+
+func TestSavedSearchWatchPoll(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 2 EXISTS",
+				"* OK [UIDVALIDITY 1] UIDs valid",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: "T2 UID SEARCH (ALL)", responses: []string{
+				"* SEARCH 1 2",
+				"T2 OK SEARCH completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	s := imapclient.NewSavedSearch(c, &imap.SearchCriteria{})
+	stop := make(chan struct{})
+	var added string
+	err := s.Watch(func(update *imapclient.SavedSearchUpdate) {
+		added = update.Added.String()
+		close(stop)
+	}, stop)
+	if err != nil {
+		t.Fatalf("Watch() = %v", err)
+	}
+	if added != "1:2" {
+		t.Errorf("Added = %q, want %q", added, "1:2")
+	}
+}
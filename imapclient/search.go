@@ -10,16 +10,54 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Client) search(uid bool, criteria *imap.SearchCriteria, options *imap.SearchOptions) *SearchCommand {
-	// TODO: use CHARSET UTF-8 with an US-ASCII fallback for IMAP4rev1 servers
+func (c *Client) search(uid bool, criteria *imap.SearchCriteria, options *imap.SearchOptions, update func(*searchContextUpdate)) *SearchCommand {
+	if err := checkSearchCaps(c.Caps(), criteria, options); err != nil {
+		cmd := &SearchCommand{client: c, uid: uid, options: options}
+		c.beginFailedCommand(uidCmdName("SEARCH", uid), cmd, err).end()
+		return cmd
+	}
+	criteria = criteria.Optimize()
+
 	// TODO: add support for SEARCHRES
-	cmd := &SearchCommand{}
+	var charset string
+	if !searchCriteriaIsASCII(criteria) && !c.Caps().Has(imap.CapIMAP4rev2) && !c.Caps().Has(imap.CapUTF8Accept) {
+		charset = "UTF-8"
+	}
+	cmd := c.searchWithCharset(uid, criteria, options, charset, update)
+	cmd.criteria = criteria
+	return cmd
+}
+
+func (c *Client) searchWithCharset(uid bool, criteria *imap.SearchCriteria, options *imap.SearchOptions, charset string, update func(*searchContextUpdate)) *SearchCommand {
+	cmd := &SearchCommand{
+		client:  c,
+		uid:     uid,
+		options: options,
+		charset: charset,
+		update:  update,
+	}
 	enc := c.beginCommand(uidCmdName("SEARCH", uid), cmd)
+	if update != nil {
+		// Registered before the command is sent, so that no update is missed
+		c.mutex.Lock()
+		if c.searchUpdates == nil {
+			c.searchUpdates = make(map[string]func(*searchContextUpdate))
+		}
+		c.searchUpdates[cmd.tag] = update
+		c.mutex.Unlock()
+	}
+	if charset != "" && !strings.EqualFold(charset, "UTF-8") {
+		// Strings in other charsets can't be sent as quoted strings
+		enc.QuotedUTF8 = false
+	}
 	if options != nil && len(options.Return) > 0 {
 		enc.SP().Atom("RETURN").SP().List(len(options.Return), func(i int) {
 			enc.Atom(string(options.Return[i]))
 		})
 	}
+	if charset != "" {
+		enc.SP().Atom("CHARSET").SP().Atom(charset)
+	}
 	enc.SP()
 	writeSearchKey(enc.Encoder, criteria)
 	enc.end()
@@ -27,18 +65,78 @@ func (c *Client) search(uid bool, criteria *imap.SearchCriteria, options *imap.S
 }
 
 // Search sends a SEARCH command.
+//
+// The criteria are simplified with imap.SearchCriteria.Optimize before being
+// sent. If the criteria or the options require a capability the server
+// doesn't advertise, the command fails without being sent.
+//
+// If the criteria contain non-ASCII strings and the server doesn't support
+// UTF-8, the UTF-8 charset is requested. If the server rejects it with a
+// BADCHARSET response code, the strings are converted to one of the supported
+// charsets and the command is retried. SearchCommand.Charset returns the
+// charset used.
 func (c *Client) Search(criteria *imap.SearchCriteria, options *imap.SearchOptions) *SearchCommand {
-	return c.search(false, criteria, options)
+	return c.search(false, criteria, options, nil)
 }
 
 // UIDSearch sends a UID SEARCH command.
 func (c *Client) UIDSearch(criteria *imap.SearchCriteria, options *imap.SearchOptions) *SearchCommand {
-	return c.search(true, criteria, options)
+	return c.search(true, criteria, options, nil)
+}
+
+// searchReturnUpdate is the UPDATE search return option, defined in RFC 5267.
+const searchReturnUpdate imap.SearchReturnOption = "UPDATE"
+
+// searchContextUpdate is a change in the result of a SEARCH RETURN (UPDATE)
+// command, sent by the server in an unsolicited ESEARCH response.
+type searchContextUpdate struct {
+	uid            bool
+	added, removed imap.SeqSet
+}
+
+// uidSearchContext sends a UID SEARCH RETURN (ALL UPDATE) command.
+//
+// Once the command completes successfully, the server keeps the result
+// up-to-date: update is called from the decoder goroutine with each change
+// until cancelSearchContext is called. update must not block.
+func (c *Client) uidSearchContext(criteria *imap.SearchCriteria, update func(*searchContextUpdate)) *SearchCommand {
+	options := &imap.SearchOptions{
+		Return: []imap.SearchReturnOption{imap.SearchReturnAll, searchReturnUpdate},
+	}
+	return c.search(true, criteria, options, update)
+}
+
+// cancelSearchContext sends a CANCELUPDATE command, stopping the updates
+// requested by a successful uidSearchContext command.
+func (c *Client) cancelSearchContext(cmd *SearchCommand) *Command {
+	tag := cmd.contextTag()
+	c.mutex.Lock()
+	delete(c.searchUpdates, tag)
+	c.mutex.Unlock()
+
+	cancelCmd := &Command{}
+	enc := c.beginCommand("CANCELUPDATE", cancelCmd)
+	enc.SP().String(tag)
+	enc.end()
+	return cancelCmd
 }
 
 func (c *Client) handleSearch() error {
 	cmd := findPendingCmdByType[*SearchCommand](c)
 	for c.dec.SP() {
+		if c.dec.Special('(') {
+			// CONDSTORE suffix: "(MODSEQ mod-sequence-value)"
+			var name string
+			var modSeq int64
+			if !c.dec.ExpectAtom(&name) || !c.dec.Expect(strings.EqualFold(name, "MODSEQ"), "MODSEQ") || !c.dec.ExpectSP() || !c.dec.ExpectNumber64(&modSeq) || !c.dec.ExpectSpecial(')') {
+				return c.dec.Err()
+			}
+			if cmd != nil {
+				cmd.data.ModSeq = uint64(modSeq)
+			}
+			break
+		}
+
 		var num uint32
 		if !c.dec.ExpectNumber(&num) {
 			return c.dec.Err()
@@ -54,10 +152,19 @@ func (c *Client) handleESearch() error {
 	if !c.dec.ExpectSP() {
 		return c.dec.Err()
 	}
-	tag, data, err := readESearchResponse(c.dec)
+	tag, data, update, err := readESearchResponse(c.dec)
 	if err != nil {
 		return err
 	}
+	if update != nil {
+		c.mutex.Lock()
+		handler := c.searchUpdates[tag]
+		c.mutex.Unlock()
+		if handler != nil {
+			handler(update)
+		}
+		return nil
+	}
 	cmd := c.findPendingCmdFunc(func(anyCmd command) bool {
 		cmd, ok := anyCmd.(*SearchCommand)
 		if !ok {
@@ -80,10 +187,66 @@ func (c *Client) handleESearch() error {
 type SearchCommand struct {
 	cmd
 	data imap.SearchData
+
+	client  *Client
+	uid     bool
+	options *imap.SearchOptions
+	charset string
+	// Original criteria, if the command can be retried with another charset
+	criteria *imap.SearchCriteria
+	// Set if the command has been retried with another charset
+	retried  bool
+	retryErr error
+	retryTag string
+	// CONTEXT=SEARCH update handler, if any
+	update func(*searchContextUpdate)
 }
 
 func (cmd *SearchCommand) Wait() (*imap.SearchData, error) {
-	return &cmd.data, cmd.cmd.Wait()
+	err := cmd.cmd.Wait()
+	if criteria := cmd.criteria; criteria != nil {
+		cmd.criteria = nil
+		if charset, encoded, ok := searchRetryCharset(err, criteria); ok {
+			if cmd.update != nil {
+				cmd.client.mutex.Lock()
+				delete(cmd.client.searchUpdates, cmd.tag)
+				cmd.client.mutex.Unlock()
+			}
+			retryCmd := cmd.client.searchWithCharset(cmd.uid, encoded, cmd.options, charset, cmd.update)
+			data, retryErr := retryCmd.Wait()
+			cmd.retryTag = retryCmd.tag
+			cmd.data = *data
+			cmd.charset = retryCmd.charset
+			cmd.retried = true
+			cmd.retryErr = retryErr
+		}
+	}
+	if cmd.retried {
+		err = cmd.retryErr
+	}
+	if err != nil && cmd.update != nil {
+		c := cmd.client
+		c.mutex.Lock()
+		delete(c.searchUpdates, cmd.contextTag())
+		c.mutex.Unlock()
+	}
+	return &cmd.data, err
+}
+
+// contextTag returns the tag the server uses to send CONTEXT=SEARCH updates.
+func (cmd *SearchCommand) contextTag() string {
+	if cmd.retried {
+		return cmd.retryTag
+	}
+	return cmd.tag
+}
+
+// Charset returns the charset used for the search strings, or an empty string
+// if none was specified.
+//
+// This must be called after Wait.
+func (cmd *SearchCommand) Charset() string {
+	return cmd.charset
 }
 
 func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
@@ -105,6 +268,42 @@ func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
 		encodeItem("UID").SP().Atom(criteria.UID.String())
 	}
 
+	// Cheap keys first, so that servers can short-circuit evaluation
+	for _, flag := range criteria.Flag {
+		if k := flagSearchKey(flag); k != "" {
+			encodeItem(k)
+		} else {
+			encodeItem("KEYWORD").SP().Flag(flag)
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if k := flagSearchKey(flag); k != "" {
+			encodeItem("UN" + k)
+		} else {
+			encodeItem("UNKEYWORD").SP().Flag(flag)
+		}
+	}
+
+	if criteria.Larger > 0 {
+		encodeItem("LARGER").SP().Number64(criteria.Larger)
+	}
+	if criteria.Smaller > 0 {
+		encodeItem("SMALLER").SP().Number64(criteria.Smaller)
+	}
+	if criteria.ModSeq != nil {
+		encodeItem("MODSEQ").SP()
+		if criteria.ModSeq.MetadataName != "" {
+			enc.Quoted(criteria.ModSeq.MetadataName).SP().Atom(string(criteria.ModSeq.MetadataType)).SP()
+		}
+		enc.Number64(int64(criteria.ModSeq.ModSeq))
+	}
+	if criteria.Older > 0 {
+		encodeItem("OLDER").SP().Number64(int64(criteria.Older / time.Second))
+	}
+	if criteria.Younger > 0 {
+		encodeItem("YOUNGER").SP().Number64(int64(criteria.Younger / time.Second))
+	}
+
 	if !criteria.Since.IsZero() && !criteria.Before.IsZero() && criteria.Before.Sub(criteria.Since) == 24*time.Hour {
 		encodeItem("ON").SP().String(criteria.Since.Format(internal.DateLayout))
 	} else {
@@ -143,28 +342,6 @@ func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
 		encodeItem("TEXT").SP().String(s)
 	}
 
-	for _, flag := range criteria.Flag {
-		if k := flagSearchKey(flag); k != "" {
-			encodeItem(k)
-		} else {
-			encodeItem("KEYWORD").SP().Flag(flag)
-		}
-	}
-	for _, flag := range criteria.NotFlag {
-		if k := flagSearchKey(flag); k != "" {
-			encodeItem("UN" + k)
-		} else {
-			encodeItem("UNKEYWORD").SP().Flag(flag)
-		}
-	}
-
-	if criteria.Larger > 0 {
-		encodeItem("LARGER").SP().Number64(criteria.Larger)
-	}
-	if criteria.Smaller > 0 {
-		encodeItem("SMALLER").SP().Number64(criteria.Smaller)
-	}
-
 	for _, not := range criteria.Not {
 		encodeItem("NOT").SP()
 		writeSearchKey(enc, &not)
@@ -183,6 +360,59 @@ func writeSearchKey(enc *imapwire.Encoder, criteria *imap.SearchCriteria) {
 	enc.Special(')')
 }
 
+// checkSearchCaps returns an error if a SEARCH command requires a capability
+// the server doesn't advertise.
+func checkSearchCaps(caps imap.CapSet, criteria *imap.SearchCriteria, options *imap.SearchOptions) error {
+	if options != nil && len(options.Return) > 0 && !caps.Has(imap.CapESearch) {
+		return fmt.Errorf("imapclient: SEARCH RETURN options require ESEARCH or IMAP4rev2")
+	}
+	if searchCriteriaHas(criteria, func(criteria *imap.SearchCriteria) bool { return criteria.ModSeq != nil }) && !caps.Has(imap.CapCondStore) {
+		return fmt.Errorf("imapclient: SEARCH MODSEQ requires CONDSTORE")
+	}
+	hasWithin := searchCriteriaHas(criteria, func(criteria *imap.SearchCriteria) bool {
+		return criteria.Older != 0 || criteria.Younger != 0
+	})
+	if hasWithin && !caps.Has(imap.CapWithin) {
+		return fmt.Errorf("imapclient: SEARCH OLDER and YOUNGER require WITHIN")
+	}
+	invalidWithin := func(criteria *imap.SearchCriteria) bool {
+		return (criteria.Older != 0 && criteria.Older < time.Second) || (criteria.Younger != 0 && criteria.Younger < time.Second)
+	}
+	if hasWithin && searchCriteriaHas(criteria, invalidWithin) {
+		return fmt.Errorf("imapclient: SEARCH OLDER and YOUNGER intervals must be a positive number of seconds")
+	}
+	if options != nil {
+		for _, opt := range options.Return {
+			if opt == imap.SearchReturnSave && !caps.Has(imap.CapSearchRes) {
+				return fmt.Errorf("imapclient: SEARCH RETURN (SAVE) requires SEARCHRES")
+			}
+			if opt == searchReturnUpdate && !caps.Has(imap.CapContextSearch) {
+				return fmt.Errorf("imapclient: SEARCH RETURN (UPDATE) requires CONTEXT=SEARCH")
+			}
+		}
+	}
+	return nil
+}
+
+// searchCriteriaHas checks whether f returns true for the criteria or for
+// any of its nested NOT and OR keys.
+func searchCriteriaHas(criteria *imap.SearchCriteria, f func(criteria *imap.SearchCriteria) bool) bool {
+	if f(criteria) {
+		return true
+	}
+	for i := range criteria.Not {
+		if searchCriteriaHas(&criteria.Not[i], f) {
+			return true
+		}
+	}
+	for i := range criteria.Or {
+		if searchCriteriaHas(&criteria.Or[i][0], f) || searchCriteriaHas(&criteria.Or[i][1], f) {
+			return true
+		}
+	}
+	return false
+}
+
 func flagSearchKey(flag imap.Flag) string {
 	switch flag {
 	case imap.FlagAnswered, imap.FlagDeleted, imap.FlagDraft, imap.FlagFlagged, imap.FlagSeen:
@@ -192,27 +422,27 @@ func flagSearchKey(flag imap.Flag) string {
 	}
 }
 
-func readESearchResponse(dec *imapwire.Decoder) (tag string, data *imap.SearchData, err error) {
+func readESearchResponse(dec *imapwire.Decoder) (tag string, data *imap.SearchData, update *searchContextUpdate, err error) {
 	data = &imap.SearchData{}
 
 	if dec.Special('(') { // search-correlator
 		var correlator string
 		if !dec.ExpectAtom(&correlator) || !dec.ExpectSP() || !dec.ExpectAString(&tag) || !dec.ExpectSpecial(')') || !dec.ExpectSP() {
-			return "", nil, dec.Err()
+			return "", nil, nil, dec.Err()
 		}
 		if correlator != "TAG" {
-			return "", nil, fmt.Errorf("in search-correlator: name must be TAG, but got %q", correlator)
+			return "", nil, nil, fmt.Errorf("in search-correlator: name must be TAG, but got %q", correlator)
 		}
 	}
 
 	var name string
 	if !dec.ExpectAtom(&name) || !dec.ExpectSP() {
-		return "", nil, dec.Err()
+		return "", nil, nil, dec.Err()
 	}
 	data.UID = name == "UID"
 	if data.UID {
 		if !dec.ExpectAtom(&name) || !dec.ExpectSP() {
-			return "", nil, dec.Err()
+			return "", nil, nil, dec.Err()
 		}
 	}
 	for {
@@ -220,28 +450,45 @@ func readESearchResponse(dec *imapwire.Decoder) (tag string, data *imap.SearchDa
 		case imap.SearchReturnMin:
 			var num uint32
 			if !dec.ExpectNumber(&num) {
-				return "", nil, dec.Err()
+				return "", nil, nil, dec.Err()
 			}
 			data.Min = num
 		case imap.SearchReturnMax:
 			var num uint32
 			if !dec.ExpectNumber(&num) {
-				return "", nil, dec.Err()
+				return "", nil, nil, dec.Err()
 			}
 			data.Max = num
 		case imap.SearchReturnAll:
 			if !dec.ExpectSeqSet(&data.All) {
-				return "", nil, dec.Err()
+				return "", nil, nil, dec.Err()
 			}
 		case imap.SearchReturnCount:
 			var num uint32
 			if !dec.ExpectNumber(&num) {
-				return "", nil, dec.Err()
+				return "", nil, nil, dec.Err()
 			}
 			data.Count = num
+		case "MODSEQ":
+			var modSeq int64
+			if !dec.ExpectNumber64(&modSeq) {
+				return "", nil, nil, dec.Err()
+			}
+			data.ModSeq = uint64(modSeq)
+		case "ADDTO", "REMOVEFROM":
+			if update == nil {
+				update = &searchContextUpdate{}
+			}
+			set := &update.added
+			if name == "REMOVEFROM" {
+				set = &update.removed
+			}
+			if !readSearchContextUpdate(dec, set) {
+				return "", nil, nil, dec.Err()
+			}
 		default:
 			if !dec.DiscardValue() {
-				return "", nil, dec.Err()
+				return "", nil, nil, dec.Err()
 			}
 		}
 
@@ -250,9 +497,36 @@ func readESearchResponse(dec *imapwire.Decoder) (tag string, data *imap.SearchDa
 		}
 
 		if !dec.ExpectAtom(&name) || !dec.ExpectSP() {
-			return "", nil, dec.Err()
+			return "", nil, nil, dec.Err()
 		}
 	}
 
-	return tag, data, nil
+	if update != nil {
+		update.uid = data.UID
+	}
+	return tag, data, update, nil
+}
+
+// readSearchContextUpdate reads the value of an ADDTO or REMOVEFROM search
+// return item:
+//
+//	"(" context-position SP sequence-set *(SP context-position SP sequence-set) ")"
+//
+// Positions are only meaningful for sorted results and are discarded.
+func readSearchContextUpdate(dec *imapwire.Decoder, set *imap.SeqSet) bool {
+	if !dec.ExpectSpecial('(') {
+		return false
+	}
+	for {
+		var pos uint32
+		var nums imap.SeqSet
+		if !dec.ExpectNumber(&pos) || !dec.ExpectSP() || !dec.ExpectSeqSet(&nums) {
+			return false
+		}
+		set.AddSet(nums)
+		if !dec.SP() {
+			break
+		}
+	}
+	return dec.ExpectSpecial(')')
 }
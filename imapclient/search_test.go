@@ -0,0 +1,188 @@
+package imapclient_test
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestSearchWithin(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 WITHIN] ready"},
+		exchanges: []corpusExchange{
+			{command: "T2 UID SEARCH (OLDER 3600 NOT (YOUNGER 60))", responses: []string{
+				"* SEARCH 2 3",
+				"T2 OK SEARCH completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+	if err := c.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+
+	// Intervals are sent as a whole number of seconds
+	invalid := &imap.SearchCriteria{Younger: 500 * time.Millisecond}
+	if _, err := c.UIDSearch(invalid, nil).Wait(); err == nil {
+		t.Errorf("UIDSearch() with a sub-second interval succeeded")
+	}
+
+	criteria := &imap.SearchCriteria{
+		Older: time.Hour,
+		Not:   []imap.SearchCriteria{{Younger: time.Minute}},
+	}
+	data, err := c.UIDSearch(criteria, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch() = %v", err)
+	}
+	if want := []uint32{2, 3}; !reflect.DeepEqual(data.AllNums(), want) {
+		t.Errorf("UIDSearch() = %v, want %v", data.AllNums(), want)
+	}
+}
+
+func TestSearchWithinUnsupported(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		<-done
+	}()
+	if err := c.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+
+	criteria := &imap.SearchCriteria{Or: [][2]imap.SearchCriteria{{{Older: time.Hour}, {Flag: []imap.Flag{imap.FlagSeen}}}}}
+	if _, err := c.Search(criteria, nil).Wait(); err == nil {
+		t.Errorf("Search() with OLDER succeeded without WITHIN")
+	}
+}
+
+func TestSearchModSeq(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 CONDSTORE] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 UID SEARCH (MODSEQ 620162338)", responses: []string{
+				"* SEARCH 2 5 6 (MODSEQ 917162500)",
+				"T1 OK SEARCH completed",
+			}},
+			{command: "T2 UID SEARCH (MODSEQ 917162501)", responses: []string{
+				"* SEARCH",
+				"T2 OK SEARCH completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	data, err := c.UIDSearch(&imap.SearchCriteria{ModSeq: &imap.SearchCriteriaModSeq{ModSeq: 620162338}}, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch() = %v", err)
+	}
+	if want := []uint32{2, 5, 6}; !reflect.DeepEqual(data.AllNums(), want) {
+		t.Errorf("UIDSearch() = %v, want %v", data.AllNums(), want)
+	}
+	if data.ModSeq != 917162500 {
+		t.Errorf("SearchData.ModSeq = %v, want 917162500", data.ModSeq)
+	}
+
+	// Without results, the server doesn't send a mod-sequence
+	data, err = c.UIDSearch(&imap.SearchCriteria{ModSeq: &imap.SearchCriteriaModSeq{ModSeq: 917162501}}, nil).Wait()
+	if err != nil {
+		t.Fatalf("UIDSearch() = %v", err)
+	}
+	if len(data.AllNums()) > 0 || data.ModSeq != 0 {
+		t.Errorf("UIDSearch() = %v (MODSEQ %v), want no results", data.AllNums(), data.ModSeq)
+	}
+}
+
+func TestSearchBadCharset(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 LITERAL+] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SEARCH CHARSET UTF-8 (BODY {5+}"},
+			{command: "café)", responses: []string{
+				"T1 NO [BADCHARSET (US-ASCII ISO-8859-1)] Unsupported charset",
+			}},
+			{command: "T2 SEARCH CHARSET ISO-8859-1 (BODY {4+}"},
+			{command: "caf\xe9)", responses: []string{
+				"* SEARCH 1 4",
+				"T2 OK SEARCH completed",
+			}},
+			{command: "T3 SEARCH CHARSET UTF-8 (BODY {6+}"},
+			{command: "日本)", responses: []string{
+				"T3 NO [BADCHARSET (US-ASCII ISO-8859-1)] Unsupported charset",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	cmd := c.Search(&imap.SearchCriteria{Body: []string{"café"}}, nil)
+	// The command is only retried once, even if Wait is called again
+	for i := 0; i < 2; i++ {
+		data, err := cmd.Wait()
+		if err != nil {
+			t.Fatalf("Search() = %v", err)
+		}
+		if want := []uint32{1, 4}; !reflect.DeepEqual(data.AllNums(), want) {
+			t.Errorf("Search() = %v, want %v", data.AllNums(), want)
+		}
+		if charset := cmd.Charset(); charset != "ISO-8859-1" {
+			t.Errorf("Charset() = %q, want ISO-8859-1", charset)
+		}
+	}
+
+	// The string can't be represented in any of the supported charsets
+	_, err := c.Search(&imap.SearchCriteria{Body: []string{"日本"}}, nil).Wait()
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeBadCharset {
+		t.Errorf("Search() = %v, want BADCHARSET error", err)
+	}
+}
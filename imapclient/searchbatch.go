@@ -0,0 +1,70 @@
+package imapclient
+
+import (
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// BatchUIDSearch searches the selected mailbox, and returns the UIDs of the
+// matching messages.
+//
+// If the criteria contain a large set of sequence numbers or UIDs, the set is
+// split into as many UID SEARCH commands as necessary to stay below
+// Client.MaxCommandLength, and the results are merged.
+func (c *Client) BatchUIDSearch(criteria *imap.SearchCriteria) (imap.UIDSet, error) {
+	criteria = criteria.Optimize()
+
+	// Split the longest set: the top-level keys are ANDed, so the results
+	// for each part of the set can be merged
+	longest, setUID := criteria.SeqNum, false
+	if len(criteria.UID.String()) > len(longest.String()) {
+		longest, setUID = criteria.UID, true
+	}
+
+	rest := *criteria
+	if setUID {
+		rest.UID = nil
+	} else {
+		rest.SeqNum = nil
+	}
+	budget, err := c.numSetLengthBudget("UID SEARCH", func(enc *imapwire.Encoder) {
+		if !searchCriteriaIsASCII(&rest) {
+			enc.Atom("CHARSET UTF-8").SP()
+		}
+		writeSearchKey(enc, &rest)
+		enc.SP().Atom("UID")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []*imap.SearchCriteria
+	if len(longest.String()) <= budget {
+		parts = []*imap.SearchCriteria{criteria}
+	} else {
+		for _, set := range longest.SplitLength(budget) {
+			part := rest
+			if setUID {
+				part.UID = set
+			} else {
+				part.SeqNum = set
+			}
+			parts = append(parts, &part)
+		}
+	}
+
+	cmds := make([]*SearchCommand, len(parts))
+	for i, part := range parts {
+		cmds[i] = c.UIDSearch(part, nil)
+	}
+
+	var uids imap.UIDSet
+	for _, cmd := range cmds {
+		data, err := cmd.Wait()
+		if err != nil {
+			return nil, err
+		}
+		uids.AddSet(imap.UIDSet(data.All))
+	}
+	return uids, nil
+}
@@ -0,0 +1,143 @@
+package imapclient
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/ianaindex"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// searchRetryCharset picks a charset from a BADCHARSET response which can
+// represent all strings of the search criteria, and returns the converted
+// criteria.
+//
+// Charsets unknown to golang.org/x/text are skipped.
+func searchRetryCharset(err error, criteria *imap.SearchCriteria) (charset string, encoded *imap.SearchCriteria, ok bool) {
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeBadCharset {
+		return "", nil, false
+	}
+	data, _ := imapErr.CodeData.(*imap.ResponseCodeBadCharsetData)
+	if data == nil {
+		return "", nil, false
+	}
+
+	for _, charset := range data.Charsets {
+		switch strings.ToUpper(charset) {
+		case "UTF-8", "US-ASCII":
+			continue // already tried
+		}
+		enc, err := ianaindex.MIME.Encoding(charset)
+		if err != nil || enc == nil {
+			continue
+		}
+		encoded, err := encodeSearchCriteria(criteria, enc.NewEncoder())
+		if err != nil {
+			continue // a string can't be represented in this charset
+		}
+		return charset, encoded, true
+	}
+	return "", nil, false
+}
+
+// encodeSearchCriteria converts all strings of the search criteria with the
+// provided encoder.
+func encodeSearchCriteria(criteria *imap.SearchCriteria, enc *encoding.Encoder) (*imap.SearchCriteria, error) {
+	encodeStrings := func(l []string) ([]string, error) {
+		if l == nil {
+			return nil, nil
+		}
+		out := make([]string, len(l))
+		for i, s := range l {
+			var err error
+			if out[i], err = enc.String(s); err != nil {
+				return nil, fmt.Errorf("imapclient: failed to encode search string: %v", err)
+			}
+		}
+		return out, nil
+	}
+
+	out := *criteria
+	var err error
+	if out.Body, err = encodeStrings(criteria.Body); err != nil {
+		return nil, err
+	}
+	if out.Text, err = encodeStrings(criteria.Text); err != nil {
+		return nil, err
+	}
+
+	out.Header = nil
+	for _, kv := range criteria.Header {
+		value, err := enc.String(kv.Value)
+		if err != nil {
+			return nil, fmt.Errorf("imapclient: failed to encode search string: %v", err)
+		}
+		out.Header = append(out.Header, imap.SearchCriteriaHeaderField{Key: kv.Key, Value: value})
+	}
+
+	out.Not = nil
+	for i := range criteria.Not {
+		not, err := encodeSearchCriteria(&criteria.Not[i], enc)
+		if err != nil {
+			return nil, err
+		}
+		out.Not = append(out.Not, *not)
+	}
+
+	out.Or = nil
+	for i := range criteria.Or {
+		left, err := encodeSearchCriteria(&criteria.Or[i][0], enc)
+		if err != nil {
+			return nil, err
+		}
+		right, err := encodeSearchCriteria(&criteria.Or[i][1], enc)
+		if err != nil {
+			return nil, err
+		}
+		out.Or = append(out.Or, [2]imap.SearchCriteria{*left, *right})
+	}
+
+	return &out, nil
+}
+
+// searchCriteriaIsASCII checks whether all strings of the search criteria
+// only contain US-ASCII characters.
+func searchCriteriaIsASCII(criteria *imap.SearchCriteria) bool {
+	for _, kv := range criteria.Header {
+		if !isASCII(kv.Key) || !isASCII(kv.Value) {
+			return false
+		}
+	}
+	for _, l := range [][]string{criteria.Body, criteria.Text} {
+		for _, s := range l {
+			if !isASCII(s) {
+				return false
+			}
+		}
+	}
+	for i := range criteria.Not {
+		if !searchCriteriaIsASCII(&criteria.Not[i]) {
+			return false
+		}
+	}
+	for i := range criteria.Or {
+		if !searchCriteriaIsASCII(&criteria.Or[i][0]) || !searchCriteriaIsASCII(&criteria.Or[i][1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -18,7 +18,7 @@ func (c *Client) Select(mailbox string) *SelectCommand {
 //
 // See Select.
 func (c *Client) Examine(mailbox string) *SelectCommand {
-	cmd := &SelectCommand{mailbox: mailbox}
+	cmd := &SelectCommand{mailbox: mailbox, readOnly: true}
 	enc := c.beginCommand("EXAMINE", cmd)
 	enc.SP().Mailbox(mailbox)
 	enc.end()
@@ -29,6 +29,7 @@ func (c *Client) Examine(mailbox string) *SelectCommand {
 //
 // This command requires support for IMAP4rev2 or the UNSELECT extension.
 func (c *Client) Unselect() *Command {
+	c.invalidateSelectedStatus()
 	cmd := &unselectCommand{}
 	c.beginCommand("UNSELECT", cmd).end()
 	return &cmd.cmd
@@ -38,6 +39,7 @@ func (c *Client) Unselect() *Command {
 //
 // CLOSE implicitly performs a silent EXPUNGE command.
 func (c *Client) UnselectAndExpunge() *Command {
+	c.invalidateSelectedStatus()
 	cmd := &unselectCommand{}
 	c.beginCommand("CLOSE", cmd).end()
 	return &cmd.cmd
@@ -85,11 +87,31 @@ func (c *Client) handleExists(num uint32) error {
 	return nil
 }
 
+func (c *Client) handleRecent(num uint32) error {
+	cmd := findPendingCmdByType[*SelectCommand](c)
+	if cmd != nil {
+		cmd.data.NumRecent = num
+	} else {
+		c.mutex.Lock()
+		if c.state == imap.ConnStateSelected {
+			c.mailbox = c.mailbox.copy()
+			c.mailbox.NumRecent = num
+		}
+		c.mutex.Unlock()
+
+		if handler := c.options.unilateralDataHandler().Mailbox; handler != nil {
+			handler(&UnilateralDataMailbox{NumRecent: &num})
+		}
+	}
+	return nil
+}
+
 // SelectCommand is a SELECT command.
 type SelectCommand struct {
 	cmd
-	mailbox string
-	data    imap.SelectData
+	mailbox  string
+	readOnly bool
+	data     imap.SelectData
 }
 
 func (cmd *SelectCommand) Wait() (*imap.SelectData, error) {
@@ -0,0 +1,201 @@
+package imapclient
+
+import (
+	"bytes"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// sentMailboxNames are common names of the Sent mailbox, used when the server
+// doesn't support SPECIAL-USE.
+var sentMailboxNames = []string{
+	"Sent",
+	"Sent Items",
+	"Sent Messages",
+	"Sent Mail",
+	"INBOX.Sent",
+	"INBOX/Sent",
+}
+
+// DuplicateDetection indicates whether AppendSent checks if a message is
+// already present in the Sent mailbox.
+type DuplicateDetection int
+
+const (
+	// Only check for duplicates on servers which are known to save sent
+	// messages automatically, such as Gmail
+	DuplicateDetectionAuto DuplicateDetection = iota
+	DuplicateDetectionAlways
+	DuplicateDetectionNever
+)
+
+// AppendSentOptions contains options for Client.AppendSent.
+type AppendSentOptions struct {
+	// Destination mailbox. If empty, the Sent mailbox is discovered with the
+	// \Sent special-use attribute, or with common mailbox names.
+	Mailbox string
+	// Submission time, used as the internal date of the message. If zero,
+	// the Date header field of the message is used, or the current time if
+	// missing.
+	Time time.Time
+	// Additional flags. \Seen is always set.
+	Flags []imap.Flag
+	// Whether to check if the message has already been saved by the server,
+	// based on its Message-Id header field.
+	DuplicateDetection DuplicateDetection
+}
+
+// AppendSentData is the data returned by Client.AppendSent.
+type AppendSentData struct {
+	Mailbox string
+	// Whether the message was already present in the mailbox, in which case
+	// it hasn't been appended again
+	Duplicate bool
+	// UID of the message, if known
+	UID uint32
+}
+
+// AppendSent saves an outgoing message in the Sent mailbox.
+//
+// Detecting duplicates requires examining the Sent mailbox. The previously
+// selected mailbox, if any, is selected again afterwards.
+func (c *Client) AppendSent(msg []byte, options *AppendSentOptions) (*AppendSentData, error) {
+	if options == nil {
+		options = new(AppendSentOptions)
+	}
+
+	var header mail.Header
+	if m, err := mail.ReadMessage(bytes.NewReader(msg)); err == nil {
+		header = m.Header
+	}
+
+	mailbox := options.Mailbox
+	if mailbox == "" {
+		var err error
+		mailbox, err = c.findSentMailbox()
+		if err != nil {
+			return nil, err
+		}
+	}
+	data := &AppendSentData{Mailbox: mailbox}
+
+	detect := options.DuplicateDetection == DuplicateDetectionAlways
+	if options.DuplicateDetection == DuplicateDetectionAuto {
+		detect = c.ServerInfo().Vendor == ServerVendorGmail
+	}
+	if msgID := strings.Trim(header.Get("Message-Id"), " <>"); detect && msgID != "" {
+		uid, err := c.findSentDuplicate(mailbox, msgID)
+		if err != nil {
+			return nil, err
+		} else if uid != 0 {
+			data.Duplicate = true
+			data.UID = uid
+			return data, nil
+		}
+	}
+
+	t := options.Time
+	if t.IsZero() {
+		if date, err := header.Date(); err == nil {
+			t = date
+		} else {
+			t = time.Now()
+		}
+	}
+
+	flags := []imap.Flag{imap.FlagSeen}
+	for _, flag := range options.Flags {
+		if !strings.EqualFold(string(flag), string(imap.FlagSeen)) {
+			flags = append(flags, flag)
+		}
+	}
+
+	cmd := c.Append(mailbox, int64(len(msg)), &imap.AppendOptions{
+		Flags: flags,
+		Time:  t,
+	})
+	if _, err := cmd.Write(msg); err != nil {
+		cmd.Close()
+		cmd.Wait()
+		return nil, err
+	}
+	if err := cmd.Close(); err != nil {
+		cmd.Wait()
+		return nil, err
+	}
+	appendData, err := cmd.Wait()
+	if err != nil {
+		return nil, err
+	}
+	data.UID = appendData.UID
+	return data, nil
+}
+
+// findSentMailbox returns the name of the Sent mailbox.
+func (c *Client) findSentMailbox() (string, error) {
+	mailboxes, err := c.List("", "*", nil).Collect()
+	if err != nil {
+		return "", err
+	}
+
+	for _, data := range mailboxes {
+		for _, attr := range data.Attrs {
+			if attr == imap.MailboxAttrSent {
+				return data.Mailbox, nil
+			}
+		}
+	}
+
+	for _, name := range sentMailboxNames {
+		for _, data := range mailboxes {
+			if strings.EqualFold(data.Mailbox, name) {
+				return data.Mailbox, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("imapclient: Sent mailbox not found")
+}
+
+// findSentDuplicate returns the UID of a message with the provided message
+// identifier in a mailbox, or zero if there is none.
+func (c *Client) findSentDuplicate(mailbox, msgID string) (uint32, error) {
+	prev := c.Mailbox()
+	if prev == nil || !sameMailbox(prev.Name, mailbox) {
+		if _, err := c.Examine(mailbox).Wait(); err != nil {
+			return 0, err
+		}
+	}
+
+	searchData, searchErr := c.UIDSearch(&imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "Message-Id", Value: msgID}},
+	}, nil).Wait()
+
+	var restoreErr error
+	if prev == nil && c.Caps().Has(imap.CapUnselect) {
+		restoreErr = c.Unselect().Wait()
+	} else if prev == nil {
+		// The mailbox is read-only, CLOSE doesn't expunge messages
+		restoreErr = c.UnselectAndExpunge().Wait()
+	} else if !sameMailbox(prev.Name, mailbox) && prev.ReadOnly {
+		_, restoreErr = c.Examine(prev.Name).Wait()
+	} else if !sameMailbox(prev.Name, mailbox) {
+		_, restoreErr = c.Select(prev.Name).Wait()
+	}
+
+	if searchErr != nil {
+		return 0, searchErr
+	} else if restoreErr != nil {
+		return 0, restoreErr
+	}
+
+	uids := searchData.AllNums()
+	if len(uids) == 0 {
+		return 0, nil
+	}
+	return uids[0], nil
+}
@@ -0,0 +1,36 @@
+package imapclient_test
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestAppendSentRestoresReadOnly(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if err := c.Create("Sent").Wait(); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := c.Examine("INBOX").Wait(); err != nil {
+		t.Fatalf("Examine() = %v", err)
+	}
+
+	msg := "Message-Id: <sent@example.org>\r\nSubject: Sent\r\n\r\nHi\r\n"
+	if _, err := c.AppendSent([]byte(msg), &imapclient.AppendSentOptions{
+		Mailbox:            "Sent",
+		DuplicateDetection: imapclient.DuplicateDetectionAlways,
+	}); err != nil {
+		t.Fatalf("AppendSent() = %v", err)
+	}
+
+	mbox := c.Mailbox()
+	if mbox == nil || mbox.Name != "INBOX" {
+		t.Fatalf("Mailbox() = %v, want INBOX", mbox)
+	}
+	if !mbox.ReadOnly {
+		t.Errorf("INBOX has been selected read-write, want EXAMINE")
+	}
+}
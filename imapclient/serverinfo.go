@@ -0,0 +1,123 @@
+package imapclient
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// ServerVendor identifies a server implementation.
+type ServerVendor string
+
+const (
+	ServerVendorUnknown ServerVendor = ""
+	ServerVendorDovecot ServerVendor = "dovecot"
+	ServerVendorCyrus   ServerVendor = "cyrus"
+	ServerVendorGmail   ServerVendor = "gmail"
+	ServerVendorOutlook ServerVendor = "outlook" // Outlook.com and Exchange
+	ServerVendorCourier ServerVendor = "courier"
+	ServerVendorZimbra  ServerVendor = "zimbra"
+)
+
+// ServerInfo contains information about the server implementation.
+//
+// The vendor is guessed from the greeting, the capabilities and the ID
+// response, if any. Servers can hide or fake this information: it should only
+// be used to work around known server bugs, never for security decisions.
+type ServerInfo struct {
+	Vendor ServerVendor
+	// Text of the server greeting
+	Greeting string
+	// Fields sent by the server in response to the last ID command, nil if
+	// the ID command hasn't been sent
+	ID map[string]string
+}
+
+// ServerInfo returns information about the server.
+//
+// The information is filled in once the greeting has been received, and
+// updated when the capabilities change or when an ID response is received.
+// ServerInfo waits for the greeting and, if Options.ID is set, for the ID
+// command sent after the greeting to complete.
+//
+// This function may send a CAPABILITY command if the capabilities aren't
+// known yet.
+func (c *Client) ServerInfo() *ServerInfo {
+	<-c.serverInfoCh
+	c.Caps()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	info := c.serverInfo
+	return &info
+}
+
+func (c *Client) updateServerInfoLocked() {
+	c.serverInfo.Vendor = detectServerVendor(c.serverInfo.Greeting, c.caps, c.serverInfo.ID)
+}
+
+// identify sends the ID command configured in Options.ID, if the server
+// supports it.
+func (c *Client) identify() {
+	defer c.serverInfoDone()
+	if !c.Caps().Has(imap.CapID) {
+		return
+	}
+	// The response is informational: errors are ignored
+	c.ID(c.options.ID).Wait()
+}
+
+func (c *Client) serverInfoDone() {
+	c.serverInfoOnce.Do(func() {
+		close(c.serverInfoCh)
+	})
+}
+
+var serverVendorFingerprints = []struct {
+	vendor   ServerVendor
+	keywords []string // lower-case
+}{
+	{ServerVendorDovecot, []string{"dovecot"}},
+	{ServerVendorCyrus, []string{"cyrus"}},
+	{ServerVendorGmail, []string{"gimap", "gmail"}},
+	{ServerVendorOutlook, []string{"microsoft exchange", "outlook"}},
+	{ServerVendorCourier, []string{"courier"}},
+	{ServerVendorZimbra, []string{"zimbra"}},
+}
+
+func detectServerVendor(greeting string, caps imap.CapSet, id map[string]string) ServerVendor {
+	// The ID name is the most reliable source, then vendor-specific
+	// capabilities, then the greeting text
+	if vendor := matchServerVendor(id["name"]); vendor != ServerVendorUnknown {
+		return vendor
+	}
+	if vendor := matchServerVendor(id["vendor"]); vendor != ServerVendorUnknown {
+		return vendor
+	}
+
+	switch {
+	case caps.Has("X-GM-EXT-1"):
+		return ServerVendorGmail
+	case caps.Has("XCOURIEROUTBOX"):
+		return ServerVendorCourier
+	case caps.Has("X-CYRUS-BACKUP") || caps.Has("X-REPLICATION"):
+		return ServerVendorCyrus
+	}
+
+	return matchServerVendor(greeting)
+}
+
+func matchServerVendor(s string) ServerVendor {
+	s = strings.ToLower(s)
+	if s == "" {
+		return ServerVendorUnknown
+	}
+	for _, fp := range serverVendorFingerprints {
+		for _, kw := range fp.keywords {
+			if strings.Contains(s, kw) {
+				return fp.vendor
+			}
+		}
+	}
+	return ServerVendorUnknown
+}
@@ -0,0 +1,76 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestServerInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  *corpusFixture
+		id       map[string]string
+		vendor   imapclient.ServerVendor
+		serverID map[string]string
+	}{
+		{
+			name: "greeting",
+			fixture: &corpusFixture{
+				greeting: []string{"* OK [CAPABILITY IMAP4rev1 ID] Dovecot ready."},
+			},
+			vendor: imapclient.ServerVendorDovecot,
+		},
+		{
+			name: "id",
+			fixture: &corpusFixture{
+				greeting: []string{"* OK [CAPABILITY IMAP4rev1 ID] IMAP server ready"},
+				exchanges: []corpusExchange{
+					{command: `T1 ID ("name" "example")`, responses: []string{
+						`* ID ("name" "Cyrus IMAP" "version" "3.8")`,
+						"T1 OK ID completed",
+					}},
+				},
+			},
+			id:       map[string]string{"name": "example"},
+			vendor:   imapclient.ServerVendorCyrus,
+			serverID: map[string]string{"name": "Cyrus IMAP", "version": "3.8"},
+		},
+		{
+			// The ID command isn't sent if the server doesn't support it
+			name: "id-unsupported",
+			fixture: &corpusFixture{
+				greeting: []string{"* OK [CAPABILITY IMAP4rev1] IMAP server ready"},
+			},
+			id:     map[string]string{"name": "example"},
+			vendor: imapclient.ServerVendorUnknown,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			clientConn, serverConn := net.Pipe()
+			done := make(chan error, 1)
+			go func() {
+				done <- tc.fixture.serve(serverConn)
+			}()
+			c := imapclient.New(clientConn, &imapclient.Options{ID: tc.id})
+			defer func() {
+				c.Close()
+				if err := <-done; err != nil {
+					t.Errorf("transcript: %v", err)
+				}
+			}()
+
+			info := c.ServerInfo()
+			if info.Vendor != tc.vendor {
+				t.Errorf("ServerInfo().Vendor = %q, want %q", info.Vendor, tc.vendor)
+			}
+			if !reflect.DeepEqual(info.ID, tc.serverID) {
+				t.Errorf("ServerInfo().ID = %v, want %v", info.ID, tc.serverID)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package imapclient
 
 import (
-	"bufio"
 	"bytes"
 	"crypto/tls"
 	"io"
@@ -50,12 +49,12 @@ func (c *Client) upgradeStartTLS(tlsConfig *tls.Config) {
 	}
 
 	tlsConn := tls.Client(cleartextConn, tlsConfig)
-	rw := c.options.wrapReadWriter(tlsConn)
+	rw := tracingReadWriter{countingReadWriter{tlsConn, c.counters}, c.tracer}
 
 	c.br.Reset(rw)
 	// Unfortunately we can't re-use the bufio.Writer here, it races with
 	// Client.StartTLS
-	c.bw = bufio.NewWriter(rw)
+	c.setWriter(rw)
 }
 
 type startTLSCommand struct {
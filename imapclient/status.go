@@ -9,8 +9,21 @@ import (
 )
 
 // Status sends a STATUS command.
+//
+// If Options.StatusCacheTTL is set and the cache contains all of the
+// requested items, no command is sent.
 func (c *Client) Status(mailbox string, items []imap.StatusItem) *StatusCommand {
 	cmd := &StatusCommand{mailbox: mailbox}
+	if c.statusCache != nil {
+		var data *imap.StatusData
+		data, cmd.gen = c.statusCache.lookup(mailbox, items)
+		if data != nil {
+			cmd.data = *data
+			cmd.cached = true
+			return cmd
+		}
+	}
+
 	enc := c.beginCommand("STATUS", cmd)
 	enc.SP().Mailbox(mailbox).SP()
 	enc.List(len(items), func(i int) {
@@ -29,7 +42,7 @@ func (c *Client) handleStatus() error {
 	cmd := c.findPendingCmdFunc(func(cmd command) bool {
 		switch cmd := cmd.(type) {
 		case *StatusCommand:
-			return cmd.mailbox == data.Mailbox
+			return imap.MailboxName{Name: cmd.mailbox}.Equal(imap.MailboxName{Name: data.Mailbox})
 		case *ListCommand:
 			return cmd.returnStatus && cmd.pendingData != nil && cmd.pendingData.Mailbox == data.Mailbox
 		default:
@@ -37,6 +50,8 @@ func (c *Client) handleStatus() error {
 		}
 	})
 	switch cmd := cmd.(type) {
+	case nil:
+		c.statusCache.invalidate(data.Mailbox)
 	case *StatusCommand:
 		cmd.data = *data
 	case *ListCommand:
@@ -53,9 +68,14 @@ type StatusCommand struct {
 	cmd
 	mailbox string
 	data    imap.StatusData
+	gen     uint64 // status cache generation
+	cached  bool   // no command has been sent
 }
 
 func (cmd *StatusCommand) Wait() (*imap.StatusData, error) {
+	if cmd.cached {
+		return &cmd.data, nil
+	}
 	return &cmd.data, cmd.cmd.Wait()
 }
 
@@ -116,6 +136,10 @@ func readStatusAttVal(dec *imapwire.Decoder, data *imap.StatusData) error {
 		var storage int64
 		ok = dec.ExpectNumber64(&storage)
 		data.DeletedStorage = &storage
+	case imap.StatusItemNumRecent:
+		var num uint32
+		ok = dec.ExpectNumber(&num)
+		data.NumRecent = &num
 	default:
 		if !dec.DiscardValue() {
 			return dec.Err()
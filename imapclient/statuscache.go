@@ -0,0 +1,172 @@
+package imapclient
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// StatusCacheStats contains statistics about the STATUS cache. See
+// Options.StatusCacheTTL.
+type StatusCacheStats struct {
+	// Number of Status calls answered from the cache
+	Hits uint64
+	// Number of Status calls which resulted in a STATUS command
+	Misses uint64
+}
+
+type statusCacheEntry struct {
+	data    imap.StatusData
+	expires time.Time
+}
+
+// statusCache caches STATUS results per mailbox.
+//
+// The generation is incremented on each invalidation. STATUS responses are
+// only stored if the generation hasn't changed since the command was sent,
+// to avoid caching data which may be stale already.
+type statusCache struct {
+	ttl time.Duration
+
+	mutex   sync.Mutex
+	entries map[string]statusCacheEntry
+	gen     uint64
+	stats   StatusCacheStats
+}
+
+func newStatusCache(ttl time.Duration) *statusCache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &statusCache{
+		ttl:     ttl,
+		entries: make(map[string]statusCacheEntry),
+	}
+}
+
+// lookup returns the cached data for a mailbox if it contains all items, and
+// the current generation.
+func (cache *statusCache) lookup(mailbox string, items []imap.StatusItem) (*imap.StatusData, uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	entry, ok := cache.entries[statusCacheKey(mailbox)]
+	if ok && time.Now().After(entry.expires) {
+		delete(cache.entries, statusCacheKey(mailbox))
+		ok = false
+	}
+	if !ok || !statusDataHasItems(&entry.data, items) {
+		cache.stats.Misses++
+		return nil, cache.gen
+	}
+	cache.stats.Hits++
+	data := entry.data
+	data.Mailbox = mailbox
+	return &data, cache.gen
+}
+
+func (cache *statusCache) store(mailbox string, data *imap.StatusData, gen uint64) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if gen != cache.gen {
+		return
+	}
+	cache.entries[statusCacheKey(mailbox)] = statusCacheEntry{
+		data:    *data,
+		expires: time.Now().Add(cache.ttl),
+	}
+}
+
+func (cache *statusCache) invalidate(mailbox string) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.gen++
+	delete(cache.entries, statusCacheKey(mailbox))
+}
+
+func (cache *statusCache) invalidateAll() {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.gen++
+	cache.entries = make(map[string]statusCacheEntry)
+}
+
+func statusCacheKey(mailbox string) string {
+	if strings.EqualFold(mailbox, "INBOX") {
+		return "INBOX"
+	}
+	return mailbox
+}
+
+func statusDataHasItems(data *imap.StatusData, items []imap.StatusItem) bool {
+	for _, item := range items {
+		var ok bool
+		switch item {
+		case imap.StatusItemNumMessages:
+			ok = data.NumMessages != nil
+		case imap.StatusItemUIDNext:
+			ok = data.UIDNext != 0
+		case imap.StatusItemUIDValidity:
+			ok = data.UIDValidity != 0
+		case imap.StatusItemNumUnseen:
+			ok = data.NumUnseen != nil
+		case imap.StatusItemNumDeleted:
+			ok = data.NumDeleted != nil
+		case imap.StatusItemSize:
+			ok = data.Size != nil
+		case imap.StatusItemAppendLimit:
+			ok = data.AppendLimit != nil
+		case imap.StatusItemDeletedStorage:
+			ok = data.DeletedStorage != nil
+		case imap.StatusItemNumRecent:
+			ok = data.NumRecent != nil
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// InvalidateStatus removes a mailbox from the STATUS cache. Applications
+// which learn about mailbox changes by other means, e.g. NOTIFY events, can
+// use it to get fresh data on the next Status call.
+//
+// If the mailbox is empty, the whole cache is cleared.
+func (c *Client) InvalidateStatus(mailbox string) {
+	if mailbox == "" {
+		c.statusCache.invalidateAll()
+	} else {
+		c.statusCache.invalidate(mailbox)
+	}
+}
+
+// StatusCacheStats returns statistics about the STATUS cache.
+func (c *Client) StatusCacheStats() StatusCacheStats {
+	if c.statusCache == nil {
+		return StatusCacheStats{}
+	}
+	c.statusCache.mutex.Lock()
+	defer c.statusCache.mutex.Unlock()
+	return c.statusCache.stats
+}
+
+// invalidateSelectedStatus removes the selected mailbox from the STATUS
+// cache.
+func (c *Client) invalidateSelectedStatus() {
+	if c.statusCache == nil {
+		return
+	}
+	if mbox := c.Mailbox(); mbox != nil {
+		c.statusCache.invalidate(mbox.Name)
+	}
+}
@@ -0,0 +1,80 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestStatusCache(t *testing.T) {
+	var debug bytes.Buffer
+	c := newTestClient(t, &imapclient.Options{
+		DebugWriter:    &debug,
+		StatusCacheTTL: time.Hour,
+	})
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	items := []imap.StatusItem{imap.StatusItemNumMessages}
+	for i := 0; i < 2; i++ {
+		data, err := c.Status("INBOX", items).Wait()
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		} else if *data.NumMessages != 0 {
+			t.Errorf("Status() = %v messages, want 0", *data.NumMessages)
+		}
+	}
+	if n := strings.Count(debug.String(), "STATUS INBOX (MESSAGES)\r\n"); n != 1 {
+		t.Errorf("sent %v STATUS commands, want 1", n)
+	}
+	if stats := c.StatusCacheStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("StatusCacheStats() = %+v, want 1 hit and 1 miss", stats)
+	}
+}
+
+func TestStatusCacheClose(t *testing.T) {
+	c := newTestClient(t, &imapclient.Options{StatusCacheTTL: time.Hour})
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	msg := "Subject: deleted\r\n\r\nBye\r\n"
+	appendCmd := c.Append("INBOX", int64(len(msg)), &imap.AppendOptions{
+		Flags: []imap.Flag{imap.FlagDeleted},
+	})
+	if _, err := appendCmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	items := []imap.StatusItem{imap.StatusItemNumMessages}
+	if data, err := c.Status("INBOX", items).Wait(); err != nil {
+		t.Fatalf("Status() = %v", err)
+	} else if *data.NumMessages != 1 {
+		t.Fatalf("Status() = %v messages, want 1", *data.NumMessages)
+	}
+
+	// CLOSE silently expunges the message
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+	if err := c.UnselectAndExpunge().Wait(); err != nil {
+		t.Fatalf("UnselectAndExpunge() = %v", err)
+	}
+
+	if data, err := c.Status("INBOX", items).Wait(); err != nil {
+		t.Fatalf("Status() = %v", err)
+	} else if *data.NumMessages != 0 {
+		t.Errorf("Status() after CLOSE = %v messages, want 0", *data.NumMessages)
+	}
+}
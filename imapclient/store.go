@@ -4,12 +4,28 @@ import (
 	"fmt"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-func (c *Client) store(uid bool, seqSet imap.SeqSet, store *imap.StoreFlags) *FetchCommand {
-	cmd := &FetchCommand{msgs: make(chan *FetchMessageData, 128)}
-	enc := c.beginCommand(uidCmdName("STORE", uid), cmd)
-	enc.SP().Atom(seqSet.String()).SP()
+func (c *Client) store(uid bool, numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	c.invalidateSelectedStatus()
+	cmd := &FetchCommand{
+		uid:    uid,
+		numSet: numSet,
+		msgs:   make(chan *FetchMessageData, c.options.queueSize()),
+	}
+	arg, err := numSetArg(numSet)
+	enc := c.beginFailedCommand(uidCmdName("STORE", uid), cmd, err)
+	enc.SP().Atom(arg).SP()
+	writeStoreArgs(enc.Encoder, store, options)
+	enc.end()
+	return cmd
+}
+
+func writeStoreArgs(enc *imapwire.Encoder, store *imap.StoreFlags, options *imap.StoreOptions) {
+	if options != nil && options.UnchangedSince > 0 {
+		enc.Special('(').Atom("UNCHANGEDSINCE").SP().Number64(int64(options.UnchangedSince)).Special(')').SP()
+	}
 	switch store.Op {
 	case imap.StoreFlagsSet:
 		// nothing to do
@@ -27,20 +43,38 @@ func (c *Client) store(uid bool, seqSet imap.SeqSet, store *imap.StoreFlags) *Fe
 	enc.SP().List(len(store.Flags), func(i int) {
 		enc.Flag(store.Flags[i])
 	})
-	enc.end()
-	return cmd
 }
 
 // Store sends a STORE command.
 //
 // Unless StoreFlags.Silent is set, the server will return the updated values.
-func (c *Client) Store(seqSet imap.SeqSet, store *imap.StoreFlags) *FetchCommand {
-	return c.store(false, seqSet, store)
+//
+// If numSet is an imap.UIDSet, a UID STORE command is sent.
+func (c *Client) Store(numSet imap.NumSet, store *imap.StoreFlags) *FetchCommand {
+	return c.store(isUIDSet(numSet), numSet, store, nil)
 }
 
-// UIDStore sends a UID STORE command.
+// UIDStore sends a UID STORE command. A SeqSet is interpreted as a set of
+// UIDs.
 //
 // See Store.
-func (c *Client) UIDStore(seqSet imap.SeqSet, store *imap.StoreFlags) *FetchCommand {
-	return c.store(true, seqSet, store)
+func (c *Client) UIDStore(numSet imap.NumSet, store *imap.StoreFlags) *FetchCommand {
+	return c.store(true, numSet, store, nil)
+}
+
+// StoreWithOptions sends a STORE command with modifiers.
+//
+// If StoreOptions.UnchangedSince is set, the messages which haven't been
+// altered are available via FetchCommand.Modified.
+//
+// See Store.
+func (c *Client) StoreWithOptions(numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	return c.store(isUIDSet(numSet), numSet, store, options)
+}
+
+// UIDStoreWithOptions sends a UID STORE command with modifiers.
+//
+// See StoreWithOptions.
+func (c *Client) UIDStoreWithOptions(numSet imap.NumSet, store *imap.StoreFlags, options *imap.StoreOptions) *FetchCommand {
+	return c.store(true, numSet, store, options)
 }
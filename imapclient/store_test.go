@@ -0,0 +1,154 @@
+package imapclient_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestBatchStore(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 CONDSTORE] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 8 EXISTS",
+				"* OK [UIDVALIDITY 1] UIDs valid",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: `T2 UID STORE 1:3 (UNCHANGEDSINCE 10) +FLAGS.SILENT (\Seen)`, responses: []string{
+				"T2 OK [MODIFIED 2] Conditional STORE failed",
+			}},
+			{command: `T3 UID STORE 4:5,8 (UNCHANGEDSINCE 10) +FLAGS.SILENT (\Seen)`, responses: []string{
+				"T3 NO STORE failed",
+			}},
+			{command: `T4 STORE 1:2 (UNCHANGEDSINCE 12) FLAGS (\Flagged)`, responses: []string{
+				`* 1 FETCH (FLAGS (\Flagged) MODSEQ (13))`,
+				"T4 OK [MODIFIED 2] Conditional STORE failed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	// Dynamic sets are rejected without sending any command
+	store := &imap.StoreFlags{Op: imap.StoreFlagsAdd, Silent: true, Flags: []imap.Flag{imap.FlagSeen}}
+	if _, err := c.BatchStore(imap.UIDSetRange(1, 0), store, nil); err == nil {
+		t.Errorf("BatchStore() with a dynamic set succeeded")
+	}
+
+	uids := imap.UIDSet{imap.Seq{Start: 1, Stop: 5}, imap.Seq{Start: 8, Stop: 8}}
+	report, err := c.BatchStore(uids, store, &imapclient.BatchStoreOptions{
+		ChunkSize:      3,
+		UnchangedSince: 10,
+	})
+	if err != nil {
+		t.Fatalf("BatchStore() = %v", err)
+	}
+	if s := report.Succeeded.String(); s != "1,3" {
+		t.Errorf("Succeeded = %v, want 1,3", s)
+	}
+	if s := report.Conflicted.String(); s != "2" {
+		t.Errorf("Conflicted = %v, want 2", s)
+	}
+	if s := report.Failed.String(); s != "4:5,8" {
+		t.Errorf("Failed = %v, want 4:5,8", s)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].UIDs.String() != "4:5,8" {
+		t.Errorf("Errors = %v, want one error for 4:5,8", report.Errors)
+	} else if _, ok := report.Errors[0].Err.(*imap.Error); !ok {
+		t.Errorf("Errors[0].Err = %v, want an *imap.Error", report.Errors[0].Err)
+	}
+
+	cmd := c.StoreWithOptions(imap.SeqSetRange(1, 2), &imap.StoreFlags{
+		Op:    imap.StoreFlagsSet,
+		Flags: []imap.Flag{imap.FlagFlagged},
+	}, &imap.StoreOptions{UnchangedSince: 12})
+	msgs, err := cmd.Collect()
+	if err != nil {
+		t.Fatalf("StoreWithOptions() = %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].SeqNum != 1 || msgs[0].ModSeq != 13 {
+		t.Errorf("StoreWithOptions() returned %v", msgs)
+	}
+	if s := cmd.Modified().String(); s != "2" {
+		t.Errorf("Modified() = %v, want 2", s)
+	}
+}
+
+func TestStoreUnsolicitedFetch(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 5 EXISTS",
+				"* OK [UIDVALIDITY 1] UIDs valid",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: `T2 STORE 1 +FLAGS (\Seen)`, responses: []string{
+				`* 5 FETCH (FLAGS (\Deleted))`,
+				`* 1 FETCH (FLAGS (\Seen))`,
+				"T2 OK STORE completed",
+			}},
+		},
+	}
+
+	unilateral := make(chan uint32, 1)
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Fetch: func(msg *imapclient.FetchMessageData) {
+				unilateral <- msg.SeqNum
+				msg.Collect()
+			},
+		},
+	})
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	store := &imap.StoreFlags{Op: imap.StoreFlagsAdd, Flags: []imap.Flag{imap.FlagSeen}}
+	msgs, err := c.Store(imap.SeqSetNum(1), store).Collect()
+	if err != nil {
+		t.Fatalf("Store() = %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].SeqNum != 1 {
+		t.Errorf("Store() returned %v messages, want message 1 only", len(msgs))
+	}
+	select {
+	case seqNum := <-unilateral:
+		if seqNum != 5 {
+			t.Errorf("unilateral FETCH for message %v, want 5", seqNum)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("FETCH for message 5 not passed to the unilateral handler")
+	}
+}
@@ -0,0 +1,152 @@
+package imapclient
+
+import (
+	"fmt"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+const defaultBatchStoreChunkSize = 1000
+
+// BatchStoreOptions contains options for Client.BatchStore.
+type BatchStoreOptions struct {
+	// Number of UIDs per UID STORE command, defaults to 1000
+	ChunkSize int
+	// Only alter messages whose mod-sequence is less than or equal to this
+	// value. Requires CONDSTORE.
+	UnchangedSince uint64
+}
+
+// BatchStoreError is the error returned by a failed chunk of a batch STORE.
+type BatchStoreError struct {
+	UIDs imap.UIDSet
+	Err  error
+}
+
+// BatchStoreReport describes the outcome of Client.BatchStore.
+//
+// It can be used to retry the failed UIDs, or to roll back the change for the
+// UIDs which have been altered.
+type BatchStoreReport struct {
+	// UIDs whose STORE command succeeded. This includes UIDs which don't
+	// exist in the mailbox.
+	Succeeded imap.UIDSet
+	// UIDs whose STORE command failed
+	Failed imap.UIDSet
+	// UIDs which haven't been altered because they failed the
+	// UNCHANGEDSINCE test
+	Conflicted imap.UIDSet
+	// Errors returned by the failed chunks
+	Errors []BatchStoreError
+}
+
+// BatchStore applies a flag change to a potentially large set of UIDs in the
+// selected mailbox, with one UID STORE command per chunk. Chunks are split
+// further to stay below Client.MaxCommandLength.
+//
+// A failed chunk doesn't stop the operation: its UIDs are reported as failed
+// and the next chunks are sent. An error is returned if the UID set is
+// dynamic, or if the connection is lost, in which case the remaining UIDs are
+// reported as failed.
+func (c *Client) BatchStore(uids imap.UIDSet, store *imap.StoreFlags, options *BatchStoreOptions) (*BatchStoreReport, error) {
+	if options == nil {
+		options = new(BatchStoreOptions)
+	}
+	chunkSize := defaultBatchStoreChunkSize
+	if options.ChunkSize > 0 {
+		chunkSize = options.ChunkSize
+	}
+	if uids.Dynamic() {
+		return nil, fmt.Errorf("imapclient: batch STORE requires a static UID set")
+	}
+	if options.UnchangedSince > 0 && !c.Caps().Has(imap.CapCondStore) {
+		return nil, fmt.Errorf("imapclient: UNCHANGEDSINCE requires CONDSTORE")
+	}
+
+	var storeOptions *imap.StoreOptions
+	if options.UnchangedSince > 0 {
+		storeOptions = &imap.StoreOptions{UnchangedSince: options.UnchangedSince}
+	}
+
+	budget, err := c.numSetLengthBudget("UID STORE", func(enc *imapwire.Encoder) {
+		writeStoreArgs(enc, store, storeOptions)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report := new(BatchStoreReport)
+	var chunks []imap.UIDSet
+	for _, chunk := range chunkUIDSet(uids, chunkSize) {
+		for _, set := range imap.SeqSet(chunk).SplitLength(budget) {
+			chunks = append(chunks, imap.UIDSet(set))
+		}
+	}
+	for i, chunk := range chunks {
+		cmd := c.UIDStoreWithOptions(chunk, store, storeOptions)
+		err := cmd.Close()
+		if err != nil {
+			report.Failed.AddSet(chunk)
+			report.Errors = append(report.Errors, BatchStoreError{UIDs: chunk, Err: err})
+			if connErr := c.Err(); connErr != nil {
+				for _, rest := range chunks[i+1:] {
+					report.Failed.AddSet(rest)
+				}
+				return report, err
+			}
+			continue
+		}
+
+		modified := imap.UIDSet(cmd.Modified())
+		if len(modified) == 0 {
+			report.Succeeded.AddSet(chunk)
+			continue
+		}
+		for _, r := range chunk {
+			for uid := r.Start; ; uid++ {
+				if modified.Contains(uid) {
+					report.Conflicted.AddNum(uid)
+				} else {
+					report.Succeeded.AddNum(uid)
+				}
+				if uid == r.Stop {
+					break
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// chunkUIDSet splits a static UID set into sets of at most n UIDs.
+func chunkUIDSet(uids imap.UIDSet, n int) []imap.UIDSet {
+	var (
+		chunks []imap.UIDSet
+		chunk  imap.UIDSet
+		size   int
+	)
+	for _, r := range imap.SeqSet(uids).Canonical() {
+		start := r.Start
+		for {
+			stop := r.Stop
+			if remaining := uint32(n - size); stop-start+1 > remaining {
+				stop = start + remaining - 1
+			}
+			chunk.AddRange(start, stop)
+			size += int(stop - start + 1)
+			if size == n {
+				chunks = append(chunks, chunk)
+				chunk, size = nil, 0
+			}
+			if stop == r.Stop {
+				break
+			}
+			start = stop + 1
+		}
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,31 @@
+package imapclient
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestChunkUIDSet(t *testing.T) {
+	testCases := []struct {
+		uids imap.UIDSet
+		n    int
+		want []string
+	}{
+		{imap.UIDSetRange(1, 10), 4, []string{"1:4", "5:8", "9:10"}},
+		{imap.UIDSetNum(1, 3, 5, 7), 2, []string{"1,3", "5,7"}},
+		{imap.UIDSet{imap.Seq{Start: 8, Stop: 9}, imap.Seq{Start: 1, Stop: 3}}, 2, []string{"1:2", "3,8", "9"}},
+		{imap.UIDSetRange(4294967290, 4294967295), 4, []string{"4294967290:4294967293", "4294967294:4294967295"}},
+		{nil, 4, nil},
+	}
+	for _, tc := range testCases {
+		var got []string
+		for _, chunk := range chunkUIDSet(tc.uids, tc.n) {
+			got = append(got, chunk.String())
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("chunkUIDSet(%v, %v) = %v, want %v", tc.uids, tc.n, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package imapclient_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestTagGenerator(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "proxy-0001 NOOP", responses: []string{"proxy-0001 OK NOOP completed"}},
+			{command: "proxy-0002 NOOP", responses: []string{"proxy-0002 OK NOOP completed"}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, &imapclient.Options{
+		TagGenerator: func(n uint64) string {
+			return fmt.Sprintf("proxy-%04d", n)
+		},
+	})
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	for _, want := range []string{"proxy-0001", "proxy-0002"} {
+		cmd := c.Noop()
+		if tag := cmd.Tag(); tag != want {
+			t.Errorf("Tag() = %q, want %q", tag, want)
+		}
+		if err := cmd.Wait(); err != nil {
+			t.Fatalf("Noop() = %v", err)
+		}
+	}
+}
+
+func TestTagGeneratorDuplicate(t *testing.T) {
+	clientConn, serverConn := net.Pipe()
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		defer serverConn.Close()
+		br := bufio.NewReader(serverConn)
+		if _, err := io.WriteString(serverConn, "* OK [CAPABILITY IMAP4rev1] ready\r\n"); err != nil {
+			done <- err
+			return
+		}
+		// The second command isn't sent: only two commands are received
+		for i := 0; i < 2; i++ {
+			l, err := br.ReadString('\n')
+			if err != nil {
+				done <- err
+				return
+			} else if l != "dup NOOP\r\n" {
+				done <- fmt.Errorf("got command %q, want %q", l, "dup NOOP")
+				return
+			}
+			if i == 0 {
+				<-release
+			}
+			if _, err := io.WriteString(serverConn, "dup OK NOOP completed\r\n"); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	c := imapclient.New(clientConn, &imapclient.Options{
+		TagGenerator: func(n uint64) string {
+			return "dup"
+		},
+	})
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("server: %v", err)
+		}
+	}()
+
+	pendingCmd := c.Noop()
+	if err := c.Noop().Wait(); err == nil || !strings.Contains(err.Error(), "duplicate command tag") {
+		t.Errorf("Noop() while a command with the same tag is pending = %v, want error", err)
+	}
+	close(release)
+	if err := pendingCmd.Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+
+	// The tag can be reused once the previous command has completed
+	if err := c.Noop().Wait(); err != nil {
+		t.Errorf("Noop() = %v", err)
+	}
+}
@@ -0,0 +1,71 @@
+package imapclient
+
+import (
+	"io"
+	"sync"
+)
+
+// tracer holds the debug writer and the command hooks, which can be changed
+// while the connection is live.
+type tracer struct {
+	mutex       sync.Mutex
+	debugWriter io.Writer
+	hooks       *CommandHooks
+}
+
+func (t *tracer) writeDebug(b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.debugWriter != nil {
+		t.debugWriter.Write(b)
+	}
+}
+
+func (t *tracer) commandHooks() *CommandHooks {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.hooks
+}
+
+// tracingReadWriter copies all data read and written to the debug writer.
+type tracingReadWriter struct {
+	rw     io.ReadWriter
+	tracer *tracer
+}
+
+func (trw tracingReadWriter) Read(b []byte) (int, error) {
+	n, err := trw.rw.Read(b)
+	trw.tracer.writeDebug(b[:n])
+	return n, err
+}
+
+func (trw tracingReadWriter) Write(b []byte) (int, error) {
+	n, err := trw.rw.Write(b)
+	trw.tracer.writeDebug(b[:n])
+	return n, err
+}
+
+// SetDebugWriter replaces the writer raw ingress and egress data is written
+// to. If nil, protocol tracing is disabled. See Options.DebugWriter.
+//
+// SetDebugWriter is safe to call while commands are running. Once it returns,
+// the previous writer is no longer used.
+func (c *Client) SetDebugWriter(w io.Writer) {
+	c.tracer.mutex.Lock()
+	c.tracer.debugWriter = w
+	c.tracer.mutex.Unlock()
+}
+
+// SetCommandHooks replaces the callbacks invoked for each command. If nil,
+// no callback is invoked. See Options.CommandHooks.
+//
+// Commands which have already been sent keep using the previous
+// CommandHooks.Sent callback.
+func (c *Client) SetCommandHooks(hooks *CommandHooks) {
+	c.tracer.mutex.Lock()
+	c.tracer.hooks = hooks
+	c.tracer.mutex.Unlock()
+}
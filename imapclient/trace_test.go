@@ -0,0 +1,132 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	mutex sync.Mutex
+	buf   bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+func TestSetDebugWriter(t *testing.T) {
+	var before, after lockedBuffer
+	c := newTestClient(t, &imapclient.Options{DebugWriter: &before})
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	c.SetDebugWriter(&after)
+	if err := c.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+
+	if s := before.String(); !strings.Contains(s, "T1 LOGIN") || strings.Contains(s, "NOOP") {
+		t.Errorf("traffic before SetDebugWriter = %q, want LOGIN only", s)
+	}
+	if s := after.String(); strings.Contains(s, "LOGIN") || !strings.Contains(s, "T2 NOOP\r\n") || !strings.Contains(s, "T2 OK") {
+		t.Errorf("traffic after SetDebugWriter = %q, want NOOP only", s)
+	}
+
+	c.SetDebugWriter(nil)
+	if err := c.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+	if s := after.String(); strings.Contains(s, "T3") {
+		t.Errorf("traffic after SetDebugWriter(nil) = %q, want no T3 command", s)
+	}
+}
+
+func TestSetDebugWriterConcurrent(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c.SetDebugWriter(new(lockedBuffer))
+			c.SetCommandHooks(&imapclient.CommandHooks{})
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		if err := c.Noop().Wait(); err != nil {
+			t.Errorf("Noop() = %v", err)
+			break
+		}
+	}
+	close(stop)
+	<-done
+}
+
+func TestSetCommandHooks(t *testing.T) {
+	c := newTestClient(t, nil)
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	var (
+		mutex sync.Mutex
+		sent  []string
+		done  []string
+	)
+	c.SetCommandHooks(&imapclient.CommandHooks{
+		Sent: func(tag, name string, raw []byte) {
+			mutex.Lock()
+			sent = append(sent, tag+" "+name)
+			mutex.Unlock()
+		},
+		Done: func(tag, name string, data interface{}, err error) error {
+			mutex.Lock()
+			done = append(done, tag+" "+name)
+			mutex.Unlock()
+			return err
+		},
+	})
+	if err := c.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+
+	c.SetCommandHooks(nil)
+	if err := c.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	want := []string{"T2 NOOP"}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("Sent calls = %v, want %v", sent, want)
+	}
+	if !reflect.DeepEqual(done, want) {
+		t.Errorf("Done calls = %v, want %v", done, want)
+	}
+}
@@ -0,0 +1,38 @@
+package imapclient
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// tryCreateRetry holds the state necessary to retry a command failing with
+// the TRYCREATE response code.
+type tryCreateRetry struct {
+	client  *Client
+	mailbox string
+}
+
+func (c *Client) newTryCreateRetry(mailbox string) *tryCreateRetry {
+	if !c.options.AutoCreateMailbox {
+		return nil
+	}
+	return &tryCreateRetry{client: c, mailbox: mailbox}
+}
+
+// create creates the destination mailbox if err contains the TRYCREATE
+// response code. It returns true if the command should be retried.
+func (r *tryCreateRetry) create(err error) (bool, error) {
+	if r == nil || !isTryCreate(err) {
+		return false, nil
+	}
+	if err := r.client.Create(r.mailbox).Wait(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func isTryCreate(err error) bool {
+	var imapErr *imap.Error
+	return errors.As(err, &imapErr) && imapErr.Code == imap.ResponseCodeTryCreate
+}
@@ -0,0 +1,156 @@
+package imapclient_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+var tryCreateSelect = corpusExchange{command: "T1 SELECT INBOX", responses: []string{
+	"* 1 EXISTS",
+	"* OK [UIDVALIDITY 1] UIDs valid",
+	"T1 OK [READ-WRITE] SELECT completed",
+}}
+
+func tryCreateCopy(c *imapclient.Client) error {
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		return err
+	}
+	_, err := c.Copy(imap.SeqSetNum(1), "Archive").Wait()
+	return err
+}
+
+func tryCreateMove(c *imapclient.Client) error {
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		return err
+	}
+	_, err := c.Move(imap.SeqSetNum(1), "Archive").Wait()
+	return err
+}
+
+func tryCreateAppend(c *imapclient.Client) error {
+	appendCmd := c.Append("Archive", 2, nil)
+	appendCmd.Write([]byte("Hi"))
+	appendCmd.Close()
+	_, err := appendCmd.Wait()
+	return err
+}
+
+func TestAutoCreateMailbox(t *testing.T) {
+	tests := []struct {
+		name       string
+		autoCreate bool
+		run        func(c *imapclient.Client) error
+		exchanges  []corpusExchange
+		wantCode   imap.ResponseCode // expected error response code, if any
+		wantErr    bool
+	}{
+		{
+			name:       "copy",
+			autoCreate: true,
+			run:        tryCreateCopy,
+			exchanges: []corpusExchange{
+				tryCreateSelect,
+				{command: `T2 COPY 1 "Archive"`, responses: []string{"T2 NO [TRYCREATE] No such mailbox"}},
+				{command: `T3 CREATE "Archive"`, responses: []string{"T3 OK CREATE completed"}},
+				{command: `T4 COPY 1 "Archive"`, responses: []string{"T4 OK COPY completed"}},
+			},
+		},
+		{
+			name:       "move",
+			autoCreate: true,
+			run:        tryCreateMove,
+			exchanges: []corpusExchange{
+				tryCreateSelect,
+				{command: `T2 MOVE 1 "Archive"`, responses: []string{"T2 NO [TRYCREATE] No such mailbox"}},
+				{command: `T3 CREATE "Archive"`, responses: []string{"T3 OK CREATE completed"}},
+				{command: `T4 MOVE 1 "Archive"`, responses: []string{"* 1 EXPUNGE", "T4 OK MOVE completed"}},
+			},
+		},
+		{
+			name:       "append",
+			autoCreate: true,
+			run:        tryCreateAppend,
+			exchanges: []corpusExchange{
+				{command: `T1 APPEND "Archive" {2}`, responses: []string{"+ send literal"}},
+				{command: "Hi", responses: []string{"T1 NO [TRYCREATE] No such mailbox"}},
+				{command: `T2 CREATE "Archive"`, responses: []string{"T2 OK CREATE completed"}},
+				{command: `T3 APPEND "Archive" {2}`, responses: []string{"+ send literal"}},
+				{command: "Hi", responses: []string{"T3 OK APPEND completed"}},
+			},
+		},
+		{
+			name: "disabled",
+			run:  tryCreateCopy,
+			exchanges: []corpusExchange{
+				tryCreateSelect,
+				{command: `T2 COPY 1 "Archive"`, responses: []string{"T2 NO [TRYCREATE] No such mailbox"}},
+			},
+			wantCode: imap.ResponseCodeTryCreate,
+			wantErr:  true,
+		},
+		{
+			name:       "create fails",
+			autoCreate: true,
+			run:        tryCreateCopy,
+			exchanges: []corpusExchange{
+				tryCreateSelect,
+				{command: `T2 COPY 1 "Archive"`, responses: []string{"T2 NO [TRYCREATE] No such mailbox"}},
+				{command: `T3 CREATE "Archive"`, responses: []string{"T3 NO [NOPERM] Permission denied"}},
+			},
+			wantCode: imap.ResponseCodeNoPerm,
+			wantErr:  true,
+		},
+		{
+			name:       "retry fails",
+			autoCreate: true,
+			run:        tryCreateCopy,
+			exchanges: []corpusExchange{
+				tryCreateSelect,
+				{command: `T2 COPY 1 "Archive"`, responses: []string{"T2 NO [TRYCREATE] No such mailbox"}},
+				{command: `T3 CREATE "Archive"`, responses: []string{"T3 OK CREATE completed"}},
+				// The command is only retried once
+				{command: `T4 COPY 1 "Archive"`, responses: []string{"T4 NO [TRYCREATE] No such mailbox"}},
+			},
+			wantCode: imap.ResponseCodeTryCreate,
+			wantErr:  true,
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			fixture := &corpusFixture{
+				greeting:  []string{"* OK [CAPABILITY IMAP4rev1 MOVE] ready"},
+				exchanges: tc.exchanges,
+			}
+
+			clientConn, serverConn := net.Pipe()
+			done := make(chan error, 1)
+			go func() {
+				done <- fixture.serve(serverConn)
+			}()
+			c := imapclient.New(clientConn, &imapclient.Options{AutoCreateMailbox: tc.autoCreate})
+			defer func() {
+				c.Close()
+				if err := <-done; err != nil {
+					t.Errorf("transcript: %v", err)
+				}
+			}()
+
+			err := tc.run(c)
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("command = %v", err)
+				}
+				return
+			}
+			var imapErr *imap.Error
+			if !errors.As(err, &imapErr) || imapErr.Code != tc.wantCode {
+				t.Errorf("command = %v, want %v error", err, tc.wantCode)
+			}
+		})
+	}
+}
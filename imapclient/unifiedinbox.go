@@ -0,0 +1,496 @@
+package imapclient
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// AccountMailbox identifies a mailbox in an account.
+type AccountMailbox struct {
+	Account string
+	Mailbox string
+}
+
+// UnifiedMessageID is a stable identifier for a message in a UnifiedMailbox.
+type UnifiedMessageID struct {
+	Account     string
+	Mailbox     string
+	UIDValidity uint32
+	UID         uint32
+}
+
+// String formats the identifier as a string which can be parsed back with
+// ParseUnifiedMessageID.
+func (id UnifiedMessageID) String() string {
+	return strings.Join([]string{
+		url.PathEscape(id.Account),
+		url.PathEscape(id.Mailbox),
+		strconv.FormatUint(uint64(id.UIDValidity), 10),
+		strconv.FormatUint(uint64(id.UID), 10),
+	}, "/")
+}
+
+// ParseUnifiedMessageID parses an identifier formatted with
+// UnifiedMessageID.String.
+func ParseUnifiedMessageID(s string) (UnifiedMessageID, error) {
+	var id UnifiedMessageID
+	l := strings.Split(s, "/")
+	if len(l) != 4 {
+		return id, fmt.Errorf("imapclient: invalid unified message ID %q", s)
+	}
+
+	var err error
+	if id.Account, err = url.PathUnescape(l[0]); err != nil {
+		return id, fmt.Errorf("imapclient: invalid account in unified message ID: %v", err)
+	}
+	if id.Mailbox, err = url.PathUnescape(l[1]); err != nil {
+		return id, fmt.Errorf("imapclient: invalid mailbox in unified message ID: %v", err)
+	}
+	uidValidity, err := strconv.ParseUint(l[2], 10, 32)
+	if err != nil {
+		return id, fmt.Errorf("imapclient: invalid UIDVALIDITY in unified message ID: %v", err)
+	}
+	uid, err := strconv.ParseUint(l[3], 10, 32)
+	if err != nil {
+		return id, fmt.Errorf("imapclient: invalid UID in unified message ID: %v", err)
+	}
+	id.UIDValidity = uint32(uidValidity)
+	id.UID = uint32(uid)
+	return id, nil
+}
+
+// UnifiedMessage is a message in a UnifiedMailbox.
+type UnifiedMessage struct {
+	ID           UnifiedMessageID
+	Flags        []imap.Flag
+	InternalDate time.Time
+	RFC822Size   int64
+	Envelope     *imap.Envelope
+}
+
+// Interval between two NOOP commands when watching a mailbox on a server
+// which doesn't support IDLE
+const unifiedPollInterval = time.Minute
+
+// UnifiedMailbox is a virtual mailbox merging several mailboxes, possibly
+// from different accounts.
+//
+// Messages are sorted by decreasing internal date. The list is updated by
+// calling Refresh, or kept current by Watch.
+//
+// Each mailbox is opened with EXAMINE on a dedicated connection, established
+// with the account's Connect function: the mailbox selected on the client
+// returned by AccountManager.Client is left untouched.
+type UnifiedMailbox struct {
+	manager *AccountManager
+	sources []*unifiedSource
+
+	mutex    sync.Mutex // protects messages and unifiedSource.messages
+	messages []UnifiedMessage
+}
+
+// unifiedSource is a mailbox of a UnifiedMailbox.
+type unifiedSource struct {
+	AccountMailbox
+
+	// Signalled when unilateral data is received for the mailbox
+	changed  chan struct{}
+	client   *Client
+	messages []UnifiedMessage
+}
+
+func (src *unifiedSource) notify() {
+	select {
+	case src.changed <- struct{}{}:
+	default:
+	}
+}
+
+// NewUnifiedMailbox creates a new unified mailbox.
+//
+// The list of messages is initially empty, Refresh or Watch must be called to
+// populate it.
+func NewUnifiedMailbox(manager *AccountManager, mailboxes []AccountMailbox) *UnifiedMailbox {
+	u := &UnifiedMailbox{manager: manager}
+	for _, mbox := range mailboxes {
+		u.sources = append(u.sources, &unifiedSource{
+			AccountMailbox: mbox,
+			changed:        make(chan struct{}, 1),
+		})
+	}
+	return u
+}
+
+// Messages returns the messages as of the last refresh.
+func (u *UnifiedMailbox) Messages() []UnifiedMessage {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return append([]UnifiedMessage(nil), u.messages...)
+}
+
+// Refresh fetches the messages of all mailboxes.
+//
+// If the server supports SORT, messages are sorted server-side, otherwise
+// they are sorted locally. The per-mailbox lists are then merged.
+//
+// The dedicated connections are kept open for the next calls, until Close is
+// called. Refresh must not be called while Watch is running.
+func (u *UnifiedMailbox) Refresh() error {
+	for _, src := range u.sources {
+		if err := u.refreshSource(src); err != nil {
+			return err
+		}
+	}
+	u.merge()
+	return nil
+}
+
+// Watch keeps the list of messages current until stop is closed.
+//
+// The messages of all mailboxes are fetched, then each dedicated connection
+// runs IDLE (or polls with NOOP if the server doesn't support IDLE). When a
+// mailbox changes, its messages are fetched again. The changed callback, if
+// non-nil, is called after each update of the list returned by Messages. It
+// will be invoked in an arbitrary goroutine, but never concurrently.
+//
+// Connections which get closed are re-established. If an error occurs, all
+// mailboxes stop being watched and the error is returned. The dedicated
+// connections are logged out when Watch returns.
+func (u *UnifiedMailbox) Watch(changed func(), stop <-chan struct{}) error {
+	var (
+		quit         = make(chan struct{})
+		quitOnce     sync.Once
+		errMutex     sync.Mutex
+		firstErr     error
+		wg           sync.WaitGroup
+		changedMutex sync.Mutex
+	)
+	fail := func(err error) {
+		errMutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMutex.Unlock()
+		quitOnce.Do(func() { close(quit) })
+	}
+	notify := func() {
+		u.merge()
+		if changed != nil {
+			changedMutex.Lock()
+			changed()
+			changedMutex.Unlock()
+		}
+	}
+
+	for _, src := range u.sources {
+		wg.Add(1)
+		go func(src *unifiedSource) {
+			defer wg.Done()
+			if err := u.watchSource(src, notify, quit); err != nil {
+				fail(err)
+			}
+		}(src)
+	}
+
+	select {
+	case <-stop:
+	case <-quit:
+	}
+	quitOnce.Do(func() { close(quit) })
+	wg.Wait()
+
+	if err := u.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// watchSource refreshes a mailbox each time it changes, until quit is closed.
+func (u *UnifiedMailbox) watchSource(src *unifiedSource, notify func(), quit <-chan struct{}) error {
+	dirty := true
+	for {
+		if dirty {
+			if err := u.refreshSource(src); err != nil {
+				return err
+			}
+			notify()
+		}
+
+		c := src.client
+		var err error
+		if c.Caps().Has(imap.CapIdle) {
+			dirty, err = waitUnifiedIdle(c, src.changed, quit)
+		} else {
+			dirty, err = waitUnifiedPoll(c, src.changed, quit)
+		}
+		if err != nil {
+			return fmt.Errorf("imapclient: failed to watch mailbox %q in account %q: %w", src.Mailbox, src.Account, err)
+		}
+
+		select {
+		case <-quit:
+			return nil
+		default:
+		}
+		if c.State() == imap.ConnStateLogout {
+			// refreshSource reconnects
+			dirty = true
+		}
+	}
+}
+
+// waitUnifiedIdle runs IDLE until the mailbox changes, quit is closed or IDLE
+// needs to be restarted. It returns true if the mailbox has changed.
+func waitUnifiedIdle(c *Client, changed <-chan struct{}, quit <-chan struct{}) (bool, error) {
+	idleCmd, err := c.Idle()
+	if err != nil {
+		return false, err
+	}
+
+	timer := time.NewTimer(accountIdleRestart)
+	defer timer.Stop()
+
+	var dirty bool
+	select {
+	case <-changed:
+		dirty = true
+	case <-timer.C:
+	case <-quit:
+	case <-c.Done():
+		return true, nil
+	}
+
+	if err := idleCmd.Close(); err != nil {
+		return false, err
+	}
+	if err := idleCmd.Wait(); err != nil {
+		return false, err
+	}
+	return dirty, nil
+}
+
+// waitUnifiedPoll periodically sends NOOP until the mailbox changes or quit
+// is closed. It returns true if the mailbox has changed.
+func waitUnifiedPoll(c *Client, changed <-chan struct{}, quit <-chan struct{}) (bool, error) {
+	ticker := time.NewTicker(unifiedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-changed:
+			return true, nil
+		case <-quit:
+			return false, nil
+		case <-c.Done():
+			return true, nil
+		case <-ticker.C:
+			if err := c.Noop().Wait(); err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// Close logs out of the dedicated connections opened by Refresh.
+//
+// The first error encountered is returned.
+func (u *UnifiedMailbox) Close() error {
+	var firstErr error
+	for _, src := range u.sources {
+		c := src.client
+		src.client = nil
+		if err := logoutClient(c); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// merge merges the per-mailbox lists of messages.
+func (u *UnifiedMailbox) merge() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	lists := make([][]UnifiedMessage, 0, len(u.sources))
+	for _, src := range u.sources {
+		lists = append(lists, src.messages)
+	}
+	u.messages = mergeUnifiedMessages(lists)
+}
+
+// sourceClient returns the dedicated connection of a mailbox, establishing it
+// if necessary.
+func (u *UnifiedMailbox) sourceClient(src *unifiedSource) (*Client, error) {
+	if c := src.client; c != nil {
+		if c.State() == imap.ConnStateSelected {
+			return c, nil
+		}
+		c.Close()
+		src.client = nil
+	}
+
+	c, err := u.manager.dial(src.Account, &UnilateralDataHandler{
+		Expunge: func(seqNum uint32) {
+			src.notify()
+		},
+		Mailbox: func(data *UnilateralDataMailbox) {
+			src.notify()
+		},
+		Fetch: func(msg *FetchMessageData) {
+			msg.discard()
+			src.notify()
+		},
+		Vanished: func(uids imap.UIDSet) {
+			src.notify()
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.Examine(src.Mailbox).Wait(); err != nil {
+		logoutClient(c)
+		return nil, fmt.Errorf("imapclient: failed to open mailbox %q in account %q: %w", src.Mailbox, src.Account, err)
+	}
+
+	// Drop the notifications received while opening the mailbox
+	select {
+	case <-src.changed:
+	default:
+	}
+
+	src.client = c
+	return c, nil
+}
+
+func (u *UnifiedMailbox) refreshSource(src *unifiedSource) error {
+	c, err := u.sourceClient(src)
+	if err != nil {
+		return err
+	}
+	l, err := fetchUnifiedMessages(c, src.AccountMailbox)
+	if err != nil {
+		return err
+	}
+
+	u.mutex.Lock()
+	src.messages = l
+	u.mutex.Unlock()
+	return nil
+}
+
+// fetchUnifiedMessages fetches the messages of the mailbox selected on c.
+func fetchUnifiedMessages(c *Client, mbox AccountMailbox) ([]UnifiedMessage, error) {
+	selected := c.Mailbox()
+	if selected == nil {
+		return nil, fmt.Errorf("imapclient: mailbox %q in account %q isn't selected", mbox.Mailbox, mbox.Account)
+	}
+	if selected.NumMessages == 0 {
+		return nil, nil
+	}
+
+	var (
+		sortedUIDs []uint32
+		err        error
+	)
+	if c.Caps().Has(imap.CapSort) {
+		sortedUIDs, err = c.UIDSort(&SortOptions{
+			SearchCriteria: &imap.SearchCriteria{},
+			SortCriteria:   []SortCriterion{{Key: SortKeyArrival, Reverse: true}},
+		}).Wait()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	msgs, err := c.Fetch(imap.SeqSetRange(1, selected.NumMessages), []imap.FetchItem{
+		imap.FetchItemUID,
+		imap.FetchItemFlags,
+		imap.FetchItemInternalDate,
+		imap.FetchItemRFC822Size,
+		imap.FetchItemEnvelope,
+	}).Collect()
+	if err != nil {
+		return nil, err
+	}
+
+	byUID := make(map[uint32]UnifiedMessage, len(msgs))
+	for _, msg := range msgs {
+		byUID[msg.UID] = UnifiedMessage{
+			ID: UnifiedMessageID{
+				Account:     mbox.Account,
+				Mailbox:     mbox.Mailbox,
+				UIDValidity: selected.UIDValidity,
+				UID:         msg.UID,
+			},
+			Flags:        msg.Flags,
+			InternalDate: msg.InternalDate,
+			RFC822Size:   msg.RFC822Size,
+			Envelope:     msg.Envelope,
+		}
+	}
+
+	l := make([]UnifiedMessage, 0, len(byUID))
+	if sortedUIDs != nil {
+		for _, uid := range sortedUIDs {
+			if msg, ok := byUID[uid]; ok {
+				l = append(l, msg)
+				delete(byUID, uid)
+			}
+		}
+		// Messages delivered between SORT and FETCH are sorted below
+	}
+	for _, msg := range byUID {
+		l = append(l, msg)
+	}
+	if sortedUIDs == nil || len(byUID) > 0 {
+		sort.SliceStable(l, func(i, j int) bool {
+			return unifiedMessageLess(&l[i], &l[j])
+		})
+	}
+	return l, nil
+}
+
+// mergeUnifiedMessages merges sorted lists of messages.
+func mergeUnifiedMessages(lists [][]UnifiedMessage) []UnifiedMessage {
+	n := 0
+	for _, l := range lists {
+		n += len(l)
+	}
+
+	out := make([]UnifiedMessage, 0, n)
+	indices := make([]int, len(lists))
+	for len(out) < n {
+		best := -1
+		for i, l := range lists {
+			if indices[i] >= len(l) {
+				continue
+			}
+			if best < 0 || unifiedMessageLess(&l[indices[i]], &lists[best][indices[best]]) {
+				best = i
+			}
+		}
+		out = append(out, lists[best][indices[best]])
+		indices[best]++
+	}
+	return out
+}
+
+func unifiedMessageLess(a, b *UnifiedMessage) bool {
+	if !a.InternalDate.Equal(b.InternalDate) {
+		return a.InternalDate.After(b.InternalDate)
+	}
+	if a.ID.Account != b.ID.Account {
+		return a.ID.Account < b.ID.Account
+	}
+	if a.ID.Mailbox != b.ID.Mailbox {
+		return a.ID.Mailbox < b.ID.Mailbox
+	}
+	return a.ID.UID > b.ID.UID
+}
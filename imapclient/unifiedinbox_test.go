@@ -0,0 +1,152 @@
+package imapclient_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func newUnifiedTestManager(t *testing.T) *imapclient.AccountManager {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Archive"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	mem.AddUser(user)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewConnSession(conn), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+	t.Cleanup(func() { server.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	m := imapclient.NewAccountManager(nil)
+	t.Cleanup(func() { m.Close() })
+	err = m.Add(imapclient.AccountConfig{
+		ID: "alice",
+		Connect: func(options *imapclient.Options) (*imapclient.Client, error) {
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				return nil, err
+			}
+			c := imapclient.New(conn, options)
+			if err := c.Login("alice", "secret").Wait(); err != nil {
+				c.Close()
+				return nil, err
+			}
+			return c, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	return m
+}
+
+func appendTestMessage(t *testing.T, c *imapclient.Client, mailbox string) {
+	msg := "Subject: unified\r\n\r\nHi\r\n"
+	cmd := c.Append(mailbox, int64(len(msg)), nil)
+	if _, err := cmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := cmd.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := cmd.Wait(); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+}
+
+func TestUnifiedMailboxRefresh(t *testing.T) {
+	m := newUnifiedTestManager(t)
+	c, err := m.Client("alice")
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	}
+	appendTestMessage(t, c, "INBOX")
+	appendTestMessage(t, c, "Archive")
+	if _, err := c.Select("Archive").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	u := imapclient.NewUnifiedMailbox(m, []imapclient.AccountMailbox{
+		{Account: "alice", Mailbox: "INBOX"},
+		{Account: "alice", Mailbox: "Archive"},
+	})
+	defer u.Close()
+	if err := u.Refresh(); err != nil {
+		t.Fatalf("Refresh() = %v", err)
+	}
+	if n := len(u.Messages()); n != 2 {
+		t.Errorf("len(Messages()) = %v, want 2", n)
+	}
+
+	// The mailbox selected on the shared client isn't changed
+	if mbox := c.Mailbox(); mbox == nil || mbox.Name != "Archive" {
+		t.Errorf("Mailbox() = %v, want Archive", mbox)
+	}
+}
+
+func TestUnifiedMailboxWatch(t *testing.T) {
+	m := newUnifiedTestManager(t)
+	c, err := m.Client("alice")
+	if err != nil {
+		t.Fatalf("Client() = %v", err)
+	}
+
+	u := imapclient.NewUnifiedMailbox(m, []imapclient.AccountMailbox{
+		{Account: "alice", Mailbox: "INBOX"},
+		{Account: "alice", Mailbox: "Archive"},
+	})
+	changed := make(chan int, 16)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- u.Watch(func() {
+			changed <- len(u.Messages())
+		}, stop)
+	}()
+
+	// Wait for the initial fetch of both mailboxes
+	waitUnifiedCount := func(want int) {
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case n := <-changed:
+				if n == want {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for %v messages", want)
+			}
+		}
+	}
+	waitUnifiedCount(0)
+	waitUnifiedCount(0)
+
+	appendTestMessage(t, c, "Archive")
+	waitUnifiedCount(1)
+	appendTestMessage(t, c, "INBOX")
+	waitUnifiedCount(2)
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Errorf("Watch() = %v", err)
+	}
+}
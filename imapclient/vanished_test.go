@@ -0,0 +1,95 @@
+package imapclient_test
+
+import (
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestFetchVanished(t *testing.T) {
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1 CONDSTORE QRESYNC] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 SELECT INBOX", responses: []string{
+				"* 10 EXISTS",
+				"* OK [UIDVALIDITY 1] UIDs valid",
+				"T1 OK [READ-WRITE] SELECT completed",
+			}},
+			{command: "T2 UID FETCH 1:* (UID FLAGS) (CHANGEDSINCE 5 VANISHED)", responses: []string{
+				"* VANISHED (EARLIER) 1:3,5",
+				"* 1 FETCH (UID 4 FLAGS (\\Seen) MODSEQ (7))",
+				"T2 OK FETCH completed",
+			}},
+			{command: "T3 NOOP", responses: []string{
+				"* VANISHED 6:4000000000",
+				"T3 OK NOOP completed",
+			}},
+		},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+
+	var unilateral imap.UIDSet
+	c := imapclient.New(clientConn, &imapclient.Options{
+		UnilateralDataHandler: &imapclient.UnilateralDataHandler{
+			Vanished: func(uids imap.UIDSet) {
+				unilateral = uids
+			},
+		},
+	})
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	cmd := c.UIDFetchWithOptions(imap.UIDSetRange(1, 0), []imap.FetchItem{imap.FetchItemFlags}, &imap.FetchOptions{
+		ChangedSince: 5,
+		Vanished:     true,
+	})
+	if _, err := cmd.Collect(); err != nil {
+		t.Fatalf("UIDFetchWithOptions() = %v", err)
+	}
+	want := imap.UIDSet{imap.Seq{Start: 1, Stop: 3}, imap.Seq{Start: 5, Stop: 5}}
+	if !reflect.DeepEqual(cmd.Vanished(), want) {
+		t.Errorf("Vanished() = %v, want %v", cmd.Vanished(), want)
+	}
+
+	// Large VANISHED responses aren't expanded
+	if err := c.Noop().Wait(); err != nil {
+		t.Fatalf("Noop() = %v", err)
+	}
+	if want := imap.UIDSetRange(6, 4000000000); !reflect.DeepEqual(unilateral, want) {
+		t.Errorf("unilateral VANISHED = %v, want %v", unilateral, want)
+	}
+	if n := c.Mailbox().NumMessages; n != 0 {
+		t.Errorf("NumMessages = %v, want 0", n)
+	}
+
+	// These commands fail without being sent
+	invalidOptions := []struct {
+		name    string
+		numSet  imap.NumSet
+		options *imap.FetchOptions
+	}{
+		{"VANISHED without UID", imap.SeqSetNum(1), &imap.FetchOptions{ChangedSince: 5, Vanished: true}},
+		{"VANISHED without CHANGEDSINCE", imap.UIDSetNum(1), &imap.FetchOptions{Vanished: true}},
+	}
+	for _, tc := range invalidOptions {
+		if _, err := c.FetchWithOptions(tc.numSet, []imap.FetchItem{imap.FetchItemFlags}, tc.options).Collect(); err == nil {
+			t.Errorf("%v: FetchWithOptions() succeeded", tc.name)
+		}
+	}
+}
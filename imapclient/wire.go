@@ -0,0 +1,193 @@
+package imapclient
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// ResponseEncoder encodes untagged responses to a writer.
+//
+// It re-serializes data decoded by the client, e.g. in a proxy or a caching
+// layer, or to generate test fixtures. The output is byte-for-byte identical
+// to the responses written by imapserver.
+type ResponseEncoder struct {
+	bw         *bufio.Writer
+	imap4rev2  bool
+	quotedUTF8 bool
+}
+
+// NewResponseEncoder creates a new response encoder.
+//
+// The encoding depends on the capabilities enabled by the client the
+// responses are sent to, if any. For instance, UTF-8 strings are sent as
+// quoted strings if IMAP4rev2 is enabled.
+func NewResponseEncoder(w io.Writer, enabled imap.CapSet) *ResponseEncoder {
+	return &ResponseEncoder{
+		bw:         bufio.NewWriter(w),
+		imap4rev2:  enabled.Has(imap.CapIMAP4rev2),
+		quotedUTF8: enabled.Has(imap.CapIMAP4rev2) || enabled.Has(imap.CapUTF8Accept),
+	}
+}
+
+func (e *ResponseEncoder) encode(f func(enc *imapwire.Encoder) error) error {
+	enc := imapwire.NewEncoder(e.bw, imapwire.ConnSideServer)
+	enc.QuotedUTF8 = e.quotedUTF8
+	if err := f(enc); err != nil {
+		return err
+	}
+	return e.bw.Flush()
+}
+
+// WriteList writes a LIST response.
+func (e *ResponseEncoder) WriteList(data *imap.ListData) error {
+	return e.encode(func(enc *imapwire.Encoder) error {
+		return enc.ListResponse(data)
+	})
+}
+
+// WriteLSub writes a LSUB response.
+func (e *ResponseEncoder) WriteLSub(data *imap.ListData) error {
+	return e.encode(func(enc *imapwire.Encoder) error {
+		return enc.LSubResponse(data)
+	})
+}
+
+// WriteStatus writes a STATUS response. Only the items set in data are
+// written.
+func (e *ResponseEncoder) WriteStatus(data *imap.StatusData) error {
+	return e.encode(func(enc *imapwire.Encoder) error {
+		return enc.StatusResponse(data, imapwire.StatusDataItems(data))
+	})
+}
+
+// WriteSearch writes a SEARCH or ESEARCH response.
+//
+// ESEARCH is used if options contain return options, or if the encoder has
+// been created with IMAP4rev2 enabled. The tag is only included in ESEARCH
+// responses, and can be empty.
+func (e *ResponseEncoder) WriteSearch(tag string, data *imap.SearchData, options *imap.SearchOptions) error {
+	if options == nil {
+		options = new(imap.SearchOptions)
+	}
+	return e.encode(func(enc *imapwire.Encoder) error {
+		if e.imap4rev2 || len(options.Return) > 0 {
+			return enc.ESearchResponse(tag, data, options)
+		}
+		return enc.SearchResponse(data)
+	})
+}
+
+// WriteFetch writes a FETCH response for a message.
+//
+// The items are written in order, typically the ones requested by the FETCH
+// command msg has been received for. Body sections, binary sections and
+// binary section sizes missing from msg are omitted. An error is returned
+// before anything is written if an item isn't supported.
+func (e *ResponseEncoder) WriteFetch(msg *FetchMessageBuffer, items []imap.FetchItem) error {
+	for _, item := range items {
+		switch item := item.(type) {
+		case *imap.FetchItemBodySection, *imap.FetchItemBinarySection, *imap.FetchItemBinarySectionSize:
+			// ok
+		default:
+			switch item {
+			case imap.FetchItemUID, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size, imap.FetchItemEnvelope, imap.FetchItemBody, imap.FetchItemBodyStructure, imap.FetchItemModSeq:
+				// ok
+			default:
+				return fmt.Errorf("imapclient: unsupported FETCH item %v", item)
+			}
+		}
+	}
+
+	return e.encode(func(enc *imapwire.Encoder) error {
+		enc.Atom("*").SP().Number(msg.SeqNum).SP().Atom("FETCH").SP().Special('(')
+		hasItem := false
+		sep := func() *imapwire.Encoder {
+			if hasItem {
+				enc.SP()
+			}
+			hasItem = true
+			return enc
+		}
+		for _, item := range items {
+			var literal []byte
+			switch item := item.(type) {
+			case *imap.FetchItemBodySection:
+				b := msg.FindBodySection(item)
+				if b == nil {
+					continue
+				}
+				sep().BodySectionName(item).SP()
+				literal = b
+			case *imap.FetchItemBinarySection:
+				b := findBinarySection(msg, item.Part)
+				if b == nil {
+					continue
+				}
+				sep().Atom("BINARY").Special('[').SectionPart(item.Part).Special(']').SP()
+				literal = b
+			case *imap.FetchItemBinarySectionSize:
+				size := findBinarySectionSize(msg, item.Part)
+				if size == nil {
+					continue
+				}
+				sep().Atom("BINARY.SIZE").Special('[').SectionPart(item.Part).Special(']').SP().Number(*size)
+			default:
+				switch item {
+				case imap.FetchItemUID:
+					sep().Atom("UID").SP().Number(msg.UID)
+				case imap.FetchItemFlags:
+					sep().Atom("FLAGS").SP().List(len(msg.Flags), func(i int) {
+						enc.Flag(msg.Flags[i])
+					})
+				case imap.FetchItemInternalDate:
+					sep().Atom("INTERNALDATE").SP().String(msg.InternalDate.Format(internal.DateTimeLayout))
+				case imap.FetchItemRFC822Size:
+					sep().Atom("RFC822.SIZE").SP().Number64(msg.RFC822Size)
+				case imap.FetchItemEnvelope:
+					sep().Atom("ENVELOPE").SP().Envelope(msg.Envelope)
+				case imap.FetchItemBody, imap.FetchItemBodyStructure:
+					if msg.BodyStructure == nil {
+						continue
+					}
+					sep().Atom(string(item.(imap.FetchItemKeyword))).SP().BodyStructure(msg.BodyStructure)
+				case imap.FetchItemModSeq:
+					sep().Atom("MODSEQ").SP().Special('(').Number64(int64(msg.ModSeq)).Special(')')
+				}
+			}
+
+			if literal != nil {
+				w := enc.Literal(int64(len(literal)), nil)
+				if _, err := w.Write(literal); err != nil {
+					return err
+				}
+				if err := w.Close(); err != nil {
+					return err
+				}
+			}
+		}
+		return enc.Special(')').CRLF()
+	})
+}
+
+func findBinarySection(msg *FetchMessageBuffer, part []int) []byte {
+	for section, b := range msg.BinarySection {
+		if intSliceEqual(section.Part, part) {
+			return b
+		}
+	}
+	return nil
+}
+
+func findBinarySectionSize(msg *FetchMessageBuffer, part []int) *uint32 {
+	for i := range msg.BinarySectionSize {
+		if data := &msg.BinarySectionSize[i]; intSliceEqual(data.Part, part) {
+			return &data.Size
+		}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package imapclient_test
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestResponseEncoder(t *testing.T) {
+	uint32Ptr := func(v uint32) *uint32 { return &v }
+
+	var buf bytes.Buffer
+	enc := imapclient.NewResponseEncoder(&buf, nil)
+
+	if err := enc.WriteList(&imap.ListData{
+		Attrs:   []imap.MailboxAttr{imap.MailboxAttrHasNoChildren},
+		Delim:   '/',
+		Mailbox: "Archive",
+	}); err != nil {
+		t.Fatalf("WriteList() = %v", err)
+	}
+	if err := enc.WriteStatus(&imap.StatusData{
+		Mailbox:     "INBOX",
+		NumMessages: uint32Ptr(42),
+		UIDNext:     43,
+	}); err != nil {
+		t.Fatalf("WriteStatus() = %v", err)
+	}
+	if err := enc.WriteSearch("", &imap.SearchData{All: imap.SeqSetNum(1, 3)}, nil); err != nil {
+		t.Fatalf("WriteSearch() = %v", err)
+	}
+	if err := enc.WriteSearch("A1", &imap.SearchData{Count: 2}, &imap.SearchOptions{
+		Return: []imap.SearchReturnOption{imap.SearchReturnCount},
+	}); err != nil {
+		t.Fatalf("WriteSearch() = %v", err)
+	}
+
+	want := "* LIST (\\HasNoChildren) \"/\" \"Archive\"\r\n" +
+		"* STATUS INBOX (MESSAGES 42 UIDNEXT 43)\r\n" +
+		"* SEARCH 1 3\r\n" +
+		"* ESEARCH (TAG \"A1\") COUNT 2\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%v\nwant:\n%v", got, want)
+	}
+}
+
+func TestResponseEncoderStatusRoundTrip(t *testing.T) {
+	uint32Ptr := func(v uint32) *uint32 { return &v }
+
+	want := &imap.StatusData{
+		Mailbox:     "INBOX",
+		NumMessages: uint32Ptr(42),
+		NumRecent:   uint32Ptr(3),
+		UIDNext:     43,
+	}
+	var buf bytes.Buffer
+	if err := imapclient.NewResponseEncoder(&buf, nil).WriteStatus(want); err != nil {
+		t.Fatalf("WriteStatus() = %v", err)
+	}
+	line := strings.TrimSuffix(buf.String(), "\r\n")
+	if wantLine := "* STATUS INBOX (MESSAGES 42 RECENT 3 UIDNEXT 43)"; line != wantLine {
+		t.Errorf("WriteStatus() = %q, want %q", line, wantLine)
+	}
+
+	fixture := &corpusFixture{
+		greeting: []string{"* OK [CAPABILITY IMAP4rev1] ready"},
+		exchanges: []corpusExchange{
+			{command: "T1 STATUS INBOX (MESSAGES RECENT UIDNEXT)", responses: []string{
+				line,
+				"T1 OK STATUS completed",
+			}},
+		},
+	}
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- fixture.serve(serverConn)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("transcript: %v", err)
+		}
+	}()
+
+	items := []imap.StatusItem{imap.StatusItemNumMessages, imap.StatusItemNumRecent, imap.StatusItemUIDNext}
+	got, err := c.Status("INBOX", items).Wait()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Status() = %+v, want %+v", got, want)
+	}
+}
+
+func TestResponseEncoder_WriteSearch(t *testing.T) {
+	tests := []struct {
+		data    *imap.SearchData
+		options *imap.SearchOptions
+		want    string
+	}{
+		{
+			data: &imap.SearchData{All: imap.SeqSetNum(2, 5, 6), ModSeq: 917162488},
+			want: "* SEARCH 2 5 6 (MODSEQ 917162488)\r\n",
+		},
+		{
+			data: &imap.SearchData{ModSeq: 917162488},
+			want: "* SEARCH\r\n",
+		},
+		{
+			data: &imap.SearchData{UID: true, All: imap.SeqSetRange(1, 3), Min: 1, Max: 3, Count: 3, ModSeq: 42},
+			options: &imap.SearchOptions{Return: []imap.SearchReturnOption{
+				imap.SearchReturnMin,
+				imap.SearchReturnMax,
+				imap.SearchReturnAll,
+				imap.SearchReturnCount,
+			}},
+			want: "* ESEARCH (TAG \"A1\") UID ALL 1:3 MIN 1 MAX 3 COUNT 3 MODSEQ 42\r\n",
+		},
+		{
+			data:    &imap.SearchData{UID: true},
+			options: &imap.SearchOptions{Return: []imap.SearchReturnOption{imap.SearchReturnMin, imap.SearchReturnCount}},
+			want:    "* ESEARCH (TAG \"A1\") UID COUNT 0\r\n",
+		},
+	}
+	for _, tc := range tests {
+		var buf bytes.Buffer
+		enc := imapclient.NewResponseEncoder(&buf, nil)
+		if err := enc.WriteSearch("A1", tc.data, tc.options); err != nil {
+			t.Fatalf("WriteSearch() = %v", err)
+		}
+		if got := buf.String(); got != tc.want {
+			t.Errorf("WriteSearch() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestResponseEncoderFetch(t *testing.T) {
+	var debug bytes.Buffer
+	c := newTestClient(t, &imapclient.Options{DebugWriter: &debug})
+	if err := c.Login("alice", "secret").Wait(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+
+	msg := "Subject: Hello\r\nFrom: alice@example.org\r\n\r\nHi!\r\n"
+	appendCmd := c.Append("INBOX", int64(len(msg)), &imap.AppendOptions{
+		Flags: []imap.Flag{imap.FlagSeen},
+		Time:  time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC),
+	})
+	if _, err := appendCmd.Write([]byte(msg)); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if err := appendCmd.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if _, err := appendCmd.Wait(); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	if _, err := c.Select("INBOX").Wait(); err != nil {
+		t.Fatalf("Select() = %v", err)
+	}
+
+	items := []imap.FetchItem{
+		imap.FetchItemUID,
+		imap.FetchItemFlags,
+		imap.FetchItemInternalDate,
+		imap.FetchItemRFC822Size,
+		&imap.FetchItemBodySection{
+			Specifier:    imap.PartSpecifierHeader,
+			HeaderFields: []string{"Subject"},
+			Peek:         true,
+		},
+		&imap.FetchItemBodySection{Specifier: imap.PartSpecifierText, Peek: true},
+	}
+	msgs, err := c.Fetch(imap.SeqSetNum(1), items).Collect()
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	} else if len(msgs) != 1 {
+		t.Fatalf("Fetch() returned %v messages, want 1", len(msgs))
+	}
+
+	var buf bytes.Buffer
+	enc := imapclient.NewResponseEncoder(&buf, nil)
+	if err := enc.WriteFetch(msgs[0], items); err != nil {
+		t.Fatalf("WriteFetch() = %v", err)
+	}
+
+	want := "* 1 FETCH (UID 1 FLAGS (\\seen) INTERNALDATE \" 1-Mar-2024 10:00:00 +0000\" RFC822.SIZE 48 " +
+		"BODY[HEADER.FIELDS (\"Subject\")] {18}\r\nSubject: Hello\r\n\r\n BODY[TEXT] {5}\r\nHi!\r\n)\r\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+	// The response is identical to the one written by the server
+	if !strings.Contains(debug.String(), want) {
+		t.Errorf("server response differs, got:\n%q", debug.String())
+	}
+
+	if err := enc.WriteFetch(msgs[0], []imap.FetchItem{imap.FetchItemUID, imap.FetchItemFull}); err == nil {
+		t.Errorf("WriteFetch(FULL) = nil, want error")
+	} else if n := buf.Len(); n != len(want) {
+		t.Errorf("WriteFetch(FULL) wrote %v bytes before failing", n-len(want))
+	}
+}
@@ -0,0 +1,239 @@
+package imapjmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// ErrCannotCalculateChanges is returned by Bridge.EmailChanges when the
+// changes since a state can't be computed. This maps to the JMAP
+// "cannotCalculateChanges" error: the JMAP client needs to fetch all Emails
+// again.
+var ErrCannotCalculateChanges = errors.New("imapjmap: cannot calculate changes")
+
+// EmailChanges contains the changes of the Emails of a mailbox, as returned
+// by the JMAP Email/changes method.
+type EmailChanges struct {
+	OldState, NewState string
+	Created            []string
+	Updated            []string
+	Destroyed          []string
+}
+
+// Bridge exposes the mailboxes and messages of an IMAP client as JMAP
+// objects.
+//
+// The client must be authenticated. Methods operating on Emails examine the
+// mailbox, changing the mailbox selected by the client.
+type Bridge struct {
+	client *imapclient.Client
+
+	mutex sync.Mutex
+	known map[string][]knownState // by mailbox, most recent last
+}
+
+// maxKnownStates is the maximum number of states remembered per mailbox.
+const maxKnownStates = 16
+
+// knownState is a state returned by the Bridge, along with the UIDs of the
+// messages in the mailbox at that state.
+type knownState struct {
+	state string
+	uids  []uint32
+}
+
+// NewBridge creates a new bridge.
+//
+// To compute Email changes, QRESYNC must be enabled with Client.Enable
+// beforehand.
+func NewBridge(c *imapclient.Client) *Bridge {
+	return &Bridge{client: c, known: make(map[string][]knownState)}
+}
+
+func (b *Bridge) rememberState(mailbox, state string, uids []uint32) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	l := b.known[mailbox]
+	for i, known := range l {
+		if known.state == state {
+			l = append(l[:i], l[i+1:]...)
+			break
+		}
+	}
+	if len(l) >= maxKnownStates {
+		l = l[1:]
+	}
+	b.known[mailbox] = append(l, knownState{state, uids})
+}
+
+func (b *Bridge) knownUIDs(mailbox, state string) ([]uint32, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, known := range b.known[mailbox] {
+		if known.state == state {
+			return known.uids, true
+		}
+	}
+	return nil, false
+}
+
+// Mailboxes returns all mailboxes.
+//
+// The counters are only populated if the server supports IMAP4rev2 or
+// LIST-STATUS.
+func (b *Bridge) Mailboxes() ([]Mailbox, error) {
+	caps := b.client.Caps()
+	options := new(imap.ListOptions)
+	if caps.Has(imap.CapIMAP4rev2) || caps.Has(imap.CapListStatus) {
+		options.ReturnStatus = []imap.StatusItem{imap.StatusItemNumMessages, imap.StatusItemNumUnseen}
+	}
+	if caps.Has(imap.CapIMAP4rev2) || caps.Has(imap.CapListExtended) {
+		options.ReturnSubscribed = true
+	}
+
+	l, err := b.client.List("", "*", options).Collect()
+	if err != nil {
+		return nil, err
+	}
+	return ConvertMailboxes(l), nil
+}
+
+// Emails returns all Emails of a mailbox, and the state to pass to
+// EmailChanges.
+func (b *Bridge) Emails(mailbox string) ([]*Email, string, error) {
+	data, err := b.client.Examine(mailbox).Wait()
+	if err != nil {
+		return nil, "", err
+	}
+	state := formatState(data)
+	if data.NumMessages == 0 {
+		b.rememberState(mailbox, state, nil)
+		return nil, state, nil
+	}
+
+	msgs, err := b.client.UIDFetch(imap.UIDSetRange(1, 0), EmailFetchItems()).Collect()
+	if err != nil {
+		return nil, "", err
+	}
+	emails := make([]*Email, len(msgs))
+	uids := make([]uint32, len(msgs))
+	for i, msg := range msgs {
+		emails[i] = ConvertEmail(mailbox, data.UIDValidity, msg)
+		uids[i] = msg.UID
+	}
+	b.rememberState(mailbox, state, uids)
+	return emails, state, nil
+}
+
+// EmailChanges returns the Emails of a mailbox which have changed since a
+// state returned by Emails or EmailChanges. Flag changes are reported as
+// updates.
+//
+// This requires QRESYNC. ErrCannotCalculateChanges is returned if the server
+// doesn't support it, if UIDVALIDITY has changed, or if the state hasn't been
+// returned recently by this Bridge: the messages present in the mailbox at
+// that state are needed to report destroyed Emails.
+func (b *Bridge) EmailChanges(mailbox, sinceState string) (*EmailChanges, error) {
+	since, err := parseState(sinceState)
+	if err != nil {
+		return nil, err
+	}
+	if !b.client.Caps().Has(imap.CapQResync) || since.modSeq == 0 || since.uidNext == 0 {
+		return nil, ErrCannotCalculateChanges
+	}
+	knownUIDs, ok := b.knownUIDs(mailbox, sinceState)
+	if !ok {
+		return nil, ErrCannotCalculateChanges
+	}
+
+	data, err := b.client.Examine(mailbox).Wait()
+	if err != nil {
+		return nil, err
+	}
+	if data.UIDValidity != since.uidValidity || data.HighestModSeq < since.modSeq {
+		return nil, ErrCannotCalculateChanges
+	}
+
+	changes := &EmailChanges{OldState: sinceState, NewState: formatState(data)}
+	if data.HighestModSeq == since.modSeq {
+		b.rememberState(mailbox, changes.NewState, knownUIDs)
+		return changes, nil
+	}
+
+	cmd := b.client.UIDFetchWithOptions(imap.UIDSetRange(1, 0), []imap.FetchItem{imap.FetchItemUID}, &imap.FetchOptions{
+		ChangedSince: since.modSeq,
+		Vanished:     true,
+	})
+	msgs, err := cmd.Collect()
+	if err != nil {
+		return nil, err
+	}
+	// The server may report UIDs expunged before the old state, or created
+	// and destroyed since then: only the UIDs known at the old state are
+	// reported as destroyed
+	vanished := cmd.Vanished()
+	uids := make([]uint32, 0, len(knownUIDs))
+	for _, uid := range knownUIDs {
+		if vanished.Contains(uid) {
+			changes.Destroyed = append(changes.Destroyed, EmailID(mailbox, data.UIDValidity, uid))
+		} else {
+			uids = append(uids, uid)
+		}
+	}
+
+	for _, msg := range msgs {
+		id := EmailID(mailbox, data.UIDValidity, msg.UID)
+		if msg.UID >= since.uidNext {
+			changes.Created = append(changes.Created, id)
+			uids = append(uids, msg.UID)
+		} else {
+			changes.Updated = append(changes.Updated, id)
+		}
+	}
+
+	b.rememberState(mailbox, changes.NewState, uids)
+	return changes, nil
+}
+
+// mailboxState is the state of the Emails of a mailbox.
+type mailboxState struct {
+	uidValidity uint32
+	modSeq      uint64
+	uidNext     uint32
+}
+
+func formatState(data *imap.SelectData) string {
+	return fmt.Sprintf("%v:%v:%v", data.UIDValidity, data.HighestModSeq, data.UIDNext)
+}
+
+func parseState(s string) (*mailboxState, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("imapjmap: invalid state %q", s)
+	}
+	uidValidity, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("imapjmap: invalid state %q: %v", s, err)
+	}
+	modSeq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("imapjmap: invalid state %q: %v", s, err)
+	}
+	uidNext, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("imapjmap: invalid state %q: %v", s, err)
+	}
+	return &mailboxState{
+		uidValidity: uint32(uidValidity),
+		modSeq:      modSeq,
+		uidNext:     uint32(uidNext),
+	}, nil
+}
@@ -0,0 +1,143 @@
+package imapjmap
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// scriptExchange is a command expected from the client, followed by the
+// responses sent by the server.
+type scriptExchange struct {
+	command   string
+	responses []string
+}
+
+// serveScript plays the server side of an IMAP session.
+func serveScript(conn net.Conn, greeting string, exchanges []scriptExchange) error {
+	defer conn.Close()
+
+	bw := bufio.NewWriter(conn)
+	br := bufio.NewReader(conn)
+	bw.WriteString(greeting + "\r\n")
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	for _, ex := range exchanges {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("waiting for command %q: %v", ex.command, err)
+		}
+		if l = strings.TrimSuffix(l, "\r\n"); l != ex.command {
+			return fmt.Errorf("got command %q, want %q", l, ex.command)
+		}
+		for _, resp := range ex.responses {
+			bw.WriteString(resp + "\r\n")
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBridgeEmailChanges(t *testing.T) {
+	exchanges := []scriptExchange{
+		{command: "T1 EXAMINE INBOX", responses: []string{
+			"* 3 EXISTS",
+			"* OK [UIDVALIDITY 42] UIDs valid",
+			"* OK [UIDNEXT 5] Predicted next UID",
+			"* OK [HIGHESTMODSEQ 10] Highest",
+			"T1 OK [READ-ONLY] EXAMINE completed",
+		}},
+		{command: "T2 UID FETCH 1:* (UID FLAGS ENVELOPE INTERNALDATE RFC822.SIZE BODYSTRUCTURE)", responses: []string{
+			"* 1 FETCH (UID 1 FLAGS ())",
+			"* 2 FETCH (UID 3 FLAGS ())",
+			"* 3 FETCH (UID 4 FLAGS ())",
+			"T2 OK FETCH completed",
+		}},
+		{command: "T3 EXAMINE INBOX", responses: []string{
+			"* 2 EXISTS",
+			"* OK [UIDVALIDITY 42] UIDs valid",
+			"* OK [UIDNEXT 7] Predicted next UID",
+			"* OK [HIGHESTMODSEQ 15] Highest",
+			"T3 OK [READ-ONLY] EXAMINE completed",
+		}},
+		{command: "T4 UID FETCH 1:* (UID) (CHANGEDSINCE 10 VANISHED)", responses: []string{
+			// UID 2 has been expunged before the old state, UID 5 has been
+			// created and expunged since then
+			"* VANISHED (EARLIER) 1:3,5",
+			"* 1 FETCH (UID 4 MODSEQ (12))",
+			"* 2 FETCH (UID 6 MODSEQ (14))",
+			"T4 OK FETCH completed",
+		}},
+		{command: "T5 EXAMINE INBOX", responses: []string{
+			"* 2 EXISTS",
+			"* OK [UIDVALIDITY 42] UIDs valid",
+			"* OK [UIDNEXT 7] Predicted next UID",
+			"* OK [HIGHESTMODSEQ 15] Highest",
+			"T5 OK [READ-ONLY] EXAMINE completed",
+		}},
+	}
+
+	clientConn, serverConn := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- serveScript(serverConn, "* OK [CAPABILITY IMAP4rev1 CONDSTORE QRESYNC] ready", exchanges)
+	}()
+	c := imapclient.New(clientConn, nil)
+	defer func() {
+		c.Close()
+		if err := <-done; err != nil {
+			t.Errorf("script: %v", err)
+		}
+	}()
+	if err := c.WaitGreeting(); err != nil {
+		t.Fatalf("WaitGreeting() = %v", err)
+	}
+
+	b := NewBridge(c)
+	emails, state, err := b.Emails("INBOX")
+	if err != nil {
+		t.Fatalf("Emails() = %v", err)
+	} else if len(emails) != 3 {
+		t.Fatalf("Emails() returned %v emails, want 3", len(emails))
+	}
+
+	// States which haven't been returned can't be used
+	if _, err := b.EmailChanges("INBOX", "42:9:5"); err != ErrCannotCalculateChanges {
+		t.Errorf("EmailChanges() with unknown state = %v, want ErrCannotCalculateChanges", err)
+	}
+
+	changes, err := b.EmailChanges("INBOX", state)
+	if err != nil {
+		t.Fatalf("EmailChanges() = %v", err)
+	}
+	id := func(uid uint32) string {
+		return EmailID("INBOX", 42, uid)
+	}
+	want := &EmailChanges{
+		OldState:  state,
+		NewState:  "42:15:7",
+		Created:   []string{id(6)},
+		Updated:   []string{id(4)},
+		Destroyed: []string{id(1), id(3)},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("EmailChanges() = %+v, want %+v", changes, want)
+	}
+
+	// The new state can be used in turn
+	changes, err = b.EmailChanges("INBOX", changes.NewState)
+	if err != nil {
+		t.Fatalf("EmailChanges() = %v", err)
+	}
+	if len(changes.Created) > 0 || len(changes.Updated) > 0 || len(changes.Destroyed) > 0 {
+		t.Errorf("EmailChanges() = %+v, want no changes", changes)
+	}
+}
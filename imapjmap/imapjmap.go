@@ -0,0 +1,347 @@
+// Package imapjmap maps IMAP mailboxes and messages onto JMAP Mailbox and
+// Email objects, defined in RFC 8621.
+//
+// This allows hybrid deployments, where a JMAP front-end is backed by an IMAP
+// server during a protocol transition.
+//
+// IMAP servers without the OBJECTID extension don't provide persistent
+// identifiers, so they are derived from the mailbox names, UIDVALIDITY and
+// UIDs. As a consequence:
+//
+//   - a message stored in several mailboxes is represented by several
+//     Emails, each one in a single Mailbox;
+//   - renaming a mailbox changes the IDs of the Mailbox and its Emails;
+//   - each Email is in its own Thread.
+package imapjmap
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+// Mailbox is a JMAP Mailbox object, see RFC 8621 section 2.
+type Mailbox struct {
+	ID            string        `json:"id"`
+	Name          string        `json:"name"`
+	ParentID      string        `json:"parentId,omitempty"`
+	Role          string        `json:"role,omitempty"`
+	SortOrder     uint32        `json:"sortOrder"`
+	TotalEmails   uint32        `json:"totalEmails"`
+	UnreadEmails  uint32        `json:"unreadEmails"`
+	TotalThreads  uint32        `json:"totalThreads"`
+	UnreadThreads uint32        `json:"unreadThreads"`
+	MyRights      MailboxRights `json:"myRights"`
+	IsSubscribed  bool          `json:"isSubscribed"`
+
+	// IMAP name of the mailbox, not part of the JMAP object
+	IMAPName string `json:"-"`
+}
+
+// MailboxRights are the rights of the user on a Mailbox.
+type MailboxRights struct {
+	MayReadItems   bool `json:"mayReadItems"`
+	MayAddItems    bool `json:"mayAddItems"`
+	MayRemoveItems bool `json:"mayRemoveItems"`
+	MaySetSeen     bool `json:"maySetSeen"`
+	MaySetKeywords bool `json:"maySetKeywords"`
+	MayCreateChild bool `json:"mayCreateChild"`
+	MayRename      bool `json:"mayRename"`
+	MayDelete      bool `json:"mayDelete"`
+	MaySubmit      bool `json:"maySubmit"`
+}
+
+// Email is a JMAP Email object, see RFC 8621 section 4. Only the metadata
+// properties are populated: the body properties require downloading the
+// message.
+type Email struct {
+	ID         string          `json:"id"`
+	BlobID     string          `json:"blobId"`
+	ThreadID   string          `json:"threadId"`
+	MailboxIDs map[string]bool `json:"mailboxIds"`
+	Keywords   map[string]bool `json:"keywords"`
+	Size       int64           `json:"size"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+
+	MessageID []string       `json:"messageId,omitempty"`
+	InReplyTo []string       `json:"inReplyTo,omitempty"`
+	Sender    []EmailAddress `json:"sender,omitempty"`
+	From      []EmailAddress `json:"from,omitempty"`
+	To        []EmailAddress `json:"to,omitempty"`
+	Cc        []EmailAddress `json:"cc,omitempty"`
+	Bcc       []EmailAddress `json:"bcc,omitempty"`
+	ReplyTo   []EmailAddress `json:"replyTo,omitempty"`
+	Subject   string         `json:"subject,omitempty"`
+	SentAt    *time.Time     `json:"sentAt,omitempty"`
+
+	HasAttachment bool `json:"hasAttachment"`
+}
+
+// EmailAddress is a JMAP EmailAddress object.
+type EmailAddress struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// MailboxID returns the JMAP ID of an IMAP mailbox.
+func MailboxID(name string) string {
+	if strings.EqualFold(name, "INBOX") {
+		name = "INBOX"
+	}
+	return "M" + hashName(name)
+}
+
+// hashName returns a short, stable identifier for a mailbox name. JMAP IDs
+// are limited to 255 characters from the base64url alphabet.
+func hashName(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:8])
+}
+
+// EmailID returns the JMAP ID of an IMAP message.
+func EmailID(mailbox string, uidValidity, uid uint32) string {
+	return fmt.Sprintf("E%v-%v-%v", MailboxID(mailbox)[1:], uidValidity, uid)
+}
+
+// ParseEmailID parses a JMAP ID returned by EmailID. The mailbox is
+// identified by its JMAP ID.
+func ParseEmailID(id string) (mailboxID string, uidValidity, uid uint32, err error) {
+	parts := strings.Split(strings.TrimPrefix(id, "E"), "-")
+	if !strings.HasPrefix(id, "E") || len(parts) != 3 {
+		return "", 0, 0, fmt.Errorf("imapjmap: invalid Email ID %q", id)
+	}
+	v, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("imapjmap: invalid Email ID %q: %v", id, err)
+	}
+	u, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("imapjmap: invalid Email ID %q: %v", id, err)
+	}
+	return "M" + parts[0], uint32(v), uint32(u), nil
+}
+
+var mailboxRoles = map[imap.MailboxAttr]string{
+	imap.MailboxAttrAll:     "all",
+	imap.MailboxAttrArchive: "archive",
+	imap.MailboxAttrDrafts:  "drafts",
+	imap.MailboxAttrFlagged: "flagged",
+	imap.MailboxAttrJunk:    "junk",
+	imap.MailboxAttrSent:    "sent",
+	imap.MailboxAttrTrash:   "trash",
+}
+
+// ConvertMailboxes converts the results of a LIST command to JMAP Mailboxes.
+//
+// The counters are populated from the STATUS data returned with LIST, if
+// any. Mailboxes which can't be selected are kept, so that their children
+// have a parent, but their items can't be read.
+func ConvertMailboxes(l []*imap.ListData) []Mailbox {
+	names := make(map[string]bool, len(l))
+	for _, data := range l {
+		names[data.Mailbox] = true
+	}
+
+	mailboxes := make([]Mailbox, 0, len(l))
+	for _, data := range l {
+		mbox := Mailbox{
+			ID:       MailboxID(data.Mailbox),
+			Name:     data.Mailbox,
+			IMAPName: data.Mailbox,
+		}
+		if data.Delim != 0 {
+			if i := strings.LastIndexByte(data.Mailbox, byte(data.Delim)); data.Delim < 0x80 && i >= 0 {
+				mbox.Name = data.Mailbox[i+1:]
+				if parent := data.Mailbox[:i]; names[parent] {
+					mbox.ParentID = MailboxID(parent)
+				}
+			}
+		}
+
+		selectable := true
+		for _, attr := range data.Attrs {
+			switch {
+			case strings.EqualFold(string(attr), string(imap.MailboxAttrNoSelect)), strings.EqualFold(string(attr), string(imap.MailboxAttrNonExistent)):
+				selectable = false
+			case strings.EqualFold(string(attr), string(imap.MailboxAttrSubscribed)):
+				mbox.IsSubscribed = true
+			}
+			if role, ok := mailboxRoles[canonicalMailboxAttr(attr)]; ok && mbox.Role == "" {
+				mbox.Role = role
+			}
+		}
+		if strings.EqualFold(data.Mailbox, "INBOX") {
+			mbox.Role = "inbox"
+			mbox.SortOrder = 1
+		}
+
+		if status := data.Status; status != nil {
+			if status.NumMessages != nil {
+				mbox.TotalEmails = *status.NumMessages
+			}
+			if status.NumUnseen != nil {
+				mbox.UnreadEmails = *status.NumUnseen
+			}
+		}
+		mbox.TotalThreads = mbox.TotalEmails
+		mbox.UnreadThreads = mbox.UnreadEmails
+
+		mbox.MyRights = MailboxRights{
+			MayReadItems:   selectable,
+			MayAddItems:    selectable,
+			MayRemoveItems: selectable,
+			MaySetSeen:     selectable,
+			MaySetKeywords: selectable,
+			MayCreateChild: true,
+			MayRename:      mbox.Role != "inbox",
+			MayDelete:      mbox.Role != "inbox",
+			MaySubmit:      false,
+		}
+
+		mailboxes = append(mailboxes, mbox)
+	}
+	return mailboxes
+}
+
+func canonicalMailboxAttr(attr imap.MailboxAttr) imap.MailboxAttr {
+	for known := range mailboxRoles {
+		if strings.EqualFold(string(attr), string(known)) {
+			return known
+		}
+	}
+	return attr
+}
+
+// systemKeywords maps lower-case IMAP system flags to JMAP keywords, see RFC
+// 8621 section 4.1.1. \Deleted and \Recent have no equivalent.
+var systemKeywords = map[string]string{
+	`\seen`:     "$seen",
+	`\flagged`:  "$flagged",
+	`\answered`: "$answered",
+	`\draft`:    "$draft",
+}
+
+// FlagsToKeywords converts IMAP flags to JMAP keywords.
+func FlagsToKeywords(flags []imap.Flag) map[string]bool {
+	keywords := make(map[string]bool, len(flags))
+	for _, flag := range flags {
+		name := strings.ToLower(string(flag))
+		if strings.HasPrefix(name, `\`) {
+			if keyword, ok := systemKeywords[name]; ok {
+				keywords[keyword] = true
+			}
+			continue
+		}
+		keywords[name] = true
+	}
+	return keywords
+}
+
+// KeywordsToFlags converts JMAP keywords to IMAP flags.
+func KeywordsToFlags(keywords map[string]bool) []imap.Flag {
+	var flags []imap.Flag
+	for keyword, ok := range keywords {
+		if !ok {
+			continue
+		}
+		keyword = strings.ToLower(keyword)
+		flag := imap.Flag(keyword)
+		for sys, kw := range systemKeywords {
+			if kw == keyword {
+				flag = imap.Flag(`\` + strings.ToUpper(sys[1:2]) + sys[2:])
+				break
+			}
+		}
+		flags = append(flags, flag)
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		return flags[i] < flags[j]
+	})
+	return flags
+}
+
+// ConvertEmail converts an IMAP message to a JMAP Email.
+//
+// The message should have been fetched with the items returned by
+// EmailFetchItems.
+func ConvertEmail(mailbox string, uidValidity uint32, msg *imapclient.FetchMessageBuffer) *Email {
+	id := EmailID(mailbox, uidValidity, msg.UID)
+	email := &Email{
+		ID:         id,
+		BlobID:     "B" + id[1:],
+		ThreadID:   "T" + id[1:],
+		MailboxIDs: map[string]bool{MailboxID(mailbox): true},
+		Keywords:   FlagsToKeywords(msg.Flags),
+		Size:       msg.RFC822Size,
+		ReceivedAt: msg.InternalDate.UTC(),
+	}
+
+	if env := msg.Envelope; env != nil {
+		email.Subject = env.Subject
+		email.MessageID = parseMsgIDList(env.MessageID)
+		email.InReplyTo = parseMsgIDList(env.InReplyTo)
+		email.Sender = convertAddressList(env.Sender)
+		email.From = convertAddressList(env.From)
+		email.To = convertAddressList(env.To)
+		email.Cc = convertAddressList(env.Cc)
+		email.Bcc = convertAddressList(env.Bcc)
+		email.ReplyTo = convertAddressList(env.ReplyTo)
+		if t, err := mail.ParseDate(env.Date); err == nil {
+			email.SentAt = &t
+		}
+	}
+
+	if bs := msg.BodyStructure; bs != nil {
+		bs.Walk(func(path []int, part imap.BodyStructure) bool {
+			if disp := part.Disposition(); disp != nil && strings.EqualFold(disp.Value, "attachment") {
+				email.HasAttachment = true
+			}
+			return !email.HasAttachment
+		})
+	}
+
+	return email
+}
+
+// EmailFetchItems returns the FETCH items needed by ConvertEmail.
+func EmailFetchItems() []imap.FetchItem {
+	return []imap.FetchItem{
+		imap.FetchItemUID,
+		imap.FetchItemFlags,
+		imap.FetchItemEnvelope,
+		imap.FetchItemInternalDate,
+		imap.FetchItemRFC822Size,
+		imap.FetchItemBodyStructure,
+	}
+}
+
+// parseMsgIDList parses a list of message IDs, removing the angle brackets.
+func parseMsgIDList(s string) []string {
+	var l []string
+	for _, id := range strings.Fields(s) {
+		id = strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+		if id != "" {
+			l = append(l, id)
+		}
+	}
+	return l
+}
+
+func convertAddressList(l []imap.Address) []EmailAddress {
+	var out []EmailAddress
+	for _, addr := range l {
+		if addr.IsGroupStart() || addr.IsGroupEnd() {
+			continue
+		}
+		out = append(out, EmailAddress{Name: addr.Name, Email: addr.Addr()})
+	}
+	return out
+}
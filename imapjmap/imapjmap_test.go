@@ -0,0 +1,92 @@
+package imapjmap
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapclient"
+)
+
+func TestConvertMailboxes(t *testing.T) {
+	uint32Ptr := func(v uint32) *uint32 { return &v }
+
+	mailboxes := ConvertMailboxes([]*imap.ListData{
+		{Mailbox: "INBOX", Delim: '/', Status: &imap.StatusData{NumMessages: uint32Ptr(3), NumUnseen: uint32Ptr(1)}},
+		{Mailbox: "Archive", Delim: '/', Attrs: []imap.MailboxAttr{"\\NoSelect"}},
+		{Mailbox: "Archive/Sent", Delim: '/', Attrs: []imap.MailboxAttr{imap.MailboxAttrSent, imap.MailboxAttrSubscribed}},
+	})
+	if len(mailboxes) != 3 {
+		t.Fatalf("ConvertMailboxes() returned %v mailboxes, want 3", len(mailboxes))
+	}
+
+	inbox, archive, sent := mailboxes[0], mailboxes[1], mailboxes[2]
+	if inbox.Role != "inbox" || inbox.TotalEmails != 3 || inbox.UnreadEmails != 1 || inbox.MyRights.MayDelete {
+		t.Errorf("INBOX = %+v", inbox)
+	}
+	if archive.MyRights.MayReadItems {
+		t.Errorf("\\Noselect mailbox is readable")
+	}
+	if sent.Name != "Sent" || sent.ParentID != archive.ID || sent.Role != "sent" || !sent.IsSubscribed {
+		t.Errorf("Archive/Sent = %+v", sent)
+	}
+	if MailboxID("inbox") != inbox.ID {
+		t.Errorf("MailboxID() is case-sensitive for INBOX")
+	}
+}
+
+func TestConvertEmail(t *testing.T) {
+	date := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	email := ConvertEmail("INBOX", 42, &imapclient.FetchMessageBuffer{
+		UID:          7,
+		Flags:        []imap.Flag{imap.FlagSeen, imap.FlagDeleted, "$Forwarded"},
+		InternalDate: date,
+		RFC822Size:   1234,
+		Envelope: &imap.Envelope{
+			Date:      "Fri, 01 Mar 2024 11:00:00 +0000",
+			Subject:   "Hello",
+			From:      []imap.Address{{Name: "Alice", Mailbox: "alice", Host: "example.org"}},
+			MessageID: "<id@example.org>",
+		},
+		BodyStructure: &imap.BodyStructureMultiPart{
+			Subtype: "mixed",
+			Children: []imap.BodyStructure{
+				&imap.BodyStructureSinglePart{Type: "text", Subtype: "plain"},
+				&imap.BodyStructureSinglePart{
+					Type:     "application",
+					Subtype:  "pdf",
+					Extended: &imap.BodyStructureSinglePartExt{Disposition: &imap.BodyStructureDisposition{Value: "attachment"}},
+				},
+			},
+		},
+	})
+
+	if want := map[string]bool{"$seen": true, "$forwarded": true}; !reflect.DeepEqual(email.Keywords, want) {
+		t.Errorf("Keywords = %v, want %v", email.Keywords, want)
+	}
+	if want := []EmailAddress{{Name: "Alice", Email: "alice@example.org"}}; !reflect.DeepEqual(email.From, want) {
+		t.Errorf("From = %v, want %v", email.From, want)
+	}
+	if !reflect.DeepEqual(email.MessageID, []string{"id@example.org"}) || email.SentAt == nil || !email.HasAttachment {
+		t.Errorf("ConvertEmail() = %+v", email)
+	}
+	if !email.MailboxIDs[MailboxID("INBOX")] {
+		t.Errorf("MailboxIDs = %v, want INBOX", email.MailboxIDs)
+	}
+
+	mailboxID, uidValidity, uid, err := ParseEmailID(email.ID)
+	if err != nil {
+		t.Fatalf("ParseEmailID() = %v", err)
+	}
+	if mailboxID != MailboxID("INBOX") || uidValidity != 42 || uid != 7 {
+		t.Errorf("ParseEmailID() = %v, %v, %v", mailboxID, uidValidity, uid)
+	}
+}
+
+func TestKeywordsToFlags(t *testing.T) {
+	flags := KeywordsToFlags(map[string]bool{"$seen": true, "$Draft": true, "$label": true, "$flagged": false})
+	if want := []imap.Flag{"$label", imap.FlagDraft, imap.FlagSeen}; !reflect.DeepEqual(flags, want) {
+		t.Errorf("KeywordsToFlags() = %v, want %v", flags, want)
+	}
+}
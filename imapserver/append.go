@@ -9,10 +9,9 @@ import (
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
-// appendLimit is the maximum size of an APPEND payload.
-//
-// TODO: make configurable
-const appendLimit = 100 * 1024 * 1024 // 100MiB
+// defaultAppendLimit is the maximum size of an APPEND payload, if the session
+// doesn't implement SessionAppendLimit.
+const defaultAppendLimit = 100 * 1024 * 1024 // 100MiB
 
 func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 	var (
@@ -22,6 +21,7 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
 		return dec.Err()
 	}
+	c.cmdMailbox = mailbox
 
 	hasFlagList, err := dec.List(func() error {
 		flag, err := internal.ReadFlag(dec)
@@ -51,13 +51,24 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 	if err != nil {
 		return err
 	}
-	if lit.Size() > appendLimit {
-		return &imap.Error{
+	// Reject the command before the client uploads the data: for
+	// synchronizing literals, no continuation request is sent
+	rejectErr := c.checkNotAnonymous()
+	if limit := c.appendLimit(mailbox); rejectErr == nil && lit.Size() > limit {
+		rejectErr = &imap.Error{
 			Type: imap.StatusResponseTypeNo,
 			Code: imap.ResponseCodeTooBig,
-			Text: fmt.Sprintf("Literals are limited to %v bytes for this command", appendLimit),
+			Text: fmt.Sprintf("Messages are limited to %v bytes in this mailbox", limit),
 		}
 	}
+	if rejectErr != nil {
+		if nonSync && lit.Size() <= 4096 {
+			// The client doesn't wait for our approval, discard the data
+			io.Copy(io.Discard, lit)
+			dec.CRLF()
+		}
+		return rejectErr
+	}
 	if err := c.acceptLiteral(lit.Size(), nonSync); err != nil {
 		return err
 	}
@@ -71,6 +82,12 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 		return err
 	}
 
+	if err := c.autoCreate(mailbox); err != nil {
+		io.Copy(io.Discard, lit)
+		dec.CRLF()
+		return err
+	}
+
 	data, appendErr := c.session.Append(mailbox, lit, &options)
 	if _, discardErr := io.Copy(io.Discard, lit); discardErr != nil {
 		return err
@@ -79,7 +96,7 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 		return err
 	}
 	if appendErr != nil {
-		return appendErr
+		return c.overQuotaError(mailbox, c.tryCreateError(appendErr, mailbox))
 	}
 	if err := c.poll("APPEND"); err != nil {
 		return err
@@ -87,6 +104,15 @@ func (c *Conn) handleAppend(tag string, dec *imapwire.Decoder) error {
 	return c.writeAppendOK(tag, data)
 }
 
+func (c *Conn) appendLimit(mailbox string) int64 {
+	if session, ok := c.session.(SessionAppendLimit); ok {
+		if limit := session.AppendLimit(mailbox); limit > 0 {
+			return int64(limit)
+		}
+	}
+	return defaultAppendLimit
+}
+
 func (c *Conn) writeAppendOK(tag string, data *imap.AppendData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
@@ -97,6 +123,6 @@ func (c *Conn) writeAppendOK(tag string, data *imap.AppendData) error {
 		enc.Atom("APPENDUID").SP().Number(data.UIDValidity).SP().Number(data.UID)
 		enc.Special(']').SP()
 	}
-	enc.Text("APPEND completed")
+	enc.Text(c.localize("APPEND completed"))
 	return enc.CRLF()
 }
@@ -0,0 +1,58 @@
+package imapserver_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type appendLimitSession struct {
+	imapserver.Session
+}
+
+func (s *appendLimitSession) AppendLimit(mailbox string) uint32 {
+	return 10
+}
+
+func TestAppendTooBig(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return &appendLimitSession{Session: mem.NewSession()}, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+
+	// The command is rejected right away: no continuation request is sent
+	// and the client doesn't upload the message
+	untagged, tagged := roundTrip(t, conn, br, "A2", "APPEND INBOX {100}")
+	if len(untagged) != 0 || !strings.HasPrefix(tagged, "A2 NO [TOOBIG]") {
+		t.Errorf("APPEND responses = %v, %q, want NO [TOOBIG]", untagged, tagged)
+	}
+
+	// Messages within the limit are accepted
+	if _, err := io.WriteString(conn, "A3 APPEND INBOX {4}\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if line, err := br.ReadString('\n'); err != nil || !strings.HasPrefix(line, "+ ") {
+		t.Fatalf("ReadString() = %q, %v, want continuation request", line, err)
+	}
+	if _, err := io.WriteString(conn, "Hi\r\n\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if line, err := br.ReadString('\n'); err != nil || !strings.HasPrefix(line, "A3 OK") {
+		t.Errorf("ReadString() = %q, %v, want OK", line, err)
+	}
+}
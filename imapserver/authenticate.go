@@ -2,6 +2,7 @@ package imapserver
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/emersion/go-sasl"
 
@@ -36,36 +37,16 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateNotAuthenticated); err != nil {
 		return err
 	}
-	if !c.canAuth() {
-		return &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Code: imap.ResponseCodePrivacyRequired,
-			Text: "TLS is required to authenticate",
-		}
-	}
 
-	// TODO: support other SASL mechanisms
-	if mech != "PLAIN" {
-		return &imap.Error{
-			Type: imap.StatusResponseTypeNo,
-			Text: "SASL mechanism not supported",
-		}
+	mech = strings.ToUpper(mech)
+	saslServer, err := c.newSASLServer(mech)
+	if err != nil {
+		return err
 	}
 
 	enc := newResponseEncoder(c)
 	defer enc.end()
 
-	saslServer := sasl.NewPlainServer(func(identity, username, password string) error {
-		if identity != "" && identity != username {
-			return &imap.Error{
-				Type: imap.StatusResponseTypeNo,
-				Code: imap.ResponseCodeAuthorizationFailed,
-				Text: "SASL identity not supported",
-			}
-		}
-		return c.session.Login(username, password)
-	})
-
 	resp := initialResp
 	for {
 		challenge, done, err := saslServer.Next(resp)
@@ -79,6 +60,7 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 		if challenge != nil {
 			challengeStr = internal.EncodeSASL(challenge)
 		}
+		c.faults.delayContinuation()
 		if err := writeContReq(enc.Encoder, challengeStr); err != nil {
 			return err
 		}
@@ -102,10 +84,67 @@ func (c *Conn) handleAuthenticate(tag string, dec *imapwire.Decoder) error {
 	}
 
 	c.state = imap.ConnStateAuthenticated
+	c.anonymous = mech == sasl.Anonymous
 	text := fmt.Sprintf("%v authentication successful", mech)
 	return writeCapabilityOK(enc.Encoder, tag, c.availableCaps(), text)
 }
 
+func (c *Conn) newSASLServer(mech string) (sasl.Server, error) {
+	if !c.filter.allowMechanism(mech) {
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeCannot,
+			Text: "SASL mechanism " + mech + " is disabled",
+		}
+	}
+
+	// TODO: support other SASL mechanisms
+	switch mech {
+	case sasl.Plain:
+		if !c.canAuth() {
+			return nil, &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodePrivacyRequired,
+				Text: "TLS is required to authenticate",
+			}
+		}
+		return sasl.NewPlainServer(func(identity, username, password string) error {
+			if identity == "" || identity == username {
+				if err := c.session.Login(username, password); err != nil {
+					return err
+				}
+				c.setAuthUser(username)
+				return nil
+			}
+			session, ok := c.session.(SessionLoginAs)
+			if !ok {
+				return &imap.Error{
+					Type: imap.StatusResponseTypeNo,
+					Code: imap.ResponseCodeAuthorizationFailed,
+					Text: "SASL identity not supported",
+				}
+			}
+			if err := session.LoginAs(identity, username, password); err != nil {
+				return err
+			}
+			// Traffic is accounted to the account being acted on
+			c.setAuthUser(identity)
+			return nil
+		}), nil
+	case sasl.External:
+		return c.newExternalServer()
+	case sasl.Anonymous:
+		// No credentials are exchanged, so TLS isn't required
+		if session, ok := c.session.(SessionAnonymous); ok {
+			return sasl.NewAnonymousServer(session.LoginAnonymous), nil
+		}
+	}
+	return nil, &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Text: "SASL mechanism not supported",
+	}
+}
+
 func decodeSASL(s string) ([]byte, error) {
 	b, err := internal.DecodeSASL(s)
 	if err != nil {
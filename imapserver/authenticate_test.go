@@ -0,0 +1,123 @@
+package imapserver_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestAuthenticateAnonymous(t *testing.T) {
+	guest := imapmemserver.NewUser("guest", "")
+	if err := guest.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	msg := "Subject: Hello\r\n\r\nHello\r\n"
+	if _, err := guest.Append("INBOX", strings.NewReader(msg), &imap.AppendOptions{}); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	mem := imapmemserver.New()
+	mem.SetAnonymousUser(guest)
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewConnSession(conn), nil
+		},
+		Caps: imap.CapSet{imap.CapIMAP4rev1: {}},
+	})
+
+	trace := base64.StdEncoding.EncodeToString([]byte("guest@example.org"))
+	if _, tagged := roundTrip(t, conn, br, "A1", "AUTHENTICATE ANONYMOUS "+trace); !strings.HasPrefix(tagged, "A1 OK") {
+		t.Fatalf("AUTHENTICATE ANONYMOUS: got %q, want OK", tagged)
+	}
+
+	// SELECT is downgraded to EXAMINE
+	if _, tagged := roundTrip(t, conn, br, "A2", "SELECT INBOX"); !strings.HasPrefix(tagged, "A2 OK [READ-ONLY]") {
+		t.Errorf("SELECT: got %q, want OK [READ-ONLY]", tagged)
+	}
+
+	for _, cmd := range []string{
+		"CREATE Drafts",
+		"DELETE INBOX",
+		"RENAME INBOX Archive",
+		"SUBSCRIBE INBOX",
+		"UNSUBSCRIBE INBOX",
+		"APPEND INBOX {5}",
+		"COPY 1 INBOX",
+		"STORE 1 +FLAGS (\\Deleted)",
+	} {
+		if _, tagged := roundTrip(t, conn, br, "A3", cmd); !strings.HasPrefix(tagged, "A3 NO") {
+			t.Errorf("%v: got %q, want NO", cmd, tagged)
+		}
+	}
+
+	if _, tagged := roundTrip(t, conn, br, "A4", "FETCH 1 (FLAGS)"); !strings.HasPrefix(tagged, "A4 OK") {
+		t.Errorf("FETCH: got %q, want OK", tagged)
+	}
+	// The mailbox must not have been created by the anonymous session
+	if err := guest.Create("Drafts"); err != nil {
+		t.Errorf("Create(Drafts) = %v", err)
+	}
+}
+
+// loginAsSession lets "admin" act as any user.
+type loginAsSession struct {
+	imapserver.Session
+}
+
+func (s *loginAsSession) LoginAs(authzid, username, password string) error {
+	if username != "admin" {
+		return imapserver.ErrAuthzFailed
+	}
+	return s.Login(username, password)
+}
+
+func TestAuthenticatePlainAuthzid(t *testing.T) {
+	newSession := func(withLoginAs bool) func(*imapserver.Conn) (imapserver.Session, error) {
+		return func(*imapserver.Conn) (imapserver.Session, error) {
+			mem := imapmemserver.New()
+			for _, username := range []string{"admin", "alice", "bob"} {
+				mem.AddUser(imapmemserver.NewUser(username, "secret"))
+			}
+			if withLoginAs {
+				return &loginAsSession{mem.NewSession()}, nil
+			}
+			return mem.NewSession(), nil
+		}
+	}
+	plain := func(authzid, username string) string {
+		return base64.StdEncoding.EncodeToString([]byte(authzid + "\x00" + username + "\x00secret"))
+	}
+
+	tests := []struct {
+		withLoginAs       bool
+		authzid, username string
+		want              string
+	}{
+		{false, "", "alice", "A1 OK"},
+		{false, "alice", "alice", "A1 OK"},
+		{false, "alice", "admin", "A1 NO [AUTHORIZATIONFAILED]"},
+		{true, "alice", "admin", "A1 OK"},
+		{true, "alice", "bob", "A1 NO [AUTHORIZATIONFAILED]"},
+	}
+	for _, tc := range tests {
+		conn, br := newTestConn(t, &imapserver.Options{
+			NewSession:   newSession(tc.withLoginAs),
+			Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+			InsecureAuth: true,
+		})
+		_, tagged := roundTrip(t, conn, br, "A1", "AUTHENTICATE PLAIN "+plain(tc.authzid, tc.username))
+		if !strings.HasPrefix(tagged, tc.want) {
+			t.Errorf("AUTHENTICATE PLAIN %q as %q (LoginAs: %v): got %q, want %q", tc.username, tc.authzid, tc.withLoginAs, tagged, tc.want)
+		}
+		if strings.HasPrefix(tc.want, "A1 NO") {
+			// The connection must stay unauthenticated
+			if _, tagged := roundTrip(t, conn, br, "A2", "SELECT INBOX"); !strings.HasPrefix(tagged, "A2 BAD") && !strings.HasPrefix(tagged, "A2 NO") {
+				t.Errorf("SELECT after failed AUTHENTICATE: got %q, want BAD or NO", tagged)
+			}
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package imapserver
 
 import (
+	"github.com/emersion/go-sasl"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
@@ -43,14 +45,24 @@ func (c *Conn) availableCaps() []imap.Cap {
 			imap.CapLiteralMinus,
 		}...)
 	}
+	if len(c.server.options.Languages) > 0 {
+		caps = append(caps, imap.CapLanguage)
+	}
 	if c.canStartTLS() {
 		caps = append(caps, imap.CapStartTLS)
 	}
-	if c.canAuth() {
-		caps = append(caps, imap.Cap("AUTH=PLAIN"))
-	} else if c.state == imap.ConnStateNotAuthenticated {
+	if c.canAuth() && c.filter.allowMechanism(sasl.Plain) {
+		caps = append(caps, imap.Cap("AUTH="+sasl.Plain))
+	}
+	if c.state == imap.ConnStateNotAuthenticated && (!c.canAuth() || !c.filter.allowCommand("LOGIN")) {
 		caps = append(caps, imap.CapLoginDisabled)
 	}
+	if c.canAuthExternal() && c.filter.allowMechanism(sasl.External) {
+		caps = append(caps, imap.Cap("AUTH="+sasl.External))
+	}
+	if _, ok := c.session.(SessionAnonymous); ok && c.state == imap.ConnStateNotAuthenticated && c.filter.allowMechanism(sasl.Anonymous) {
+		caps = append(caps, imap.Cap("AUTH="+sasl.Anonymous))
+	}
 	if c.state == imap.ConnStateAuthenticated || c.state == imap.ConnStateSelected {
 		if available.Has(imap.CapIMAP4rev1) {
 			caps = append(caps, []imap.Cap{
@@ -67,10 +79,28 @@ func (c *Conn) availableCaps() []imap.Cap {
 				imap.CapListStatus,
 				imap.CapMove,
 				imap.CapStatusSize,
+				imap.CapI18NLevel1,
 			})
+			if _, ok := c.session.(SessionChildren); ok && available.Has(imap.CapIMAP4rev1) {
+				caps = append(caps, imap.CapChildren)
+			}
+			if _, ok := c.session.(SessionEnable); ok {
+				addAvailableCaps(&caps, available, []imap.Cap{
+					imap.CapCondStore,
+					imap.CapQResync,
+					imap.CapUTF8Accept,
+				})
+			}
+			if available.Has(imap.CapQuota) {
+				caps = append(caps, []imap.Cap{
+					imap.CapQuota,
+					imap.Cap("QUOTA=RES-" + string(imap.QuotaResourceStorage)),
+					imap.Cap("QUOTA=RES-" + string(imap.QuotaResourceMessage)),
+				}...)
+			}
 		}
 	}
-	return caps
+	return c.filter.filterCaps(caps)
 }
 
 func addAvailableCaps(caps *[]imap.Cap, available imap.CapSet, l []imap.Cap) {
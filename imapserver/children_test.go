@@ -0,0 +1,56 @@
+package imapserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+type childrenSession struct {
+	Session
+	parents map[string]bool
+	calls   int
+}
+
+func (s *childrenSession) HasChildren(mailbox string) (bool, error) {
+	s.calls++
+	return s.parents[mailbox], nil
+}
+
+func TestAddChildrenAttr(t *testing.T) {
+	session := &childrenSession{parents: map[string]bool{"Archive": true}}
+	c := &Conn{session: session}
+
+	tests := []struct {
+		data *imap.ListData
+		want []imap.MailboxAttr
+	}{
+		{&imap.ListData{Mailbox: "Archive"}, []imap.MailboxAttr{imap.MailboxAttrHasChildren}},
+		{&imap.ListData{Mailbox: "INBOX"}, []imap.MailboxAttr{imap.MailboxAttrHasNoChildren}},
+		{
+			&imap.ListData{Mailbox: "Sent", Attrs: []imap.MailboxAttr{imap.MailboxAttrNoInferiors}},
+			[]imap.MailboxAttr{imap.MailboxAttrNoInferiors},
+		},
+		{
+			&imap.ListData{Mailbox: "Old", Attrs: []imap.MailboxAttr{imap.MailboxAttrNonExistent}},
+			[]imap.MailboxAttr{imap.MailboxAttrNonExistent},
+		},
+	}
+	for _, tc := range tests {
+		orig := append([]imap.MailboxAttr(nil), tc.data.Attrs...)
+		got, err := c.addChildrenAttr(tc.data)
+		if err != nil {
+			t.Fatalf("addChildrenAttr(%q) = %v", tc.data.Mailbox, err)
+		}
+		if !reflect.DeepEqual(got.Attrs, tc.want) {
+			t.Errorf("addChildrenAttr(%q) attrs = %v, want %v", tc.data.Mailbox, got.Attrs, tc.want)
+		}
+		if !reflect.DeepEqual(tc.data.Attrs, orig) {
+			t.Errorf("addChildrenAttr(%q) modified the original attrs", tc.data.Mailbox)
+		}
+	}
+	if session.calls != 3 {
+		t.Errorf("HasChildren called %v times, want 3", session.calls)
+	}
+}
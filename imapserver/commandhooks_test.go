@@ -0,0 +1,98 @@
+package imapserver_test
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type commandHooksSession struct {
+	imapserver.Session
+
+	mutex  sync.Mutex
+	events []string
+}
+
+func (s *commandHooksSession) BeginCommand(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events = append(s.events, "begin "+name)
+	if name == "DELETE" {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeNoPerm,
+			Text: "Read-only account",
+		}
+	}
+	return nil
+}
+
+func (s *commandHooksSession) EndCommand(name string, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	event := "end " + name
+	if err != nil {
+		event += ": error"
+	}
+	s.events = append(s.events, event)
+}
+
+func (s *commandHooksSession) takeEvents() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	events := s.events
+	s.events = nil
+	return events
+}
+
+func TestSessionCommandHooks(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Archive"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+	}
+	mem.AddUser(user)
+
+	session := &commandHooksSession{Session: mem.NewSession()}
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return session, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+
+	tests := []struct {
+		cmd    string
+		resp   string // prefix of the tagged response, without the tag
+		events []string
+	}{
+		{cmd: "LOGIN alice secret", resp: "OK", events: []string{"begin LOGIN", "end LOGIN"}},
+		{cmd: "SELECT INBOX", resp: "OK", events: []string{"begin SELECT", "end SELECT"}},
+		{cmd: "UID FETCH 1:* FLAGS", resp: "OK", events: []string{"begin UID FETCH", "end UID FETCH"}},
+		// The error returned by the command is passed to EndCommand
+		{cmd: "SELECT Missing", resp: "NO", events: []string{"begin SELECT", "end SELECT: error"}},
+		// The command isn't executed if BeginCommand fails: the error is sent
+		// to the client, EndCommand isn't called and the mailbox still exists
+		{cmd: "DELETE Archive", resp: "NO [NOPERM] Read-only account", events: []string{"begin DELETE"}},
+		{cmd: "STATUS Archive (MESSAGES)", resp: "OK", events: []string{"begin STATUS", "end STATUS"}},
+	}
+	for i, tc := range tests {
+		tag := fmt.Sprintf("A%v", i+1)
+		_, tagged := roundTrip(t, conn, br, tag, tc.cmd)
+		if !strings.HasPrefix(tagged, tag+" "+tc.resp) {
+			t.Errorf("%v: got %q, want %v", tc.cmd, tagged, tc.resp)
+		}
+		if events := session.takeEvents(); !reflect.DeepEqual(events, tc.events) {
+			t.Errorf("%v: hooks called %v, want %v", tc.cmd, events, tc.events)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package imapserver
+
+import (
+	"golang.org/x/text/language"
+	"golang.org/x/text/search"
+)
+
+// Comparator matches strings in SEARCH criteria.
+//
+// See RFC 5255 section 4.
+type Comparator interface {
+	// Contains reports whether substr is within s.
+	Contains(s, substr string) bool
+}
+
+// DefaultComparator is the comparator used if Options.Comparator is nil.
+//
+// It ignores case, diacritics and character width differences, as required by
+// the I18NLEVEL=1 extension.
+var DefaultComparator Comparator = &collateComparator{
+	matcher: search.New(language.Und, search.Loose),
+}
+
+type collateComparator struct {
+	matcher *search.Matcher
+}
+
+func (cmp *collateComparator) Contains(s, substr string) bool {
+	if substr == "" {
+		return true
+	}
+	start, _ := cmp.matcher.IndexString(s, substr)
+	return start >= 0
+}
+
+// Comparator returns the comparator backends should use to match strings in
+// SEARCH criteria.
+//
+// Backends performing their own normalization, e.g. in a full-text index, can
+// ignore it.
+func (c *Conn) Comparator() Comparator {
+	if cmp := c.server.options.Comparator; cmp != nil {
+		return cmp
+	}
+	return DefaultComparator
+}
@@ -0,0 +1,26 @@
+package imapserver
+
+import (
+	"testing"
+)
+
+func TestDefaultComparator(t *testing.T) {
+	tests := []struct {
+		s, substr string
+		want      bool
+	}{
+		{"Hello World", "world", true},
+		{"Hello World", "", true},
+		{"Hello World", "planet", false},
+		{"Café crème", "cafe creme", true},
+		{"CAFÉ", "café", true},
+		{"Straße", "STRASSE", true},
+		{"ＡＢＣ", "abc", true},
+		{"naïve", "naive", true},
+	}
+	for _, tc := range tests {
+		if got := DefaultComparator.Contains(tc.s, tc.substr); got != tc.want {
+			t.Errorf("Contains(%q, %q) = %v, want %v", tc.s, tc.substr, got, tc.want)
+		}
+	}
+}
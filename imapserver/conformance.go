@@ -0,0 +1,252 @@
+package imapserver
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// TraceEventType is the type of a conformance trace event.
+type TraceEventType string
+
+const (
+	// A client has connected
+	TraceEventConnect TraceEventType = "connect"
+	// The server has received a command
+	TraceEventCommand TraceEventType = "command"
+	// The server has sent a status response: the greeting, a command
+	// completion result or BYE
+	TraceEventResponse TraceEventType = "response"
+	// The connection has been closed
+	TraceEventDisconnect TraceEventType = "disconnect"
+)
+
+// TraceEvent is an entry of a conformance trace, see
+// Options.ConformanceTrace.
+type TraceEvent struct {
+	Time time.Time      `json:"time"`
+	Type TraceEventType `json:"type"`
+	// Connection identifier, unique for the lifetime of the server
+	Conn uint64 `json:"conn"`
+
+	// For connect events
+	RemoteAddr string `json:"remoteAddr,omitempty"`
+
+	// For command events, the state the command has been received in
+	State string `json:"state,omitempty"`
+	// For command events and tagged responses, the command tag and the
+	// upper-case command name, prefixed with "UID " for UID commands
+	Tag     string `json:"tag,omitempty"`
+	Command string `json:"command,omitempty"`
+
+	// For response events
+	Status imap.StatusResponseType `json:"status,omitempty"`
+	Code   imap.ResponseCode       `json:"code,omitempty"`
+	Text   string                  `json:"text,omitempty"`
+	Caps   []imap.Cap              `json:"caps,omitempty"`
+	// For response events, the time elapsed since the command was received
+	Duration time.Duration `json:"duration,omitempty"`
+	// Specification sections motivating the response, e.g. "RFC 9051
+	// section 6.3.2"
+	Spec []string `json:"spec,omitempty"`
+}
+
+// conformanceTracer writes trace events as JSON lines.
+type conformanceTracer struct {
+	mutex  sync.Mutex
+	enc    *json.Encoder
+	nextID uint64
+}
+
+func newConformanceTracer(w io.Writer) *conformanceTracer {
+	return &conformanceTracer{enc: json.NewEncoder(w)}
+}
+
+func (t *conformanceTracer) newConnID() uint64 {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.nextID++
+	return t.nextID
+}
+
+func (t *conformanceTracer) write(ev *TraceEvent) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	ev.Time = time.Now()
+	t.enc.Encode(ev) // errors are ignored, tracing is best-effort
+}
+
+// traceCommand holds the state of a command being traced. Deferred commands
+// may complete after other commands have been read, so the state is kept per
+// tag.
+type traceCommand struct {
+	tag, name string
+	start     time.Time
+	spec      []string
+}
+
+func (c *Conn) traceEvent(ev *TraceEvent) {
+	if c.tracer == nil {
+		return
+	}
+	ev.Conn = c.traceID
+	c.tracer.write(ev)
+}
+
+func (c *Conn) traceBeginCommand(tag, name string) {
+	if c.tracer == nil {
+		return
+	}
+	c.traceMutex.Lock()
+	if c.traceCmds == nil {
+		c.traceCmds = make(map[string]*traceCommand)
+	}
+	c.traceCmds[tag] = &traceCommand{tag: tag, name: name, start: time.Now()}
+	c.traceTag = tag
+	c.traceMutex.Unlock()
+	c.traceEvent(&TraceEvent{
+		Type:    TraceEventCommand,
+		State:   c.state.String(),
+		Tag:     tag,
+		Command: name,
+	})
+}
+
+// traceSpec records a specification section motivating the response to the
+// command being read.
+func (c *Conn) traceSpec(ref string) {
+	if c.tracer == nil {
+		return
+	}
+	c.traceMutex.Lock()
+	tag := c.traceTag
+	c.traceMutex.Unlock()
+	c.traceCommandSpec(tag, ref)
+}
+
+// traceCommandSpec records a specification section motivating the response
+// to a command.
+func (c *Conn) traceCommandSpec(tag, ref string) {
+	if c.tracer == nil {
+		return
+	}
+	c.traceMutex.Lock()
+	if cmd := c.traceCmds[tag]; cmd != nil {
+		cmd.spec = append(cmd.spec, ref)
+	}
+	c.traceMutex.Unlock()
+}
+
+func (c *Conn) traceResponse(tag string, resp *imap.StatusResponse, caps []imap.Cap) {
+	if c.tracer == nil {
+		return
+	}
+	ev := TraceEvent{
+		Type:   TraceEventResponse,
+		Tag:    tag,
+		Status: resp.Type,
+		Code:   resp.Code,
+		Text:   resp.Text,
+		Caps:   caps,
+	}
+	c.traceMutex.Lock()
+	if cmd := c.traceCmds[tag]; tag != "" && cmd != nil {
+		ev.Command = cmd.name
+		ev.Duration = time.Since(cmd.start)
+		if ref, ok := commandSpecs[cmd.name]; ok {
+			ev.Spec = append(ev.Spec, ref)
+		}
+		ev.Spec = append(ev.Spec, cmd.spec...)
+		delete(c.traceCmds, tag)
+	}
+	c.traceMutex.Unlock()
+	if rfc9051ResponseCodes[resp.Code] {
+		ev.Spec = append(ev.Spec, specResponseCode)
+	}
+	c.traceEvent(&ev)
+}
+
+// responseCodeCapability is the CAPABILITY response code, written by
+// writeCapabilityStatus.
+const responseCodeCapability imap.ResponseCode = "CAPABILITY"
+
+const (
+	specStates       = "RFC 9051 section 3"
+	specSyntax       = "RFC 9051 section 9"
+	specReadOnly     = "RFC 9051 section 6.3.3"
+	specResponseCode = "RFC 9051 section 7.1"
+	specPipelining   = "RFC 9051 section 5.5"
+)
+
+var commandSpecs = map[string]string{
+	"CAPABILITY":   "RFC 9051 section 6.1.1",
+	"NOOP":         "RFC 9051 section 6.1.2",
+	"LOGOUT":       "RFC 9051 section 6.1.3",
+	"STARTTLS":     "RFC 9051 section 6.2.1",
+	"AUTHENTICATE": "RFC 9051 section 6.2.2",
+	"LOGIN":        "RFC 9051 section 6.2.3",
+	"ENABLE":       "RFC 9051 section 6.3.1",
+	"SELECT":       "RFC 9051 section 6.3.2",
+	"EXAMINE":      "RFC 9051 section 6.3.3",
+	"CREATE":       "RFC 9051 section 6.3.4",
+	"DELETE":       "RFC 9051 section 6.3.5",
+	"RENAME":       "RFC 9051 section 6.3.6",
+	"SUBSCRIBE":    "RFC 9051 section 6.3.7",
+	"UNSUBSCRIBE":  "RFC 9051 section 6.3.8",
+	"LIST":         "RFC 9051 section 6.3.9",
+	"NAMESPACE":    "RFC 9051 section 6.3.10",
+	"STATUS":       "RFC 9051 section 6.3.11",
+	"APPEND":       "RFC 9051 section 6.3.12",
+	"IDLE":         "RFC 9051 section 6.3.13",
+	"CLOSE":        "RFC 9051 section 6.4.1",
+	"UNSELECT":     "RFC 9051 section 6.4.2",
+	"EXPUNGE":      "RFC 9051 section 6.4.3",
+	"SEARCH":       "RFC 9051 section 6.4.4",
+	"FETCH":        "RFC 9051 section 6.4.5",
+	"STORE":        "RFC 9051 section 6.4.6",
+	"COPY":         "RFC 9051 section 6.4.7",
+	"MOVE":         "RFC 9051 section 6.4.8",
+	"UID EXPUNGE":  "RFC 9051 section 6.4.9",
+	"UID SEARCH":   "RFC 9051 section 6.4.9",
+	"UID FETCH":    "RFC 9051 section 6.4.9",
+	"UID STORE":    "RFC 9051 section 6.4.9",
+	"UID COPY":     "RFC 9051 section 6.4.9",
+	"UID MOVE":     "RFC 9051 section 6.4.9",
+	"CHECK":        "RFC 3501 section 6.4.1",
+	"LSUB":         "RFC 3501 section 6.3.9",
+	"LANGUAGE":     "RFC 5255 section 3.2",
+	"GETQUOTA":     "RFC 9208 section 4.2",
+	"GETQUOTAROOT": "RFC 9208 section 4.3",
+}
+
+// rfc9051ResponseCodes contains the response codes defined in RFC 9051
+// section 7.1.
+var rfc9051ResponseCodes = map[imap.ResponseCode]bool{
+	imap.ResponseCodeAlert:                true,
+	imap.ResponseCodeAlreadyExists:        true,
+	imap.ResponseCodeAuthenticationFailed: true,
+	imap.ResponseCodeAuthorizationFailed:  true,
+	imap.ResponseCodeBadCharset:           true,
+	imap.ResponseCodeCannot:               true,
+	imap.ResponseCodeClientBug:            true,
+	imap.ResponseCodeContactAdmin:         true,
+	imap.ResponseCodeCorruption:           true,
+	imap.ResponseCodeExpired:              true,
+	imap.ResponseCodeHasChildren:          true,
+	imap.ResponseCodeInUse:                true,
+	imap.ResponseCodeLimit:                true,
+	imap.ResponseCodeNonExistent:          true,
+	imap.ResponseCodeNoPerm:               true,
+	imap.ResponseCodeOverQuota:            true,
+	imap.ResponseCodeParse:                true,
+	imap.ResponseCodePrivacyRequired:      true,
+	imap.ResponseCodeReadOnly:             true,
+	imap.ResponseCodeReadWrite:            true,
+	imap.ResponseCodeServerBug:            true,
+	imap.ResponseCodeTryCreate:            true,
+	imap.ResponseCodeUnavailable:          true,
+	imap.ResponseCodeUnknownCTE:           true,
+}
@@ -0,0 +1,92 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestConformanceTrace(t *testing.T) {
+	traceReader, traceWriter := io.Pipe()
+	defer traceReader.Close()
+
+	mem := imapmemserver.New()
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		ConformanceTrace: traceWriter,
+	})
+	defer server.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	defer conn.Close()
+	go io.Copy(io.Discard, conn)
+	if _, err := io.WriteString(conn, "A1 SELECT INBOX\r\nA2 LOGOUT\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	type event struct {
+		Type    imapserver.TraceEventType
+		Tag     string
+		Command string
+		Status  imap.StatusResponseType
+		Spec    []string
+	}
+	want := []event{
+		{Type: imapserver.TraceEventConnect},
+		{Type: imapserver.TraceEventResponse, Status: imap.StatusResponseTypeOK},
+		{Type: imapserver.TraceEventCommand, Tag: "A1", Command: "SELECT"},
+		{
+			Type:    imapserver.TraceEventResponse,
+			Tag:     "A1",
+			Command: "SELECT",
+			Status:  imap.StatusResponseTypeBad,
+			Spec:    []string{"RFC 9051 section 6.3.2", "RFC 9051 section 3", "RFC 9051 section 7.1"},
+		},
+		{Type: imapserver.TraceEventCommand, Tag: "A2", Command: "LOGOUT"},
+		{Type: imapserver.TraceEventResponse, Status: imap.StatusResponseTypeBye},
+		{
+			Type:    imapserver.TraceEventResponse,
+			Tag:     "A2",
+			Command: "LOGOUT",
+			Status:  imap.StatusResponseTypeOK,
+			Spec:    []string{"RFC 9051 section 6.1.3"},
+		},
+		{Type: imapserver.TraceEventDisconnect},
+	}
+
+	scanner := bufio.NewScanner(traceReader)
+	for i, w := range want {
+		if !scanner.Scan() {
+			t.Fatalf("missing event #%v: %v", i, scanner.Err())
+		}
+		var ev imapserver.TraceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("json.Unmarshal() = %v", err)
+		}
+		if ev.Conn != 1 {
+			t.Errorf("event #%v: conn = %v, want 1", i, ev.Conn)
+		}
+		got := event{ev.Type, ev.Tag, ev.Command, ev.Status, ev.Spec}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("event #%v = %+v, want %+v", i, got, w)
+		}
+	}
+}
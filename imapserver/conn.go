@@ -44,19 +44,70 @@ type Conn struct {
 
 	state   imap.ConnState
 	session Session
+
+	// Name of the selected mailbox, only valid in the selected state
+	mailbox string
+	// Whether the selected mailbox has been opened in read-only mode
+	readOnly bool
+	// Selected mailbox whose opening has been deferred, see
+	// SessionMailboxSummary
+	deferredSelect *deferredSelect
+	// Whether the client has authenticated with SASL ANONYMOUS
+	anonymous bool
+	// Mailbox the current command operates on, for statistics
+	cmdMailbox string
+
+	writeLimiter *rateLimiter       // immutable
+	faults       *faultInjector     // immutable
+	filter       *CommandFilter     // immutable
+	tracer       *conformanceTracer // immutable
+	traceID      uint64             // immutable
+	traceMutex   sync.Mutex
+	traceCmds    map[string]*traceCommand // by tag, protected by traceMutex
+	traceTag     string                   // protected by traceMutex
+	// Closed when the connection is closed, to interrupt writers waiting
+	// for the write rate limits
+	closed    chan struct{}
+	closeOnce sync.Once
+	// Authenticated user and its write rate limiter, protected by mutex
+	authUser    string
+	userLimiter *rateLimiter
+	// Language selected with the LANGUAGE command, protected by mutex
+	language string
+	// Whether the current command has sent EXPUNGE responses, whether the
+	// client had sent more data before its tagged response was written, and
+	// whether the next command was pipelined after such a command, protected
+	// by mutex
+	cmdExpunged, cmdPipelined, pipelineHazard bool
+	// Number of deferred commands in progress, protected by mutex
+	numDeferred int
+	deferred    sync.WaitGroup
 }
 
 func newConn(c net.Conn, server *Server) *Conn {
 	rw := server.options.wrapReadWriter(c)
-	br := bufio.NewReader(rw)
-	bw := bufio.NewWriter(rw)
-	return &Conn{
+	conn := &Conn{
 		conn:    c,
 		server:  server,
-		br:      br,
-		bw:      bw,
+		br:      bufio.NewReader(rw),
 		enabled: make(imap.CapSet),
+		closed:  make(chan struct{}),
+	}
+	if server.options.WriteRateLimit > 0 {
+		conn.writeLimiter = newRateLimiter(server.options.WriteRateLimit)
+	}
+	if faults := server.options.Faults; faults != nil {
+		conn.faults = newFaultInjector(faults)
 	}
+	conn.bw = bufio.NewWriter(conn.wrapWriter(rw))
+	if server.options.CommandFilter != nil {
+		conn.filter = server.options.CommandFilter(conn)
+	}
+	if server.tracer != nil {
+		conn.tracer = server.tracer
+		conn.traceID = server.tracer.newConnID()
+	}
+	return conn
 }
 
 // NetConn returns the underlying connection that is wrapped by the IMAP
@@ -70,13 +121,21 @@ func (c *Conn) NetConn() net.Conn {
 	return c.conn
 }
 
+// close closes the underlying connection.
+func (c *Conn) close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+	})
+	return c.NetConn().Close()
+}
+
 // Bye terminates the IMAP connection.
 func (c *Conn) Bye(text string) error {
 	respErr := c.writeStatusResp("", &imap.StatusResponse{
 		Type: imap.StatusResponseTypeBye,
 		Text: text,
 	})
-	closeErr := c.conn.Close()
+	closeErr := c.close()
 	if respErr != nil {
 		return respErr
 	}
@@ -84,26 +143,44 @@ func (c *Conn) Bye(text string) error {
 }
 
 func (c *Conn) serve() {
+	c.traceEvent(&TraceEvent{Type: TraceEventConnect, RemoteAddr: c.conn.RemoteAddr().String()})
+	defer c.traceEvent(&TraceEvent{Type: TraceEventDisconnect})
+
+	// Set if the connection has been handed over to Options.TLSNextProto
+	takenOver := false
 	defer func() {
 		if v := recover(); v != nil {
 			c.server.logger().Printf("panic handling command: %v\n%s", v, debug.Stack())
 		}
 
-		c.conn.Close()
+		if !takenOver {
+			c.close()
+		}
 	}()
 
 	c.server.mutex.Lock()
 	c.server.conns[c] = struct{}{}
 	c.server.mutex.Unlock()
 	defer func() {
+		c.releaseAuthUser()
 		c.server.mutex.Lock()
 		delete(c.server.conns, c)
 		c.server.mutex.Unlock()
 	}()
 
 	var err error
+	if tlsConn, ok := c.conn.(*tls.Conn); ok {
+		if takenOver, err = c.handshakeTLS(tlsConn); err != nil {
+			c.server.logger().Printf("TLS handshake error: %v", err)
+			return
+		} else if takenOver {
+			return
+		}
+	}
+
 	c.session, err = c.server.options.NewSession(c)
 	if err != nil {
+		err = mapBackendError(err)
 		var (
 			resp    *imap.StatusResponse
 			imapErr *imap.Error
@@ -121,6 +198,7 @@ func (c *Conn) serve() {
 	}
 
 	defer func() {
+		c.deferred.Wait()
 		if c.session != nil {
 			if err := c.session.Close(); err != nil {
 				c.server.logger().Printf("failed to close session: %v", err)
@@ -135,12 +213,15 @@ func (c *Conn) serve() {
 	if _, ok := c.session.(SessionNamespace); !ok && caps.Has(imap.CapNamespace) {
 		panic("imapserver: server advertises NAMESPACE but session doesn't support it")
 	}
-	if _, ok := c.session.(SessionMove); !ok && caps.Has(imap.CapMove) {
+	if !sessionSupportsMove(c.session) && caps.Has(imap.CapMove) {
 		panic("imapserver: server advertises MOVE but session doesn't support it")
 	}
 
 	c.state = imap.ConnStateNotAuthenticated
-	if err := c.writeCapabilityOK("", "IMAP server ready"); err != nil {
+	if session, ok := c.session.(SessionPreAuth); ok && session.PreAuth() {
+		c.state = imap.ConnStateAuthenticated
+	}
+	if err := c.writeGreeting(); err != nil {
 		c.server.logger().Printf("failed to write greeting: %v", err)
 		return
 	}
@@ -149,7 +230,7 @@ func (c *Conn) serve() {
 		var readTimeout time.Duration
 		switch c.state {
 		case imap.ConnStateAuthenticated, imap.ConnStateSelected:
-			readTimeout = idleReadTimeout
+			readTimeout = c.server.options.autologoutTimeout()
 		default:
 			readTimeout = cmdReadTimeout
 		}
@@ -157,10 +238,22 @@ func (c *Conn) serve() {
 
 		dec := imapwire.NewDecoder(c.br, imapwire.ConnSideServer)
 		dec.CheckBufferedLiteralFunc = c.checkBufferedLiteral
+		dec.SeqSetOptions = c.server.options.SeqSetParseOptions
 
 		if c.state == imap.ConnStateLogout || dec.EOF() {
 			break
 		}
+		if err := dec.Err(); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if err := c.Bye("Autologout timer expired"); err != nil && !errors.Is(err, net.ErrClosed) {
+					c.server.logger().Printf("failed to write autologout BYE: %v", err)
+				}
+			} else if !errors.Is(err, net.ErrClosed) {
+				c.server.logger().Printf("failed to read command: %v", err)
+			}
+			break
+		}
 
 		c.setReadTimeout(cmdReadTimeout)
 		if err := c.readCommand(dec); err != nil {
@@ -172,6 +265,32 @@ func (c *Conn) serve() {
 	}
 }
 
+// handshakeTLS performs the TLS handshake for an implicit TLS connection.
+//
+// If the negotiated ALPN protocol is handled by Options.TLSNextProto, the
+// connection is handed over and takenOver is true.
+func (c *Conn) handshakeTLS(tlsConn *tls.Conn) (takenOver bool, err error) {
+	c.setReadTimeout(cmdReadTimeout)
+	c.setWriteTimeout(respWriteTimeout)
+	err = tlsConn.Handshake()
+	c.setReadTimeout(0)
+	c.setWriteTimeout(0)
+	if err != nil {
+		return false, err
+	}
+
+	proto := tlsConn.ConnectionState().NegotiatedProtocol
+	if proto == "" || proto == alpnProtocol {
+		return false, nil
+	}
+	f, ok := c.server.options.TLSNextProto[proto]
+	if !ok {
+		return false, fmt.Errorf("unsupported ALPN protocol %q", proto)
+	}
+	f(tlsConn)
+	return true, nil
+}
+
 func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 	var tag, name string
 	if !dec.ExpectAtom(&tag) || !dec.ExpectSP() || !dec.ExpectAtom(&name) {
@@ -189,9 +308,123 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		name = "UID " + strings.ToUpper(subName)
 	}
 
-	// TODO: handle multiple commands concurrently
-	sendOK := true
-	var err error
+	if err := c.injectDisconnect(); err != nil {
+		return err
+	}
+
+	c.traceBeginCommand(tag, name)
+
+	c.cmdMailbox = ""
+	if c.state == imap.ConnStateSelected {
+		c.cmdMailbox = c.mailbox
+	}
+	c.waitDeferredIfNeeded(name)
+
+	cmd := &runningCommand{tag: tag, name: name, start: time.Now()}
+	cmd.hooks, _ = c.session.(SessionCommandHooks)
+	var (
+		sendOK bool
+		err    error
+	)
+	if !c.filter.allowCommand(name) {
+		err = commandDisabledError(name)
+		cmd.hooks = nil
+	} else if err = c.checkPipelining(name); err != nil {
+		cmd.hooks = nil
+	} else if cmd.hooks != nil {
+		err = cmd.hooks.BeginCommand(name)
+	}
+	var reordered []byte
+	if err == nil {
+		endReorder := c.beginReorder(name)
+		sendOK, err = c.handleCommand(tag, name, numKind, dec)
+		reordered = endReorder()
+	} else {
+		cmd.hooks = nil // EndCommand is only called if BeginCommand succeeded
+	}
+
+	dec.DiscardLine()
+
+	cmd.mailbox = c.cmdMailbox
+	var deferred *deferredResponse
+	if errors.As(err, &deferred) {
+		if deferrableCommands[name] && deferred.run != nil {
+			c.startDeferred(deferred, cmd)
+			return c.writeReordered(reordered)
+		}
+		err = fmt.Errorf("imapserver: Defer isn't supported by %v command", name)
+	}
+
+	if err := c.finishCommand(cmd, sendOK, true, err); err != nil {
+		return err
+	}
+	c.endPipelining(name)
+	return c.writeReordered(reordered)
+}
+
+// runningCommand holds the information needed to complete a command.
+type runningCommand struct {
+	tag, name string
+	mailbox   string
+	start     time.Time
+	hooks     SessionCommandHooks
+}
+
+// finishCommand sends the tagged response of a command, if sendOK is set or
+// if the command failed.
+func (c *Conn) finishCommand(cmd *runningCommand, sendOK, poll bool, err error) error {
+	err = mapBackendError(err)
+	c.observeCommand(cmd, time.Since(cmd.start), err)
+
+	var (
+		resp    *imap.StatusResponse
+		imapErr *imap.Error
+		decErr  *imapwire.DecoderExpectError
+	)
+	if errors.As(err, &imapErr) {
+		resp = (*imap.StatusResponse)(imapErr)
+	} else if errors.As(err, &decErr) {
+		c.traceCommandSpec(cmd.tag, specSyntax)
+		resp = &imap.StatusResponse{
+			Type: imap.StatusResponseTypeBad,
+			Code: imap.ResponseCodeClientBug,
+			Text: "Syntax error: " + decErr.Message,
+		}
+	} else if err != nil {
+		c.server.logger().Printf("handling %v command: %v", cmd.name, err)
+		resp = internalServerErrorResp
+	} else {
+		if !sendOK {
+			if cmd.hooks != nil {
+				cmd.hooks.EndCommand(cmd.name, nil)
+			}
+			return nil
+		}
+		if poll {
+			if err := c.poll(cmd.name); err != nil {
+				if cmd.hooks != nil {
+					cmd.hooks.EndCommand(cmd.name, err)
+				}
+				return err
+			}
+		}
+		resp = &imap.StatusResponse{
+			Type: imap.StatusResponseTypeOK,
+			Text: fmt.Sprintf("%v completed", cmd.name),
+		}
+	}
+	if cmd.hooks != nil {
+		cmd.hooks.EndCommand(cmd.name, err)
+	}
+	if poll && err != nil {
+		// The command may have sent EXPUNGE responses before failing
+		c.recordPipelined()
+	}
+	return c.writeStatusResp(cmd.tag, resp)
+}
+
+func (c *Conn) handleCommand(tag, name string, numKind NumKind, dec *imapwire.Decoder) (sendOK bool, err error) {
+	sendOK = true
 	switch name {
 	case "NOOP", "CHECK":
 		err = c.handleNoop(dec)
@@ -210,6 +443,12 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 		sendOK = false
 	case "ENABLE":
 		err = c.handleEnable(dec)
+	case "LANGUAGE":
+		err = c.handleLanguage(dec)
+	case "GETQUOTA":
+		err = c.handleGetQuota(dec)
+	case "GETQUOTAROOT":
+		err = c.handleGetQuotaRoot(dec)
 	case "CREATE":
 		err = c.handleCreate(dec)
 	case "DELETE":
@@ -259,45 +498,15 @@ func (c *Conn) readCommand(dec *imapwire.Decoder) error {
 			Text: "Unknown command",
 		}
 	}
-
-	dec.DiscardLine()
-
-	var (
-		resp    *imap.StatusResponse
-		imapErr *imap.Error
-		decErr  *imapwire.DecoderExpectError
-	)
-	if errors.As(err, &imapErr) {
-		resp = (*imap.StatusResponse)(imapErr)
-	} else if errors.As(err, &decErr) {
-		resp = &imap.StatusResponse{
-			Type: imap.StatusResponseTypeBad,
-			Code: imap.ResponseCodeClientBug,
-			Text: "Syntax error: " + decErr.Message,
-		}
-	} else if err != nil {
-		c.server.logger().Printf("handling %v command: %v", name, err)
-		resp = internalServerErrorResp
-	} else {
-		if !sendOK {
-			return nil
-		}
-		if err := c.poll(name); err != nil {
-			return err
-		}
-		resp = &imap.StatusResponse{
-			Type: imap.StatusResponseTypeOK,
-			Text: fmt.Sprintf("%v completed", name),
-		}
-	}
-	return c.writeStatusResp(tag, resp)
+	return sendOK, err
 }
 
 func (c *Conn) handleNoop(dec *imapwire.Decoder) error {
 	if !dec.ExpectCRLF() {
 		return dec.Err()
 	}
-	return nil
+	// Clients may use NOOP to check for updates in the selected mailbox
+	return c.openDeferredMailbox()
 }
 
 func (c *Conn) handleLogout(dec *imapwire.Decoder) error {
@@ -321,6 +530,9 @@ func (c *Conn) handleCreate(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
+	if err := c.checkNotAnonymous(); err != nil {
+		return err
+	}
 	return c.session.Create(name)
 }
 
@@ -332,7 +544,45 @@ func (c *Conn) handleDelete(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
-	return c.session.Delete(name)
+	if err := c.checkNotAnonymous(); err != nil {
+		return err
+	}
+	if err := c.session.Delete(name); err != nil {
+		return err
+	}
+	if c.state == imap.ConnStateSelected && (imap.MailboxName{Name: c.mailbox}).Equal(imap.MailboxName{Name: name}) {
+		return c.closeDeletedMailbox()
+	}
+	return nil
+}
+
+// closeDeletedMailbox closes the selected mailbox after it has been deleted by
+// this session. Other sessions are disconnected by the SessionTracker.
+//
+// The CLOSED response code is only sent to clients which have enabled an
+// extension defining it: others only get an informational untagged OK.
+func (c *Conn) closeDeletedMailbox() error {
+	if c.deferredSelect != nil {
+		c.deferredSelect = nil
+	} else if err := c.session.Unselect(); err != nil {
+		return err
+	}
+	c.state = imap.ConnStateAuthenticated
+	c.readOnly = false
+	resp := &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Text: "Selected mailbox has been deleted",
+	}
+	if c.closedEnabled() {
+		resp.Code = imap.ResponseCodeClosed
+	}
+	return c.writeStatusResp("", resp)
+}
+
+// closedEnabled returns true if the client understands the CLOSED response
+// code, defined by QRESYNC and IMAP4rev2.
+func (c *Conn) closedEnabled() bool {
+	return c.enabled.Has(imap.CapIMAP4rev2) || c.enabled.Has(imap.CapQResync)
 }
 
 func (c *Conn) handleRename(dec *imapwire.Decoder) error {
@@ -343,6 +593,9 @@ func (c *Conn) handleRename(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
+	if err := c.checkNotAnonymous(); err != nil {
+		return err
+	}
 	return c.session.Rename(oldName, newName)
 }
 
@@ -354,6 +607,9 @@ func (c *Conn) handleSubscribe(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
+	if err := c.checkNotAnonymous(); err != nil {
+		return err
+	}
 	return c.session.Subscribe(name)
 }
 
@@ -365,6 +621,9 @@ func (c *Conn) handleUnsubscribe(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
+	if err := c.checkNotAnonymous(); err != nil {
+		return err
+	}
 	return c.session.Unsubscribe(name)
 }
 
@@ -404,21 +663,64 @@ func (c *Conn) canAuth() bool {
 }
 
 func (c *Conn) writeStatusResp(tag string, statusResp *imap.StatusResponse) error {
+	if text := c.localize(statusResp.Text); text != statusResp.Text {
+		resp := *statusResp
+		resp.Text = text
+		statusResp = &resp
+	}
+
+	c.traceResponse(tag, statusResp, nil)
+
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	return writeStatusResp(enc.Encoder, tag, statusResp)
 }
 
 func (c *Conn) writeContReq(text string) error {
+	c.faults.delayContinuation()
+
 	enc := newResponseEncoder(c)
 	defer enc.end()
-	return writeContReq(enc.Encoder, text)
+	return writeContReq(enc.Encoder, c.localize(text))
 }
 
 func (c *Conn) writeCapabilityOK(tag, text string) error {
+	caps, text := c.availableCaps(), c.localize(text)
+	c.traceResponse(tag, &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Code: responseCodeCapability,
+		Text: text,
+	}, caps)
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	return writeCapabilityOK(enc.Encoder, tag, caps, text)
+}
+
+func (c *Conn) writeGreeting() error {
+	typ := imap.StatusResponseTypeOK
+	if c.state == imap.ConnStateAuthenticated {
+		typ = imap.StatusResponseTypePreAuth
+	}
+
+	text := c.server.options.greetingText()
+	if c.server.options.GreetingOmitCaps {
+		return c.writeStatusResp("", &imap.StatusResponse{
+			Type: typ,
+			Text: text,
+		})
+	}
+
+	caps := c.availableCaps()
+	c.traceResponse("", &imap.StatusResponse{
+		Type: typ,
+		Code: responseCodeCapability,
+		Text: text,
+	}, caps)
+
 	enc := newResponseEncoder(c)
 	defer enc.end()
-	return writeCapabilityOK(enc.Encoder, tag, c.availableCaps(), text)
+	return writeCapabilityStatus(enc.Encoder, "", typ, caps, text)
 }
 
 func (c *Conn) checkState(state imap.ConnState) error {
@@ -426,11 +728,38 @@ func (c *Conn) checkState(state imap.ConnState) error {
 		return nil
 	}
 	if c.state != state {
+		c.traceSpec(specStates)
 		return newClientBugError(fmt.Sprintf("This command is only valid in the %s state", state))
 	}
 	return nil
 }
 
+// checkWritable returns an error if the selected mailbox is read-only.
+func (c *Conn) checkWritable() error {
+	if c.readOnly {
+		c.traceSpec(specReadOnly)
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeReadOnly,
+			Text: "Mailbox is read-only",
+		}
+	}
+	return nil
+}
+
+// checkNotAnonymous returns an error if the client has authenticated with
+// SASL ANONYMOUS. Guest sessions can't modify mailboxes.
+func (c *Conn) checkNotAnonymous() error {
+	if c.anonymous {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeNoPerm,
+			Text: "Anonymous sessions are read-only",
+		}
+	}
+	return nil
+}
+
 func (c *Conn) setReadTimeout(dur time.Duration) {
 	if dur > 0 {
 		c.conn.SetReadDeadline(time.Now().Add(dur))
@@ -460,9 +789,22 @@ func (c *Conn) poll(cmd string) error {
 	case "FETCH", "STORE", "SEARCH":
 		allowExpunge = false
 	}
+	if c.hasDeferred() {
+		// Keep the expunges for a later command, to avoid renumbering
+		// messages under the feet of deferred commands
+		allowExpunge = false
+	}
 
 	w := &UpdateWriter{conn: c, allowExpunge: allowExpunge}
-	return c.session.Poll(w, allowExpunge)
+	err := c.session.Poll(w, allowExpunge)
+	var imapErr *imap.Error
+	if errors.As(err, &imapErr) && imapErr.Type == imap.StatusResponseTypeBye {
+		c.writeStatusResp("", (*imap.StatusResponse)(imapErr))
+		c.close()
+	}
+	// The tagged response is written right after polling
+	c.recordPipelined()
+	return err
 }
 
 type responseEncoder struct {
@@ -472,12 +814,13 @@ type responseEncoder struct {
 
 func newResponseEncoder(conn *Conn) *responseEncoder {
 	conn.mutex.Lock()
-	quotedUTF8 := conn.enabled.Has(imap.CapIMAP4rev2)
+	quotedUTF8 := conn.enabled.Has(imap.CapIMAP4rev2) || conn.enabled.Has(imap.CapUTF8Accept)
 	conn.mutex.Unlock()
 
 	wireEnc := imapwire.NewEncoder(conn.bw, imapwire.ConnSideServer)
 	wireEnc.QuotedUTF8 = quotedUTF8
 
+	conn.waitWriteLimit()
 	conn.encMutex.Lock() // released by responseEncoder.end
 	conn.setWriteTimeout(respWriteTimeout)
 	return &responseEncoder{
@@ -498,7 +841,7 @@ func (enc *responseEncoder) end() {
 func (enc *responseEncoder) Literal(size int64) io.WriteCloser {
 	enc.conn.setWriteTimeout(literalWriteTimeout)
 	return literalWriter{
-		WriteCloser: enc.Encoder.Literal(size, nil),
+		WriteCloser: enc.conn.injectTruncatedLiteral(enc.Encoder.Literal(size, nil), size),
 		conn:        enc.conn,
 	}
 }
@@ -526,11 +869,15 @@ func writeStatusResp(enc *imapwire.Encoder, tag string, statusResp *imap.StatusR
 }
 
 func writeCapabilityOK(enc *imapwire.Encoder, tag string, caps []imap.Cap, text string) error {
+	return writeCapabilityStatus(enc, tag, imap.StatusResponseTypeOK, caps, text)
+}
+
+func writeCapabilityStatus(enc *imapwire.Encoder, tag string, typ imap.StatusResponseType, caps []imap.Cap, text string) error {
 	if tag == "" {
 		tag = "*"
 	}
 
-	enc.Atom(tag).SP().Atom("OK").SP().Special('[').Atom("CAPABILITY")
+	enc.Atom(tag).SP().Atom(string(typ)).SP().Special('[').Atom("CAPABILITY")
 	for _, c := range caps {
 		enc.SP().Atom(string(c))
 	}
@@ -556,6 +903,15 @@ type UpdateWriter struct {
 	allowExpunge bool
 }
 
+// writeMailboxRenamed records the new name of the selected mailbox.
+func (w *UpdateWriter) writeMailboxRenamed(name string) error {
+	w.conn.mailbox = name
+	return w.conn.writeStatusResp("", &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Text: "Selected mailbox has been renamed",
+	})
+}
+
 // WriteExpunge writes an EXPUNGE response.
 func (w *UpdateWriter) WriteExpunge(seqNum uint32) error {
 	if !w.allowExpunge {
@@ -574,6 +930,26 @@ func (w *UpdateWriter) WriteMailboxFlags(flags []imap.Flag) error {
 	return w.conn.writeFlags(flags)
 }
 
+// WriteMailboxStatus writes an untagged STATUS response for a mailbox other
+// than the selected one. Only the items set in data are written.
+//
+// The client must have requested these updates, e.g. via NOTIFY.
+func (w *UpdateWriter) WriteMailboxStatus(data *imap.StatusData) error {
+	items := imapwire.StatusDataItems(data)
+	if w.conn.enabled.Has(imap.CapIMAP4rev2) {
+		// RECENT has been removed in IMAP4rev2
+		n := 0
+		for _, item := range items {
+			if item != imap.StatusItemNumRecent {
+				items[n] = item
+				n++
+			}
+		}
+		items = items[:n]
+	}
+	return w.conn.writeStatus(data, items)
+}
+
 // WriteMessageFlags writes a FETCH response with FLAGS.
 func (w *UpdateWriter) WriteMessageFlags(seqNum, uid uint32, flags []imap.Flag) error {
 	fetchWriter := &FetchWriter{conn: w.conn}
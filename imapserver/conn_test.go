@@ -0,0 +1,54 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+// newTestConn starts a server and connects to it. The greeting is consumed.
+func newTestConn(t *testing.T, options *imapserver.Options) (net.Conn, *bufio.Reader) {
+	server := imapserver.New(options)
+	t.Cleanup(func() { server.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	br := bufio.NewReader(conn)
+	if _, err := br.ReadString('\n'); err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	}
+	return conn, br
+}
+
+// roundTrip sends a command and returns the untagged responses and the
+// tagged one.
+func roundTrip(t *testing.T, conn net.Conn, br *bufio.Reader, tag, cmd string) (untagged []string, tagged string) {
+	if _, err := io.WriteString(conn, tag+" "+cmd+"\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() = %v", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "* ") {
+			untagged = append(untagged, line)
+		} else {
+			return untagged, line
+		}
+	}
+}
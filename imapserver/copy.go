@@ -12,11 +12,18 @@ func (c *Conn) handleCopy(tag string, dec *imapwire.Decoder, numKind NumKind) er
 	}
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
+	} else if err := c.openDeferredMailbox(); err != nil {
+		return err
+	} else if err := c.checkNotAnonymous(); err != nil {
+		return err
 	}
-	data, err := c.session.Copy(numKind, seqSet, dest)
-	if err != nil {
+	if err := c.autoCreate(dest); err != nil {
 		return err
 	}
+	data, err := c.copy(numKind, seqSet, dest)
+	if err != nil {
+		return c.overQuotaError(dest, c.tryCreateError(err, dest))
+	}
 
 	cmdName := "COPY"
 	if numKind == NumKindUID {
@@ -29,6 +36,33 @@ func (c *Conn) handleCopy(tag string, dec *imapwire.Decoder, numKind NumKind) er
 	return c.writeCopyOK(tag, data)
 }
 
+func (c *Conn) copy(numKind NumKind, seqSet imap.SeqSet, dest string) (*imap.CopyData, error) {
+	session, ok := c.session.(SessionBulkCopy)
+	if !ok {
+		return c.session.Copy(numKind, seqSet, dest)
+	}
+	uids, err := c.resolveUIDs(numKind, seqSet)
+	if err != nil || len(uids) == 0 {
+		return nil, err
+	}
+	return session.CopyUIDs(uids, dest)
+}
+
+// resolveUIDs returns the UIDs of the messages in a sequence set.
+func (c *Conn) resolveUIDs(numKind NumKind, numSet imap.SeqSet) (imap.SeqSet, error) {
+	var criteria imap.SearchCriteria
+	if numKind == NumKindUID {
+		criteria.UID = numSet
+	} else {
+		criteria.SeqNum = numSet
+	}
+	data, err := runDeferredSearch(c.session.Search(NumKindUID, &criteria, &imap.SearchOptions{}))
+	if err != nil {
+		return nil, err
+	}
+	return data.All, nil
+}
+
 func (c *Conn) writeCopyOK(tag string, data *imap.CopyData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
@@ -43,7 +77,7 @@ func (c *Conn) writeCopyOK(tag string, data *imap.CopyData) error {
 		enc.Atom("COPYUID").SP().Number(data.UIDValidity).SP().Atom(data.SourceUIDs.String()).SP().Atom(data.DestUIDs.String())
 		enc.Special(']').SP()
 	}
-	enc.Text("COPY completed")
+	enc.Text(c.localize("COPY completed"))
 	return enc.CRLF()
 }
 
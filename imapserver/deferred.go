@@ -0,0 +1,149 @@
+package imapserver
+
+import (
+	"errors"
+	"runtime/debug"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// concurrentCommands lists the commands which can be executed while deferred
+// commands are in progress. They don't change the connection state nor the
+// message sequence numbers, so their results don't depend on the order of
+// execution. Other commands wait for deferred commands to complete.
+var concurrentCommands = map[string]bool{
+	"CAPABILITY":   true,
+	"NOOP":         true,
+	"CHECK":        true,
+	"STATUS":       true,
+	"LIST":         true,
+	"LSUB":         true,
+	"NAMESPACE":    true,
+	"GETQUOTA":     true,
+	"GETQUOTAROOT": true,
+	"FETCH":        true,
+	"UID FETCH":    true,
+	"SEARCH":       true,
+	"UID SEARCH":   true,
+}
+
+// deferrableCommands lists the commands whose session method can return an
+// error created by Defer.
+var deferrableCommands = map[string]bool{
+	"LIST":       true,
+	"FETCH":      true,
+	"UID FETCH":  true,
+	"SEARCH":     true,
+	"UID SEARCH": true,
+}
+
+type deferredResponse struct {
+	run    func() error
+	search func() (*imap.SearchData, error)
+}
+
+func (*deferredResponse) Error() string {
+	return "imapserver: deferred response"
+}
+
+// Defer returns an error which, when returned by Session.Fetch or
+// Session.List, delays the tagged response of the command: f is called on a
+// separate goroutine and the tagged response is sent when it returns. This
+// can be used to run expensive operations on a worker pool.
+//
+// f can keep writing responses with the writer passed to the session method.
+// Its return value is handled as if it was returned by the session method.
+//
+// When the server calls Session.List internally, e.g. for LSUB or to look up
+// a mailbox before SELECT, f is called synchronously instead.
+//
+// Meanwhile, the server keeps processing the commands which can run
+// concurrently per RFC 9051 section 5.5: commands which don't change the
+// connection state nor the selected mailbox. Session methods may thus be
+// called while f is running. Other commands wait for all deferred commands to
+// complete, and EXPUNGE responses aren't sent until then.
+func Defer(f func() error) error {
+	return &deferredResponse{run: f}
+}
+
+// DeferSearch is like Defer, but for Session.Search.
+func DeferSearch(f func() (*imap.SearchData, error)) error {
+	return &deferredResponse{search: f}
+}
+
+// runDeferred runs the function passed to Defer synchronously, if err has
+// been returned by Defer. It's used when the server calls a session method
+// internally, e.g. Session.List to look up a mailbox or for LSUB: the result is
+// needed before the command can continue.
+func runDeferred(err error) error {
+	var deferred *deferredResponse
+	if !errors.As(err, &deferred) || deferred.run == nil {
+		return err
+	}
+	err = deferred.run()
+	if errors.As(err, new(*deferredResponse)) {
+		err = errors.New("imapserver: Defer called by deferred function")
+	}
+	return err
+}
+
+// runDeferredSearch is like runDeferred, but for DeferSearch.
+func runDeferredSearch(data *imap.SearchData, err error) (*imap.SearchData, error) {
+	var deferred *deferredResponse
+	if !errors.As(err, &deferred) || deferred.search == nil {
+		return data, err
+	}
+	data, err = deferred.search()
+	if errors.As(err, new(*deferredResponse)) {
+		err = errors.New("imapserver: DeferSearch called by deferred function")
+	}
+	return data, err
+}
+
+// waitDeferredIfNeeded blocks until all deferred commands have completed,
+// unless the command can run concurrently.
+func (c *Conn) waitDeferredIfNeeded(name string) {
+	if !concurrentCommands[name] {
+		c.deferred.Wait()
+	}
+}
+
+func (c *Conn) hasDeferred() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.numDeferred > 0
+}
+
+// startDeferred runs a deferred command on a separate goroutine, and sends
+// its tagged response when done.
+func (c *Conn) startDeferred(d *deferredResponse, cmd *runningCommand) {
+	c.mutex.Lock()
+	c.numDeferred++
+	c.mutex.Unlock()
+	c.deferred.Add(1)
+
+	go func() {
+		defer c.deferred.Done()
+		defer func() {
+			c.mutex.Lock()
+			c.numDeferred--
+			c.mutex.Unlock()
+		}()
+		defer func() {
+			if v := recover(); v != nil {
+				c.server.logger().Printf("panic handling deferred %v command: %v\n%s", cmd.name, v, debug.Stack())
+				c.close()
+			}
+		}()
+
+		err := d.run()
+		if errors.As(err, new(*deferredResponse)) {
+			err = errors.New("imapserver: Defer called by deferred function")
+		}
+		// Don't poll: the session may be busy handling another command
+		if err := c.finishCommand(cmd, true, false, err); err != nil {
+			c.server.logger().Printf("failed to complete deferred %v command: %v", cmd.name, err)
+			c.close()
+		}
+	}()
+}
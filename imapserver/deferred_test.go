@@ -0,0 +1,200 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type deferredSession struct {
+	imapserver.Session
+	release chan struct{}
+}
+
+func (s *deferredSession) Search(kind imapserver.NumKind, criteria *imap.SearchCriteria, options *imap.SearchOptions) (*imap.SearchData, error) {
+	return nil, imapserver.DeferSearch(func() (*imap.SearchData, error) {
+		<-s.release
+		return s.Session.Search(kind, criteria, options)
+	})
+}
+
+type deferredListSession struct {
+	imapserver.Session
+}
+
+func (s *deferredListSession) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+	return imapserver.Defer(func() error {
+		return s.Session.List(w, ref, patterns, options)
+	})
+}
+
+func newDeferTestConn(t *testing.T, options *imapserver.Options, newSession func(imapserver.Session) imapserver.Session) (net.Conn, *bufio.Reader) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+
+	options.NewSession = func(*imapserver.Conn) (imapserver.Session, error) {
+		return newSession(mem.NewSession()), nil
+	}
+	options.Caps = imap.CapSet{imap.CapIMAP4rev1: {}}
+	options.InsecureAuth = true
+	server := imapserver.New(options)
+	t.Cleanup(func() { server.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	br := bufio.NewReader(conn)
+	if _, err := br.ReadString('\n'); err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	}
+	return conn, br
+}
+
+func TestDefer(t *testing.T) {
+	traceReader, traceWriter := io.Pipe()
+	defer traceReader.Close()
+	var (
+		traceMutex sync.Mutex
+		trace      []imapserver.TraceEvent
+	)
+	go func() {
+		dec := json.NewDecoder(traceReader)
+		for {
+			var ev imapserver.TraceEvent
+			if err := dec.Decode(&ev); err != nil {
+				return
+			}
+			traceMutex.Lock()
+			trace = append(trace, ev)
+			traceMutex.Unlock()
+		}
+	}()
+
+	release := make(chan struct{})
+	conn, br := newDeferTestConn(t, &imapserver.Options{ConformanceTrace: traceWriter}, func(session imapserver.Session) imapserver.Session {
+		return &deferredSession{Session: session, release: release}
+	})
+
+	write := func(s string) {
+		if _, err := io.WriteString(conn, s); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+	// Reads responses until a tagged one, and returns its tag
+	readTagged := func() string {
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() = %v", err)
+			}
+			if strings.HasPrefix(line, "* ") {
+				continue
+			}
+			tag, status, _ := strings.Cut(line, " ")
+			if !strings.HasPrefix(status, "OK") {
+				t.Fatalf("%v", line)
+			}
+			return tag
+		}
+	}
+
+	write("A1 LOGIN alice secret\r\nA2 SELECT INBOX\r\n")
+	readTagged()
+	readTagged()
+
+	// NOOP can run while SEARCH is in progress
+	write("A3 SEARCH ALL\r\nA4 NOOP\r\n")
+	if tag := readTagged(); tag != "A4" {
+		t.Fatalf("got tagged response for %v, want A4", tag)
+	}
+
+	// CREATE waits for SEARCH to complete
+	write("A5 CREATE Archive\r\n")
+	close(release)
+	if tag := readTagged(); tag != "A3" {
+		t.Errorf("got tagged response for %v, want A3", tag)
+	}
+	if tag := readTagged(); tag != "A5" {
+		t.Errorf("got tagged response for %v, want A5", tag)
+	}
+
+	// The trace event of the deferred command isn't mixed up with the
+	// commands received in the meantime
+	write("A6 LOGOUT\r\n")
+	for {
+		if _, err := br.ReadString('\n'); err != nil {
+			break
+		}
+	}
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+	found := false
+	for _, ev := range trace {
+		if ev.Type == imapserver.TraceEventResponse && ev.Tag == "A3" {
+			found = true
+			if ev.Command != "SEARCH" || ev.Duration == 0 {
+				t.Errorf("trace event for A3 = %+v, want SEARCH command with duration", ev)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no trace event for A3")
+	}
+}
+
+func TestDeferInternalList(t *testing.T) {
+	conn, br := newDeferTestConn(t, &imapserver.Options{}, func(session imapserver.Session) imapserver.Session {
+		return &deferredListSession{Session: session}
+	})
+
+	roundTrip := func(tag, cmd string) (untagged []string) {
+		if _, err := io.WriteString(conn, tag+" "+cmd+"\r\n"); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() = %v", err)
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, "* ") {
+				untagged = append(untagged, line)
+				continue
+			}
+			if !strings.HasPrefix(line, tag+" OK") {
+				t.Fatalf("%v: %v", cmd, line)
+			}
+			return untagged
+		}
+	}
+
+	roundTrip("A1", "LOGIN alice secret")
+	if got := roundTrip("A2", `LIST "" *`); len(got) != 1 || !strings.Contains(got[0], "INBOX") {
+		t.Errorf("LIST responses = %v", got)
+	}
+	roundTrip("A3", "SUBSCRIBE INBOX")
+	if got := roundTrip("A5", `LSUB "" *`); len(got) != 1 || !strings.HasPrefix(got[0], "* LSUB") {
+		t.Errorf("LSUB responses = %v", got)
+	}
+	roundTrip("A6", "SELECT INBOX")
+}
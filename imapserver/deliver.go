@@ -0,0 +1,33 @@
+package imapserver
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// ErrUnknownRecipient is returned by Deliverer.DeliverMessage when the
+// recipient doesn't match any user.
+var ErrUnknownRecipient = errors.New("imapserver: unknown recipient")
+
+// Deliverer is a backend which accepts incoming messages from a mail delivery
+// agent, e.g. an LMTP server. IMAP sessions with the destination mailbox
+// selected should be notified of the new message.
+type Deliverer interface {
+	// DeliverMessage stores a message in the mailbox of the user matching the
+	// recipient address. Nil AppendData is returned if the message has been
+	// discarded.
+	DeliverMessage(recipient string, r io.Reader, options *DeliverOptions) (*imap.AppendData, error)
+}
+
+// DeliverOptions contains options for Deliverer.DeliverMessage.
+type DeliverOptions struct {
+	// Destination mailbox. If empty, the backend picks one, usually INBOX.
+	Mailbox string
+	// Flags to set on the delivered message
+	Flags []imap.Flag
+	// Internal date of the message. If zero, the current time is used.
+	Time time.Time
+}
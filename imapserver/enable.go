@@ -1,10 +1,35 @@
 package imapserver
 
 import (
+	"strings"
+
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 )
 
+// enableCaps lists the extensions which can be enabled with ENABLE, along
+// with the extensions they imply.
+//
+// Apart from IMAP4rev2, these extensions can only be enabled if they're
+// listed in Options.Caps and the session implements SessionEnable.
+var enableCaps = map[imap.Cap][]imap.Cap{
+	imap.CapIMAP4rev2:  nil,
+	imap.CapCondStore:  nil,
+	imap.CapQResync:    {imap.CapCondStore}, // RFC 7162 section 3.2.3
+	imap.CapUTF8Accept: nil,
+}
+
+// canonicalEnableCap returns the canonical name of an extension, since
+// capability names are case-insensitive.
+func canonicalEnableCap(name string) imap.Cap {
+	for cap := range enableCaps {
+		if strings.EqualFold(string(cap), name) {
+			return cap
+		}
+	}
+	return imap.Cap(strings.ToUpper(name))
+}
+
 func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 	var requested []imap.Cap
 	for dec.SP() {
@@ -12,7 +37,7 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 		if !dec.ExpectAtom(&c) {
 			return dec.Err()
 		}
-		requested = append(requested, imap.Cap(c))
+		requested = append(requested, canonicalEnableCap(c))
 	}
 	if !dec.ExpectCRLF() {
 		return dec.Err()
@@ -24,18 +49,14 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 
 	var enabled []imap.Cap
 	for _, req := range requested {
-		switch req {
-		case imap.CapIMAP4rev2:
+		ok, err := c.enable(req)
+		if err != nil {
+			return err
+		} else if ok {
 			enabled = append(enabled, req)
 		}
 	}
 
-	c.mutex.Lock()
-	for _, e := range enabled {
-		c.enabled[e] = struct{}{}
-	}
-	c.mutex.Unlock()
-
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	enc.Atom("*").SP().Atom("ENABLED")
@@ -44,3 +65,52 @@ func (c *Conn) handleEnable(dec *imapwire.Decoder) error {
 	}
 	return enc.CRLF()
 }
+
+// enable enables an extension and the extensions it implies. It returns false
+// if the extension cannot be enabled, or if it's already enabled.
+func (c *Conn) enable(cap imap.Cap) (bool, error) {
+	implied, ok := enableCaps[cap]
+	if !ok || (cap != imap.CapIMAP4rev2 && !c.server.options.caps().Has(cap)) {
+		return false, nil
+	}
+	session, hasSessionEnable := c.session.(SessionEnable)
+	if !hasSessionEnable && cap != imap.CapIMAP4rev2 {
+		return false, nil
+	}
+
+	c.mutex.Lock()
+	alreadyEnabled := c.enabled.Has(cap)
+	c.mutex.Unlock()
+	if alreadyEnabled {
+		return false, nil
+	}
+
+	for _, dep := range implied {
+		if _, err := c.enable(dep); err != nil {
+			return false, err
+		}
+	}
+
+	if hasSessionEnable {
+		if err := session.Enable(cap); err != nil {
+			return false, err
+		}
+	}
+
+	c.mutex.Lock()
+	c.enabled[cap] = struct{}{}
+	c.mutex.Unlock()
+	return true, nil
+}
+
+// Enabled returns the extensions enabled by the client with the ENABLE
+// command.
+func (c *Conn) Enabled() imap.CapSet {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	enabled := make(imap.CapSet, len(c.enabled))
+	for cap := range c.enabled {
+		enabled[cap] = struct{}{}
+	}
+	return enabled
+}
@@ -0,0 +1,115 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type enableSession struct {
+	imapserver.Session
+	conn    *imapserver.Conn
+	enabled []imap.Cap
+}
+
+func (s *enableSession) Enable(cap imap.Cap) error {
+	s.enabled = append(s.enabled, cap)
+	return nil
+}
+
+func newEnableTestConn(t *testing.T) (net.Conn, *bufio.Reader, <-chan *enableSession) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("Archive"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+
+	sessions := make(chan *enableSession, 1)
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(conn *imapserver.Conn) (imapserver.Session, error) {
+			session := &enableSession{Session: mem.NewSession(), conn: conn}
+			sessions <- session
+			return session, nil
+		},
+		Caps: imap.CapSet{
+			imap.CapIMAP4rev1: {},
+			imap.CapCondStore: {},
+			imap.CapQResync:   {},
+		},
+		InsecureAuth: true,
+	})
+	if _, tagged := roundTrip(t, conn, br, "A1", "LOGIN alice secret"); !strings.HasPrefix(tagged, "A1 OK") {
+		t.Fatalf("LOGIN: %v", tagged)
+	}
+	return conn, br, sessions
+}
+
+// enableResponse sends an ENABLE command and returns the ENABLED response.
+func enableResponse(t *testing.T, conn net.Conn, br *bufio.Reader, tag, caps string) string {
+	untagged, tagged := roundTrip(t, conn, br, tag, "ENABLE "+caps)
+	if !strings.HasPrefix(tagged, tag+" OK") {
+		t.Fatalf("ENABLE %v: %v", caps, tagged)
+	}
+	for _, line := range untagged {
+		if strings.HasPrefix(line, "* ENABLED") {
+			return line
+		}
+	}
+	return ""
+}
+
+func TestEnable(t *testing.T) {
+	conn, br, sessions := newEnableTestConn(t)
+
+	// UTF8=ACCEPT isn't listed in Options.Caps
+	untagged, _ := roundTrip(t, conn, br, "A2", "CAPABILITY")
+	if len(untagged) != 1 || !strings.Contains(untagged[0], " CONDSTORE") || !strings.Contains(untagged[0], " QRESYNC") || strings.Contains(untagged[0], " UTF8=ACCEPT") {
+		t.Errorf("CAPABILITY responses = %v, want CONDSTORE and QRESYNC without UTF8=ACCEPT", untagged)
+	}
+
+	// QRESYNC implies CONDSTORE, but only the requested extensions are
+	// listed in the ENABLED response
+	if got, want := enableResponse(t, conn, br, "A3", "qresync UTF8=ACCEPT"), "* ENABLED QRESYNC"; got != want {
+		t.Errorf("ENABLE response = %q, want %q", got, want)
+	}
+	if got, want := enableResponse(t, conn, br, "A4", "CONDSTORE QRESYNC imap4rev2"), "* ENABLED IMAP4rev2"; got != want {
+		t.Errorf("second ENABLE response = %q, want %q", got, want)
+	}
+
+	session := <-sessions
+	want := []imap.Cap{imap.CapCondStore, imap.CapQResync, imap.CapIMAP4rev2}
+	if !reflect.DeepEqual(session.enabled, want) {
+		t.Errorf("Enable() calls = %v, want %v", session.enabled, want)
+	}
+	wantEnabled := imap.CapSet{imap.CapCondStore: {}, imap.CapQResync: {}, imap.CapIMAP4rev2: {}}
+	if enabled := session.conn.Enabled(); !reflect.DeepEqual(enabled, wantEnabled) {
+		t.Errorf("Conn.Enabled() = %v, want %v", enabled, wantEnabled)
+	}
+}
+
+func TestEnableQResyncClosed(t *testing.T) {
+	conn, br, _ := newEnableTestConn(t)
+
+	if got, want := enableResponse(t, conn, br, "A2", "QRESYNC"), "* ENABLED QRESYNC"; got != want {
+		t.Errorf("ENABLE response = %q, want %q", got, want)
+	}
+	if _, tagged := roundTrip(t, conn, br, "A3", "SELECT Archive"); !strings.HasPrefix(tagged, "A3 OK") {
+		t.Fatalf("SELECT: %v", tagged)
+	}
+
+	// QRESYNC defines the CLOSED response code
+	untagged, tagged := roundTrip(t, conn, br, "A4", "DELETE Archive")
+	if !strings.HasPrefix(tagged, "A4 OK") {
+		t.Fatalf("DELETE: %v", tagged)
+	}
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* OK [CLOSED]") {
+		t.Errorf("DELETE untagged responses = %v, want OK [CLOSED]", untagged)
+	}
+}
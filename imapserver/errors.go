@@ -0,0 +1,193 @@
+package imapserver
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// Generic errors which can be returned by sessions, possibly wrapped with
+// fmt.Errorf and %w. The server translates them to NO responses with the
+// appropriate response code, without exposing the wrapping error text to the
+// client.
+//
+// Sessions which need more control over the response can return an
+// *imap.Error instead.
+var (
+	// The mailbox or message doesn't exist (NONEXISTENT, or TRYCREATE for the
+	// destination mailbox of COPY, MOVE and APPEND)
+	ErrNotFound = errors.New("imapserver: not found")
+	// The user isn't allowed to perform the operation (NOPERM)
+	ErrPermissionDenied = errors.New("imapserver: permission denied")
+	// The operation would exceed a quota (OVERQUOTA)
+	ErrQuotaExceeded = errors.New("imapserver: quota exceeded")
+	// The target of the operation already exists (ALREADYEXISTS)
+	ErrConflict = errors.New("imapserver: conflict")
+	// A subsystem is temporarily down (UNAVAILABLE)
+	ErrUnavailable = errors.New("imapserver: unavailable")
+)
+
+var backendErrors = []struct {
+	err  error
+	code imap.ResponseCode
+	text string
+}{
+	{ErrNotFound, imap.ResponseCodeNonExistent, "No such mailbox or message"},
+	{ErrPermissionDenied, imap.ResponseCodeNoPerm, "Permission denied"},
+	{ErrQuotaExceeded, imap.ResponseCodeOverQuota, "Quota exceeded"},
+	{ErrConflict, imap.ResponseCodeAlreadyExists, "Already exists"},
+	{ErrUnavailable, imap.ResponseCodeUnavailable, "Temporary failure, try again later"},
+}
+
+// mapBackendError converts the generic errors returned by sessions into
+// IMAP errors. Other errors are returned unchanged.
+func mapBackendError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var imapErr *imap.Error
+	if errors.As(err, &imapErr) {
+		return err
+	}
+	for _, be := range backendErrors {
+		if errors.Is(err, be.err) {
+			return newCodeError(be.code, "", be.text)
+		}
+	}
+	return err
+}
+
+// The following functions return errors with a standard response code, for
+// use by sessions. The server sends them to the client as tagged NO
+// responses, including when they are wrapped with fmt.Errorf and %w.
+//
+// If text is empty, a generic human-readable text is used.
+
+// NewAlreadyExistsError returns an error indicating that the target of a
+// CREATE or RENAME command already exists.
+func NewAlreadyExistsError(text string) error {
+	return newCodeError(imap.ResponseCodeAlreadyExists, text, "Mailbox already exists")
+}
+
+// NewAuthenticationFailedError returns an error indicating that the
+// credentials are invalid.
+func NewAuthenticationFailedError(text string) error {
+	return newCodeError(imap.ResponseCodeAuthenticationFailed, text, "Authentication failed")
+}
+
+// NewAuthorizationFailedError returns an error indicating that the
+// credentials are valid, but the client isn't allowed to act as the
+// requested authorization identity.
+func NewAuthorizationFailedError(text string) error {
+	return newCodeError(imap.ResponseCodeAuthorizationFailed, text, "Authorization failed")
+}
+
+// NewCannotError returns an error indicating that the operation violates
+// an invariant of the server and can never succeed.
+func NewCannotError(text string) error {
+	return newCodeError(imap.ResponseCodeCannot, text, "Operation not permitted")
+}
+
+// NewContactAdminError returns an error indicating that the user should
+// contact the system administrator.
+func NewContactAdminError(text string) error {
+	return newCodeError(imap.ResponseCodeContactAdmin, text, "Contact your administrator")
+}
+
+// NewCorruptionError returns an error indicating that the server discovered
+// corrupted data.
+func NewCorruptionError(text string) error {
+	return newCodeError(imap.ResponseCodeCorruption, text, "Data is corrupted")
+}
+
+// NewExpiredError returns an error indicating that the credentials have
+// expired.
+func NewExpiredError(text string) error {
+	return newCodeError(imap.ResponseCodeExpired, text, "Credentials have expired")
+}
+
+// NewHasChildrenError returns an error indicating that a mailbox can't be
+// deleted because it has child mailboxes.
+func NewHasChildrenError(text string) error {
+	return newCodeError(imap.ResponseCodeHasChildren, text, "Mailbox has children")
+}
+
+// NewInUseError returns an error indicating that the operation can't be
+// performed because a resource is locked by another operation.
+func NewInUseError(text string) error {
+	return newCodeError(imap.ResponseCodeInUse, text, "Resource is in use, try again later")
+}
+
+// NewLimitError returns an error indicating that the operation exceeds a
+// server limit, other than a quota.
+func NewLimitError(text string) error {
+	return newCodeError(imap.ResponseCodeLimit, text, "Limit exceeded")
+}
+
+// NewNonExistentError returns an error indicating that the target of the
+// operation doesn't exist.
+//
+// COPY, MOVE and APPEND commands automatically replace this response code
+// with TRYCREATE.
+func NewNonExistentError(text string) error {
+	return newCodeError(imap.ResponseCodeNonExistent, text, "No such mailbox")
+}
+
+// NewNoPermError returns an error indicating that the user doesn't have the
+// permission to perform the operation.
+func NewNoPermError(text string) error {
+	return newCodeError(imap.ResponseCodeNoPerm, text, "Permission denied")
+}
+
+// NewOverQuotaError returns an error indicating that the user is over quota.
+func NewOverQuotaError(text string) error {
+	return newCodeError(imap.ResponseCodeOverQuota, text, "Quota exceeded")
+}
+
+// NewPrivacyRequiredError returns an error indicating that the operation
+// requires a secure connection.
+func NewPrivacyRequiredError(text string) error {
+	return newCodeError(imap.ResponseCodePrivacyRequired, text, "A secure connection is required")
+}
+
+// NewServerBugError returns an error indicating that the server encountered
+// a bug.
+func NewServerBugError(text string) error {
+	return newCodeError(imap.ResponseCodeServerBug, text, "Internal server error")
+}
+
+// NewTooBigError returns an error indicating that an APPEND command exceeds
+// the maximum message size.
+func NewTooBigError(text string) error {
+	return newCodeError(imap.ResponseCodeTooBig, text, "Message too big")
+}
+
+// NewTryCreateError returns an error indicating that the destination mailbox
+// of a COPY, MOVE or APPEND command doesn't exist, and that the client can
+// create it and retry.
+func NewTryCreateError(text string) error {
+	return newCodeError(imap.ResponseCodeTryCreate, text, "Mailbox doesn't exist")
+}
+
+// NewUnavailableError returns an error indicating that a subsystem is
+// temporarily down.
+func NewUnavailableError(text string) error {
+	return newCodeError(imap.ResponseCodeUnavailable, text, "Temporary failure, try again later")
+}
+
+// NewUnknownCTEError returns an error indicating that the server doesn't
+// know how to decode the content transfer encoding of a message part.
+func NewUnknownCTEError(text string) error {
+	return newCodeError(imap.ResponseCodeUnknownCTE, text, "Unknown content transfer encoding")
+}
+
+func newCodeError(code imap.ResponseCode, text, defaultText string) error {
+	if text == "" {
+		text = defaultText
+	}
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: code,
+		Text: text,
+	}
+}
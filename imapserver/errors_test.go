@@ -0,0 +1,52 @@
+package imapserver
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestNewCodeError(t *testing.T) {
+	err := fmt.Errorf("opening mailbox: %w", NewNonExistentError(""))
+
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) {
+		t.Fatalf("errors.As() = false for %v", err)
+	}
+	if imapErr.Type != imap.StatusResponseTypeNo || imapErr.Code != imap.ResponseCodeNonExistent || imapErr.Text != "No such mailbox" {
+		t.Errorf("unexpected error: %+v", imapErr)
+	}
+
+	if err := NewOverQuotaError("Mailbox is full"); err.(*imap.Error).Text != "Mailbox is full" {
+		t.Errorf("NewOverQuotaError() text = %q", err.(*imap.Error).Text)
+	}
+}
+
+func TestMapBackendError(t *testing.T) {
+	tests := []struct {
+		err  error
+		code imap.ResponseCode
+	}{
+		{fmt.Errorf("mailbox %q: %w", "Archive", ErrNotFound), imap.ResponseCodeNonExistent},
+		{ErrPermissionDenied, imap.ResponseCodeNoPerm},
+		{fmt.Errorf("append: %w", ErrQuotaExceeded), imap.ResponseCodeOverQuota},
+		{ErrConflict, imap.ResponseCodeAlreadyExists},
+		{ErrUnavailable, imap.ResponseCodeUnavailable},
+		{fmt.Errorf("lock: %w", NewInUseError("")), imap.ResponseCodeInUse},
+	}
+	for _, tc := range tests {
+		var imapErr *imap.Error
+		if !errors.As(mapBackendError(tc.err), &imapErr) {
+			t.Errorf("mapBackendError(%v) isn't an IMAP error", tc.err)
+		} else if imapErr.Type != imap.StatusResponseTypeNo || imapErr.Code != tc.code {
+			t.Errorf("mapBackendError(%v) = %v %v, want NO %v", tc.err, imapErr.Type, imapErr.Code, tc.code)
+		}
+	}
+
+	err := errors.New("disk failure")
+	if mapBackendError(err) != err {
+		t.Errorf("mapBackendError() changed unknown error")
+	}
+}
@@ -24,11 +24,21 @@ func (c *Conn) expunge(uids *imap.SeqSet) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
 	w := &ExpungeWriter{conn: c}
 	return c.session.Expunge(w, uids)
 }
 
 func (c *Conn) writeExpunge(seqNum uint32) error {
+	c.mutex.Lock()
+	c.cmdExpunged = true
+	c.mutex.Unlock()
+
 	enc := newResponseEncoder(c)
 	defer enc.end()
 	enc.Atom("*").SP().Number(seqNum).SP().Atom("EXPUNGE")
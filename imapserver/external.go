@@ -0,0 +1,147 @@
+package imapserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// CertificateField is a field of a TLS client certificate which identifies a
+// user.
+type CertificateField int
+
+const (
+	// E-mail address subject alternative names
+	CertificateFieldEmail CertificateField = iota
+	// DNS name subject alternative names
+	CertificateFieldDNS
+	// URI subject alternative names
+	CertificateFieldURI
+	// Common name of the subject
+	CertificateFieldCommonName
+)
+
+// CertificateMapper maps verified TLS client certificates to usernames, for
+// the SASL EXTERNAL mechanism.
+//
+// The server must request client certificates via tls.Config.ClientAuth, for
+// instance with tls.VerifyClientCertIfGiven. Only certificates verified
+// against tls.Config.ClientCAs are considered.
+type CertificateMapper struct {
+	// Certificate fields to consider, in order. If empty, e-mail address
+	// subject alternative names and the subject common name are used.
+	Fields []CertificateField
+	// Resolve maps the value of a certificate field to a username. An empty
+	// username means that the value doesn't identify a user, in which case
+	// the next value is tried. If nil, values are used as usernames as-is.
+	Resolve func(field CertificateField, value string) (username string, err error)
+}
+
+var defaultCertificateFields = []CertificateField{
+	CertificateFieldEmail,
+	CertificateFieldCommonName,
+}
+
+// Username returns the username for the verified client certificate of a TLS
+// connection.
+func (m *CertificateMapper) Username(state *tls.ConnectionState) (string, error) {
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeAuthenticationFailed,
+			Text: "No verified client certificate",
+		}
+	}
+	cert := state.VerifiedChains[0][0]
+
+	fields := m.Fields
+	if len(fields) == 0 {
+		fields = defaultCertificateFields
+	}
+	for _, field := range fields {
+		for _, value := range certificateFieldValues(cert, field) {
+			if m.Resolve == nil {
+				return value, nil
+			}
+			username, err := m.Resolve(field, value)
+			if err != nil {
+				return "", err
+			} else if username != "" {
+				return username, nil
+			}
+		}
+	}
+
+	return "", &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeAuthenticationFailed,
+		Text: "Client certificate doesn't identify a user",
+	}
+}
+
+func certificateFieldValues(cert *x509.Certificate, field CertificateField) []string {
+	switch field {
+	case CertificateFieldEmail:
+		return cert.EmailAddresses
+	case CertificateFieldDNS:
+		return cert.DNSNames
+	case CertificateFieldURI:
+		l := make([]string, len(cert.URIs))
+		for i, u := range cert.URIs {
+			l[i] = u.String()
+		}
+		return l
+	case CertificateFieldCommonName:
+		if cert.Subject.CommonName == "" {
+			return nil
+		}
+		return []string{cert.Subject.CommonName}
+	default:
+		return nil
+	}
+}
+
+// canAuthExternal checks whether the client can authenticate with the SASL
+// EXTERNAL mechanism.
+func (c *Conn) canAuthExternal() bool {
+	if c.state != imap.ConnStateNotAuthenticated || c.server.options.ClientCertificates == nil {
+		return false
+	}
+	if _, ok := c.session.(SessionExternal); !ok {
+		return false
+	}
+	tlsConn, ok := c.conn.(*tls.Conn)
+	if !ok {
+		return false
+	}
+	state := tlsConn.ConnectionState()
+	return len(state.VerifiedChains) > 0
+}
+
+func (c *Conn) newExternalServer() (sasl.Server, error) {
+	if !c.canAuthExternal() {
+		return nil, &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: "SASL mechanism not supported",
+		}
+	}
+	session := c.session.(SessionExternal)
+	return sasl.NewExternalServer(func(identity string) error {
+		state := c.conn.(*tls.Conn).ConnectionState()
+		username, err := c.server.options.ClientCertificates.Username(&state)
+		if err != nil {
+			return err
+		}
+		if identity != "" && identity != username {
+			return ErrAuthzFailed
+		}
+		if err := session.LoginExternal(username); err != nil {
+			return err
+		}
+		c.setAuthUser(username)
+		return nil
+	}), nil
+}
@@ -0,0 +1,53 @@
+package imapserver_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func TestCertificateMapper(t *testing.T) {
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "Alice"},
+		EmailAddresses: []string{"alice@example.org"},
+		DNSNames:       []string{"alice.example.org"},
+	}
+	state := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	tests := []struct {
+		mapper *imapserver.CertificateMapper
+		want   string
+	}{
+		{&imapserver.CertificateMapper{}, "alice@example.org"},
+		{&imapserver.CertificateMapper{Fields: []imapserver.CertificateField{imapserver.CertificateFieldCommonName}}, "Alice"},
+		{&imapserver.CertificateMapper{
+			Fields: []imapserver.CertificateField{imapserver.CertificateFieldEmail, imapserver.CertificateFieldDNS},
+			Resolve: func(field imapserver.CertificateField, value string) (string, error) {
+				if field != imapserver.CertificateFieldDNS {
+					return "", nil
+				}
+				return strings.TrimSuffix(value, ".example.org"), nil
+			},
+		}, "alice"},
+	}
+	for _, tc := range tests {
+		username, err := tc.mapper.Username(state)
+		if err != nil {
+			t.Errorf("Username() = %v", err)
+		} else if username != tc.want {
+			t.Errorf("Username() = %q, want %q", username, tc.want)
+		}
+	}
+
+	mapper := &imapserver.CertificateMapper{Fields: []imapserver.CertificateField{imapserver.CertificateFieldURI}}
+	if _, err := mapper.Username(state); err == nil {
+		t.Errorf("Username() for certificate without URI = nil, want error")
+	}
+	if _, err := mapper.Username(&tls.ConnectionState{}); err == nil {
+		t.Errorf("Username() without verified certificate = nil, want error")
+	}
+}
@@ -0,0 +1,205 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// FaultInjection configures simulated faults, to test the resilience of
+// clients (reconnection logic, timeouts, and so on).
+//
+// Faults are picked with a pseudo-random number generator seeded with Seed.
+// Each connection uses its own generator, so a client issuing the same
+// sequence of commands always hits the same faults.
+//
+// This must not be used in production.
+type FaultInjection struct {
+	// Seed for the pseudo-random number generator
+	Seed int64
+	// Probability that the connection is closed after reading a command,
+	// before handling it, between 0 and 1
+	DisconnectProbability float64
+	// Delay before sending continuation requests
+	ContinuationDelay time.Duration
+	// Probability that a literal sent by the server is cut in half, after
+	// which the connection is closed, between 0 and 1
+	TruncateLiteralProbability float64
+	// Probability that the untagged responses of a command are sent after its
+	// tagged response, between 0 and 1. Commands such as SELECT, COPY or
+	// APPEND are never affected.
+	ReorderProbability float64
+	// Delay before each write to the connection
+	WriteDelay time.Duration
+}
+
+// reorderableCommands lists the commands whose untagged responses can be
+// reordered. Commands involving continuation requests and commands writing
+// their own tagged response are excluded.
+var reorderableCommands = map[string]bool{
+	"NOOP":       true,
+	"CHECK":      true,
+	"CAPABILITY": true,
+	"LIST":       true,
+	"LSUB":       true,
+	"STATUS":     true,
+	"NAMESPACE":  true,
+	"FETCH":      true,
+	"UID FETCH":  true,
+	"STORE":      true,
+	"UID STORE":  true,
+	"SEARCH":     true,
+	"UID SEARCH": true,
+	"MOVE":       true,
+	"UID MOVE":   true,
+	"EXPUNGE":    true,
+}
+
+type faultInjector struct {
+	options *FaultInjection // immutable
+
+	mutex sync.Mutex
+	rand  *rand.Rand
+}
+
+func newFaultInjector(options *FaultInjection) *faultInjector {
+	return &faultInjector{
+		options: options,
+		rand:    rand.New(rand.NewSource(options.Seed)),
+	}
+}
+
+// hit returns true with the provided probability.
+func (f *faultInjector) hit(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.rand.Float64() < p
+}
+
+func (f *faultInjector) delayContinuation() {
+	if f != nil && f.options.ContinuationDelay > 0 {
+		time.Sleep(f.options.ContinuationDelay)
+	}
+}
+
+// wrapWriter wraps the writer of the connection with the write rate limits and
+// the write delay fault, if any.
+func (c *Conn) wrapWriter(w io.Writer) io.Writer {
+	w = c.shapeWriter(w)
+	if c.faults != nil && c.faults.options.WriteDelay > 0 {
+		w = faultWriter{w, c.faults.options.WriteDelay}
+	}
+	return w
+}
+
+// faultWriter delays writes.
+type faultWriter struct {
+	w     io.Writer
+	delay time.Duration
+}
+
+func (w faultWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.w.Write(b)
+}
+
+// injectDisconnect closes the connection if a disconnection fault is hit.
+func (c *Conn) injectDisconnect() error {
+	if c.faults == nil || !c.faults.hit(c.faults.options.DisconnectProbability) {
+		return nil
+	}
+	c.close()
+	return net.ErrClosed
+}
+
+// injectTruncatedLiteral wraps a literal writer if a truncation fault is hit.
+func (c *Conn) injectTruncatedLiteral(w io.WriteCloser, size int64) io.WriteCloser {
+	if c.faults == nil || size == 0 || !c.faults.hit(c.faults.options.TruncateLiteralProbability) {
+		return w
+	}
+	return &truncatedLiteralWriter{w: w, conn: c, remaining: size / 2}
+}
+
+// beginReorder starts buffering responses if a reordering fault is hit for
+// the command. The returned function stops buffering and returns the buffered
+// responses.
+func (c *Conn) beginReorder(name string) (end func() []byte) {
+	if c.faults == nil || !reorderableCommands[name] || !c.faults.hit(c.faults.options.ReorderProbability) {
+		return func() []byte { return nil }
+	}
+
+	var buf bytes.Buffer
+	c.encMutex.Lock()
+	bw := c.bw
+	c.bw = bufio.NewWriter(&buf)
+	c.encMutex.Unlock()
+
+	return func() []byte {
+		c.encMutex.Lock()
+		c.bw.Flush()
+		c.bw = bw
+		c.encMutex.Unlock()
+		return buf.Bytes()
+	}
+}
+
+// writeReordered writes responses buffered by beginReorder.
+func (c *Conn) writeReordered(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	c.encMutex.Lock()
+	defer c.encMutex.Unlock()
+	if _, err := c.bw.Write(b); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// truncatedLiteralWriter writes the first half of a literal, then closes the
+// connection.
+type truncatedLiteralWriter struct {
+	w         io.Writer
+	conn      *Conn
+	remaining int64
+	closed    bool
+}
+
+func (w *truncatedLiteralWriter) Write(b []byte) (int, error) {
+	if w.closed {
+		return 0, net.ErrClosed
+	}
+	if int64(len(b)) > w.remaining {
+		b = b[:w.remaining]
+	}
+	n, err := w.w.Write(b)
+	w.remaining -= int64(n)
+	if err != nil {
+		return n, err
+	}
+	if w.remaining == 0 {
+		w.cut()
+		return n, net.ErrClosed
+	}
+	return n, nil
+}
+
+func (w *truncatedLiteralWriter) Close() error {
+	if !w.closed {
+		w.cut()
+	}
+	return net.ErrClosed
+}
+
+func (w *truncatedLiteralWriter) cut() {
+	w.closed = true
+	w.conn.bw.Flush()
+	w.conn.close()
+}
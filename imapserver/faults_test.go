@@ -0,0 +1,112 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() = %v", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}
+}
+
+func newFaultsTestOptions(faults *imapserver.FaultInjection) *imapserver.Options {
+	mem := imapmemserver.New()
+	return &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:   imap.CapSet{imap.CapIMAP4rev1: {}},
+		Faults: faults,
+	}
+}
+
+func TestFaultsWriteDelay(t *testing.T) {
+	const delay = 50 * time.Millisecond
+	options := newFaultsTestOptions(&imapserver.FaultInjection{WriteDelay: delay})
+	options.TLSConfig = newTestTLSConfig(t)
+	conn, br := newTestConn(t, options)
+
+	start := time.Now()
+	roundTrip(t, conn, br, "A1", "NOOP")
+	if d := time.Since(start); d < delay {
+		t.Errorf("NOOP completed after %v, want at least %v", d, delay)
+	}
+
+	if _, tagged := roundTrip(t, conn, br, "A2", "STARTTLS"); !strings.HasPrefix(tagged, "A2 OK") {
+		t.Fatalf("STARTTLS: %v", tagged)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{InsecureSkipVerify: true})
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("Handshake() = %v", err)
+	}
+
+	// The delay still applies after STARTTLS
+	start = time.Now()
+	if _, tagged := roundTrip(t, tlsConn, bufio.NewReader(tlsConn), "A3", "NOOP"); !strings.HasPrefix(tagged, "A3 OK") {
+		t.Fatalf("NOOP: %v", tagged)
+	}
+	if d := time.Since(start); d < delay {
+		t.Errorf("NOOP after STARTTLS completed after %v, want at least %v", d, delay)
+	}
+}
+
+func TestFaultsDisconnect(t *testing.T) {
+	conn, br := newTestConn(t, newFaultsTestOptions(&imapserver.FaultInjection{DisconnectProbability: 1}))
+
+	if _, err := io.WriteString(conn, "A1 NOOP\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if l, err := br.ReadString('\n'); err != io.EOF {
+		t.Errorf("ReadString() = %q, %v, want EOF", l, err)
+	}
+}
+
+func TestFaultsReorder(t *testing.T) {
+	conn, br := newTestConn(t, newFaultsTestOptions(&imapserver.FaultInjection{ReorderProbability: 1}))
+
+	if _, err := io.WriteString(conn, "A1 CAPABILITY\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	var lines []string
+	for i := 0; i < 2; i++ {
+		l, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() = %v", err)
+		}
+		lines = append(lines, strings.TrimRight(l, "\r\n"))
+	}
+	if !strings.HasPrefix(lines[0], "A1 OK") || !strings.HasPrefix(lines[1], "* CAPABILITY") {
+		t.Errorf("responses = %q, want tagged response first", lines)
+	}
+}
@@ -3,8 +3,6 @@ package imapserver
 import (
 	"fmt"
 	"io"
-	"mime"
-	"sort"
 	"strings"
 	"time"
 
@@ -61,6 +59,9 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
 
 	obsolete := make(map[imap.FetchItem]imap.FetchItemKeyword)
 	for i, item := range items {
@@ -84,6 +85,18 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 		}
 	}
 
+	// Fetching a body section in a read-only mailbox must not set \Seen
+	if c.readOnly {
+		for _, item := range items {
+			switch item := item.(type) {
+			case *imap.FetchItemBodySection:
+				item.Peek = true
+			case *imap.FetchItemBinarySection:
+				item.Peek = true
+			}
+		}
+	}
+
 	if numKind == NumKindUID {
 		itemsWithUID := []imap.FetchItem{imap.FetchItemUID}
 		for _, item := range items {
@@ -95,6 +108,16 @@ func (c *Conn) handleFetch(dec *imapwire.Decoder, numKind NumKind) error {
 	}
 
 	w := &FetchWriter{conn: c, obsolete: obsolete}
+	if session, ok := c.session.(SessionFetchIterator); ok {
+		if err := checkFetchIteratorItems(items); err != nil {
+			return err
+		}
+		it, err := session.FetchIterator(numKind, seqSet, items)
+		if err != nil {
+			return err
+		}
+		return w.WriteIterator(it, items)
+	}
 	if err := c.session.Fetch(w, numKind, seqSet, items); err != nil {
 		return err
 	}
@@ -365,44 +388,13 @@ func (w *FetchResponseWriter) WriteBodySection(section *imap.FetchItemBodySectio
 	if obs, ok := w.obsolete[section]; ok {
 		enc.Atom(string(obs))
 	} else {
-		writeItemBodySection(enc, section)
+		enc.BodySectionName(section)
 	}
 
 	enc.SP()
 	return w.enc.Literal(size)
 }
 
-func writeItemBodySection(enc *imapwire.Encoder, section *imap.FetchItemBodySection) {
-	enc.Atom("BODY")
-	enc.Special('[')
-	writeSectionPart(enc, section.Part)
-	if len(section.Part) > 0 && section.Specifier != imap.PartSpecifierNone {
-		enc.Special('.')
-	}
-	if section.Specifier != imap.PartSpecifierNone {
-		enc.Atom(string(section.Specifier))
-
-		var headerList []string
-		if len(section.HeaderFields) > 0 {
-			headerList = section.HeaderFields
-			enc.Atom(".FIELDS")
-		} else if len(section.HeaderFieldsNot) > 0 {
-			headerList = section.HeaderFieldsNot
-			enc.Atom(".FIELDS.NOT")
-		}
-
-		if len(headerList) > 0 {
-			enc.SP().List(len(headerList), func(i int) {
-				enc.String(headerList[i])
-			})
-		}
-	}
-	enc.Special(']')
-	if partial := section.Partial; partial != nil {
-		enc.Special('<').Number(uint32(partial.Offset)).Special('>')
-	}
-}
-
 // WriteBinarySection writes a binary section.
 //
 // The returned io.WriteCloser must be closed before writing any more message
@@ -412,7 +404,7 @@ func (w *FetchResponseWriter) WriteBinarySection(section *imap.FetchItemBinarySe
 	enc := w.enc.Encoder
 
 	enc.Atom("BINARY").Special('[')
-	writeSectionPart(enc, section.Part)
+	enc.SectionPart(section.Part)
 	enc.Special(']').SP()
 	return w.enc.Literal(size)
 }
@@ -423,7 +415,7 @@ func (w *FetchResponseWriter) WriteBinarySectionSize(section *imap.FetchItemBina
 	enc := w.enc.Encoder
 
 	enc.Atom("BINARY.SIZE").Special('[')
-	writeSectionPart(enc, section.Part)
+	enc.SectionPart(section.Part)
 	enc.Special(']').SP().Number(size)
 }
 
@@ -432,7 +424,7 @@ func (w *FetchResponseWriter) WriteEnvelope(envelope *imap.Envelope) {
 	w.writeItemSep()
 	enc := w.enc.Encoder
 	enc.Atom("ENVELOPE").SP()
-	writeEnvelope(enc, envelope)
+	enc.Envelope(envelope)
 }
 
 // WriteBodyStructure writes the message's body structure (either BODYSTRUCTURE
@@ -454,7 +446,7 @@ func (w *FetchResponseWriter) WriteBodyStructure(bs imap.BodyStructure) {
 	w.writeItemSep()
 	enc := w.enc.Encoder
 	enc.Atom(item).SP()
-	writeBodyStructure(enc, bs)
+	enc.BodyStructure(bs)
 }
 
 // Close closes the FETCH message writer.
@@ -467,199 +459,3 @@ func (w *FetchResponseWriter) Close() error {
 	w.enc = nil
 	return err
 }
-
-func writeEnvelope(enc *imapwire.Encoder, envelope *imap.Envelope) {
-	if envelope == nil {
-		envelope = new(imap.Envelope)
-	}
-
-	sender := envelope.Sender
-	if sender == nil {
-		sender = envelope.From
-	}
-	replyTo := envelope.ReplyTo
-	if replyTo == nil {
-		replyTo = envelope.From
-	}
-
-	enc.Special('(')
-	writeNString(enc, envelope.Date)
-	enc.SP()
-	writeNString(enc, mime.QEncoding.Encode("utf-8", envelope.Subject))
-	addrs := [][]imap.Address{
-		envelope.From,
-		sender,
-		replyTo,
-		envelope.To,
-		envelope.Cc,
-		envelope.Bcc,
-	}
-	for _, l := range addrs {
-		enc.SP()
-		writeAddressList(enc, l)
-	}
-	enc.SP()
-	writeNString(enc, envelope.InReplyTo)
-	enc.SP()
-	writeNString(enc, envelope.MessageID)
-	enc.Special(')')
-}
-
-func writeAddressList(enc *imapwire.Encoder, l []imap.Address) {
-	if l == nil {
-		enc.NIL()
-		return
-	}
-
-	enc.List(len(l), func(i int) {
-		addr := l[i]
-		enc.Special('(')
-		writeNString(enc, mime.QEncoding.Encode("utf-8", addr.Name))
-		enc.SP().NIL().SP()
-		writeNString(enc, addr.Mailbox)
-		enc.SP()
-		writeNString(enc, addr.Host)
-		enc.Special(')')
-	})
-}
-
-func writeNString(enc *imapwire.Encoder, s string) {
-	if s == "" {
-		enc.NIL()
-	} else {
-		enc.String(s)
-	}
-}
-
-func writeSectionPart(enc *imapwire.Encoder, part []int) {
-	if len(part) == 0 {
-		return
-	}
-
-	var l []string
-	for _, num := range part {
-		l = append(l, fmt.Sprintf("%v", num))
-	}
-	enc.Atom(strings.Join(l, "."))
-}
-
-func writeBodyStructure(enc *imapwire.Encoder, bs imap.BodyStructure) {
-	enc.Special('(')
-	switch bs := bs.(type) {
-	case *imap.BodyStructureSinglePart:
-		writeBodyType1part(enc, bs)
-	case *imap.BodyStructureMultiPart:
-		writeBodyTypeMpart(enc, bs)
-	default:
-		panic(fmt.Errorf("unknown body structure type %T", bs))
-	}
-	enc.Special(')')
-}
-
-func writeBodyType1part(enc *imapwire.Encoder, bs *imap.BodyStructureSinglePart) {
-	enc.String(bs.Type).SP().String(bs.Subtype).SP()
-	writeBodyFldParam(enc, bs.Params)
-	enc.SP()
-	writeNString(enc, bs.ID)
-	enc.SP()
-	writeNString(enc, bs.Description)
-	enc.SP()
-	if bs.Encoding == "" {
-		enc.String("7BIT")
-	} else {
-		enc.String(strings.ToUpper(bs.Encoding))
-	}
-	enc.SP().Number(bs.Size)
-
-	if msg := bs.MessageRFC822; msg != nil {
-		enc.SP()
-		writeEnvelope(enc, msg.Envelope)
-		enc.SP()
-		writeBodyStructure(enc, msg.BodyStructure)
-		enc.SP().Number64(msg.NumLines)
-	} else if text := bs.Text; text != nil {
-		enc.SP().Number64(text.NumLines)
-	}
-
-	ext := bs.Extended
-	if ext == nil {
-		return
-	}
-
-	enc.SP()
-	enc.NIL() // MD5
-	enc.SP()
-	writeBodyFldDsp(enc, ext.Disposition)
-	enc.SP()
-	writeBodyFldLang(enc, ext.Language)
-	enc.SP()
-	writeNString(enc, ext.Location)
-}
-
-func writeBodyTypeMpart(enc *imapwire.Encoder, bs *imap.BodyStructureMultiPart) {
-	if len(bs.Children) == 0 {
-		panic("imapserver: imap.BodyStructureMultiPart must have at least one child")
-	}
-	for i, child := range bs.Children {
-		if i > 0 {
-			enc.SP()
-		}
-		writeBodyStructure(enc, child)
-	}
-
-	enc.SP().String(bs.Subtype)
-
-	ext := bs.Extended
-	if ext == nil {
-		return
-	}
-
-	enc.SP()
-	writeBodyFldParam(enc, ext.Params)
-	enc.SP()
-	writeBodyFldDsp(enc, ext.Disposition)
-	enc.SP()
-	writeBodyFldLang(enc, ext.Language)
-	enc.SP()
-	writeNString(enc, ext.Location)
-}
-
-func writeBodyFldParam(enc *imapwire.Encoder, params map[string]string) {
-	if params == nil {
-		enc.NIL()
-		return
-	}
-
-	var l []string
-	for k := range params {
-		l = append(l, k)
-	}
-	sort.Strings(l)
-
-	enc.List(len(l), func(i int) {
-		k := l[i]
-		v := params[k]
-		enc.String(k).SP().String(v)
-	})
-}
-
-func writeBodyFldDsp(enc *imapwire.Encoder, disp *imap.BodyStructureDisposition) {
-	if disp == nil {
-		enc.NIL()
-		return
-	}
-
-	enc.Special('(').String(disp.Value).SP()
-	writeBodyFldParam(enc, disp.Params)
-	enc.Special(')')
-}
-
-func writeBodyFldLang(enc *imapwire.Encoder, l []string) {
-	if l == nil {
-		enc.NIL()
-	} else {
-		enc.List(len(l), func(i int) {
-			enc.String(l[i])
-		})
-	}
-}
@@ -0,0 +1,250 @@
+package imapserver
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// SessionFetchIterator is an IMAP session which returns FETCH results as an
+// iterator.
+//
+// When implemented, FetchIterator is used instead of Session.Fetch. Responses
+// are streamed to the client one message at a time, and message contents are
+// only retrieved if a requested item needs them.
+type SessionFetchIterator interface {
+	Session
+
+	// Selected state
+	FetchIterator(kind NumKind, seqSet imap.SeqSet, items []imap.FetchItem) (FetchIterator, error)
+}
+
+// FetchIterator iterates over the messages matched by a FETCH command.
+type FetchIterator interface {
+	// Next returns the next message. It returns nil when there are no more
+	// messages.
+	Next() (*FetchMessage, error)
+	// Close releases the iterator.
+	Close() error
+}
+
+// FetchMessage is a message returned by a FetchIterator.
+//
+// The metadata fields must always be populated. The functions retrieving the
+// message contents are only called if a requested item needs them, so a
+// FETCH command only requesting flags never opens message bodies. Functions
+// may be nil if the corresponding items are never requested.
+//
+// If a body section without Peek is requested, the backend is responsible for
+// setting the \Seen flag, and for including it in Flags.
+type FetchMessage struct {
+	SeqNum       uint32
+	UID          uint32
+	Flags        []imap.Flag
+	InternalDate time.Time
+	RFC822Size   int64
+
+	Envelope      func() (*imap.Envelope, error)
+	BodyStructure func(extended bool) (imap.BodyStructure, error)
+	// OpenBodySection opens a body section, with Partial already applied.
+	// The size of the returned data must be known in advance.
+	OpenBodySection func(section *imap.FetchItemBodySection) (r io.ReadCloser, size int64, err error)
+	// OpenMessage opens the full message. It's used when OpenBodySection is
+	// nil: body sections are extracted with ExtractBodySection, so backends
+	// which only provide a full-message reader support HEADER.FIELDS and
+	// partial fetches.
+	OpenMessage func() (io.ReadCloser, error)
+	// OpenBinarySection opens a binary section, with Partial already applied.
+	OpenBinarySection func(section *imap.FetchItemBinarySection) (r io.ReadCloser, size int64, err error)
+}
+
+// WriteIterator writes FETCH responses for all messages returned by an
+// iterator, then closes it.
+//
+// This can be used to implement Session.Fetch on top of a FetchIterator. An
+// error is returned before any response is written if an item isn't
+// supported.
+func (w *FetchWriter) WriteIterator(it FetchIterator, items []imap.FetchItem) error {
+	if err := checkFetchIteratorItems(items); err != nil {
+		it.Close()
+		return err
+	}
+
+	for {
+		msg, err := it.Next()
+		if err != nil {
+			it.Close()
+			return err
+		} else if msg == nil {
+			break
+		}
+
+		if err := w.writeMessage(msg, items); err != nil {
+			it.Close()
+			return err
+		}
+	}
+	return it.Close()
+}
+
+// checkFetchIteratorItems returns an error if an item can't be written from
+// a FetchMessage.
+func checkFetchIteratorItems(items []imap.FetchItem) error {
+	for _, item := range items {
+		switch item.(type) {
+		case *imap.FetchItemBodySection, *imap.FetchItemBinarySection, *imap.FetchItemBinarySectionSize:
+			continue
+		}
+		switch item {
+		case imap.FetchItemUID, imap.FetchItemFlags, imap.FetchItemInternalDate, imap.FetchItemRFC822Size,
+			imap.FetchItemEnvelope, imap.FetchItemBodyStructure, imap.FetchItemBody:
+		default:
+			return fmt.Errorf("imapserver: unsupported FETCH item %v", item)
+		}
+	}
+	return nil
+}
+
+// fetchMessageItem is the data retrieved for a FETCH item, before the
+// response is written.
+type fetchMessageItem struct {
+	item          imap.FetchItem
+	envelope      *imap.Envelope
+	bodyStructure imap.BodyStructure
+	section       io.ReadCloser
+	size          int64
+}
+
+func (w *FetchWriter) writeMessage(msg *FetchMessage, items []imap.FetchItem) error {
+	// Retrieve everything which can fail before starting to write the
+	// response: errors can't be reported once the response is partially
+	// written
+	prepared := make([]fetchMessageItem, 0, len(items))
+	closeSections := func() {
+		for _, p := range prepared {
+			if p.section != nil {
+				p.section.Close()
+			}
+		}
+	}
+	for _, item := range items {
+		p, err := prepareFetchMessageItem(msg, item)
+		if err != nil {
+			closeSections()
+			return err
+		}
+		prepared = append(prepared, *p)
+	}
+
+	respWriter := w.CreateMessage(msg.SeqNum)
+	for i, p := range prepared {
+		if err := writeFetchMessageItem(respWriter, msg, &p); err != nil {
+			prepared = prepared[i+1:]
+			closeSections()
+			respWriter.Close()
+			return err
+		}
+	}
+	return respWriter.Close()
+}
+
+func prepareFetchMessageItem(msg *FetchMessage, item imap.FetchItem) (*fetchMessageItem, error) {
+	p := &fetchMessageItem{item: item}
+	var err error
+	switch item := item.(type) {
+	case *imap.FetchItemBodySection:
+		if msg.OpenBodySection == nil && msg.OpenMessage != nil {
+			var b []byte
+			b, err = openMessageSection(msg, item)
+			p.section, p.size = io.NopCloser(bytes.NewReader(b)), int64(len(b))
+		} else if msg.OpenBodySection == nil {
+			return nil, fmt.Errorf("imapserver: body section requested but FetchMessage.OpenBodySection and OpenMessage are nil")
+		} else {
+			p.section, p.size, err = msg.OpenBodySection(item)
+		}
+		return p, err
+	case *imap.FetchItemBinarySection:
+		if msg.OpenBinarySection == nil {
+			return nil, fmt.Errorf("imapserver: binary section requested but FetchMessage.OpenBinarySection is nil")
+		}
+		p.section, p.size, err = msg.OpenBinarySection(item)
+		return p, err
+	case *imap.FetchItemBinarySectionSize:
+		if msg.OpenBinarySection == nil {
+			return nil, fmt.Errorf("imapserver: binary section size requested but FetchMessage.OpenBinarySection is nil")
+		}
+		var r io.ReadCloser
+		r, p.size, err = msg.OpenBinarySection(&imap.FetchItemBinarySection{Part: item.Part, Peek: true})
+		if err != nil {
+			return nil, err
+		}
+		r.Close()
+		return p, nil
+	}
+
+	switch item {
+	case imap.FetchItemEnvelope:
+		if msg.Envelope == nil {
+			return nil, fmt.Errorf("imapserver: ENVELOPE requested but FetchMessage.Envelope is nil")
+		}
+		p.envelope, err = msg.Envelope()
+	case imap.FetchItemBodyStructure, imap.FetchItemBody:
+		if msg.BodyStructure == nil {
+			return nil, fmt.Errorf("imapserver: %v requested but FetchMessage.BodyStructure is nil", item)
+		}
+		p.bodyStructure, err = msg.BodyStructure(item == imap.FetchItemBodyStructure)
+	}
+	return p, err
+}
+
+// writeFetchMessageItem writes a prepared item, and closes its section.
+func writeFetchMessageItem(w *FetchResponseWriter, msg *FetchMessage, p *fetchMessageItem) error {
+	switch item := p.item.(type) {
+	case *imap.FetchItemBodySection:
+		return copySection(w.WriteBodySection(item, p.size), p.section)
+	case *imap.FetchItemBinarySection:
+		return copySection(w.WriteBinarySection(item, p.size), p.section)
+	case *imap.FetchItemBinarySectionSize:
+		w.WriteBinarySectionSize(&imap.FetchItemBinarySection{Part: item.Part}, uint32(p.size))
+		return nil
+	}
+
+	switch p.item {
+	case imap.FetchItemUID:
+		w.WriteUID(msg.UID)
+	case imap.FetchItemFlags:
+		w.WriteFlags(msg.Flags)
+	case imap.FetchItemInternalDate:
+		w.WriteInternalDate(msg.InternalDate)
+	case imap.FetchItemRFC822Size:
+		w.WriteRFC822Size(msg.RFC822Size)
+	case imap.FetchItemEnvelope:
+		w.WriteEnvelope(p.envelope)
+	case imap.FetchItemBodyStructure, imap.FetchItemBody:
+		w.WriteBodyStructure(p.bodyStructure)
+	}
+	return nil
+}
+
+func openMessageSection(msg *FetchMessage, item *imap.FetchItemBodySection) ([]byte, error) {
+	r, err := msg.OpenMessage()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ExtractBodySection(r, item)
+}
+
+// copySection copies a section to a literal writer and closes both.
+func copySection(wc io.WriteCloser, r io.ReadCloser) error {
+	_, copyErr := io.Copy(wc, r)
+	r.Close()
+	closeErr := wc.Close()
+	if copyErr != nil {
+		return copyErr
+	}
+	return closeErr
+}
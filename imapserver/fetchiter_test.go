@@ -0,0 +1,113 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// iteratorSession returns fixed messages from FetchIterator.
+type iteratorSession struct {
+	imapserver.Session
+	messages []imapserver.FetchMessage
+}
+
+func (sess *iteratorSession) FetchIterator(kind imapserver.NumKind, seqSet imap.SeqSet, items []imap.FetchItem) (imapserver.FetchIterator, error) {
+	return &sliceIterator{messages: sess.messages}, nil
+}
+
+type sliceIterator struct {
+	messages []imapserver.FetchMessage
+}
+
+func (it *sliceIterator) Next() (*imapserver.FetchMessage, error) {
+	if len(it.messages) == 0 {
+		return nil, nil
+	}
+	msg := &it.messages[0]
+	it.messages = it.messages[1:]
+	return msg, nil
+}
+
+func (it *sliceIterator) Close() error {
+	return nil
+}
+
+func newIteratorTestConn(t *testing.T, messages []imapserver.FetchMessage) (net.Conn, *bufio.Reader) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return &iteratorSession{Session: mem.NewSession(), messages: messages}, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	if _, tagged := roundTrip(t, conn, br, "A2", "SELECT INBOX"); !strings.HasPrefix(tagged, "A2 OK") {
+		t.Fatalf("SELECT: %v", tagged)
+	}
+	return conn, br
+}
+
+func TestFetchIterator(t *testing.T) {
+	const header = "Subject: Hi\r\nFrom: alice@example.org\r\n\r\n"
+	conn, br := newIteratorTestConn(t, []imapserver.FetchMessage{{
+		SeqNum:       1,
+		UID:          42,
+		Flags:        []imap.Flag{imap.FlagSeen},
+		InternalDate: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		OpenMessage: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(header + "Hello")), nil
+		},
+	}})
+
+	if _, err := io.WriteString(conn, "A3 FETCH 1 (FLAGS BODY.PEEK[HEADER.FIELDS (Subject)])\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	want := "* 1 FETCH (FLAGS (\\Seen) BODY[HEADER.FIELDS (\"Subject\")] {15}\r\nSubject: Hi\r\n\r\n)\r\nA3 OK "
+	b := make([]byte, len(want))
+	if _, err := io.ReadFull(br, b); err != nil {
+		t.Fatalf("ReadFull() = %v", err)
+	} else if string(b) != want {
+		t.Errorf("FETCH response = %q, want %q", b, want)
+	}
+}
+
+func TestFetchIteratorError(t *testing.T) {
+	conn, br := newIteratorTestConn(t, []imapserver.FetchMessage{{
+		SeqNum: 1,
+		UID:    42,
+		OpenBodySection: func(*imap.FetchItemBodySection) (io.ReadCloser, int64, error) {
+			return nil, 0, fmt.Errorf("storage unavailable")
+		},
+	}})
+
+	// Nothing is written for the message if a section can't be opened
+	untagged, tagged := roundTrip(t, conn, br, "A3", "FETCH 1 (UID FLAGS BODY.PEEK[])")
+	if len(untagged) > 0 {
+		t.Errorf("FETCH untagged responses = %v, want none", untagged)
+	}
+	if !strings.HasPrefix(tagged, "A3 NO") {
+		t.Errorf("FETCH: %v, want NO", tagged)
+	}
+
+	// A missing function is reported before the response is started too
+	untagged, tagged = roundTrip(t, conn, br, "A4", "FETCH 1 (UID ENVELOPE)")
+	if len(untagged) > 0 || !strings.HasPrefix(tagged, "A4 NO") {
+		t.Errorf("FETCH ENVELOPE = %v %v, want NO", untagged, tagged)
+	}
+}
@@ -0,0 +1,110 @@
+package imapserver
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// CommandFilter restricts the commands and SASL mechanisms available to
+// clients, e.g. to disable DELETE and RENAME on a read-only archive endpoint,
+// or AUTH=PLAIN on a public port.
+//
+// Command names are case-insensitive. A UID command such as "UID FETCH" can
+// be matched by its full name or by its base name ("FETCH"). CAPABILITY, NOOP
+// and LOGOUT are always allowed.
+//
+// Rejected commands fail with a NO response and the CANNOT response code.
+// Capabilities of disabled commands and mechanisms aren't advertised.
+type CommandFilter struct {
+	// Commands available to clients. If empty, all commands are available,
+	// except the denied ones.
+	Allow []string
+	// Commands which are rejected.
+	Deny []string
+	// SASL mechanisms which are rejected, e.g. sasl.Plain.
+	DenyMechanisms []string
+}
+
+// allowCommand checks whether a command is available. A nil filter allows all
+// commands.
+func (filter *CommandFilter) allowCommand(name string) bool {
+	if filter == nil {
+		return true
+	}
+	name = strings.ToUpper(name)
+	switch name {
+	case "CAPABILITY", "NOOP", "LOGOUT":
+		return true
+	}
+	names := []string{name}
+	if base := strings.TrimPrefix(name, "UID "); base != name {
+		names = append(names, base)
+	}
+	for _, n := range names {
+		if hasFold(filter.Deny, n) {
+			return false
+		}
+	}
+	if len(filter.Allow) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if hasFold(filter.Allow, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowMechanism checks whether a SASL mechanism is available. A nil filter
+// allows all mechanisms.
+func (filter *CommandFilter) allowMechanism(mech string) bool {
+	if filter == nil {
+		return true
+	}
+	return filter.allowCommand("AUTHENTICATE") && !hasFold(filter.DenyMechanisms, mech)
+}
+
+func hasFold(l []string, s string) bool {
+	for _, v := range l {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// capCommands maps capabilities to the command they provide.
+var capCommands = map[imap.Cap]string{
+	imap.CapStartTLS:  "STARTTLS",
+	imap.CapUnselect:  "UNSELECT",
+	imap.CapEnable:    "ENABLE",
+	imap.CapIdle:      "IDLE",
+	imap.CapNamespace: "NAMESPACE",
+	imap.CapMove:      "MOVE",
+	imap.CapLanguage:  "LANGUAGE",
+}
+
+// filterCaps removes the capabilities of disabled commands.
+func (filter *CommandFilter) filterCaps(caps []imap.Cap) []imap.Cap {
+	if filter == nil {
+		return caps
+	}
+	out := caps[:0]
+	for _, c := range caps {
+		if name, ok := capCommands[c]; ok && !filter.allowCommand(name) {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func commandDisabledError(name string) error {
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeCannot,
+		Text: name + " is disabled",
+	}
+}
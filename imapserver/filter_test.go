@@ -0,0 +1,59 @@
+package imapserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-sasl"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestCommandFilter(t *testing.T) {
+	deny := &CommandFilter{
+		Deny:           []string{"delete", "RENAME", "MOVE"},
+		DenyMechanisms: []string{sasl.Plain},
+	}
+	allow := &CommandFilter{
+		Allow: []string{"LOGIN", "SELECT", "UID FETCH"},
+	}
+
+	tests := []struct {
+		filter *CommandFilter
+		name   string
+		want   bool
+	}{
+		{nil, "DELETE", true},
+		{deny, "DELETE", false},
+		{deny, "RENAME", false},
+		{deny, "UID MOVE", false},
+		{deny, "SELECT", true},
+		{deny, "LOGOUT", true},
+		{allow, "SELECT", true},
+		{allow, "UID FETCH", true},
+		{allow, "FETCH", false},
+		{allow, "DELETE", false},
+		{allow, "NOOP", true},
+		{allow, "CAPABILITY", true},
+	}
+	for _, tc := range tests {
+		if got := tc.filter.allowCommand(tc.name); got != tc.want {
+			t.Errorf("allowCommand(%q) = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if deny.allowMechanism(sasl.Plain) {
+		t.Errorf("allowMechanism(PLAIN) = true, want false")
+	}
+	if !deny.allowMechanism(sasl.External) {
+		t.Errorf("allowMechanism(EXTERNAL) = false, want true")
+	}
+	if allow.allowMechanism(sasl.External) {
+		t.Errorf("allowMechanism(EXTERNAL) = true with AUTHENTICATE not allowed, want false")
+	}
+
+	caps := deny.filterCaps([]imap.Cap{imap.CapIMAP4rev1, imap.CapMove, imap.CapIdle})
+	if want := []imap.Cap{imap.CapIMAP4rev1, imap.CapIdle}; !reflect.DeepEqual(caps, want) {
+		t.Errorf("filterCaps() = %v, want %v", caps, want)
+	}
+}
@@ -0,0 +1,182 @@
+package imapserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+var systemFlags = []imap.Flag{
+	imap.FlagSeen,
+	imap.FlagAnswered,
+	imap.FlagFlagged,
+	imap.FlagDeleted,
+	imap.FlagDraft,
+}
+
+// FlagRegistry keeps track of the flags supported by a mailbox.
+//
+// Permanent flags are stored with messages. Session-only flags can be set by
+// clients, but are lost when the session ends. System flags are always
+// permanent.
+//
+// A FlagRegistry can be used by backends to populate the Flags and
+// PermanentFlags fields of imap.SelectData. The server doesn't check the
+// flags sent by clients: backends can use Check in Session.Store, and need to
+// keep session-only flags separate for each session, e.g. with
+// SessionTracker.SetMessageFlags.
+type FlagRegistry struct {
+	mutex     sync.Mutex
+	flags     map[string]imap.Flag // keyed by lower-case flag
+	permanent map[string]bool      // keyed by lower-case flag
+	allowNew  bool
+}
+
+// NewFlagRegistry creates a new flag registry with the system flags.
+//
+// If allowNew is true, clients can create new permanent keywords, and
+// PERMANENTFLAGS includes "\*".
+func NewFlagRegistry(allowNew bool) *FlagRegistry {
+	r := &FlagRegistry{
+		flags:     make(map[string]imap.Flag),
+		permanent: make(map[string]bool),
+		allowNew:  allowNew,
+	}
+	r.DeclarePermanent(systemFlags...)
+	return r
+}
+
+func (r *FlagRegistry) declare(flags []imap.Flag, permanent bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, flag := range flags {
+		k := strings.ToLower(string(flag))
+		if _, ok := r.flags[k]; !ok {
+			r.flags[k] = flag
+		}
+		r.permanent[k] = permanent || r.permanent[k]
+	}
+}
+
+// DeclarePermanent declares permanent keywords.
+func (r *FlagRegistry) DeclarePermanent(flags ...imap.Flag) {
+	r.declare(flags, true)
+}
+
+// DeclareSession declares session-only keywords.
+func (r *FlagRegistry) DeclareSession(flags ...imap.Flag) {
+	r.declare(flags, false)
+}
+
+// Register records keywords set by a client. New keywords are added as
+// permanent keywords, if allowed. It returns true if the list of flags has
+// changed, in which case an updated FLAGS response should be sent to clients.
+//
+// Register should be called after a successful Check.
+func (r *FlagRegistry) Register(flags []imap.Flag) bool {
+	if !r.allowNew {
+		return false
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changed := false
+	for _, flag := range flags {
+		k := strings.ToLower(string(flag))
+		if _, ok := r.flags[k]; ok || flag == imap.FlagRecent {
+			continue
+		}
+		r.flags[k] = flag
+		r.permanent[k] = true
+		changed = true
+	}
+	return changed
+}
+
+// IsPermanent checks whether a flag is permanent.
+func (r *FlagRegistry) IsPermanent(flag imap.Flag) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.permanent[strings.ToLower(string(flag))]
+}
+
+// Flags returns the list of flags to be sent in the FLAGS response.
+func (r *FlagRegistry) Flags() []imap.Flag {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	l := make([]imap.Flag, 0, len(r.flags))
+	for _, flag := range r.flags {
+		l = append(l, flag)
+	}
+	sortFlags(l)
+	return l
+}
+
+// PermanentFlags returns the list of flags to be sent in the PERMANENTFLAGS
+// response code.
+func (r *FlagRegistry) PermanentFlags() []imap.Flag {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	l := make([]imap.Flag, 0, len(r.flags)+1)
+	for k, flag := range r.flags {
+		if r.permanent[k] {
+			l = append(l, flag)
+		}
+	}
+	sortFlags(l)
+	if r.allowNew {
+		l = append(l, imap.FlagWildcard)
+	}
+	return l
+}
+
+// Check returns an error if some of the flags cannot be set by a client.
+func (r *FlagRegistry) Check(flags []imap.Flag) error {
+	return checkFlags(flags, r.Flags(), r.PermanentFlags())
+}
+
+// checkFlags returns a NO error if a flag cannot be set according to the
+// FLAGS and PERMANENTFLAGS advertised for a mailbox.
+func checkFlags(flags, mailboxFlags, permanentFlags []imap.Flag) error {
+	if permanentFlags == nil || hasFlag(permanentFlags, imap.FlagWildcard) {
+		return nil
+	}
+	for _, flag := range flags {
+		if flag == imap.FlagRecent {
+			return &imap.Error{
+				Type: imap.StatusResponseTypeBad,
+				Text: "The \\Recent flag cannot be changed",
+			}
+		}
+		if !hasFlag(mailboxFlags, flag) && !hasFlag(permanentFlags, flag) {
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeCannot,
+				Text: fmt.Sprintf("Keyword %v is not supported in this mailbox", flag),
+			}
+		}
+	}
+	return nil
+}
+
+func hasFlag(flags []imap.Flag, flag imap.Flag) bool {
+	for _, f := range flags {
+		if strings.EqualFold(string(f), string(flag)) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortFlags(l []imap.Flag) {
+	sort.Slice(l, func(i, j int) bool {
+		return l[i] < l[j]
+	})
+}
@@ -0,0 +1,48 @@
+package imapserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestFlagRegistry(t *testing.T) {
+	r := NewFlagRegistry(false)
+	r.DeclarePermanent("$Important")
+	r.DeclareSession("$Draft")
+
+	wantFlags := []imap.Flag{"$Draft", "$Important", imap.FlagAnswered, imap.FlagDeleted, imap.FlagDraft, imap.FlagFlagged, imap.FlagSeen}
+	if flags := r.Flags(); !reflect.DeepEqual(flags, wantFlags) {
+		t.Errorf("Flags() = %v, want %v", flags, wantFlags)
+	}
+	wantPermanent := []imap.Flag{"$Important", imap.FlagAnswered, imap.FlagDeleted, imap.FlagDraft, imap.FlagFlagged, imap.FlagSeen}
+	if flags := r.PermanentFlags(); !reflect.DeepEqual(flags, wantPermanent) {
+		t.Errorf("PermanentFlags() = %v, want %v", flags, wantPermanent)
+	}
+
+	if err := r.Check([]imap.Flag{"\\seen", "$draft", "$Important"}); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+	err := r.Check([]imap.Flag{"$Unknown"})
+	if imapErr, ok := err.(*imap.Error); !ok || imapErr.Type != imap.StatusResponseTypeNo {
+		t.Errorf("Check() = %v, want NO error", err)
+	}
+	if r.Register([]imap.Flag{"$Unknown"}) {
+		t.Errorf("Register() = true, want false")
+	}
+
+	r = NewFlagRegistry(true)
+	if err := r.Check([]imap.Flag{"$Unknown"}); err != nil {
+		t.Errorf("Check() = %v, want nil", err)
+	}
+	if !r.Register([]imap.Flag{"$Unknown"}) {
+		t.Errorf("Register() = false, want true")
+	}
+	if r.Register([]imap.Flag{"$unknown"}) {
+		t.Errorf("Register() = true, want false")
+	}
+	if !r.IsPermanent("$Unknown") {
+		t.Errorf("IsPermanent() = false, want true")
+	}
+}
@@ -1,9 +1,11 @@
 package imapserver
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"runtime/debug"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
@@ -17,6 +19,9 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
 
 	if err := c.writeContReq("idling"); err != nil {
 		return err
@@ -32,15 +37,32 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 			}
 		}()
 		w := &UpdateWriter{conn: c, allowExpunge: true}
-		done <- c.session.Idle(w, stop)
+		err := c.session.Idle(w, stop)
+		// Don't wait for DONE if the session needs to be terminated, e.g.
+		// because the selected mailbox has been deleted
+		var imapErr *imap.Error
+		if errors.As(err, &imapErr) && imapErr.Type == imap.StatusResponseTypeBye {
+			c.writeStatusResp("", (*imap.StatusResponse)(imapErr))
+			c.close()
+		}
+		done <- err
 	}()
 
-	c.setReadTimeout(idleReadTimeout)
+	tickDone := c.idleTick(stop)
+
+	// IDLE is excluded from the autologout timer
+	c.setReadTimeout(0)
 	line, isPrefix, err := c.br.ReadLine()
 	close(stop)
+	<-tickDone
 	if err == io.EOF {
 		return nil
 	} else if err != nil {
+		var imapErr *imap.Error
+		if errors.As(<-done, &imapErr) && imapErr.Type == imap.StatusResponseTypeBye {
+			c.state = imap.ConnStateLogout
+			return nil
+		}
 		return err
 	} else if isPrefix || string(line) != "DONE" {
 		return newClientBugError("Syntax error: expected DONE to end IDLE command")
@@ -48,3 +70,37 @@ func (c *Conn) handleIdle(dec *imapwire.Decoder) error {
 
 	return <-done
 }
+
+// idleTick calls SessionIdleTick.IdleTick periodically until stop is closed.
+// The returned channel is closed once the last call has returned.
+func (c *Conn) idleTick(stop <-chan struct{}) <-chan struct{} {
+	done := make(chan struct{})
+	session, ok := c.session.(SessionIdleTick)
+	if !ok {
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		defer func() {
+			if v := recover(); v != nil {
+				c.server.logger().Printf("panic in idle tick: %v\n%s", v, debug.Stack())
+			}
+		}()
+
+		ticker := time.NewTicker(c.server.options.idleTickInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			if err := session.IdleTick(); err != nil {
+				c.server.logger().Printf("idle tick failed: %v", err)
+			}
+		}
+	}()
+	return done
+}
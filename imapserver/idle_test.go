@@ -0,0 +1,121 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type idleTickSession struct {
+	imapserver.Session
+	ticks int32
+}
+
+func (s *idleTickSession) IdleTick() error {
+	atomic.AddInt32(&s.ticks, 1)
+	return nil
+}
+
+func newIdleTestConn(t *testing.T, options *imapserver.Options, session imapserver.Session) (net.Conn, *bufio.Reader) {
+	options.NewSession = func(*imapserver.Conn) (imapserver.Session, error) {
+		return session, nil
+	}
+	options.Caps = imap.CapSet{imap.CapIMAP4rev1: {}}
+	options.InsecureAuth = true
+	server := imapserver.New(options)
+	t.Cleanup(func() { server.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	br := bufio.NewReader(conn)
+
+	if _, err := br.ReadString('\n'); err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	}
+	for _, cmd := range []string{"A1 LOGIN alice secret\r\n", "A2 SELECT INBOX\r\n", "A3 IDLE\r\n"} {
+		if _, err := io.WriteString(conn, cmd); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() = %v", err)
+			}
+			if !strings.HasPrefix(line, "* ") {
+				break
+			}
+		}
+	}
+	return conn, br
+}
+
+func newIdleTestSession(t *testing.T) imapserver.Session {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+	return mem.NewSession()
+}
+
+func TestIdleTick(t *testing.T) {
+	session := &idleTickSession{Session: newIdleTestSession(t)}
+	conn, br := newIdleTestConn(t, &imapserver.Options{IdleTickInterval: 5 * time.Millisecond}, session)
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := io.WriteString(conn, "DONE\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if line, err := br.ReadString('\n'); err != nil || !strings.HasPrefix(line, "A3 OK") {
+		t.Fatalf("ReadString() = %q, %v", line, err)
+	}
+
+	n := atomic.LoadInt32(&session.ticks)
+	if n == 0 {
+		t.Errorf("IdleTick not called")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if after := atomic.LoadInt32(&session.ticks); after != n {
+		t.Errorf("IdleTick called %v times after IDLE completed", after-n)
+	}
+}
+
+func TestIdleAutologout(t *testing.T) {
+	conn, br := newIdleTestConn(t, &imapserver.Options{AutologoutTimeout: 50 * time.Millisecond}, newIdleTestSession(t))
+
+	// The connection must survive while idling
+	time.Sleep(200 * time.Millisecond)
+	if _, err := io.WriteString(conn, "DONE\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	if line, err := br.ReadString('\n'); err != nil || !strings.HasPrefix(line, "A3 OK") {
+		t.Fatalf("ReadString() = %q, %v", line, err)
+	}
+
+	// The autologout timer applies again once IDLE is done
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	}
+	if !strings.HasPrefix(line, "* BYE") {
+		t.Errorf("got %q, want BYE", line)
+	}
+}
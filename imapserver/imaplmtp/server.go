@@ -0,0 +1,388 @@
+// Package imaplmtp implements an LMTP server delivering messages to an IMAP
+// backend.
+//
+// LMTP is defined in RFC 2033. Messages are handed over to an
+// imapserver.Deliverer, and a reply is sent for each recipient once the
+// message data has been received.
+package imaplmtp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+var errClosed = errors.New("imaplmtp: server closed")
+
+// Options contains server options.
+//
+// The only required field is Deliverer.
+type Options struct {
+	// Deliverer stores incoming messages
+	Deliverer imapserver.Deliverer
+	// Hostname sent in the greeting and in the LHLO reply. If empty, the
+	// local hostname is used.
+	Hostname string
+	// Maximum size of a message in bytes. Zero means no limit.
+	MaxMessageBytes int64
+	// Maximum number of recipients per message. Zero means no limit.
+	MaxRecipients int
+	// Logger is a logger to print error messages. If nil, log.Default is
+	// used.
+	Logger imapserver.Logger
+}
+
+// Server is an LMTP server.
+type Server struct {
+	options Options
+
+	listenerWaitGroup sync.WaitGroup
+
+	mutex     sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+}
+
+// New creates a new server.
+func New(options *Options) *Server {
+	return &Server{
+		options:   *options,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+func (s *Server) logger() imapserver.Logger {
+	if s.options.Logger == nil {
+		return log.Default()
+	}
+	return s.options.Logger
+}
+
+func (s *Server) hostname() string {
+	if s.options.Hostname != "" {
+		return s.options.Hostname
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return hostname
+}
+
+// Serve accepts incoming connections on the listener ln.
+func (s *Server) Serve(ln net.Listener) error {
+	s.mutex.Lock()
+	ok := !s.closed
+	if ok {
+		s.listeners[ln] = struct{}{}
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return errClosed
+	}
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.listeners, ln)
+		s.mutex.Unlock()
+	}()
+
+	s.listenerWaitGroup.Add(1)
+	defer s.listenerWaitGroup.Done()
+
+	var delay time.Duration
+	for {
+		conn, err := ln.Accept()
+		if ne, ok := err.(net.Error); ok && ne.Temporary() {
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else {
+				delay *= 2
+			}
+			if max := 1 * time.Second; delay > max {
+				delay = max
+			}
+			s.logger().Printf("accept error (retrying in %v): %v", delay, err)
+			time.Sleep(delay)
+			continue
+		} else if errors.Is(err, net.ErrClosed) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("accept error: %w", err)
+		}
+
+		delay = 0
+		go s.serveConn(conn)
+	}
+}
+
+// Close immediately closes all active listeners and connections.
+//
+// Once Close has been called on a server, it may not be reused.
+func (s *Server) Close() error {
+	var err error
+
+	s.mutex.Lock()
+	ok := !s.closed
+	if ok {
+		s.closed = true
+		for l := range s.listeners {
+			if closeErr := l.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+	}
+	s.mutex.Unlock()
+	if !ok {
+		return errClosed
+	}
+
+	s.listenerWaitGroup.Wait()
+
+	s.mutex.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mutex.Unlock()
+
+	return err
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.mutex.Lock()
+	ok := !s.closed
+	if ok {
+		s.conns[conn] = struct{}{}
+	}
+	s.mutex.Unlock()
+	if !ok {
+		conn.Close()
+		return
+	}
+
+	defer func() {
+		s.mutex.Lock()
+		delete(s.conns, conn)
+		s.mutex.Unlock()
+		conn.Close()
+	}()
+
+	sess := &session{server: s, text: textproto.NewConn(conn)}
+	if err := sess.serve(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logger().Printf("LMTP connection error: %v", err)
+	}
+}
+
+// session is the state of an LMTP connection.
+type session struct {
+	server *Server
+	text   *textproto.Conn
+
+	greeted    bool
+	from       string
+	hasFrom    bool
+	recipients []string
+}
+
+func (sess *session) reply(code int, format string, args ...interface{}) error {
+	return sess.text.PrintfLine("%03d %v", code, fmt.Sprintf(format, args...))
+}
+
+func (sess *session) reset() {
+	sess.from, sess.hasFrom, sess.recipients = "", false, nil
+}
+
+func (sess *session) serve() error {
+	if err := sess.reply(220, "%v LMTP server ready", sess.server.hostname()); err != nil {
+		return err
+	}
+
+	for {
+		line, err := sess.text.ReadLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		verb, arg := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			verb, arg = line[:i], strings.TrimSpace(line[i+1:])
+		}
+
+		switch strings.ToUpper(verb) {
+		case "LHLO":
+			err = sess.handleLHLO(arg)
+		case "HELO", "EHLO":
+			err = sess.reply(500, "5.5.1 LHLO is required")
+		case "MAIL":
+			err = sess.handleMail(arg)
+		case "RCPT":
+			err = sess.handleRcpt(arg)
+		case "DATA":
+			err = sess.handleData()
+		case "RSET":
+			sess.reset()
+			err = sess.reply(250, "2.0.0 OK")
+		case "NOOP":
+			err = sess.reply(250, "2.0.0 OK")
+		case "VRFY":
+			err = sess.reply(252, "2.5.0 Cannot verify users")
+		case "QUIT":
+			sess.reply(221, "2.0.0 Bye")
+			return nil
+		default:
+			err = sess.reply(500, "5.5.2 Unknown command")
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (sess *session) handleLHLO(arg string) error {
+	if arg == "" {
+		return sess.reply(501, "5.5.4 Missing domain")
+	}
+	sess.reset()
+	sess.greeted = true
+
+	exts := []string{sess.server.hostname(), "PIPELINING", "ENHANCEDSTATUSCODES", "8BITMIME"}
+	if max := sess.server.options.MaxMessageBytes; max > 0 {
+		exts = append(exts, fmt.Sprintf("SIZE %v", max))
+	}
+	for i, ext := range exts {
+		sep := "-"
+		if i == len(exts)-1 {
+			sep = " "
+		}
+		if err := sess.text.PrintfLine("250%v%v", sep, ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sess *session) handleMail(arg string) error {
+	if !sess.greeted {
+		return sess.reply(503, "5.5.1 LHLO is required")
+	} else if sess.hasFrom {
+		return sess.reply(503, "5.5.1 Nested MAIL command")
+	}
+	from, ok := parsePath(arg, "FROM:")
+	if !ok {
+		return sess.reply(501, "5.5.4 Invalid MAIL FROM syntax")
+	}
+	sess.from, sess.hasFrom = from, true
+	return sess.reply(250, "2.1.0 OK")
+}
+
+func (sess *session) handleRcpt(arg string) error {
+	if !sess.hasFrom {
+		return sess.reply(503, "5.5.1 MAIL is required")
+	}
+	rcpt, ok := parsePath(arg, "TO:")
+	if !ok || rcpt == "" {
+		return sess.reply(501, "5.5.4 Invalid RCPT TO syntax")
+	}
+	if max := sess.server.options.MaxRecipients; max > 0 && len(sess.recipients) >= max {
+		return sess.reply(452, "4.5.3 Too many recipients")
+	}
+	sess.recipients = append(sess.recipients, rcpt)
+	return sess.reply(250, "2.1.5 OK")
+}
+
+func (sess *session) handleData() error {
+	if !sess.hasFrom {
+		return sess.reply(503, "5.5.1 MAIL is required")
+	} else if len(sess.recipients) == 0 {
+		return sess.reply(503, "5.5.1 RCPT is required")
+	}
+	if err := sess.reply(354, "Start mail input; end with <CRLF>.<CRLF>"); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("Return-Path: <" + sess.from + ">\r\n")
+
+	// Read the data line by line rather than with DotReader, which converts
+	// CRLF to LF. The rest of the data is consumed if the limit is reached.
+	max := sess.server.options.MaxMessageBytes
+	var size int64
+	tooLarge := false
+	for {
+		line, err := sess.text.ReadLine()
+		if err != nil {
+			return err
+		} else if line == "." {
+			break
+		}
+		line = strings.TrimPrefix(line, ".")
+		size += int64(len(line)) + 2
+		if max > 0 && size > max {
+			tooLarge = true
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\r\n")
+	}
+
+	recipients := sess.recipients
+	sess.reset()
+
+	// LMTP requires one reply per recipient
+	for _, rcpt := range recipients {
+		var err error
+		if tooLarge {
+			err = sess.reply(552, "5.3.4 Message too large")
+		} else {
+			err = sess.deliver(rcpt, buf.Bytes())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sess *session) deliver(rcpt string, b []byte) error {
+	_, err := sess.server.options.Deliverer.DeliverMessage(rcpt, bytes.NewReader(b), nil)
+	switch {
+	case err == nil:
+		return sess.reply(250, "2.0.0 <%v> Delivered", rcpt)
+	case errors.Is(err, imapserver.ErrUnknownRecipient):
+		return sess.reply(550, "5.1.1 <%v> Unknown recipient", rcpt)
+	default:
+		sess.server.logger().Printf("failed to deliver message to %v: %v", rcpt, err)
+		return sess.reply(451, "4.3.0 <%v> Delivery failed", rcpt)
+	}
+}
+
+// parsePath parses the address in the argument of MAIL or RCPT, e.g.
+// "FROM:<addr> SIZE=42". Parameters are ignored.
+func parsePath(arg, prefix string) (addr string, ok bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	arg = strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(arg, "<") {
+		return "", false
+	}
+	i := strings.IndexByte(arg, '>')
+	if i < 0 {
+		return "", false
+	}
+	return arg[1:i], true
+}
@@ -0,0 +1,128 @@
+package imaplmtp_test
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imaplmtp"
+)
+
+// recordingDeliverer records delivered messages. Only alice exists.
+type recordingDeliverer struct {
+	mutex    sync.Mutex
+	messages map[string][]string
+}
+
+func (d *recordingDeliverer) DeliverMessage(recipient string, r io.Reader, options *imapserver.DeliverOptions) (*imap.AppendData, error) {
+	if !strings.HasPrefix(recipient, "alice") {
+		return nil, imapserver.ErrUnknownRecipient
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.messages[recipient] = append(d.messages[recipient], string(b))
+	return &imap.AppendData{}, nil
+}
+
+func newTestConn(t *testing.T, options *imaplmtp.Options) *textproto.Conn {
+	server := imaplmtp.New(options)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := textproto.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("textproto.Dial() = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if _, _, err := conn.ReadResponse(220); err != nil {
+		t.Fatalf("greeting: %v", err)
+	}
+	return conn
+}
+
+func cmd(t *testing.T, conn *textproto.Conn, expectCode int, format string, args ...interface{}) string {
+	if err := conn.PrintfLine(format, args...); err != nil {
+		t.Fatalf("PrintfLine() = %v", err)
+	}
+	_, msg, err := conn.ReadResponse(expectCode)
+	if err != nil {
+		t.Fatalf("%v: %v", fmt.Sprintf(format, args...), err)
+	}
+	return msg
+}
+
+func TestServer(t *testing.T) {
+	d := &recordingDeliverer{messages: make(map[string][]string)}
+	conn := newTestConn(t, &imaplmtp.Options{Deliverer: d, Hostname: "mx.example.org"})
+
+	cmd(t, conn, 503, "MAIL FROM:<bob@example.org>")
+	if msg := cmd(t, conn, 250, "LHLO client.example.org"); !strings.Contains(msg, "PIPELINING") {
+		t.Errorf("LHLO reply = %q, want PIPELINING", msg)
+	}
+	cmd(t, conn, 250, "MAIL FROM:<bob@example.org>")
+	cmd(t, conn, 250, "RCPT TO:<alice@example.org>")
+	cmd(t, conn, 250, "RCPT TO:<carol@example.org>")
+	cmd(t, conn, 250, "RCPT TO:<alice+lists@example.org>")
+	cmd(t, conn, 354, "DATA")
+
+	w := conn.DotWriter()
+	io.WriteString(w, "Subject: Hi\r\n\r\n.Hello\r\n")
+	if err := w.Close(); err != nil {
+		t.Fatalf("DotWriter.Close() = %v", err)
+	}
+	// One reply per recipient, in order
+	for _, code := range []int{250, 550, 250} {
+		if _, _, err := conn.ReadResponse(code); err != nil {
+			t.Errorf("DATA reply: %v", err)
+		}
+	}
+
+	want := "Return-Path: <bob@example.org>\r\nSubject: Hi\r\n\r\n.Hello\r\n"
+	d.mutex.Lock()
+	got := d.messages
+	d.mutex.Unlock()
+	if wantMessages := map[string][]string{"alice@example.org": {want}, "alice+lists@example.org": {want}}; !reflect.DeepEqual(got, wantMessages) {
+		t.Errorf("delivered %q, want %q", got, wantMessages)
+	}
+
+	// The transaction is reset after DATA
+	cmd(t, conn, 503, "RCPT TO:<alice@example.org>")
+	cmd(t, conn, 221, "QUIT")
+}
+
+func TestServerMaxMessageBytes(t *testing.T) {
+	d := &recordingDeliverer{messages: make(map[string][]string)}
+	conn := newTestConn(t, &imaplmtp.Options{Deliverer: d, MaxMessageBytes: 16})
+
+	cmd(t, conn, 250, "LHLO client.example.org")
+	cmd(t, conn, 250, "MAIL FROM:<>")
+	cmd(t, conn, 250, "RCPT TO:<alice@example.org>")
+	cmd(t, conn, 354, "DATA")
+	w := conn.DotWriter()
+	io.WriteString(w, "Subject: This is too long\r\n\r\nHello\r\n")
+	w.Close()
+	if _, _, err := conn.ReadResponse(552); err != nil {
+		t.Errorf("DATA reply: %v", err)
+	}
+
+	// The connection is still usable
+	cmd(t, conn, 250, "NOOP")
+	if len(d.messages) > 0 {
+		t.Errorf("delivered %q, want nothing", d.messages)
+	}
+}
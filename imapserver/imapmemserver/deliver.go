@@ -0,0 +1,132 @@
+package imapmemserver
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-message/textproto"
+)
+
+var _ imapserver.Deliverer = (*Server)(nil)
+
+// Delivery describes a message being delivered by a mail delivery agent.
+//
+// A DeliveryFilter can change the destination mailbox and the flags.
+type Delivery struct {
+	// Recipient address, as provided to DeliverMessage
+	Recipient string
+	// Header of the message
+	Header textproto.Header
+	// Destination mailbox
+	Mailbox string
+	// Flags to set on the delivered message
+	Flags []imap.Flag
+	// If set, the message is silently dropped
+	Discard bool
+}
+
+// DeliveryFilter is called for each delivered message, before it's stored. It
+// can be used to implement Sieve-like rules. Returning an error rejects the
+// message.
+type DeliveryFilter func(d *Delivery) error
+
+// SetDeliveryFilter sets the filter called by DeliverMessage. If nil, messages
+// are delivered unchanged.
+func (s *Server) SetDeliveryFilter(filter DeliveryFilter) {
+	s.mutex.Lock()
+	s.deliveryFilter = filter
+	s.mutex.Unlock()
+}
+
+// DeliverMessage implements imapserver.Deliverer.
+//
+// The recipient can be a username or an e-mail address whose local part,
+// without the sub-address, is a username. If options.Mailbox is empty, the
+// mailbox named by the sub-address ("user+mailbox@example.org") is used if
+// it exists. If the destination mailbox doesn't exist, the message is
+// delivered to INBOX. Nil AppendData is returned if the message has been
+// discarded by the filter.
+func (s *Server) DeliverMessage(recipient string, r io.Reader, options *imapserver.DeliverOptions) (*imap.AppendData, error) {
+	if options == nil {
+		options = new(imapserver.DeliverOptions)
+	}
+
+	user, detail := s.recipientUser(recipient)
+	if user == nil {
+		return nil, imapserver.ErrUnknownRecipient
+	}
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	header, err := textproto.ReadHeader(bufio.NewReader(bytes.NewReader(buf.Bytes())))
+	if err != nil {
+		return nil, fmt.Errorf("imapmemserver: failed to parse message header: %v", err)
+	}
+
+	d := &Delivery{
+		Recipient: recipient,
+		Header:    header,
+		Mailbox:   options.Mailbox,
+		Flags:     append([]imap.Flag(nil), options.Flags...),
+	}
+	if d.Mailbox == "" {
+		d.Mailbox = "INBOX"
+		if detail != "" {
+			if _, err := user.mailbox(detail); err == nil {
+				d.Mailbox = detail
+			}
+		}
+	}
+
+	s.mutex.Lock()
+	filter := s.deliveryFilter
+	s.mutex.Unlock()
+	if filter != nil {
+		if err := filter(d); err != nil {
+			return nil, err
+		}
+	}
+	if d.Discard {
+		return nil, nil
+	}
+
+	mbox, err := user.mailbox(d.Mailbox)
+	if err != nil {
+		mbox, err = user.mailbox("INBOX")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mbox.appendBytes(buf.Bytes(), &imap.AppendOptions{
+		Flags: d.Flags,
+		Time:  options.Time,
+	}), nil
+}
+
+// recipientUser returns the user matching a recipient address, and the
+// sub-address if any.
+func (s *Server) recipientUser(recipient string) (user *User, detail string) {
+	if user := s.user(recipient); user != nil {
+		return user, ""
+	}
+
+	localPart := recipient
+	if i := strings.LastIndexByte(localPart, '@'); i >= 0 {
+		localPart = localPart[:i]
+	}
+	if i := strings.IndexByte(localPart, '+'); i >= 0 {
+		localPart, detail = localPart[:i], localPart[i+1:]
+	}
+	if user := s.user(localPart); user != nil {
+		return user, detail
+	}
+	return nil, ""
+}
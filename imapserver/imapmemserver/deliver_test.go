@@ -0,0 +1,45 @@
+package imapmemserver_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func ExampleServer_DeliverMessage() {
+	s := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "hunter2")
+	user.Create("INBOX")
+	user.Create("Lists")
+	s.AddUser(user)
+
+	// File mailing list traffic and flag messages from the boss
+	s.SetDeliveryFilter(func(d *imapmemserver.Delivery) error {
+		if d.Header.Get("List-Id") != "" {
+			d.Mailbox = "Lists"
+		}
+		if strings.Contains(d.Header.Get("From"), "boss@example.org") {
+			d.Flags = append(d.Flags, imap.FlagFlagged)
+		}
+		return nil
+	})
+
+	msg := []byte("From: boss@example.org\r\n" +
+		"Subject: Hello\r\n" +
+		"\r\n" +
+		"Hi!\r\n")
+	for _, rcpt := range []string{"alice@example.org", "bob@example.org"} {
+		_, err := s.DeliverMessage(rcpt, bytes.NewReader(msg), nil)
+		fmt.Println(err)
+	}
+
+	data, _ := user.Status("INBOX", []imap.StatusItem{imap.StatusItemNumMessages})
+	fmt.Println(*data.NumMessages)
+	// Output:
+	// <nil>
+	// imapserver: unknown recipient
+	// 1
+}
@@ -3,7 +3,6 @@ package imapmemserver
 import (
 	"bytes"
 	"fmt"
-	"sort"
 	"sync"
 	"time"
 
@@ -17,6 +16,7 @@ import (
 // users.
 type Mailbox struct {
 	tracker     *imapserver.MailboxTracker
+	flags       *imapserver.FlagRegistry
 	uidValidity uint32
 
 	mutex      sync.Mutex
@@ -30,12 +30,30 @@ type Mailbox struct {
 func NewMailbox(name string, uidValidity uint32) *Mailbox {
 	return &Mailbox{
 		tracker:     imapserver.NewMailboxTracker(0),
+		flags:       imapserver.NewFlagRegistry(true),
 		uidValidity: uidValidity,
 		name:        name,
 		uidNext:     1,
 	}
 }
 
+// FlagRegistry returns the registry of flags supported by this mailbox.
+//
+// By default, clients can create new keywords. Replacing the registry allows
+// restricting the set of supported keywords.
+func (mbox *Mailbox) FlagRegistry() *imapserver.FlagRegistry {
+	mbox.mutex.Lock()
+	defer mbox.mutex.Unlock()
+	return mbox.flags
+}
+
+// SetFlagRegistry replaces the registry of flags supported by this mailbox.
+func (mbox *Mailbox) SetFlagRegistry(flags *imapserver.FlagRegistry) {
+	mbox.mutex.Lock()
+	mbox.flags = flags
+	mbox.mutex.Unlock()
+}
+
 func (mbox *Mailbox) list(options *imap.ListOptions) *imap.ListData {
 	mbox.mutex.Lock()
 	defer mbox.mutex.Unlock()
@@ -143,6 +161,10 @@ func (mbox *Mailbox) appendBytes(buf []byte, options *imap.AppendOptions) *imap.
 	mbox.mutex.Lock()
 	defer mbox.mutex.Unlock()
 
+	if mbox.flags.Register(options.Flags) {
+		mbox.tracker.QueueMailboxFlags(mbox.flags.Flags())
+	}
+
 	msg.uid = mbox.uidNext
 	mbox.uidNext++
 
@@ -169,41 +191,15 @@ func (mbox *Mailbox) SetSubscribed(subscribed bool) {
 }
 
 func (mbox *Mailbox) selectDataLocked() *imap.SelectData {
-	flags := mbox.flagsLocked()
-
-	permanentFlags := make([]imap.Flag, len(flags))
-	copy(permanentFlags, flags)
-	permanentFlags = append(permanentFlags, imap.FlagWildcard)
-
 	return &imap.SelectData{
-		Flags:          flags,
-		PermanentFlags: permanentFlags,
+		Flags:          mbox.flags.Flags(),
+		PermanentFlags: mbox.flags.PermanentFlags(),
 		NumMessages:    uint32(len(mbox.l)),
 		UIDNext:        mbox.uidNext,
 		UIDValidity:    mbox.uidValidity,
 	}
 }
 
-func (mbox *Mailbox) flagsLocked() []imap.Flag {
-	m := make(map[imap.Flag]struct{})
-	for _, msg := range mbox.l {
-		for flag := range msg.flags {
-			m[flag] = struct{}{}
-		}
-	}
-
-	var l []imap.Flag
-	for flag := range m {
-		l = append(l, flag)
-	}
-
-	sort.Slice(l, func(i, j int) bool {
-		return l[i] < l[j]
-	})
-
-	return l
-}
-
 func (mbox *Mailbox) Expunge(w *imapserver.ExpungeWriter, uids *imap.SeqSet) error {
 	expunged := make(map[*message]struct{})
 	mbox.mutex.Lock()
@@ -259,10 +255,17 @@ func (mbox *Mailbox) expungeLocked(expunged map[*message]struct{}) (seqNums []ui
 //
 // Callers must call MailboxView.Close once they are done with the mailbox view.
 func (mbox *Mailbox) NewView() *MailboxView {
-	return &MailboxView{
-		Mailbox: mbox,
-		tracker: mbox.tracker.NewSession(),
+	view := &MailboxView{
+		Mailbox:      mbox,
+		tracker:      mbox.tracker.NewSession(),
+		sessionFlags: make(map[uint32]sessionFlags),
 	}
+	view.tracker.SetMessageFlags(func(uid uint32, flags []imap.Flag) []imap.Flag {
+		mbox.mutex.Lock()
+		defer mbox.mutex.Unlock()
+		return appendSessionFlags(flags, view.sessionFlags[uid])
+	})
+	return view
 }
 
 // A MailboxView is a view into a mailbox.
@@ -275,7 +278,12 @@ func (mbox *Mailbox) NewView() *MailboxView {
 // selected state.
 type MailboxView struct {
 	*Mailbox
-	tracker *imapserver.SessionTracker
+	tracker    *imapserver.SessionTracker
+	comparator imapserver.Comparator
+
+	// Session-only flags set by this view, by UID. Protected by
+	// Mailbox.mutex.
+	sessionFlags map[uint32]sessionFlags
 }
 
 // Close releases the resources allocated for the mailbox view.
@@ -304,7 +312,7 @@ func (mbox *MailboxView) Fetch(w *imapserver.FetchWriter, numKind imapserver.Num
 		}
 
 		respWriter := w.CreateMessage(mbox.tracker.EncodeSeqNum(seqNum))
-		err = msg.fetch(respWriter, items)
+		err = msg.fetch(respWriter, items, mbox.sessionFlags[msg.uid])
 	})
 	return err
 }
@@ -316,6 +324,11 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 	mbox.staticSeqSet(criteria.SeqNum, imapserver.NumKindSeq)
 	mbox.staticSeqSet(criteria.UID, imapserver.NumKindUID)
 
+	cmp := mbox.comparator
+	if cmp == nil {
+		cmp = imapserver.DefaultComparator
+	}
+
 	data := imap.SearchData{
 		UID: numKind == imapserver.NumKindUID,
 	}
@@ -323,7 +336,7 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 	for i, msg := range mbox.l {
 		seqNum := mbox.tracker.EncodeSeqNum(uint32(i) + 1)
 
-		if !msg.search(seqNum, criteria) {
+		if !msg.search(seqNum, criteria, cmp, mbox.sessionFlags[msg.uid]) {
 			continue
 		}
 
@@ -351,8 +364,35 @@ func (mbox *MailboxView) Search(numKind imapserver.NumKind, criteria *imap.Searc
 }
 
 func (mbox *MailboxView) Store(w *imapserver.FetchWriter, numKind imapserver.NumKind, seqSet imap.SeqSet, flags *imap.StoreFlags) error {
+	registry := mbox.Mailbox.FlagRegistry()
+	if flags.Op != imap.StoreFlagsDel {
+		if err := registry.Check(flags.Flags); err != nil {
+			return err
+		}
+		if registry.Register(flags.Flags) {
+			mbox.Mailbox.tracker.QueueMailboxFlags(registry.Flags())
+		}
+	}
+
+	// Session-only flags are only visible to this view
+	permanent := &imap.StoreFlags{Op: flags.Op, Silent: flags.Silent}
+	session := &imap.StoreFlags{Op: flags.Op, Silent: flags.Silent}
+	for _, flag := range flags.Flags {
+		if flags.Op == imap.StoreFlagsDel || registry.IsPermanent(flag) {
+			permanent.Flags = append(permanent.Flags, flag)
+		}
+		if flags.Op == imap.StoreFlagsDel || !registry.IsPermanent(flag) {
+			session.Flags = append(session.Flags, flag)
+		}
+	}
+
 	mbox.forEach(numKind, seqSet, func(seqNum uint32, msg *message) {
-		msg.store(flags)
+		msg.store(permanent)
+		if l := storeFlags(mbox.sessionFlags[msg.uid], session); len(l) > 0 {
+			mbox.sessionFlags[msg.uid] = l
+		} else {
+			delete(mbox.sessionFlags, msg.uid)
+		}
 		mbox.Mailbox.tracker.QueueMessageFlags(seqNum, msg.uid, msg.flagList(), mbox.tracker)
 	})
 	if !flags.Silent {
@@ -26,11 +26,14 @@ type message struct {
 	flags map[imap.Flag]struct{}
 }
 
-func (msg *message) fetch(w *imapserver.FetchResponseWriter, items []imap.FetchItem) error {
+// sessionFlags contains session-only flags set on a message by a session.
+type sessionFlags map[imap.Flag]struct{}
+
+func (msg *message) fetch(w *imapserver.FetchResponseWriter, items []imap.FetchItem, session sessionFlags) error {
 	w.WriteUID(msg.uid)
 
 	for _, item := range items {
-		if err := msg.fetchItem(w, item); err != nil {
+		if err := msg.fetchItem(w, item, session); err != nil {
 			return err
 		}
 	}
@@ -38,7 +41,7 @@ func (msg *message) fetch(w *imapserver.FetchResponseWriter, items []imap.FetchI
 	return w.Close()
 }
 
-func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.FetchItem) error {
+func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.FetchItem, session sessionFlags) error {
 	switch item := item.(type) {
 	case *imap.FetchItemBodySection:
 		buf := msg.bodySection(item)
@@ -59,7 +62,7 @@ func (msg *message) fetchItem(w *imapserver.FetchResponseWriter, item imap.Fetch
 	case imap.FetchItemUID:
 		// always included
 	case imap.FetchItemFlags:
-		w.WriteFlags(msg.flagList())
+		w.WriteFlags(appendSessionFlags(msg.flagList(), session))
 	case imap.FetchItemInternalDate:
 		w.WriteInternalDate(msg.t)
 	case imap.FetchItemRFC822Size:
@@ -89,136 +92,8 @@ func (msg *message) bodyStructure(extended bool) imap.BodyStructure {
 	return getBodyStructure(header, br, extended)
 }
 
-func openMessagePart(header textproto.Header, body io.Reader, parentMediaType string) (textproto.Header, io.Reader) {
-	msgHeader := gomessage.Header{header}
-	mediaType, _, _ := msgHeader.ContentType()
-	if !msgHeader.Has("Content-Type") && parentMediaType == "multipart/digest" {
-		mediaType = "message/rfc822"
-	}
-	if mediaType == "message/rfc822" || mediaType == "message/global" {
-		br := bufio.NewReader(body)
-		header, _ = textproto.ReadHeader(br)
-		return header, br
-	}
-	return header, body
-}
-
 func (msg *message) bodySection(item *imap.FetchItemBodySection) []byte {
-	var (
-		header textproto.Header
-		body   io.Reader
-	)
-
-	br := bufio.NewReader(bytes.NewReader(msg.buf))
-	header, err := textproto.ReadHeader(br)
-	if err != nil {
-		return nil
-	}
-	body = br
-
-	// First part of non-multipart message refers to the message itself
-	msgHeader := gomessage.Header{header}
-	mediaType, _, _ := msgHeader.ContentType()
-	partPath := item.Part
-	if !strings.HasPrefix(mediaType, "multipart/") && len(partPath) > 0 && partPath[0] == 1 {
-		partPath = partPath[1:]
-	}
-
-	// Find the requested part using the provided path
-	var parentMediaType string
-	for i := 0; i < len(partPath); i++ {
-		partNum := partPath[i]
-
-		header, body = openMessagePart(header, body, parentMediaType)
-
-		msgHeader := gomessage.Header{header}
-		mediaType, typeParams, _ := msgHeader.ContentType()
-		if !strings.HasPrefix(mediaType, "multipart/") {
-			if partNum != 1 {
-				return nil
-			}
-			continue
-		}
-
-		mr := textproto.NewMultipartReader(body, typeParams["boundary"])
-		found := false
-		for j := 1; j <= partNum; j++ {
-			p, err := mr.NextPart()
-			if err != nil {
-				return nil
-			}
-
-			if j == partNum {
-				parentMediaType = mediaType
-				header = p.Header
-				body = p
-				found = true
-				break
-			}
-		}
-		if !found {
-			return nil
-		}
-	}
-
-	if len(item.Part) > 0 {
-		switch item.Specifier {
-		case imap.PartSpecifierHeader, imap.PartSpecifierText:
-			header, body = openMessagePart(header, body, parentMediaType)
-		}
-	}
-
-	// Filter header fields
-	if len(item.HeaderFields) > 0 {
-		keep := make(map[string]struct{})
-		for _, k := range item.HeaderFields {
-			keep[strings.ToLower(k)] = struct{}{}
-		}
-		for field := header.Fields(); field.Next(); {
-			if _, ok := keep[strings.ToLower(field.Key())]; !ok {
-				field.Del()
-			}
-		}
-	}
-	for _, k := range item.HeaderFieldsNot {
-		header.Del(k)
-	}
-
-	// Write the requested data to a buffer
-	var buf bytes.Buffer
-
-	writeHeader := true
-	switch item.Specifier {
-	case imap.PartSpecifierNone:
-		writeHeader = len(item.Part) == 0
-	case imap.PartSpecifierText:
-		writeHeader = false
-	}
-	if writeHeader {
-		if err := textproto.WriteHeader(&buf, header); err != nil {
-			return nil
-		}
-	}
-
-	switch item.Specifier {
-	case imap.PartSpecifierNone, imap.PartSpecifierText:
-		if _, err := io.Copy(&buf, body); err != nil {
-			return nil
-		}
-	}
-
-	// Extract partial if any
-	b := buf.Bytes()
-	if partial := item.Partial; partial != nil {
-		end := partial.Offset + partial.Size
-		if partial.Offset > int64(len(b)) {
-			return nil
-		}
-		if end > int64(len(b)) {
-			end = int64(len(b))
-		}
-		b = b[partial.Offset:end]
-	}
+	b, _ := imapserver.ExtractBodySection(bytes.NewReader(msg.buf), item)
 	return b
 }
 
@@ -230,25 +105,49 @@ func (msg *message) flagList() []imap.Flag {
 	return flags
 }
 
+func (msg *message) hasFlag(flag imap.Flag, session sessionFlags) bool {
+	flag = canonicalFlag(flag)
+	_, ok := msg.flags[flag]
+	if !ok {
+		_, ok = session[flag]
+	}
+	return ok
+}
+
 func (msg *message) store(store *imap.StoreFlags) {
+	msg.flags = storeFlags(msg.flags, store)
+}
+
+func storeFlags(flags map[imap.Flag]struct{}, store *imap.StoreFlags) map[imap.Flag]struct{} {
 	switch store.Op {
 	case imap.StoreFlagsSet:
-		msg.flags = make(map[imap.Flag]struct{})
+		flags = make(map[imap.Flag]struct{})
 		fallthrough
 	case imap.StoreFlagsAdd:
+		if flags == nil {
+			flags = make(map[imap.Flag]struct{})
+		}
 		for _, flag := range store.Flags {
-			msg.flags[canonicalFlag(flag)] = struct{}{}
+			flags[canonicalFlag(flag)] = struct{}{}
 		}
 	case imap.StoreFlagsDel:
 		for _, flag := range store.Flags {
-			delete(msg.flags, canonicalFlag(flag))
+			delete(flags, canonicalFlag(flag))
 		}
 	default:
 		panic(fmt.Errorf("unknown STORE flag operation: %v", store.Op))
 	}
+	return flags
+}
+
+func appendSessionFlags(flags []imap.Flag, session sessionFlags) []imap.Flag {
+	for flag := range session {
+		flags = append(flags, flag)
+	}
+	return flags
 }
 
-func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
+func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria, cmp imapserver.Comparator, session sessionFlags) bool {
 	if criteria.SeqNum != nil && (seqNum == 0 || !criteria.SeqNum.Contains(seqNum)) {
 		return false
 	}
@@ -260,12 +159,12 @@ func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
 	}
 
 	for _, flag := range criteria.Flag {
-		if _, ok := msg.flags[canonicalFlag(flag)]; !ok {
+		if !msg.hasFlag(flag, session) {
 			return false
 		}
 	}
 	for _, flag := range criteria.NotFlag {
-		if _, ok := msg.flags[canonicalFlag(flag)]; ok {
+		if msg.hasFlag(flag, session) {
 			return false
 		}
 	}
@@ -277,7 +176,7 @@ func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
 		return false
 	}
 
-	if !matchBytes(msg.buf, criteria.Text) {
+	if !matchBytes(msg.buf, criteria.Text, cmp) {
 		return false
 	}
 
@@ -294,7 +193,7 @@ func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
 		}
 		found := false
 		for _, v := range header.Values(fieldCriteria.Key) {
-			found = strings.Contains(strings.ToLower(v), strings.ToLower(fieldCriteria.Value))
+			found = cmp.Contains(v, fieldCriteria.Value)
 			if found {
 				break
 			}
@@ -315,18 +214,18 @@ func (msg *message) search(seqNum uint32, criteria *imap.SearchCriteria) bool {
 
 	if len(criteria.Body) > 0 {
 		body, _ := io.ReadAll(br)
-		if !matchBytes(body, criteria.Body) {
+		if !matchBytes(body, criteria.Body, cmp) {
 			return false
 		}
 	}
 
 	for _, not := range criteria.Not {
-		if msg.search(seqNum, &not) {
+		if msg.search(seqNum, &not, cmp, session) {
 			return false
 		}
 	}
 	for _, or := range criteria.Or {
-		if !msg.search(seqNum, &or[0]) && !msg.search(seqNum, &or[1]) {
+		if !msg.search(seqNum, &or[0], cmp, session) && !msg.search(seqNum, &or[1], cmp, session) {
 			return false
 		}
 	}
@@ -348,13 +247,13 @@ func matchDate(t, since, before time.Time) bool {
 	return true
 }
 
-func matchBytes(buf []byte, patterns []string) bool {
+func matchBytes(buf []byte, patterns []string, cmp imapserver.Comparator) bool {
 	if len(patterns) == 0 {
 		return true
 	}
-	buf = bytes.ToLower(buf)
-	for _, s := range patterns {
-		if !bytes.Contains(buf, bytes.ToLower([]byte(s))) {
+	s := string(buf)
+	for _, pattern := range patterns {
+		if !cmp.Contains(s, pattern) {
 			return false
 		}
 	}
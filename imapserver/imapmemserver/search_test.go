@@ -0,0 +1,52 @@
+package imapmemserver_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// exactComparator matches strings byte per byte
+type exactComparator struct{}
+
+func (exactComparator) Contains(s, substr string) bool {
+	return strings.Contains(s, substr)
+}
+
+func TestSearchComparator(t *testing.T) {
+	user := imapmemserver.NewUser("alice", "hunter2")
+	user.Create("INBOX")
+	msg := "Subject: Café\r\n\r\nHello\r\n"
+	if _, err := user.Append("INBOX", strings.NewReader(msg), &imap.AppendOptions{}); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+
+	criteria := &imap.SearchCriteria{
+		Header: []imap.SearchCriteriaHeaderField{{Key: "Subject", Value: "cafe"}},
+	}
+	tests := []struct {
+		cmp  imapserver.Comparator
+		want int
+	}{
+		{nil, 1},
+		{exactComparator{}, 0},
+	}
+	for _, tc := range tests {
+		sess := imapmemserver.NewUserSession(user)
+		sess.SetComparator(tc.cmp)
+		if _, err := sess.Select("INBOX", nil); err != nil {
+			t.Fatalf("Select() = %v", err)
+		}
+		data, err := sess.Search(imapserver.NumKindUID, criteria, &imap.SearchOptions{})
+		if err != nil {
+			t.Fatalf("Search() = %v", err)
+		}
+		if n := len(data.AllNums()); n != tc.want {
+			t.Errorf("Search() with comparator %T = %v results, want %v", tc.cmp, n, tc.want)
+		}
+		sess.Close()
+	}
+}
@@ -11,8 +11,11 @@ import (
 //
 // A server contains a list of users.
 type Server struct {
-	mutex sync.Mutex
-	users map[string]*User
+	mutex     sync.Mutex
+	users     map[string]*User
+	anonymous *User
+
+	deliveryFilter DeliveryFilter
 }
 
 // New creates a new server.
@@ -23,8 +26,27 @@ func New() *Server {
 }
 
 // NewSession creates a new IMAP session.
+//
+// The session matches strings in SEARCH criteria with
+// imapserver.DefaultComparator, see NewConnSession to use the comparator
+// configured in imapserver.Options.
 func (s *Server) NewSession() imapserver.Session {
-	return &serverSession{server: s}
+	return s.newSession(nil)
+}
+
+// NewConnSession creates a new IMAP session for a connection.
+//
+// The session matches strings in SEARCH criteria with conn.Comparator.
+func (s *Server) NewConnSession(conn *imapserver.Conn) imapserver.Session {
+	return s.newSession(conn.Comparator())
+}
+
+func (s *Server) newSession(cmp imapserver.Comparator) imapserver.Session {
+	sess := &serverSession{server: s, comparator: cmp}
+	if s.anonymousUser() != nil {
+		return &anonymousServerSession{sess}
+	}
+	return sess
 }
 
 func (s *Server) user(username string) *User {
@@ -33,6 +55,21 @@ func (s *Server) user(username string) *User {
 	return s.users[username]
 }
 
+func (s *Server) anonymousUser() *User {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.anonymous
+}
+
+// SetAnonymousUser sets the user whose mailboxes are shared with clients
+// authenticating with SASL ANONYMOUS. Anonymous sessions are read-only. If
+// nil, SASL ANONYMOUS is disabled.
+func (s *Server) SetAnonymousUser(user *User) {
+	s.mutex.Lock()
+	s.anonymous = user
+	s.mutex.Unlock()
+}
+
 // AddUser adds a user to the server.
 func (s *Server) AddUser(user *User) {
 	s.mutex.Lock()
@@ -43,7 +80,8 @@ func (s *Server) AddUser(user *User) {
 type serverSession struct {
 	*UserSession // may be nil
 
-	server *Server // immutable
+	server     *Server               // immutable
+	comparator imapserver.Comparator // immutable
 }
 
 var _ imapserver.Session = (*serverSession)(nil)
@@ -57,5 +95,34 @@ func (sess *serverSession) Login(username, password string) error {
 		return err
 	}
 	sess.UserSession = NewUserSession(u)
+	sess.UserSession.SetComparator(sess.comparator)
+	return nil
+}
+
+var _ imapserver.SessionExternal = (*serverSession)(nil)
+
+func (sess *serverSession) LoginExternal(username string) error {
+	u := sess.server.user(username)
+	if u == nil {
+		return imapserver.ErrAuthFailed
+	}
+	sess.UserSession = NewUserSession(u)
+	sess.UserSession.SetComparator(sess.comparator)
+	return nil
+}
+
+type anonymousServerSession struct {
+	*serverSession
+}
+
+var _ imapserver.SessionAnonymous = anonymousServerSession{}
+
+func (sess anonymousServerSession) LoginAnonymous(trace string) error {
+	u := sess.server.anonymousUser()
+	if u == nil {
+		return imapserver.ErrAuthFailed
+	}
+	sess.UserSession = NewUserSession(u)
+	sess.UserSession.SetComparator(sess.comparator)
 	return nil
 }
@@ -17,15 +17,28 @@ type (
 type UserSession struct {
 	*user    // immutable
 	*mailbox // may be nil
+
+	comparator imapserver.Comparator
 }
 
-var _ imapserver.SessionIMAP4rev2 = (*UserSession)(nil)
+var (
+	_ imapserver.SessionIMAP4rev2     = (*UserSession)(nil)
+	_ imapserver.SessionChildren      = (*UserSession)(nil)
+	_ imapserver.SessionMailboxLookup = (*UserSession)(nil)
+)
 
 // NewUserSession creates a new user session.
 func NewUserSession(user *User) *UserSession {
 	return &UserSession{user: user}
 }
 
+// SetComparator sets the comparator used to match strings in SEARCH criteria,
+// usually imapserver.Conn.Comparator. If nil, imapserver.DefaultComparator is
+// used.
+func (sess *UserSession) SetComparator(cmp imapserver.Comparator) {
+	sess.comparator = cmp
+}
+
 func (sess *UserSession) Close() error {
 	if sess != nil && sess.mailbox != nil {
 		sess.mailbox.Close()
@@ -41,6 +54,7 @@ func (sess *UserSession) Select(name string, options *imapserver.SelectOptions)
 	mbox.mutex.Lock()
 	defer mbox.mutex.Unlock()
 	sess.mailbox = mbox.NewView()
+	sess.mailbox.comparator = sess.comparator
 	return mbox.selectDataLocked(), nil
 }
 
@@ -56,6 +56,11 @@ func (u *User) mailbox(name string) (*Mailbox, error) {
 	return u.mailboxLocked(name)
 }
 
+// Mailbox returns the mailbox with the specified name.
+func (u *User) Mailbox(name string) (*Mailbox, error) {
+	return u.mailbox(name)
+}
+
 func (u *User) Status(name string, items []imap.StatusItem) (*imap.StatusData, error) {
 	mbox, err := u.mailbox(name)
 	if err != nil {
@@ -64,10 +69,34 @@ func (u *User) Status(name string, items []imap.StatusItem) (*imap.StatusData, e
 	return mbox.StatusData(items), nil
 }
 
-func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+// LookupMailbox returns the LIST data for a mailbox, without matching LIST
+// patterns.
+func (u *User) LookupMailbox(name string) (*imap.ListData, error) {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 
+	names := make([]string, 0, len(u.mailboxes))
+	for name := range u.mailboxes {
+		names = append(names, name)
+	}
+	tree := imapserver.NewMailboxTree(names, mailboxDelim)
+	options := &imap.ListOptions{ReturnChildren: true}
+
+	if mbox := u.mailboxes[name]; mbox != nil {
+		data := mbox.list(options)
+		data.Attrs = append(data.Attrs, tree.Attrs(name, options)...)
+		return data, nil
+	} else if tree.HasChildren(name) {
+		return &imap.ListData{
+			Attrs:   tree.Attrs(name, options),
+			Delim:   mailboxDelim,
+			Mailbox: name,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
 	// TODO: fail if ref doesn't exist
 
 	if len(patterns) == 0 {
@@ -77,25 +106,46 @@ func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, opt
 		})
 	}
 
+	// The lock is released before writing responses. The children
+	// attributes are computed from the tree: the ListWriter doesn't need to
+	// call HasChildren for each mailbox.
+	u.mutex.Lock()
+	names := make([]string, 0, len(u.mailboxes))
+	for name := range u.mailboxes {
+		names = append(names, name)
+	}
+	tree := imapserver.NewMailboxTree(names, mailboxDelim)
+
 	var l []imap.ListData
 	for name, mbox := range u.mailboxes {
-		match := false
-		for _, pattern := range patterns {
-			match = imapserver.MatchList(name, mailboxDelim, ref, pattern)
-			if match {
-				break
-			}
-		}
-		if !match {
+		if !matchListPatterns(name, ref, patterns, "") {
 			continue
 		}
 
 		data := mbox.list(options)
 		if data != nil {
+			data.Attrs = append(data.Attrs, tree.Attrs(name, options)...)
 			l = append(l, *data)
 		}
 	}
 
+	// Levels of hierarchy matched by a trailing "%" are returned even if they
+	// don't exist
+	if !options.SelectSubscribed {
+		for _, name := range tree.ImpliedParents() {
+			if !matchListPatterns(name, ref, patterns, "%") {
+				continue
+			}
+			l = append(l, imap.ListData{
+				Attrs:   tree.Attrs(name, options),
+				Delim:   mailboxDelim,
+				Mailbox: name,
+			})
+		}
+	}
+
+	u.mutex.Unlock()
+
 	sort.Slice(l, func(i, j int) bool {
 		return l[i].Mailbox < l[j].Mailbox
 	})
@@ -109,6 +159,34 @@ func (u *User) List(w *imapserver.ListWriter, ref string, patterns []string, opt
 	return nil
 }
 
+// HasChildren returns true if the mailbox has at least one child mailbox.
+func (u *User) HasChildren(mailbox string) (bool, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	prefix := mailbox + string(mailboxDelim)
+	for name := range u.mailboxes {
+		if strings.HasPrefix(name, prefix) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// matchListPatterns checks whether a mailbox matches any of the patterns
+// ending with suffix.
+func matchListPatterns(name, ref string, patterns []string, suffix string) bool {
+	for _, pattern := range patterns {
+		if !strings.HasSuffix(pattern, suffix) {
+			continue
+		}
+		if imapserver.MatchList(name, mailboxDelim, ref, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
 func (u *User) Append(mailbox string, r imap.LiteralReader, options *imap.AppendOptions) (*imap.AppendData, error) {
 	mbox, err := u.mailbox(mailbox)
 	if err != nil {
@@ -146,11 +224,13 @@ func (u *User) Delete(name string) error {
 	u.mutex.Lock()
 	defer u.mutex.Unlock()
 
-	if _, err := u.mailboxLocked(name); err != nil {
+	mbox, err := u.mailboxLocked(name)
+	if err != nil {
 		return err
 	}
 
 	delete(u.mailboxes, name)
+	mbox.tracker.QueueMailboxDeleted()
 	return nil
 }
 
@@ -176,6 +256,7 @@ func (u *User) Rename(oldName, newName string) error {
 	mbox.rename(newName)
 	u.mailboxes[newName] = mbox
 	delete(u.mailboxes, oldName)
+	mbox.tracker.QueueMailboxRenamed(newName)
 	return nil
 }
 
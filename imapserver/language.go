@@ -0,0 +1,91 @@
+package imapserver
+
+import (
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// defaultLanguage is the language tag for the default server language, see
+// RFC 2277 section 4.5.
+const defaultLanguage = "i-default"
+
+func (c *Conn) handleLanguage(dec *imapwire.Decoder) error {
+	var ranges []string
+	for dec.SP() {
+		var s string
+		if !dec.ExpectAString(&s) {
+			return dec.Err()
+		}
+		ranges = append(ranges, s)
+	}
+	if !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	languages := c.server.options.Languages
+	if len(languages) == 0 {
+		return newClientBugError("LANGUAGE is not supported")
+	}
+
+	if len(ranges) == 0 {
+		return c.writeLanguage(append([]string{defaultLanguage}, languages...))
+	}
+
+	lang := matchLanguage(ranges, languages)
+	if lang == "" {
+		return &imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: "Unsupported language",
+		}
+	}
+
+	c.mutex.Lock()
+	c.language = lang
+	c.mutex.Unlock()
+
+	return c.writeLanguage([]string{lang})
+}
+
+func (c *Conn) writeLanguage(langs []string) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("LANGUAGE").SP().List(len(langs), func(i int) {
+		enc.String(langs[i])
+	})
+	return enc.CRLF()
+}
+
+// localize translates human-readable response text to the language selected
+// by the client.
+func (c *Conn) localize(text string) string {
+	c.mutex.Lock()
+	lang := c.language
+	c.mutex.Unlock()
+
+	translate := c.server.options.Translate
+	if lang == "" || lang == defaultLanguage || translate == nil || text == "" {
+		return text
+	}
+	return translate(lang, text)
+}
+
+// matchLanguage returns the first supported language matching a list of
+// language ranges, as defined in RFC 4647 section 3.3.1.
+func matchLanguage(ranges, languages []string) string {
+	for _, r := range ranges {
+		if r == "*" {
+			return languages[0]
+		}
+		if strings.EqualFold(r, defaultLanguage) {
+			return defaultLanguage
+		}
+		for _, lang := range languages {
+			if strings.EqualFold(lang, r) || (len(lang) > len(r) && strings.EqualFold(lang[:len(r)], r) && lang[len(r)] == '-') {
+				return lang
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,111 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+var testTranslations = map[string]map[string]string{
+	"fr-CA": {
+		"LANGUAGE completed": "LANGUAGE terminé",
+		"NOOP completed":     "NOOP terminé",
+	},
+}
+
+func newLanguageTestConn(t *testing.T, languages []string) (net.Conn, *bufio.Reader) {
+	mem := imapmemserver.New()
+	mem.AddUser(imapmemserver.NewUser("alice", "secret"))
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:      imap.CapSet{imap.CapIMAP4rev1: {}},
+		Languages: languages,
+		Translate: func(lang, text string) string {
+			if s, ok := testTranslations[lang][text]; ok {
+				return s
+			}
+			return text
+		},
+		InsecureAuth: true,
+	})
+	return conn, br
+}
+
+func TestLanguage(t *testing.T) {
+	conn, br := newLanguageTestConn(t, []string{"en", "fr-CA"})
+
+	tests := []struct {
+		cmd      string
+		untagged []string
+		tagged   string
+	}{
+		{
+			cmd:    "NOOP",
+			tagged: "OK NOOP completed",
+		},
+		{
+			// Without arguments, the available languages are listed
+			cmd:      "LANGUAGE",
+			untagged: []string{`* LANGUAGE ("i-default" "en" "fr-CA")`},
+			tagged:   "OK LANGUAGE completed",
+		},
+		{
+			// The response to LANGUAGE is sent in the new language
+			cmd:      "LANGUAGE fr",
+			untagged: []string{`* LANGUAGE ("fr-CA")`},
+			tagged:   "OK LANGUAGE terminé",
+		},
+		{
+			cmd:    "NOOP",
+			tagged: "OK NOOP terminé",
+		},
+		{
+			// The selected language is kept if none matches
+			cmd:    "LANGUAGE de it",
+			tagged: "NO Unsupported language",
+		},
+		{
+			cmd:    "NOOP",
+			tagged: "OK NOOP terminé",
+		},
+		{
+			cmd:      "LANGUAGE i-default",
+			untagged: []string{`* LANGUAGE ("i-default")`},
+			tagged:   "OK LANGUAGE completed",
+		},
+		{
+			cmd:    "NOOP",
+			tagged: "OK NOOP completed",
+		},
+	}
+	for i, tc := range tests {
+		tag := fmt.Sprintf("A%v", i+1)
+		untagged, tagged := roundTrip(t, conn, br, tag, tc.cmd)
+		tagged = strings.TrimPrefix(tagged, tag+" ")
+		if !reflect.DeepEqual(untagged, tc.untagged) || tagged != tc.tagged {
+			t.Errorf("%v: got %v, %q, want %v, %q", tc.cmd, untagged, tagged, tc.untagged, tc.tagged)
+		}
+	}
+}
+
+func TestLanguageUnsupported(t *testing.T) {
+	conn, br := newLanguageTestConn(t, nil)
+
+	untagged, _ := roundTrip(t, conn, br, "A1", "CAPABILITY")
+	if len(untagged) != 1 || strings.Contains(untagged[0], " LANGUAGE") {
+		t.Errorf("CAPABILITY responses = %v, want no LANGUAGE", untagged)
+	}
+	if _, tagged := roundTrip(t, conn, br, "A2", "LANGUAGE"); !strings.HasPrefix(tagged, "A2 BAD") {
+		t.Errorf("LANGUAGE: got %q, want BAD", tagged)
+	}
+}
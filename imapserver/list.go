@@ -5,6 +5,7 @@ import (
 	"strings"
 
 	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal"
 	"github.com/emersion/go-imap/v2/internal/imapwire"
 	"github.com/emersion/go-imap/v2/internal/utf7"
 )
@@ -48,72 +49,20 @@ func (c *Conn) handleLSub(dec *imapwire.Decoder) error {
 		conn: c,
 		lsub: true,
 	}
-	return c.session.List(w, ref, []string{pattern}, options)
+	// LSUB isn't deferrable
+	return runDeferred(c.session.List(w, ref, []string{pattern}, options))
 }
 
 func (c *Conn) writeList(data *imap.ListData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
-
-	enc.Atom("*").SP().Atom("LIST").SP()
-	enc.List(len(data.Attrs), func(i int) {
-		enc.Atom(string(data.Attrs[i])) // TODO: validate attr
-	})
-	enc.SP()
-	if data.Delim == 0 {
-		enc.NIL()
-	} else {
-		enc.Quoted(string(data.Delim))
-	}
-	enc.SP().Mailbox(data.Mailbox)
-
-	var ext []string
-	if data.ChildInfo != nil {
-		ext = append(ext, "CHILDINFO")
-	}
-	if data.OldName != "" {
-		ext = append(ext, "OLDNAME")
-	}
-
-	// TODO: omit extended data if the client didn't ask for it
-	if len(ext) > 0 {
-		enc.SP().List(len(ext), func(i int) {
-			name := ext[i]
-			enc.Atom(name).SP()
-			switch name {
-			case "CHILDINFO":
-				enc.Special('(')
-				if data.ChildInfo.Subscribed {
-					enc.Quoted("SUBSCRIBED")
-				}
-				enc.Special(')')
-			case "OLDNAME":
-				enc.Special('(').Mailbox(data.OldName).Special(')')
-			default:
-				panic(fmt.Errorf("imapserver: unknown LIST extended-item %v", name))
-			}
-		})
-	}
-
-	return enc.CRLF()
+	return enc.ListResponse(data)
 }
 
 func (c *Conn) writeLSub(data *imap.ListData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
-
-	enc.Atom("*").SP().Atom("LSUB").SP()
-	enc.List(len(data.Attrs), func(i int) {
-		enc.Atom(string(data.Attrs[i])) // TODO: validate attr
-	})
-	enc.SP()
-	if data.Delim == 0 {
-		enc.NIL()
-	} else {
-		enc.Quoted(string(data.Delim))
-	}
-	enc.SP().Mailbox(data.Mailbox)
-	return enc.CRLF()
+	return enc.LSubResponse(data)
 }
 
 func readListCmd(dec *imapwire.Decoder) (ref string, patterns []string, options *imap.ListOptions, err error) {
@@ -247,19 +196,61 @@ func readReturnOption(dec *imapwire.Decoder, options *imap.ListOptions) error {
 	return nil
 }
 
+// lookupMailbox returns the LIST data for a mailbox, or nil if the session
+// doesn't list it. Mailboxes which don't exist but have children may be
+// returned with the \NonExistent attribute.
+func (c *Conn) lookupMailbox(mailbox string) (*imap.ListData, error) {
+	if session, ok := c.session.(SessionMailboxLookup); ok {
+		return session.LookupMailbox(mailbox)
+	}
+
+	// Wildcards can't be escaped in LIST patterns: the "%" wildcard matches
+	// them, without matching other hierarchy levels. A LIST-EXTENDED option
+	// is used, so that backends report non-existent mailboxes with
+	// \NonExistent rather than \Noselect.
+	var result *imap.ListData
+	w := &ListWriter{
+		conn:    c,
+		options: &imap.ListOptions{ReturnChildren: true},
+		onList: func(data *imap.ListData) error {
+			if data.MailboxName().Equal(imap.MailboxName{Name: mailbox, Delim: data.Delim}) {
+				result = data
+			}
+			return nil
+		},
+	}
+	pattern := strings.ReplaceAll(mailbox, "*", "%")
+	if err := runDeferred(c.session.List(w, "", []string{pattern}, w.options)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // ListWriter writes LIST responses.
 type ListWriter struct {
 	conn    *Conn
 	options *imap.ListOptions
 	lsub    bool
+
+	// If set, LIST responses are passed to this function instead of being
+	// written to the connection
+	onList func(data *imap.ListData) error
 }
 
 // WriteList writes a single LIST response for a mailbox.
 func (w *ListWriter) WriteList(data *imap.ListData) error {
+	if w.onList != nil {
+		return w.onList(data)
+	}
 	if w.lsub {
 		return w.conn.writeLSub(data)
 	}
 
+	data, err := w.conn.addChildrenAttr(data)
+	if err != nil {
+		return err
+	}
+
 	if err := w.conn.writeList(data); err != nil {
 		return err
 	}
@@ -271,59 +262,38 @@ func (w *ListWriter) WriteList(data *imap.ListData) error {
 	return nil
 }
 
-// MatchList checks whether a reference and a pattern matches a mailbox.
-func MatchList(name string, delim rune, reference, pattern string) bool {
-	var delimStr string
-	if delim != 0 {
-		delimStr = string(delim)
-	}
-
-	if delimStr != "" && strings.HasPrefix(pattern, delimStr) {
-		reference = ""
-		pattern = strings.TrimPrefix(pattern, delimStr)
-	}
-	if reference != "" {
-		if delimStr != "" && !strings.HasSuffix(reference, delimStr) {
-			reference += delimStr
-		}
-		if !strings.HasPrefix(name, reference) {
-			return false
+// addChildrenAttr adds \HasChildren or \HasNoChildren to LIST data missing
+// them, if the session implements SessionChildren. The data is copied before
+// being modified.
+func (c *Conn) addChildrenAttr(data *imap.ListData) (*imap.ListData, error) {
+	session, ok := c.session.(SessionChildren)
+	if !ok {
+		return data, nil
+	}
+	for _, attr := range []imap.MailboxAttr{imap.MailboxAttrHasChildren, imap.MailboxAttrHasNoChildren, imap.MailboxAttrNoInferiors} {
+		if hasMailboxAttr(data.Attrs, attr) {
+			return data, nil
 		}
-		name = strings.TrimPrefix(name, reference)
 	}
 
-	return matchList(name, delimStr, pattern)
-}
-
-func matchList(name, delim, pattern string) bool {
-	// TODO: optimize
-
-	i := strings.IndexAny(pattern, "*%")
-	if i == -1 {
-		// No more wildcards
-		return name == pattern
+	hasChildren, err := session.HasChildren(data.Mailbox)
+	if err != nil {
+		return nil, err
 	}
-
-	// Get parts before and after wildcard
-	chunk, wildcard, rest := pattern[0:i], pattern[i], pattern[i+1:]
-
-	// Check that name begins with chunk
-	if len(chunk) > 0 && !strings.HasPrefix(name, chunk) {
-		return false
+	attr := imap.MailboxAttrHasNoChildren
+	if hasChildren {
+		attr = imap.MailboxAttrHasChildren
+	} else if hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+		// Implied by \NonExistent
+		return data, nil
 	}
-	name = strings.TrimPrefix(name, chunk)
 
-	// Expand wildcard
-	var j int
-	for j = 0; j < len(name); j++ {
-		if wildcard == '%' && string(name[j]) == delim {
-			break // Stop on delimiter if wildcard is %
-		}
-		// Try to match the rest from here
-		if matchList(name[j:], delim, rest) {
-			return true
-		}
-	}
+	withAttr := *data
+	withAttr.Attrs = append(append([]imap.MailboxAttr(nil), data.Attrs...), attr)
+	return &withAttr, nil
+}
 
-	return matchList(name[j:], delim, rest)
+// MatchList checks whether a reference and a pattern matches a mailbox.
+func MatchList(name string, delim rune, reference, pattern string) bool {
+	return internal.MatchList(name, delim, reference, pattern)
 }
@@ -1,9 +1,13 @@
 package imapserver_test
 
 import (
+	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
 )
 
 var matchListTests = []struct {
@@ -49,3 +53,114 @@ func TestMatchList(t *testing.T) {
 		}
 	}
 }
+
+// countingChildrenSession counts HasChildren calls
+type countingChildrenSession struct {
+	imapserver.SessionIMAP4rev2
+	children imapserver.SessionChildren
+	calls    int32
+}
+
+func (s *countingChildrenSession) HasChildren(mailbox string) (bool, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return s.children.HasChildren(mailbox)
+}
+
+func TestListChildren(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Archive", "Archive/2023", "Archive/2024", "Lists/go"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	mem.AddUser(user)
+
+	session := &countingChildrenSession{}
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			sess := mem.NewSession()
+			session.SessionIMAP4rev2 = sess.(imapserver.SessionIMAP4rev2)
+			session.children = sess.(imapserver.SessionChildren)
+			return session, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	untagged, tagged := roundTrip(t, conn, br, "A2", `LIST "" "*"`)
+	if !strings.HasPrefix(tagged, "A2 OK") {
+		t.Fatalf("LIST: %v", tagged)
+	}
+
+	want := map[string]string{
+		"INBOX":        `\HasNoChildren`,
+		"Archive":      `\HasChildren`,
+		"Archive/2023": `\HasNoChildren`,
+		"Archive/2024": `\HasNoChildren`,
+		"Lists/go":     `\HasNoChildren`,
+	}
+	for _, line := range untagged {
+		for name, attr := range want {
+			if strings.HasSuffix(line, ` "/" `+name) || strings.HasSuffix(line, ` "/" "`+name+`"`) {
+				if !strings.Contains(line, attr) {
+					t.Errorf("LIST %v = %q, want %v", name, line, attr)
+				}
+				delete(want, name)
+			}
+		}
+	}
+	for name := range want {
+		t.Errorf("LIST didn't return %v", name)
+	}
+	if n := atomic.LoadInt32(&session.calls); n != 0 {
+		t.Errorf("HasChildren called %v times, want attributes from the mailbox tree", n)
+	}
+}
+
+func TestListImpliedParent(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Lists/go"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	mem.AddUser(user)
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+
+	tests := []struct {
+		cmd, want, notWant string
+	}{
+		{`LIST "" "%"`, `\Noselect`, `\NonExistent`},
+		{`LIST "" "%" RETURN (CHILDREN)`, `\NonExistent`, `\Noselect`},
+	}
+	for _, tc := range tests {
+		untagged, tagged := roundTrip(t, conn, br, "A2", tc.cmd)
+		if !strings.HasPrefix(tagged, "A2 OK") {
+			t.Fatalf("%v: %v", tc.cmd, tagged)
+		}
+		var found bool
+		for _, line := range untagged {
+			if !strings.HasSuffix(line, ` "/" "Lists"`) {
+				continue
+			}
+			found = true
+			if !strings.Contains(line, tc.want) || strings.Contains(line, tc.notWant) {
+				t.Errorf("%v: got %q, want %v", tc.cmd, line, tc.want)
+			}
+		}
+		if !found {
+			t.Errorf("%v didn't return the implied parent: %v", tc.cmd, untagged)
+		}
+	}
+}
@@ -23,6 +23,7 @@ func (c *Conn) handleLogin(tag string, dec *imapwire.Decoder) error {
 	if err := c.session.Login(username, password); err != nil {
 		return err
 	}
+	c.setAuthUser(username)
 	c.state = imap.ConnStateAuthenticated
 	return c.writeCapabilityOK(tag, "Logged in")
 }
@@ -0,0 +1,104 @@
+package imapserver_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// listRecordingSession records LIST patterns. It hides LookupMailbox unless
+// lookup is set.
+type listRecordingSession struct {
+	imapserver.SessionIMAP4rev2
+	lookup imapserver.SessionMailboxLookup
+
+	mutex    sync.Mutex
+	patterns []string
+}
+
+func (s *listRecordingSession) List(w *imapserver.ListWriter, ref string, patterns []string, options *imap.ListOptions) error {
+	s.mutex.Lock()
+	s.patterns = append(s.patterns, patterns...)
+	s.mutex.Unlock()
+	return s.SessionIMAP4rev2.List(w, ref, patterns, options)
+}
+
+func (s *listRecordingSession) recorded() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.patterns...)
+}
+
+type lookupSession struct {
+	*listRecordingSession
+}
+
+func (s lookupSession) LookupMailbox(mailbox string) (*imap.ListData, error) {
+	return s.lookup.LookupMailbox(mailbox)
+}
+
+func newLookupTestConn(t *testing.T, withLookup bool) (*listRecordingSession, func(tag, cmd string) string) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Lists*", "ListsArchive", "Archive/2024"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	mem.AddUser(user)
+
+	session := &listRecordingSession{}
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			sess := mem.NewSession()
+			session.SessionIMAP4rev2 = sess.(imapserver.SessionIMAP4rev2)
+			session.lookup = sess.(imapserver.SessionMailboxLookup)
+			if withLookup {
+				return lookupSession{session}, nil
+			}
+			return session, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	return session, func(tag, cmd string) string {
+		_, tagged := roundTrip(t, conn, br, tag, cmd)
+		return tagged
+	}
+}
+
+func TestSelectLookup(t *testing.T) {
+	session, run := newLookupTestConn(t, true)
+
+	if tagged := run("A2", `SELECT "Lists*"`); !strings.HasPrefix(tagged, "A2 OK") {
+		t.Errorf("SELECT Lists*: %v", tagged)
+	}
+	if tagged := run("A3", "SELECT Archive"); !strings.HasPrefix(tagged, "A3 NO [NONEXISTENT]") {
+		t.Errorf("SELECT of an implied parent: %v, want NO [NONEXISTENT]", tagged)
+	}
+	if patterns := session.recorded(); len(patterns) != 0 {
+		t.Errorf("LIST patterns = %v, want none", patterns)
+	}
+}
+
+func TestSelectLookupList(t *testing.T) {
+	session, run := newLookupTestConn(t, false)
+
+	if tagged := run("A2", `SELECT "Lists*"`); !strings.HasPrefix(tagged, "A2 OK") {
+		t.Errorf("SELECT Lists*: %v", tagged)
+	}
+	if tagged := run("A3", "SELECT Archive"); !strings.HasPrefix(tagged, "A3 NO [NONEXISTENT]") {
+		t.Errorf("SELECT of an implied parent: %v, want NO [NONEXISTENT]", tagged)
+	}
+
+	// The "*" wildcard would match all mailboxes below "Lists"
+	want := []string{"Lists%", "Archive"}
+	if patterns := session.recorded(); strings.Join(patterns, ",") != strings.Join(want, ",") {
+		t.Errorf("LIST patterns = %v, want %v", patterns, want)
+	}
+}
@@ -0,0 +1,202 @@
+package imapserver
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Latency histogram buckets: bucket i contains durations shorter than
+// 1ms << i, the last bucket contains all longer durations.
+const numLatencyBuckets = 21
+
+const (
+	defaultMailboxStatsLimit = 10000
+	// Number of entries among which the one with the lowest total duration
+	// is evicted when the limit is reached
+	mailboxStatsEvictionSamples = 8
+)
+
+func (options *Options) mailboxStatsLimit() int {
+	if options.MailboxStatsLimit > 0 {
+		return options.MailboxStatsLimit
+	}
+	return defaultMailboxStatsLimit
+}
+
+// MailboxStats contains statistics about the commands operating on a
+// mailbox, see Options.MailboxStats.
+//
+// A command operates on the selected mailbox, or on the mailbox passed as
+// argument to SELECT, EXAMINE, STATUS and APPEND.
+type MailboxStats struct {
+	Username string
+	Mailbox  string
+
+	// Number of commands, and number of commands which failed
+	Commands, Errors uint64
+	// Cumulated and maximum command duration
+	TotalTime, MaxTime time.Duration
+	// Approximate command duration percentiles. The precision decreases as
+	// the duration grows: values are rounded up to the next power of two
+	// milliseconds.
+	P50, P90, P99 time.Duration
+}
+
+type mailboxStatsKey struct {
+	username, mailbox string
+}
+
+type mailboxStatsEntry struct {
+	commands, errors   uint64
+	totalTime, maxTime time.Duration
+	buckets            [numLatencyBuckets]uint64
+}
+
+func (entry *mailboxStatsEntry) observe(d time.Duration, failed bool) {
+	entry.commands++
+	if failed {
+		entry.errors++
+	}
+	entry.totalTime += d
+	if d > entry.maxTime {
+		entry.maxTime = d
+	}
+
+	i := 0
+	for i < numLatencyBuckets-1 && d >= time.Millisecond<<i {
+		i++
+	}
+	entry.buckets[i]++
+}
+
+// percentile returns the upper bound of the bucket containing the p-th
+// percentile, with p between 0 and 1.
+func (entry *mailboxStatsEntry) percentile(p float64) time.Duration {
+	rank := uint64(float64(entry.commands)*p + 0.5)
+	if rank == 0 {
+		rank = 1
+	}
+	var n uint64
+	for i, count := range entry.buckets {
+		n += count
+		if n >= rank {
+			if bound := time.Millisecond << i; i < numLatencyBuckets-1 && bound < entry.maxTime {
+				return bound
+			}
+			return entry.maxTime
+		}
+	}
+	return entry.maxTime
+}
+
+// MailboxStats returns per-mailbox command statistics, sorted by decreasing
+// total command duration: the mailboxes causing the most load come first.
+//
+// Statistics are only collected if Options.MailboxStats is set. They are
+// kept until ResetMailboxStats is called, for at most
+// Options.MailboxStatsLimit mailboxes.
+func (s *Server) MailboxStats() []MailboxStats {
+	s.statsMutex.Lock()
+	l := make([]MailboxStats, 0, len(s.mailboxStats))
+	for key, entry := range s.mailboxStats {
+		l = append(l, MailboxStats{
+			Username:  key.username,
+			Mailbox:   key.mailbox,
+			Commands:  entry.commands,
+			Errors:    entry.errors,
+			TotalTime: entry.totalTime,
+			MaxTime:   entry.maxTime,
+			P50:       entry.percentile(0.5),
+			P90:       entry.percentile(0.9),
+			P99:       entry.percentile(0.99),
+		})
+	}
+	s.statsMutex.Unlock()
+
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].TotalTime != l[j].TotalTime {
+			return l[i].TotalTime > l[j].TotalTime
+		}
+		if l[i].Username != l[j].Username {
+			return l[i].Username < l[j].Username
+		}
+		return l[i].Mailbox < l[j].Mailbox
+	})
+	return l
+}
+
+// ResetMailboxStats clears the statistics returned by MailboxStats.
+func (s *Server) ResetMailboxStats() {
+	s.statsMutex.Lock()
+	s.mailboxStats = nil
+	s.statsMutex.Unlock()
+}
+
+// observeCommand records the duration of a command, and logs it if it's
+// slower than Options.SlowCommandThreshold.
+func (c *Conn) observeCommand(cmd *runningCommand, d time.Duration, err error) {
+	options := &c.server.options
+	name, mailbox := cmd.name, cmd.mailbox
+	if mailbox == "" || name == "IDLE" {
+		return // IDLE lasts until the client stops it
+	}
+	if stats, ok := cmd.hooks.(SessionCommandStats); ok {
+		stats.CommandStats(name, mailbox, d, err)
+	}
+	if !options.MailboxStats && (options.SlowCommandThreshold <= 0 || d < options.SlowCommandThreshold) {
+		return
+	}
+
+	c.mutex.Lock()
+	username := c.authUser
+	c.mutex.Unlock()
+
+	if options.SlowCommandThreshold > 0 && d >= options.SlowCommandThreshold {
+		c.server.logger().Printf("slow %v command for user %q on mailbox %q: %v", name, username, mailbox, d)
+	}
+	if !options.MailboxStats {
+		return
+	}
+
+	if strings.EqualFold(mailbox, "INBOX") {
+		mailbox = "INBOX"
+	}
+
+	key := mailboxStatsKey{username: username, mailbox: mailbox}
+	c.server.statsMutex.Lock()
+	defer c.server.statsMutex.Unlock()
+	if c.server.mailboxStats == nil {
+		c.server.mailboxStats = make(map[mailboxStatsKey]*mailboxStatsEntry)
+	}
+	entry := c.server.mailboxStats[key]
+	if entry == nil {
+		if len(c.server.mailboxStats) >= options.mailboxStatsLimit() {
+			evictMailboxStatsLocked(c.server.mailboxStats)
+		}
+		entry = new(mailboxStatsEntry)
+		c.server.mailboxStats[key] = entry
+	}
+	entry.observe(d, err != nil)
+}
+
+// evictMailboxStatsLocked removes an entry causing little load. Map
+// iteration order is random: the entry with the lowest total duration among
+// a few samples is removed, to avoid scanning the whole map.
+func evictMailboxStatsLocked(stats map[mailboxStatsKey]*mailboxStatsEntry) {
+	var (
+		evictKey mailboxStatsKey
+		evict    *mailboxStatsEntry
+		n        int
+	)
+	for key, entry := range stats {
+		if evict == nil || entry.totalTime < evict.totalTime {
+			evictKey, evict = key, entry
+		}
+		n++
+		if n >= mailboxStatsEvictionSamples {
+			break
+		}
+	}
+	delete(stats, evictKey)
+}
@@ -0,0 +1,107 @@
+package imapserver
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMailboxStatsEntry(t *testing.T) {
+	var entry mailboxStatsEntry
+	for i := 0; i < 98; i++ {
+		entry.observe(500*time.Microsecond, false)
+	}
+	entry.observe(3*time.Millisecond, true)
+	entry.observe(2*time.Second, false)
+
+	if entry.commands != 100 || entry.errors != 1 {
+		t.Errorf("commands = %v, errors = %v, want 100 and 1", entry.commands, entry.errors)
+	}
+	if entry.maxTime != 2*time.Second {
+		t.Errorf("maxTime = %v, want 2s", entry.maxTime)
+	}
+	if p := entry.percentile(0.5); p != time.Millisecond {
+		t.Errorf("percentile(0.5) = %v, want 1ms", p)
+	}
+	if p := entry.percentile(0.99); p != 4*time.Millisecond {
+		t.Errorf("percentile(0.99) = %v, want 4ms", p)
+	}
+	if p := entry.percentile(1); p != 2*time.Second {
+		t.Errorf("percentile(1) = %v, want 2s", p)
+	}
+}
+
+func TestServer_MailboxStats(t *testing.T) {
+	s := New(&Options{MailboxStats: true})
+	c := &Conn{server: s, authUser: "alice"}
+
+	c.observeCommand(&runningCommand{name: "FETCH", mailbox: "inbox"}, 10*time.Millisecond, nil)
+	c.observeCommand(&runningCommand{name: "SEARCH", mailbox: "Archive"}, time.Second, nil)
+	c.observeCommand(&runningCommand{name: "IDLE", mailbox: "Archive"}, time.Hour, nil)
+	c.observeCommand(&runningCommand{name: "STORE", mailbox: "INBOX"}, 5*time.Millisecond, nil)
+
+	l := s.MailboxStats()
+	if len(l) != 2 {
+		t.Fatalf("MailboxStats() returned %v entries, want 2", len(l))
+	}
+	if l[0].Mailbox != "Archive" || l[0].Commands != 1 || l[0].TotalTime != time.Second {
+		t.Errorf("MailboxStats()[0] = %+v", l[0])
+	}
+	if l[1].Username != "alice" || l[1].Mailbox != "INBOX" || l[1].Commands != 2 {
+		t.Errorf("MailboxStats()[1] = %+v", l[1])
+	}
+
+	s.ResetMailboxStats()
+	if l := s.MailboxStats(); len(l) != 0 {
+		t.Errorf("MailboxStats() after reset = %+v", l)
+	}
+}
+
+func TestServer_MailboxStatsLimit(t *testing.T) {
+	s := New(&Options{MailboxStats: true, MailboxStatsLimit: 10})
+	c := &Conn{server: s, authUser: "alice"}
+
+	c.observeCommand(&runningCommand{name: "SEARCH", mailbox: "Archive"}, time.Hour, nil)
+	for i := 0; i < 100; i++ {
+		c.observeCommand(&runningCommand{name: "FETCH", mailbox: fmt.Sprintf("Folder%v", i)}, time.Millisecond, nil)
+	}
+
+	l := s.MailboxStats()
+	if len(l) > 10 {
+		t.Errorf("MailboxStats() returned %v entries, want at most 10", len(l))
+	}
+	if l[0].Mailbox != "Archive" {
+		t.Errorf("MailboxStats()[0] = %+v, want the mailbox causing the most load", l[0])
+	}
+}
+
+type commandStatsSession struct {
+	Session
+	mailboxes []string
+}
+
+func (s *commandStatsSession) BeginCommand(name string) error    { return nil }
+func (s *commandStatsSession) EndCommand(name string, err error) {}
+
+func (s *commandStatsSession) CommandStats(name, mailbox string, d time.Duration, err error) {
+	s.mailboxes = append(s.mailboxes, name+" "+mailbox)
+}
+
+func TestSessionCommandStats(t *testing.T) {
+	// Statistics are passed to the session even if the server doesn't
+	// collect them
+	s := New(&Options{})
+	c := &Conn{server: s}
+	session := &commandStatsSession{}
+
+	c.observeCommand(&runningCommand{name: "FETCH", mailbox: "INBOX", hooks: session}, time.Millisecond, nil)
+	c.observeCommand(&runningCommand{name: "IDLE", mailbox: "INBOX", hooks: session}, time.Hour, nil)
+	c.observeCommand(&runningCommand{name: "LIST", hooks: session}, time.Millisecond, nil)
+
+	if len(session.mailboxes) != 1 || session.mailboxes[0] != "FETCH INBOX" {
+		t.Errorf("CommandStats calls = %v, want FETCH INBOX", session.mailboxes)
+	}
+	if l := s.MailboxStats(); len(l) != 0 {
+		t.Errorf("MailboxStats() = %+v, want none", l)
+	}
+}
@@ -0,0 +1,109 @@
+package imapserver
+
+import (
+	"sort"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// MailboxTree computes hierarchy-related mailbox attributes from a flat list
+// of mailbox names.
+//
+// Backends which store mailboxes as a flat list can use it to fill
+// imap.ListData.Attrs consistently: \HasChildren, \HasNoChildren, and
+// \NonExistent or \Noselect.
+type MailboxTree struct {
+	delim    rune
+	exists   map[string]bool
+	children map[string]bool
+}
+
+// NewMailboxTree creates a new mailbox tree from a list of existing mailbox
+// names and the hierarchy delimiter. A zero delimiter indicates a flat
+// hierarchy.
+func NewMailboxTree(names []string, delim rune) *MailboxTree {
+	t := &MailboxTree{
+		delim:    delim,
+		exists:   make(map[string]bool, len(names)),
+		children: make(map[string]bool),
+	}
+	for _, name := range names {
+		name = t.canonical(name)
+		t.exists[name] = true
+		if delim == 0 {
+			continue
+		}
+		for i, ch := range name {
+			if ch == delim && i > 0 {
+				t.children[name[:i]] = true
+			}
+		}
+	}
+	return t
+}
+
+func (t *MailboxTree) canonical(name string) string {
+	return imap.MailboxName{Name: name, Delim: t.delim}.Canonical()
+}
+
+// Exists returns true if the mailbox exists.
+func (t *MailboxTree) Exists(name string) bool {
+	return t.exists[t.canonical(name)]
+}
+
+// HasChildren returns true if the mailbox has at least one existing
+// descendant.
+func (t *MailboxTree) HasChildren(name string) bool {
+	return t.children[t.canonical(name)]
+}
+
+// Attrs returns the hierarchy-related attributes of a mailbox for a LIST
+// command: \HasChildren or \HasNoChildren, and \NonExistent if the mailbox
+// doesn't exist.
+//
+// \NonExistent is defined by LIST-EXTENDED: if the LIST command doesn't use
+// any LIST-EXTENDED option, \Noselect is returned instead, as in RFC 3501.
+// \HasNoChildren is omitted for non-existent mailboxes, since it's implied
+// by \NonExistent in the absence of \HasChildren.
+func (t *MailboxTree) Attrs(name string, options *imap.ListOptions) []imap.MailboxAttr {
+	var attrs []imap.MailboxAttr
+	exists, hasChildren := t.Exists(name), t.HasChildren(name)
+	if !exists && isListExtended(options) {
+		attrs = append(attrs, imap.MailboxAttrNonExistent)
+	} else if !exists {
+		attrs = append(attrs, imap.MailboxAttrNoSelect)
+	}
+	if hasChildren {
+		attrs = append(attrs, imap.MailboxAttrHasChildren)
+	} else if exists {
+		attrs = append(attrs, imap.MailboxAttrHasNoChildren)
+	}
+	return attrs
+}
+
+// ImpliedParents returns the names of the mailboxes which don't exist, but
+// have existing descendants. The names are sorted.
+//
+// For instance, if "Archive/2024" exists but "Archive" doesn't, "Archive" is
+// an implied parent. Servers need to return such mailboxes with the
+// attributes returned by Attrs when matched by a LIST pattern ending with
+// "%".
+func (t *MailboxTree) ImpliedParents() []string {
+	var l []string
+	for name := range t.children {
+		if !t.exists[name] {
+			l = append(l, name)
+		}
+	}
+	sort.Strings(l)
+	return l
+}
+
+// isListExtended returns true if a LIST command uses LIST-EXTENDED options.
+func isListExtended(options *imap.ListOptions) bool {
+	if options == nil {
+		return false
+	}
+	return options.SelectSubscribed || options.SelectRemote || options.SelectRecursiveMatch ||
+		options.ReturnSubscribed || options.ReturnChildren || len(options.ReturnStatus) > 0
+}
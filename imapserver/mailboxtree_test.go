@@ -0,0 +1,48 @@
+package imapserver_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+)
+
+func TestMailboxTree(t *testing.T) {
+	tree := imapserver.NewMailboxTree([]string{
+		"INBOX",
+		"inbox/Receipts",
+		"Archive/2023",
+		"Archive/2024/Q1",
+		"Sent",
+	}, '/')
+
+	extended := &imap.ListOptions{ReturnChildren: true}
+	attrsTests := []struct {
+		name string
+		want []imap.MailboxAttr
+	}{
+		{"INBOX", []imap.MailboxAttr{imap.MailboxAttrHasChildren}},
+		{"INBOX/Receipts", []imap.MailboxAttr{imap.MailboxAttrHasNoChildren}},
+		{"Sent", []imap.MailboxAttr{imap.MailboxAttrHasNoChildren}},
+		{"Archive", []imap.MailboxAttr{imap.MailboxAttrNonExistent, imap.MailboxAttrHasChildren}},
+		{"Archive/2024", []imap.MailboxAttr{imap.MailboxAttrNonExistent, imap.MailboxAttrHasChildren}},
+		{"Drafts", []imap.MailboxAttr{imap.MailboxAttrNonExistent}},
+	}
+	for _, tc := range attrsTests {
+		if attrs := tree.Attrs(tc.name, extended); !reflect.DeepEqual(attrs, tc.want) {
+			t.Errorf("Attrs(%q) = %v, want %v", tc.name, attrs, tc.want)
+		}
+	}
+
+	// \NonExistent is only defined by LIST-EXTENDED
+	wantAttrs := []imap.MailboxAttr{imap.MailboxAttrNoSelect, imap.MailboxAttrHasChildren}
+	if attrs := tree.Attrs("Archive", &imap.ListOptions{}); !reflect.DeepEqual(attrs, wantAttrs) {
+		t.Errorf("Attrs(%q) without LIST-EXTENDED = %v, want %v", "Archive", attrs, wantAttrs)
+	}
+
+	want := []string{"Archive", "Archive/2024"}
+	if l := tree.ImpliedParents(); !reflect.DeepEqual(l, want) {
+		t.Errorf("ImpliedParents() = %v, want %v", l, want)
+	}
+}
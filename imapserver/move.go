@@ -13,12 +13,67 @@ func (c *Conn) handleMove(dec *imapwire.Decoder, numKind NumKind) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
-	session, ok := c.session.(SessionMove)
-	if !ok {
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
+	if !sessionSupportsMove(c.session) {
 		return newClientBugError("MOVE is not supported")
 	}
+	if err := c.autoCreate(dest); err != nil {
+		return err
+	}
 	w := &MoveWriter{conn: c}
-	return session.Move(w, numKind, seqSet, dest)
+	if session, ok := c.session.(SessionMove); ok {
+		err = session.Move(w, numKind, seqSet, dest)
+	} else {
+		err = c.moveWithCopy(w, c.session.(SessionBulkCopy), numKind, seqSet, dest)
+	}
+	return c.overQuotaError(dest, c.tryCreateError(err, dest))
+}
+
+func sessionSupportsMove(session Session) bool {
+	switch session.(type) {
+	case SessionMove, SessionBulkCopy:
+		return true
+	default:
+		return false
+	}
+}
+
+// moveWithCopy implements MOVE for sessions which only support bulk copies,
+// with CopyUIDs, STORE and EXPUNGE. Each step operates on the whole set of
+// messages at once.
+func (c *Conn) moveWithCopy(w *MoveWriter, session SessionBulkCopy, numKind NumKind, numSet imap.SeqSet, dest string) error {
+	// Resolve UIDs beforehand: sequence numbers change when messages are
+	// expunged, and only the moved messages must be expunged
+	uids, err := c.resolveUIDs(numKind, numSet)
+	if err != nil || len(uids) == 0 {
+		return err
+	}
+
+	copyData, err := session.CopyUIDs(uids, dest)
+	if err != nil {
+		return err
+	}
+	if copyData != nil {
+		if err := w.WriteCopyData(copyData); err != nil {
+			return err
+		}
+	}
+
+	err = c.session.Store(&FetchWriter{conn: c}, NumKindUID, uids, &imap.StoreFlags{
+		Op:     imap.StoreFlagsAdd,
+		Silent: true,
+		Flags:  []imap.Flag{imap.FlagDeleted},
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.session.Expunge(&ExpungeWriter{conn: c}, &uids)
 }
 
 // MoveWriter writes responses for the MOVE command.
@@ -0,0 +1,108 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// bulkCopySession supports bulk copies but not MOVE
+type bulkCopySession struct {
+	imapserver.Session
+	copied []imap.SeqSet
+}
+
+func (s *bulkCopySession) CopyUIDs(uids imap.SeqSet, dest string) (*imap.CopyData, error) {
+	s.copied = append(s.copied, uids)
+	return s.Session.Copy(imapserver.NumKindUID, uids, dest)
+}
+
+func newMoveTestConn(t *testing.T) (*bulkCopySession, net.Conn, *bufio.Reader) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Archive"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		msg := "Subject: test\r\n\r\nHello\r\n"
+		if _, err := user.Append("INBOX", strings.NewReader(msg), &imap.AppendOptions{}); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+	mem.AddUser(user)
+
+	session := &bulkCopySession{Session: mem.NewSession()}
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return session, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapMove: {}, imap.CapUIDPlus: {}},
+		InsecureAuth: true,
+	})
+	return session, conn, br
+}
+
+func TestMoveWithBulkCopy(t *testing.T) {
+	session, conn, br := newMoveTestConn(t)
+
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	roundTrip(t, conn, br, "A2", "SELECT INBOX")
+
+	untagged, tagged := roundTrip(t, conn, br, "A3", "MOVE 1:2 Archive")
+	if !strings.HasPrefix(tagged, "A3 OK") {
+		t.Fatalf("MOVE: %v", tagged)
+	}
+	// imapmemserver expunges messages in reverse order
+	want := []string{"* OK [COPYUID", "* 2 EXPUNGE", "* 1 EXPUNGE"}
+	if len(untagged) != len(want) {
+		t.Fatalf("MOVE untagged responses = %v, want %v", untagged, want)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(untagged[i], prefix) {
+			t.Errorf("MOVE untagged response #%v = %q, want %q", i, untagged[i], prefix)
+		}
+	}
+	if len(session.copied) != 1 || session.copied[0].String() != "1:2" {
+		t.Errorf("CopyUIDs called with %v, want [1:2]", session.copied)
+	}
+
+	// The remaining message hasn't been flagged
+	untagged, _ = roundTrip(t, conn, br, "A4", "FETCH 1:* (UID FLAGS)")
+	if len(untagged) != 1 || untagged[0] != "* 1 FETCH (UID 3 FLAGS ())" {
+		t.Errorf("FETCH INBOX = %v, want UID 3 without flags", untagged)
+	}
+
+	// Moved messages don't carry the \Deleted flag
+	roundTrip(t, conn, br, "A5", "SELECT Archive")
+	untagged, _ = roundTrip(t, conn, br, "A6", "FETCH 1:* FLAGS")
+	if len(untagged) != 2 {
+		t.Fatalf("FETCH Archive = %v, want 2 messages", untagged)
+	}
+	for _, line := range untagged {
+		if strings.Contains(line, `\Deleted`) {
+			t.Errorf("moved message flagged as deleted: %v", line)
+		}
+	}
+}
+
+func TestCopyWithBulkCopy(t *testing.T) {
+	session, conn, br := newMoveTestConn(t)
+
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	roundTrip(t, conn, br, "A2", "SELECT INBOX")
+
+	// Sequence numbers are resolved to UIDs, non-existing UIDs are dropped
+	if _, tagged := roundTrip(t, conn, br, "A3", "UID COPY 2:10 Archive"); !strings.HasPrefix(tagged, "A3 OK [COPYUID") {
+		t.Fatalf("UID COPY: %v", tagged)
+	}
+	if len(session.copied) != 1 || session.copied[0].String() != "2:3" {
+		t.Errorf("CopyUIDs called with %v, want [2:3]", session.copied)
+	}
+}
@@ -0,0 +1,78 @@
+package imapserver
+
+import (
+	"time"
+)
+
+// seqNumCommands lists the commands using message sequence numbers. Per
+// RFC 9051 section 5.5, clients must not pipeline them after a command which
+// may send EXPUNGE responses, since the responses renumber the messages.
+var seqNumCommands = map[string]bool{
+	"FETCH":  true,
+	"STORE":  true,
+	"COPY":   true,
+	"MOVE":   true,
+	"SEARCH": true,
+}
+
+// pipeliningProbeTimeout is how long isPipelined waits for data received by
+// the system but not read yet.
+const pipeliningProbeTimeout = time.Millisecond
+
+// isPipelined returns true if the server has received data from the client
+// which hasn't been processed yet. The client has sent it before receiving
+// the responses written so far.
+func (c *Conn) isPipelined() bool {
+	if c.br.Buffered() > 0 {
+		return true
+	}
+	// Check for data received by the system but not read yet. A zero
+	// timeout would fail without attempting to read.
+	c.NetConn().SetReadDeadline(time.Now().Add(pipeliningProbeTimeout))
+	_, err := c.br.Peek(1)
+	c.setReadTimeout(cmdReadTimeout)
+	return err == nil
+}
+
+// recordPipelined records whether commands have been received after a command
+// which has sent EXPUNGE responses. It must be called right before the tagged
+// response of the command is written.
+func (c *Conn) recordPipelined() {
+	c.mutex.Lock()
+	expunged := c.cmdExpunged
+	c.mutex.Unlock()
+	if !expunged {
+		return
+	}
+
+	pipelined := c.isPipelined()
+	c.mutex.Lock()
+	c.cmdPipelined = pipelined
+	c.mutex.Unlock()
+}
+
+// endPipelining records whether the command which has just completed has
+// renumbered messages while the next command was already pipelined.
+func (c *Conn) endPipelining(name string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.pipelineHazard = c.cmdExpunged && name != "IDLE" && c.cmdPipelined
+	c.cmdExpunged = false
+	c.cmdPipelined = false
+}
+
+// checkPipelining returns an error if the command uses message sequence
+// numbers which have been invalidated by EXPUNGE responses sent after the
+// client has sent the command.
+func (c *Conn) checkPipelining(name string) error {
+	c.mutex.Lock()
+	hazard := c.pipelineHazard
+	c.pipelineHazard = false
+	c.mutex.Unlock()
+
+	if !hazard || !seqNumCommands[name] {
+		return nil
+	}
+	c.traceSpec(specPipelining)
+	return newClientBugError("Ambiguous message sequence numbers: command sent before the completion of a command which expunged messages")
+}
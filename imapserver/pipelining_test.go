@@ -0,0 +1,181 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestPipelining(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		msg := "Subject: Hello\r\n\r\nHi\r\n"
+		if _, err := user.Append("INBOX", strings.NewReader(msg), &imap.AppendOptions{}); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+	mem.AddUser(user)
+
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+	defer server.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	write := func(s string) {
+		if _, err := io.WriteString(conn, s); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+	// Reads responses until the tagged one, and returns it
+	readTagged := func(tag string) string {
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatalf("ReadString() = %v", err)
+			}
+			if strings.HasPrefix(line, tag+" ") {
+				return strings.TrimRight(line, "\r\n")
+			}
+		}
+	}
+
+	if _, err := br.ReadString('\n'); err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	}
+	write("A1 LOGIN alice secret\r\nA2 SELECT INBOX\r\nA3 STORE 1,2 +FLAGS.SILENT (\\Deleted)\r\n")
+	readTagged("A3")
+
+	// A4 is ambiguous: it's sent before the client knows that message 3 is
+	// now message 1
+	write("A4 EXPUNGE\r\nA5 FETCH 1 FLAGS\r\n")
+	readTagged("A4")
+	if resp := readTagged("A5"); !strings.HasPrefix(resp, "A5 BAD [CLIENTBUG]") {
+		t.Errorf("pipelined FETCH after EXPUNGE: got %q, want BAD", resp)
+	}
+
+	// Once the client has received the EXPUNGE responses, sequence numbers
+	// are unambiguous
+	write("A6 FETCH 1 FLAGS\r\n")
+	if resp := readTagged("A6"); !strings.HasPrefix(resp, "A6 OK") {
+		t.Errorf("FETCH after EXPUNGE completion: got %q, want OK", resp)
+	}
+
+	// Commands which don't use sequence numbers can be pipelined
+	write("A7 STORE 1 +FLAGS.SILENT (\\Deleted)\r\nA8 EXPUNGE\r\nA9 NOOP\r\n")
+	if resp := readTagged("A9"); !strings.HasPrefix(resp, "A9 OK") {
+		t.Errorf("pipelined NOOP after EXPUNGE: got %q, want OK", resp)
+	}
+}
+
+// blockingExpungeSession blocks EXPUNGE until unblock is closed
+type blockingExpungeSession struct {
+	imapserver.Session
+	expunging chan struct{}
+	unblock   chan struct{}
+}
+
+func (s *blockingExpungeSession) Expunge(w *imapserver.ExpungeWriter, uids *imap.SeqSet) error {
+	close(s.expunging)
+	<-s.unblock
+	return s.Session.Expunge(w, uids)
+}
+
+func TestPipeliningReceivedDuringCommand(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		msg := "Subject: Hello\r\n\r\nHi\r\n"
+		if _, err := user.Append("INBOX", strings.NewReader(msg), &imap.AppendOptions{}); err != nil {
+			t.Fatalf("Append() = %v", err)
+		}
+	}
+	mem.AddUser(user)
+
+	session := &blockingExpungeSession{
+		Session:   mem.NewSession(),
+		expunging: make(chan struct{}),
+		unblock:   make(chan struct{}),
+	}
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return session, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+	defer server.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("net.Dial() = %v", err)
+	}
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+
+	if _, err := br.ReadString('\n'); err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	}
+	for _, cmd := range []string{"A1 LOGIN alice secret", "A2 SELECT INBOX", "A3 STORE 1 +FLAGS.SILENT (\\Deleted)"} {
+		roundTrip(t, conn, br, cmd[:2], cmd[3:])
+	}
+
+	// A5 is sent while A4 is running, in a separate packet
+	if _, err := io.WriteString(conn, "A4 EXPUNGE\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	<-session.expunging
+	if _, err := io.WriteString(conn, "A5 FETCH 1 FLAGS\r\n"); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(session.unblock)
+
+	var lines []string
+	for len(lines) == 0 || !strings.HasPrefix(lines[len(lines)-1], "A5 ") {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() = %v", err)
+		}
+		lines = append(lines, strings.TrimRight(line, "\r\n"))
+	}
+	if resp := lines[len(lines)-1]; !strings.HasPrefix(resp, "A5 BAD [CLIENTBUG]") {
+		t.Errorf("FETCH received before EXPUNGE completion: got %q, want BAD", resp)
+	}
+}
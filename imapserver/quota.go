@@ -0,0 +1,221 @@
+package imapserver
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+// Quota is a quota root tracking storage and message count usage.
+//
+// Backends can use it to enforce limits: Add must be called before storing
+// messages, and Remove after deleting them. A Quota is safe for concurrent
+// use, and can be shared between multiple mailboxes or users.
+type Quota struct {
+	root string
+
+	mutex        sync.Mutex
+	storageLimit int64 // bytes
+	messageLimit int64
+	storage      int64
+	messages     int64
+}
+
+// NewQuota creates a new quota root. The storage limit is expressed in bytes.
+// A zero limit means unlimited.
+func NewQuota(root string, storageLimit, messageLimit int64) *Quota {
+	return &Quota{
+		root:         root,
+		storageLimit: storageLimit,
+		messageLimit: messageLimit,
+	}
+}
+
+// Root returns the name of the quota root.
+func (q *Quota) Root() string {
+	return q.root
+}
+
+// SetLimits updates the limits. A zero limit means unlimited.
+func (q *Quota) SetLimits(storageLimit, messageLimit int64) {
+	q.mutex.Lock()
+	q.storageLimit = storageLimit
+	q.messageLimit = messageLimit
+	q.mutex.Unlock()
+}
+
+// Usage returns the current storage usage in bytes and the number of
+// messages.
+func (q *Quota) Usage() (storage, messages int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.storage, q.messages
+}
+
+// Add records numMessages new messages with a total size of size bytes.
+//
+// If a limit would be exceeded, usage is left unchanged and a NO response
+// with the OVERQUOTA response code is returned.
+func (q *Quota) Add(size, numMessages int64) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.storageLimit > 0 && q.storage+size > q.storageLimit {
+		return newOverQuotaError("Storage quota exceeded")
+	}
+	if q.messageLimit > 0 && q.messages+numMessages > q.messageLimit {
+		return newOverQuotaError("Message quota exceeded")
+	}
+	q.storage += size
+	q.messages += numMessages
+	return nil
+}
+
+// Remove records the deletion of numMessages messages with a total size of
+// size bytes.
+func (q *Quota) Remove(size, numMessages int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.storage -= size
+	q.messages -= numMessages
+	if q.storage < 0 {
+		q.storage = 0
+	}
+	if q.messages < 0 {
+		q.messages = 0
+	}
+}
+
+func newOverQuotaError(text string) *imap.Error {
+	return &imap.Error{
+		Type: imap.StatusResponseTypeNo,
+		Code: imap.ResponseCodeOverQuota,
+		Text: text,
+	}
+}
+
+func (c *Conn) handleGetQuota(dec *imapwire.Decoder) error {
+	var root string
+	if !dec.ExpectSP() || !dec.ExpectAString(&root) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionQuota)
+	if !ok {
+		return newClientBugError("GETQUOTA is not supported")
+	}
+
+	quota, err := session.Quota(root)
+	if err != nil {
+		return err
+	}
+	return c.writeQuota(quota)
+}
+
+func (c *Conn) handleGetQuotaRoot(dec *imapwire.Decoder) error {
+	var mailbox string
+	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
+		return dec.Err()
+	}
+
+	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
+		return err
+	}
+
+	session, ok := c.session.(SessionQuota)
+	if !ok {
+		return newClientBugError("GETQUOTAROOT is not supported")
+	}
+
+	quotas, err := session.QuotaRoots(mailbox)
+	if err != nil {
+		return err
+	}
+
+	if err := c.writeQuotaRoot(mailbox, quotas); err != nil {
+		return err
+	}
+	for _, quota := range quotas {
+		if err := c.writeQuota(quota); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Conn) writeQuotaRoot(mailbox string, quotas []*Quota) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("QUOTAROOT").SP().Mailbox(mailbox)
+	for _, quota := range quotas {
+		enc.SP().String(quota.Root())
+	}
+	return enc.CRLF()
+}
+
+func (c *Conn) writeQuota(quota *Quota) error {
+	quota.mutex.Lock()
+	storage, messages := quota.storage, quota.messages
+	storageLimit, messageLimit := quota.storageLimit, quota.messageLimit
+	quota.mutex.Unlock()
+
+	type resource struct {
+		typ          imap.QuotaResourceType
+		usage, limit int64
+	}
+	var resources []resource
+	if storageLimit > 0 {
+		resources = append(resources, resource{imap.QuotaResourceStorage, storageUnits(storage), storageUnits(storageLimit)})
+	}
+	if messageLimit > 0 {
+		resources = append(resources, resource{imap.QuotaResourceMessage, messages, messageLimit})
+	}
+
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("QUOTA").SP().String(quota.Root()).SP()
+	enc.List(len(resources), func(i int) {
+		res := resources[i]
+		enc.Atom(string(res.typ)).SP().Number64(res.usage).SP().Number64(res.limit)
+	})
+	return enc.CRLF()
+}
+
+// storageUnits converts a number of octets to the units of the STORAGE
+// resource, 1024 octets, rounding up.
+func storageUnits(n int64) int64 {
+	return (n + 1023) / 1024
+}
+
+// overQuotaError sends QUOTA responses for the quota roots of a mailbox if
+// err contains the OVERQUOTA response code, as recommended by RFC 9208.
+func (c *Conn) overQuotaError(mailbox string, err error) error {
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeOverQuota {
+		return err
+	}
+	session, ok := c.session.(SessionQuota)
+	if !ok {
+		return err
+	}
+
+	quotas, quotaErr := session.QuotaRoots(mailbox)
+	if quotaErr != nil {
+		c.server.logger().Printf("failed to get quota roots for mailbox %q: %v", mailbox, quotaErr)
+		return err
+	}
+	for _, quota := range quotas {
+		if writeErr := c.writeQuota(quota); writeErr != nil {
+			return fmt.Errorf("failed to write QUOTA response: %w", writeErr)
+		}
+	}
+	return err
+}
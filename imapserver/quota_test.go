@@ -0,0 +1,55 @@
+package imapserver
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestQuota(t *testing.T) {
+	q := NewQuota("", 1000, 2)
+
+	if err := q.Add(600, 1); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+
+	var imapErr *imap.Error
+	if err := q.Add(600, 1); !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeOverQuota {
+		t.Errorf("Add() = %v, want OVERQUOTA", err)
+	}
+	if storage, messages := q.Usage(); storage != 600 || messages != 1 {
+		t.Errorf("Usage() = %v, %v, want 600, 1", storage, messages)
+	}
+
+	if err := q.Add(100, 1); err != nil {
+		t.Fatalf("Add() = %v", err)
+	}
+	if err := q.Add(0, 1); err == nil {
+		t.Errorf("Add() = nil, want OVERQUOTA")
+	}
+
+	q.Remove(700, 2)
+	if storage, messages := q.Usage(); storage != 0 || messages != 0 {
+		t.Errorf("Usage() = %v, %v, want 0, 0", storage, messages)
+	}
+
+	q.SetLimits(0, 0)
+	if err := q.Add(1<<40, 1<<20); err != nil {
+		t.Errorf("Add() = %v, want no limit", err)
+	}
+}
+
+func TestStorageUnits(t *testing.T) {
+	for _, tc := range []struct{ in, want int64 }{
+		{0, 0},
+		{1, 1},
+		{1024, 1},
+		{1025, 2},
+		{1500, 2},
+	} {
+		if got := storageUnits(tc.in); got != tc.want {
+			t.Errorf("storageUnits(%v) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package imapserver
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -76,64 +77,69 @@ func (c *Conn) handleSearch(tag string, dec *imapwire.Decoder, numKind NumKind)
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
+
+	if session, ok := c.session.(SessionSearchIndex); ok {
+		resolved, err := applySearchIndex(&criteria, session.SearchText)
+		if err != nil {
+			return err
+		}
+		criteria = *resolved
+	}
 
 	data, err := c.session.Search(numKind, &criteria, &options)
-	if err != nil {
+	var deferred *deferredResponse
+	if errors.As(err, &deferred) && deferred.search != nil {
+		return Defer(func() error {
+			data, err := deferred.search()
+			if err != nil {
+				return err
+			}
+			return c.writeSearchData(tag, data, &options, extended)
+		})
+	} else if err != nil {
 		return err
 	}
 
+	return c.writeSearchData(tag, data, &options, extended)
+}
+
+func (c *Conn) writeSearchData(tag string, data *imap.SearchData, options *imap.SearchOptions, extended bool) error {
 	if c.enabled.Has(imap.CapIMAP4rev2) || extended {
-		return c.writeESearch(tag, data, &options)
+		return c.writeESearch(tag, data, options)
 	} else {
-		return c.writeSearch(data.All)
+		return c.writeSearch(data)
+	}
+}
+
+// WriteESearch writes an ESEARCH response.
+//
+// The tag is the tag of the command the response correlates to, and can be
+// empty for unsolicited responses. Only the items requested in the return
+// options are written: MIN, MAX and ALL are omitted if no message matched,
+// and ALL is written if no return option is set. The UID indicator is written
+// if data.UID is set and MODSEQ if data.ModSeq is non-zero.
+//
+// This can be used to implement extensions returning ESEARCH responses.
+func (c *Conn) WriteESearch(tag string, data *imap.SearchData, options *imap.SearchOptions) error {
+	if options == nil {
+		options = new(imap.SearchOptions)
 	}
+	return c.writeESearch(tag, data, options)
 }
 
 func (c *Conn) writeESearch(tag string, data *imap.SearchData, options *imap.SearchOptions) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
-
-	returnOpts := make(map[imap.SearchReturnOption]bool)
-	for _, opt := range options.Return {
-		returnOpts[opt] = true
-	}
-
-	enc.Atom("*").SP().Atom("ESEARCH")
-	if tag != "" {
-		enc.SP().Special('(').Atom("TAG").SP().Atom(tag).Special(')')
-	}
-	if data.UID {
-		enc.SP().Atom("UID")
-	}
-	if (returnOpts[imap.SearchReturnAll] || len(options.Return) == 0) && len(data.All) > 0 {
-		enc.SP().Atom("ALL").SP().Atom(data.All.String())
-	}
-	if returnOpts[imap.SearchReturnMin] && data.Min > 0 {
-		enc.SP().Atom("MIN").SP().Number(data.Min)
-	}
-	if returnOpts[imap.SearchReturnMax] && data.Max > 0 {
-		enc.SP().Atom("MAX").SP().Number(data.Max)
-	}
-	if returnOpts[imap.SearchReturnCount] {
-		enc.SP().Atom("COUNT").SP().Number(data.Count)
-	}
-	return enc.CRLF()
+	return enc.ESearchResponse(tag, data, options)
 }
 
-func (c *Conn) writeSearch(seqSet imap.SeqSet) error {
+func (c *Conn) writeSearch(data *imap.SearchData) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
-
-	nums, ok := seqSet.Nums()
-	if !ok {
-		return fmt.Errorf("imapserver: failed to enumerate message numbers in SEARCH response")
-	}
-
-	enc.Atom("*").SP().Atom("SEARCH")
-	for _, num := range nums {
-		enc.SP().Number(num)
-	}
-	return enc.CRLF()
+	return enc.SearchResponse(data)
 }
 
 func readSearchReturnOpts(dec *imapwire.Decoder) ([]imap.SearchReturnOption, error) {
@@ -303,7 +309,7 @@ func readSearchKeyWithAtom(criteria *imap.SearchCriteria, dec *imapwire.Decoder,
 		}
 		criteria.Or = append(criteria.Or, or)
 	default:
-		seqSet, err := imap.ParseSeqSet(key)
+		seqSet, err := dec.ParseSeqSet(key)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,76 @@
+package imapserver
+
+import (
+	"github.com/emersion/go-imap/v2"
+)
+
+// SearchTextCriteria contains the full-text keys of SEARCH criteria.
+//
+// A message matches if it matches all of the keys.
+type SearchTextCriteria struct {
+	// Strings the message body must contain
+	Body []string
+	// Strings the message header or body must contain
+	Text []string
+}
+
+// applySearchIndex returns a copy of the criteria with the full-text keys
+// replaced with UID keys, as returned by the search index.
+//
+// Each set of criteria is resolved independently, so that full-text keys
+// nested in NOT and OR keys keep their meaning.
+func applySearchIndex(criteria *imap.SearchCriteria, search func(*SearchTextCriteria) (imap.UIDSet, error)) (*imap.SearchCriteria, error) {
+	out := *criteria
+
+	if len(criteria.Body) > 0 || len(criteria.Text) > 0 {
+		uids, err := search(&SearchTextCriteria{
+			Body: criteria.Body,
+			Text: criteria.Text,
+		})
+		if err != nil {
+			return nil, err
+		}
+		out.Body, out.Text = nil, nil
+
+		out.Not = append([]imap.SearchCriteria(nil), criteria.Not...)
+		switch {
+		case len(uids) == 0:
+			// NOT ALL doesn't match any message
+			out.Not = append(out.Not, imap.SearchCriteria{})
+		case len(out.UID) == 0:
+			out.UID = imap.SeqSet(uids)
+		default:
+			// NOT (NOT UID x) intersects with the existing UID key
+			out.Not = append(out.Not, imap.SearchCriteria{
+				Not: []imap.SearchCriteria{{UID: imap.SeqSet(uids)}},
+			})
+		}
+	}
+
+	if len(out.Not) > 0 {
+		not := make([]imap.SearchCriteria, len(out.Not))
+		for i := range out.Not {
+			c, err := applySearchIndex(&out.Not[i], search)
+			if err != nil {
+				return nil, err
+			}
+			not[i] = *c
+		}
+		out.Not = not
+	}
+	if len(out.Or) > 0 {
+		or := make([][2]imap.SearchCriteria, len(out.Or))
+		for i := range out.Or {
+			for j := range out.Or[i] {
+				c, err := applySearchIndex(&out.Or[i][j], search)
+				if err != nil {
+					return nil, err
+				}
+				or[i][j] = *c
+			}
+		}
+		out.Or = or
+	}
+
+	return &out, nil
+}
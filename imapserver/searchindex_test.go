@@ -0,0 +1,101 @@
+package imapserver
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestApplySearchIndex(t *testing.T) {
+	index := map[string]imap.UIDSet{
+		"hello":  imap.UIDSetNum(1, 2, 3),
+		"world":  imap.UIDSetNum(2),
+		"absent": nil,
+	}
+	search := func(criteria *SearchTextCriteria) (imap.UIDSet, error) {
+		var keys []string
+		keys = append(keys, criteria.Body...)
+		keys = append(keys, criteria.Text...)
+		return index[strings.Join(keys, " ")], nil
+	}
+
+	tests := []struct {
+		name     string
+		criteria imap.SearchCriteria
+		want     imap.SearchCriteria
+	}{
+		{
+			name:     "structural",
+			criteria: imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}},
+			want:     imap.SearchCriteria{Flag: []imap.Flag{imap.FlagSeen}},
+		},
+		{
+			name: "text",
+			criteria: imap.SearchCriteria{
+				Text: []string{"hello"},
+				Flag: []imap.Flag{imap.FlagSeen},
+			},
+			want: imap.SearchCriteria{
+				UID:  imap.SeqSet(imap.UIDSetNum(1, 2, 3)),
+				Flag: []imap.Flag{imap.FlagSeen},
+			},
+		},
+		{
+			name: "bodyAndText",
+			criteria: imap.SearchCriteria{
+				Body: []string{"hello"},
+				Text: []string{"world"},
+			},
+			want: imap.SearchCriteria{Not: []imap.SearchCriteria{{}}},
+		},
+		{
+			name:     "noMatch",
+			criteria: imap.SearchCriteria{Text: []string{"absent"}},
+			want:     imap.SearchCriteria{Not: []imap.SearchCriteria{{}}},
+		},
+		{
+			name: "existingUID",
+			criteria: imap.SearchCriteria{
+				UID:  imap.SeqSet(imap.UIDSetNum(2, 4)),
+				Body: []string{"hello"},
+			},
+			want: imap.SearchCriteria{
+				UID: imap.SeqSet(imap.UIDSetNum(2, 4)),
+				Not: []imap.SearchCriteria{{
+					Not: []imap.SearchCriteria{{UID: imap.SeqSet(imap.UIDSetNum(1, 2, 3))}},
+				}},
+			},
+		},
+		{
+			name: "nested",
+			criteria: imap.SearchCriteria{
+				Not: []imap.SearchCriteria{{Text: []string{"world"}}},
+				Or: [][2]imap.SearchCriteria{{
+					{Text: []string{"hello"}},
+					{Flag: []imap.Flag{imap.FlagFlagged}},
+				}},
+			},
+			want: imap.SearchCriteria{
+				Not: []imap.SearchCriteria{{UID: imap.SeqSet(imap.UIDSetNum(2))}},
+				Or: [][2]imap.SearchCriteria{{
+					{UID: imap.SeqSet(imap.UIDSetNum(1, 2, 3))},
+					{Flag: []imap.Flag{imap.FlagFlagged}},
+				}},
+			},
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := applySearchIndex(&tc.criteria, search)
+			if err != nil {
+				t.Fatalf("applySearchIndex() = %v", err)
+			}
+			if !reflect.DeepEqual(*got, tc.want) {
+				t.Errorf("applySearchIndex() = %v, want %v", got.String(), tc.want.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package imapserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+	gomessage "github.com/emersion/go-message"
+	"github.com/emersion/go-message/textproto"
+)
+
+// ExtractBodySection extracts a body section from a full message, for
+// backends which don't store messages in parsed form.
+//
+// Part paths, the HEADER, HEADER.FIELDS, HEADER.FIELDS.NOT, MIME and TEXT
+// specifiers, and partial ranges are supported. The whole message is read in
+// memory. If the message doesn't contain the requested part, an empty section
+// is returned. Only errors reading r are returned.
+func ExtractBodySection(r io.Reader, section *imap.FetchItemBodySection) ([]byte, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return extractBodySection(buf, section), nil
+}
+
+func extractBodySection(buf []byte, item *imap.FetchItemBodySection) []byte {
+	br := bufio.NewReader(bytes.NewReader(buf))
+	header, err := textproto.ReadHeader(br)
+	if err != nil {
+		return nil
+	}
+	var body io.Reader = br
+
+	// First part of non-multipart message refers to the message itself
+	msgHeader := gomessage.Header{Header: header}
+	mediaType, _, _ := msgHeader.ContentType()
+	partPath := item.Part
+	if !strings.HasPrefix(mediaType, "multipart/") && len(partPath) > 0 && partPath[0] == 1 {
+		partPath = partPath[1:]
+	}
+
+	// Find the requested part using the provided path
+	var parentMediaType string
+	for _, partNum := range partPath {
+		header, body = openMessagePart(header, body, parentMediaType)
+
+		msgHeader := gomessage.Header{Header: header}
+		mediaType, typeParams, _ := msgHeader.ContentType()
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			if partNum != 1 {
+				return nil
+			}
+			continue
+		}
+
+		mr := textproto.NewMultipartReader(body, typeParams["boundary"])
+		for j := 1; j <= partNum; j++ {
+			p, err := mr.NextPart()
+			if err != nil {
+				return nil
+			}
+			if j == partNum {
+				parentMediaType = mediaType
+				header = p.Header
+				body = p
+			}
+		}
+	}
+
+	if len(item.Part) > 0 {
+		switch item.Specifier {
+		case imap.PartSpecifierHeader, imap.PartSpecifierText:
+			header, body = openMessagePart(header, body, parentMediaType)
+		}
+	}
+
+	// Filter header fields
+	if len(item.HeaderFields) > 0 {
+		keep := make(map[string]struct{})
+		for _, k := range item.HeaderFields {
+			keep[strings.ToLower(k)] = struct{}{}
+		}
+		for field := header.Fields(); field.Next(); {
+			if _, ok := keep[strings.ToLower(field.Key())]; !ok {
+				field.Del()
+			}
+		}
+	}
+	for _, k := range item.HeaderFieldsNot {
+		header.Del(k)
+	}
+
+	// Write the requested data to a buffer
+	var out bytes.Buffer
+
+	writeHeader := true
+	switch item.Specifier {
+	case imap.PartSpecifierNone:
+		writeHeader = len(item.Part) == 0
+	case imap.PartSpecifierText:
+		writeHeader = false
+	}
+	if writeHeader {
+		if err := textproto.WriteHeader(&out, header); err != nil {
+			return nil
+		}
+	}
+
+	switch item.Specifier {
+	case imap.PartSpecifierNone, imap.PartSpecifierText:
+		if _, err := io.Copy(&out, body); err != nil {
+			return nil
+		}
+	}
+
+	return applyPartial(out.Bytes(), item.Partial)
+}
+
+// openMessagePart returns the header and body of the message encapsulated
+// in a message/rfc822 part. Other parts are returned as-is.
+func openMessagePart(header textproto.Header, body io.Reader, parentMediaType string) (textproto.Header, io.Reader) {
+	msgHeader := gomessage.Header{Header: header}
+	mediaType, _, _ := msgHeader.ContentType()
+	if !msgHeader.Has("Content-Type") && parentMediaType == "multipart/digest" {
+		mediaType = "message/rfc822"
+	}
+	if mediaType == "message/rfc822" || mediaType == "message/global" {
+		br := bufio.NewReader(body)
+		header, _ = textproto.ReadHeader(br)
+		return header, br
+	}
+	return header, body
+}
+
+func applyPartial(b []byte, partial *imap.SectionPartial) []byte {
+	if partial == nil {
+		return b
+	}
+	if partial.Offset > int64(len(b)) {
+		return nil
+	}
+	end := partial.Offset + partial.Size
+	if end > int64(len(b)) {
+		end = int64(len(b))
+	}
+	return b[partial.Offset:end]
+}
@@ -0,0 +1,53 @@
+package imapserver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+const sectionTestMessage = "From: alice@example.org\r\n" +
+	"Subject: Hello\r\n" +
+	"Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"Hi there\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/html\r\n" +
+	"\r\n" +
+	"<p>Hi</p>\r\n" +
+	"--b--\r\n"
+
+func TestExtractBodySection(t *testing.T) {
+	tests := []struct {
+		section *imap.FetchItemBodySection
+		want    string
+	}{
+		{
+			&imap.FetchItemBodySection{Specifier: imap.PartSpecifierHeader, HeaderFields: []string{"subject"}},
+			"Subject: Hello\r\n\r\n",
+		},
+		{
+			&imap.FetchItemBodySection{Specifier: imap.PartSpecifierHeader, HeaderFieldsNot: []string{"Content-Type", "From"}},
+			"Subject: Hello\r\n\r\n",
+		},
+		{&imap.FetchItemBodySection{Part: []int{1}}, "Hi there"},
+		{&imap.FetchItemBodySection{Part: []int{2}, Specifier: imap.PartSpecifierMIME}, "Content-Type: text/html\r\n\r\n"},
+		{&imap.FetchItemBodySection{Part: []int{3}}, ""},
+		{&imap.FetchItemBodySection{Partial: &imap.SectionPartial{Offset: 6, Size: 5}}, "alice"},
+		{&imap.FetchItemBodySection{Part: []int{1}, Partial: &imap.SectionPartial{Offset: 3, Size: 100}}, "there"},
+		{&imap.FetchItemBodySection{Partial: &imap.SectionPartial{Offset: 10000, Size: 1}}, ""},
+	}
+	for _, tc := range tests {
+		b, err := ExtractBodySection(strings.NewReader(sectionTestMessage), tc.section)
+		if err != nil {
+			t.Fatalf("ExtractBodySection(%+v) = %v", tc.section, err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("ExtractBodySection(%+v) = %q, want %q", tc.section, b, tc.want)
+		}
+	}
+}
@@ -17,19 +17,23 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectCRLF() {
 		return dec.Err()
 	}
+	c.cmdMailbox = mailbox
 
 	if err := c.checkState(imap.ConnStateAuthenticated); err != nil {
 		return err
 	}
 
 	if c.state == imap.ConnStateSelected {
-		if err := c.session.Unselect(); err != nil {
+		if c.deferredSelect != nil {
+			c.deferredSelect = nil
+		} else if err := c.session.Unselect(); err != nil {
 			return err
 		}
 		c.state = imap.ConnStateAuthenticated
+		c.readOnly = false
 		err := c.writeStatusResp("", &imap.StatusResponse{
 			Type: imap.StatusResponseTypeOK,
-			Code: "CLOSED",
+			Code: imap.ResponseCodeClosed,
 			Text: "Previous mailbox is now closed",
 		})
 		if err != nil {
@@ -37,8 +41,26 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 		}
 	}
 
+	if err := c.checkSelectable(mailbox); err != nil {
+		return err
+	}
+
+	if c.anonymous {
+		readOnly = true
+	}
+
 	options := SelectOptions{ReadOnly: readOnly}
-	data, err := c.session.Select(mailbox, &options)
+	var (
+		data     *imap.SelectData
+		deferred *deferredSelect
+		err      error
+	)
+	if sess, ok := c.session.(SessionMailboxSummary); ok {
+		data, err = sess.MailboxSummary(mailbox)
+		deferred = &deferredSelect{mailbox: mailbox, options: options, summary: data}
+	} else {
+		data, err = c.session.Select(mailbox, &options)
+	}
 	if err != nil {
 		return err
 	}
@@ -47,7 +69,7 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 		return err
 	}
 	if !c.enabled.Has(imap.CapIMAP4rev2) {
-		if err := c.writeObsoleteRecent(); err != nil {
+		if err := c.writeObsoleteRecent(data.NumRecent); err != nil {
 			return err
 		}
 	}
@@ -57,6 +79,15 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	if err := c.writeUIDNext(data.UIDNext); err != nil {
 		return err
 	}
+	if data.UIDNotSticky {
+		if err := c.writeStatusResp("", &imap.StatusResponse{
+			Type: imap.StatusResponseTypeNo,
+			Code: imap.ResponseCodeUIDNotSticky,
+			Text: "Non-persistent UIDs",
+		}); err != nil {
+			return err
+		}
+	}
 	if err := c.writeFlags(data.Flags); err != nil {
 		return err
 	}
@@ -70,7 +101,9 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	}
 
 	c.state = imap.ConnStateSelected
-	// TODO: forbid write commands in read-only mode
+	c.mailbox = mailbox
+	c.readOnly = readOnly
+	c.deferredSelect = deferred
 
 	var (
 		cmdName string
@@ -78,10 +111,10 @@ func (c *Conn) handleSelect(tag string, dec *imapwire.Decoder, readOnly bool) er
 	)
 	if readOnly {
 		cmdName = "EXAMINE"
-		code = "READ-ONLY"
+		code = imap.ResponseCodeReadOnly
 	} else {
 		cmdName = "SELECT"
-		code = "READ-WRITE"
+		code = imap.ResponseCodeReadWrite
 	}
 	return c.writeStatusResp(tag, &imap.StatusResponse{
 		Type: imap.StatusResponseTypeOK,
@@ -95,11 +128,23 @@ func (c *Conn) handleUnselect(dec *imapwire.Decoder, expunge bool) error {
 		return dec.Err()
 	}
 
+	// The mailbox doesn't need to be opened if there is nothing to expunge
+	if c.deferredSelect != nil && (!expunge || c.readOnly) {
+		c.deferredSelect = nil
+		c.state = imap.ConnStateAuthenticated
+		c.readOnly = false
+		return nil
+	}
+
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
 
-	if expunge {
+	// CLOSE doesn't expunge messages in read-only mailboxes
+	if expunge && !c.readOnly {
 		w := &ExpungeWriter{}
 		if err := c.session.Expunge(w, nil); err != nil {
 			return err
@@ -111,6 +156,36 @@ func (c *Conn) handleUnselect(dec *imapwire.Decoder, expunge bool) error {
 	}
 
 	c.state = imap.ConnStateAuthenticated
+	c.readOnly = false
+	return nil
+}
+
+// checkSelectable returns an error if the mailbox is listed with the
+// \Noselect or \NonExistent attribute.
+func (c *Conn) checkSelectable(mailbox string) error {
+	data, err := c.lookupMailbox(mailbox)
+	if err != nil {
+		return err
+	} else if data == nil {
+		return nil
+	}
+
+	for _, attr := range data.Attrs {
+		switch attr {
+		case imap.MailboxAttrNoSelect:
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeCannot,
+				Text: "Mailbox cannot be selected",
+			}
+		case imap.MailboxAttrNonExistent:
+			return &imap.Error{
+				Type: imap.StatusResponseTypeNo,
+				Code: imap.ResponseCodeNonExistent,
+				Text: "No such mailbox",
+			}
+		}
+	}
 	return nil
 }
 
@@ -120,10 +195,10 @@ func (c *Conn) writeExists(numMessages uint32) error {
 	return enc.Atom("*").SP().Number(numMessages).SP().Atom("EXISTS").CRLF()
 }
 
-func (c *Conn) writeObsoleteRecent() error {
+func (c *Conn) writeObsoleteRecent(n uint32) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
-	return enc.Atom("*").SP().Number(0).SP().Atom("RECENT").CRLF()
+	return enc.Atom("*").SP().Number(n).SP().Atom("RECENT").CRLF()
 }
 
 func (c *Conn) writeUIDValidity(uidValidity uint32) error {
@@ -131,7 +206,7 @@ func (c *Conn) writeUIDValidity(uidValidity uint32) error {
 	defer enc.end()
 	enc.Atom("*").SP().Atom("OK").SP()
 	enc.Special('[').Atom("UIDVALIDITY").SP().Number(uidValidity).Special(']')
-	enc.SP().Text("UIDs valid")
+	enc.SP().Text(c.localize("UIDs valid"))
 	return enc.CRLF()
 }
 
@@ -140,7 +215,7 @@ func (c *Conn) writeUIDNext(uidNext uint32) error {
 	defer enc.end()
 	enc.Atom("*").SP().Atom("OK").SP()
 	enc.Special('[').Atom("UIDNEXT").SP().Number(uidNext).Special(']')
-	enc.SP().Text("Predicted next UID")
+	enc.SP().Text(c.localize("Predicted next UID"))
 	return enc.CRLF()
 }
 
@@ -160,6 +235,6 @@ func (c *Conn) writePermanentFlags(flags []imap.Flag) error {
 	enc.Special('[').Atom("PERMANENTFLAGS").SP().List(len(flags), func(i int) {
 		enc.Flag(flags[i])
 	}).Special(']')
-	enc.SP().Text("Permanent flags")
+	enc.SP().Text(c.localize("Permanent flags"))
 	return enc.CRLF()
 }
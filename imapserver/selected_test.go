@@ -0,0 +1,78 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func newSelectedTestConn(t *testing.T, enable bool) (net.Conn, *bufio.Reader) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Archive"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create() = %v", err)
+		}
+	}
+	mem.AddUser(user)
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}},
+		InsecureAuth: true,
+	})
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	if enable {
+		roundTrip(t, conn, br, "A2", "ENABLE IMAP4rev2")
+	}
+	if _, tagged := roundTrip(t, conn, br, "A3", "SELECT Archive"); !strings.HasPrefix(tagged, "A3 OK") {
+		t.Fatalf("SELECT: %v", tagged)
+	}
+	return conn, br
+}
+
+func TestRenameDeleteSelected(t *testing.T) {
+	conn, br := newSelectedTestConn(t, true)
+
+	untagged, tagged := roundTrip(t, conn, br, "A4", "RENAME Archive Old")
+	if !strings.HasPrefix(tagged, "A4 OK") {
+		t.Fatalf("RENAME: %v", tagged)
+	}
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* OK ") || strings.Contains(untagged[0], "[CLOSED]") {
+		t.Errorf("RENAME untagged responses = %v, want OK", untagged)
+	}
+
+	// The selected mailbox is tracked under its new name
+	untagged, tagged = roundTrip(t, conn, br, "A5", "DELETE Old")
+	if !strings.HasPrefix(tagged, "A5 OK") {
+		t.Fatalf("DELETE: %v", tagged)
+	}
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* OK [CLOSED]") {
+		t.Errorf("DELETE untagged responses = %v, want OK [CLOSED]", untagged)
+	}
+	if _, tagged := roundTrip(t, conn, br, "A6", "FETCH 1:* FLAGS"); !strings.HasPrefix(tagged, "A6 BAD") {
+		t.Errorf("FETCH after DELETE: %v, want BAD", tagged)
+	}
+}
+
+func TestDeleteSelectedIMAP4rev1(t *testing.T) {
+	conn, br := newSelectedTestConn(t, false)
+
+	untagged, tagged := roundTrip(t, conn, br, "A4", "DELETE Archive")
+	if !strings.HasPrefix(tagged, "A4 OK") {
+		t.Fatalf("DELETE: %v", tagged)
+	}
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* OK ") || strings.Contains(untagged[0], "[CLOSED]") {
+		t.Errorf("DELETE untagged responses = %v, want OK without CLOSED", untagged)
+	}
+	if _, tagged := roundTrip(t, conn, br, "A5", "FETCH 1:* FLAGS"); !strings.HasPrefix(tagged, "A5 BAD") {
+		t.Errorf("FETCH after DELETE: %v, want BAD", tagged)
+	}
+}
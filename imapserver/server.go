@@ -16,6 +16,9 @@ import (
 
 var errClosed = errors.New("imapserver: server closed")
 
+// alpnProtocol is the ALPN protocol ID for IMAP, see RFC 7301.
+const alpnProtocol = "imap"
+
 // Logger is a facility to log error messages.
 type Logger interface {
 	Printf(format string, args ...interface{})
@@ -43,16 +46,110 @@ type Options struct {
 	Caps imap.CapSet
 	// Logger is a logger to print error messages. If nil, log.Default is used.
 	Logger Logger
-	// TLSConfig is a TLS configuration for STARTTLS. If nil, STARTTLS is
-	// disabled.
+	// TLSConfig is a TLS configuration for STARTTLS and implicit TLS. If nil,
+	// STARTTLS is disabled.
+	//
+	// The "imap" ALPN protocol is automatically added to NextProtos for
+	// implicit TLS listeners.
 	TLSConfig *tls.Config
+	// TLSNextProto optionally specifies a function to take over ownership of
+	// an implicit TLS connection when a non-IMAP ALPN protocol has been
+	// negotiated. The map key is the protocol name. This can be used to serve
+	// multiple protocols on the same TLS listener.
+	//
+	// The function is responsible for closing the connection. Server.Close
+	// closes the connection if the function hasn't returned yet.
+	TLSNextProto map[string]func(*tls.Conn)
 	// InsecureAuth allows clients to authenticate without TLS. In this mode,
 	// the server is susceptible to man-in-the-middle attacks.
 	InsecureAuth bool
+	// ClientCertificates maps TLS client certificates to usernames. If set
+	// and the session implements SessionExternal, clients presenting a
+	// verified certificate can authenticate with SASL EXTERNAL.
+	ClientCertificates *CertificateMapper
 	// Raw ingress and egress data will be written to this writer, if any.
 	// Note, this may include sensitive information such as credentials used
 	// during authentication.
 	DebugWriter io.Writer
+
+	// Hostname is the server hostname advertised in the greeting, if any.
+	Hostname string
+	// GreetingText is the human-readable text sent in the greeting. If empty,
+	// "IMAP server ready" is used.
+	GreetingText string
+	// GreetingOmitCaps disables the CAPABILITY response code in the greeting.
+	// Clients will need to issue a CAPABILITY command.
+	GreetingOmitCaps bool
+	// AutologoutTimeout is the inactivity timeout after which authenticated
+	// connections are logged out with a BYE response. If zero, 35 minutes is
+	// used. RFC 9051 section 5.4 requires at least 30 minutes.
+	//
+	// Connections running IDLE are not subject to this timer.
+	AutologoutTimeout time.Duration
+	// AutoCreateMailbox is called when a COPY, MOVE or APPEND command targets
+	// a mailbox which doesn't exist. If it returns true, the mailbox is
+	// created before running the command. If nil, the command fails with a
+	// TRYCREATE response code.
+	AutoCreateMailbox func(conn *Conn, mailbox string) bool
+	// Languages lists the languages available for human-readable response
+	// text, as RFC 5646 language tags. If non-empty, the LANGUAGE capability
+	// is advertised and clients can select a language with the LANGUAGE
+	// command.
+	Languages []string
+	// Translate localizes human-readable response text once the client has
+	// selected a language other than the default one. If nil, text is left
+	// untranslated.
+	Translate func(lang, text string) string
+	// Comparator is returned by Conn.Comparator. If nil, DefaultComparator
+	// is used.
+	//
+	// Servers using DefaultComparator in their backend can advertise the
+	// I18NLEVEL=1 capability.
+	Comparator Comparator
+	// SeqSetParseOptions contains the limits applied to sequence sets sent
+	// by clients. If nil, imap.DefaultSeqSetParseOptions is used.
+	SeqSetParseOptions *imap.SeqSetParseOptions
+	// WriteRateLimit limits the rate at which data is sent to each
+	// connection, in bytes per second. If zero, the rate is unlimited.
+	// Large responses are sent at once, and delay the next responses.
+	WriteRateLimit int64
+	// UserWriteRateLimit limits the combined rate at which data is sent to
+	// all connections authenticated as the same user, in bytes per second.
+	// The bandwidth is shared fairly between these connections, so that a
+	// client downloading a whole mailbox cannot starve the user's other
+	// sessions. If zero, the rate is unlimited.
+	UserWriteRateLimit int64
+	// CommandFilter returns the commands and SASL mechanisms available on a
+	// connection. It's called once per connection, and can return a different
+	// filter for each listener, e.g. based on conn.NetConn().LocalAddr(). If
+	// nil or if it returns nil, all commands are available.
+	CommandFilter func(conn *Conn) *CommandFilter
+	// ConformanceTrace receives a machine-readable trace of all connections,
+	// to debug interoperability issues with clients. The trace contains one
+	// JSON-encoded TraceEvent per line: commands received, status responses
+	// sent and references to the specification sections motivating them.
+	//
+	// Unlike DebugWriter, the trace doesn't contain command arguments and
+	// message data, but it may still contain sensitive information such as
+	// mailbox names in response text.
+	ConformanceTrace io.Writer
+	// Faults injects simulated faults, to test clients. If nil, no fault is
+	// injected.
+	Faults *FaultInjection
+	// MailboxStats enables the collection of per-mailbox command statistics,
+	// to find the mailboxes causing the most load. See Server.MailboxStats.
+	MailboxStats bool
+	// MailboxStatsLimit is the maximum number of mailboxes for which
+	// statistics are kept. When it's reached, statistics of mailboxes
+	// causing little load are dropped. If zero, 10000 is used.
+	MailboxStatsLimit int
+	// SlowCommandThreshold is the duration above which commands operating on
+	// a mailbox are logged, along with the username and mailbox name. If
+	// zero, slow commands aren't logged.
+	SlowCommandThreshold time.Duration
+	// IdleTickInterval is the interval at which SessionIdleTick.IdleTick is
+	// called while a connection is running IDLE. If zero, 1 minute is used.
+	IdleTickInterval time.Duration
 }
 
 func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
@@ -68,6 +165,31 @@ func (options *Options) wrapReadWriter(rw io.ReadWriter) io.ReadWriter {
 	}
 }
 
+func (options *Options) autologoutTimeout() time.Duration {
+	if options.AutologoutTimeout > 0 {
+		return options.AutologoutTimeout
+	}
+	return idleReadTimeout
+}
+
+func (options *Options) idleTickInterval() time.Duration {
+	if options.IdleTickInterval > 0 {
+		return options.IdleTickInterval
+	}
+	return time.Minute
+}
+
+func (options *Options) greetingText() string {
+	text := options.GreetingText
+	if text == "" {
+		text = "IMAP server ready"
+	}
+	if options.Hostname != "" {
+		text = options.Hostname + " " + text
+	}
+	return text
+}
+
 func (options *Options) caps() imap.CapSet {
 	if options.Caps != nil {
 		return options.Caps
@@ -85,6 +207,12 @@ type Server struct {
 	listeners map[net.Listener]struct{}
 	conns     map[*Conn]struct{}
 	closed    bool
+
+	userLimiters map[string]*userRateLimiter
+	tracer       *conformanceTracer // immutable
+
+	statsMutex   sync.Mutex
+	mailboxStats map[mailboxStatsKey]*mailboxStatsEntry
 }
 
 // New creates a new server.
@@ -92,11 +220,33 @@ func New(options *Options) *Server {
 	if caps := options.caps(); !caps.Has(imap.CapIMAP4rev2) && !caps.Has(imap.CapIMAP4rev1) {
 		panic("imapserver: at least IMAP4rev1 must be supported")
 	}
-	return &Server{
+	s := &Server{
 		options:   *options,
 		listeners: make(map[net.Listener]struct{}),
 		conns:     make(map[*Conn]struct{}),
 	}
+	if options.ConformanceTrace != nil {
+		s.tracer = newConformanceTracer(options.ConformanceTrace)
+	}
+	return s
+}
+
+func (s *Server) tlsConfig() *tls.Config {
+	if s.options.TLSConfig == nil {
+		return nil
+	}
+	config := s.options.TLSConfig.Clone()
+	hasIMAP := false
+	for _, proto := range config.NextProtos {
+		if proto == alpnProtocol {
+			hasIMAP = true
+			break
+		}
+	}
+	if !hasIMAP {
+		config.NextProtos = append(config.NextProtos, alpnProtocol)
+	}
+	return config
 }
 
 func (s *Server) logger() Logger {
@@ -167,6 +317,18 @@ func (s *Server) ListenAndServe(addr string) error {
 	return s.Serve(ln)
 }
 
+// ServeTLS accepts incoming connections on the listener ln and performs an
+// implicit TLS handshake on each of them.
+//
+// The TLS configuration set in Options.TLSConfig is used.
+func (s *Server) ServeTLS(ln net.Listener) error {
+	config := s.tlsConfig()
+	if config == nil {
+		return fmt.Errorf("imapserver: TLSConfig is required for implicit TLS")
+	}
+	return s.Serve(tls.NewListener(ln, config))
+}
+
 // ListenAndServeTLS listens on the TCP network address addr and then calls
 // Serve to handle incoming TLS connections.
 //
@@ -176,11 +338,56 @@ func (s *Server) ListenAndServeTLS(addr string) error {
 	if addr == "" {
 		addr = ":993"
 	}
-	ln, err := tls.Listen("tcp", addr, s.options.TLSConfig)
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
 		return err
 	}
-	return s.Serve(ln)
+	return s.ServeTLS(ln)
+}
+
+// ListenAndServeAll listens on the TCP network address addr for cleartext
+// connections (with STARTTLS if Options.TLSConfig is set) and on tlsAddr for
+// implicit TLS connections, then serves both.
+//
+// If addr is empty, ":143" is used. If tlsAddr is empty, ":993" is used.
+//
+// ListenAndServeAll returns as soon as one of the listeners fails. The other
+// listener is closed.
+func (s *Server) ListenAndServeAll(addr, tlsAddr string) error {
+	if addr == "" {
+		addr = ":143"
+	}
+	if tlsAddr == "" {
+		tlsAddr = ":993"
+	}
+
+	if s.tlsConfig() == nil {
+		return fmt.Errorf("imapserver: TLSConfig is required for implicit TLS")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	tlsLn, err := net.Listen("tcp", tlsAddr)
+	if err != nil {
+		ln.Close()
+		return err
+	}
+
+	errCh := make(chan error, 2)
+	go func() {
+		errCh <- s.Serve(ln)
+	}()
+	go func() {
+		errCh <- s.ServeTLS(tlsLn)
+	}()
+
+	err = <-errCh
+	ln.Close()
+	tlsLn.Close()
+	<-errCh
+	return err
 }
 
 // Close immediately closes all active listeners and connections.
@@ -212,7 +419,7 @@ func (s *Server) Close() error {
 
 	s.mutex.Lock()
 	for c := range s.conns {
-		c.conn.Close()
+		c.close()
 	}
 	s.mutex.Unlock()
 
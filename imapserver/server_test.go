@@ -0,0 +1,167 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+type discardLogger struct{}
+
+func (discardLogger) Printf(format string, args ...interface{}) {}
+
+func newALPNTestServer(t *testing.T, nextProto map[string]func(*tls.Conn)) (*imapserver.Server, string) {
+	mem := imapmemserver.New()
+	config := newTestTLSConfig(t)
+	config.NextProtos = []string{"imap", "x-test"}
+	server := imapserver.New(&imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		Logger:       discardLogger{},
+		TLSConfig:    config,
+		TLSNextProto: nextProto,
+	})
+	t.Cleanup(func() { server.Close() })
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	go server.ServeTLS(ln)
+	return server, ln.Addr().String()
+}
+
+func dialALPN(t *testing.T, addr, proto string) *tls.Conn {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{proto},
+	})
+	if err != nil {
+		t.Fatalf("tls.Dial() = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+func TestServeTLSNextProto(t *testing.T) {
+	_, addr := newALPNTestServer(t, map[string]func(*tls.Conn){
+		"x-test": func(conn *tls.Conn) {
+			io.WriteString(conn, "hello\r\n")
+			conn.Close()
+		},
+	})
+
+	tests := []struct {
+		proto string
+		want  string
+	}{
+		{"x-test", "hello"},
+		{"imap", "* OK"},
+	}
+	for _, tc := range tests {
+		conn := dialALPN(t, addr, tc.proto)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			t.Fatalf("ReadString() with ALPN %q = %v", tc.proto, err)
+		}
+		if !strings.HasPrefix(line, tc.want) {
+			t.Errorf("ALPN %q: got %q, want %q", tc.proto, line, tc.want)
+		}
+	}
+}
+
+func TestServeTLSNextProtoPanic(t *testing.T) {
+	_, addr := newALPNTestServer(t, map[string]func(*tls.Conn){
+		"x-test": func(conn *tls.Conn) {
+			panic("test")
+		},
+	})
+
+	conn := dialALPN(t, addr, "x-test")
+	if _, err := conn.Read(make([]byte, 1)); err == nil {
+		t.Errorf("Read() = nil, want the connection to be closed")
+	}
+
+	// The server keeps running
+	conn = dialALPN(t, addr, "imap")
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+		t.Fatalf("ReadString() = %v", err)
+	} else if !strings.HasPrefix(line, "* OK") {
+		t.Errorf("got %q, want greeting", line)
+	}
+}
+
+func TestServerCloseTakenOver(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan error, 1)
+	server, addr := newALPNTestServer(t, map[string]func(*tls.Conn){
+		"x-test": func(conn *tls.Conn) {
+			close(started)
+			_, err := conn.Read(make([]byte, 1))
+			done <- err
+		},
+	})
+
+	dialALPN(t, addr, "x-test")
+	<-started
+	server.Close()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Read() = nil, want error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close() didn't close the connection handed over to TLSNextProto")
+	}
+}
+
+func TestListenAndServeAll(t *testing.T) {
+	newServer := func(config *tls.Config) *imapserver.Server {
+		mem := imapmemserver.New()
+		return imapserver.New(&imapserver.Options{
+			NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+				return mem.NewSession(), nil
+			},
+			Caps:      imap.CapSet{imap.CapIMAP4rev1: {}},
+			TLSConfig: config,
+		})
+	}
+
+	if err := newServer(nil).ListenAndServeAll("127.0.0.1:0", "127.0.0.1:0"); err == nil {
+		t.Errorf("ListenAndServeAll() without TLSConfig = nil, want error")
+	}
+
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() = %v", err)
+	}
+	defer busy.Close()
+	if err := newServer(newTestTLSConfig(t)).ListenAndServeAll("127.0.0.1:0", busy.Addr().String()); err == nil {
+		t.Errorf("ListenAndServeAll() with busy TLS address = nil, want error")
+	}
+
+	server := newServer(newTestTLSConfig(t))
+	done := make(chan error, 1)
+	go func() {
+		done <- server.ListenAndServeAll("127.0.0.1:0", "127.0.0.1:0")
+	}()
+	time.Sleep(50 * time.Millisecond)
+	server.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("ListenAndServeAll() didn't return after Close()")
+	}
+}
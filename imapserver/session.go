@@ -2,6 +2,7 @@ package imapserver
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/emersion/go-imap/v2"
 )
@@ -15,6 +16,14 @@ var errAuthFailed = &imap.Error{
 // ErrAuthFailed is returned by Session.Login on authentication failure.
 var ErrAuthFailed = errAuthFailed
 
+// ErrAuthzFailed is returned by SessionLoginAs.LoginAs when the authenticated
+// user isn't allowed to act as the requested authorization identity.
+var ErrAuthzFailed = &imap.Error{
+	Type: imap.StatusResponseTypeNo,
+	Code: imap.ResponseCodeAuthorizationFailed,
+	Text: "Authorization failed",
+}
+
 // NumKind describes how a number should be interpreted: either as a sequence
 // number, either as a UID.
 type NumKind int
@@ -73,6 +82,23 @@ type SessionNamespace interface {
 	Namespace() (*imap.NamespaceData, error)
 }
 
+// SessionMailboxLookup is an IMAP session which can look up a single mailbox
+// by name.
+//
+// The server looks up mailboxes to check whether they can be selected or
+// need to be created. Sessions which don't implement SessionMailboxLookup are
+// sent a LIST command instead.
+type SessionMailboxLookup interface {
+	Session
+
+	// Authenticated state
+
+	// LookupMailbox returns the LIST data for a mailbox, or nil if it doesn't
+	// exist. Mailboxes which don't exist but have children can be returned
+	// with the \NonExistent attribute.
+	LookupMailbox(mailbox string) (*imap.ListData, error)
+}
+
 // SessionMove is an IMAP session which supports MOVE.
 type SessionMove interface {
 	Session
@@ -81,6 +107,202 @@ type SessionMove interface {
 	Move(w *MoveWriter, kind NumKind, seqSet imap.SeqSet, dest string) error
 }
 
+// SessionBulkCopy is an IMAP session which copies a whole set of messages at
+// once, e.g. with a single database operation.
+//
+// The server resolves the messages to UIDs before calling CopyUIDs: uids only
+// contains messages which exist in the selected mailbox, and is never empty.
+// Sessions which don't implement SessionBulkCopy receive the sequence set sent
+// by the client in Copy, and iterate over the messages themselves.
+//
+// If the session implements SessionBulkCopy but not SessionMove, MOVE commands
+// are executed with CopyUIDs, Store and Expunge.
+type SessionBulkCopy interface {
+	Session
+
+	// Selected state
+	CopyUIDs(uids imap.SeqSet, dest string) (*imap.CopyData, error)
+}
+
+// SessionQuota is an IMAP session which supports QUOTA.
+//
+// The session can use the Quota helper to enforce limits.
+type SessionQuota interface {
+	Session
+
+	// Authenticated state
+	Quota(root string) (*Quota, error)
+	QuotaRoots(mailbox string) ([]*Quota, error)
+}
+
+// SessionAppendLimit is an IMAP session which limits the size of messages
+// appended to mailboxes.
+type SessionAppendLimit interface {
+	Session
+
+	// AppendLimit returns the maximum size of a message appended to a
+	// mailbox, in bytes. Zero means that the server default is used.
+	//
+	// APPEND commands exceeding the limit are rejected before the client
+	// uploads the message.
+	AppendLimit(mailbox string) uint32
+}
+
+// SessionPreAuth is an IMAP session which may start in the authenticated
+// state, e.g. for connections over a trusted local transport.
+//
+// If PreAuth returns true, a PREAUTH greeting is sent and LOGIN/AUTHENTICATE
+// are skipped.
+type SessionPreAuth interface {
+	Session
+
+	// PreAuth is called once before the greeting is sent.
+	PreAuth() bool
+}
+
+// SessionCommandHooks is an IMAP session which is notified before and after
+// each command, e.g. to wrap each command in a database transaction.
+//
+// name is the upper-case command name, prefixed with "UID " for UID commands.
+type SessionCommandHooks interface {
+	Session
+
+	// BeginCommand is called before a command is executed. If an error is
+	// returned, the command isn't executed and the error is sent to the
+	// client.
+	BeginCommand(name string) error
+	// EndCommand is called after a command has been executed, with the error
+	// returned by the command, if any.
+	EndCommand(name string, err error)
+}
+
+// SessionCommandStats is a SessionCommandHooks which is passed statistics
+// about commands operating on a mailbox, e.g. to export metrics.
+//
+// A command operates on the selected mailbox, or on the mailbox passed as
+// argument to SELECT, EXAMINE, STATUS and APPEND. IDLE commands are excluded.
+type SessionCommandStats interface {
+	SessionCommandHooks
+
+	// CommandStats is called before EndCommand, with the duration of the
+	// command and the error it returned, if any.
+	CommandStats(name, mailbox string, d time.Duration, err error)
+}
+
+// SessionIdleTick is an IMAP session which is notified periodically while
+// IDLE is running, at the interval set in Options.IdleTickInterval.
+//
+// This is useful for backends which don't have a native change feed and need
+// to poll their storage: IdleTick can check for changes and queue them in a
+// MailboxTracker, and Idle sends them to the client.
+type SessionIdleTick interface {
+	Session
+
+	// IdleTick is called concurrently with Idle. It's never called once the
+	// IDLE command has completed. If an error is returned, it's logged and
+	// IDLE keeps running.
+	IdleTick() error
+}
+
+// SessionAnonymous is an IMAP session which supports SASL ANONYMOUS, defined in
+// RFC 4505.
+//
+// Anonymous sessions are read-only: mailboxes are always opened with EXAMINE
+// semantics and commands which modify mailboxes (CREATE, DELETE, RENAME,
+// SUBSCRIBE, UNSUBSCRIBE, APPEND, COPY) are rejected. This is suitable for
+// publishing public archives, such as mailing lists.
+type SessionAnonymous interface {
+	Session
+
+	// Not authenticated state
+	LoginAnonymous(trace string) error
+}
+
+// SessionLoginAs is an IMAP session which supports SASL authorization
+// identities distinct from the authentication identity. This allows admin or
+// migration users to act on behalf of other accounts.
+//
+// Authorization identities are only supported with the PLAIN mechanism.
+type SessionLoginAs interface {
+	Session
+
+	// Not authenticated state
+
+	// LoginAs authenticates with the username and password, then acts as
+	// the authorization identity authzid. The backend decides whether the
+	// authenticated user is allowed to do so, and should return
+	// ErrAuthzFailed otherwise.
+	LoginAs(authzid, username, password string) error
+}
+
+// SessionExternal is an IMAP session which supports SASL EXTERNAL with TLS
+// client certificates. Options.ClientCertificates must be set.
+type SessionExternal interface {
+	Session
+
+	// Not authenticated state
+
+	// LoginExternal authenticates as the user identified by the client
+	// certificate, as mapped by Options.ClientCertificates. The backend
+	// should return ErrAuthFailed if the account doesn't exist.
+	LoginExternal(username string) error
+}
+
+// SessionSearchIndex is an IMAP session which delegates full-text SEARCH keys
+// to an external index, e.g. backed by Bleve or Xapian.
+//
+// BODY and TEXT keys are evaluated with SearchText and replaced with UID keys
+// before the criteria are passed to Search, which only needs to evaluate the
+// remaining structural keys.
+type SessionSearchIndex interface {
+	Session
+
+	// Selected state
+
+	// SearchText returns the UIDs of the messages in the selected mailbox
+	// which match all of the full-text keys. The index may use fuzzy
+	// matching.
+	SearchText(criteria *SearchTextCriteria) (imap.UIDSet, error)
+}
+
+// SessionEnable is an IMAP session which is notified when the client enables
+// extensions with the ENABLE command, defined in RFC 5161.
+//
+// CONDSTORE, QRESYNC and UTF8=ACCEPT are advertised and can be enabled if
+// they're listed in Options.Caps. The server only handles the parts of these
+// extensions which don't involve the backend (e.g. the CLOSED response code
+// and UTF-8 quoted strings): the session is responsible for the rest, such as
+// sending MODSEQ items once CONDSTORE is enabled. Conn.Enabled returns the
+// enabled extensions.
+type SessionEnable interface {
+	Session
+
+	// Authenticated state
+
+	// Enable is called when the client enables an extension. Extensions
+	// implied by the requested one are enabled first, e.g. CONDSTORE before
+	// QRESYNC. Enable is called at most once per extension. If an error is
+	// returned, the ENABLE command fails.
+	Enable(cap imap.Cap) error
+}
+
+// SessionChildren is an IMAP session which can tell whether a mailbox has
+// children, for the CHILDREN extension defined in RFC 3348.
+//
+// LIST responses written without \HasChildren, \HasNoChildren or
+// \NoInferiors are completed with the result of HasChildren. Backends can
+// answer from an index instead of listing the whole hierarchy for each
+// mailbox.
+type SessionChildren interface {
+	Session
+
+	// Authenticated state
+
+	// HasChildren returns true if the mailbox has at least one child
+	// mailbox.
+	HasChildren(mailbox string) (bool, error)
+}
+
 // SessionIMAP4rev2 is an IMAP session which supports IMAP4rev2.
 type SessionIMAP4rev2 interface {
 	Session
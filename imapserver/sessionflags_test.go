@@ -0,0 +1,80 @@
+package imapserver_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+func TestSessionFlags(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	if _, err := user.Append("INBOX", strings.NewReader("Subject: Hi\r\n\r\nHi!\r\n"), &imap.AppendOptions{}); err != nil {
+		t.Fatalf("Append() = %v", err)
+	}
+	mbox, err := user.Mailbox("INBOX")
+	if err != nil {
+		t.Fatalf("Mailbox() = %v", err)
+	}
+	registry := imapserver.NewFlagRegistry(false)
+	registry.DeclareSession("$Temp")
+	mbox.SetFlagRegistry(registry)
+	mem.AddUser(user)
+
+	options := &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return mem.NewSession(), nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	}
+	connA, brA := newTestConn(t, options)
+	connB, brB := newTestConn(t, options)
+	roundTrip(t, connA, brA, "A1", "LOGIN alice secret")
+	roundTrip(t, connA, brA, "A2", "SELECT INBOX")
+	roundTrip(t, connB, brB, "B1", "LOGIN alice secret")
+	roundTrip(t, connB, brB, "B2", "SELECT INBOX")
+
+	untagged, tagged := roundTrip(t, connA, brA, "A3", "STORE 1 +FLAGS ($Temp)")
+	if !strings.HasPrefix(tagged, "A3 OK") {
+		t.Fatalf("STORE: %v", tagged)
+	}
+	if len(untagged) != 1 || !strings.Contains(strings.ToLower(untagged[0]), "$temp") {
+		t.Errorf("STORE untagged responses = %v, want FETCH with $Temp", untagged)
+	}
+
+	// Keywords unknown to the backend are rejected by the backend
+	if _, tagged := roundTrip(t, connA, brA, "A4", "STORE 1 +FLAGS ($Other)"); !strings.HasPrefix(tagged, "A4 NO") {
+		t.Errorf("STORE with unknown keyword: %v, want NO", tagged)
+	}
+
+	untagged, _ = roundTrip(t, connA, brA, "A5", "SEARCH KEYWORD $Temp")
+	if len(untagged) != 1 || untagged[0] != "* SEARCH 1" {
+		t.Errorf("SEARCH KEYWORD $Temp = %v, want 1", untagged)
+	}
+
+	// Session flags aren't visible to other sessions
+	untagged, _ = roundTrip(t, connB, brB, "B3", "FETCH 1 FLAGS")
+	for _, l := range untagged {
+		if strings.Contains(strings.ToLower(l), "$temp") {
+			t.Errorf("session flag visible to another session: %v", l)
+		}
+	}
+	untagged, _ = roundTrip(t, connB, brB, "B4", "SEARCH KEYWORD $Temp")
+	if len(untagged) != 1 || untagged[0] != "* SEARCH" {
+		t.Errorf("SEARCH KEYWORD $Temp in another session = %v, want no results", untagged)
+	}
+
+	// Updates from other sessions keep session flags
+	roundTrip(t, connB, brB, "B5", `STORE 1 +FLAGS (\Seen)`)
+	untagged, _ = roundTrip(t, connA, brA, "A6", "NOOP")
+	if len(untagged) != 1 || !strings.Contains(strings.ToLower(untagged[0]), `\seen`) || !strings.Contains(strings.ToLower(untagged[0]), "$temp") {
+		t.Errorf("NOOP untagged responses = %v, want FETCH with \\Seen and $Temp", untagged)
+	}
+}
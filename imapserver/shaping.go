@@ -0,0 +1,174 @@
+package imapserver
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket allowing bursts of up to one second worth of
+// traffic.
+type rateLimiter struct {
+	rate float64 // bytes per second
+
+	mutex  sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate int64) *rateLimiter {
+	return &rateLimiter{
+		rate:   float64(rate),
+		tokens: float64(rate),
+		last:   time.Now(),
+	}
+}
+
+// reserve consumes n bytes and returns the delay after which they can be sent.
+//
+// Reservations are served in the order they are made: a caller reserving
+// after another one waits for the previous reservation to be fulfilled. With
+// n = 0, reserve returns the delay until all previous reservations are
+// fulfilled.
+func (l *rateLimiter) reserve(now time.Time, n int) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.After(l.last) {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate {
+			l.tokens = l.rate
+		}
+		l.last = now
+	}
+
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+type userRateLimiter struct {
+	*rateLimiter
+	refs int
+}
+
+// acquireUserLimiter returns the rate limiter shared by all connections of a
+// user. It must be released with releaseUserLimiter.
+func (s *Server) acquireUserLimiter(username string) *rateLimiter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l := s.userLimiters[username]
+	if l == nil {
+		l = &userRateLimiter{rateLimiter: newRateLimiter(s.options.UserWriteRateLimit)}
+		if s.userLimiters == nil {
+			s.userLimiters = make(map[string]*userRateLimiter)
+		}
+		s.userLimiters[username] = l
+	}
+	l.refs++
+	return l.rateLimiter
+}
+
+func (s *Server) releaseUserLimiter(username string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	l := s.userLimiters[username]
+	l.refs--
+	if l.refs == 0 {
+		delete(s.userLimiters, username)
+	}
+}
+
+// shapeWriter wraps w with the write rate limits of the connection, if any.
+func (c *Conn) shapeWriter(w io.Writer) io.Writer {
+	if c.writeLimiter == nil && c.server.options.UserWriteRateLimit <= 0 {
+		return w
+	}
+	return &shapedWriter{conn: c, w: w}
+}
+
+// setAuthUser records the username of an authenticated connection, for the
+// per-user write rate limit and mailbox statistics.
+func (c *Conn) setAuthUser(username string) {
+	var l *rateLimiter
+	if c.server.options.UserWriteRateLimit > 0 {
+		l = c.server.acquireUserLimiter(username)
+	}
+
+	c.mutex.Lock()
+	c.authUser = username
+	c.userLimiter = l
+	c.mutex.Unlock()
+}
+
+func (c *Conn) releaseAuthUser() {
+	c.mutex.Lock()
+	username, l := c.authUser, c.userLimiter
+	c.userLimiter = nil
+	c.mutex.Unlock()
+
+	if l != nil {
+		c.server.releaseUserLimiter(username)
+	}
+}
+
+// waitWriteLimit blocks until the data previously sent on the connection
+// fits in its write rate limits. It must be called before locking encMutex,
+// so that other writers aren't blocked while waiting, and returns early when
+// the connection is closed.
+//
+// A response is sent in one go: the following one is delayed so that the
+// average rate doesn't exceed the limits.
+func (c *Conn) waitWriteLimit() {
+	now := time.Now()
+	var delay time.Duration
+	if c.writeLimiter != nil {
+		delay = c.writeLimiter.reserve(now, 0)
+	}
+	c.mutex.Lock()
+	userLimiter := c.userLimiter
+	c.mutex.Unlock()
+	if userLimiter != nil {
+		if d := userLimiter.reserve(now, 0); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.closed:
+	}
+}
+
+// shapedWriter charges the data written to the write rate limits of a
+// connection. It never blocks: waiting is left to waitWriteLimit.
+type shapedWriter struct {
+	conn *Conn
+	w    io.Writer
+}
+
+func (w *shapedWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+
+	now := time.Now()
+	if l := w.conn.writeLimiter; l != nil {
+		l.reserve(now, n)
+	}
+	w.conn.mutex.Lock()
+	userLimiter := w.conn.userLimiter
+	w.conn.mutex.Unlock()
+	if userLimiter != nil {
+		userLimiter.reserve(now, n)
+	}
+
+	return n, err
+}
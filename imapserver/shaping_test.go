@@ -0,0 +1,109 @@
+package imapserver
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(1000)
+	now := l.last
+
+	// The bucket starts full
+	if d := l.reserve(now, 1000); d != 0 {
+		t.Errorf("reserve(1000) = %v, want 0", d)
+	}
+	if d := l.reserve(now, 500); d != 500*time.Millisecond {
+		t.Errorf("reserve(500) = %v, want 500ms", d)
+	}
+	// Reservations are queued behind the previous one
+	if d := l.reserve(now, 500); d != time.Second {
+		t.Errorf("reserve(500) = %v, want 1s", d)
+	}
+
+	now = now.Add(time.Second)
+	if d := l.reserve(now, 0); d != 0 {
+		t.Errorf("reserve(0) after 1s = %v, want 0", d)
+	}
+
+	// Idle time doesn't accumulate more than one second worth of tokens
+	now = now.Add(time.Hour)
+	if d := l.reserve(now, 2000); d != time.Second {
+		t.Errorf("reserve(2000) after 1h = %v, want 1s", d)
+	}
+}
+
+func newShapingTestConn(t *testing.T, options *Options) *Conn {
+	server := New(options)
+	c1, c2 := net.Pipe()
+	t.Cleanup(func() {
+		c1.Close()
+		c2.Close()
+	})
+	go io.Copy(io.Discard, c2)
+	return newConn(c1, server)
+}
+
+func writeShapingTestResp(c *Conn, size int) error {
+	enc := newResponseEncoder(c)
+	defer enc.end()
+	enc.Atom("*").SP().Atom("OK").SP().Text(strings.Repeat("a", size))
+	return enc.CRLF()
+}
+
+func TestConnWriteRateLimit(t *testing.T) {
+	c := newShapingTestConn(t, &Options{WriteRateLimit: 1000})
+
+	// The bucket starts full: the first response isn't delayed, the second
+	// one waits until the first has been paid for
+	start := time.Now()
+	if err := writeShapingTestResp(c, 1200); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("first response delayed by %v", d)
+	}
+
+	// Other writers aren't blocked while a writer waits
+	waiting := make(chan error, 1)
+	go func() {
+		waiting <- writeShapingTestResp(c, 10)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if !c.encMutex.TryLock() {
+		t.Errorf("encMutex held while waiting for the rate limit")
+	} else {
+		c.encMutex.Unlock()
+	}
+
+	if err := <-waiting; err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("second response delayed by %v, want at least 150ms", d)
+	}
+}
+
+func TestConnWriteRateLimitClose(t *testing.T) {
+	c := newShapingTestConn(t, &Options{WriteRateLimit: 100})
+	if err := writeShapingTestResp(c, 1000); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		writeShapingTestResp(c, 10)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.close()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("writer still waiting after close")
+	}
+}
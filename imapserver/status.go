@@ -1,7 +1,6 @@
 package imapserver
 
 import (
-	"fmt"
 	"strings"
 
 	"github.com/emersion/go-imap/v2"
@@ -14,6 +13,7 @@ func (c *Conn) handleStatus(dec *imapwire.Decoder) error {
 	if !dec.ExpectSP() || !dec.ExpectMailbox(&mailbox) || !dec.ExpectSP() {
 		return dec.Err()
 	}
+	c.cmdMailbox = mailbox
 
 	var items []imap.StatusItem
 	recent := false
@@ -40,7 +40,10 @@ func (c *Conn) handleStatus(dec *imapwire.Decoder) error {
 		return err
 	}
 
-	data, err := c.session.Status(mailbox, items)
+	data, ok, err := c.statusFromSummary(mailbox, items)
+	if !ok {
+		data, err = c.session.Status(mailbox, items)
+	}
 	if err != nil {
 		return err
 	}
@@ -54,36 +57,7 @@ func (c *Conn) handleStatus(dec *imapwire.Decoder) error {
 func (c *Conn) writeStatus(data *imap.StatusData, items []imap.StatusItem) error {
 	enc := newResponseEncoder(c)
 	defer enc.end()
-	return enc.Atom("*").SP().Atom("STATUS").SP().Mailbox(data.Mailbox).SP().List(len(items), func(i int) {
-		item := items[i]
-		enc.Atom(string(item)).SP()
-		switch item {
-		case imap.StatusItemNumMessages:
-			enc.Number(*data.NumMessages)
-		case imap.StatusItemUIDNext:
-			enc.Number(data.UIDNext)
-		case imap.StatusItemUIDValidity:
-			enc.Number(data.UIDValidity)
-		case imap.StatusItemNumUnseen:
-			enc.Number(*data.NumUnseen)
-		case imap.StatusItemNumDeleted:
-			enc.Number(*data.NumDeleted)
-		case imap.StatusItemSize:
-			enc.Number64(*data.Size)
-		case imap.StatusItemAppendLimit:
-			if data.AppendLimit != nil {
-				enc.Number(*data.AppendLimit)
-			} else {
-				enc.NIL()
-			}
-		case imap.StatusItemDeletedStorage:
-			enc.Number64(*data.DeletedStorage)
-		case internal.StatusItemRecent:
-			enc.Number(0)
-		default:
-			panic(fmt.Errorf("imapserver: unknown STATUS item %v", item))
-		}
-	}).CRLF()
+	return enc.StatusResponse(data, items)
 }
 
 func readStatusItem(dec *imapwire.Decoder) (imap.StatusItem, error) {
@@ -0,0 +1,194 @@
+package imapserver
+
+import (
+	"sync"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// StatusTracker computes STATUS updates for mailboxes other than the selected
+// one, for a single IMAP client.
+//
+// The client must have registered interest in these updates, e.g. with the
+// NOTIFY extension: servers must not send unsolicited STATUS responses
+// otherwise.
+//
+// Only the items which have changed since the last update are sent. Pending
+// updates for the same mailbox are coalesced.
+type StatusTracker struct {
+	mutex   sync.Mutex
+	last    map[string]*imap.StatusData
+	pending map[string]*imap.StatusData
+	order   []string // mailboxes with pending updates, oldest first
+	updates chan struct{}
+}
+
+// NewStatusTracker creates a new STATUS tracker.
+func NewStatusTracker() *StatusTracker {
+	return &StatusTracker{
+		last:    make(map[string]*imap.StatusData),
+		pending: make(map[string]*imap.StatusData),
+		updates: make(chan struct{}, 1),
+	}
+}
+
+// Watch starts tracking a mailbox. The initial status is the state known by
+// the client, subsequent updates are computed relative to it.
+func (t *StatusTracker) Watch(mailbox string, initial *imap.StatusData) {
+	last := &imap.StatusData{Mailbox: mailbox}
+	if initial != nil {
+		mergeStatusData(last, initial)
+	}
+
+	t.mutex.Lock()
+	t.last[mailbox] = last
+	t.mutex.Unlock()
+}
+
+// Unwatch stops tracking a mailbox. Pending updates for the mailbox are
+// discarded.
+func (t *StatusTracker) Unwatch(mailbox string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	delete(t.last, mailbox)
+	if _, ok := t.pending[mailbox]; ok {
+		delete(t.pending, mailbox)
+		for i, name := range t.order {
+			if name == mailbox {
+				t.order = append(t.order[:i], t.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// QueueStatus queues a STATUS update for a mailbox, typically when a backend
+// event occurs.
+//
+// The data can contain any subset of the STATUS items. Updates for mailboxes
+// which aren't watched and items which haven't changed are ignored.
+func (t *StatusTracker) QueueStatus(data *imap.StatusData) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	last := t.last[data.Mailbox]
+	if last == nil {
+		return
+	}
+
+	delta := diffStatusData(last, data)
+	if delta == nil {
+		return
+	}
+	mergeStatusData(last, delta)
+
+	if pending := t.pending[data.Mailbox]; pending != nil {
+		mergeStatusData(pending, delta)
+	} else {
+		t.pending[data.Mailbox] = delta
+		t.order = append(t.order, data.Mailbox)
+	}
+
+	select {
+	case t.updates <- struct{}{}:
+	default:
+		// an update is already signalled
+	}
+}
+
+// Updates returns a channel which receives a value when updates are pending.
+//
+// This can be used by SessionIMAP4rev2.Idle implementations to wait for
+// updates.
+func (t *StatusTracker) Updates() <-chan struct{} {
+	return t.updates
+}
+
+// Poll writes pending STATUS updates.
+func (t *StatusTracker) Poll(w *UpdateWriter) error {
+	t.mutex.Lock()
+	pending := make([]*imap.StatusData, len(t.order))
+	for i, mailbox := range t.order {
+		pending[i] = t.pending[mailbox]
+	}
+	t.pending = make(map[string]*imap.StatusData)
+	t.order = nil
+	t.mutex.Unlock()
+
+	for _, data := range pending {
+		if err := w.WriteMailboxStatus(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// diffStatusData returns the items of cur which differ from prev, or nil if
+// there are none.
+func diffStatusData(prev, cur *imap.StatusData) *imap.StatusData {
+	delta := imap.StatusData{Mailbox: cur.Mailbox}
+	changed := false
+	diffUint32 := func(dst **uint32, prev, cur *uint32) {
+		if cur != nil && (prev == nil || *prev != *cur) {
+			v := *cur
+			*dst = &v
+			changed = true
+		}
+	}
+	diffInt64 := func(dst **int64, prev, cur *int64) {
+		if cur != nil && (prev == nil || *prev != *cur) {
+			v := *cur
+			*dst = &v
+			changed = true
+		}
+	}
+
+	diffUint32(&delta.NumMessages, prev.NumMessages, cur.NumMessages)
+	diffUint32(&delta.NumUnseen, prev.NumUnseen, cur.NumUnseen)
+	diffUint32(&delta.NumDeleted, prev.NumDeleted, cur.NumDeleted)
+	diffUint32(&delta.AppendLimit, prev.AppendLimit, cur.AppendLimit)
+	diffInt64(&delta.Size, prev.Size, cur.Size)
+	diffInt64(&delta.DeletedStorage, prev.DeletedStorage, cur.DeletedStorage)
+	if cur.UIDNext != 0 && cur.UIDNext != prev.UIDNext {
+		delta.UIDNext = cur.UIDNext
+		changed = true
+	}
+	if cur.UIDValidity != 0 && cur.UIDValidity != prev.UIDValidity {
+		delta.UIDValidity = cur.UIDValidity
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return &delta
+}
+
+// mergeStatusData copies the items set in src to dst.
+func mergeStatusData(dst, src *imap.StatusData) {
+	if src.NumMessages != nil {
+		dst.NumMessages = src.NumMessages
+	}
+	if src.UIDNext != 0 {
+		dst.UIDNext = src.UIDNext
+	}
+	if src.UIDValidity != 0 {
+		dst.UIDValidity = src.UIDValidity
+	}
+	if src.NumUnseen != nil {
+		dst.NumUnseen = src.NumUnseen
+	}
+	if src.NumDeleted != nil {
+		dst.NumDeleted = src.NumDeleted
+	}
+	if src.Size != nil {
+		dst.Size = src.Size
+	}
+	if src.AppendLimit != nil {
+		dst.AppendLimit = src.AppendLimit
+	}
+	if src.DeletedStorage != nil {
+		dst.DeletedStorage = src.DeletedStorage
+	}
+}
@@ -0,0 +1,56 @@
+package imapserver
+
+import (
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestStatusTracker(t *testing.T) {
+	uint32Ptr := func(v uint32) *uint32 { return &v }
+
+	tracker := NewStatusTracker()
+	tracker.Watch("INBOX", &imap.StatusData{
+		NumMessages: uint32Ptr(10),
+		NumUnseen:   uint32Ptr(2),
+		UIDNext:     11,
+	})
+
+	// Unchanged items and unwatched mailboxes are ignored
+	tracker.QueueStatus(&imap.StatusData{Mailbox: "INBOX", NumMessages: uint32Ptr(10)})
+	tracker.QueueStatus(&imap.StatusData{Mailbox: "Archive", NumMessages: uint32Ptr(1)})
+	if n := len(tracker.order); n != 0 {
+		t.Fatalf("got %v pending updates, want 0", n)
+	}
+
+	tracker.QueueStatus(&imap.StatusData{Mailbox: "INBOX", NumMessages: uint32Ptr(11), NumUnseen: uint32Ptr(2), UIDNext: 12})
+	tracker.QueueStatus(&imap.StatusData{Mailbox: "INBOX", NumMessages: uint32Ptr(12), NumUnseen: uint32Ptr(3), UIDNext: 13})
+	if n := len(tracker.order); n != 1 {
+		t.Fatalf("got %v pending updates, want 1", n)
+	}
+
+	pending := tracker.pending["INBOX"]
+	if pending.NumMessages == nil || *pending.NumMessages != 12 {
+		t.Errorf("NumMessages = %v, want 12", pending.NumMessages)
+	}
+	if pending.NumUnseen == nil || *pending.NumUnseen != 3 {
+		t.Errorf("NumUnseen = %v, want 3", pending.NumUnseen)
+	}
+	if pending.UIDNext != 13 {
+		t.Errorf("UIDNext = %v, want 13", pending.UIDNext)
+	}
+	if pending.UIDValidity != 0 {
+		t.Errorf("UIDValidity = %v, want 0", pending.UIDValidity)
+	}
+
+	select {
+	case <-tracker.Updates():
+	default:
+		t.Errorf("Updates() not signalled")
+	}
+
+	tracker.Unwatch("INBOX")
+	if n := len(tracker.order); n != 0 {
+		t.Errorf("got %v pending updates after Unwatch, want 0", n)
+	}
+}
@@ -67,6 +67,12 @@ func (c *Conn) handleStore(dec *imapwire.Decoder, numKind NumKind) error {
 	if err := c.checkState(imap.ConnStateSelected); err != nil {
 		return err
 	}
+	if err := c.openDeferredMailbox(); err != nil {
+		return err
+	}
+	if err := c.checkWritable(); err != nil {
+		return err
+	}
 
 	w := &FetchWriter{conn: c}
 	return c.session.Store(w, numKind, seqSet, &imap.StoreFlags{
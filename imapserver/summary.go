@@ -0,0 +1,142 @@
+package imapserver
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// SessionMailboxSummary is an IMAP session which can cheaply retrieve a
+// summary of a mailbox, without opening it.
+//
+// When implemented, SELECT and EXAMINE reply with the summary and opening the
+// mailbox with Select is deferred until a command needs it. Clients which
+// select mailboxes one after the other to check for new messages never cause
+// a full mailbox load. STATUS commands only requesting MESSAGES, UIDNEXT and
+// UIDVALIDITY are also answered from the summary.
+type SessionMailboxSummary interface {
+	Session
+
+	// Authenticated state
+
+	// MailboxSummary returns the data which would be returned by Select.
+	// The summary must be consistent with the state of the mailbox when it's
+	// opened later on: messages may have been added in-between, but not
+	// expunged.
+	MailboxSummary(mailbox string) (*imap.SelectData, error)
+}
+
+// deferredSelect is a mailbox which has been selected from its summary, but
+// not opened yet.
+type deferredSelect struct {
+	mailbox string
+	options SelectOptions
+	summary *imap.SelectData
+}
+
+// openDeferredMailbox opens the selected mailbox, if its opening has been
+// deferred. Commands operating on the selected mailbox need to call it after
+// checking the connection state.
+//
+// If the mailbox can't be opened or has changed since its summary was sent,
+// the mailbox is closed, see closeStaleMailbox.
+func (c *Conn) openDeferredMailbox() error {
+	deferred := c.deferredSelect
+	if deferred == nil {
+		return nil
+	}
+	c.deferredSelect = nil
+
+	data, err := c.session.Select(deferred.mailbox, &deferred.options)
+	if err != nil {
+		return c.closeStaleMailbox(err)
+	}
+
+	if data.UIDValidity != deferred.summary.UIDValidity || data.NumMessages < deferred.summary.NumMessages {
+		if err := c.session.Unselect(); err != nil {
+			return err
+		}
+		return c.closeStaleMailbox(&imap.Error{
+			Type: imap.StatusResponseTypeNo,
+			Text: "Mailbox has changed, please select it again",
+		})
+	}
+
+	if data.NumMessages > deferred.summary.NumMessages {
+		return c.writeExists(data.NumMessages)
+	}
+	return nil
+}
+
+// closeStaleMailbox returns to the authenticated state after a deferred
+// mailbox couldn't be opened, and returns the error to send in the tagged
+// response.
+//
+// The client must learn about the state change: IMAP4rev2 clients are sent an
+// untagged OK response with the CLOSED response code. IMAP4rev1 clients have
+// no way to notice it, so the connection is closed with a BYE response.
+func (c *Conn) closeStaleMailbox(err error) error {
+	c.state = imap.ConnStateAuthenticated
+	c.readOnly = false
+
+	text := "Mailbox has changed, please select it again"
+	var imapErr *imap.Error
+	if errors.As(err, &imapErr) && imapErr.Text != "" {
+		text = imapErr.Text
+	}
+
+	resp := &imap.StatusResponse{
+		Type: imap.StatusResponseTypeOK,
+		Code: imap.ResponseCodeClosed,
+		Text: text,
+	}
+	if !c.closedEnabled() {
+		c.state = imap.ConnStateLogout
+		resp = &imap.StatusResponse{
+			Type: imap.StatusResponseTypeBye,
+			Text: text,
+		}
+	}
+	if err := c.writeStatusResp("", resp); err != nil {
+		return err
+	}
+	return err
+}
+
+// statusFromSummary returns STATUS data built from a mailbox summary, if all
+// of the requested items are part of it.
+func (c *Conn) statusFromSummary(mailbox string, items []imap.StatusItem) (*imap.StatusData, bool, error) {
+	sess, ok := c.session.(SessionMailboxSummary)
+	if !ok {
+		return nil, false, nil
+	}
+	for _, item := range items {
+		switch item {
+		case imap.StatusItemNumMessages, imap.StatusItemUIDNext, imap.StatusItemUIDValidity:
+			// part of the summary
+		default:
+			return nil, false, nil
+		}
+	}
+
+	summary, err := sess.MailboxSummary(mailbox)
+	if err != nil {
+		return nil, true, err
+	}
+
+	data := &imap.StatusData{Mailbox: mailbox}
+	for _, item := range items {
+		switch item {
+		case imap.StatusItemNumMessages:
+			num := summary.NumMessages
+			data.NumMessages = &num
+		case imap.StatusItemUIDNext:
+			data.UIDNext = summary.UIDNext
+		case imap.StatusItemUIDValidity:
+			data.UIDValidity = summary.UIDValidity
+		}
+	}
+	num := summary.NumRecent
+	data.NumRecent = &num
+	return data, true, nil
+}
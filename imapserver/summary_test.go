@@ -0,0 +1,81 @@
+package imapserver_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// staleSummarySession returns summaries which don't match the mailboxes
+type staleSummarySession struct {
+	imapserver.SessionIMAP4rev2
+}
+
+func (s *staleSummarySession) MailboxSummary(mailbox string) (*imap.SelectData, error) {
+	return &imap.SelectData{UIDValidity: 42, UIDNext: 1}, nil
+}
+
+func newSummaryTestConn(t *testing.T, caps imap.CapSet) (net.Conn, *bufio.Reader) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	if err := user.Create("INBOX"); err != nil {
+		t.Fatalf("Create() = %v", err)
+	}
+	mem.AddUser(user)
+
+	return newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return &staleSummarySession{mem.NewSession().(imapserver.SessionIMAP4rev2)}, nil
+		},
+		Caps:         caps,
+		InsecureAuth: true,
+	})
+}
+
+func TestMailboxSummaryChanged(t *testing.T) {
+	conn, br := newSummaryTestConn(t, imap.CapSet{imap.CapIMAP4rev1: {}, imap.CapIMAP4rev2: {}})
+
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	roundTrip(t, conn, br, "A2", "ENABLE IMAP4rev2")
+	if _, tagged := roundTrip(t, conn, br, "A3", "SELECT INBOX"); !strings.HasPrefix(tagged, "A3 OK") {
+		t.Fatalf("SELECT: %v", tagged)
+	}
+
+	untagged, tagged := roundTrip(t, conn, br, "A4", "FETCH 1:* FLAGS")
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* OK [CLOSED]") {
+		t.Errorf("FETCH untagged responses = %v, want OK [CLOSED]", untagged)
+	}
+	if !strings.HasPrefix(tagged, "A4 NO") {
+		t.Errorf("FETCH tagged response = %v, want NO", tagged)
+	}
+
+	// The connection is back to the authenticated state
+	if _, tagged := roundTrip(t, conn, br, "A5", "FETCH 1:* FLAGS"); !strings.HasPrefix(tagged, "A5 BAD") {
+		t.Errorf("FETCH after CLOSED: %v, want BAD", tagged)
+	}
+}
+
+func TestMailboxSummaryChangedIMAP4rev1(t *testing.T) {
+	conn, br := newSummaryTestConn(t, imap.CapSet{imap.CapIMAP4rev1: {}})
+
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	roundTrip(t, conn, br, "A2", "SELECT INBOX")
+
+	// IMAP4rev1 clients don't support CLOSED: the connection is closed
+	untagged, tagged := roundTrip(t, conn, br, "A3", "FETCH 1:* FLAGS")
+	if len(untagged) != 1 || !strings.HasPrefix(untagged[0], "* BYE") {
+		t.Errorf("FETCH untagged responses = %v, want BYE", untagged)
+	}
+	if !strings.HasPrefix(tagged, "A3 NO") {
+		t.Errorf("FETCH tagged response = %v, want NO", tagged)
+	}
+	if _, err := br.ReadString('\n'); err != io.EOF {
+		t.Errorf("connection not closed after BYE: %v", err)
+	}
+}
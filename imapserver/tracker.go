@@ -49,6 +49,10 @@ func (t *MailboxTracker) queueUpdate(update *trackerUpdate, source *SessionTrack
 		panic(fmt.Errorf("imapserver: cannot decrease mailbox number of messages from %v to %v", t.numMessages, update.numMessages))
 	}
 
+	if update.numMessages != 0 {
+		update.prevNumMessages = t.numMessages
+	}
+
 	for st := range t.sessions {
 		if source != nil && st == source {
 			continue
@@ -74,7 +78,6 @@ func (t *MailboxTracker) QueueExpunge(seqNum uint32) {
 
 // QueueNumMessages queues a new EXISTS update.
 func (t *MailboxTracker) QueueNumMessages(n uint32) {
-	// TODO: merge consecutive NumMessages updates
 	t.queueUpdate(&trackerUpdate{numMessages: n}, nil)
 }
 
@@ -86,6 +89,23 @@ func (t *MailboxTracker) QueueMailboxFlags(flags []imap.Flag) {
 	t.queueUpdate(&trackerUpdate{mailboxFlags: flags}, nil)
 }
 
+// QueueMailboxDeleted notifies sessions that the mailbox has been deleted.
+//
+// Sessions with the mailbox selected are disconnected with a BYE response on
+// their next poll. The session which deleted the mailbox is not affected,
+// since the server closes its selected mailbox before polling.
+func (t *MailboxTracker) QueueMailboxDeleted() {
+	t.queueUpdate(&trackerUpdate{deleted: true}, nil)
+}
+
+// QueueMailboxRenamed notifies sessions that the mailbox has been renamed.
+//
+// Sessions keep the mailbox selected under its new name, and are sent an
+// untagged OK response.
+func (t *MailboxTracker) QueueMailboxRenamed(newName string) {
+	t.queueUpdate(&trackerUpdate{renamed: newName}, nil)
+}
+
 // QueueMessageFlags queues a new FETCH FLAGS update.
 //
 // If source is not nil, the update won't be dispatched to it.
@@ -102,6 +122,10 @@ type trackerUpdate struct {
 	numMessages  uint32
 	mailboxFlags []imap.Flag
 	fetch        *trackerUpdateFetch
+	deleted      bool
+	renamed      string
+
+	prevNumMessages uint32 // only for numMessages updates
 }
 
 type trackerUpdateFetch struct {
@@ -110,13 +134,50 @@ type trackerUpdateFetch struct {
 	flags  []imap.Flag
 }
 
+// sessionTrackerQueueLimit is the maximum number of pending updates for a
+// single session, after redundant updates have been coalesced.
+const sessionTrackerQueueLimit = 4096
+
+// errSessionTrackerOverflow is returned by SessionTracker.Poll when the
+// client has not consumed updates for too long.
+var errSessionTrackerOverflow = &imap.Error{
+	Type: imap.StatusResponseTypeBye,
+	Code: imap.ResponseCodeLimit,
+	Text: "Too many pending mailbox updates",
+}
+
+// errSessionTrackerDeleted is returned by SessionTracker.Poll when the
+// mailbox has been deleted by another session.
+var errSessionTrackerDeleted = &imap.Error{
+	Type: imap.StatusResponseTypeBye,
+	Code: imap.ResponseCodeNonExistent,
+	Text: "Selected mailbox has been deleted",
+}
+
 // SessionTracker tracks the state of a mailbox for an IMAP client.
+//
+// Redundant pending updates are coalesced. If too many updates are pending,
+// the session is considered out of sync: Poll returns an error with a BYE
+// status response and the connection is closed.
 type SessionTracker struct {
 	mailbox *MailboxTracker
 
-	mutex   sync.Mutex
-	queue   []trackerUpdate
-	updates chan<- struct{}
+	mutex        sync.Mutex
+	queue        []trackerUpdate
+	overflow     bool
+	deleted      bool
+	updates      chan<- struct{}
+	messageFlags func(uid uint32, flags []imap.Flag) []imap.Flag
+}
+
+// SetMessageFlags sets a function called with the flags of FETCH FLAGS
+// updates before they are written, and returning the flags to send. This
+// can be used to add flags only visible to this session, e.g. session-only
+// keywords.
+func (t *SessionTracker) SetMessageFlags(f func(uid uint32, flags []imap.Flag) []imap.Flag) {
+	t.mutex.Lock()
+	t.messageFlags = f
+	t.mutex.Unlock()
 }
 
 // Close unregisters the session.
@@ -130,7 +191,16 @@ func (t *SessionTracker) Close() {
 func (t *SessionTracker) queueUpdate(update *trackerUpdate) {
 	var updates chan<- struct{}
 	t.mutex.Lock()
-	t.queue = append(t.queue, *update)
+	if update.deleted {
+		t.deleted = true
+		t.queue = nil
+	} else if !t.overflow && !t.deleted && !t.coalesceLocked(update) {
+		t.queue = append(t.queue, *update)
+		if len(t.queue) > sessionTrackerQueueLimit {
+			t.overflow = true
+			t.queue = nil
+		}
+	}
 	updates = t.updates
 	t.mutex.Unlock()
 
@@ -144,10 +214,52 @@ func (t *SessionTracker) queueUpdate(update *trackerUpdate) {
 	}
 }
 
+// coalesceLocked tries to merge an update into the pending queue. It returns
+// false if the update needs to be appended.
+func (t *SessionTracker) coalesceLocked(update *trackerUpdate) bool {
+	if len(t.queue) == 0 {
+		return false
+	}
+	last := &t.queue[len(t.queue)-1]
+
+	switch {
+	case update.numMessages != 0:
+		if last.numMessages != 0 {
+			last.numMessages = update.numMessages
+			return true
+		}
+	case update.mailboxFlags != nil:
+		if last.mailboxFlags != nil {
+			last.mailboxFlags = update.mailboxFlags
+			return true
+		}
+	case update.fetch != nil:
+		// Sequence numbers are stable until the next expunge
+		for i := len(t.queue) - 1; i >= 0; i-- {
+			pending := &t.queue[i]
+			if pending.expunge != 0 {
+				break
+			}
+			if pending.fetch != nil && pending.fetch.seqNum == update.fetch.seqNum {
+				pending.fetch = update.fetch
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // Poll dequeues pending mailbox updates for this session.
 func (t *SessionTracker) Poll(w *UpdateWriter, allowExpunge bool) error {
 	var updates []trackerUpdate
 	t.mutex.Lock()
+	if t.overflow {
+		t.mutex.Unlock()
+		return errSessionTrackerOverflow
+	} else if t.deleted {
+		t.mutex.Unlock()
+		return errSessionTrackerDeleted
+	}
 	if allowExpunge {
 		updates = t.queue
 		t.queue = nil
@@ -166,6 +278,7 @@ func (t *SessionTracker) Poll(w *UpdateWriter, allowExpunge bool) error {
 			t.queue = nil
 		}
 	}
+	messageFlags := t.messageFlags
 	t.mutex.Unlock()
 
 	for _, update := range updates {
@@ -178,7 +291,13 @@ func (t *SessionTracker) Poll(w *UpdateWriter, allowExpunge bool) error {
 		case update.mailboxFlags != nil:
 			err = w.WriteMailboxFlags(update.mailboxFlags)
 		case update.fetch != nil:
-			err = w.WriteMessageFlags(update.fetch.seqNum, update.fetch.uid, update.fetch.flags)
+			flags := update.fetch.flags
+			if messageFlags != nil {
+				flags = messageFlags(update.fetch.uid, flags)
+			}
+			err = w.WriteMessageFlags(update.fetch.seqNum, update.fetch.uid, flags)
+		case update.renamed != "":
+			err = w.writeMailboxRenamed(update.renamed)
 		default:
 			panic(fmt.Errorf("imapserver: unknown tracker update %#v", update))
 		}
@@ -200,6 +319,10 @@ func (t *SessionTracker) Idle(w *UpdateWriter, stop <-chan struct{}) error {
 	ok := t.updates == nil
 	if ok {
 		t.updates = updates
+		// Updates may have been queued since the last poll
+		if len(t.queue) > 0 {
+			updates <- struct{}{}
+		}
 	}
 	t.mutex.Unlock()
 	if !ok {
@@ -272,8 +395,7 @@ func (t *SessionTracker) EncodeSeqNum(seqNum uint32) uint32 {
 
 	for i := len(t.queue) - 1; i >= 0; i-- {
 		update := t.queue[i]
-		// TODO: this doesn't handle increments > 1
-		if update.numMessages != 0 && seqNum == update.numMessages {
+		if update.numMessages != 0 && seqNum > update.prevNumMessages {
 			return 0
 		}
 		if update.expunge != 0 && seqNum >= update.expunge {
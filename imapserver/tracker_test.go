@@ -1,8 +1,10 @@
 package imapserver_test
 
 import (
+	"errors"
 	"testing"
 
+	"github.com/emersion/go-imap/v2"
 	"github.com/emersion/go-imap/v2/imapserver"
 )
 
@@ -106,6 +108,24 @@ var sessionTrackerSeqNumTests = []struct {
 		clientSeqNum: 0,
 		serverSeqNum: 42,
 	},
+	{
+		name: "multi_append",
+		pending: []trackerUpdate{
+			{numMessages: 43},
+			{numMessages: 44},
+		},
+		clientSeqNum: 0,
+		serverSeqNum: 43,
+	},
+	{
+		name: "multi_append_last",
+		pending: []trackerUpdate{
+			{numMessages: 43},
+			{numMessages: 44},
+		},
+		clientSeqNum: 0,
+		serverSeqNum: 44,
+	},
 	{
 		name: "multi_expunge_middle",
 		pending: []trackerUpdate{
@@ -153,3 +173,32 @@ func TestSessionTracker(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionTracker_overflow(t *testing.T) {
+	mboxTracker := imapserver.NewMailboxTracker(100000)
+	sessTracker := mboxTracker.NewSession()
+	defer sessTracker.Close()
+
+	for i := uint32(1); i < 10000; i++ {
+		mboxTracker.QueueExpunge(1)
+	}
+	err := sessTracker.Poll(&imapserver.UpdateWriter{}, true)
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBye {
+		t.Errorf("Poll() = %v, want BYE error", err)
+	}
+}
+
+func TestSessionTracker_deleted(t *testing.T) {
+	mboxTracker := imapserver.NewMailboxTracker(10)
+	sessTracker := mboxTracker.NewSession()
+	defer sessTracker.Close()
+
+	mboxTracker.QueueNumMessages(11)
+	mboxTracker.QueueMailboxDeleted()
+	err := sessTracker.Poll(&imapserver.UpdateWriter{}, true)
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Type != imap.StatusResponseTypeBye {
+		t.Errorf("Poll() = %v, want BYE error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package imapserver
+
+import (
+	"errors"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// autoCreate creates the destination mailbox of a COPY, MOVE or APPEND
+// command if it doesn't exist and the server is configured to do so.
+func (c *Conn) autoCreate(mailbox string) error {
+	if c.server.options.AutoCreateMailbox == nil {
+		return nil
+	}
+
+	data, err := c.lookupMailbox(mailbox)
+	if err != nil {
+		return err
+	}
+	if data != nil && !hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+		return nil
+	}
+
+	if !c.server.options.AutoCreateMailbox(c, mailbox) {
+		return nil
+	}
+	return c.session.Create(mailbox)
+}
+
+// tryCreateError replaces the NONEXISTENT response code with TRYCREATE in
+// errors returned by COPY, MOVE and APPEND, so that clients know they can
+// create the destination mailbox and retry.
+//
+// The code is only replaced if the destination mailbox doesn't exist: the
+// error may be about something else, e.g. the source messages.
+func (c *Conn) tryCreateError(err error, dest string) error {
+	err = mapBackendError(err)
+	var imapErr *imap.Error
+	if !errors.As(err, &imapErr) || imapErr.Code != imap.ResponseCodeNonExistent {
+		return err
+	}
+	if data, lookupErr := c.lookupMailbox(dest); lookupErr != nil {
+		return err
+	} else if data != nil && !hasMailboxAttr(data.Attrs, imap.MailboxAttrNonExistent) {
+		return err
+	}
+	resp := *imapErr
+	resp.Code = imap.ResponseCodeTryCreate
+	return &resp
+}
+
+func hasMailboxAttr(attrs []imap.MailboxAttr, attr imap.MailboxAttr) bool {
+	for _, a := range attrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package imapserver_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/imapserver"
+	"github.com/emersion/go-imap/v2/imapserver/imapmemserver"
+)
+
+// missingSourceSession fails COPY as if the source messages didn't exist
+type missingSourceSession struct {
+	imapserver.SessionIMAP4rev2
+}
+
+func (s *missingSourceSession) Copy(kind imapserver.NumKind, seqSet imap.SeqSet, dest string) (*imap.CopyData, error) {
+	return nil, fmt.Errorf("message %v: %w", seqSet, imapserver.ErrNotFound)
+}
+
+func TestCopyTryCreate(t *testing.T) {
+	mem := imapmemserver.New()
+	user := imapmemserver.NewUser("alice", "secret")
+	for _, name := range []string{"INBOX", "Archive"} {
+		if err := user.Create(name); err != nil {
+			t.Fatalf("Create(%q) = %v", name, err)
+		}
+	}
+	mem.AddUser(user)
+
+	conn, br := newTestConn(t, &imapserver.Options{
+		NewSession: func(*imapserver.Conn) (imapserver.Session, error) {
+			return &missingSourceSession{mem.NewSession().(imapserver.SessionIMAP4rev2)}, nil
+		},
+		Caps:         imap.CapSet{imap.CapIMAP4rev1: {}},
+		InsecureAuth: true,
+	})
+
+	roundTrip(t, conn, br, "A1", "LOGIN alice secret")
+	roundTrip(t, conn, br, "A2", "SELECT INBOX")
+
+	if _, tagged := roundTrip(t, conn, br, "A3", "COPY 1 Missing"); !strings.HasPrefix(tagged, "A3 NO [TRYCREATE]") {
+		t.Errorf("COPY to a missing mailbox: %v, want NO [TRYCREATE]", tagged)
+	}
+	if _, tagged := roundTrip(t, conn, br, "A4", "COPY 1 Archive"); !strings.HasPrefix(tagged, "A4 NO [NONEXISTENT]") {
+		t.Errorf("COPY of missing messages: %v, want NO [NONEXISTENT]", tagged)
+	}
+}
@@ -0,0 +1,361 @@
+package imapserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// UIDMapState is the persisted state of a mailbox in a UIDMap.
+type UIDMapState struct {
+	UIDValidity uint32 `json:"uidValidity"`
+	UIDNext     uint32 `json:"uidNext"`
+	// Opaque token describing the source numbering, see UIDMap.Sync
+	Generation string `json:"generation,omitempty"`
+	// UIDs of the messages, indexed by source ID
+	UIDs map[string]uint32 `json:"uids,omitempty"`
+}
+
+// UIDMapStore persists the state of a UIDMap.
+type UIDMapStore interface {
+	// Load returns the state of a mailbox, or nil if there is none.
+	Load(mailbox string) (*UIDMapState, error)
+	// Save replaces the state of a mailbox. It must not return before the
+	// state has been persisted.
+	Save(mailbox string, state *UIDMapState) error
+	// Delete removes the state of a mailbox. It's not an error if there is
+	// none.
+	Delete(mailbox string) error
+}
+
+// UIDMapEntry associates a source ID with a UID.
+type UIDMapEntry struct {
+	ID  string
+	UID uint32
+}
+
+// UIDMapSnapshot is the state of a mailbox returned by UIDMap.Sync.
+type UIDMapSnapshot struct {
+	UIDValidity uint32
+	UIDNext     uint32
+	// Messages sorted by UID
+	Entries []UIDMapEntry
+	// UIDs of the messages which have been removed since the previous
+	// synchronization. Sessions need to send EXPUNGE or VANISHED responses
+	// for these.
+	Removed imap.UIDSet
+	// Renumbered is true if UIDVALIDITY has changed: all previous UIDs are
+	// invalid. Clients with a selected mailbox need to be disconnected.
+	Renumbered bool
+}
+
+// UID returns the UID of a source ID.
+func (snapshot *UIDMapSnapshot) UID(id string) (uint32, bool) {
+	for _, entry := range snapshot.Entries {
+		if entry.ID == id {
+			return entry.UID, true
+		}
+	}
+	return 0, false
+}
+
+// ID returns the source ID of a UID.
+func (snapshot *UIDMapSnapshot) ID(uid uint32) (string, bool) {
+	i := sort.Search(len(snapshot.Entries), func(i int) bool {
+		return snapshot.Entries[i].UID >= uid
+	})
+	if i < len(snapshot.Entries) && snapshot.Entries[i].UID == uid {
+		return snapshot.Entries[i].ID, true
+	}
+	return "", false
+}
+
+// UIDMap assigns UIDs and UIDVALIDITY values to messages, for backends whose
+// storage doesn't provide stable numeric identifiers, e.g. REST APIs or object
+// stores. The backend identifies messages with opaque source IDs, and the map
+// persists the UIDs in a UIDMapStore.
+//
+// The rules of RFC 9051 section 2.3.1.1 are followed: UIDs are strictly
+// ascending in the order messages are added to the mailbox, and aren't reused.
+// A message which disappears from the source and comes back later gets a new
+// UID. If the UIDs can't be preserved, UIDVALIDITY is changed to a greater
+// value and the messages are renumbered:
+//
+//   - when the source generation changes, see Sync;
+//   - when the UIDs are exhausted;
+//   - when a mailbox is deleted and created again.
+//
+// A UIDMap is safe for concurrent use.
+type UIDMap struct {
+	store UIDMapStore
+	now   func() time.Time
+
+	mutex        sync.Mutex
+	states       map[string]*UIDMapState
+	lastValidity uint32
+}
+
+// NewUIDMap creates a new UID map.
+func NewUIDMap(store UIDMapStore) *UIDMap {
+	return &UIDMap{
+		store:  store,
+		now:    time.Now,
+		states: make(map[string]*UIDMapState),
+	}
+}
+
+func (m *UIDMap) load(mailbox string) (*UIDMapState, error) {
+	if state, ok := m.states[mailbox]; ok {
+		return state, nil
+	}
+	state, err := m.store.Load(mailbox)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		if state.UIDs == nil {
+			state.UIDs = make(map[string]uint32)
+		}
+		m.states[mailbox] = state
+	}
+	return state, nil
+}
+
+// nextUIDValidity returns the next UIDVALIDITY value, greater than prev.
+//
+// The current time is used so that values keep growing if the state of a
+// mailbox is lost.
+func (m *UIDMap) nextUIDValidity(prev uint32) uint32 {
+	v := uint32(m.now().Unix())
+	if v <= prev {
+		v = prev + 1
+	}
+	if v <= m.lastValidity {
+		v = m.lastValidity + 1
+	}
+	return v
+}
+
+// newUIDValidity allocates a new UIDVALIDITY value, greater than prev.
+func (m *UIDMap) newUIDValidity(prev uint32) uint32 {
+	v := m.nextUIDValidity(prev)
+	m.lastValidity = v
+	return v
+}
+
+// Sync reconciles the map of a mailbox with the messages currently in the
+// source, and returns the resulting UIDs.
+//
+// ids lists the source IDs of the messages. UIDs are assigned to new messages
+// in the order of the list. Messages of the map missing from the list are
+// removed.
+//
+// generation is an opaque token describing the source numbering, such as the
+// ID of a folder in a REST API. If it differs from the one of the previous
+// synchronization, source IDs can't be trusted to refer to the same messages:
+// the mailbox is renumbered.
+func (m *UIDMap) Sync(mailbox, generation string, ids []string) (*UIDMapSnapshot, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, snapshot, err := m.reconcileLocked(mailbox, generation, ids, m.newUIDValidity)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.store.Save(mailbox, state); err != nil {
+		return nil, err
+	}
+	m.states[mailbox] = state
+	return snapshot, nil
+}
+
+// Peek returns the snapshot Sync would return, without modifying the map. It
+// can be used to implement STATUS without consuming the changes a session
+// with the mailbox selected needs to report.
+//
+// If the mailbox needs to be renumbered, the UIDVALIDITY value of the
+// snapshot may be lower than the one assigned by the next Sync call.
+func (m *UIDMap) Peek(mailbox, generation string, ids []string) (*UIDMapSnapshot, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	_, snapshot, err := m.reconcileLocked(mailbox, generation, ids, m.nextUIDValidity)
+	return snapshot, err
+}
+
+// reconcileLocked computes the new state of a mailbox, see Sync. The map
+// isn't modified, except by newValidity.
+func (m *UIDMap) reconcileLocked(mailbox, generation string, ids []string, newValidity func(prev uint32) uint32) (*UIDMapState, *UIDMapSnapshot, error) {
+	seen := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, dup := seen[id]; dup {
+			return nil, nil, fmt.Errorf("imapserver: duplicate source ID %q in mailbox %q", id, mailbox)
+		}
+		seen[id] = struct{}{}
+	}
+
+	prev, err := m.load(mailbox)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var added int
+	if prev != nil && prev.Generation == generation {
+		for _, id := range ids {
+			if _, ok := prev.UIDs[id]; !ok {
+				added++
+			}
+		}
+	}
+
+	snapshot := new(UIDMapSnapshot)
+	state := &UIDMapState{
+		Generation: generation,
+		UIDs:       make(map[string]uint32, len(ids)),
+	}
+	if prev != nil && prev.Generation == generation && uint64(prev.UIDNext)+uint64(added) <= math.MaxUint32 {
+		state.UIDValidity = prev.UIDValidity
+		state.UIDNext = prev.UIDNext
+		for id, uid := range prev.UIDs {
+			if _, ok := seen[id]; ok {
+				state.UIDs[id] = uid
+			} else {
+				snapshot.Removed.AddNum(uid)
+			}
+		}
+	} else {
+		var prevValidity uint32
+		if prev != nil {
+			prevValidity = prev.UIDValidity
+			snapshot.Renumbered = true
+		}
+		state.UIDValidity = newValidity(prevValidity)
+		state.UIDNext = 1
+	}
+
+	for _, id := range ids {
+		if _, ok := state.UIDs[id]; !ok {
+			state.UIDs[id] = state.UIDNext
+			state.UIDNext++
+		}
+	}
+
+	snapshot.UIDValidity = state.UIDValidity
+	snapshot.UIDNext = state.UIDNext
+	snapshot.Entries = make([]UIDMapEntry, 0, len(state.UIDs))
+	for id, uid := range state.UIDs {
+		snapshot.Entries = append(snapshot.Entries, UIDMapEntry{ID: id, UID: uid})
+	}
+	sort.Slice(snapshot.Entries, func(i, j int) bool {
+		return snapshot.Entries[i].UID < snapshot.Entries[j].UID
+	})
+	return state, snapshot, nil
+}
+
+// Rename moves the map of a mailbox. UIDs are preserved.
+func (m *UIDMap) Rename(oldName, newName string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, err := m.load(oldName)
+	if err != nil {
+		return err
+	} else if state == nil {
+		return nil
+	}
+	if err := m.store.Save(newName, state); err != nil {
+		return err
+	}
+	m.states[newName] = state
+	delete(m.states, oldName)
+	return m.store.Delete(oldName)
+}
+
+// Delete removes the map of a mailbox. A mailbox created later with the same
+// name gets a new UIDVALIDITY.
+func (m *UIDMap) Delete(mailbox string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, err := m.load(mailbox)
+	if err != nil {
+		return err
+	}
+	if state != nil && state.UIDValidity > m.lastValidity {
+		m.lastValidity = state.UIDValidity
+	}
+	delete(m.states, mailbox)
+	return m.store.Delete(mailbox)
+}
+
+// UIDMapFileStore is a UIDMapStore saving each mailbox in a JSON file.
+type UIDMapFileStore struct {
+	// Directory containing the files
+	Dir string
+}
+
+var _ UIDMapStore = (*UIDMapFileStore)(nil)
+
+func (store *UIDMapFileStore) path(mailbox string) string {
+	return filepath.Join(store.Dir, url.PathEscape(mailbox)+".json")
+}
+
+// Load implements UIDMapStore.
+func (store *UIDMapFileStore) Load(mailbox string) (*UIDMapState, error) {
+	b, err := os.ReadFile(store.path(mailbox))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state UIDMapState
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("imapserver: invalid UID map for mailbox %q: %v", mailbox, err)
+	}
+	return &state, nil
+}
+
+// Save implements UIDMapStore. The file is replaced atomically.
+func (store *UIDMapFileStore) Save(mailbox string, state *UIDMapState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(store.Dir, ".uidmap-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), store.path(mailbox))
+}
+
+// Delete implements UIDMapStore.
+func (store *UIDMapFileStore) Delete(mailbox string) error {
+	err := os.Remove(store.path(mailbox))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
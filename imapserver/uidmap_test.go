@@ -0,0 +1,115 @@
+package imapserver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUIDMap(t *testing.T) {
+	store := &UIDMapFileStore{Dir: t.TempDir()}
+	m := NewUIDMap(store)
+	m.now = func() time.Time { return time.Unix(1000, 0) }
+
+	snapshot, err := m.Sync("INBOX", "gen1", []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if snapshot.UIDValidity != 1000 || snapshot.UIDNext != 4 || snapshot.Renumbered {
+		t.Errorf("initial Sync() = %+v", snapshot)
+	}
+	validity := snapshot.UIDValidity
+
+	// Removed messages aren't renumbered, new ones get new UIDs
+	snapshot, err = m.Sync("INBOX", "gen1", []string{"c", "d", "a"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	want := []UIDMapEntry{{"a", 1}, {"c", 3}, {"d", 4}}
+	if !reflect.DeepEqual(snapshot.Entries, want) {
+		t.Errorf("Sync() entries = %v, want %v", snapshot.Entries, want)
+	}
+	if s := snapshot.Removed.String(); s != "2" {
+		t.Errorf("Sync() removed = %v, want 2", s)
+	}
+	if id, ok := snapshot.ID(3); !ok || id != "c" {
+		t.Errorf("ID(3) = %q, %v, want c", id, ok)
+	}
+
+	// A message coming back gets a new UID, and the state survives restarts
+	m = NewUIDMap(store)
+	snapshot, err = m.Sync("INBOX", "gen1", []string{"a", "b", "c", "d"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if uid, _ := snapshot.UID("b"); uid != 5 || snapshot.UIDValidity != validity {
+		t.Errorf("Sync() after restart: UID(b) = %v, UIDVALIDITY = %v", uid, snapshot.UIDValidity)
+	}
+
+	// A new generation renumbers the mailbox
+	m.now = func() time.Time { return time.Unix(10, 0) }
+	snapshot, err = m.Sync("INBOX", "gen2", []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if !snapshot.Renumbered || snapshot.UIDValidity <= validity || snapshot.UIDNext != 3 {
+		t.Errorf("Sync() with new generation = %+v", snapshot)
+	}
+	validity = snapshot.UIDValidity
+
+	// Re-creating a mailbox changes UIDVALIDITY
+	if err := m.Delete("INBOX"); err != nil {
+		t.Fatalf("Delete() = %v", err)
+	}
+	snapshot, err = m.Sync("INBOX", "gen2", []string{"a"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if snapshot.UIDValidity <= validity {
+		t.Errorf("Sync() after Delete(): UIDVALIDITY = %v, want > %v", snapshot.UIDValidity, validity)
+	}
+
+	if _, err := m.Sync("INBOX", "gen2", []string{"a", "a"}); err == nil {
+		t.Errorf("Sync() with duplicate IDs succeeded")
+	}
+}
+
+func TestUIDMap_Peek(t *testing.T) {
+	m := NewUIDMap(&UIDMapFileStore{Dir: t.TempDir()})
+	m.now = func() time.Time { return time.Unix(1000, 0) }
+
+	if _, err := m.Sync("INBOX", "gen1", []string{"a", "b"}); err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+
+	snapshot, err := m.Peek("INBOX", "gen1", []string{"b", "c"})
+	if err != nil {
+		t.Fatalf("Peek() = %v", err)
+	}
+	if snapshot.UIDNext != 4 || len(snapshot.Entries) != 2 || snapshot.Removed.String() != "1" {
+		t.Errorf("Peek() = %+v", snapshot)
+	}
+
+	// The changes are still reported by Sync
+	snapshot, err = m.Sync("INBOX", "gen1", []string{"b", "c"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	want := []UIDMapEntry{{"b", 2}, {"c", 3}}
+	if !reflect.DeepEqual(snapshot.Entries, want) || snapshot.Removed.String() != "1" {
+		t.Errorf("Sync() after Peek() = %+v, want entries %v and 1 removed", snapshot, want)
+	}
+
+	// Peek doesn't allocate UIDVALIDITY values
+	peeked, err := m.Peek("INBOX", "gen2", []string{"b"})
+	if err != nil {
+		t.Fatalf("Peek() = %v", err)
+	}
+	snapshot, err = m.Sync("INBOX", "gen2", []string{"b"})
+	if err != nil {
+		t.Fatalf("Sync() = %v", err)
+	}
+	if !peeked.Renumbered || peeked.UIDValidity != snapshot.UIDValidity {
+		t.Errorf("Peek() UIDVALIDITY = %v, Sync() UIDVALIDITY = %v", peeked.UIDValidity, snapshot.UIDValidity)
+	}
+}
@@ -43,6 +43,11 @@ type Decoder struct {
 	// CheckBufferedLiteralFunc is called when a literal is about to be decoded
 	// and needs to be fully buffered in memory.
 	CheckBufferedLiteralFunc func(size int64, nonSync bool) error
+	// RawMailbox disables modified UTF-7 decoding of mailbox names.
+	RawMailbox bool
+	// SeqSetOptions contains the limits applied to sequence sets. If nil,
+	// imap.DefaultSeqSetParseOptions is used.
+	SeqSetOptions *imap.SeqSetParseOptions
 
 	r       *bufio.Reader
 	side    ConnSide
@@ -402,6 +407,17 @@ func (dec *Decoder) ExpectNStringReader() (lit *LiteralReader, nonSync, ok bool)
 	}
 }
 
+// ExpectNString8Reader is like ExpectNStringReader, but also accepts a
+// literal8 (RFC 3516). literal8 contents may contain NUL bytes.
+func (dec *Decoder) ExpectNString8Reader() (lit *LiteralReader, nonSync, ok bool) {
+	if lit, nonSync, ok = dec.Literal8Reader(); ok {
+		return lit, nonSync, true
+	} else if dec.Err() != nil {
+		return nil, false, false
+	}
+	return dec.ExpectNStringReader()
+}
+
 func (dec *Decoder) List(f func() error) (isList bool, err error) {
 	if !dec.Special('(') {
 		return false, nil
@@ -453,6 +469,10 @@ func (dec *Decoder) ExpectMailbox(ptr *string) bool {
 		*ptr = "INBOX"
 		return true
 	}
+	if dec.RawMailbox {
+		*ptr = name
+		return true
+	}
 	name, err := utf7.Encoding.NewDecoder().String(name)
 	if err == nil {
 		*ptr = name
@@ -465,13 +485,22 @@ func (dec *Decoder) ExpectSeqSet(ptr *imap.SeqSet) bool {
 	if !dec.Expect(dec.Func(&s, isSeqSetChar), "sequence-set") {
 		return false
 	}
-	seqSet, err := imap.ParseSeqSet(s)
+	seqSet, err := dec.ParseSeqSet(s)
 	if err == nil {
 		*ptr = seqSet
 	}
 	return dec.returnErr(err)
 }
 
+// ParseSeqSet parses a sequence set with the limits of the decoder.
+func (dec *Decoder) ParseSeqSet(s string) (imap.SeqSet, error) {
+	options := dec.SeqSetOptions
+	if options == nil {
+		options = &imap.DefaultSeqSetParseOptions
+	}
+	return imap.ParseSeqSetWithOptions(s, options)
+}
+
 func isSeqSetChar(ch byte) bool {
 	return ch == '*' || IsAtomChar(ch)
 }
@@ -499,6 +528,22 @@ func (dec *Decoder) LiteralReader() (lit *LiteralReader, nonSync, ok bool) {
 	if !dec.Special('{') {
 		return nil, false, false
 	}
+	return dec.literalReader(false)
+}
+
+// Literal8Reader decodes a literal8 (RFC 3516), ie. a literal prefixed with
+// "~" whose contents may contain NUL bytes.
+func (dec *Decoder) Literal8Reader() (lit *LiteralReader, nonSync, ok bool) {
+	if !dec.Special('~') {
+		return nil, false, false
+	}
+	if !dec.ExpectSpecial('{') {
+		return nil, false, false
+	}
+	return dec.literalReader(true)
+}
+
+func (dec *Decoder) literalReader(binary bool) (lit *LiteralReader, nonSync, ok bool) {
 	var size int64
 	if !dec.ExpectNumber64(&size) {
 		return nil, false, false
@@ -511,9 +556,10 @@ func (dec *Decoder) LiteralReader() (lit *LiteralReader, nonSync, ok bool) {
 	}
 	dec.literal = true
 	lit = &LiteralReader{
-		dec:  dec,
-		size: size,
-		r:    io.LimitReader(dec.r, size),
+		dec:    dec,
+		size:   size,
+		binary: binary,
+		r:      io.LimitReader(dec.r, size),
 	}
 	return lit, nonSync, true
 }
@@ -527,9 +573,10 @@ func (dec *Decoder) ExpectLiteralReader() (lit *LiteralReader, nonSync bool, err
 }
 
 type LiteralReader struct {
-	dec  *Decoder
-	size int64
-	r    io.Reader
+	dec    *Decoder
+	size   int64
+	binary bool
+	r      io.Reader
 }
 
 func newLiteralReaderFromString(s string) *LiteralReader {
@@ -543,6 +590,11 @@ func (lit *LiteralReader) Size() int64 {
 	return lit.size
 }
 
+// Binary returns true if the literal was sent as a literal8.
+func (lit *LiteralReader) Binary() bool {
+	return lit.binary
+}
+
 func (lit *LiteralReader) Read(b []byte) (int, error) {
 	n, err := lit.r.Read(b)
 	if err == io.EOF {
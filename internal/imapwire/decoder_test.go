@@ -0,0 +1,84 @@
+package imapwire_test
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+func TestDecoderExpectSeqSetLimits(t *testing.T) {
+	tests := []struct {
+		in      string
+		options *imap.SeqSetParseOptions
+		ok      bool
+	}{
+		{"1:3,5", nil, true},
+		{"1:4294967295", nil, true},
+		{strings.Repeat("1,", imap.DefaultSeqSetParseOptions.MaxValues) + "1", nil, false},
+		{"1:3,5,7", &imap.SeqSetParseOptions{MaxValues: 2}, false},
+		{"5:1", &imap.SeqSetParseOptions{RejectReversed: true}, false},
+	}
+	for _, tc := range tests {
+		dec := imapwire.NewDecoder(bufio.NewReader(strings.NewReader(tc.in+"\r\n")), imapwire.ConnSideServer)
+		dec.SeqSetOptions = tc.options
+		var seqSet imap.SeqSet
+		if ok := dec.ExpectSeqSet(&seqSet); ok != tc.ok {
+			t.Errorf("ExpectSeqSet(%.20q) = %v (%v), want %v", tc.in, ok, dec.Err(), tc.ok)
+		}
+	}
+}
+
+func TestDecoderExpectNString8Reader(t *testing.T) {
+	tests := []struct {
+		in      string
+		side    imapwire.ConnSide
+		ok      bool
+		nil     bool
+		binary  bool
+		nonSync bool
+		want    string
+	}{
+		{in: "~{5}\r\nab\x00cd", side: imapwire.ConnSideClient, ok: true, binary: true, want: "ab\x00cd"},
+		{in: "~{0}\r\n", side: imapwire.ConnSideClient, ok: true, binary: true, want: ""},
+		{in: "~{5+}\r\nab\x00cd", side: imapwire.ConnSideServer, ok: true, binary: true, nonSync: true, want: "ab\x00cd"},
+		{in: "{3}\r\nabc", side: imapwire.ConnSideClient, ok: true, want: "abc"},
+		{in: "\"abc\"", side: imapwire.ConnSideClient, ok: true, want: "abc"},
+		{in: "NIL\r\n", side: imapwire.ConnSideClient, ok: true, nil: true},
+		{in: "~5", side: imapwire.ConnSideClient, ok: false},
+		{in: "~{x}\r\n", side: imapwire.ConnSideClient, ok: false},
+		{in: "~{5+}\r\nab\x00cd", side: imapwire.ConnSideClient, ok: false},
+		{in: "~{5}", side: imapwire.ConnSideClient, ok: false},
+	}
+	for _, tc := range tests {
+		dec := imapwire.NewDecoder(bufio.NewReader(strings.NewReader(tc.in)), tc.side)
+		lit, nonSync, ok := dec.ExpectNString8Reader()
+		if ok != tc.ok {
+			t.Errorf("ExpectNString8Reader(%q) = %v (%v), want %v", tc.in, ok, dec.Err(), tc.ok)
+			continue
+		} else if !ok {
+			continue
+		}
+		if tc.nil {
+			if lit != nil {
+				t.Errorf("ExpectNString8Reader(%q) = %v, want nil", tc.in, lit)
+			}
+			continue
+		}
+		if lit.Binary() != tc.binary {
+			t.Errorf("ExpectNString8Reader(%q).Binary() = %v, want %v", tc.in, lit.Binary(), tc.binary)
+		}
+		if tc.binary && nonSync != tc.nonSync {
+			t.Errorf("ExpectNString8Reader(%q) nonSync = %v, want %v", tc.in, nonSync, tc.nonSync)
+		}
+		b, err := io.ReadAll(lit)
+		if err != nil {
+			t.Errorf("ReadAll() = %v", err)
+		} else if string(b) != tc.want {
+			t.Errorf("ExpectNString8Reader(%q) = %q, want %q", tc.in, b, tc.want)
+		}
+	}
+}
@@ -27,6 +27,8 @@ type Encoder struct {
 	// NewContinuationRequest creates a new continuation request. This is only
 	// meaningful for clients.
 	NewContinuationRequest func() *ContinuationRequest
+	// RawMailbox disables modified UTF-7 encoding of mailbox names.
+	RawMailbox bool
 
 	w       *bufio.Writer
 	side    ConnSide
@@ -80,7 +82,58 @@ func (enc *Encoder) Special(ch byte) *Encoder {
 	return enc.writeString(string(ch))
 }
 
+// StringForm is the syntax used to encode a string.
+type StringForm int
+
+const (
+	StringFormAtom StringForm = 1 + iota
+	StringFormQuoted
+	StringFormLiteral
+)
+
+// StringForm returns the syntax used by String to encode s.
+//
+// Quoted strings are used whenever possible, literals otherwise.
+func (enc *Encoder) StringForm(s string) StringForm {
+	if enc.validQuoted(s) {
+		return StringFormQuoted
+	}
+	return StringFormLiteral
+}
+
+// AStringForm returns the syntax used by AString to encode s.
+//
+// Atoms are used whenever possible, then quoted strings, then literals.
+func (enc *Encoder) AStringForm(s string) StringForm {
+	if isAStringAtom(s) {
+		return StringFormAtom
+	}
+	return enc.StringForm(s)
+}
+
+func isAStringAtom(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch > 0x7F || (!IsAtomChar(ch) && ch != ']') {
+			return false
+		}
+	}
+	return true
+}
+
+// Quoted writes a quoted string.
+//
+// An error is returned by CRLF if s cannot be represented as a quoted string,
+// e.g. because it contains CR or LF. Use String to fall back to a literal.
 func (enc *Encoder) Quoted(s string) *Encoder {
+	if !enc.validQuoted(s) {
+		enc.setErr(fmt.Errorf("imapwire: string %q cannot be quoted", s))
+		return enc
+	}
+
 	var sb strings.Builder
 	sb.Grow(2 + len(s))
 	sb.WriteByte('"')
@@ -95,12 +148,23 @@ func (enc *Encoder) Quoted(s string) *Encoder {
 	return enc.writeString(sb.String())
 }
 
+// String writes a string, either quoted or as a literal.
 func (enc *Encoder) String(s string) *Encoder {
-	if !enc.validQuoted(s) {
-		enc.stringLiteral(s)
-		return enc
+	switch enc.StringForm(s) {
+	case StringFormQuoted:
+		return enc.Quoted(s)
+	default:
+		return enc.StringLiteral(s)
 	}
-	return enc.Quoted(s)
+}
+
+// AString writes an astring: an atom if s only contains ASTRING-CHAR
+// characters, a string otherwise.
+func (enc *Encoder) AString(s string) *Encoder {
+	if enc.AStringForm(s) == StringFormAtom {
+		return enc.Atom(s)
+	}
+	return enc.String(s)
 }
 
 func (enc *Encoder) validQuoted(s string) bool {
@@ -124,6 +188,15 @@ func (enc *Encoder) validQuoted(s string) bool {
 	return true
 }
 
+// StringLiteral writes a string as a literal.
+//
+// On the client side, a synchronizing literal is used unless LiteralMinus is
+// set and the string is short enough.
+func (enc *Encoder) StringLiteral(s string) *Encoder {
+	enc.stringLiteral(s)
+	return enc
+}
+
 func (enc *Encoder) stringLiteral(s string) {
 	var sync *ContinuationRequest
 	if enc.side == ConnSideClient && (!enc.LiteralMinus || len(s) > 4096) {
@@ -148,6 +221,8 @@ func (enc *Encoder) stringLiteral(s string) {
 func (enc *Encoder) Mailbox(name string) *Encoder {
 	if strings.EqualFold(name, "INBOX") {
 		return enc.Atom("INBOX")
+	} else if enc.RawMailbox {
+		return enc.String(name)
 	} else {
 		name, _ = utf7.Encoding.NewEncoder().String(name)
 		return enc.String(name)
@@ -0,0 +1,72 @@
+package imapwire_test
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap/v2/internal/imapwire"
+)
+
+var astringForms = []struct {
+	in         string
+	quotedUTF8 bool
+	form       imapwire.StringForm
+	out        string
+}{
+	{"INBOX", false, imapwire.StringFormAtom, "INBOX"},
+	{"a]b", false, imapwire.StringFormAtom, "a]b"},
+	{"", false, imapwire.StringFormQuoted, `""`},
+	{"hello world", false, imapwire.StringFormQuoted, `"hello world"`},
+	{`a"b\c`, false, imapwire.StringFormQuoted, `"a\"b\\c"`},
+	{"a%b", false, imapwire.StringFormQuoted, `"a%b"`},
+	{"café", false, imapwire.StringFormLiteral, "{5}\r\ncafé"},
+	{"café", true, imapwire.StringFormQuoted, `"café"`},
+	{"a\r\nb", false, imapwire.StringFormLiteral, "{4}\r\na\r\nb"},
+}
+
+func TestEncoder_AString(t *testing.T) {
+	for _, tc := range astringForms {
+		var buf bytes.Buffer
+		enc := imapwire.NewEncoder(bufio.NewWriter(&buf), imapwire.ConnSideServer)
+		enc.QuotedUTF8 = tc.quotedUTF8
+
+		if form := enc.AStringForm(tc.in); form != tc.form {
+			t.Errorf("AStringForm(%q) = %v, want %v", tc.in, form, tc.form)
+		}
+		if err := enc.AString(tc.in).CRLF(); err != nil {
+			t.Errorf("AString(%q): %v", tc.in, err)
+			continue
+		}
+		if out := buf.String(); out != tc.out+"\r\n" {
+			t.Errorf("AString(%q) = %q, want %q", tc.in, out, tc.out+"\r\n")
+		}
+	}
+}
+
+func TestEncoder_Quoted_invalid(t *testing.T) {
+	for _, s := range []string{"a\rb", "a\nb", "a\x00b", "café"} {
+		enc := imapwire.NewEncoder(bufio.NewWriter(new(bytes.Buffer)), imapwire.ConnSideServer)
+		if err := enc.Quoted(s).CRLF(); err == nil {
+			t.Errorf("Quoted(%q): expected an error", s)
+		}
+	}
+}
+
+func TestEncoder_StringLiteral_client(t *testing.T) {
+	var buf bytes.Buffer
+	enc := imapwire.NewEncoder(bufio.NewWriter(&buf), imapwire.ConnSideClient)
+	enc.LiteralMinus = true
+	if err := enc.StringLiteral("foo").CRLF(); err != nil {
+		t.Fatalf("StringLiteral() = %v", err)
+	}
+	if out, want := buf.String(), "{3+}\r\nfoo\r\n"; out != want {
+		t.Errorf("StringLiteral() = %q, want %q", out, want)
+	}
+
+	// Synchronizing literals require a continuation request
+	enc = imapwire.NewEncoder(bufio.NewWriter(new(bytes.Buffer)), imapwire.ConnSideClient)
+	if err := enc.StringLiteral("foo").CRLF(); err == nil {
+		t.Errorf("StringLiteral() without LiteralMinus: expected an error")
+	}
+}
@@ -0,0 +1,426 @@
+package imapwire
+
+import (
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+// This file contains encoders for response data, shared by the server and by
+// clients re-serializing decoded responses.
+
+// ListResponse writes a LIST response.
+func (enc *Encoder) ListResponse(data *imap.ListData) error {
+	enc.Atom("*").SP().Atom("LIST").SP()
+	enc.listData(data)
+
+	var ext []string
+	if data.ChildInfo != nil {
+		ext = append(ext, "CHILDINFO")
+	}
+	if data.OldName != "" {
+		ext = append(ext, "OLDNAME")
+	}
+
+	// TODO: omit extended data if the client didn't ask for it
+	if len(ext) > 0 {
+		enc.SP().List(len(ext), func(i int) {
+			name := ext[i]
+			enc.Atom(name).SP()
+			switch name {
+			case "CHILDINFO":
+				enc.Special('(')
+				if data.ChildInfo.Subscribed {
+					enc.Quoted("SUBSCRIBED")
+				}
+				enc.Special(')')
+			case "OLDNAME":
+				enc.Special('(').Mailbox(data.OldName).Special(')')
+			default:
+				panic(fmt.Errorf("imapwire: unknown LIST extended-item %v", name))
+			}
+		})
+	}
+
+	return enc.CRLF()
+}
+
+// LSubResponse writes a LSUB response.
+func (enc *Encoder) LSubResponse(data *imap.ListData) error {
+	enc.Atom("*").SP().Atom("LSUB").SP()
+	enc.listData(data)
+	return enc.CRLF()
+}
+
+func (enc *Encoder) listData(data *imap.ListData) {
+	enc.List(len(data.Attrs), func(i int) {
+		enc.Atom(string(data.Attrs[i])) // TODO: validate attr
+	})
+	enc.SP()
+	if data.Delim == 0 {
+		enc.NIL()
+	} else {
+		enc.Quoted(string(data.Delim))
+	}
+	enc.SP().Mailbox(data.Mailbox)
+}
+
+// StatusResponse writes a STATUS response with the provided items.
+func (enc *Encoder) StatusResponse(data *imap.StatusData, items []imap.StatusItem) error {
+	return enc.Atom("*").SP().Atom("STATUS").SP().Mailbox(data.Mailbox).SP().List(len(items), func(i int) {
+		item := items[i]
+		enc.Atom(string(item)).SP()
+		switch item {
+		case imap.StatusItemNumMessages:
+			enc.Number(*data.NumMessages)
+		case imap.StatusItemUIDNext:
+			enc.Number(data.UIDNext)
+		case imap.StatusItemUIDValidity:
+			enc.Number(data.UIDValidity)
+		case imap.StatusItemNumUnseen:
+			enc.Number(*data.NumUnseen)
+		case imap.StatusItemNumDeleted:
+			enc.Number(*data.NumDeleted)
+		case imap.StatusItemSize:
+			enc.Number64(*data.Size)
+		case imap.StatusItemAppendLimit:
+			if data.AppendLimit != nil {
+				enc.Number(*data.AppendLimit)
+			} else {
+				enc.NIL()
+			}
+		case imap.StatusItemDeletedStorage:
+			enc.Number64(*data.DeletedStorage)
+		case imap.StatusItemNumRecent:
+			if data.NumRecent != nil {
+				enc.Number(*data.NumRecent)
+			} else {
+				enc.Number(0)
+			}
+		default:
+			panic(fmt.Errorf("imapwire: unknown STATUS item %v", item))
+		}
+	}).CRLF()
+}
+
+// StatusDataItems returns the STATUS items set in data.
+func StatusDataItems(data *imap.StatusData) []imap.StatusItem {
+	var items []imap.StatusItem
+	if data.NumMessages != nil {
+		items = append(items, imap.StatusItemNumMessages)
+	}
+	if data.NumRecent != nil {
+		items = append(items, imap.StatusItemNumRecent)
+	}
+	if data.UIDNext != 0 {
+		items = append(items, imap.StatusItemUIDNext)
+	}
+	if data.UIDValidity != 0 {
+		items = append(items, imap.StatusItemUIDValidity)
+	}
+	if data.NumUnseen != nil {
+		items = append(items, imap.StatusItemNumUnseen)
+	}
+	if data.NumDeleted != nil {
+		items = append(items, imap.StatusItemNumDeleted)
+	}
+	if data.Size != nil {
+		items = append(items, imap.StatusItemSize)
+	}
+	if data.AppendLimit != nil {
+		items = append(items, imap.StatusItemAppendLimit)
+	}
+	if data.DeletedStorage != nil {
+		items = append(items, imap.StatusItemDeletedStorage)
+	}
+	return items
+}
+
+// SearchResponse writes a SEARCH response.
+func (enc *Encoder) SearchResponse(data *imap.SearchData) error {
+	nums, ok := data.All.Nums()
+	if !ok {
+		return fmt.Errorf("imapwire: failed to enumerate message numbers in SEARCH response")
+	}
+
+	enc.Atom("*").SP().Atom("SEARCH")
+	for _, num := range nums {
+		enc.SP().Number(num)
+	}
+	if len(nums) > 0 && data.ModSeq > 0 {
+		enc.SP().Special('(').Atom("MODSEQ").SP().Number64(int64(data.ModSeq)).Special(')')
+	}
+	return enc.CRLF()
+}
+
+// ESearchResponse writes an ESEARCH response.
+//
+// The tag can be empty for unsolicited responses. Only the items requested in
+// the return options are written: MIN, MAX and ALL are omitted if no message
+// matched, and ALL is written if no return option is set.
+func (enc *Encoder) ESearchResponse(tag string, data *imap.SearchData, options *imap.SearchOptions) error {
+	returnOpts := make(map[imap.SearchReturnOption]bool)
+	for _, opt := range options.Return {
+		returnOpts[opt] = true
+	}
+
+	enc.Atom("*").SP().Atom("ESEARCH")
+	if tag != "" {
+		enc.SP().Special('(').Atom("TAG").SP().Quoted(tag).Special(')')
+	}
+	if data.UID {
+		enc.SP().Atom("UID")
+	}
+	if (returnOpts[imap.SearchReturnAll] || len(options.Return) == 0) && len(data.All) > 0 {
+		enc.SP().Atom("ALL").SP().Atom(data.All.String())
+	}
+	if returnOpts[imap.SearchReturnMin] && data.Min > 0 {
+		enc.SP().Atom("MIN").SP().Number(data.Min)
+	}
+	if returnOpts[imap.SearchReturnMax] && data.Max > 0 {
+		enc.SP().Atom("MAX").SP().Number(data.Max)
+	}
+	if returnOpts[imap.SearchReturnCount] {
+		enc.SP().Atom("COUNT").SP().Number(data.Count)
+	}
+	if data.ModSeq > 0 {
+		enc.SP().Atom("MODSEQ").SP().Number64(int64(data.ModSeq))
+	}
+	return enc.CRLF()
+}
+
+// NString writes a nstring: NIL if s is empty.
+func (enc *Encoder) NString(s string) *Encoder {
+	if s == "" {
+		return enc.NIL()
+	}
+	return enc.String(s)
+}
+
+// SectionPart writes a section part, e.g. "1.2".
+func (enc *Encoder) SectionPart(part []int) *Encoder {
+	if len(part) == 0 {
+		return enc
+	}
+
+	var l []string
+	for _, num := range part {
+		l = append(l, fmt.Sprintf("%v", num))
+	}
+	return enc.Atom(strings.Join(l, "."))
+}
+
+// BodySectionName writes the name of a body section as it appears in FETCH
+// responses, e.g. "BODY[HEADER.FIELDS (Subject)]<0>".
+func (enc *Encoder) BodySectionName(section *imap.FetchItemBodySection) *Encoder {
+	enc.Atom("BODY")
+	enc.Special('[')
+	enc.SectionPart(section.Part)
+	if len(section.Part) > 0 && section.Specifier != imap.PartSpecifierNone {
+		enc.Special('.')
+	}
+	if section.Specifier != imap.PartSpecifierNone {
+		enc.Atom(string(section.Specifier))
+
+		var headerList []string
+		if len(section.HeaderFields) > 0 {
+			headerList = section.HeaderFields
+			enc.Atom(".FIELDS")
+		} else if len(section.HeaderFieldsNot) > 0 {
+			headerList = section.HeaderFieldsNot
+			enc.Atom(".FIELDS.NOT")
+		}
+
+		if len(headerList) > 0 {
+			enc.SP().List(len(headerList), func(i int) {
+				enc.String(headerList[i])
+			})
+		}
+	}
+	enc.Special(']')
+	if partial := section.Partial; partial != nil {
+		enc.Special('<').Number(uint32(partial.Offset)).Special('>')
+	}
+	return enc
+}
+
+// Envelope writes a message envelope.
+func (enc *Encoder) Envelope(envelope *imap.Envelope) *Encoder {
+	if envelope == nil {
+		envelope = new(imap.Envelope)
+	}
+
+	sender := envelope.Sender
+	if sender == nil {
+		sender = envelope.From
+	}
+	replyTo := envelope.ReplyTo
+	if replyTo == nil {
+		replyTo = envelope.From
+	}
+
+	enc.Special('(')
+	enc.NString(envelope.Date)
+	enc.SP()
+	enc.NString(mime.QEncoding.Encode("utf-8", envelope.Subject))
+	addrs := [][]imap.Address{
+		envelope.From,
+		sender,
+		replyTo,
+		envelope.To,
+		envelope.Cc,
+		envelope.Bcc,
+	}
+	for _, l := range addrs {
+		enc.SP()
+		enc.addressList(l)
+	}
+	enc.SP()
+	enc.NString(envelope.InReplyTo)
+	enc.SP()
+	enc.NString(envelope.MessageID)
+	return enc.Special(')')
+}
+
+func (enc *Encoder) addressList(l []imap.Address) {
+	if l == nil {
+		enc.NIL()
+		return
+	}
+
+	enc.List(len(l), func(i int) {
+		addr := l[i]
+		enc.Special('(')
+		enc.NString(mime.QEncoding.Encode("utf-8", addr.Name))
+		enc.SP().NIL().SP()
+		enc.NString(addr.Mailbox)
+		enc.SP()
+		enc.NString(addr.Host)
+		enc.Special(')')
+	})
+}
+
+// BodyStructure writes a message body structure.
+func (enc *Encoder) BodyStructure(bs imap.BodyStructure) *Encoder {
+	enc.Special('(')
+	switch bs := bs.(type) {
+	case *imap.BodyStructureSinglePart:
+		enc.bodyType1part(bs)
+	case *imap.BodyStructureMultiPart:
+		enc.bodyTypeMpart(bs)
+	default:
+		panic(fmt.Errorf("unknown body structure type %T", bs))
+	}
+	return enc.Special(')')
+}
+
+func (enc *Encoder) bodyType1part(bs *imap.BodyStructureSinglePart) {
+	enc.String(bs.Type).SP().String(bs.Subtype).SP()
+	enc.bodyFldParam(bs.Params)
+	enc.SP()
+	enc.NString(bs.ID)
+	enc.SP()
+	enc.NString(bs.Description)
+	enc.SP()
+	if bs.Encoding == "" {
+		enc.String("7BIT")
+	} else {
+		enc.String(strings.ToUpper(bs.Encoding))
+	}
+	enc.SP().Number(bs.Size)
+
+	if msg := bs.MessageRFC822; msg != nil {
+		enc.SP()
+		enc.Envelope(msg.Envelope)
+		enc.SP()
+		enc.BodyStructure(msg.BodyStructure)
+		enc.SP().Number64(msg.NumLines)
+	} else if text := bs.Text; text != nil {
+		enc.SP().Number64(text.NumLines)
+	}
+
+	ext := bs.Extended
+	if ext == nil {
+		return
+	}
+
+	enc.SP()
+	enc.NIL() // MD5
+	enc.SP()
+	enc.bodyFldDsp(ext.Disposition)
+	enc.SP()
+	enc.bodyFldLang(ext.Language)
+	enc.SP()
+	enc.NString(ext.Location)
+}
+
+func (enc *Encoder) bodyTypeMpart(bs *imap.BodyStructureMultiPart) {
+	if len(bs.Children) == 0 {
+		panic("imapwire: imap.BodyStructureMultiPart must have at least one child")
+	}
+	for i, child := range bs.Children {
+		if i > 0 {
+			enc.SP()
+		}
+		enc.BodyStructure(child)
+	}
+
+	enc.SP().String(bs.Subtype)
+
+	ext := bs.Extended
+	if ext == nil {
+		return
+	}
+
+	enc.SP()
+	enc.bodyFldParam(ext.Params)
+	enc.SP()
+	enc.bodyFldDsp(ext.Disposition)
+	enc.SP()
+	enc.bodyFldLang(ext.Language)
+	enc.SP()
+	enc.NString(ext.Location)
+}
+
+func (enc *Encoder) bodyFldParam(params map[string]string) {
+	if params == nil {
+		enc.NIL()
+		return
+	}
+
+	var l []string
+	for k := range params {
+		l = append(l, k)
+	}
+	sort.Strings(l)
+
+	enc.List(len(l), func(i int) {
+		k := l[i]
+		v := params[k]
+		enc.String(k).SP().String(v)
+	})
+}
+
+func (enc *Encoder) bodyFldDsp(disp *imap.BodyStructureDisposition) {
+	if disp == nil {
+		enc.NIL()
+		return
+	}
+
+	enc.Special('(').String(disp.Value).SP()
+	enc.bodyFldParam(disp.Params)
+	enc.Special(')')
+}
+
+func (enc *Encoder) bodyFldLang(l []string) {
+	if l == nil {
+		enc.NIL()
+	} else {
+		enc.List(len(l), func(i int) {
+			enc.String(l[i])
+		})
+	}
+}
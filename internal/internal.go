@@ -13,7 +13,7 @@ const (
 	DateLayout     = "2-Jan-2006"
 )
 
-const StatusItemRecent imap.StatusItem = "RECENT" // removed in IMAP4rev2
+const StatusItemRecent = imap.StatusItemNumRecent // removed in IMAP4rev2
 
 // Fetch items removed in IMAP4rev2.
 var (
@@ -22,7 +22,7 @@ var (
 	FetchItemRFC822Text   imap.FetchItem = imap.FetchItemKeyword("RFC822.TEXT")   // equivalent to BODY[TEXT]
 )
 
-const FlagRecent imap.Flag = "\\Recent" // removed in IMAP4rev2
+const FlagRecent = imap.FlagRecent // removed in IMAP4rev2
 
 func DecodeDateTime(dec *imapwire.Decoder) (time.Time, error) {
 	var s string
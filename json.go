@@ -0,0 +1,104 @@
+package imap
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// jsonDateLayout is the layout used for dates in JSON. Only the date is
+// relevant for search criteria.
+const jsonDateLayout = "2006-01-02"
+
+// MarshalText implements encoding.TextMarshaler.
+func (s SeqSet) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *SeqSet) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		*s = nil
+		return nil
+	}
+	set, err := ParseSeqSet(string(b))
+	if err != nil {
+		return err
+	}
+	*s = set
+	return nil
+}
+
+type searchCriteriaJSON struct {
+	Since      string `json:"since,omitempty"`
+	Before     string `json:"before,omitempty"`
+	SentSince  string `json:"sentSince,omitempty"`
+	SentBefore string `json:"sentBefore,omitempty"`
+	Older      int64  `json:"older,omitempty"`
+	Younger    int64  `json:"younger,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// Dates are formatted as "YYYY-MM-DD". Intervals are formatted as a number
+// of seconds.
+func (criteria SearchCriteria) MarshalJSON() ([]byte, error) {
+	type searchCriteria SearchCriteria
+	formatDate := func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(jsonDateLayout)
+	}
+	return json.Marshal(struct {
+		*searchCriteria
+		searchCriteriaJSON
+	}{
+		searchCriteria: (*searchCriteria)(&criteria),
+		searchCriteriaJSON: searchCriteriaJSON{
+			Since:      formatDate(criteria.Since),
+			Before:     formatDate(criteria.Before),
+			SentSince:  formatDate(criteria.SentSince),
+			SentBefore: formatDate(criteria.SentBefore),
+			Older:      int64(criteria.Older / time.Second),
+			Younger:    int64(criteria.Younger / time.Second),
+		},
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (criteria *SearchCriteria) UnmarshalJSON(b []byte) error {
+	type searchCriteria SearchCriteria
+	var v struct {
+		*searchCriteria
+		searchCriteriaJSON
+	}
+	*criteria = SearchCriteria{}
+	v.searchCriteria = (*searchCriteria)(criteria)
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	criteria.Older = time.Duration(v.searchCriteriaJSON.Older) * time.Second
+	criteria.Younger = time.Duration(v.searchCriteriaJSON.Younger) * time.Second
+
+	dates := []struct {
+		s   string
+		ptr *time.Time
+	}{
+		{v.searchCriteriaJSON.Since, &criteria.Since},
+		{v.searchCriteriaJSON.Before, &criteria.Before},
+		{v.searchCriteriaJSON.SentSince, &criteria.SentSince},
+		{v.searchCriteriaJSON.SentBefore, &criteria.SentBefore},
+	}
+	for _, date := range dates {
+		if date.s == "" {
+			continue
+		}
+		t, err := time.Parse(jsonDateLayout, date.s)
+		if err != nil {
+			return err
+		}
+		*date.ptr = t
+	}
+	return nil
+}
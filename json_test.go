@@ -0,0 +1,40 @@
+package imap
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSearchCriteria_JSON(t *testing.T) {
+	criteria := SearchCriteria{
+		UID:     SeqSetNum(1, 2, 3, 10),
+		Since:   time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Header:  []SearchCriteriaHeaderField{{Key: "From", Value: "alice"}},
+		NotFlag: []Flag{FlagSeen},
+		Older:   time.Hour,
+		Younger: 7 * 24 * time.Hour,
+		Or: [][2]SearchCriteria{{
+			{Flag: []Flag{FlagFlagged}},
+			{Larger: 1024},
+		}},
+	}
+
+	b, err := json.Marshal(&criteria)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	want := `{"uid":"1:3,10","header":[{"key":"From","value":"alice"}],"notFlag":["\\Seen"],"or":[[{"flag":["\\Flagged"]},{"larger":1024}]],"since":"2024-01-01","older":3600,"younger":604800}`
+	if string(b) != want {
+		t.Errorf("json.Marshal() = %v, want %v", string(b), want)
+	}
+
+	var got SearchCriteria
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if !reflect.DeepEqual(&got, &criteria) {
+		t.Errorf("json.Unmarshal() = %#v, want %#v", got, criteria)
+	}
+}
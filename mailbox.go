@@ -0,0 +1,22 @@
+package imap
+
+import (
+	"github.com/emersion/go-imap/v2/internal/utf7"
+)
+
+// EncodeMailbox encodes a mailbox name with the modified UTF-7 encoding
+// defined in RFC 3501 section 5.1.3.
+//
+// This is only necessary when dealing with raw IMAP data: imapclient and
+// imapserver automatically encode and decode mailbox names. Invalid UTF-8
+// sequences are replaced with U+FFFD.
+func EncodeMailbox(name string) string {
+	s, _ := utf7.Encoding.NewEncoder().String(name)
+	return s
+}
+
+// DecodeMailbox decodes a mailbox name encoded with the modified UTF-7
+// encoding defined in RFC 3501 section 5.1.3.
+func DecodeMailbox(s string) (string, error) {
+	return utf7.Encoding.NewDecoder().String(s)
+}
@@ -0,0 +1,80 @@
+package imap_test
+
+import (
+	"testing"
+	"unicode/utf8"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+var mailboxEncodingTests = []struct {
+	decoded, encoded string
+}{
+	{"INBOX", "INBOX"},
+	{"Archive/2023", "Archive/2023"},
+	{"R&D", "R&-D"},
+	{"Entwürfe", "Entw&APw-rfe"},
+	{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+}
+
+func TestEncodeMailbox(t *testing.T) {
+	for _, tc := range mailboxEncodingTests {
+		if s := imap.EncodeMailbox(tc.decoded); s != tc.encoded {
+			t.Errorf("EncodeMailbox(%q) = %q, want %q", tc.decoded, s, tc.encoded)
+		}
+	}
+}
+
+func TestDecodeMailbox(t *testing.T) {
+	for _, tc := range mailboxEncodingTests {
+		s, err := imap.DecodeMailbox(tc.encoded)
+		if err != nil {
+			t.Errorf("DecodeMailbox(%q) = %v", tc.encoded, err)
+		} else if s != tc.decoded {
+			t.Errorf("DecodeMailbox(%q) = %q, want %q", tc.encoded, s, tc.decoded)
+		}
+	}
+
+	for _, s := range []string{"&", "&Jjo", "&Jjo!-", "\x00", "&AGE-"} {
+		if _, err := imap.DecodeMailbox(s); err == nil {
+			t.Errorf("DecodeMailbox(%q) = nil, want error", s)
+		}
+	}
+}
+
+func FuzzEncodeMailbox(f *testing.F) {
+	for _, tc := range mailboxEncodingTests {
+		f.Add(tc.decoded)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		if !utf8.ValidString(name) {
+			t.Skip()
+		}
+		encoded := imap.EncodeMailbox(name)
+		decoded, err := imap.DecodeMailbox(encoded)
+		if err != nil {
+			t.Fatalf("DecodeMailbox(%q) = %v", encoded, err)
+		} else if decoded != name {
+			t.Fatalf("DecodeMailbox(EncodeMailbox(%q)) = %q", name, decoded)
+		}
+	})
+}
+
+func FuzzDecodeMailbox(f *testing.F) {
+	for _, tc := range mailboxEncodingTests {
+		f.Add(tc.encoded)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		decoded, err := imap.DecodeMailbox(s)
+		if err != nil {
+			return
+		}
+		if !utf8.ValidString(decoded) {
+			t.Fatalf("DecodeMailbox(%q) = %q, invalid UTF-8", s, decoded)
+		}
+		// Re-encoding a valid name yields a valid name
+		if _, err := imap.DecodeMailbox(imap.EncodeMailbox(decoded)); err != nil {
+			t.Fatalf("DecodeMailbox(EncodeMailbox(%q)) = %v", decoded, err)
+		}
+	})
+}
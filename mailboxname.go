@@ -0,0 +1,162 @@
+package imap
+
+import (
+	"strings"
+)
+
+// MailboxName is a mailbox name along with its hierarchy delimiter and
+// namespace.
+//
+// It can be used to navigate the mailbox hierarchy without concatenating
+// strings by hand.
+type MailboxName struct {
+	// Raw mailbox name, as used in commands and responses
+	Name string
+	// Hierarchy delimiter, zero if the hierarchy is flat
+	Delim rune
+	// Namespace the mailbox belongs to, if known
+	Namespace *NamespaceDescriptor
+}
+
+// MailboxName returns the mailbox name of a LIST response.
+func (data *ListData) MailboxName() MailboxName {
+	return MailboxName{Name: data.Mailbox, Delim: data.Delim}
+}
+
+// MailboxName returns the mailbox name made of the provided segments below
+// the namespace prefix.
+func (desc *NamespaceDescriptor) MailboxName(segments ...string) MailboxName {
+	name := MailboxName{Name: strings.TrimSuffix(desc.Prefix, string(desc.Delim)), Delim: desc.Delim, Namespace: desc}
+	if desc.Delim == 0 {
+		name.Name = desc.Prefix
+	}
+	for _, seg := range segments {
+		name = name.Child(seg)
+	}
+	return name
+}
+
+// MailboxName returns a mailbox name with its namespace, looked up by longest
+// prefix. If no namespace matches, the mailbox name has no delimiter.
+func (data *NamespaceData) MailboxName(name string) MailboxName {
+	var best *NamespaceDescriptor
+	for _, l := range [][]NamespaceDescriptor{data.Personal, data.Other, data.Shared} {
+		for i := range l {
+			desc := &l[i]
+			if !namespaceContains(desc, name) {
+				continue
+			}
+			if best == nil || len(desc.Prefix) > len(best.Prefix) {
+				best = desc
+			}
+		}
+	}
+	if best == nil {
+		return MailboxName{Name: name}
+	}
+	return MailboxName{Name: name, Delim: best.Delim, Namespace: best}
+}
+
+func namespaceContains(desc *NamespaceDescriptor, name string) bool {
+	prefix := desc.Prefix
+	if prefix == "" {
+		return true
+	}
+	if strings.HasPrefix(name, prefix) {
+		return true
+	}
+	// The namespace prefix without the trailing delimiter is often a mailbox
+	// too, e.g. "INBOX" for the "INBOX." prefix
+	return desc.Delim != 0 && canonicalMailboxName(name, desc.Delim) == canonicalMailboxName(strings.TrimSuffix(prefix, string(desc.Delim)), desc.Delim)
+}
+
+// String returns the raw mailbox name.
+func (name MailboxName) String() string {
+	return name.Name
+}
+
+// IsInbox returns true if the mailbox is INBOX.
+func (name MailboxName) IsInbox() bool {
+	return strings.EqualFold(name.Name, "INBOX")
+}
+
+// Segments returns the hierarchy levels of the mailbox name, below the
+// namespace prefix if any.
+func (name MailboxName) Segments() []string {
+	s := name.relativeName()
+	if s == "" {
+		return nil
+	} else if name.Delim == 0 {
+		return []string{s}
+	}
+	return strings.Split(s, string(name.Delim))
+}
+
+func (name MailboxName) relativeName() string {
+	if name.Namespace == nil || name.Namespace.Prefix == "" {
+		return name.Name
+	}
+	prefix := name.Namespace.Prefix
+	if len(name.Name) >= len(prefix) && canonicalMailboxName(name.Name[:len(prefix)], name.Delim) == canonicalMailboxName(prefix, name.Delim) {
+		return name.Name[len(prefix):]
+	}
+	return ""
+}
+
+// Parent returns the parent mailbox name. It returns false if the mailbox is
+// at the top of the hierarchy, or at the top of its namespace.
+func (name MailboxName) Parent() (MailboxName, bool) {
+	segments := name.Segments()
+	if name.Delim == 0 || len(segments) <= 1 {
+		return MailboxName{}, false
+	}
+	last := segments[len(segments)-1]
+	parent := name
+	parent.Name = name.Name[:len(name.Name)-len(last)-len(string(name.Delim))]
+	return parent, true
+}
+
+// Child returns the name of a child mailbox.
+//
+// The child name must not contain the hierarchy delimiter.
+func (name MailboxName) Child(child string) MailboxName {
+	out := name
+	switch {
+	case name.Name == "":
+		out.Name = child
+	case name.Delim == 0:
+		out.Name = name.Name + child
+	case strings.HasSuffix(name.Name, string(name.Delim)):
+		out.Name = name.Name + child
+	default:
+		out.Name = name.Name + string(name.Delim) + child
+	}
+	return out
+}
+
+// Equal checks whether two mailbox names refer to the same mailbox. INBOX is
+// case-insensitive, including when used as the first hierarchy level.
+func (name MailboxName) Equal(other MailboxName) bool {
+	return canonicalMailboxName(name.Name, name.Delim) == canonicalMailboxName(other.Name, other.Delim)
+}
+
+// Canonical returns the raw mailbox name with INBOX upper-cased, including
+// when used as the first hierarchy level. Two mailbox names are equal if and
+// only if their canonical forms are equal.
+func (name MailboxName) Canonical() string {
+	return canonicalMailboxName(name.Name, name.Delim)
+}
+
+// canonicalMailboxName upper-cases INBOX in a mailbox name.
+func canonicalMailboxName(name string, delim rune) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	if delim != 0 {
+		prefix := "INBOX" + string(delim)
+		if len(name) > len(prefix) && strings.EqualFold(name[:len(prefix)], prefix) {
+			return prefix + name[len(prefix):]
+		}
+	}
+	return name
+}
@@ -0,0 +1,62 @@
+package imap_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestMailboxName(t *testing.T) {
+	name := imap.MailboxName{Name: "Archive/2024/Q1", Delim: '/'}
+	if segments := name.Segments(); !reflect.DeepEqual(segments, []string{"Archive", "2024", "Q1"}) {
+		t.Errorf("Segments() = %v", segments)
+	}
+
+	parent, ok := name.Parent()
+	if !ok || parent.Name != "Archive/2024" {
+		t.Errorf("Parent() = %q, %v, want %q, true", parent.Name, ok, "Archive/2024")
+	}
+	if child := parent.Child("Q2"); child.Name != "Archive/2024/Q2" {
+		t.Errorf("Child() = %q, want %q", child.Name, "Archive/2024/Q2")
+	}
+	if _, ok := (imap.MailboxName{Name: "Archive", Delim: '/'}).Parent(); ok {
+		t.Errorf("Parent() of top-level mailbox returned true")
+	}
+
+	if !(imap.MailboxName{Name: "inbox/Receipts", Delim: '/'}).Equal(imap.MailboxName{Name: "INBOX/Receipts", Delim: '/'}) {
+		t.Errorf("Equal() is case-sensitive for INBOX")
+	}
+	if (imap.MailboxName{Name: "archive", Delim: '/'}).Equal(imap.MailboxName{Name: "Archive", Delim: '/'}) {
+		t.Errorf("Equal() is case-insensitive for mailboxes other than INBOX")
+	}
+}
+
+func TestNamespaceData_MailboxName(t *testing.T) {
+	data := &imap.NamespaceData{
+		Personal: []imap.NamespaceDescriptor{{Prefix: "INBOX.", Delim: '.'}},
+		Shared:   []imap.NamespaceDescriptor{{Prefix: "#shared.", Delim: '.'}},
+	}
+
+	name := data.MailboxName("INBOX.Sent.2024")
+	if name.Namespace == nil || name.Namespace.Prefix != "INBOX." {
+		t.Fatalf("MailboxName() has namespace %v, want INBOX.", name.Namespace)
+	}
+	if segments := name.Segments(); !reflect.DeepEqual(segments, []string{"Sent", "2024"}) {
+		t.Errorf("Segments() = %v", segments)
+	}
+	parent, ok := name.Parent()
+	if !ok || parent.Name != "INBOX.Sent" {
+		t.Errorf("Parent() = %q, %v, want %q, true", parent.Name, ok, "INBOX.Sent")
+	}
+	if _, ok := parent.Parent(); ok {
+		t.Errorf("Parent() at the top of the namespace returned true")
+	}
+
+	if child := data.Shared[0].MailboxName("Team", "Lists"); child.Name != "#shared.Team.Lists" {
+		t.Errorf("NamespaceDescriptor.MailboxName() = %q", child.Name)
+	}
+	if name := data.MailboxName("Other"); name.Namespace != nil || name.Delim != 0 {
+		t.Errorf("MailboxName() outside of namespaces = %+v", name)
+	}
+}
@@ -0,0 +1,299 @@
+package imap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// MessageBuilder composes RFC 5322 messages with a fluent API, e.g. to be
+// uploaded with APPEND.
+//
+// The message body is made of an optional text part, an optional HTML part
+// and optional attachments. When both text and HTML are provided, a
+// multipart/alternative body is generated. Attachments are base64-encoded in
+// a multipart/mixed body.
+type MessageBuilder struct {
+	header      textproto.MIMEHeader
+	keys        []string // header keys, in insertion order
+	date        time.Time
+	text, html  *string
+	attachments []messageAttachment
+	err         error
+}
+
+type messageAttachment struct {
+	filename, mediaType string
+	data                []byte
+}
+
+// NewMessageBuilder creates a new MessageBuilder.
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{header: make(textproto.MIMEHeader)}
+}
+
+func (b *MessageBuilder) errorf(format string, args ...interface{}) *MessageBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("imap: invalid message: "+format, args...)
+	}
+	return b
+}
+
+// Header sets a header field, replacing any existing value. Values which
+// aren't ASCII are encoded with RFC 2047.
+func (b *MessageBuilder) Header(key, value string) *MessageBuilder {
+	if strings.ContainsAny(value, "\r\n") {
+		return b.errorf("header field %q contains a line break", key)
+	}
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	if _, ok := b.header[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.header.Set(key, mime.QEncoding.Encode("utf-8", value))
+	return b
+}
+
+func (b *MessageBuilder) addressHeader(key string, addrs []Address) *MessageBuilder {
+	if len(addrs) == 0 {
+		return b.errorf("empty %v header field", key)
+	}
+	l := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if addr.Addr() == "" {
+			return b.errorf("invalid address in %v header field", key)
+		}
+		mailAddr := mail.Address{Name: addr.Name, Address: addr.Addr()}
+		l = append(l, mailAddr.String())
+	}
+	if _, ok := b.header[key]; !ok {
+		b.keys = append(b.keys, key)
+	}
+	b.header.Set(key, strings.Join(l, ", "))
+	return b
+}
+
+// From sets the authors of the message.
+func (b *MessageBuilder) From(addrs ...Address) *MessageBuilder {
+	return b.addressHeader("From", addrs)
+}
+
+// To sets the primary recipients of the message.
+func (b *MessageBuilder) To(addrs ...Address) *MessageBuilder {
+	return b.addressHeader("To", addrs)
+}
+
+// Cc sets the secondary recipients of the message.
+func (b *MessageBuilder) Cc(addrs ...Address) *MessageBuilder {
+	return b.addressHeader("Cc", addrs)
+}
+
+// Bcc sets the blind recipients of the message.
+func (b *MessageBuilder) Bcc(addrs ...Address) *MessageBuilder {
+	return b.addressHeader("Bcc", addrs)
+}
+
+// Subject sets the subject of the message.
+func (b *MessageBuilder) Subject(subject string) *MessageBuilder {
+	return b.Header("Subject", subject)
+}
+
+// Date sets the origination date of the message. If unset, the time at which
+// Build is called is used.
+func (b *MessageBuilder) Date(t time.Time) *MessageBuilder {
+	b.date = t
+	return b
+}
+
+// MessageID sets the message identifier, without angle brackets.
+func (b *MessageBuilder) MessageID(id string) *MessageBuilder {
+	if id == "" || strings.ContainsAny(id, "<> \t\r\n") {
+		return b.errorf("invalid message identifier %q", id)
+	}
+	return b.Header("Message-Id", "<"+id+">")
+}
+
+// Text sets the plain text body of the message.
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	b.text = &text
+	return b
+}
+
+// HTML sets the HTML body of the message.
+func (b *MessageBuilder) HTML(html string) *MessageBuilder {
+	b.html = &html
+	return b
+}
+
+// Attach adds an attachment to the message. If mediaType is empty,
+// application/octet-stream is used.
+func (b *MessageBuilder) Attach(filename, mediaType string, data []byte) *MessageBuilder {
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	b.attachments = append(b.attachments, messageAttachment{
+		filename:  filename,
+		mediaType: mediaType,
+		data:      data,
+	})
+	return b
+}
+
+// Build returns the message. Lines are terminated with CRLF.
+func (b *MessageBuilder) Build() ([]byte, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if _, ok := b.header["From"]; !ok {
+		return nil, fmt.Errorf("imap: invalid message: missing From header field")
+	}
+
+	date := b.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+
+	var buf bytes.Buffer
+	writeMessageHeaderField(&buf, "Date", date.Format(time.RFC1123Z))
+	for _, k := range b.keys {
+		writeMessageHeaderField(&buf, k, b.header.Get(k))
+	}
+	writeMessageHeaderField(&buf, "Mime-Version", "1.0")
+
+	var err error
+	if len(b.attachments) == 0 {
+		err = b.writeBody(&buf)
+	} else {
+		var parts []func(w io.Writer) error
+		if b.text != nil || b.html != nil {
+			parts = append(parts, b.writeBody)
+		}
+		for i := range b.attachments {
+			parts = append(parts, b.attachments[i].write)
+		}
+		err = writeMultipart(&buf, "mixed", parts)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBody writes the header fields and body of the text part(s).
+func (b *MessageBuilder) writeBody(w io.Writer) error {
+	if b.text != nil && b.html != nil {
+		return writeMultipart(w, "alternative", []func(w io.Writer) error{
+			func(w io.Writer) error {
+				return writeTextPart(w, "text/plain", *b.text)
+			},
+			func(w io.Writer) error {
+				return writeTextPart(w, "text/html", *b.html)
+			},
+		})
+	} else if b.html != nil {
+		return writeTextPart(w, "text/html", *b.html)
+	} else {
+		var text string
+		if b.text != nil {
+			text = *b.text
+		}
+		return writeTextPart(w, "text/plain", text)
+	}
+}
+
+func (att *messageAttachment) write(w io.Writer) error {
+	var buf bytes.Buffer
+	params := map[string]string{}
+	if att.filename != "" {
+		params["filename"] = att.filename
+	}
+	writeMessageHeaderField(&buf, "Content-Type", mime.FormatMediaType(att.mediaType, nil))
+	writeMessageHeaderField(&buf, "Content-Disposition", mime.FormatMediaType("attachment", params))
+	writeMessageHeaderField(&buf, "Content-Transfer-Encoding", "base64")
+	buf.WriteString("\r\n")
+
+	s := base64.StdEncoding.EncodeToString(att.data)
+	for len(s) > 76 {
+		buf.WriteString(s[:76])
+		buf.WriteString("\r\n")
+		s = s[76:]
+	}
+	if s != "" {
+		buf.WriteString(s)
+		buf.WriteString("\r\n")
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func writeTextPart(w io.Writer, mediaType, text string) error {
+	var buf bytes.Buffer
+	writeMessageHeaderField(&buf, "Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"}))
+	writeMessageHeaderField(&buf, "Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qw := quotedprintable.NewWriter(&buf)
+	if _, err := io.WriteString(qw, strings.ReplaceAll(text, "\r\n", "\n")); err != nil {
+		return err
+	}
+	if err := qw.Close(); err != nil {
+		return err
+	}
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeMultipart writes the header fields and body of a multipart entity.
+// Each part writes its own header fields and body.
+func writeMultipart(w io.Writer, subtype string, parts []func(w io.Writer) error) error {
+	// Only used to generate a random boundary
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+
+	var buf bytes.Buffer
+	mediaType := mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary})
+	writeMessageHeaderField(&buf, "Content-Type", mediaType)
+	buf.WriteString("\r\n")
+	for i, part := range parts {
+		if i > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("--" + boundary + "\r\n")
+		if err := part(&buf); err != nil {
+			return err
+		}
+	}
+	buf.WriteString("\r\n--" + boundary + "--\r\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeMessageHeaderField writes a header field, folding long lines at
+// whitespace.
+func writeMessageHeaderField(buf *bytes.Buffer, k, v string) {
+	line := k + ": "
+	lineLen := len(line)
+	buf.WriteString(line)
+	for i, word := range strings.Split(v, " ") {
+		if i > 0 {
+			if lineLen+1+len(word) > 76 {
+				buf.WriteString("\r\n")
+				lineLen = 0
+			}
+			buf.WriteString(" ")
+			lineLen++
+		}
+		buf.WriteString(word)
+		lineLen += len(word)
+	}
+	buf.WriteString("\r\n")
+}
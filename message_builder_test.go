@@ -0,0 +1,94 @@
+package imap
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	date := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+	b, err := NewMessageBuilder().
+		From(Address{Name: "Álice", Mailbox: "alice", Host: "example.org"}).
+		To(Address{Mailbox: "bob", Host: "example.org"}).
+		Subject("Café meeting").
+		Date(date).
+		MessageID("123@example.org").
+		Text("Hello Bob,\nsee attached.").
+		HTML("<p>Hello Bob</p>").
+		Attach("notes.txt", "text/plain", []byte(strings.Repeat("x", 100))).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+	if bytes.Contains(bytes.ReplaceAll(b, []byte("\r\n"), nil), []byte("\n")) {
+		t.Errorf("message contains bare LF")
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("ReadMessage() = %v", err)
+	}
+	dec := new(mime.WordDecoder)
+	if subject, _ := dec.DecodeHeader(msg.Header.Get("Subject")); subject != "Café meeting" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if from, err := msg.Header.AddressList("From"); err != nil || from[0].Name != "Álice" || from[0].Address != "alice@example.org" {
+		t.Errorf("From = %v, %v", from, err)
+	}
+	if d, err := msg.Header.Date(); err != nil || !d.Equal(date) {
+		t.Errorf("Date = %v, %v", d, err)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %v", mediaType)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+
+	p, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() = %v", err)
+	}
+	mediaType, altParams, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("first part Content-Type = %v", mediaType)
+	}
+	alt := multipart.NewReader(p, altParams["boundary"])
+	for _, want := range []string{"Hello Bob,\r\nsee attached.", "<p>Hello Bob</p>"} {
+		p, err := alt.NextPart()
+		if err != nil {
+			t.Fatalf("alternative NextPart() = %v", err)
+		}
+		// multipart.Reader decodes quoted-printable
+		body, _ := io.ReadAll(p)
+		if string(body) != want {
+			t.Errorf("alternative part = %q, want %q", body, want)
+		}
+	}
+
+	p, err = mr.NextPart()
+	if err != nil {
+		t.Fatalf("NextPart() = %v", err)
+	}
+	if p.FileName() != "notes.txt" || p.Header.Get("Content-Transfer-Encoding") != "base64" {
+		t.Errorf("attachment header = %v", p.Header)
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Errorf("NextPart() = %v, want EOF", err)
+	}
+}
+
+func TestMessageBuilder_invalid(t *testing.T) {
+	if _, err := NewMessageBuilder().Text("hi").Build(); err == nil {
+		t.Errorf("Build() without From: expected an error")
+	}
+	if _, err := NewMessageBuilder().From(Address{Mailbox: "alice", Host: "example.org"}).Subject("a\r\nBcc: x").Build(); err == nil {
+		t.Errorf("Build() with line break in header: expected an error")
+	}
+}
@@ -0,0 +1,134 @@
+package imap
+
+// NumSet is a set of numbers identifying messages.
+//
+// NumSet is implemented by SeqSet (message sequence numbers), UIDSet (message
+// UIDs) and the value returned by SearchRes. Commands accepting a NumSet
+// operate on UIDs when passed a UIDSet.
+type NumSet interface {
+	// String returns the IMAP representation of the set.
+	String() string
+	// Dynamic returns true if the set contains "*" or "n:*" values, or
+	// refers to a saved search result.
+	Dynamic() bool
+
+	numSet()
+}
+
+var (
+	_ NumSet = SeqSet(nil)
+	_ NumSet = UIDSet(nil)
+	_ NumSet = searchRes{}
+)
+
+func (SeqSet) numSet() {}
+
+// UIDSet is a set of message UIDs.
+//
+// UIDSet has the same representation as SeqSet. The zero value is an empty
+// set.
+type UIDSet SeqSet
+
+// UIDSetNum returns a new UIDSet containing the UIDs.
+func UIDSetNum(uids ...uint32) UIDSet {
+	return UIDSet(SeqSetNum(uids...))
+}
+
+// UIDSetRange returns a new UIDSet containing the UID range.
+func UIDSetRange(start, stop uint32) UIDSet {
+	return UIDSet(SeqSetRange(start, stop))
+}
+
+// UIDSetFromNums returns a new UIDSet containing the UIDs.
+//
+// See SeqSetFromNums.
+func UIDSetFromNums(uids []uint32) UIDSet {
+	return UIDSet(SeqSetFromNums(uids))
+}
+
+func (UIDSet) numSet() {}
+
+// AddNum inserts new UIDs into the set. The value 0 represents "*".
+func (s *UIDSet) AddNum(uids ...uint32) {
+	(*SeqSet)(s).AddNum(uids...)
+}
+
+// AddRange inserts a new UID range into the set.
+func (s *UIDSet) AddRange(start, stop uint32) {
+	(*SeqSet)(s).AddRange(start, stop)
+}
+
+// AddSet inserts all UIDs from t into s.
+func (s *UIDSet) AddSet(t UIDSet) {
+	(*SeqSet)(s).AddSet(SeqSet(t))
+}
+
+// Dynamic returns true if the set contains "*" or "n:*" values.
+func (s UIDSet) Dynamic() bool {
+	return SeqSet(s).Dynamic()
+}
+
+// Contains returns true if the non-zero UID uid is contained in the set.
+//
+// See SeqSet.Contains.
+func (s UIDSet) Contains(uid uint32) bool {
+	return SeqSet(s).Contains(uid)
+}
+
+// Nums returns a slice of all UIDs contained in the set.
+func (s UIDSet) Nums() (uids []uint32, ok bool) {
+	return SeqSet(s).Nums()
+}
+
+// Coalesce returns a copy of the set where UID values separated by at most
+// maxGap missing UIDs are merged.
+//
+// See SeqSet.Coalesce.
+func (s UIDSet) Coalesce(maxGap uint32) UIDSet {
+	return UIDSet(SeqSet(s).Coalesce(maxGap))
+}
+
+// Split splits the set into sets containing at most n UID values each.
+//
+// See SeqSet.Split.
+func (s UIDSet) Split(n int) []UIDSet {
+	seqSets := SeqSet(s).Split(n)
+	l := make([]UIDSet, len(seqSets))
+	for i, seqSet := range seqSets {
+		l[i] = UIDSet(seqSet)
+	}
+	return l
+}
+
+// Complement returns the UIDs between min and max inclusive which aren't
+// contained in the set.
+//
+// See SeqSet.Complement.
+func (s UIDSet) Complement(min, max uint32) UIDSet {
+	return UIDSet(SeqSet(s).Complement(min, max))
+}
+
+// String returns a sorted representation of all contained UIDs.
+func (s UIDSet) String() string {
+	return SeqSet(s).String()
+}
+
+// SearchRes returns a special NumSet referring to the result of the last
+// SEARCH command issued with the SAVE return option ("$").
+//
+// This requires the SEARCHRES extension.
+func SearchRes() NumSet {
+	return searchRes{}
+}
+
+type searchRes struct{}
+
+func (searchRes) String() string {
+	return "$"
+}
+
+func (searchRes) Dynamic() bool {
+	return true
+}
+
+func (searchRes) numSet() {}
@@ -37,6 +37,8 @@ const (
 	ResponseCodeOverQuota            ResponseCode = "OVERQUOTA"
 	ResponseCodeParse                ResponseCode = "PARSE"
 	ResponseCodePrivacyRequired      ResponseCode = "PRIVACYREQUIRED"
+	ResponseCodeReadOnly             ResponseCode = "READ-ONLY"
+	ResponseCodeReadWrite            ResponseCode = "READ-WRITE"
 	ResponseCodeServerBug            ResponseCode = "SERVERBUG"
 	ResponseCodeTryCreate            ResponseCode = "TRYCREATE"
 	ResponseCodeUnavailable          ResponseCode = "UNAVAILABLE"
@@ -48,6 +50,16 @@ const (
 
 	// APPENDLIMIT
 	ResponseCodeTooBig ResponseCode = "TOOBIG"
+
+	// UIDPLUS
+	ResponseCodeUIDNotSticky ResponseCode = "UIDNOTSTICKY"
+
+	// CONDSTORE
+	ResponseCodeModified      ResponseCode = "MODIFIED"
+	ResponseCodeHighestModSeq ResponseCode = "HIGHESTMODSEQ"
+
+	// QRESYNC, IMAP4rev2
+	ResponseCodeClosed ResponseCode = "CLOSED"
 )
 
 // StatusResponse is a generic status response.
@@ -56,7 +68,66 @@ const (
 type StatusResponse struct {
 	Type StatusResponseType
 	Code ResponseCode
-	Text string
+	// Parsed response code arguments, if any. This is one of the
+	// ResponseCode*Data types, or a value returned by a custom parser.
+	CodeData interface{}
+	Text     string
+}
+
+// ResponseCodeCapabilityData is the data attached to a CAPABILITY response
+// code.
+type ResponseCodeCapabilityData struct {
+	Caps CapSet
+}
+
+// ResponseCodeBadCharsetData is the data attached to a BADCHARSET response
+// code.
+type ResponseCodeBadCharsetData struct {
+	// Charsets supported by the server, may be empty
+	Charsets []string
+}
+
+// ResponseCodePermanentFlagsData is the data attached to a PERMANENTFLAGS
+// response code.
+type ResponseCodePermanentFlagsData struct {
+	Flags []Flag
+}
+
+// ResponseCodeUIDNextData is the data attached to a UIDNEXT response code.
+type ResponseCodeUIDNextData struct {
+	UIDNext uint32
+}
+
+// ResponseCodeUIDValidityData is the data attached to a UIDVALIDITY response
+// code.
+type ResponseCodeUIDValidityData struct {
+	UIDValidity uint32
+}
+
+// ResponseCodeAppendUIDData is the data attached to an APPENDUID response
+// code.
+type ResponseCodeAppendUIDData struct {
+	UIDValidity uint32
+	UID         uint32
+}
+
+// ResponseCodeCopyUIDData is the data attached to a COPYUID response code.
+type ResponseCodeCopyUIDData struct {
+	UIDValidity uint32
+	SourceUIDs  SeqSet
+	DestUIDs    SeqSet
+}
+
+// ResponseCodeModifiedData is the data attached to a MODIFIED response code.
+type ResponseCodeModifiedData struct {
+	// Messages which failed the UNCHANGEDSINCE test
+	Set SeqSet
+}
+
+// ResponseCodeHighestModSeqData is the data attached to a HIGHESTMODSEQ
+// response code.
+type ResponseCodeHighestModSeqData struct {
+	ModSeq uint64
 }
 
 // Error is an IMAP error caused by a status response.
@@ -13,11 +13,12 @@ const (
 	SearchReturnMax   SearchReturnOption = "MAX"
 	SearchReturnAll   SearchReturnOption = "ALL"
 	SearchReturnCount SearchReturnOption = "COUNT"
+	SearchReturnSave  SearchReturnOption = "SAVE" // requires SEARCHRES
 )
 
 // SearchOptions contains options for the SEARCH command.
 type SearchOptions struct {
-	Return []SearchReturnOption // requires IMAP4rev2 or ESEARCH
+	Return []SearchReturnOption `json:"return,omitempty"` // requires IMAP4rev2 or ESEARCH
 }
 
 // SearchCriteria is a criteria for the SEARCH command.
@@ -25,47 +26,85 @@ type SearchOptions struct {
 // When multiple fields are populated, the result is the intersection ("and"
 // function) of all messages that match the fields.
 type SearchCriteria struct {
-	SeqNum SeqSet
-	UID    SeqSet
+	SeqNum SeqSet `json:"seqNum,omitempty"`
+	UID    SeqSet `json:"uid,omitempty"`
 
 	// Only the date is used, the time and timezone are ignored
-	Since      time.Time
-	Before     time.Time
-	SentSince  time.Time
-	SentBefore time.Time
+	Since      time.Time `json:"-"`
+	Before     time.Time `json:"-"`
+	SentSince  time.Time `json:"-"`
+	SentBefore time.Time `json:"-"`
 
-	Header []SearchCriteriaHeaderField
-	Body   []string
-	Text   []string
+	Header []SearchCriteriaHeaderField `json:"header,omitempty"`
+	Body   []string                    `json:"body,omitempty"`
+	Text   []string                    `json:"text,omitempty"`
 
-	Flag    []Flag
-	NotFlag []Flag
+	Flag    []Flag `json:"flag,omitempty"`
+	NotFlag []Flag `json:"notFlag,omitempty"`
 
-	Larger  int64
-	Smaller int64
+	Larger  int64 `json:"larger,omitempty"`
+	Smaller int64 `json:"smaller,omitempty"`
 
-	Not []SearchCriteria
-	Or  [][2]SearchCriteria
+	ModSeq *SearchCriteriaModSeq `json:"modSeq,omitempty"` // requires CONDSTORE
+
+	// Intervals relative to the current time, in whole seconds, matched
+	// against the internal date. Requires WITHIN.
+	Older   time.Duration `json:"-"`
+	Younger time.Duration `json:"-"`
+
+	Not []SearchCriteria    `json:"not,omitempty"`
+	Or  [][2]SearchCriteria `json:"or,omitempty"`
 }
 
 type SearchCriteriaHeaderField struct {
-	Key, Value string
+	Key   string `json:"key"`
+	Value string `json:"value"`
 }
 
+// SearchCriteriaModSeq matches messages whose mod-sequence is greater than or
+// equal to ModSeq.
+type SearchCriteriaModSeq struct {
+	ModSeq       uint64                     `json:"modSeq"`
+	MetadataName string                     `json:"metadataName,omitempty"`
+	MetadataType SearchCriteriaMetadataType `json:"metadataType,omitempty"`
+}
+
+// SearchCriteriaMetadataType is the type of the flag whose mod-sequence is
+// compared in a MODSEQ search key.
+type SearchCriteriaMetadataType string
+
+const (
+	SearchCriteriaMetadataAll     SearchCriteriaMetadataType = "all"
+	SearchCriteriaMetadataPrivate SearchCriteriaMetadataType = "priv"
+	SearchCriteriaMetadataShared  SearchCriteriaMetadataType = "shared"
+)
+
 // SearchData is the data returned by a SEARCH command.
 type SearchData struct {
-	All SeqSet
+	All SeqSet `json:"all,omitempty"`
 
 	// requires IMAP4rev2 or ESEARCH
-	UID   bool
-	Min   uint32
-	Max   uint32
-	Count uint32
+	UID   bool   `json:"uid,omitempty"`
+	Min   uint32 `json:"min,omitempty"`
+	Max   uint32 `json:"max,omitempty"`
+	Count uint32 `json:"count,omitempty"`
+
+	// Highest mod-sequence of the matching messages, only returned when the
+	// criteria contain a MODSEQ key. Requires CONDSTORE.
+	ModSeq uint64 `json:"modSeq,omitempty"`
 }
 
-// AllNums returns All as a slice of numbers.
+// AllNums returns All as a slice of numbers, in ascending order and without
+// duplicates.
+//
+// SEARCH results are sets: the order in which the server sends them isn't
+// meaningful. SORT should be used to get messages in a specific order.
 func (data *SearchData) AllNums() []uint32 {
+	all := data.All
+	if !all.canonical() {
+		all = all.Canonical()
+	}
 	// Note: a dynamic sequence set would be a server bug
-	nums, _ := data.All.Nums()
+	nums, _ := all.Nums()
 	return nums
 }
@@ -0,0 +1,464 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const searchDateLayout = "2-Jan-2006"
+
+// SearchCriteriaBuilder builds a SearchCriteria with a fluent API.
+//
+// Each method adds a search key to the criteria and returns the builder. The
+// criteria is checked for inconsistent terms when Build is called.
+type SearchCriteriaBuilder struct {
+	criteria SearchCriteria
+	err      error
+}
+
+// NewSearchCriteriaBuilder creates a new SearchCriteriaBuilder. An empty
+// criteria matches all messages.
+func NewSearchCriteriaBuilder() *SearchCriteriaBuilder {
+	return &SearchCriteriaBuilder{}
+}
+
+func (b *SearchCriteriaBuilder) errorf(format string, args ...interface{}) *SearchCriteriaBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("imap: invalid search criteria: "+format, args...)
+	}
+	return b
+}
+
+// SeqNum restricts the search to the provided message sequence numbers.
+func (b *SearchCriteriaBuilder) SeqNum(seqSet SeqSet) *SearchCriteriaBuilder {
+	b.criteria.SeqNum.AddSet(seqSet)
+	return b
+}
+
+// UID restricts the search to the provided message UIDs.
+func (b *SearchCriteriaBuilder) UID(uids SeqSet) *SearchCriteriaBuilder {
+	b.criteria.UID.AddSet(uids)
+	return b
+}
+
+// Since matches messages whose internal date is on or after t.
+func (b *SearchCriteriaBuilder) Since(t time.Time) *SearchCriteriaBuilder {
+	if t.After(b.criteria.Since) {
+		b.criteria.Since = t
+	}
+	return b
+}
+
+// Before matches messages whose internal date is before t.
+func (b *SearchCriteriaBuilder) Before(t time.Time) *SearchCriteriaBuilder {
+	if b.criteria.Before.IsZero() || t.Before(b.criteria.Before) {
+		b.criteria.Before = t
+	}
+	return b
+}
+
+// On matches messages whose internal date is within the day of t.
+func (b *SearchCriteriaBuilder) On(t time.Time) *SearchCriteriaBuilder {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return b.Since(day).Before(day.Add(24 * time.Hour))
+}
+
+// SentSince matches messages whose Date header is on or after t.
+func (b *SearchCriteriaBuilder) SentSince(t time.Time) *SearchCriteriaBuilder {
+	if t.After(b.criteria.SentSince) {
+		b.criteria.SentSince = t
+	}
+	return b
+}
+
+// SentBefore matches messages whose Date header is before t.
+func (b *SearchCriteriaBuilder) SentBefore(t time.Time) *SearchCriteriaBuilder {
+	if b.criteria.SentBefore.IsZero() || t.Before(b.criteria.SentBefore) {
+		b.criteria.SentBefore = t
+	}
+	return b
+}
+
+// SentOn matches messages whose Date header is within the day of t.
+func (b *SearchCriteriaBuilder) SentOn(t time.Time) *SearchCriteriaBuilder {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return b.SentSince(day).SentBefore(day.Add(24 * time.Hour))
+}
+
+// Header matches messages whose header field key contains value.
+func (b *SearchCriteriaBuilder) Header(key, value string) *SearchCriteriaBuilder {
+	if key == "" {
+		return b.errorf("empty header field name")
+	}
+	b.criteria.Header = append(b.criteria.Header, SearchCriteriaHeaderField{
+		Key:   key,
+		Value: value,
+	})
+	return b
+}
+
+// From matches messages whose From header field contains s.
+func (b *SearchCriteriaBuilder) From(s string) *SearchCriteriaBuilder {
+	return b.Header("From", s)
+}
+
+// To matches messages whose To header field contains s.
+func (b *SearchCriteriaBuilder) To(s string) *SearchCriteriaBuilder {
+	return b.Header("To", s)
+}
+
+// Cc matches messages whose Cc header field contains s.
+func (b *SearchCriteriaBuilder) Cc(s string) *SearchCriteriaBuilder {
+	return b.Header("Cc", s)
+}
+
+// Bcc matches messages whose Bcc header field contains s.
+func (b *SearchCriteriaBuilder) Bcc(s string) *SearchCriteriaBuilder {
+	return b.Header("Bcc", s)
+}
+
+// Subject matches messages whose Subject header field contains s.
+func (b *SearchCriteriaBuilder) Subject(s string) *SearchCriteriaBuilder {
+	return b.Header("Subject", s)
+}
+
+// Body matches messages whose body contains s.
+func (b *SearchCriteriaBuilder) Body(s string) *SearchCriteriaBuilder {
+	b.criteria.Body = append(b.criteria.Body, s)
+	return b
+}
+
+// Text matches messages whose header or body contains s.
+func (b *SearchCriteriaBuilder) Text(s string) *SearchCriteriaBuilder {
+	b.criteria.Text = append(b.criteria.Text, s)
+	return b
+}
+
+// Flag matches messages with the flag set.
+func (b *SearchCriteriaBuilder) Flag(flag Flag) *SearchCriteriaBuilder {
+	b.criteria.Flag = append(b.criteria.Flag, flag)
+	return b
+}
+
+// NotFlag matches messages without the flag set.
+func (b *SearchCriteriaBuilder) NotFlag(flag Flag) *SearchCriteriaBuilder {
+	b.criteria.NotFlag = append(b.criteria.NotFlag, flag)
+	return b
+}
+
+// Seen matches messages with the \Seen flag.
+func (b *SearchCriteriaBuilder) Seen() *SearchCriteriaBuilder {
+	return b.Flag(FlagSeen)
+}
+
+// Unseen matches messages without the \Seen flag.
+func (b *SearchCriteriaBuilder) Unseen() *SearchCriteriaBuilder {
+	return b.NotFlag(FlagSeen)
+}
+
+// Answered matches messages with the \Answered flag.
+func (b *SearchCriteriaBuilder) Answered() *SearchCriteriaBuilder {
+	return b.Flag(FlagAnswered)
+}
+
+// Unanswered matches messages without the \Answered flag.
+func (b *SearchCriteriaBuilder) Unanswered() *SearchCriteriaBuilder {
+	return b.NotFlag(FlagAnswered)
+}
+
+// Flagged matches messages with the \Flagged flag.
+func (b *SearchCriteriaBuilder) Flagged() *SearchCriteriaBuilder {
+	return b.Flag(FlagFlagged)
+}
+
+// Unflagged matches messages without the \Flagged flag.
+func (b *SearchCriteriaBuilder) Unflagged() *SearchCriteriaBuilder {
+	return b.NotFlag(FlagFlagged)
+}
+
+// Deleted matches messages with the \Deleted flag.
+func (b *SearchCriteriaBuilder) Deleted() *SearchCriteriaBuilder {
+	return b.Flag(FlagDeleted)
+}
+
+// Undeleted matches messages without the \Deleted flag.
+func (b *SearchCriteriaBuilder) Undeleted() *SearchCriteriaBuilder {
+	return b.NotFlag(FlagDeleted)
+}
+
+// Draft matches messages with the \Draft flag.
+func (b *SearchCriteriaBuilder) Draft() *SearchCriteriaBuilder {
+	return b.Flag(FlagDraft)
+}
+
+// Undraft matches messages without the \Draft flag.
+func (b *SearchCriteriaBuilder) Undraft() *SearchCriteriaBuilder {
+	return b.NotFlag(FlagDraft)
+}
+
+// Larger matches messages whose size is larger than n bytes.
+func (b *SearchCriteriaBuilder) Larger(n int64) *SearchCriteriaBuilder {
+	if n < 0 {
+		return b.errorf("negative LARGER size")
+	}
+	if n > b.criteria.Larger {
+		b.criteria.Larger = n
+	}
+	return b
+}
+
+// Smaller matches messages whose size is smaller than n bytes.
+func (b *SearchCriteriaBuilder) Smaller(n int64) *SearchCriteriaBuilder {
+	if n <= 0 {
+		return b.errorf("non-positive SMALLER size")
+	}
+	if b.criteria.Smaller == 0 || n < b.criteria.Smaller {
+		b.criteria.Smaller = n
+	}
+	return b
+}
+
+// Older matches messages whose internal date is older than d. Requires
+// WITHIN.
+func (b *SearchCriteriaBuilder) Older(d time.Duration) *SearchCriteriaBuilder {
+	if d < time.Second {
+		return b.errorf("OLDER interval is not a positive number of seconds")
+	}
+	if d > b.criteria.Older {
+		b.criteria.Older = d
+	}
+	return b
+}
+
+// Younger matches messages whose internal date is younger than d. Requires
+// WITHIN.
+func (b *SearchCriteriaBuilder) Younger(d time.Duration) *SearchCriteriaBuilder {
+	if d < time.Second {
+		return b.errorf("YOUNGER interval is not a positive number of seconds")
+	}
+	if b.criteria.Younger == 0 || d < b.criteria.Younger {
+		b.criteria.Younger = d
+	}
+	return b
+}
+
+// Not matches messages which don't match the criteria built by other.
+func (b *SearchCriteriaBuilder) Not(other *SearchCriteriaBuilder) *SearchCriteriaBuilder {
+	criteria, err := other.Build()
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.criteria.Not = append(b.criteria.Not, *criteria)
+	return b
+}
+
+// Or matches messages which match the criteria built by either left or
+// right.
+func (b *SearchCriteriaBuilder) Or(left, right *SearchCriteriaBuilder) *SearchCriteriaBuilder {
+	l, err := left.Build()
+	if err != nil {
+		b.err = err
+		return b
+	}
+	r, err := right.Build()
+	if err != nil {
+		b.err = err
+		return b
+	}
+	b.criteria.Or = append(b.criteria.Or, [2]SearchCriteria{*l, *r})
+	return b
+}
+
+// Build returns the search criteria.
+//
+// An error is returned if the criteria contains terms which can never match
+// any message, e.g. a flag which is both required and forbidden.
+func (b *SearchCriteriaBuilder) Build() (*SearchCriteria, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	criteria := b.criteria
+	if err := criteria.validate(); err != nil {
+		return nil, err
+	}
+	return &criteria, nil
+}
+
+func (criteria *SearchCriteria) validate() error {
+	if !criteria.Since.IsZero() && !criteria.Before.IsZero() && !criteria.Since.Before(criteria.Before) {
+		return fmt.Errorf("imap: invalid search criteria: SINCE %v is not before BEFORE %v", criteria.Since.Format(searchDateLayout), criteria.Before.Format(searchDateLayout))
+	}
+	if !criteria.SentSince.IsZero() && !criteria.SentBefore.IsZero() && !criteria.SentSince.Before(criteria.SentBefore) {
+		return fmt.Errorf("imap: invalid search criteria: SENTSINCE %v is not before SENTBEFORE %v", criteria.SentSince.Format(searchDateLayout), criteria.SentBefore.Format(searchDateLayout))
+	}
+	for _, interval := range []struct {
+		key string
+		d   time.Duration
+	}{{"OLDER", criteria.Older}, {"YOUNGER", criteria.Younger}} {
+		if interval.d < 0 || (interval.d > 0 && interval.d < time.Second) {
+			return fmt.Errorf("imap: invalid search criteria: %v interval %v is not a positive number of seconds", interval.key, interval.d)
+		}
+	}
+	if criteria.Older > 0 && criteria.Younger > 0 && criteria.Older >= criteria.Younger {
+		return fmt.Errorf("imap: invalid search criteria: OLDER %v and YOUNGER %v never match", criteria.Older, criteria.Younger)
+	}
+	if criteria.Smaller > 0 && criteria.Larger+1 >= criteria.Smaller {
+		return fmt.Errorf("imap: invalid search criteria: LARGER %v and SMALLER %v never match", criteria.Larger, criteria.Smaller)
+	}
+	for _, flag := range criteria.Flag {
+		for _, notFlag := range criteria.NotFlag {
+			if strings.EqualFold(string(flag), string(notFlag)) {
+				return fmt.Errorf("imap: invalid search criteria: flag %v is both set and unset", flag)
+			}
+		}
+	}
+	return nil
+}
+
+// String returns a human-readable representation of the criteria, using the
+// IMAP search key syntax.
+//
+// Strings are written as IMAP quoted strings, or as literals if they contain
+// NUL, CR or LF. 8-bit characters are left as-is, as in IMAP4rev2.
+func (criteria *SearchCriteria) String() string {
+	var l []string
+	if len(criteria.SeqNum) > 0 {
+		l = append(l, criteria.SeqNum.String())
+	}
+	if len(criteria.UID) > 0 {
+		l = append(l, "UID "+criteria.UID.String())
+	}
+
+	writeDate := func(k string, t time.Time) {
+		if !t.IsZero() {
+			l = append(l, k+" "+t.Format(searchDateLayout))
+		}
+	}
+	writeDate("SINCE", criteria.Since)
+	writeDate("BEFORE", criteria.Before)
+	writeDate("SENTSINCE", criteria.SentSince)
+	writeDate("SENTBEFORE", criteria.SentBefore)
+
+	for _, kv := range criteria.Header {
+		switch k := strings.ToUpper(kv.Key); k {
+		case "BCC", "CC", "FROM", "SUBJECT", "TO":
+			l = append(l, k+" "+searchString(kv.Value))
+		default:
+			l = append(l, "HEADER "+searchString(kv.Key)+" "+searchString(kv.Value))
+		}
+	}
+	for _, s := range criteria.Body {
+		l = append(l, "BODY "+searchString(s))
+	}
+	for _, s := range criteria.Text {
+		l = append(l, "TEXT "+searchString(s))
+	}
+
+	for _, flag := range criteria.Flag {
+		if k := searchFlagKey(flag); k != "" {
+			l = append(l, k)
+		} else {
+			l = append(l, "KEYWORD "+searchFlag(flag))
+		}
+	}
+	for _, flag := range criteria.NotFlag {
+		if k := searchFlagKey(flag); k != "" {
+			l = append(l, "UN"+k)
+		} else {
+			l = append(l, "UNKEYWORD "+searchFlag(flag))
+		}
+	}
+
+	if criteria.Larger > 0 {
+		l = append(l, "LARGER "+strconv.FormatInt(criteria.Larger, 10))
+	}
+	if criteria.Smaller > 0 {
+		l = append(l, "SMALLER "+strconv.FormatInt(criteria.Smaller, 10))
+	}
+	if criteria.ModSeq != nil {
+		l = append(l, criteria.ModSeq.String())
+	}
+	if criteria.Older > 0 {
+		l = append(l, "OLDER "+strconv.FormatInt(int64(criteria.Older/time.Second), 10))
+	}
+	if criteria.Younger > 0 {
+		l = append(l, "YOUNGER "+strconv.FormatInt(int64(criteria.Younger/time.Second), 10))
+	}
+
+	for i := range criteria.Not {
+		l = append(l, "NOT "+criteria.Not[i].nestedString())
+	}
+	for i := range criteria.Or {
+		l = append(l, "OR "+criteria.Or[i][0].nestedString()+" "+criteria.Or[i][1].nestedString())
+	}
+
+	if len(l) == 0 {
+		return "ALL"
+	}
+	return strings.Join(l, " ")
+}
+
+// String returns the MODSEQ search key.
+func (modSeq *SearchCriteriaModSeq) String() string {
+	s := "MODSEQ "
+	if modSeq.MetadataName != "" {
+		s += searchString(modSeq.MetadataName) + " " + string(modSeq.MetadataType) + " "
+	}
+	return s + strconv.FormatUint(modSeq.ModSeq, 10)
+}
+
+func (criteria *SearchCriteria) nestedString() string {
+	s := criteria.String()
+	if strings.ContainsRune(s, ' ') {
+		s = "(" + s + ")"
+	}
+	return s
+}
+
+// searchString formats a string as a quoted string, or as a literal if it
+// can't be quoted.
+func searchString(s string) string {
+	if strings.ContainsAny(s, "\x00\r\n") {
+		return "{" + strconv.Itoa(len(s)) + "}\r\n" + s
+	}
+
+	var sb strings.Builder
+	sb.Grow(2 + len(s))
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch == '"' || ch == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(ch)
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// searchFlag formats a keyword as an atom, or as a string if it contains
+// characters not allowed in atoms.
+func searchFlag(flag Flag) string {
+	if flag == "" {
+		return searchString("")
+	}
+	for i := 0; i < len(flag); i++ {
+		ch := flag[i]
+		if ch <= ' ' || ch >= 0x7F || strings.IndexByte("(){%*\"\\]", ch) >= 0 {
+			return searchString(string(flag))
+		}
+	}
+	return string(flag)
+}
+
+func searchFlagKey(flag Flag) string {
+	switch flag {
+	case FlagAnswered, FlagDeleted, FlagDraft, FlagFlagged, FlagSeen:
+		return strings.ToUpper(strings.TrimPrefix(string(flag), "\\"))
+	default:
+		return ""
+	}
+}
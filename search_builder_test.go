@@ -0,0 +1,73 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchCriteriaBuilder(t *testing.T) {
+	since := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	criteria, err := NewSearchCriteriaBuilder().
+		From("alice@example.org").
+		Unseen().
+		Since(since).
+		Or(NewSearchCriteriaBuilder().Flagged(), NewSearchCriteriaBuilder().Larger(1024)).
+		Not(NewSearchCriteriaBuilder().Subject("spam").Deleted()).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() = %v", err)
+	}
+
+	want := `SINCE 1-Feb-2024 FROM "alice@example.org" UNSEEN NOT (SUBJECT "spam" DELETED) OR FLAGGED (LARGER 1024)`
+	if s := criteria.String(); s != want {
+		t.Errorf("String() = %q, want %q", s, want)
+	}
+}
+
+func TestSearchCriteria_String(t *testing.T) {
+	tests := []struct {
+		criteria SearchCriteria
+		want     string
+	}{
+		{SearchCriteria{}, "ALL"},
+		{SearchCriteria{Body: []string{`say "hi"`}}, `BODY "say \"hi\""`},
+		{SearchCriteria{Text: []string{`C:\dir`}}, `TEXT "C:\\dir"`},
+		{SearchCriteria{Text: []string{"café"}}, `TEXT "café"`},
+		{SearchCriteria{Text: []string{"a\r\nb"}}, "TEXT {4}\r\na\r\nb"},
+		{SearchCriteria{Header: []SearchCriteriaHeaderField{{Key: "X-Spam", Value: ""}}}, `HEADER "X-Spam" ""`},
+		{SearchCriteria{Flag: []Flag{"$Junk"}}, "KEYWORD $Junk"},
+		{SearchCriteria{Flag: []Flag{"my flag"}}, `KEYWORD "my flag"`},
+		{SearchCriteria{NotFlag: []Flag{`a"b`}}, `UNKEYWORD "a\"b"`},
+		{SearchCriteria{NotFlag: []Flag{""}}, `UNKEYWORD ""`},
+	}
+	for _, tc := range tests {
+		if s := tc.criteria.String(); s != tc.want {
+			t.Errorf("String() = %q, want %q", s, tc.want)
+		}
+	}
+}
+
+func TestSearchCriteriaBuilder_invalid(t *testing.T) {
+	day := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		builder *SearchCriteriaBuilder
+	}{
+		{"flag", NewSearchCriteriaBuilder().Seen().Unseen()},
+		{"date", NewSearchCriteriaBuilder().Since(day).Before(day)},
+		{"size", NewSearchCriteriaBuilder().Larger(10).Smaller(11)},
+		{"nested", NewSearchCriteriaBuilder().Not(NewSearchCriteriaBuilder().Flagged().Unflagged())},
+		{"header", NewSearchCriteriaBuilder().Header("", "x")},
+		{"older", NewSearchCriteriaBuilder().Older(-time.Hour)},
+		{"younger", NewSearchCriteriaBuilder().Younger(time.Millisecond)},
+		{"within", NewSearchCriteriaBuilder().Older(time.Hour).Younger(time.Minute)},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.builder.Build(); err == nil {
+				t.Errorf("Build() = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+package imap
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Optimize returns a simplified copy of the criteria, matching the same
+// messages.
+//
+// Double negations are removed and the negated criteria are merged into
+// their parent, sequence number and UID sets are merged, and duplicate keys
+// are dropped. If this makes the criteria cheaper to evaluate, nested NOT
+// and OR keys are also sorted so that the cheapest ones come first.
+// Otherwise, the keys are left in their original order.
+func (criteria *SearchCriteria) Optimize() *SearchCriteria {
+	out := criteria.simplify()
+	if out.cost() < criteria.cost() {
+		out.reorder()
+	}
+	return out
+}
+
+func (criteria *SearchCriteria) simplify() *SearchCriteria {
+	var out SearchCriteria
+	out.andFields(criteria)
+	out.Not = append(out.Not, criteria.Not...)
+	out.Or = append(out.Or, criteria.Or...)
+	out.normalize()
+	return &out
+}
+
+// normalize simplifies the NOT and OR keys, without changing their order.
+// The receiver must not share the Not and Or slices with the caller.
+func (criteria *SearchCriteria) normalize() {
+	pendingNot, pendingOr := criteria.Not, criteria.Or
+	criteria.Not, criteria.Or = nil, nil
+
+	for len(pendingNot) > 0 || len(pendingOr) > 0 {
+		if len(pendingNot) > 0 {
+			inner := pendingNot[0].simplify()
+			pendingNot = pendingNot[1:]
+
+			// NOT (NOT x) is x
+			if inner.onlyNot() && len(inner.Not) == 1 && criteria.canAnd(&inner.Not[0]) {
+				x := &inner.Not[0]
+				criteria.andFields(x)
+				pendingNot = append(pendingNot, x.Not...)
+				pendingOr = append(pendingOr, x.Or...)
+			} else {
+				criteria.Not = append(criteria.Not, *inner)
+			}
+			continue
+		}
+
+		left, right := pendingOr[0][0].simplify(), pendingOr[0][1].simplify()
+		pendingOr = pendingOr[1:]
+
+		if union, ok := orNumSets(left, right); ok && criteria.canAnd(union) {
+			criteria.andFields(union)
+			continue
+		}
+		criteria.Or = append(criteria.Or, [2]SearchCriteria{*left, *right})
+	}
+}
+
+// reorder sorts the NOT and OR keys so that the cheapest ones come first.
+// Keys with the same cost keep their order.
+func (criteria *SearchCriteria) reorder() {
+	for i := range criteria.Not {
+		criteria.Not[i].reorder()
+	}
+	for i := range criteria.Or {
+		or := &criteria.Or[i]
+		or[0].reorder()
+		or[1].reorder()
+		if or[0].cost() > or[1].cost() {
+			or[0], or[1] = or[1], or[0]
+		}
+	}
+
+	sort.SliceStable(criteria.Not, func(i, j int) bool {
+		return criteria.Not[i].cost() < criteria.Not[j].cost()
+	})
+	sort.SliceStable(criteria.Or, func(i, j int) bool {
+		return criteria.Or[i][0].cost()+criteria.Or[i][1].cost() < criteria.Or[j][0].cost()+criteria.Or[j][1].cost()
+	})
+}
+
+// onlyNot returns true if the criteria only contains NOT keys.
+func (criteria *SearchCriteria) onlyNot() bool {
+	other := *criteria
+	other.Not = nil
+	return len(criteria.Not) > 0 && other.isEmpty()
+}
+
+func (criteria *SearchCriteria) isEmpty() bool {
+	return len(criteria.SeqNum) == 0 && len(criteria.UID) == 0 &&
+		criteria.Since.IsZero() && criteria.Before.IsZero() &&
+		criteria.SentSince.IsZero() && criteria.SentBefore.IsZero() &&
+		len(criteria.Header) == 0 && len(criteria.Body) == 0 && len(criteria.Text) == 0 &&
+		len(criteria.Flag) == 0 && len(criteria.NotFlag) == 0 &&
+		criteria.Larger == 0 && criteria.Smaller == 0 && criteria.ModSeq == nil &&
+		criteria.Older == 0 && criteria.Younger == 0 &&
+		len(criteria.Not) == 0 && len(criteria.Or) == 0
+}
+
+// canAnd checks whether the keys of other can be merged into criteria.
+// Dynamic sequence sets cannot be intersected, an empty intersection cannot
+// be represented, and only one MODSEQ key is allowed.
+func (criteria *SearchCriteria) canAnd(other *SearchCriteria) bool {
+	if criteria.ModSeq != nil && other.ModSeq != nil && *criteria.ModSeq != *other.ModSeq {
+		return false
+	}
+	_, ok := intersectSeqSet(criteria.SeqNum, other.SeqNum)
+	if !ok {
+		return false
+	}
+	_, ok = intersectSeqSet(criteria.UID, other.UID)
+	return ok
+}
+
+// andFields merges the keys of other into criteria, except NOT and OR keys.
+// canAnd must return true.
+func (criteria *SearchCriteria) andFields(other *SearchCriteria) {
+	criteria.SeqNum, _ = intersectSeqSet(criteria.SeqNum, other.SeqNum)
+	criteria.UID, _ = intersectSeqSet(criteria.UID, other.UID)
+
+	criteria.Since = laterTime(criteria.Since, other.Since)
+	criteria.Before = earlierTime(criteria.Before, other.Before)
+	criteria.SentSince = laterTime(criteria.SentSince, other.SentSince)
+	criteria.SentBefore = earlierTime(criteria.SentBefore, other.SentBefore)
+
+	for _, kv := range other.Header {
+		if !hasHeaderField(criteria.Header, kv) {
+			criteria.Header = append(criteria.Header, kv)
+		}
+	}
+	criteria.Body = appendUniqueStrings(criteria.Body, other.Body)
+	criteria.Text = appendUniqueStrings(criteria.Text, other.Text)
+	criteria.Flag = appendUniqueFlags(criteria.Flag, other.Flag)
+	criteria.NotFlag = appendUniqueFlags(criteria.NotFlag, other.NotFlag)
+
+	if other.Larger > criteria.Larger {
+		criteria.Larger = other.Larger
+	}
+	if other.Smaller > 0 && (criteria.Smaller == 0 || other.Smaller < criteria.Smaller) {
+		criteria.Smaller = other.Smaller
+	}
+	if other.Older > criteria.Older {
+		criteria.Older = other.Older
+	}
+	if other.Younger > 0 && (criteria.Younger == 0 || other.Younger < criteria.Younger) {
+		criteria.Younger = other.Younger
+	}
+	if other.ModSeq != nil {
+		modSeq := *other.ModSeq
+		criteria.ModSeq = &modSeq
+	}
+}
+
+// orNumSets returns the union of two criteria which only contain sequence
+// numbers, or only contain UIDs.
+func orNumSets(left, right *SearchCriteria) (*SearchCriteria, bool) {
+	leftSeqNum, leftUID := left.SeqNum, left.UID
+	rightSeqNum, rightUID := right.SeqNum, right.UID
+	l, r := *left, *right
+	l.SeqNum, l.UID, r.SeqNum, r.UID = nil, nil, nil, nil
+	if !l.isEmpty() || !r.isEmpty() {
+		return nil, false
+	}
+
+	var union SearchCriteria
+	switch {
+	case len(leftUID) == 0 && len(rightUID) == 0 && len(leftSeqNum) > 0 && len(rightSeqNum) > 0:
+		union.SeqNum.AddSet(leftSeqNum)
+		union.SeqNum.AddSet(rightSeqNum)
+	case len(leftSeqNum) == 0 && len(rightSeqNum) == 0 && len(leftUID) > 0 && len(rightUID) > 0:
+		union.UID.AddSet(leftUID)
+		union.UID.AddSet(rightUID)
+	default:
+		return nil, false
+	}
+	return &union, true
+}
+
+// cost estimates how expensive it is for a server to evaluate the criteria.
+func (criteria *SearchCriteria) cost() int {
+	n := 0
+	if len(criteria.SeqNum) > 0 {
+		n++
+	}
+	if len(criteria.UID) > 0 {
+		n++
+	}
+	n += len(criteria.Flag) + len(criteria.NotFlag)
+	if criteria.Larger > 0 {
+		n++
+	}
+	if criteria.Smaller > 0 {
+		n++
+	}
+	if criteria.ModSeq != nil {
+		n++
+	}
+	for _, t := range []time.Time{criteria.Since, criteria.Before, criteria.SentSince, criteria.SentBefore} {
+		if !t.IsZero() {
+			n += 2
+		}
+	}
+	for _, d := range []time.Duration{criteria.Older, criteria.Younger} {
+		if d > 0 {
+			n += 2
+		}
+	}
+	n += 10 * len(criteria.Header)
+	n += 100 * (len(criteria.Body) + len(criteria.Text))
+	for i := range criteria.Not {
+		n += criteria.Not[i].cost()
+	}
+	for i := range criteria.Or {
+		n += criteria.Or[i][0].cost() + criteria.Or[i][1].cost()
+	}
+	return n
+}
+
+// intersectSeqSet returns the intersection of two sequence sets. An empty
+// set matches all messages. ok is false if a set is dynamic, or if the
+// intersection is empty.
+func intersectSeqSet(a, b SeqSet) (out SeqSet, ok bool) {
+	if len(a) == 0 {
+		return append(SeqSet(nil), b...), true
+	} else if len(b) == 0 {
+		return append(SeqSet(nil), a...), true
+	} else if a.Dynamic() || b.Dynamic() {
+		return nil, false
+	}
+
+	for _, s := range a.Canonical() {
+		for _, t := range b.Canonical() {
+			start, stop := s.Start, s.Stop
+			if t.Start > start {
+				start = t.Start
+			}
+			if t.Stop < stop {
+				stop = t.Stop
+			}
+			if start <= stop {
+				out.AddRange(start, stop)
+			}
+		}
+	}
+	return out, len(out) > 0
+}
+
+func hasHeaderField(l []SearchCriteriaHeaderField, kv SearchCriteriaHeaderField) bool {
+	for _, other := range l {
+		if strings.EqualFold(other.Key, kv.Key) && other.Value == kv.Value {
+			return true
+		}
+	}
+	return false
+}
+
+func appendUniqueStrings(l, other []string) []string {
+	for _, s := range other {
+		found := false
+		for _, v := range l {
+			if v == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l = append(l, s)
+		}
+	}
+	return l
+}
+
+func appendUniqueFlags(l, other []Flag) []Flag {
+	for _, flag := range other {
+		found := false
+		for _, v := range l {
+			if strings.EqualFold(string(v), string(flag)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			l = append(l, flag)
+		}
+	}
+	return l
+}
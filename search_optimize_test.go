@@ -0,0 +1,83 @@
+package imap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSearchCriteria_Optimize(t *testing.T) {
+	tests := []struct {
+		criteria *SearchCriteria
+		want     string
+	}{
+		{
+			criteria: &SearchCriteria{
+				UID: SeqSetRange(1, 10),
+				Not: []SearchCriteria{{Not: []SearchCriteria{{UID: SeqSetRange(5, 20)}}}},
+			},
+			want: `UID 5:10`,
+		},
+		{
+			criteria: &SearchCriteria{
+				Or: [][2]SearchCriteria{{
+					{UID: SeqSetNum(1, 2)},
+					{UID: SeqSetNum(3, 4)},
+				}},
+			},
+			want: `UID 1:4`,
+		},
+		{
+			criteria: &SearchCriteria{
+				Flag: []Flag{FlagSeen, "\\seen"},
+				Body: []string{"hello", "hello"},
+			},
+			want: `BODY "hello" SEEN`,
+		},
+		{
+			criteria: &SearchCriteria{
+				Or: [][2]SearchCriteria{{
+					{Body: []string{"hello"}},
+					{Flag: []Flag{FlagFlagged}},
+				}},
+			},
+			want: `OR (BODY "hello") FLAGGED`,
+		},
+		{
+			criteria: &SearchCriteria{
+				Body: []string{"hello", "hello"},
+				Or: [][2]SearchCriteria{{
+					{Body: []string{"hello"}},
+					{Flag: []Flag{FlagFlagged}},
+				}},
+			},
+			want: `BODY "hello" OR FLAGGED (BODY "hello")`,
+		},
+		{
+			criteria: &SearchCriteria{
+				Older: time.Hour,
+				Not:   []SearchCriteria{{Not: []SearchCriteria{{Older: 2 * time.Hour, Younger: 3 * time.Hour}}}},
+			},
+			want: `OLDER 7200 YOUNGER 10800`,
+		},
+		{
+			criteria: &SearchCriteria{
+				SeqNum: SeqSetRange(1, 10),
+				Not:    []SearchCriteria{{Not: []SearchCriteria{{SeqNum: SeqSetRange(5, 0)}}}},
+			},
+			want: `1:10 NOT (NOT 5:*)`,
+		},
+		{
+			criteria: &SearchCriteria{
+				Not: []SearchCriteria{{Not: []SearchCriteria{{
+					ModSeq: &SearchCriteriaModSeq{ModSeq: 42, MetadataName: "/flags/\\draft", MetadataType: SearchCriteriaMetadataAll},
+				}}}},
+			},
+			want: `MODSEQ "/flags/\\draft" all 42`,
+		},
+	}
+	for _, tc := range tests {
+		if s := tc.criteria.Optimize().String(); s != tc.want {
+			t.Errorf("Optimize(%q) = %q, want %q", tc.criteria.String(), s, tc.want)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+package imap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// and intersects two search criteria.
+func (criteria *SearchCriteria) and(other *SearchCriteria) {
+	if len(other.SeqNum) > 0 {
+		if len(criteria.SeqNum) > 0 {
+			criteria.Not = append(criteria.Not, SearchCriteria{
+				Not: []SearchCriteria{{SeqNum: other.SeqNum}},
+			})
+		} else {
+			criteria.SeqNum = other.SeqNum
+		}
+	}
+	if len(other.UID) > 0 {
+		if len(criteria.UID) > 0 {
+			criteria.Not = append(criteria.Not, SearchCriteria{
+				Not: []SearchCriteria{{UID: other.UID}},
+			})
+		} else {
+			criteria.UID = other.UID
+		}
+	}
+
+	criteria.Since = laterTime(criteria.Since, other.Since)
+	criteria.Before = earlierTime(criteria.Before, other.Before)
+	criteria.SentSince = laterTime(criteria.SentSince, other.SentSince)
+	criteria.SentBefore = earlierTime(criteria.SentBefore, other.SentBefore)
+
+	criteria.Header = append(criteria.Header, other.Header...)
+	criteria.Body = append(criteria.Body, other.Body...)
+	criteria.Text = append(criteria.Text, other.Text...)
+
+	criteria.Flag = append(criteria.Flag, other.Flag...)
+	criteria.NotFlag = append(criteria.NotFlag, other.NotFlag...)
+
+	if other.Larger > criteria.Larger {
+		criteria.Larger = other.Larger
+	}
+	if other.Smaller > 0 && (criteria.Smaller == 0 || other.Smaller < criteria.Smaller) {
+		criteria.Smaller = other.Smaller
+	}
+	if other.Older > criteria.Older {
+		criteria.Older = other.Older
+	}
+	if other.Younger > 0 && (criteria.Younger == 0 || other.Younger < criteria.Younger) {
+		criteria.Younger = other.Younger
+	}
+
+	criteria.Not = append(criteria.Not, other.Not...)
+	criteria.Or = append(criteria.Or, other.Or...)
+}
+
+func laterTime(t1, t2 time.Time) time.Time {
+	if t2.After(t1) {
+		return t2
+	}
+	return t1
+}
+
+func earlierTime(t1, t2 time.Time) time.Time {
+	if t1.IsZero() || (!t2.IsZero() && t2.Before(t1)) {
+		return t2
+	}
+	return t1
+}
+
+// ParseSearchQuery parses a user-typed search query into search criteria.
+//
+// The syntax is similar to the one used by popular webmail clients. A query
+// is a list of terms separated by spaces, which must all match. Terms can be
+// negated with a "-" prefix, combined with "OR" and grouped with
+// parentheses. Values containing spaces can be double-quoted. The following
+// terms are supported:
+//
+//	word             header or body contains word
+//	from:, to:, cc:, bcc:, subject:
+//	                 header field contains value
+//	body:            body contains value
+//	before:, after:, on:
+//	                 internal date, formatted as YYYY-MM-DD
+//	larger:, smaller:
+//	                 message size in bytes, with an optional K or M suffix
+//	is:              one of seen, read, unread, answered, flagged, starred,
+//	                 deleted, draft
+//	flag:            message has the flag or keyword set
+//	has:attachment   message is multipart/mixed
+//
+// has:attachment is an approximation, since IMAP SEARCH cannot inspect the
+// MIME structure of a message.
+func ParseSearchQuery(s string) (*SearchCriteria, error) {
+	tokens, err := tokenizeSearchQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	p := searchQueryParser{tokens: tokens}
+	criteria, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) > 0 {
+		return nil, fmt.Errorf("imap: invalid search query: unexpected %q", ")")
+	}
+	if err := criteria.validate(); err != nil {
+		return nil, err
+	}
+	return criteria, nil
+}
+
+type searchQueryTokenKind int
+
+const (
+	searchQueryTokenTerm searchQueryTokenKind = iota
+	searchQueryTokenOr
+	searchQueryTokenNot
+	searchQueryTokenOpen
+	searchQueryTokenClose
+)
+
+type searchQueryToken struct {
+	kind       searchQueryTokenKind
+	key, value string
+}
+
+func tokenizeSearchQuery(s string) ([]searchQueryToken, error) {
+	var tokens []searchQueryToken
+	r := []rune(s)
+	for i := 0; i < len(r); {
+		switch ch := r[i]; {
+		case unicode.IsSpace(ch):
+			i++
+			continue
+		case ch == '(':
+			tokens = append(tokens, searchQueryToken{kind: searchQueryTokenOpen})
+			i++
+			continue
+		case ch == ')':
+			tokens = append(tokens, searchQueryToken{kind: searchQueryTokenClose})
+			i++
+			continue
+		case ch == '-' && i+1 < len(r) && !unicode.IsSpace(r[i+1]):
+			tokens = append(tokens, searchQueryToken{kind: searchQueryTokenNot})
+			i++
+			continue
+		}
+
+		var (
+			key, value   strings.Builder
+			hasKey       bool
+			quoted, seen bool
+		)
+		cur := &value
+		for ; i < len(r); i++ {
+			ch := r[i]
+			if quoted {
+				switch {
+				case ch == '\\' && i+1 < len(r):
+					i++
+					cur.WriteRune(r[i])
+				case ch == '"':
+					quoted = false
+				default:
+					cur.WriteRune(ch)
+				}
+				continue
+			}
+			if unicode.IsSpace(ch) || ch == '(' || ch == ')' {
+				break
+			}
+			switch {
+			case ch == '"':
+				quoted, seen = true, true
+			case ch == ':' && !hasKey && !seen:
+				hasKey = true
+				key.WriteString(value.String())
+				value.Reset()
+			default:
+				cur.WriteRune(ch)
+			}
+		}
+		if quoted {
+			return nil, fmt.Errorf("imap: invalid search query: unterminated quoted string")
+		}
+
+		tok := searchQueryToken{
+			kind:  searchQueryTokenTerm,
+			key:   strings.ToLower(key.String()),
+			value: value.String(),
+		}
+		if !hasKey && !seen && tok.value == "OR" {
+			tok.kind = searchQueryTokenOr
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens, nil
+}
+
+type searchQueryParser struct {
+	tokens []searchQueryToken
+}
+
+func (p *searchQueryParser) peek() *searchQueryToken {
+	if len(p.tokens) == 0 {
+		return nil
+	}
+	return &p.tokens[0]
+}
+
+func (p *searchQueryParser) next() searchQueryToken {
+	tok := p.tokens[0]
+	p.tokens = p.tokens[1:]
+	return tok
+}
+
+func (p *searchQueryParser) parseAnd() (*SearchCriteria, error) {
+	var criteria SearchCriteria
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind == searchQueryTokenClose {
+			return &criteria, nil
+		}
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		criteria.and(c)
+	}
+}
+
+func (p *searchQueryParser) parseOr() (*SearchCriteria, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok == nil || tok.kind != searchQueryTokenOr {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &SearchCriteria{Or: [][2]SearchCriteria{{*left, *right}}}
+	}
+}
+
+func (p *searchQueryParser) parseUnary() (*SearchCriteria, error) {
+	tok := p.peek()
+	if tok == nil {
+		return nil, fmt.Errorf("imap: invalid search query: unexpected end of query")
+	}
+	switch tok.kind {
+	case searchQueryTokenNot:
+		p.next()
+		c, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchCriteria{Not: []SearchCriteria{*c}}, nil
+	case searchQueryTokenOpen:
+		p.next()
+		c, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if tok := p.peek(); tok == nil || tok.kind != searchQueryTokenClose {
+			return nil, fmt.Errorf("imap: invalid search query: missing %q", ")")
+		}
+		p.next()
+		return c, nil
+	case searchQueryTokenTerm:
+		p.next()
+		return parseSearchQueryTerm(tok.key, tok.value)
+	default:
+		return nil, fmt.Errorf("imap: invalid search query: unexpected %q", p.next().String())
+	}
+}
+
+func (tok searchQueryToken) String() string {
+	switch tok.kind {
+	case searchQueryTokenOr:
+		return "OR"
+	case searchQueryTokenNot:
+		return "-"
+	case searchQueryTokenOpen:
+		return "("
+	case searchQueryTokenClose:
+		return ")"
+	}
+	if tok.key != "" {
+		return tok.key + ":" + tok.value
+	}
+	return tok.value
+}
+
+func parseSearchQueryTerm(key, value string) (*SearchCriteria, error) {
+	if key != "" && value == "" {
+		return nil, fmt.Errorf("imap: invalid search query: missing value for %q", key+":")
+	}
+
+	b := NewSearchCriteriaBuilder()
+	switch key {
+	case "":
+		b.Text(value)
+	case "from", "to", "cc", "bcc", "subject":
+		b.Header(strings.ToUpper(key[:1])+key[1:], value)
+	case "body":
+		b.Body(value)
+	case "before", "after", "on":
+		t, err := parseSearchQueryDate(value)
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "before":
+			b.Before(t)
+		case "after":
+			b.Since(t)
+		case "on":
+			b.On(t)
+		}
+	case "larger", "smaller":
+		n, err := parseSearchQuerySize(value)
+		if err != nil {
+			return nil, err
+		}
+		if key == "larger" {
+			b.Larger(n)
+		} else {
+			b.Smaller(n)
+		}
+	case "is":
+		switch strings.ToLower(value) {
+		case "seen", "read":
+			b.Seen()
+		case "unread", "unseen":
+			b.Unseen()
+		case "answered":
+			b.Answered()
+		case "flagged", "starred":
+			b.Flagged()
+		case "deleted":
+			b.Deleted()
+		case "draft":
+			b.Draft()
+		default:
+			return nil, fmt.Errorf("imap: invalid search query: unknown term %q", "is:"+value)
+		}
+	case "flag":
+		b.Flag(parseSearchQueryFlag(value))
+	case "has":
+		if !strings.EqualFold(value, "attachment") {
+			return nil, fmt.Errorf("imap: invalid search query: unknown term %q", "has:"+value)
+		}
+		b.Header("Content-Type", "multipart/mixed")
+	default:
+		return nil, fmt.Errorf("imap: invalid search query: unknown key %q", key)
+	}
+	return b.Build()
+}
+
+func parseSearchQueryDate(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006/01/02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("imap: invalid search query: invalid date %q", s)
+}
+
+func parseSearchQuerySize(s string) (int64, error) {
+	mult := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"), strings.HasSuffix(s, "k"):
+		mult = 1024
+	case strings.HasSuffix(s, "M"), strings.HasSuffix(s, "m"):
+		mult = 1024 * 1024
+	}
+	if mult != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("imap: invalid search query: invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+func parseSearchQueryFlag(s string) Flag {
+	for _, flag := range []Flag{FlagSeen, FlagAnswered, FlagFlagged, FlagDeleted, FlagDraft} {
+		if strings.EqualFold(s, string(flag)) || strings.EqualFold(s, string(flag)[1:]) {
+			return flag
+		}
+	}
+	return Flag(s)
+}
@@ -0,0 +1,57 @@
+package imap
+
+import (
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{``, `ALL`},
+		{`hello`, `TEXT "hello"`},
+		{`from:alice subject:"hello world" before:2024-01-01 has:attachment -flag:seen`, `BEFORE 1-Jan-2024 FROM "alice" SUBJECT "hello world" HEADER "Content-Type" "multipart/mixed" NOT SEEN`},
+		{`is:unread larger:2K`, `UNSEEN LARGER 2048`},
+		{`from:alice OR from:bob`, `OR (FROM "alice") (FROM "bob")`},
+		{`-(is:starred to:carol)`, `NOT (TO "carol" FLAGGED)`},
+		{`flag:$Junk`, `KEYWORD $Junk`},
+		{`larger:8796093022207M`, `LARGER 9223372036853727232`},
+		{`is:seen after:2024-01-01 after:2024-02-01 before:2024-03-01 before:2024-04-01`, `SINCE 1-Feb-2024 BEFORE 1-Mar-2024 SEEN`},
+		{`larger:1K larger:2K smaller:10K smaller:5K`, `LARGER 2048 SMALLER 5120`},
+		{`from:alice from:bob`, `FROM "alice" FROM "bob"`},
+	}
+	for _, tc := range tests {
+		criteria, err := ParseSearchQuery(tc.query)
+		if err != nil {
+			t.Errorf("ParseSearchQuery(%q) = %v", tc.query, err)
+			continue
+		}
+		if s := criteria.String(); s != tc.want {
+			t.Errorf("ParseSearchQuery(%q) = %q, want %q", tc.query, s, tc.want)
+		}
+	}
+}
+
+func TestParseSearchQuery_invalid(t *testing.T) {
+	for _, query := range []string{
+		`from:"alice`,
+		`before:yesterday`,
+		`is:bogus`,
+		`unknown:key`,
+		`(is:seen`,
+		`is:seen)`,
+		`OR is:seen`,
+		`is:seen is:unseen`,
+		`from:`,
+		`from: alice`,
+		`subject:""`,
+		`larger:`,
+		`larger:9223372036854775807K`,
+		`smaller:-1`,
+	} {
+		if _, err := ParseSearchQuery(query); err == nil {
+			t.Errorf("ParseSearchQuery(%q) = nil, want error", query)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package imap
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchData_AllNums(t *testing.T) {
+	data := &SearchData{All: SeqSet{{7, 7}, {1, 3}, {2, 2}, {5, 5}}}
+	want := []uint32{1, 2, 3, 5, 7}
+	if got := data.AllNums(); !reflect.DeepEqual(got, want) {
+		t.Errorf("AllNums() = %v, want %v", got, want)
+	}
+}
@@ -5,13 +5,21 @@ package imap
 // In the old RFC 2060, PermanentFlags, UIDNext and UIDValidity are optional.
 type SelectData struct {
 	// Flags defined for this mailbox
-	Flags []Flag
+	Flags []Flag `json:"flags,omitempty"`
 	// Flags that the client can change permanently
-	PermanentFlags []Flag
+	PermanentFlags []Flag `json:"permanentFlags,omitempty"`
 	// Number of messages in this mailbox (aka. "EXISTS")
-	NumMessages uint32
-	UIDNext     uint32
-	UIDValidity uint32
+	NumMessages uint32 `json:"numMessages"`
+	UIDNext     uint32 `json:"uidNext,omitempty"`
+	UIDValidity uint32 `json:"uidValidity,omitempty"`
+	// UIDs aren't persistent across sessions, see RFC 4315 section 3
+	UIDNotSticky bool `json:"uidNotSticky,omitempty"`
 
-	List *ListData // requires IMAP4rev2
+	HighestModSeq uint64 `json:"highestModSeq,omitempty"` // requires CONDSTORE
+
+	List *ListData `json:"list,omitempty"` // requires IMAP4rev2
+
+	// Deprecated: RECENT has been removed in IMAP4rev2. It's only returned
+	// by IMAP4rev1 servers.
+	NumRecent uint32 `json:"numRecent,omitempty"`
 }
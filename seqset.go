@@ -124,29 +124,102 @@ func (s Seq) append(nums []uint32) (out []uint32, ok bool) {
 	if s.Start == 0 || s.Stop == 0 {
 		return nil, false
 	}
-	for n := s.Start; n <= s.Stop; n++ {
+	for n := s.Start; ; n++ {
 		nums = append(nums, n)
+		if n == s.Stop {
+			// n++ would overflow when Stop is the maximum uint32 value
+			break
+		}
 	}
 	return nums, true
 }
 
+// count returns the number of values contained in a static seq.
+func (s Seq) count() uint64 {
+	return uint64(s.Stop) - uint64(s.Start) + 1
+}
+
 // SeqSet is used to represent a set of message sequence numbers or UIDs (see
 // sequence-set ABNF rule). The zero value is an empty set.
 type SeqSet []Seq
 
-// ParseSeqSet returns a new SeqSet after parsing the set string.
+// ParseSeqSet returns a new SeqSet after parsing the set string, with the
+// limits in DefaultSeqSetParseOptions.
 func ParseSeqSet(set string) (SeqSet, error) {
-	var s SeqSet
+	return ParseSeqSetWithOptions(set, &DefaultSeqSetParseOptions)
+}
+
+// SeqSetParseOptions contains options for ParseSeqSetWithOptions.
+type SeqSetParseOptions struct {
+	// Maximum number of comma-separated values, zero means no limit
+	MaxValues int
+	// Maximum number of numbers contained in the static values of the set,
+	// zero means no limit
+	MaxNums uint64
+	// Reject ranges whose start is greater than their stop (e.g. "5:1")
+	// instead of swapping them
+	RejectReversed bool
+}
+
+// DefaultSeqSetParseOptions contains the limits used by ParseSeqSet, and
+// applied to sequence sets received by clients and servers unless configured
+// otherwise.
+//
+// Static ranges such as "1:4294967295" are valid and commonly used, so the
+// number of contained numbers isn't limited.
+var DefaultSeqSetParseOptions = SeqSetParseOptions{
+	MaxValues: 100000,
+}
+
+// ParseSeqSetWithOptions returns a new SeqSet after parsing the set string,
+// rejecting pathological inputs as specified by options. A nil options
+// doesn't apply any limit.
+func ParseSeqSetWithOptions(set string, options *SeqSetParseOptions) (SeqSet, error) {
+	if options == nil {
+		options = new(SeqSetParseOptions)
+	}
+	if options.MaxValues > 0 && strings.Count(set, ",") >= options.MaxValues {
+		return nil, fmt.Errorf("imap: sequence set has too many values (limit is %v)", options.MaxValues)
+	}
+
+	var (
+		s    SeqSet
+		nums uint64
+	)
 	for _, sv := range strings.Split(set, ",") {
 		v, err := parseSeq(sv)
 		if err != nil {
 			return s, err
 		}
+		if options.RejectReversed && isReversedSeq(sv) {
+			return s, fmt.Errorf("imap: reversed range in sequence set %q", sv)
+		}
+		if options.MaxNums > 0 && v.Start != 0 && v.Stop != 0 {
+			nums += v.count()
+			if nums > options.MaxNums {
+				return s, fmt.Errorf("imap: sequence set contains too many numbers (limit is %v)", options.MaxNums)
+			}
+		}
 		s.insert(v)
 	}
 	return s, nil
 }
 
+// isReversedSeq checks whether the raw seq-range v has its start after its
+// stop. v must be a valid seq-number or seq-range.
+func isReversedSeq(v string) bool {
+	sep := strings.IndexByte(v, ':')
+	if sep < 0 {
+		return false
+	}
+	start, _ := parseSeqNum(v[:sep])
+	stop, _ := parseSeqNum(v[sep+1:])
+	if start == 0 {
+		return stop != 0 // "*:n"
+	}
+	return stop != 0 && stop < start
+}
+
 // SeqSetNum returns a new SeqSet containing the sequence numbers.
 func SeqSetNum(q ...uint32) SeqSet {
 	var s SeqSet
@@ -213,10 +286,15 @@ func (s SeqSet) Nums() (nums []uint32, ok bool) {
 }
 
 // String returns a sorted representation of all contained sequence values.
+//
+// Overlapping and adjacent values are merged.
 func (s SeqSet) String() string {
 	if len(s) == 0 {
 		return ""
 	}
+	if !s.canonical() {
+		s = s.Canonical()
+	}
 	b := make([]byte, 0, 64)
 	for _, v := range s {
 		b = append(b, ',')
@@ -236,6 +314,179 @@ func (s SeqSet) String() string {
 	return string(b[1:])
 }
 
+// Canonical returns a copy of the set with values sorted and overlapping or
+// adjacent values merged.
+//
+// Sets populated via ParseSeqSet and the Add methods are always canonical.
+// This is only necessary for sets constructed by hand.
+func (s SeqSet) Canonical() SeqSet {
+	var out SeqSet
+	for _, v := range s {
+		out.AddRange(v.Start, v.Stop)
+	}
+	return out
+}
+
+// SeqSetFromNums returns a new SeqSet containing the sequence numbers, with
+// consecutive numbers merged into ranges.
+//
+// This is equivalent to SeqSetNum, but runs in linear time if nums is sorted
+// in increasing order. Unsorted input and duplicates are accepted.
+func SeqSetFromNums(nums []uint32) SeqSet {
+	var s SeqSet
+	for _, n := range nums {
+		i := len(s) - 1
+		switch {
+		case n == 0 || i < 0 || s[i].Stop == 0 || n < s[i].Start:
+			s.insert(Seq{n, n})
+		case n <= s[i].Stop:
+			// duplicate
+		case n == s[i].Stop+1:
+			s[i].Stop = n
+		default:
+			s = append(s, Seq{n, n})
+		}
+	}
+	return s
+}
+
+// Coalesce returns a copy of the set where sequence values separated by at
+// most maxGap missing numbers are merged into a single range. The result is a
+// superset of s with fewer values.
+//
+// This is useful to shorten UID sets: servers ignore UIDs which don't exist.
+func (s SeqSet) Coalesce(maxGap uint32) SeqSet {
+	if !s.canonical() {
+		s = s.Canonical()
+	}
+	var out SeqSet
+	for _, v := range s {
+		if i := len(out) - 1; i >= 0 && v.Start != 0 && out[i].Stop != 0 && uint64(v.Start)-uint64(out[i].Stop)-1 <= uint64(maxGap) {
+			out[i].Stop = v.Stop
+		} else {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Split splits the set into sets containing at most n sequence values each,
+// e.g. to stay below a server's command length limit. The sets are sorted.
+func (s SeqSet) Split(n int) []SeqSet {
+	if n <= 0 {
+		panic("imap: SeqSet.Split called with non-positive n")
+	}
+	if !s.canonical() {
+		s = s.Canonical()
+	}
+	var l []SeqSet
+	for len(s) > n {
+		l = append(l, s[:n:n])
+		s = s[n:]
+	}
+	if len(s) > 0 {
+		l = append(l, s)
+	}
+	return l
+}
+
+// SplitLength splits the set into sets whose IMAP representation is at most
+// n bytes long, e.g. to stay below a server's command length limit. The sets
+// are sorted. A single sequence value longer than n bytes gets its own set.
+func (s SeqSet) SplitLength(n int) []SeqSet {
+	if n <= 0 {
+		panic("imap: SeqSet.SplitLength called with non-positive n")
+	}
+	if !s.canonical() {
+		s = s.Canonical()
+	}
+	var (
+		l      []SeqSet
+		start  int
+		length int
+	)
+	for i, v := range s {
+		size := len(v.String())
+		if i > start {
+			size++ // comma
+		}
+		if i > start && length+size > n {
+			l = append(l, s[start:i:i])
+			start, length = i, 0
+			size--
+		}
+		length += size
+	}
+	if start < len(s) {
+		l = append(l, s[start:])
+	}
+	return l
+}
+
+// Complement returns the numbers between min and max inclusive which aren't
+// contained in the set.
+//
+// The dynamic range "n:*" contains all numbers greater than or equal to n.
+// The dynamic value "*" is ignored.
+func (s SeqSet) Complement(min, max uint32) SeqSet {
+	if min == 0 {
+		min = 1
+	}
+	if min > max {
+		return nil
+	}
+	if !s.canonical() {
+		s = s.Canonical()
+	}
+	var out SeqSet
+	next := uint64(min) // next candidate number
+	for _, v := range s {
+		if v.Start == 0 {
+			continue
+		}
+		if uint64(v.Start) > next {
+			out.AddRange(uint32(next), minUint32(v.Start-1, max))
+		}
+		if v.Stop == 0 {
+			return out
+		}
+		if uint64(v.Stop)+1 > next {
+			next = uint64(v.Stop) + 1
+		}
+		if next > uint64(max) {
+			return out
+		}
+	}
+	if next <= uint64(max) {
+		out.AddRange(uint32(next), max)
+	}
+	return out
+}
+
+func minUint32(a, b uint32) uint32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// canonical checks whether the set is sorted and has no overlapping or
+// adjacent values.
+func (s SeqSet) canonical() bool {
+	for i, v := range s {
+		if (v.Stop < v.Start && v.Stop != 0) || (v.Start == 0 && v.Stop != 0) {
+			return false
+		}
+		if i > 0 {
+			prev := s[i-1]
+			if prev.Stop == 0 || (v.Start != 0 && uint64(prev.Stop)+1 >= uint64(v.Start)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // insert adds sequence value v to the set.
 func (ptr *SeqSet) insert(v Seq) {
 	s := *ptr
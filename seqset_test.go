@@ -2,6 +2,7 @@ package imap
 
 import (
 	"math/rand"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -722,3 +723,204 @@ func TestSeqSetAddNumRangeSet(t *testing.T) {
 		}
 	}
 }
+
+func TestParseSeqSetWithOptions(t *testing.T) {
+	tests := []struct {
+		in      string
+		options SeqSetParseOptions
+		ok      bool
+	}{
+		{"1:3,5", SeqSetParseOptions{MaxValues: 2}, true},
+		{"1:3,5,7", SeqSetParseOptions{MaxValues: 2}, false},
+		{"1:10", SeqSetParseOptions{MaxNums: 10}, true},
+		{"1:11", SeqSetParseOptions{MaxNums: 10}, false},
+		{"1:4294967295", SeqSetParseOptions{MaxNums: 1000}, false},
+		{"1:*", SeqSetParseOptions{MaxNums: 10}, true},
+		{"1:5", SeqSetParseOptions{RejectReversed: true}, true},
+		{"5:1", SeqSetParseOptions{RejectReversed: true}, false},
+		{"*:1", SeqSetParseOptions{RejectReversed: true}, false},
+		{"1:*", SeqSetParseOptions{RejectReversed: true}, true},
+		{"5:1", SeqSetParseOptions{}, true},
+	}
+	for _, test := range tests {
+		_, err := ParseSeqSetWithOptions(test.in, &test.options)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("ParseSeqSetWithOptions(%q, %+v) error = %v, want ok = %v", test.in, test.options, err, test.ok)
+		}
+	}
+}
+
+func TestParseSeqSetDefaultLimits(t *testing.T) {
+	limit := DefaultSeqSetParseOptions.MaxValues
+	if _, err := ParseSeqSet(strings.Repeat("1,", limit-1) + "1"); err != nil {
+		t.Errorf("ParseSeqSet(%v values) = %v", limit, err)
+	}
+	if _, err := ParseSeqSet(strings.Repeat("1,", limit) + "1"); err == nil {
+		t.Errorf("ParseSeqSet(%v values) succeeded", limit+1)
+	}
+}
+
+func TestSeqSetNumsMax(t *testing.T) {
+	s := SeqSetRange(max-1, max)
+	nums, ok := s.Nums()
+	if !ok || len(nums) != 2 || nums[0] != max-1 || nums[1] != max {
+		t.Errorf("%q.Nums() = %v, %v", s, nums, ok)
+	}
+}
+
+// randSeqSet returns a random, possibly non-canonical, hand-crafted set.
+func randSeqSet(r *rand.Rand) SeqSet {
+	s := make(SeqSet, r.Intn(8))
+	for i := range s {
+		start, stop := uint32(r.Intn(50)), uint32(r.Intn(50))
+		s[i] = Seq{start, stop}
+	}
+	return s
+}
+
+func TestSeqSetProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		s := randSeqSet(r)
+		c := s.Canonical()
+		checkSeqSet(c, t)
+
+		if cc := c.Canonical(); !reflect.DeepEqual(cc, c) {
+			t.Fatalf("%v.Canonical() not idempotent: %v != %v", s, cc, c)
+		}
+		if str := s.String(); str != c.String() {
+			t.Fatalf("%v.String() = %q, want canonical %q", []Seq(s), str, c.String())
+		}
+		if len(c) == 0 {
+			continue
+		}
+
+		parsed, err := ParseSeqSet(c.String())
+		if err != nil {
+			t.Fatalf("ParseSeqSet(%q) = %v", c, err)
+		}
+		if !reflect.DeepEqual(parsed, c) {
+			t.Fatalf("ParseSeqSet(%q) = %v, want %v", c, parsed, c)
+		}
+
+		for q := uint32(1); q < 60; q++ {
+			want := false
+			for _, v := range s {
+				if v.Start == 0 || v.Stop == 0 {
+					continue // dynamic values need the caller to resolve "*"
+				}
+				lo, hi := v.Start, v.Stop
+				if lo > hi {
+					lo, hi = hi, lo
+				}
+				if lo <= q && q <= hi {
+					want = true
+				}
+			}
+			if want && !c.Contains(q) {
+				t.Fatalf("%q.Contains(%v) = false, want true", c, q)
+			}
+		}
+	}
+}
+
+func TestSeqSetFromNums(t *testing.T) {
+	tests := []struct {
+		nums []uint32
+		out  string
+	}{
+		{nil, ""},
+		{[]uint32{1, 2, 3, 5, 7, 8}, "1:3,5,7:8"},
+		{[]uint32{1, 1, 2, 2, 4}, "1:2,4"},
+		{[]uint32{5, 1, 3, 2}, "1:3,5"},
+		{[]uint32{1, 2, 0}, "1:2,*"},
+		{[]uint32{max - 1, max}, "4294967294:4294967295"},
+	}
+	for _, test := range tests {
+		s := SeqSetFromNums(test.nums)
+		checkSeqSet(s, t)
+		if out := s.String(); out != test.out {
+			t.Errorf("SeqSetFromNums(%v) = %q, want %q", test.nums, out, test.out)
+		}
+	}
+}
+
+func TestSeqSetCoalesce(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxGap uint32
+		out    string
+	}{
+		{"1:3,5,7:8", 0, "1:3,5,7:8"},
+		{"1:3,5,7:8", 1, "1:8"},
+		{"1:3,6,10:12,20:*", 2, "1:6,10:12,20:*"},
+		{"1:3,5:*", 1, "1:*"},
+	}
+	for _, test := range tests {
+		s, _ := ParseSeqSet(test.in)
+		c := s.Coalesce(test.maxGap)
+		checkSeqSet(c, t)
+		if out := c.String(); out != test.out {
+			t.Errorf("%q.Coalesce(%v) = %q, want %q", test.in, test.maxGap, out, test.out)
+		}
+	}
+}
+
+func TestSeqSetSplit(t *testing.T) {
+	s, _ := ParseSeqSet("1,3,5:7,9,11:*")
+	var l []string
+	for _, sub := range s.Split(2) {
+		l = append(l, sub.String())
+	}
+	if want := []string{"1,3", "5:7,9", "11:*"}; !reflect.DeepEqual(l, want) {
+		t.Errorf("%q.Split(2) = %v, want %v", s, l, want)
+	}
+}
+
+func TestSeqSetSplitLength(t *testing.T) {
+	s, _ := ParseSeqSet("1,3,5:7,9,11:*")
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{5, []string{"1,3", "5:7,9", "11:*"}},
+		{2, []string{"1", "3", "5:7", "9", "11:*"}},
+		{100, []string{"1,3,5:7,9,11:*"}},
+	}
+	for _, test := range tests {
+		var l []string
+		for _, sub := range s.SplitLength(test.n) {
+			l = append(l, sub.String())
+		}
+		if !reflect.DeepEqual(l, test.want) {
+			t.Errorf("%q.SplitLength(%v) = %v, want %v", s, test.n, l, test.want)
+		}
+	}
+}
+
+func TestSeqSetComplement(t *testing.T) {
+	tests := []struct {
+		in       string
+		min, max uint32
+		out      string
+	}{
+		{"", 1, 10, "1:10"},
+		{"2:3,5,8:*", 1, 10, "1,4,6:7"},
+		{"1:3,5", 2, 4, "4"},
+		{"1:10", 1, 10, ""},
+		{"*", 1, 3, "1:3"},
+		{"5", 6, 4, ""},
+		{"1:4294967294", 1, max, "4294967295"},
+	}
+	for _, test := range tests {
+		s, _ := ParseSeqSet(test.in)
+		if test.in == "" {
+			s = nil
+		}
+		c := s.Complement(test.min, test.max)
+		checkSeqSet(c, t)
+		if out := c.String(); out != test.out {
+			t.Errorf("%q.Complement(%v, %v) = %q, want %q", test.in, test.min, test.max, out, test.out)
+		}
+	}
+}
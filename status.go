@@ -13,21 +13,29 @@ const (
 
 	StatusItemAppendLimit    StatusItem = "APPENDLIMIT"     // requires APPENDLIMIT
 	StatusItemDeletedStorage StatusItem = "DELETED-STORAGE" // requires QUOTA=RES-STORAGE
+
+	// Deprecated: RECENT has been removed in IMAP4rev2. It's only supported
+	// by IMAP4rev1 servers.
+	StatusItemNumRecent StatusItem = "RECENT"
 )
 
 // StatusData is the data returned by a STATUS command.
 //
 // The mailbox name is always populated. The remaining fields are optional.
 type StatusData struct {
-	Mailbox string
+	Mailbox string `json:"mailbox"`
+
+	NumMessages *uint32 `json:"numMessages,omitempty"`
+	UIDNext     uint32  `json:"uidNext,omitempty"`
+	UIDValidity uint32  `json:"uidValidity,omitempty"`
+	NumUnseen   *uint32 `json:"numUnseen,omitempty"`
+	NumDeleted  *uint32 `json:"numDeleted,omitempty"`
+	Size        *int64  `json:"size,omitempty"`
 
-	NumMessages *uint32
-	UIDNext     uint32
-	UIDValidity uint32
-	NumUnseen   *uint32
-	NumDeleted  *uint32
-	Size        *int64
+	AppendLimit    *uint32 `json:"appendLimit,omitempty"`
+	DeletedStorage *int64  `json:"deletedStorage,omitempty"`
 
-	AppendLimit    *uint32
-	DeletedStorage *int64
+	// Deprecated: RECENT has been removed in IMAP4rev2. It's only returned
+	// by IMAP4rev1 servers.
+	NumRecent *uint32 `json:"numRecent,omitempty"`
 }
@@ -15,3 +15,11 @@ type StoreFlags struct {
 	Silent bool
 	Flags  []Flag
 }
+
+// StoreOptions contains options for the STORE command.
+type StoreOptions struct {
+	// Only alter messages whose mod-sequence is less than or equal to this
+	// value. Messages failing this test are reported via the MODIFIED
+	// response code. Requires CONDSTORE.
+	UnchangedSince uint64
+}
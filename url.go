@@ -0,0 +1,117 @@
+package imap
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URL is an IMAP URL addressing a message or a part of a message, defined in
+// RFC 5092.
+//
+// URLs can be handed to other services instead of copying message data. If
+// Access is set, the URL is a URLAUTH rump which must be authorized by the
+// server with the GENURLAUTH command, defined in RFC 4467.
+type URL struct {
+	// Server host, optionally followed by a port
+	Host string
+	// User name and SASL mechanism, both optional. Auth is "*" for any
+	// mechanism.
+	User string
+	Auth string
+
+	Mailbox     string
+	UIDValidity uint32
+	UID         uint32
+
+	// Body section, the whole message if empty
+	Specifier PartSpecifier
+	Part      []int
+	Partial   *SectionPartial // requires URL-PARTIAL
+
+	// Expiration time of the URLAUTH authorization, optional
+	Expire time.Time
+	// URLAUTH access identifier, e.g. "anonymous", "authuser" or
+	// "submit+fred"
+	Access string
+}
+
+// String formats the URL.
+func (u *URL) String() string {
+	var sb strings.Builder
+	sb.WriteString("imap://")
+	if u.User != "" || u.Auth != "" {
+		sb.WriteString(escapeURL(u.User, urlCharsUser))
+		if u.Auth == "*" {
+			sb.WriteString(";AUTH=*")
+		} else if u.Auth != "" {
+			sb.WriteString(";AUTH=" + escapeURL(u.Auth, urlCharsUser))
+		}
+		sb.WriteByte('@')
+	}
+	sb.WriteString(u.Host)
+	sb.WriteByte('/')
+	sb.WriteString(escapeURL(u.Mailbox, urlCharsMailbox))
+	if u.UIDValidity != 0 {
+		fmt.Fprintf(&sb, ";UIDVALIDITY=%v", u.UIDValidity)
+	}
+	fmt.Fprintf(&sb, "/;UID=%v", u.UID)
+	if section := u.section(); section != "" {
+		sb.WriteString("/;SECTION=" + escapeURL(section, urlCharsMailbox))
+	}
+	if u.Partial != nil {
+		sb.WriteString("/;PARTIAL=" + strconv.FormatInt(u.Partial.Offset, 10))
+		if u.Partial.Size > 0 {
+			sb.WriteString("." + strconv.FormatInt(u.Partial.Size, 10))
+		}
+	}
+	if u.Access != "" {
+		if !u.Expire.IsZero() {
+			sb.WriteString(";EXPIRE=" + u.Expire.UTC().Format(time.RFC3339))
+		}
+		sb.WriteString(";URLAUTH=" + escapeURL(u.Access, urlCharsUser))
+	}
+	return sb.String()
+}
+
+func (u *URL) section() string {
+	l := make([]string, 0, len(u.Part)+1)
+	for _, part := range u.Part {
+		l = append(l, strconv.Itoa(part))
+	}
+	if u.Specifier != PartSpecifierNone {
+		l = append(l, string(u.Specifier))
+	}
+	return strings.Join(l, ".")
+}
+
+const (
+	// achar in RFC 5092, in addition to unreserved characters
+	urlCharsUser = "!$'()*+,&=~"
+	// bchar in RFC 5092, in addition to unreserved characters
+	urlCharsMailbox = urlCharsUser + ":@/"
+)
+
+// escapeURL percent-encodes all characters except unreserved characters and
+// the allowed ones.
+func escapeURL(s, allowed string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		isUnreserved := (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') || strings.IndexByte("-._~", ch) >= 0
+		if isUnreserved || (ch < 0x80 && strings.IndexByte(allowed, ch) >= 0) {
+			sb.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", ch)
+		}
+	}
+	return sb.String()
+}
+
+// URLAuthMechanism is a URLAUTH authorization mechanism.
+type URLAuthMechanism string
+
+// URLAuthMechanismInternal is the authorization mechanism all URLAUTH
+// servers support.
+const URLAuthMechanismInternal URLAuthMechanism = "INTERNAL"
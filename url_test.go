@@ -0,0 +1,50 @@
+package imap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap/v2"
+)
+
+func TestURL_String(t *testing.T) {
+	tests := []struct {
+		url  imap.URL
+		want string
+	}{
+		{
+			url:  imap.URL{Host: "mail.example.org", Mailbox: "INBOX", UID: 42},
+			want: "imap://mail.example.org/INBOX/;UID=42",
+		},
+		{
+			url: imap.URL{
+				Host:        "mail.example.org:143",
+				User:        "fred",
+				Auth:        "*",
+				Mailbox:     "Archive/2024 été",
+				UIDValidity: 1234,
+				UID:         7,
+				Part:        []int{1, 2},
+				Specifier:   imap.PartSpecifierMIME,
+			},
+			want: "imap://fred;AUTH=*@mail.example.org:143/Archive/2024%20%C3%A9t%C3%A9;UIDVALIDITY=1234/;UID=7/;SECTION=1.2.MIME",
+		},
+		{
+			url: imap.URL{
+				Host:    "mail.example.org",
+				User:    "fred@example.org",
+				Mailbox: "a;b",
+				UID:     1,
+				Partial: &imap.SectionPartial{Offset: 0, Size: 1024},
+				Expire:  time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+				Access:  "submit+fred",
+			},
+			want: "imap://fred%40example.org@mail.example.org/a%3Bb/;UID=1/;PARTIAL=0.1024;EXPIRE=2024-03-01T12:00:00Z;URLAUTH=submit+fred",
+		},
+	}
+	for _, tc := range tests {
+		if got := tc.url.String(); got != tc.want {
+			t.Errorf("String() = %q, want %q", got, tc.want)
+		}
+	}
+}